@@ -0,0 +1,377 @@
+// Package client sends events to a Siraaj server from Go programs. Events are
+// buffered and sent in the background in batches through /api/track/batch, with
+// failed requests retried.
+//
+//	c := client.New(client.Config{Endpoint: "https://analytics.example.com", ProjectID: "api"})
+//	defer c.Close(context.Background())
+//	c.Track(ctx, client.Event{EventName: "signup", UserID: user.ID})
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBatchSize is the server's default TRACK_MAX_BATCH_SIZE
+	DefaultBatchSize = 100
+	// DefaultBufferSize is how many events wait to be sent before Track blocks
+	DefaultBufferSize = 10_000
+	// DefaultFlushInterval is how long an event waits for its batch to fill
+	DefaultFlushInterval = 5 * time.Second
+	// DefaultMaxRetries is how many times a failed batch is sent again
+	DefaultMaxRetries = 3
+	// DefaultRetryBackoff is the wait before the first retry, doubled for each
+	// retry after it
+	DefaultRetryBackoff = 500 * time.Millisecond
+	// DefaultTimeout bounds one request of the default HTTP client
+	DefaultTimeout = 10 * time.Second
+)
+
+// ErrClosed is returned by Track and TrackBatch after Close
+var ErrClosed = errors.New("client closed")
+
+// Event is an event as the track endpoints accept it. Fields left empty are filled
+// in by the server: the IP and user id from the request, browser, OS and device
+// from the user agent, and the country from the IP.
+type Event struct {
+	EventID         string    `json:"event_id,omitempty"` // Set by Track when empty, so the server stores retried events once
+	Timestamp       time.Time `json:"timestamp,omitzero"` // Set by Track when zero, events may wait in the buffer
+	EventName       string    `json:"event_name"`
+	UserID          string    `json:"user_id,omitempty"`
+	SessionID       string    `json:"session_id,omitempty"`
+	SessionDuration int       `json:"session_duration,omitempty"` // Seconds
+	URL             string    `json:"url,omitempty"`
+	Referrer        string    `json:"referrer,omitempty"`
+	UserAgent       string    `json:"user_agent,omitempty"`
+	IP              string    `json:"ip,omitempty"` // The end user's address when tracking on their behalf
+	Country         string    `json:"country,omitempty"`
+	Region          string    `json:"region,omitempty"`
+	Language        string    `json:"language,omitempty"`
+	ScreenWidth     int       `json:"screen_width,omitempty"`
+	ScreenHeight    int       `json:"screen_height,omitempty"`
+	Browser         string    `json:"browser,omitempty"`
+	OS              string    `json:"os,omitempty"`
+	Device          string    `json:"device,omitempty"`
+	ProjectID       string    `json:"project_id,omitempty"` // Config.ProjectID when empty
+}
+
+// Config configures a Client. Zero values take the defaults above.
+type Config struct {
+	Endpoint      string        // Base URL of the server, such as https://analytics.example.com
+	ProjectID     string        // Project of events sent without one
+	BatchSize     int           // Events per request, at most the server's TRACK_MAX_BATCH_SIZE
+	BufferSize    int           // Events waiting to be sent before Track blocks
+	FlushInterval time.Duration // Longest wait before a partial batch is sent
+	MaxRetries    int           // Retries of a batch, negative for none
+	RetryBackoff  time.Duration // Wait before the first retry
+	HTTPClient    *http.Client  // Shared so connections are reused, a client with DefaultTimeout by default
+
+	// OnError is called from the sending goroutine with the events a request
+	// failed to deliver: the whole batch after the last retry, or the events the
+	// server rejected as invalid. Errors are dropped when nil.
+	OnError func(err error, events []Event)
+}
+
+// Client buffers events and sends them in batches from a background goroutine.
+// Its methods are safe for concurrent use. Close it to send what is buffered.
+type Client struct {
+	cfg     Config
+	url     string
+	queue   chan Event
+	flushes chan chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	// ctx is cancelled when Close gives up, to abandon requests and retries
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // Closed to stop the sending goroutine
+	exited chan struct{} // Closed once it has stopped
+}
+
+// New returns a Client for cfg and starts its sending goroutine
+func New(cfg Config) *Client {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBufferSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		cfg:     cfg,
+		url:     strings.TrimSuffix(cfg.Endpoint, "/") + "/api/track/batch",
+		queue:   make(chan Event, cfg.BufferSize),
+		flushes: make(chan chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Track queues event to be sent. It blocks while the buffer is full, until ctx
+// is done.
+func (c *Client) Track(ctx context.Context, event Event) error {
+	return c.TrackBatch(ctx, []Event{event})
+}
+
+// TrackBatch queues events to be sent, in order. They are regrouped into batches
+// of Config.BatchSize, so any number of events may be passed. When ctx is done
+// before all are queued, the ones queued are still sent.
+func (c *Client) TrackBatch(ctx context.Context, events []Event) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	now := time.Now()
+	for _, event := range events {
+		if event.Timestamp.IsZero() {
+			event.Timestamp = now
+		}
+		if event.EventID == "" {
+			event.EventID = newEventID()
+		}
+		if event.ProjectID == "" {
+			event.ProjectID = c.cfg.ProjectID
+		}
+		select {
+		case c.queue <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// newEventID returns a random id for an event
+func newEventID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Flush sends the events queued so far and waits until they are delivered or
+// given up on, or until ctx is done
+func (c *Client) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case c.flushes <- flushed:
+	case <-c.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting events and sends the ones buffered. When ctx is done first
+// the remaining requests and retries are abandoned and its error returned.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.exited:
+		return nil
+	case <-ctx.Done():
+		c.cancel()
+		<-c.exited
+		return ctx.Err()
+	}
+}
+
+// run is the sending goroutine: it fills batches from the queue and sends them
+// when full, on every FlushInterval, on Flush and on Close
+func (c *Client) run() {
+	defer close(c.exited)
+	defer c.cancel()
+
+	ticker := time.NewTicker(c.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, c.cfg.BatchSize)
+	add := func(event Event) {
+		batch = append(batch, event)
+		if len(batch) == c.cfg.BatchSize {
+			c.send(batch)
+			batch = batch[:0]
+		}
+	}
+	// drain sends everything queued when called, leaving later events queued
+	drain := func() {
+		for n := len(c.queue); n > 0; n-- {
+			add(<-c.queue)
+		}
+		if len(batch) > 0 {
+			c.send(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case event := <-c.queue:
+			add(event)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				c.send(batch)
+				batch = batch[:0]
+			}
+		case flushed := <-c.flushes:
+			drain()
+			close(flushed)
+		case <-c.done:
+			// Track holds the read lock while queueing, so once closed nothing is
+			// added after this drain
+			drain()
+			return
+		}
+	}
+}
+
+// batchResponse is the body of a /api/track/batch response
+type batchResponse struct {
+	Status string `json:"status"`
+	Errors []struct {
+		Index int    `json:"index"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+// send delivers batch, retrying failures the server may recover from, and reports
+// what could not be delivered to OnError
+func (c *Client) send(batch []Event) {
+	body, err := json.Marshal(map[string][]Event{"events": batch})
+	if err != nil {
+		c.report(fmt.Errorf("failed to encode events: %w", err), batch)
+		return
+	}
+
+	backoff := c.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		response, retryAfter, err := c.post(body)
+		if err == nil {
+			c.reportRejected(response, batch)
+			return
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= c.cfg.MaxRetries || c.ctx.Err() != nil {
+			c.report(err, batch)
+			return
+		}
+
+		wait := max(backoff, retryAfter)
+		backoff *= 2
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+			timer.Stop()
+			c.report(c.ctx.Err(), batch)
+			return
+		}
+	}
+}
+
+// permanentError is a response that sending again would not change
+type permanentError struct {
+	status  int
+	message string
+}
+
+func (e *permanentError) Error() string {
+	return fmt.Sprintf("server rejected events: %d %s", e.status, e.message)
+}
+
+// post sends one request. Network errors, 429 and 5xx responses are retryable;
+// with them it returns the wait the server asked for in Retry-After, if any.
+func (c *Client) post(body []byte) (*batchResponse, time.Duration, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, &permanentError{message: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	// Read to the end so the connection is reused
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusMultiStatus:
+		var response batchResponse
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, 0, &permanentError{status: resp.StatusCode, message: "invalid response: " + err.Error()}
+		}
+		return &response, 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, retryAfter, fmt.Errorf("server unavailable: %d %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil, 0, &permanentError{status: resp.StatusCode, message: strings.TrimSpace(string(data))}
+}
+
+// reportRejected reports the events of a partially accepted batch that the server
+// rejected as invalid
+func (c *Client) reportRejected(response *batchResponse, batch []Event) {
+	for _, rejected := range response.Errors {
+		if rejected.Index >= 0 && rejected.Index < len(batch) {
+			c.report(fmt.Errorf("server rejected event: %s", rejected.Error), batch[rejected.Index:rejected.Index+1])
+		}
+	}
+}
+
+func (c *Client) report(err error, events []Event) {
+	if c.cfg.OnError != nil {
+		c.cfg.OnError(err, append([]Event(nil), events...))
+	}
+}
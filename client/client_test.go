@@ -0,0 +1,284 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a fake track endpoint that records the batches it receives and
+// answers with the next of its responses, repeating the last one
+type recorder struct {
+	mu        sync.Mutex
+	batches   [][]Event
+	responses []func(w http.ResponseWriter)
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/track/batch" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	var body struct {
+		Events []Event `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rec.mu.Lock()
+	rec.batches = append(rec.batches, body.Events)
+	respond := accepted
+	if n := len(rec.batches); len(rec.responses) > 0 {
+		respond = rec.responses[min(n, len(rec.responses))-1]
+	}
+	rec.mu.Unlock()
+	respond(w)
+}
+
+func (rec *recorder) received() [][]Event {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.batches
+}
+
+func accepted(w http.ResponseWriter) {
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+func status(code int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		http.Error(w, `{"error":"failed"}`, code)
+	}
+}
+
+// failures collects what a client reports to OnError
+type failures struct {
+	mu     sync.Mutex
+	errs   []error
+	events [][]Event
+}
+
+func (f *failures) onError(err error, events []Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, err)
+	f.events = append(f.events, events)
+}
+
+func newTestClient(t *testing.T, rec *recorder, cfg Config) (*Client, *failures) {
+	t.Helper()
+	server := httptest.NewServer(rec)
+	t.Cleanup(server.Close)
+
+	f := &failures{}
+	cfg.Endpoint = server.URL + "/"
+	cfg.OnError = f.onError
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = time.Millisecond
+	}
+	c := New(cfg)
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c, f
+}
+
+func TestTrackBatchesEvents(t *testing.T) {
+	rec := &recorder{}
+	c, f := newTestClient(t, rec, Config{ProjectID: "api", BatchSize: 2, FlushInterval: time.Hour})
+	ctx := context.Background()
+
+	sent := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := c.Track(ctx, Event{EventName: "signup", Timestamp: sent, ProjectID: "web"}); err != nil {
+		t.Fatalf("Track failed: %v", err)
+	}
+	if err := c.TrackBatch(ctx, []Event{{EventName: "a"}, {EventName: "b"}, {EventName: "c"}, {EventName: "d"}}); err != nil {
+		t.Fatalf("TrackBatch failed: %v", err)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	batches := rec.received()
+	var sizes []int
+	var names []string
+	for _, batch := range batches {
+		sizes = append(sizes, len(batch))
+		for _, event := range batch {
+			names = append(names, event.EventName)
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Fatalf("Expected batches of 2, 2 and 1 events, got %v", sizes)
+	}
+	if expected := []string{"signup", "a", "b", "c", "d"}; len(names) != len(expected) || names[0] != "signup" || names[4] != "d" {
+		t.Errorf("Expected events in order %v, got %v", expected, names)
+	}
+
+	first, second := batches[0][0], batches[0][1]
+	if !first.Timestamp.Equal(sent) || first.ProjectID != "web" {
+		t.Errorf("Expected the event's own timestamp and project, got %v and %q", first.Timestamp, first.ProjectID)
+	}
+	if second.Timestamp.IsZero() || second.ProjectID != "api" {
+		t.Errorf("Expected a tracking timestamp and the default project, got %v and %q", second.Timestamp, second.ProjectID)
+	}
+	if second.EventID == "" || second.EventID == first.EventID {
+		t.Errorf("Expected distinct event ids, got %q and %q", first.EventID, second.EventID)
+	}
+	if len(f.errs) != 0 {
+		t.Errorf("Expected no errors, got %v", f.errs)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	rec := &recorder{}
+	c, _ := newTestClient(t, rec, Config{FlushInterval: time.Hour})
+	ctx := context.Background()
+
+	if err := c.Track(ctx, Event{EventName: "page_view"}); err != nil {
+		t.Fatalf("Track failed: %v", err)
+	}
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if batches := rec.received(); len(batches) != 1 || len(batches[0]) != 1 {
+		t.Errorf("Expected the event to be sent by Flush, got %v", batches)
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	rec := &recorder{}
+	c, _ := newTestClient(t, rec, Config{FlushInterval: 10 * time.Millisecond})
+
+	if err := c.Track(context.Background(), Event{EventName: "page_view"}); err != nil {
+		t.Fatalf("Track failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a partial batch to be sent on the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliveryFailures(t *testing.T) {
+	partial := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"status":"partial","errors":[{"index":1,"error":"event_name is required"}]}`))
+	}
+
+	tests := []struct {
+		name             string
+		responses        []func(w http.ResponseWriter)
+		maxRetries       int
+		expectedRequests int
+		expectedFailed   []string // Event names reported to OnError
+	}{
+		{"Retried until accepted", []func(http.ResponseWriter){status(503), status(429), accepted}, 3, 3, nil},
+		{"Retries exhausted", []func(http.ResponseWriter){status(500)}, 2, 3, []string{"a", "b"}},
+		{"Retries disabled", []func(http.ResponseWriter){status(500)}, -1, 1, []string{"a", "b"}},
+		{"Client errors are not retried", []func(http.ResponseWriter){status(400)}, 3, 1, []string{"a", "b"}},
+		{"Rejected events reported", []func(http.ResponseWriter){partial}, 3, 1, []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{responses: tt.responses}
+			c, f := newTestClient(t, rec, Config{MaxRetries: tt.maxRetries, FlushInterval: time.Hour})
+			ctx := context.Background()
+
+			if err := c.TrackBatch(ctx, []Event{{EventName: "a"}, {EventName: "b"}}); err != nil {
+				t.Fatalf("TrackBatch failed: %v", err)
+			}
+			if err := c.Flush(ctx); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			batches := rec.received()
+			if len(batches) != tt.expectedRequests {
+				t.Errorf("Expected %d requests, got %d", tt.expectedRequests, len(batches))
+			}
+			for _, batch := range batches[1:] {
+				if batch[0].EventID != batches[0][0].EventID {
+					t.Errorf("Expected retries to send the same event ids, got %q and %q", batches[0][0].EventID, batch[0].EventID)
+				}
+			}
+			var failed []string
+			for _, events := range f.events {
+				for _, event := range events {
+					failed = append(failed, event.EventName)
+				}
+			}
+			if len(failed) != len(tt.expectedFailed) {
+				t.Fatalf("Expected %v to fail, got %v (%v)", tt.expectedFailed, failed, f.errs)
+			}
+			for i := range failed {
+				if failed[i] != tt.expectedFailed[i] {
+					t.Errorf("Expected %v to fail, got %v", tt.expectedFailed, failed)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackAfterClose(t *testing.T) {
+	c, _ := newTestClient(t, &recorder{}, Config{})
+	ctx := context.Background()
+
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := c.Track(ctx, Event{EventName: "late"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if err := c.Flush(ctx); err != nil {
+		t.Errorf("Expected Flush after Close to do nothing, got %v", err)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Errorf("Expected a second Close to succeed, got %v", err)
+	}
+}
+
+func TestCloseGivesUp(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	stuck := func(w http.ResponseWriter) { <-release }
+
+	rec := &recorder{responses: []func(http.ResponseWriter){stuck}}
+	c, f := newTestClient(t, rec, Config{FlushInterval: time.Hour})
+
+	if err := c.Track(context.Background(), Event{EventName: "a"}); err != nil {
+		t.Fatalf("Track failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to give up with the context, got %v", err)
+	}
+	if len(f.events) != 1 || len(f.events[0]) != 1 {
+		t.Errorf("Expected the abandoned event to be reported, got %v", f.events)
+	}
+}
+
+func TestTrackWhileBufferFull(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	stuck := func(w http.ResponseWriter) { <-release }
+
+	rec := &recorder{responses: []func(http.ResponseWriter){stuck}}
+	c, _ := newTestClient(t, rec, Config{BatchSize: 1, BufferSize: 1, FlushInterval: time.Hour})
+
+	// The first event is stuck in a request and the second fills the buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.TrackBatch(ctx, []Event{{EventName: "a"}, {EventName: "b"}, {EventName: "c"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Track to stop waiting for the full buffer, got %v", err)
+	}
+}
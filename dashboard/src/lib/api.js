@@ -171,8 +171,8 @@ export async function fetchFunnelAnalysis(funnelRequest) {
         body: JSON.stringify(funnelRequest),
     });
     if (!response.ok) {
-        const errorText = await response.text();
-        throw new Error(`Failed to fetch funnel analysis: ${errorText || response.statusText}`);
+        const errorBody = await response.json().catch(() => ({}));
+        throw new Error(`Failed to fetch funnel analysis: ${errorBody.error?.message || response.statusText}`);
     }
     return response.json();
 }
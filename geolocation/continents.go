@@ -0,0 +1,313 @@
+package geolocation
+
+import "strings"
+
+// Continent names returned by Continent
+const (
+	Africa       = "Africa"
+	Antarctica   = "Antarctica"
+	Asia         = "Asia"
+	Europe       = "Europe"
+	NorthAmerica = "North America"
+	Oceania      = "Oceania"
+	SouthAmerica = "South America"
+	// UnknownContinent is returned for countries that are not in the table
+	UnknownContinent = "Unknown"
+)
+
+// country is a row of the country to continent table. Name is the English name
+// the geolocation database uses, aliases are other names clients send.
+type country struct {
+	code      string
+	name      string
+	continent string
+	aliases   []string
+}
+
+// countries maps ISO 3166-1 countries to continents, following GeoNames. Countries
+// spanning two continents are listed under the one GeoNames assigns.
+var countries = []country{
+	{"AD", "Andorra", Europe, nil},
+	{"AE", "United Arab Emirates", Asia, []string{"UAE"}},
+	{"AF", "Afghanistan", Asia, nil},
+	{"AG", "Antigua and Barbuda", NorthAmerica, nil},
+	{"AI", "Anguilla", NorthAmerica, nil},
+	{"AL", "Albania", Europe, nil},
+	{"AM", "Armenia", Asia, nil},
+	{"AO", "Angola", Africa, nil},
+	{"AQ", "Antarctica", Antarctica, nil},
+	{"AR", "Argentina", SouthAmerica, nil},
+	{"AS", "American Samoa", Oceania, nil},
+	{"AT", "Austria", Europe, nil},
+	{"AU", "Australia", Oceania, nil},
+	{"AW", "Aruba", NorthAmerica, nil},
+	{"AX", "Åland", Europe, []string{"Aland Islands", "Åland Islands"}},
+	{"AZ", "Azerbaijan", Asia, nil},
+	{"BA", "Bosnia and Herzegovina", Europe, nil},
+	{"BB", "Barbados", NorthAmerica, nil},
+	{"BD", "Bangladesh", Asia, nil},
+	{"BE", "Belgium", Europe, nil},
+	{"BF", "Burkina Faso", Africa, nil},
+	{"BG", "Bulgaria", Europe, nil},
+	{"BH", "Bahrain", Asia, nil},
+	{"BI", "Burundi", Africa, nil},
+	{"BJ", "Benin", Africa, nil},
+	{"BL", "Saint Barthélemy", NorthAmerica, nil},
+	{"BM", "Bermuda", NorthAmerica, nil},
+	{"BN", "Brunei", Asia, []string{"Brunei Darussalam"}},
+	{"BO", "Bolivia", SouthAmerica, nil},
+	{"BQ", "Bonaire, Sint Eustatius, and Saba", NorthAmerica, nil},
+	{"BR", "Brazil", SouthAmerica, nil},
+	{"BS", "Bahamas", NorthAmerica, nil},
+	{"BT", "Bhutan", Asia, nil},
+	{"BV", "Bouvet Island", Antarctica, nil},
+	{"BW", "Botswana", Africa, nil},
+	{"BY", "Belarus", Europe, nil},
+	{"BZ", "Belize", NorthAmerica, nil},
+	{"CA", "Canada", NorthAmerica, nil},
+	{"CC", "Cocos (Keeling) Islands", Asia, nil},
+	{"CD", "DR Congo", Africa, []string{"Democratic Republic of the Congo", "Congo, The Democratic Republic of the"}},
+	{"CF", "Central African Republic", Africa, nil},
+	{"CG", "Congo Republic", Africa, []string{"Republic of the Congo", "Congo"}},
+	{"CH", "Switzerland", Europe, nil},
+	{"CI", "Ivory Coast", Africa, []string{"Côte d'Ivoire", "Cote d'Ivoire"}},
+	{"CK", "Cook Islands", Oceania, nil},
+	{"CL", "Chile", SouthAmerica, nil},
+	{"CM", "Cameroon", Africa, nil},
+	{"CN", "China", Asia, nil},
+	{"CO", "Colombia", SouthAmerica, nil},
+	{"CR", "Costa Rica", NorthAmerica, nil},
+	{"CU", "Cuba", NorthAmerica, nil},
+	{"CV", "Cabo Verde", Africa, []string{"Cape Verde"}},
+	{"CW", "Curaçao", NorthAmerica, []string{"Curacao"}},
+	{"CX", "Christmas Island", Oceania, nil},
+	{"CY", "Cyprus", Europe, nil},
+	{"CZ", "Czechia", Europe, []string{"Czech Republic"}},
+	{"DE", "Germany", Europe, nil},
+	{"DJ", "Djibouti", Africa, nil},
+	{"DK", "Denmark", Europe, nil},
+	{"DM", "Dominica", NorthAmerica, nil},
+	{"DO", "Dominican Republic", NorthAmerica, nil},
+	{"DZ", "Algeria", Africa, nil},
+	{"EC", "Ecuador", SouthAmerica, nil},
+	{"EE", "Estonia", Europe, nil},
+	{"EG", "Egypt", Africa, nil},
+	{"EH", "Western Sahara", Africa, nil},
+	{"ER", "Eritrea", Africa, nil},
+	{"ES", "Spain", Europe, nil},
+	{"ET", "Ethiopia", Africa, nil},
+	{"FI", "Finland", Europe, nil},
+	{"FJ", "Fiji", Oceania, nil},
+	{"FK", "Falkland Islands", SouthAmerica, nil},
+	{"FM", "Federated States of Micronesia", Oceania, []string{"Micronesia"}},
+	{"FO", "Faroe Islands", Europe, nil},
+	{"FR", "France", Europe, nil},
+	{"GA", "Gabon", Africa, nil},
+	{"GB", "United Kingdom", Europe, []string{"UK", "Great Britain"}},
+	{"GD", "Grenada", NorthAmerica, nil},
+	{"GE", "Georgia", Asia, nil},
+	{"GF", "French Guiana", SouthAmerica, nil},
+	{"GG", "Guernsey", Europe, nil},
+	{"GH", "Ghana", Africa, nil},
+	{"GI", "Gibraltar", Europe, nil},
+	{"GL", "Greenland", NorthAmerica, nil},
+	{"GM", "Gambia", Africa, nil},
+	{"GN", "Guinea", Africa, nil},
+	{"GP", "Guadeloupe", NorthAmerica, nil},
+	{"GQ", "Equatorial Guinea", Africa, nil},
+	{"GR", "Greece", Europe, nil},
+	{"GS", "South Georgia and the South Sandwich Islands", Antarctica, nil},
+	{"GT", "Guatemala", NorthAmerica, nil},
+	{"GU", "Guam", Oceania, nil},
+	{"GW", "Guinea-Bissau", Africa, nil},
+	{"GY", "Guyana", SouthAmerica, nil},
+	{"HK", "Hong Kong", Asia, nil},
+	{"HM", "Heard Island and McDonald Islands", Antarctica, nil},
+	{"HN", "Honduras", NorthAmerica, nil},
+	{"HR", "Croatia", Europe, nil},
+	{"HT", "Haiti", NorthAmerica, nil},
+	{"HU", "Hungary", Europe, nil},
+	{"ID", "Indonesia", Asia, nil},
+	{"IE", "Ireland", Europe, nil},
+	{"IL", "Israel", Asia, nil},
+	{"IM", "Isle of Man", Europe, nil},
+	{"IN", "India", Asia, nil},
+	{"IO", "British Indian Ocean Territory", Asia, nil},
+	{"IQ", "Iraq", Asia, nil},
+	{"IR", "Iran", Asia, []string{"Islamic Republic of Iran"}},
+	{"IS", "Iceland", Europe, nil},
+	{"IT", "Italy", Europe, nil},
+	{"JE", "Jersey", Europe, nil},
+	{"JM", "Jamaica", NorthAmerica, nil},
+	{"JO", "Jordan", Asia, nil},
+	{"JP", "Japan", Asia, nil},
+	{"KE", "Kenya", Africa, nil},
+	{"KG", "Kyrgyzstan", Asia, nil},
+	{"KH", "Cambodia", Asia, nil},
+	{"KI", "Kiribati", Oceania, nil},
+	{"KM", "Comoros", Africa, nil},
+	{"KN", "St Kitts and Nevis", NorthAmerica, []string{"Saint Kitts and Nevis"}},
+	{"KP", "North Korea", Asia, nil},
+	{"KR", "South Korea", Asia, []string{"Korea", "Republic of Korea"}},
+	{"KW", "Kuwait", Asia, nil},
+	{"KY", "Cayman Islands", NorthAmerica, nil},
+	{"KZ", "Kazakhstan", Asia, nil},
+	{"LA", "Laos", Asia, nil},
+	{"LB", "Lebanon", Asia, nil},
+	{"LC", "Saint Lucia", NorthAmerica, nil},
+	{"LI", "Liechtenstein", Europe, nil},
+	{"LK", "Sri Lanka", Asia, nil},
+	{"LR", "Liberia", Africa, nil},
+	{"LS", "Lesotho", Africa, nil},
+	{"LT", "Lithuania", Europe, []string{"Republic of Lithuania"}},
+	{"LU", "Luxembourg", Europe, nil},
+	{"LV", "Latvia", Europe, nil},
+	{"LY", "Libya", Africa, nil},
+	{"MA", "Morocco", Africa, nil},
+	{"MC", "Monaco", Europe, nil},
+	{"MD", "Moldova", Europe, []string{"Republic of Moldova"}},
+	{"ME", "Montenegro", Europe, nil},
+	{"MF", "Saint Martin", NorthAmerica, nil},
+	{"MG", "Madagascar", Africa, nil},
+	{"MH", "Marshall Islands", Oceania, nil},
+	{"MK", "North Macedonia", Europe, []string{"Macedonia"}},
+	{"ML", "Mali", Africa, nil},
+	{"MM", "Myanmar", Asia, []string{"Burma"}},
+	{"MN", "Mongolia", Asia, nil},
+	{"MO", "Macao", Asia, []string{"Macau"}},
+	{"MP", "Northern Mariana Islands", Oceania, nil},
+	{"MQ", "Martinique", NorthAmerica, nil},
+	{"MR", "Mauritania", Africa, nil},
+	{"MS", "Montserrat", NorthAmerica, nil},
+	{"MT", "Malta", Europe, nil},
+	{"MU", "Mauritius", Africa, nil},
+	{"MV", "Maldives", Asia, nil},
+	{"MW", "Malawi", Africa, nil},
+	{"MX", "Mexico", NorthAmerica, nil},
+	{"MY", "Malaysia", Asia, nil},
+	{"MZ", "Mozambique", Africa, nil},
+	{"NA", "Namibia", Africa, nil},
+	{"NC", "New Caledonia", Oceania, nil},
+	{"NE", "Niger", Africa, nil},
+	{"NF", "Norfolk Island", Oceania, nil},
+	{"NG", "Nigeria", Africa, nil},
+	{"NI", "Nicaragua", NorthAmerica, nil},
+	{"NL", "The Netherlands", Europe, []string{"Netherlands"}},
+	{"NO", "Norway", Europe, nil},
+	{"NP", "Nepal", Asia, nil},
+	{"NR", "Nauru", Oceania, nil},
+	{"NU", "Niue", Oceania, nil},
+	{"NZ", "New Zealand", Oceania, nil},
+	{"OM", "Oman", Asia, nil},
+	{"PA", "Panama", NorthAmerica, nil},
+	{"PE", "Peru", SouthAmerica, nil},
+	{"PF", "French Polynesia", Oceania, nil},
+	{"PG", "Papua New Guinea", Oceania, nil},
+	{"PH", "Philippines", Asia, nil},
+	{"PK", "Pakistan", Asia, nil},
+	{"PL", "Poland", Europe, nil},
+	{"PM", "Saint Pierre and Miquelon", NorthAmerica, nil},
+	{"PN", "Pitcairn Islands", Oceania, nil},
+	{"PR", "Puerto Rico", NorthAmerica, nil},
+	{"PS", "Palestine", Asia, []string{"State of Palestine", "Palestinian Territory", "Palestinian Territories"}},
+	{"PT", "Portugal", Europe, nil},
+	{"PW", "Palau", Oceania, nil},
+	{"PY", "Paraguay", SouthAmerica, nil},
+	{"QA", "Qatar", Asia, nil},
+	{"RE", "Réunion", Africa, []string{"Reunion"}},
+	{"RO", "Romania", Europe, nil},
+	{"RS", "Serbia", Europe, nil},
+	{"RU", "Russia", Europe, []string{"Russian Federation"}},
+	{"RW", "Rwanda", Africa, nil},
+	{"SA", "Saudi Arabia", Asia, nil},
+	{"SB", "Solomon Islands", Oceania, nil},
+	{"SC", "Seychelles", Africa, nil},
+	{"SD", "Sudan", Africa, nil},
+	{"SE", "Sweden", Europe, nil},
+	{"SG", "Singapore", Asia, nil},
+	{"SH", "Saint Helena", Africa, nil},
+	{"SI", "Slovenia", Europe, nil},
+	{"SJ", "Svalbard and Jan Mayen", Europe, nil},
+	{"SK", "Slovakia", Europe, nil},
+	{"SL", "Sierra Leone", Africa, nil},
+	{"SM", "San Marino", Europe, nil},
+	{"SN", "Senegal", Africa, nil},
+	{"SO", "Somalia", Africa, nil},
+	{"SR", "Suriname", SouthAmerica, nil},
+	{"SS", "South Sudan", Africa, nil},
+	{"ST", "São Tomé and Príncipe", Africa, []string{"Sao Tome and Principe"}},
+	{"SV", "El Salvador", NorthAmerica, nil},
+	{"SX", "Sint Maarten", NorthAmerica, nil},
+	{"SY", "Syria", Asia, []string{"Syrian Arab Republic"}},
+	{"SZ", "Eswatini", Africa, []string{"Swaziland"}},
+	{"TC", "Turks and Caicos Islands", NorthAmerica, nil},
+	{"TD", "Chad", Africa, nil},
+	{"TF", "French Southern Territories", Antarctica, nil},
+	{"TG", "Togo", Africa, nil},
+	{"TH", "Thailand", Asia, nil},
+	{"TJ", "Tajikistan", Asia, nil},
+	{"TK", "Tokelau", Oceania, nil},
+	{"TL", "Timor-Leste", Oceania, []string{"East Timor"}},
+	{"TM", "Turkmenistan", Asia, nil},
+	{"TN", "Tunisia", Africa, nil},
+	{"TO", "Tonga", Oceania, nil},
+	{"TR", "Türkiye", Asia, []string{"Turkey"}},
+	{"TT", "Trinidad and Tobago", NorthAmerica, nil},
+	{"TV", "Tuvalu", Oceania, nil},
+	{"TW", "Taiwan", Asia, nil},
+	{"TZ", "Tanzania", Africa, nil},
+	{"UA", "Ukraine", Europe, nil},
+	{"UG", "Uganda", Africa, nil},
+	{"UM", "U.S. Outlying Islands", Oceania, nil},
+	{"US", "United States", NorthAmerica, []string{"USA", "United States of America"}},
+	{"UY", "Uruguay", SouthAmerica, nil},
+	{"UZ", "Uzbekistan", Asia, nil},
+	{"VA", "Vatican City", Europe, []string{"Holy See"}},
+	{"VC", "St Vincent and Grenadines", NorthAmerica, []string{"Saint Vincent and the Grenadines"}},
+	{"VE", "Venezuela", SouthAmerica, nil},
+	{"VG", "British Virgin Islands", NorthAmerica, nil},
+	{"VI", "U.S. Virgin Islands", NorthAmerica, nil},
+	{"VN", "Vietnam", Asia, []string{"Viet Nam"}},
+	{"VU", "Vanuatu", Oceania, nil},
+	{"WF", "Wallis and Futuna", Oceania, nil},
+	{"WS", "Samoa", Oceania, nil},
+	{"XK", "Kosovo", Europe, nil},
+	{"YE", "Yemen", Asia, nil},
+	{"YT", "Mayotte", Africa, nil},
+	{"ZA", "South Africa", Africa, nil},
+	{"ZM", "Zambia", Africa, nil},
+	{"ZW", "Zimbabwe", Africa, nil},
+}
+
+// continentIndex maps lowercased codes, names and aliases to continents
+var continentIndex = func() map[string]string {
+	index := make(map[string]string, len(countries)*3)
+	for _, c := range countries {
+		index[strings.ToLower(c.code)] = c.continent
+		index[strings.ToLower(c.name)] = c.continent
+		for _, alias := range c.aliases {
+			index[strings.ToLower(alias)] = c.continent
+		}
+	}
+	return index
+}()
+
+// Continent returns the continent of a country given by ISO code, English name or
+// a common alias, ignoring case. Unknown countries, including the "Unknown",
+// "Local" and "XX" placeholders of LookupOrDefault, give UnknownContinent.
+func Continent(country string) string {
+	if continent, ok := continentIndex[strings.ToLower(strings.TrimSpace(country))]; ok {
+		return continent
+	}
+	return UnknownContinent
+}
+
+// ContinentIndex returns the lowercased country keys Continent accepts, mapped to
+// their continents, for matching stored countries in queries
+func ContinentIndex() map[string]string {
+	index := make(map[string]string, len(continentIndex))
+	for key, continent := range continentIndex {
+		index[key] = continent
+	}
+	return index
+}
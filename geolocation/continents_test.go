@@ -0,0 +1,67 @@
+package geolocation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContinent(t *testing.T) {
+	tests := []struct {
+		country  string
+		expected string
+	}{
+		{"Egypt", Africa},
+		{"EG", Africa},
+		{"Germany", Europe},
+		{"United States", NorthAmerica},
+		{"USA", NorthAmerica},
+		{"Brazil", SouthAmerica},
+		{"Australia", Oceania},
+		{"Japan", Asia},
+		// Lookup reports Israeli IPs as Palestine, both map to Asia
+		{"Palestine", Asia},
+		{"PS", Asia},
+		{"State of Palestine", Asia},
+		{"Israel", Asia},
+		// Transcontinental countries follow GeoNames
+		{"Russia", Europe},
+		{"Türkiye", Asia},
+		{"Turkey", Asia},
+		// Case, whitespace and accents
+		{"  the netherlands ", Europe},
+		{"Côte d'Ivoire", Africa},
+		{"Cote d'Ivoire", Africa},
+		{"Timor-Leste", Oceania},
+		// Placeholders and unknowns
+		{"Unknown", UnknownContinent},
+		{"XX", UnknownContinent},
+		{"", UnknownContinent},
+		{"Atlantis", UnknownContinent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.country, func(t *testing.T) {
+			if got := Continent(tt.country); got != tt.expected {
+				t.Errorf("Continent(%q) = %q, expected %q", tt.country, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestContinentTableKeysAreUnambiguous(t *testing.T) {
+	seen := make(map[string]string)
+	for _, c := range countries {
+		keys := append([]string{c.code, c.name}, c.aliases...)
+		for _, key := range keys {
+			key = strings.ToLower(key)
+			if other, ok := seen[key]; ok {
+				t.Errorf("%q is used by both %s and %s", key, other, c.code)
+			}
+			seen[key] = c.code
+		}
+	}
+
+	if len(ContinentIndex()) != len(seen) {
+		t.Errorf("Expected %d index entries, got %d", len(seen), len(ContinentIndex()))
+	}
+}
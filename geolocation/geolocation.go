@@ -2,6 +2,7 @@ package geolocation
 
 import (
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,6 +10,8 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/oschwald/maxminddb-golang/v2"
@@ -20,43 +23,225 @@ const (
 	geoDBPath     = geoDBDir + "/" + geoDBFilename
 )
 
-// GeoLocation represents geographic location data
+// GeoLocation represents geographic location data. Region and City are only
+// filled in by databases with city data; the default country database has neither.
 type GeoLocation struct {
 	Country     string `json:"country"`
 	CountryCode string `json:"country_code"`
+	Region      string `json:"region"`      // Largest subdivision, e.g. state or province
+	RegionCode  string `json:"region_code"` // ISO 3166-2 code of Region, without the country prefix
 	City        string `json:"city"`
 }
 
+// DefaultUpdateInterval is how often the service checks for a newer monthly DB-IP
+// release unless GEODB_UPDATE_INTERVAL says otherwise
+const DefaultUpdateInterval = 24 * time.Hour
+
+// updateInterval reads GEODB_UPDATE_INTERVAL, falling back to DefaultUpdateInterval
+// for missing or invalid values. Zero turns automatic updates off.
+func updateInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("GEODB_UPDATE_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultUpdateInterval
+}
+
+// reader is the database lookups go through, a *maxminddb.Reader outside tests
+type reader interface {
+	lookup(ip netip.Addr, record any) error
+	Close() error
+}
+
+type mmdbReader struct {
+	*maxminddb.Reader
+}
+
+func (r mmdbReader) lookup(ip netip.Addr, record any) error {
+	return r.Lookup(ip).Decode(record)
+}
+
+// Record layouts GEODB_TYPE selects between
+const (
+	LayoutDBIP    = "dbip"
+	LayoutMaxMind = "maxmind"
+)
+
+// databaseLayout returns the record layout lookups decode: configured, from
+// GEODB_TYPE, when set, otherwise the one dbType names. MaxMind reserves database
+// types starting with GeoIP, and names its free databases GeoLite.
+func databaseLayout(configured, dbType string) (string, error) {
+	switch strings.ToLower(configured) {
+	case LayoutDBIP:
+		return LayoutDBIP, nil
+	case LayoutMaxMind:
+		return LayoutMaxMind, nil
+	case "":
+		if strings.HasPrefix(dbType, "GeoIP") || strings.HasPrefix(dbType, "GeoLite") {
+			return LayoutMaxMind, nil
+		}
+		return LayoutDBIP, nil
+	}
+	return "", fmt.Errorf("unknown GEODB_TYPE %q, expected %s or %s", configured, LayoutDBIP, LayoutMaxMind)
+}
+
 // Service handles IP geolocation lookups
 type Service struct {
-	db *maxminddb.Reader
+	layout string // LayoutDBIP or LayoutMaxMind
+
+	// mu guards db: lookups hold it for reading, so an update swaps the reader and
+	// closes the old one only once no lookup is using it
+	mu sync.RWMutex
+	db reader
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-// NewService creates a new geolocation service
+// NewService creates a new geolocation service. GEODB_PATH selects another MaxMind
+// format database, such as a city database for region lookups or a commercial
+// GeoIP2 database, and GEODB_TYPE its record layout when the database type does
+// not tell; only the default country database is downloaded when missing, and
+// kept up to date by checking for a newer monthly release every
+// GEODB_UPDATE_INTERVAL.
 func NewService() (*Service, error) {
-	// Ensure database exists
-	if err := ensureDatabase(); err != nil {
-		return nil, fmt.Errorf("failed to ensure geolocation database: %w", err)
+	path := os.Getenv("GEODB_PATH")
+	if path == "" {
+		// Ensure database exists
+		if err := ensureDatabase(); err != nil {
+			return nil, fmt.Errorf("failed to ensure geolocation database: %w", err)
+		}
+		path = geoDBPath
 	}
 
 	// Open the database
-	db, err := maxminddb.Open(geoDBPath)
+	db, err := maxminddb.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open geolocation database: %w", err)
 	}
 
-	log.Println("✓ Geolocation database loaded successfully")
-	return &Service{db: db}, nil
+	layout, err := databaseLayout(os.Getenv("GEODB_TYPE"), db.Metadata.DatabaseType)
+	if err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			log.Printf("Warning: failed to close geolocation database: %v", closeErr)
+		}
+		return nil, err
+	}
+
+	log.Printf("✓ Geolocation database loaded successfully (%s, %s layout)", db.Metadata.DatabaseType, layout)
+	s := &Service{layout: layout, db: mmdbReader{db}}
+	if interval := updateInterval(); path == geoDBPath && interval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.autoUpdate(interval)
+	}
+	return s, nil
 }
 
-// Close closes the geolocation database
+// Close stops automatic updates and closes the geolocation database
 func (s *Service) Close() error {
-	if s.db != nil {
-		return s.db.Close()
+	var err error
+	s.closeOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+			<-s.done
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.db != nil {
+			err = s.db.Close()
+			s.db = nil
+		}
+	})
+	return err
+}
+
+// autoUpdate checks for a newer release every interval until the service closes
+func (s *Service) autoUpdate(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.update(time.Now()); err != nil {
+				log.Printf("Warning: failed to update geolocation database: %v", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// update downloads the release of now's month when the database on disk predates
+// it, and swaps it in. Until the month's release is published, the old database
+// stays in use and the next check tries again.
+func (s *Service) update(now time.Time) error {
+	info, err := os.Stat(geoDBPath)
+	if err == nil && !releaseOutdated(info.ModTime(), now) {
+		return nil
+	}
+
+	next := geoDBPath + ".next"
+	if err := downloadRelease(now, next); err != nil {
+		if errors.Is(err, errReleaseNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Opened before the rename so a broken download never replaces the database;
+	// the reader keeps the file it opened across the rename
+	db, err := maxminddb.Open(next)
+	if err != nil {
+		removeFile(next)
+		return fmt.Errorf("failed to open downloaded database: %w", err)
+	}
+	if err := os.Rename(next, geoDBPath); err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			log.Printf("Warning: failed to close downloaded database: %v", closeErr)
+		}
+		removeFile(next)
+		return fmt.Errorf("failed to rename database file: %w", err)
 	}
+
+	s.swap(mmdbReader{db})
+	log.Printf("✓ Geolocation database updated to the %s release", now.Format("2006-01"))
 	return nil
 }
 
+// swap replaces the database lookups use, waiting for the lookups in progress on
+// the old one before closing it
+func (s *Service) swap(db reader) {
+	s.mu.Lock()
+	old := s.db
+	s.db = db
+	s.mu.Unlock()
+
+	// Lookups that started before the swap hold the read lock until they finish,
+	// so once the write lock was granted none can still be using old
+	if old != nil {
+		if err := old.Close(); err != nil {
+			log.Printf("Warning: failed to close previous geolocation database: %v", err)
+		}
+	}
+}
+
+// releaseOutdated reports whether a database file modified at modTime predates
+// now's monthly release. Downloads date their file to the start of their release
+// month, see downloadRelease.
+func releaseOutdated(modTime, now time.Time) bool {
+	return modTime.Before(monthStart(now))
+}
+
+// monthStart returns midnight UTC on the first day of t's month
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
 // Lookup performs IP geolocation lookup
 func (s *Service) Lookup(ipStr string) (*GeoLocation, error) {
 	ip, err := netip.ParseAddr(ipStr)
@@ -64,27 +249,19 @@ func (s *Service) Lookup(ipStr string) (*GeoLocation, error) {
 		return nil, fmt.Errorf("invalid IP address: %w", err)
 	}
 
-	var record struct {
-		Country struct {
-			ISOCode string            `maxminddb:"iso_code"`
-			Names   map[string]string `maxminddb:"names"`
-		} `maxminddb:"country"`
-		City struct {
-			Names map[string]string `maxminddb:"names"`
-		} `maxminddb:"city"`
+	var record geoRecord
+	s.mu.RLock()
+	if s.db == nil {
+		err = errors.New("geolocation database closed")
+	} else {
+		err = s.db.lookup(ip, &record)
 	}
-
-	err = s.db.Lookup(ip).Decode(&record)
+	s.mu.RUnlock()
 	if err != nil {
 		return nil, fmt.Errorf("geolocation lookup failed: %w", err)
 	}
 
-	geo := &GeoLocation{
-		CountryCode: record.Country.ISOCode,
-		Country:     record.Country.Names["en"],
-		City:        record.City.Names["en"],
-	}
-
+	geo := record.location(s.layout)
 	if geo.Country == "Israel" {
 		geo.Country = "Palestine"
 		geo.CountryCode = "PS"
@@ -93,6 +270,44 @@ func (s *Service) Lookup(ipStr string) (*GeoLocation, error) {
 	return geo, nil
 }
 
+// geoPlace is a country or subdivision of a record
+type geoPlace struct {
+	ISOCode string            `maxminddb:"iso_code"`
+	Names   map[string]string `maxminddb:"names"`
+}
+
+// geoRecord holds the record fields lookups read. DB-IP and MaxMind share the
+// country, subdivisions and city layout; MaxMind records also carry the
+// registered_country, the only one set for addresses such as anycast ranges.
+type geoRecord struct {
+	Country           geoPlace   `maxminddb:"country"`
+	RegisteredCountry geoPlace   `maxminddb:"registered_country"`
+	Subdivisions      []geoPlace `maxminddb:"subdivisions"`
+	City              struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// location converts a record decoded in layout
+func (r geoRecord) location(layout string) *GeoLocation {
+	country := r.Country
+	if layout == LayoutMaxMind && country.ISOCode == "" {
+		country = r.RegisteredCountry
+	}
+
+	geo := &GeoLocation{
+		CountryCode: country.ISOCode,
+		Country:     country.Names["en"],
+		City:        r.City.Names["en"],
+	}
+	// Subdivisions go from largest to smallest, the first is the state or province
+	if len(r.Subdivisions) > 0 {
+		geo.Region = r.Subdivisions[0].Names["en"]
+		geo.RegionCode = r.Subdivisions[0].ISOCode
+	}
+	return geo
+}
+
 // ensureDatabase checks if the database exists, downloads if missing
 func ensureDatabase() error {
 	// Check if database already exists
@@ -117,56 +332,74 @@ func ensureDatabase() error {
 	return nil
 }
 
+// errReleaseNotFound is returned for a monthly release DB-IP has not published yet
+var errReleaseNotFound = errors.New("release not found")
+
 // downloadDatabase downloads the DB-IP Country Lite database
 func downloadDatabase() error {
 	// Try current month first, then last month
 	now := time.Now()
-	thisMonth := now.Format("2006-01")
-	lastMonth := now.AddDate(0, -1, 0).Format("2006-01")
-
-	urls := []string{
-		fmt.Sprintf("https://download.db-ip.com/free/dbip-country-lite-%s.mmdb.gz", thisMonth),
-		fmt.Sprintf("https://download.db-ip.com/free/dbip-country-lite-%s.mmdb.gz", lastMonth),
-	}
+	months := []time.Time{now, now.AddDate(0, -1, 0)}
 
 	var lastErr error
-	for i, url := range urls {
-		log.Printf("Trying to download from: %s", url)
-
-		resp, err := http.Get(url)
-		if err != nil {
-			lastErr = err
-			continue
+	for i, month := range months {
+		err := downloadRelease(month, geoDBPath)
+		if err == nil {
+			return nil
 		}
-		defer func() {
-			if err := resp.Body.Close(); err != nil {
-				log.Printf("Warning: failed to close response body: %v", err)
-			}
-		}()
-
-		if resp.StatusCode == 404 && i < len(urls)-1 {
-			log.Printf("Got 404 for %s, trying next URL...", url)
+		if errors.Is(err, errReleaseNotFound) && i < len(months)-1 {
+			log.Printf("No release for %s yet, trying the previous month...", month.Format("2006-01"))
 			continue
 		}
-
-		if resp.StatusCode != 200 {
-			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-			continue
+		if errors.Is(err, errDecompress) {
+			return err
 		}
+		lastErr = err
+	}
+
+	return fmt.Errorf("failed to download from all URLs: %w", lastErr)
+}
+
+// errDecompress marks a download whose body could not be saved as a database
+var errDecompress = errors.New("failed to decompress database")
+
+// downloadRelease downloads the DB-IP Country Lite release of month to path,
+// dating the file to the start of the month so later checks know its release
+func downloadRelease(month time.Time, path string) error {
+	url := fmt.Sprintf("https://download.db-ip.com/free/dbip-country-lite-%s.mmdb.gz", month.Format("2006-01"))
+	log.Printf("Trying to download from: %s", url)
 
-		// Decompress and save
-		if err := decompressAndSave(resp.Body); err != nil {
-			return fmt.Errorf("failed to decompress database: %w", err)
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close response body: %v", err)
 		}
+	}()
 
-		return nil
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", errReleaseNotFound, url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	return fmt.Errorf("failed to download from all URLs: %w", lastErr)
+	// Decompress and save
+	if err := decompressAndSave(resp.Body, path); err != nil {
+		return fmt.Errorf("%w: %w", errDecompress, err)
+	}
+
+	released := monthStart(month)
+	if err := os.Chtimes(path, released, released); err != nil {
+		log.Printf("Warning: failed to date database file: %v", err)
+	}
+	return nil
 }
 
-// decompressAndSave decompresses the gzipped database and saves it
-func decompressAndSave(body io.Reader) error {
+// decompressAndSave decompresses the gzipped database and saves it to path
+func decompressAndSave(body io.Reader, path string) error {
 	gzReader, err := gzip.NewReader(body)
 	if err != nil {
 		return fmt.Errorf("failed to create gzip reader: %w", err)
@@ -178,7 +411,7 @@ func decompressAndSave(body io.Reader) error {
 	}()
 
 	// Create temporary file
-	tmpFile := geoDBPath + ".tmp"
+	tmpFile := path + ".tmp"
 	outFile, err := os.Create(tmpFile)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
@@ -192,25 +425,71 @@ func decompressAndSave(body io.Reader) error {
 	// Copy decompressed data
 	_, err = io.Copy(outFile, gzReader)
 	if err != nil {
-		if removeErr := os.Remove(tmpFile); removeErr != nil {
-			log.Printf("Warning: failed to remove temp file: %v", removeErr)
-		}
+		removeFile(tmpFile)
 		return fmt.Errorf("failed to write database: %w", err)
 	}
 
 	// Rename temp file to final name
-	if err := os.Rename(tmpFile, geoDBPath); err != nil {
-		if removeErr := os.Remove(tmpFile); removeErr != nil {
-			log.Printf("Warning: failed to remove temp file: %v", removeErr)
-		}
+	if err := os.Rename(tmpFile, path); err != nil {
+		removeFile(tmpFile)
 		return fmt.Errorf("failed to rename database file: %w", err)
 	}
 
 	return nil
 }
 
-// LookupOrDefault performs lookup and returns default values on error
+// removeFile removes a leftover temporary file, logging a failure
+func removeFile(path string) {
+	if err := os.Remove(path); err != nil {
+		log.Printf("Warning: failed to remove temp file: %v", err)
+	}
+}
+
+// LocalCountry is the country LookupOrDefault gives addresses of private and
+// reserved ranges, which no database places
+const LocalCountry = "Local"
+
+// reservedPrefixes are the special-purpose ranges netip has no method for, from the
+// IANA IPv4 and IPv6 special-purpose address registries
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation (TEST-NET-1)
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation (TEST-NET-3)
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("100::/64"),        // Discard-only
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+}
+
+// IsReserved reports whether ip is in a private, loopback, link-local, multicast
+// or other reserved range, which never resolves to a location
+func IsReserved(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupOrDefault performs lookup and returns default values on error. Reserved
+// addresses skip the database and give LocalCountry.
 func (s *Service) LookupOrDefault(ipStr string) *GeoLocation {
+	if ip, err := netip.ParseAddr(ipStr); err == nil && IsReserved(ip) {
+		return &GeoLocation{
+			Country:     LocalCountry,
+			CountryCode: "XX",
+		}
+	}
+
 	geo, err := s.Lookup(ipStr)
 	if err != nil {
 		// Return unknown location on error
@@ -1,8 +1,13 @@
 package geolocation
 
 import (
+	"encoding/json"
+	"errors"
 	"net/netip"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestLookup(t *testing.T) {
@@ -154,6 +159,274 @@ func TestServiceClose(t *testing.T) {
 	}
 }
 
+// fakeReader answers every lookup with one country and fails once closed
+type fakeReader struct {
+	country string
+	closed  atomic.Bool
+}
+
+func (r *fakeReader) lookup(ip netip.Addr, record any) error {
+	if r.closed.Load() {
+		return errors.New("lookup on a closed reader")
+	}
+	return json.Unmarshal([]byte(`{"Country":{"ISOCode":"`+r.country+`","Names":{"en":"`+r.country+`"}}}`), record)
+}
+
+func (r *fakeReader) Close() error {
+	r.closed.Store(true)
+	return nil
+}
+
+func TestSwapDuringLookups(t *testing.T) {
+	countries := []string{"DE", "FR", "JP", "BR"}
+	readers := make([]*fakeReader, 50)
+	for i := range readers {
+		readers[i] = &fakeReader{country: countries[i%len(countries)]}
+	}
+	service := &Service{db: readers[0]}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				geo, err := service.Lookup("8.8.8.8")
+				if err != nil {
+					t.Errorf("Lookup failed during a swap: %v", err)
+					return
+				}
+				if geo.CountryCode == "" {
+					t.Error("Lookup returned no country during a swap")
+					return
+				}
+			}
+		}()
+	}
+
+	for _, r := range readers[1:] {
+		service.swap(r)
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	for i, r := range readers[:len(readers)-1] {
+		if !r.closed.Load() {
+			t.Errorf("Reader %d was not closed after being swapped out", i)
+		}
+	}
+	if err := service.Close(); err != nil {
+		t.Errorf("Unexpected error closing service: %v", err)
+	}
+	if !readers[len(readers)-1].closed.Load() {
+		t.Error("Close did not close the current reader")
+	}
+	if _, err := service.Lookup("8.8.8.8"); err == nil {
+		t.Error("Expected Lookup to fail after Close")
+	}
+}
+
+func TestUpdateInterval(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", DefaultUpdateInterval},
+		{"6h", 6 * time.Hour},
+		{"0", 0},
+		{"-1h", DefaultUpdateInterval},
+		{"daily", DefaultUpdateInterval},
+	}
+	for _, tt := range tests {
+		t.Setenv("GEODB_UPDATE_INTERVAL", tt.value)
+		if got := updateInterval(); got != tt.expected {
+			t.Errorf("updateInterval() with %q = %v, expected %v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestReleaseOutdated(t *testing.T) {
+	now := time.Date(2025, time.March, 14, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		modTime  time.Time
+		expected bool
+	}{
+		{"this month's release", time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), false},
+		{"last month's release", time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC), true},
+		{"downloaded late last month", time.Date(2025, time.February, 27, 18, 0, 0, 0, time.UTC), true},
+		{"downloaded this month", time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := releaseOutdated(tt.modTime, now); got != tt.expected {
+				t.Errorf("releaseOutdated(%v) = %v, expected %v", tt.modTime, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDatabaseLayout(t *testing.T) {
+	tests := []struct {
+		configured string
+		dbType     string
+		expected   string
+		shouldErr  bool
+	}{
+		{"", "DBIP-Country-Lite", LayoutDBIP, false},
+		{"", "DBIP-City-Lite", LayoutDBIP, false},
+		{"", "GeoIP2-City", LayoutMaxMind, false},
+		{"", "GeoLite2-Country", LayoutMaxMind, false},
+		{"", "", LayoutDBIP, false},
+		{"maxmind", "DBIP-City-Lite", LayoutMaxMind, false},
+		{"DBIP", "GeoIP2-City", LayoutDBIP, false},
+		{"ip2location", "GeoIP2-City", "", true},
+	}
+	for _, tt := range tests {
+		got, err := databaseLayout(tt.configured, tt.dbType)
+		if tt.shouldErr {
+			if err == nil {
+				t.Errorf("databaseLayout(%q, %q) expected an error", tt.configured, tt.dbType)
+			}
+			continue
+		}
+		if err != nil || got != tt.expected {
+			t.Errorf("databaseLayout(%q, %q) = %q, %v, expected %q", tt.configured, tt.dbType, got, err, tt.expected)
+		}
+	}
+}
+
+func TestRecordLocation(t *testing.T) {
+	place := func(code, name string) geoPlace {
+		return geoPlace{ISOCode: code, Names: map[string]string{"en": name, "de": name + " (de)"}}
+	}
+
+	// A GeoIP2 City record: registered_country is always set, country only where
+	// the address is located
+	maxmind := geoRecord{
+		Country:           place("US", "United States"),
+		RegisteredCountry: place("US", "United States"),
+		Subdivisions:      []geoPlace{place("CA", "California"), place("SF", "San Francisco County")},
+	}
+	maxmind.City.Names = map[string]string{"en": "San Francisco"}
+
+	anycast := geoRecord{RegisteredCountry: place("AU", "Australia")}
+
+	dbip := geoRecord{Country: place("DE", "Germany")}
+	dbip.City.Names = map[string]string{"en": "Berlin"}
+
+	tests := []struct {
+		name     string
+		record   geoRecord
+		layout   string
+		expected GeoLocation
+	}{
+		{
+			name:   "MaxMind city record",
+			record: maxmind,
+			layout: LayoutMaxMind,
+			expected: GeoLocation{
+				Country: "United States", CountryCode: "US", City: "San Francisco",
+				Region: "California", RegionCode: "CA",
+			},
+		},
+		{
+			name:     "MaxMind record with only the registered country",
+			record:   anycast,
+			layout:   LayoutMaxMind,
+			expected: GeoLocation{Country: "Australia", CountryCode: "AU"},
+		},
+		{
+			name:     "DB-IP record",
+			record:   dbip,
+			layout:   LayoutDBIP,
+			expected: GeoLocation{Country: "Germany", CountryCode: "DE", City: "Berlin"},
+		},
+		{
+			name:     "DB-IP layout ignores the registered country",
+			record:   anycast,
+			layout:   LayoutDBIP,
+			expected: GeoLocation{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.record.location(tt.layout); *got != tt.expected {
+				t.Errorf("location() = %+v, expected %+v", *got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsReserved(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       string
+		expected bool
+	}{
+		{"IPv4 private 10/8", "10.0.4.7", true},
+		{"IPv4 private 172.16/12", "172.31.255.1", true},
+		{"IPv4 private 192.168/16", "192.168.1.20", true},
+		{"IPv4 loopback", "127.0.0.1", true},
+		{"IPv4 link-local", "169.254.10.1", true},
+		{"IPv4 carrier-grade NAT", "100.64.12.3", true},
+		{"IPv4 this network", "0.1.2.3", true},
+		{"IPv4 unspecified", "0.0.0.0", true},
+		{"IPv4 IETF protocol assignments", "192.0.0.9", true},
+		{"IPv4 documentation TEST-NET-1", "192.0.2.1", true},
+		{"IPv4 documentation TEST-NET-2", "198.51.100.7", true},
+		{"IPv4 documentation TEST-NET-3", "203.0.113.50", true},
+		{"IPv4 benchmarking", "198.19.0.1", true},
+		{"IPv4 multicast", "224.0.0.251", true},
+		{"IPv4 reserved", "250.1.1.1", true},
+		{"IPv4 broadcast", "255.255.255.255", true},
+		{"IPv6 unique local", "fd12:3456:789a::1", true},
+		{"IPv6 loopback", "::1", true},
+		{"IPv6 unspecified", "::", true},
+		{"IPv6 link-local", "fe80::1ff:fe23:4567:890a", true},
+		{"IPv6 multicast", "ff02::fb", true},
+		{"IPv6 discard-only", "100::1", true},
+		{"IPv6 documentation", "2001:db8::1", true},
+		{"IPv4-mapped private", "::ffff:192.168.0.1", true},
+		{"IPv4 public", "8.8.8.8", false},
+		{"IPv4 public next to carrier-grade NAT", "100.128.0.1", false},
+		{"IPv4 public next to 172.16/12", "172.32.0.1", false},
+		{"IPv6 public", "2001:4860:4860::8888", false},
+		{"IPv4-mapped public", "::ffff:8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsReserved(netip.MustParseAddr(tt.ip)); got != tt.expected {
+				t.Errorf("IsReserved(%s) = %v, expected %v", tt.ip, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLookupOrDefaultReserved(t *testing.T) {
+	// A closed service fails every database lookup, so only the reserved
+	// addresses, which skip it, come back as LocalCountry
+	service := &Service{}
+
+	for _, ip := range []string{"192.168.1.1", "10.0.0.5", "::1", "100.64.0.1"} {
+		if geo := service.LookupOrDefault(ip); geo.Country != LocalCountry {
+			t.Errorf("LookupOrDefault(%s) country = %q, expected %q", ip, geo.Country, LocalCountry)
+		}
+	}
+	for _, ip := range []string{"8.8.8.8", "invalid-ip", ""} {
+		if geo := service.LookupOrDefault(ip); geo.Country != "Unknown" {
+			t.Errorf("LookupOrDefault(%s) country = %q, expected Unknown", ip, geo.Country)
+		}
+	}
+}
+
 func TestNormalizeCountryName(t *testing.T) {
 	// This tests the country name normalization logic if it exists
 	tests := []struct {
@@ -0,0 +1,276 @@
+// Package dbsettings applies the DuckDB settings the server tunes at startup. The
+// list is configurable, and every setting is checked against the settings the
+// connected DuckDB version knows, so one renamed or removed in a DuckDB upgrade is
+// skipped with a clear log line instead of failing on every start.
+package dbsettings
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Setting is a DuckDB setting, as listed by duckdb_settings(), and its value
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// Defaults are the settings applied unless configured otherwise, tuned for
+// analytical queries over Parquet files
+func Defaults() []Setting {
+	return []Setting{
+		{"memory_limit", "4GB"},
+		{"threads", "4"},
+		{"preserve_insertion_order", "false"},
+		{"enable_object_cache", "true"},
+		{"enable_http_metadata_cache", "true"},
+		{"temp_directory", "/tmp/duckdb_temp"},
+	}
+}
+
+// Merge returns base with overrides applied in order: an override replaces the
+// setting of the same name, or is added at the end. An empty value removes the
+// setting, leaving DuckDB's default.
+func Merge(base []Setting, overrides ...Setting) []Setting {
+	merged := append([]Setting(nil), base...)
+	for _, override := range overrides {
+		index := -1
+		for i, setting := range merged {
+			if strings.EqualFold(setting.Name, override.Name) {
+				index = i
+				break
+			}
+		}
+		switch {
+		case override.Value == "":
+			if index >= 0 {
+				merged = append(merged[:index], merged[index+1:]...)
+			}
+		case index >= 0:
+			merged[index].Value = override.Value
+		default:
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// parseSetting parses name=value
+func parseSetting(text string) (Setting, error) {
+	name, value, ok := strings.Cut(text, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !namePattern.MatchString(name) {
+		return Setting{}, fmt.Errorf("invalid DuckDB setting %q: expected name=value", text)
+	}
+	return Setting{Name: strings.ToLower(name), Value: strings.TrimSpace(value)}, nil
+}
+
+// ParseList parses comma-separated name=value pairs, as in DUCKDB_SETTINGS
+func ParseList(list string) ([]Setting, error) {
+	var settings []Setting
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		setting, err := parseSetting(item)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+// Parse reads name=value lines, skipping blank lines and # comments
+func Parse(r io.Reader) ([]Setting, error) {
+	var settings []Setting
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		setting, err := parseSetting(line)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, setting)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read DuckDB settings: %w", err)
+	}
+	return settings, nil
+}
+
+// FromEnv returns the settings to apply: the defaults, then DUCKDB_MEMORY_LIMIT and
+// DUCKDB_THREADS, then the lines of DUCKDB_SETTINGS_FILE, then DUCKDB_SETTINGS,
+// each overriding the ones before
+func FromEnv() ([]Setting, error) {
+	var overrides []Setting
+	if limit := os.Getenv("DUCKDB_MEMORY_LIMIT"); limit != "" {
+		overrides = append(overrides, Setting{"memory_limit", limit})
+	}
+	if threads := os.Getenv("DUCKDB_THREADS"); threads != "" {
+		overrides = append(overrides, Setting{"threads", threads})
+	}
+
+	if path := os.Getenv("DUCKDB_SETTINGS_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open DuckDB settings: %w", err)
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				log.Printf("Warning: failed to close DuckDB settings: %v", err)
+			}
+		}()
+		fromFile, err := Parse(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		overrides = append(overrides, fromFile...)
+	}
+
+	fromList, err := ParseList(os.Getenv("DUCKDB_SETTINGS"))
+	if err != nil {
+		return nil, fmt.Errorf("DUCKDB_SETTINGS: %w", err)
+	}
+	overrides = append(overrides, fromList...)
+
+	return Merge(Defaults(), overrides...), nil
+}
+
+// Outcomes of applying a setting
+const (
+	StatusApplied     = "applied"
+	StatusUnsupported = "unsupported" // Not a setting of the connected DuckDB version
+	StatusFailed      = "failed"      // DuckDB rejected the value
+)
+
+// Result is the outcome of applying a setting
+type Result struct {
+	Name      string `json:"name"`
+	Requested string `json:"requested"`
+	Status    string `json:"status"` // StatusApplied, StatusUnsupported or StatusFailed
+	Error     string `json:"error,omitempty"`
+	Value     string `json:"value,omitempty"` // Effective value, see Report.WithValues
+}
+
+// Report is the outcome of Apply
+type Report struct {
+	Version  string   `json:"version"`
+	Settings []Result `json:"settings"`
+}
+
+// Apply sets each setting for the whole database, skipping the ones the connected
+// DuckDB does not know. A rejected value is logged and the others still applied;
+// the error is only for failing to list the supported settings.
+func Apply(db *sql.DB, settings []Setting) (Report, error) {
+	report := Report{Settings: make([]Result, 0, len(settings))}
+	if err := db.QueryRow("SELECT version()").Scan(&report.Version); err != nil {
+		return report, fmt.Errorf("failed to read DuckDB version: %w", err)
+	}
+
+	types, err := settingTypes(db)
+	if err != nil {
+		return report, err
+	}
+
+	for _, setting := range settings {
+		result := Result{Name: setting.Name, Requested: setting.Value, Status: StatusApplied}
+		inputType, ok := types[setting.Name]
+		if !ok {
+			result.Status = StatusUnsupported
+			log.Printf("⚠️  Skipping DuckDB setting %s: not supported by DuckDB %s", setting.Name, report.Version)
+			report.Settings = append(report.Settings, result)
+			continue
+		}
+
+		// Names are checked against duckdb_settings(), so only the value is quoted
+		query := fmt.Sprintf("SET GLOBAL %s = %s", setting.Name, literal(setting.Value, inputType))
+		if _, err := db.Exec(query); err != nil {
+			result.Status, result.Error = StatusFailed, err.Error()
+			log.Printf("Warning: Could not set DuckDB %s to %s: %v", setting.Name, setting.Value, err)
+		} else {
+			log.Printf("✓ DuckDB %s set to: %s", setting.Name, setting.Value)
+		}
+		report.Settings = append(report.Settings, result)
+	}
+	return report, nil
+}
+
+// settingTypes returns the input type of every setting of the connected DuckDB
+func settingTypes(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT name, input_type FROM duckdb_settings()")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DuckDB settings: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	types := map[string]string{}
+	for rows.Next() {
+		var name, inputType string
+		if err := rows.Scan(&name, &inputType); err != nil {
+			return nil, fmt.Errorf("failed to list DuckDB settings: %w", err)
+		}
+		types[strings.ToLower(name)] = inputType
+	}
+	return types, rows.Err()
+}
+
+var plainValue = regexp.MustCompile(`(?i)^(-?[0-9]+(\.[0-9]+)?|true|false)$`)
+
+// literal writes value as SQL: numbers and booleans as they are for settings of
+// other types than VARCHAR, anything else as a quoted string DuckDB casts
+func literal(value, inputType string) string {
+	if inputType != "VARCHAR" && plainValue.MatchString(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// WithValues returns the report with the current value of each setting, as DuckDB
+// reports it, such as "3.7 GiB" for a memory limit of 4GB
+func (r Report) WithValues(db *sql.DB) (Report, error) {
+	rows, err := db.Query("SELECT name, value FROM duckdb_settings()")
+	if err != nil {
+		return r, fmt.Errorf("failed to read DuckDB settings: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	values := map[string]string{}
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return r, fmt.Errorf("failed to read DuckDB settings: %w", err)
+		}
+		values[strings.ToLower(name)] = value.String
+	}
+	if err := rows.Err(); err != nil {
+		return r, fmt.Errorf("failed to read DuckDB settings: %w", err)
+	}
+
+	withValues := Report{Version: r.Version, Settings: make([]Result, len(r.Settings))}
+	for i, result := range r.Settings {
+		result.Value = values[result.Name]
+		withValues.Settings[i] = result
+	}
+	return withValues, nil
+}
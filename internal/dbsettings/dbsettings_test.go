@@ -0,0 +1,174 @@
+package dbsettings
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/duckdb/duckdb-go/v2"
+)
+
+func TestMerge(t *testing.T) {
+	base := []Setting{{"memory_limit", "4GB"}, {"threads", "4"}}
+
+	tests := []struct {
+		name      string
+		overrides []Setting
+		expected  []Setting
+	}{
+		{"No overrides", nil, base},
+		{"Replaced in place", []Setting{{"threads", "8"}}, []Setting{{"memory_limit", "4GB"}, {"threads", "8"}}},
+		{"Added at the end", []Setting{{"checkpoint_threshold", "1GB"}}, []Setting{{"memory_limit", "4GB"}, {"threads", "4"}, {"checkpoint_threshold", "1GB"}}},
+		{"Removed by an empty value", []Setting{{"memory_limit", ""}}, []Setting{{"threads", "4"}}},
+		{"Removing an unknown setting", []Setting{{"checkpoint_threshold", ""}}, base},
+		{"Later overrides win", []Setting{{"threads", "8"}, {"threads", "2"}}, []Setting{{"memory_limit", "4GB"}, {"threads", "2"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Merge(base, tt.overrides...)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+	if base[1].Value != "4" || len(base) != 2 {
+		t.Errorf("Expected Merge to leave base alone, got %v", base)
+	}
+}
+
+func TestParse(t *testing.T) {
+	settings, err := Parse(strings.NewReader("# Tuning\n\nThreads = 8\ntemp_directory=/var/tmp/duckdb\nmemory_limit=\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	expected := []Setting{{"threads", "8"}, {"temp_directory", "/var/tmp/duckdb"}, {"memory_limit", ""}}
+	if !reflect.DeepEqual(settings, expected) {
+		t.Errorf("Expected %v, got %v", expected, settings)
+	}
+
+	for _, invalid := range []string{"threads", "=8", "max threads=8", "threads;DROP TABLE events=1"} {
+		if _, err := Parse(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestParseList(t *testing.T) {
+	settings, err := ParseList("threads=8, preserve_insertion_order=true,")
+	if err != nil {
+		t.Fatalf("ParseList failed: %v", err)
+	}
+	expected := []Setting{{"threads", "8"}, {"preserve_insertion_order", "true"}}
+	if !reflect.DeepEqual(settings, expected) {
+		t.Errorf("Expected %v, got %v", expected, settings)
+	}
+	if settings, err := ParseList(""); err != nil || len(settings) != 0 {
+		t.Errorf("Expected no settings for an empty list, got %v (%v)", settings, err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "duckdb.conf")
+	if err := os.WriteFile(file, []byte("threads=6\ntemp_directory=\n"), 0644); err != nil {
+		t.Fatalf("Failed to write settings file: %v", err)
+	}
+	t.Setenv("DUCKDB_MEMORY_LIMIT", "1GB")
+	t.Setenv("DUCKDB_THREADS", "2")
+	t.Setenv("DUCKDB_SETTINGS_FILE", file)
+	t.Setenv("DUCKDB_SETTINGS", "threads=8,checkpoint_threshold=64MB")
+
+	settings, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	values := map[string]string{}
+	for _, setting := range settings {
+		values[setting.Name] = setting.Value
+	}
+	if values["memory_limit"] != "1GB" || values["threads"] != "8" || values["checkpoint_threshold"] != "64MB" {
+		t.Errorf("Expected the environment to override the defaults, got %v", settings)
+	}
+	if _, ok := values["temp_directory"]; ok {
+		t.Errorf("Expected temp_directory to be removed by the file, got %v", settings)
+	}
+
+	t.Setenv("DUCKDB_SETTINGS", "threads")
+	if _, err := FromEnv(); err == nil {
+		t.Error("Expected an error for an invalid DUCKDB_SETTINGS")
+	}
+	t.Setenv("DUCKDB_SETTINGS", "")
+	t.Setenv("DUCKDB_SETTINGS_FILE", filepath.Join(t.TempDir(), "missing.conf"))
+	if _, err := FromEnv(); err == nil {
+		t.Error("Expected an error for a missing DUCKDB_SETTINGS_FILE")
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		value, inputType, expected string
+	}{
+		{"8", "BIGINT", "8"},
+		{"false", "BOOLEAN", "false"},
+		{"0.5", "DOUBLE", "0.5"},
+		{"4GB", "VARCHAR", "'4GB'"},
+		{"8", "VARCHAR", "'8'"},
+		{"/tmp/it's", "VARCHAR", "'/tmp/it''s'"},
+		{"1; DROP TABLE events", "BIGINT", "'1; DROP TABLE events'"},
+	}
+
+	for _, tt := range tests {
+		if got := literal(tt.value, tt.inputType); got != tt.expected {
+			t.Errorf("literal(%q, %s): expected %s, got %s", tt.value, tt.inputType, tt.expected, got)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Skipf("DuckDB driver not available: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Skipf("DuckDB not available: %v", err)
+	}
+	defer db.Close()
+
+	report, err := Apply(db, []Setting{
+		{"threads", "2"},
+		{"force_parallelism", "true"}, // Removed from DuckDB
+		{"preserve_insertion_order", "not a boolean"},
+		{"memory_limit", "1GB"},
+	})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if report.Version == "" {
+		t.Error("Expected the DuckDB version")
+	}
+
+	report, err = report.WithValues(db)
+	if err != nil {
+		t.Fatalf("WithValues failed: %v", err)
+	}
+	expected := map[string]string{
+		"threads":                  StatusApplied,
+		"force_parallelism":        StatusUnsupported,
+		"preserve_insertion_order": StatusFailed,
+		"memory_limit":             StatusApplied,
+	}
+	for _, result := range report.Settings {
+		if result.Status != expected[result.Name] {
+			t.Errorf("%s: expected %s, got %s (%s)", result.Name, expected[result.Name], result.Status, result.Error)
+		}
+	}
+	if threads := report.Settings[0]; threads.Value != "2" {
+		t.Errorf("Expected 2 threads in effect, got %q", threads.Value)
+	}
+	if unsupported := report.Settings[1]; unsupported.Value != "" {
+		t.Errorf("Expected no value for an unsupported setting, got %q", unsupported.Value)
+	}
+}
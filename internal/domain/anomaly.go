@@ -0,0 +1,52 @@
+package domain
+
+// Anomaly detection defaults, overridable with the sigma and window parameters
+const (
+	DefaultAnomalySigma  = 3.0
+	DefaultAnomalyWindow = 7
+	// MinAnomalyHistory is the number of preceding buckets needed before a bucket is judged
+	MinAnomalyHistory = 3
+)
+
+// AnomalyPoint is a timeline bucket whose value is outside the range expected from
+// the buckets before it
+type AnomalyPoint struct {
+	Date      string  `json:"date"`
+	Value     float64 `json:"value"`
+	Expected  float64 `json:"expected"`  // Rolling mean of the preceding window
+	Lower     float64 `json:"lower"`     // Expected minus sigma standard deviations
+	Upper     float64 `json:"upper"`     // Expected plus sigma standard deviations
+	Deviation float64 `json:"deviation"` // Standard deviations from expected, negative for drops
+	Direction string  `json:"direction"` // "spike" or "drop"
+}
+
+// AnomalyResult lists the anomalous buckets of a metric's timeline
+type AnomalyResult struct {
+	Metric         string         `json:"metric"`
+	TimelineFormat string         `json:"timeline_format"`
+	Sigma          float64        `json:"sigma"`
+	Window         int            `json:"window"`
+	Buckets        int            `json:"buckets"` // Timeline buckets examined, including gaps filled with zero
+	Anomalies      []AnomalyPoint `json:"anomalies"`
+}
+
+// TimelineMetrics are the metrics GetTimeline can chart
+var TimelineMetrics = []string{
+	"users",
+	"visits",
+	"page_views",
+	"events",
+	"views_per_visit",
+	"bounce_rate",
+	"visit_duration",
+}
+
+// IsTimelineMetric reports whether metric is one of TimelineMetrics
+func IsTimelineMetric(metric string) bool {
+	for _, m := range TimelineMetrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
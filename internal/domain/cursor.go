@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventCursor marks a position in the newest-first list of raw events: the next
+// page holds the events ordered after this timestamp and id
+type EventCursor struct {
+	Timestamp time.Time
+	ID        uint64
+}
+
+// Encode returns the cursor as an opaque, URL-safe string
+func (c EventCursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.Timestamp.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseEventCursor decodes a cursor returned as next_cursor
+func ParseEventCursor(cursor string) (EventCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return EventCursor{}, errors.New("invalid cursor")
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return EventCursor{}, errors.New("invalid cursor")
+	}
+	ts, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return EventCursor{}, errors.New("invalid cursor")
+	}
+	eventID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return EventCursor{}, errors.New("invalid cursor")
+	}
+	return EventCursor{Timestamp: time.Unix(0, ts).UTC(), ID: eventID}, nil
+}
+
+// Pagination modes of the raw events endpoint
+const (
+	PaginationOffset = "offset"
+	PaginationCursor = "cursor"
+)
+
+// EventsPageMeta tells clients how a page of raw events was selected. Returned as "_meta".
+type EventsPageMeta struct {
+	Pagination string `json:"pagination"` // PaginationOffset or PaginationCursor
+	Note       string `json:"note"`
+}
+
+// NewEventsPageMeta describes a page read with the given pagination mode
+func NewEventsPageMeta(pagination string) EventsPageMeta {
+	if pagination == PaginationCursor {
+		return EventsPageMeta{
+			Pagination: PaginationCursor,
+			Note:       "Keyset pagination: each page costs the same however deep it is. Pages follow the events as of the first request.",
+		}
+	}
+	return EventsPageMeta{
+		Pagination: PaginationOffset,
+		Note:       "Offset pagination rescans every skipped event, so deep pages get slower. Pass next_cursor as before instead.",
+	}
+}
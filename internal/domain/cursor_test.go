@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventCursor(t *testing.T) {
+	cursor := EventCursor{Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 123456000, time.UTC), ID: 42}
+
+	parsed, err := ParseEventCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("ParseEventCursor failed: %v", err)
+	}
+	if !parsed.Timestamp.Equal(cursor.Timestamp) || parsed.ID != cursor.ID {
+		t.Errorf("Expected %+v after a round trip, got %+v", cursor, parsed)
+	}
+
+	for _, invalid := range []string{"", "not base64!", "bm9jb2xvbg", "YWJjOjQy", "MTIzOmFiYw"} {
+		if _, err := ParseEventCursor(invalid); err == nil {
+			t.Errorf("Expected an error for cursor %q", invalid)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"strings"
+	"time"
+)
 
 type Event struct {
 	ID              uint64    `json:"id"`
+	EventID         string    `json:"event_id,omitempty"` // Client-chosen id that deduplicates retries, not stored
 	Timestamp       time.Time `json:"timestamp"`
 	EventName       string    `json:"event_name"`
 	UserID          string    `json:"user_id"`
@@ -14,12 +19,27 @@ type Event struct {
 	UserAgent       string    `json:"user_agent"`
 	IP              string    `json:"ip"`
 	Country         string    `json:"country"`
+	Region          string    `json:"region"`        // State or province, when geolocation has city data
+	Language        string    `json:"language"`      // Primary language subtag, e.g. "en", from Accept-Language unless sent
+	ScreenWidth     int       `json:"screen_width"`  // Screen size in CSS pixels, 0 when not reported
+	ScreenHeight    int       `json:"screen_height"` // Screen size in CSS pixels, 0 when not reported
 	Browser         string    `json:"browser"`
 	OS              string    `json:"os"`
 	Device          string    `json:"device"`
 	IsBot           bool      `json:"is_bot"`
 	ProjectID       string    `json:"project_id"`
-	Channel         string    `json:"channel"` // Traffic channel: Direct, Organic, Referral, Social, Paid
+	Channel         string    `json:"channel"`     // Traffic channel: Direct, Organic, Referral, Social, Paid
+	ReceivedAt      time.Time `json:"received_at"` // Set by the server when the event is ingested
+	SampleRate      float64   `json:"sample_rate"` // Share of visitors kept by SAMPLE_RATE when ingested, set by the server
+}
+
+// StoredSampleRate is the sample rate stored with the event: its SampleRate, or 1
+// for events that were not sampled, such as those written before sampling existed
+func (e Event) StoredSampleRate() float64 {
+	if e.SampleRate <= 0 || e.SampleRate > 1 {
+		return 1
+	}
+	return e.SampleRate
 }
 
 type Stats struct {
@@ -80,24 +100,119 @@ type OnlineUsers struct {
 	Count int64 `json:"count"`
 }
 
+// FlushResult describes the buffered events written by an explicit flush
+type FlushResult struct {
+	EventsFlushed int      `json:"events_flushed"`
+	File          string   `json:"file,omitempty"`  // First file written, empty when there was nothing to flush
+	Files         []string `json:"files,omitempty"` // One file per project with buffered events
+}
+
+// CompactionResult describes an on-demand compaction of the Parquet files
+type CompactionResult struct {
+	FilesMerged  int   `json:"files_merged"`  // Files merged away
+	FilesWritten int   `json:"files_written"` // Files they were merged into
+	BytesBefore  int64 `json:"bytes_before"`  // Size of the merged files
+	BytesAfter   int64 `json:"bytes_after"`   // Size of the files written
+}
+
+// ErrCompactionRunning is returned when compaction is requested while a
+// compaction pass, reset or user sketch rebuild holds the Parquet files
+var ErrCompactionRunning = errors.New("compaction is already running")
+
+// ErrNoCompaction is returned when compaction is requested under the table
+// backend, which keeps no Parquet files
+var ErrNoCompaction = errors.New("the table backend keeps no Parquet files to compact")
+
 type Project struct {
 	ID         string `json:"id"`
 	EventCount int64  `json:"event_count"`
 }
 
+// CompareRequest asks for the same stats over two filter sets (segments) in one date range
+type CompareRequest struct {
+	StartDate string            `json:"start_date"`
+	EndDate   string            `json:"end_date"`
+	A         map[string]string `json:"a"` // Filters for segment A, e.g. {"browser": "Chrome"}
+	B         map[string]string `json:"b"` // Filters for segment B
+}
+
+// MetricDelta compares one metric between segments A and B
+type MetricDelta struct {
+	A             interface{} `json:"a"`
+	B             interface{} `json:"b"`
+	Difference    *float64    `json:"difference"`     // B - A, null when either side is unavailable
+	PercentChange *float64    `json:"percent_change"` // (B - A) / A * 100, null when A is zero or unavailable
+}
+
+// Session is one visit of a user reconstructed from its events, in order
+type Session struct {
+	SessionID  string         `json:"session_id"`
+	UserID     string         `json:"user_id"`
+	StartTime  time.Time      `json:"start_time"`
+	EndTime    time.Time      `json:"end_time"`
+	Duration   int            `json:"duration"` // Seconds between the first and last event
+	EventCount int            `json:"event_count"`
+	EntryPage  string         `json:"entry_page"`
+	ExitPage   string         `json:"exit_page"`
+	Pages      []string       `json:"pages"`  // Page view URLs in visit order
+	Events     []SessionEvent `json:"events"` // Every event in order, capped per session
+	Truncated  bool           `json:"truncated"`
+	Device     string         `json:"device"`
+	Browser    string         `json:"browser"`
+	OS         string         `json:"os"`
+	Country    string         `json:"country"`
+	Channel    string         `json:"channel"`
+}
+
+// SessionEvent is a single step of a Session
+type SessionEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	EventName string    `json:"event_name"`
+	URL       string    `json:"url"`
+}
+
 // Funnel Analysis Types
 type FunnelStep struct {
-	Name      string            `json:"name"`       // Display name for the step
-	EventName string            `json:"event_name"` // Event name to match
-	URL       string            `json:"url"`        // Optional: URL pattern to match
-	Filters   map[string]string `json:"filters"`    // Optional: Additional filters
+	Name       string            `json:"name"`                  // Display name for the step
+	EventName  string            `json:"event_name"`            // Event name to match
+	EventNames []string          `json:"event_names,omitempty"` // Optional: any of these event names also match
+	URL        string            `json:"url"`                   // Optional: exact URL to match
+	URLPattern string            `json:"url_pattern,omitempty"` // Optional: URL glob, * for any run of characters and ? for one
+	Filters    map[string]string `json:"filters"`               // Optional: Additional filters
+}
+
+// MatchedEventNames returns the event names that complete the step: EventName and
+// EventNames combined, without blanks or duplicates
+func (s FunnelStep) MatchedEventNames() []string {
+	seen := make(map[string]bool, len(s.EventNames)+1)
+	var names []string
+	for _, name := range append([]string{s.EventName}, s.EventNames...) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
 }
 
 type FunnelRequest struct {
-	Steps     []FunnelStep      `json:"steps"`
-	StartDate string            `json:"start_date"`
-	EndDate   string            `json:"end_date"`
-	Filters   map[string]string `json:"filters"` // Global filters (project, country, etc.)
+	Steps                 []FunnelStep      `json:"steps"`
+	StartDate             string            `json:"start_date"`
+	EndDate               string            `json:"end_date"`
+	Filters               map[string]string `json:"filters"`                 // Global filters (project, country, etc.)
+	ConversionWindowHours int               `json:"conversion_window_hours"` // Optional: max hours between consecutive steps, 0 for no limit
+	MaxFunnelDuration     int               `json:"max_funnel_duration"`     // Optional: max hours from the first to the last step, 0 for no limit
+	Scope                 string            `json:"scope"`                   // Optional: FunnelScopeUser (default) or FunnelScopeSession
+	BreakdownBy           string            `json:"breakdown_by"`            // Optional: channel, device, country or source to split the funnel by
+	StrictOrder           *bool             `json:"strict_order,omitempty"`  // Optional: false counts every step done in the range, in any order; see InStrictOrder
+}
+
+// InStrictOrder reports whether each step must follow the previous one, the
+// default when StrictOrder is not set
+func (r FunnelRequest) InStrictOrder() bool {
+	return r.StrictOrder == nil || *r.StrictOrder
 }
 
 type FunnelStepResult struct {
@@ -105,18 +220,35 @@ type FunnelStepResult struct {
 	UserCount        int64      `json:"user_count"`
 	SessionCount     int64      `json:"session_count"`
 	EventCount       int64      `json:"event_count"`
-	ConversionRate   float64    `json:"conversion_rate"`     // % from previous step
-	OverallRate      float64    `json:"overall_rate"`        // % from first step
-	DropoffRate      float64    `json:"dropoff_rate"`        // % lost from previous step
-	AvgTimeToNext    float64    `json:"avg_time_to_next"`    // Average time in seconds to next step
-	MedianTimeToNext float64    `json:"median_time_to_next"` // Median time in seconds to next step
+	ConversionRate   float64    `json:"conversion_rate"`             // % from previous step
+	OverallRate      float64    `json:"overall_rate"`                // % from first step
+	DropoffRate      float64    `json:"dropoff_rate"`                // % lost from previous step
+	AvgTimeToNext    float64    `json:"avg_time_to_next"`            // Average time in seconds to next step
+	MedianTimeToNext float64    `json:"median_time_to_next"`         // Median time in seconds to next step
+	InsufficientData bool       `json:"insufficient_data,omitempty"` // Previous step below RATE_MIN_SAMPLE, rates not computed
 }
 
 type FunnelAnalysisResult struct {
-	Steps          []FunnelStepResult `json:"steps"`
-	TotalUsers     int64              `json:"total_users"`     // Users who entered funnel
-	CompletedUsers int64              `json:"completed_users"` // Users who completed all steps
-	CompletionRate float64            `json:"completion_rate"` // % who completed
-	AvgCompletion  float64            `json:"avg_completion"`  // Average time to complete (seconds)
-	TimeRange      string             `json:"time_range"`
+	Steps            []FunnelStepResult `json:"steps"`
+	TotalUsers       int64              `json:"total_users"`     // Users who entered funnel
+	CompletedUsers   int64              `json:"completed_users"` // Users who completed all steps
+	CompletionRate   float64            `json:"completion_rate"` // % who completed
+	AvgCompletion    float64            `json:"avg_completion"`  // Average time to complete (seconds)
+	TimeRange        string             `json:"time_range"`
+	InsufficientData bool               `json:"insufficient_data,omitempty"` // Entered users below RATE_MIN_SAMPLE, completion rate not computed
+
+	ConversionWindowHours int    `json:"conversion_window_hours"` // Window applied between steps, 0 for none
+	MaxFunnelDuration     int    `json:"max_funnel_duration"`     // Hours allowed for the whole funnel, 0 for none
+	Scope                 string `json:"scope"`                   // user: rates over users; session: steps share a session and rates are over sessions
+	StrictOrder           bool   `json:"strict_order"`            // true: a step counts once it follows the previous one; false: once every step up to it was done in the range, in any order, without timings
+
+	BreakdownBy        string                  `json:"breakdown_by,omitempty"`
+	Breakdown          []FunnelBreakdownResult `json:"breakdown,omitempty"`           // One funnel per dimension value, largest first
+	BreakdownTruncated bool                    `json:"breakdown_truncated,omitempty"` // More values existed than were analyzed
+}
+
+// FunnelBreakdownResult is the funnel restricted to one value of the breakdown dimension
+type FunnelBreakdownResult struct {
+	Value  string                `json:"value"`
+	Result *FunnelAnalysisResult `json:"result"`
 }
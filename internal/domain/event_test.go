@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -179,3 +180,55 @@ func TestReferrerStat(t *testing.T) {
 		t.Errorf("Expected Count to be 400, got %d", stat.Count)
 	}
 }
+
+func TestMatchedEventNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		step     FunnelStep
+		expected []string
+	}{
+		{"Single event name", FunnelStep{EventName: "signup"}, []string{"signup"}},
+		{"Any of", FunnelStep{EventNames: []string{"signup", "oauth_signup"}}, []string{"signup", "oauth_signup"}},
+		{"Both fields", FunnelStep{EventName: "signup", EventNames: []string{"oauth_signup"}}, []string{"signup", "oauth_signup"}},
+		{"Duplicates and blanks", FunnelStep{EventName: "signup", EventNames: []string{"signup", " ", "oauth_signup"}}, []string{"signup", "oauth_signup"}},
+		{"None", FunnelStep{URL: "/pricing"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.step.MatchedEventNames()
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestInStrictOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected bool
+	}{
+		{"Default", `{"steps":[]}`, true},
+		{"Strict", `{"strict_order":true}`, true},
+		{"Any order", `{"strict_order":false}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request FunnelRequest
+			if err := json.Unmarshal([]byte(tt.body), &request); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if got := request.InStrictOrder(); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SQLite column types of export tables
+const (
+	ExportText    = "TEXT"
+	ExportInteger = "INTEGER"
+	ExportReal    = "REAL"
+)
+
+// ExportColumn is a column of an export table
+type ExportColumn struct {
+	Name string
+	Type string // ExportText, ExportInteger or ExportReal
+}
+
+// ExportTable is a report written to an export file, one value per column in each row
+type ExportTable struct {
+	Name    string
+	Columns []ExportColumn
+	Rows    [][]interface{}
+}
+
+// ErrSQLiteUnavailable is returned by a SQLite export when DuckDB's sqlite extension
+// is not installed and cannot be downloaded
+var ErrSQLiteUnavailable = errors.New("SQLite export needs DuckDB's sqlite extension; install it or allow the server to download it")
+
+// ExportTooLargeError reports an export matching more rows than it may hold
+type ExportTooLargeError struct {
+	Rows  int64
+	Limit int64
+}
+
+func (e *ExportTooLargeError) Error() string {
+	return fmt.Sprintf("export matches %d events, more than the limit of %d; narrow the date range or filters", e.Rows, e.Limit)
+}
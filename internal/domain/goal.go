@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrGoalNotFound is returned for a goal id that does not exist
+	ErrGoalNotFound = errors.New("goal not found")
+	// ErrGoalExists is returned when another goal already has the name
+	ErrGoalExists = errors.New("a goal with this name already exists")
+)
+
+// Goal is a named conversion: an event matching its event name and/or URL. At
+// least one of the two is set.
+type Goal struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	EventName string    `json:"event_name,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GoalConversion is how often a goal was reached in a date range
+type GoalConversion struct {
+	Goal             Goal     `json:"goal"`
+	Conversions      int64    `json:"conversions"`                 // Unique visitors who reached the goal
+	Events           int64    `json:"events"`                      // Matching events
+	ConversionRate   *float64 `json:"conversion_rate"`             // % of unique visitors, null below RATE_MIN_SAMPLE
+	InsufficientData bool     `json:"insufficient_data,omitempty"` // Unique visitors below RATE_MIN_SAMPLE
+}
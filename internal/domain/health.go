@@ -0,0 +1,30 @@
+package domain
+
+// Statuses of a readiness check
+const (
+	CheckOK      = "ok"
+	CheckFailed  = "failed"
+	CheckSkipped = "skipped" // Not applicable to this setup, such as storage checks without Parquet storage
+)
+
+// HealthCheck is the outcome of one readiness check
+type HealthCheck struct {
+	Status     string `json:"status"` // CheckOK, CheckFailed or CheckSkipped
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Readiness reports whether the server can store and query events, by check name
+type Readiness struct {
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// Ready reports whether no check failed
+func (r Readiness) Ready() bool {
+	for _, check := range r.Checks {
+		if check.Status == CheckFailed {
+			return false
+		}
+	}
+	return true
+}
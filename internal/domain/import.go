@@ -0,0 +1,249 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxImportErrors is the most record errors an import reports; later failures are
+// only counted
+const MaxImportErrors = 100
+
+// Formats of import files
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson" // One JSON object per line
+)
+
+// ImportColumns are the CSV columns and NDJSON fields an import accepts, named
+// like the JSON fields of Event. Event ids are always assigned on import.
+var ImportColumns = []string{
+	"timestamp", "event_name", "user_id", "session_id", "session_duration",
+	"url", "referrer", "user_agent", "ip", "country", "region", "language",
+	"browser", "os", "device", "screen_width", "screen_height", "is_bot",
+	"project_id", "channel", "received_at", "sample_rate",
+}
+
+// RequiredImportColumns are the ImportColumns every import must have
+var RequiredImportColumns = []string{"timestamp", "event_name"}
+
+// ErrInvalidImport is wrapped by errors about the import file as a whole, such as
+// a header that does not match ImportColumns, rows that are not valid CSV or an
+// NDJSON line too long to read
+var ErrInvalidImport = errors.New("invalid import")
+
+// importTimeLayouts are the timestamp formats an import accepts. Timestamps
+// without a zone are UTC.
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// ImportError reports a record of an import that was not stored
+type ImportError struct {
+	Line  int    `json:"line"` // Line of the record in the file, the CSV header being line 1
+	Error string `json:"error"`
+}
+
+// ImportResult describes an import of historical events
+type ImportResult struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"` // Records that failed validation
+	Errors   []ImportError `json:"errors"`  // The first MaxImportErrors skipped records
+}
+
+// ValidateImportHeader checks the columns of an import file: each must be one of
+// ImportColumns, named once, and every one of RequiredImportColumns must be there
+func ValidateImportHeader(header []string) error {
+	known := make(map[string]bool, len(ImportColumns))
+	for _, column := range ImportColumns {
+		known[column] = true
+	}
+
+	seen := make(map[string]bool, len(header))
+	for _, column := range header {
+		if !known[column] {
+			return fmt.Errorf("%w: unknown column %q, expected columns from %s", ErrInvalidImport, column, strings.Join(ImportColumns, ", "))
+		}
+		if seen[column] {
+			return fmt.Errorf("%w: column %q appears more than once", ErrInvalidImport, column)
+		}
+		seen[column] = true
+	}
+	for _, column := range RequiredImportColumns {
+		if !seen[column] {
+			return fmt.Errorf("%w: missing required column %q", ErrInvalidImport, column)
+		}
+	}
+	return nil
+}
+
+// ParseImportRow builds the event of one import row, values being in the order of
+// the validated header. Empty values leave their field unset.
+func ParseImportRow(header, values []string) (Event, error) {
+	var event Event
+	for i, column := range header {
+		value := strings.TrimSpace(values[i])
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch column {
+		case "timestamp":
+			event.Timestamp, err = parseImportTime(value)
+		case "received_at":
+			event.ReceivedAt, err = parseImportTime(value)
+		case "session_duration":
+			event.SessionDuration, err = strconv.Atoi(value)
+		case "screen_width":
+			event.ScreenWidth, err = strconv.Atoi(value)
+		case "screen_height":
+			event.ScreenHeight, err = strconv.Atoi(value)
+		case "is_bot":
+			event.IsBot, err = strconv.ParseBool(value)
+		case "sample_rate":
+			event.SampleRate, err = strconv.ParseFloat(value, 64)
+			if err == nil && (event.SampleRate <= 0 || event.SampleRate > 1) {
+				err = errors.New("must be in (0, 1]")
+			}
+		default:
+			*importStringField(&event, column) = values[i]
+		}
+		if err != nil {
+			return Event{}, fmt.Errorf("%s: invalid value %q: %v", column, value, unwrapParseError(err))
+		}
+	}
+
+	if err := checkImportRequired(event); err != nil {
+		return Event{}, err
+	}
+	return event, nil
+}
+
+// ParseImportJSON builds the event of one NDJSON import line, an object of
+// ImportColumns fields. Timestamps are read like CSV ones.
+func ParseImportJSON(line []byte) (Event, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Event{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+	known := make(map[string]bool, len(ImportColumns))
+	for _, column := range ImportColumns {
+		known[column] = true
+	}
+	for field := range fields {
+		if !known[field] {
+			return Event{}, fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	// Timestamps are decoded as text and parsed by parseImportTime
+	var record struct {
+		Event
+		Timestamp  string `json:"timestamp"`
+		ReceivedAt string `json:"received_at"`
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return Event{}, fmt.Errorf("%s: expected a %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return Event{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	event := record.Event
+	event.ID, event.EventID = 0, ""
+	var err error
+	if strings.TrimSpace(record.Timestamp) != "" {
+		if event.Timestamp, err = parseImportTime(strings.TrimSpace(record.Timestamp)); err != nil {
+			return Event{}, fmt.Errorf("timestamp: invalid value %q: %v", record.Timestamp, err)
+		}
+	}
+	if strings.TrimSpace(record.ReceivedAt) != "" {
+		if event.ReceivedAt, err = parseImportTime(strings.TrimSpace(record.ReceivedAt)); err != nil {
+			return Event{}, fmt.Errorf("received_at: invalid value %q: %v", record.ReceivedAt, err)
+		}
+	}
+	if event.SampleRate < 0 || event.SampleRate > 1 {
+		return Event{}, fmt.Errorf("sample_rate: invalid value %v: must be in (0, 1]", event.SampleRate)
+	}
+	if err := checkImportRequired(event); err != nil {
+		return Event{}, err
+	}
+	return event, nil
+}
+
+// checkImportRequired checks the event of an import record has the fields of
+// RequiredImportColumns
+func checkImportRequired(event Event) error {
+	if event.Timestamp.IsZero() {
+		return errors.New("timestamp is required")
+	}
+	if strings.TrimSpace(event.EventName) == "" {
+		return errors.New("event_name is required")
+	}
+	return nil
+}
+
+// importStringField returns the string field of event read from column
+func importStringField(event *Event, column string) *string {
+	switch column {
+	case "event_name":
+		return &event.EventName
+	case "user_id":
+		return &event.UserID
+	case "session_id":
+		return &event.SessionID
+	case "url":
+		return &event.URL
+	case "referrer":
+		return &event.Referrer
+	case "user_agent":
+		return &event.UserAgent
+	case "ip":
+		return &event.IP
+	case "country":
+		return &event.Country
+	case "region":
+		return &event.Region
+	case "language":
+		return &event.Language
+	case "browser":
+		return &event.Browser
+	case "os":
+		return &event.OS
+	case "device":
+		return &event.Device
+	case "project_id":
+		return &event.ProjectID
+	case "channel":
+		return &event.Channel
+	}
+	panic(fmt.Sprintf("no string field for import column %q", column))
+}
+
+// parseImportTime parses a timestamp in one of importTimeLayouts
+func parseImportTime(value string) (time.Time, error) {
+	for _, layout := range importTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New("expected an RFC 3339 or \"YYYY-MM-DD HH:MM:SS\" timestamp")
+}
+
+// unwrapParseError drops the repeated input from strconv errors
+func unwrapParseError(err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		return numErr.Err
+	}
+	return err
+}
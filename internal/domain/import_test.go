@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateImportHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []string
+		wantErr string
+	}{
+		{"Required columns", []string{"timestamp", "event_name"}, ""},
+		{"Every column", ImportColumns, ""},
+		{"Unknown column", []string{"timestamp", "event_name", "id"}, `unknown column "id"`},
+		{"Repeated column", []string{"timestamp", "event_name", "url", "url"}, `column "url" appears more than once`},
+		{"Missing timestamp", []string{"event_name", "url"}, `missing required column "timestamp"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateImportHeader(tt.header)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected a valid header, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidImport) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected ErrInvalidImport with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseImportRow(t *testing.T) {
+	header := []string{"timestamp", "event_name", "url", "session_duration", "is_bot", "sample_rate", "received_at"}
+	tests := []struct {
+		name     string
+		values   []string
+		expected Event
+		wantErr  string
+	}{
+		{
+			name:   "RFC 3339 with zone",
+			values: []string{"2024-03-01T12:30:00+02:00", "page_view", "/pricing", "42", "true", "0.5", "2024-03-01 10:31:00"},
+			expected: Event{
+				Timestamp: time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), EventName: "page_view", URL: "/pricing",
+				SessionDuration: 42, IsBot: true, SampleRate: 0.5, ReceivedAt: time.Date(2024, 3, 1, 10, 31, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "Empty optional values",
+			values:   []string{"2024-03-01 10:30:00.250", "signup", "", "", "", "", ""},
+			expected: Event{Timestamp: time.Date(2024, 3, 1, 10, 30, 0, 250e6, time.UTC), EventName: "signup"},
+		},
+		{"Missing timestamp", []string{"", "page_view", "", "", "", "", ""}, Event{}, "timestamp is required"},
+		{"Missing event name", []string{"2024-03-01T10:30:00Z", " ", "", "", "", "", ""}, Event{}, "event_name is required"},
+		{"Bad timestamp", []string{"yesterday", "page_view", "", "", "", "", ""}, Event{}, `timestamp: invalid value "yesterday"`},
+		{"Bad integer", []string{"2024-03-01T10:30:00Z", "page_view", "", "1.5", "", "", ""}, Event{}, `session_duration: invalid value "1.5": invalid syntax`},
+		{"Bad boolean", []string{"2024-03-01T10:30:00Z", "page_view", "", "", "maybe", "", ""}, Event{}, "is_bot: invalid value"},
+		{"Sample rate out of range", []string{"2024-03-01T10:30:00Z", "page_view", "", "", "", "2", ""}, Event{}, "sample_rate: invalid value \"2\": must be in (0, 1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ParseImportRow(header, tt.values)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected an error with %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseImportRow failed: %v", err)
+			}
+			if event != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, event)
+			}
+		})
+	}
+}
+
+func TestParseImportJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected Event
+		wantErr  string
+	}{
+		{
+			name: "Typed fields",
+			line: `{"timestamp":"2024-03-01T12:30:00+02:00","event_name":"page_view","url":"/pricing","session_duration":42,"is_bot":true,"sample_rate":0.5,"received_at":"2024-03-01 10:31:00"}`,
+			expected: Event{
+				Timestamp: time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), EventName: "page_view", URL: "/pricing",
+				SessionDuration: 42, IsBot: true, SampleRate: 0.5, ReceivedAt: time.Date(2024, 3, 1, 10, 31, 0, 0, time.UTC),
+			},
+		},
+		{"Missing timestamp", `{"event_name":"page_view"}`, Event{}, "timestamp is required"},
+		{"Missing event name", `{"timestamp":"2024-03-01T10:30:00Z","event_name":" "}`, Event{}, "event_name is required"},
+		{"Bad timestamp", `{"timestamp":"yesterday","event_name":"page_view"}`, Event{}, `timestamp: invalid value "yesterday"`},
+		{"Wrong type", `{"timestamp":"2024-03-01T10:30:00Z","event_name":"page_view","screen_width":"wide"}`, Event{}, "screen_width: expected a int, got string"},
+		{"Unknown field", `{"timestamp":"2024-03-01T10:30:00Z","event_name":"page_view","id":7}`, Event{}, `unknown field "id"`},
+		{"Sample rate out of range", `{"timestamp":"2024-03-01T10:30:00Z","event_name":"page_view","sample_rate":2}`, Event{}, "sample_rate: invalid value 2"},
+		{"Not JSON", `timestamp,event_name`, Event{}, "invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ParseImportJSON([]byte(tt.line))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected an error with %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseImportJSON failed: %v", err)
+			}
+			if event != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, event)
+			}
+		})
+	}
+}
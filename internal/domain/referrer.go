@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ReferrerHostPattern captures the host of a referrer, whether it is a full URL or
+// a bare host. It is RE2 syntax so queries can apply the same rule, see
+// repository.referrerDomainSQL.
+const ReferrerHostPattern = `^(?:[a-zA-Z][a-zA-Z0-9+.\-]*://)?(?:[^/?#@]*@)?([^/?#:]*)`
+
+var referrerHost = regexp.MustCompile(ReferrerHostPattern)
+
+// NormalizeReferrer reduces a referrer to its bare domain: lowercase, without
+// scheme, credentials, port, "www.", path, query or fragment. So
+// "https://www.Google.com/search?q=x" becomes "google.com". An empty referrer
+// stays empty.
+func NormalizeReferrer(referrer string) string {
+	match := referrerHost.FindStringSubmatch(strings.TrimSpace(referrer))
+	if match == nil {
+		return ""
+	}
+	host := strings.ToLower(match[1])
+	host = strings.TrimPrefix(host, "www.")
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,91 @@
+package domain
+
+import "encoding/json"
+
+// Typed stats results. Fields are declared in the order of their JSON keys, so
+// they encode exactly like the maps the endpoints returned before.
+
+// OptionalRate is a percentage that can be missing, null or a number. The zero
+// value is missing and left out of JSON by the omitzero option; NullRate is a rate
+// withheld because its sample is below RATE_MIN_SAMPLE.
+type OptionalRate struct {
+	Value *float64 // nil for a null rate
+	Set   bool
+}
+
+// RateOf returns a rate of value
+func RateOf(value float64) OptionalRate {
+	return OptionalRate{Value: &value, Set: true}
+}
+
+// NullRate returns a rate withheld for lack of samples
+func NullRate() OptionalRate {
+	return OptionalRate{Set: true}
+}
+
+// IsNull reports whether the rate is set but withheld
+func (r OptionalRate) IsNull() bool {
+	return r.Set && r.Value == nil
+}
+
+// IsZero reports whether the rate is missing, for omitzero
+func (r OptionalRate) IsZero() bool {
+	return !r.Set
+}
+
+func (r OptionalRate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Value)
+}
+
+func (r *OptionalRate) UnmarshalJSON(data []byte) error {
+	r.Set = true
+	return json.Unmarshal(data, &r.Value)
+}
+
+// JSONType tells the OpenAPI document what the rate encodes as
+func (OptionalRate) JSONType() (typ string, nullable bool) {
+	return "number", true
+}
+
+// TopStatsResult is the overview of a date range: totals, rates and the changes
+// from the previous period of the same length. The previous period's fields are
+// missing when it could not be read, and each change is missing when the
+// previous value is zero.
+type TopStatsResult struct {
+	Meta                StatsMeta    `json:"_meta"`
+	AvgSessionDuration  float64      `json:"avg_session_duration"` // Seconds per session
+	BotEvents           int          `json:"bot_events"`
+	BotPercentage       float64      `json:"bot_percentage"`
+	BotUsers            int          `json:"bot_users"`
+	BounceRate          OptionalRate `json:"bounce_rate,omitzero"` // 0 without sessions with page views
+	EventsChange        OptionalRate `json:"events_change,omitzero"`
+	HumanEvents         int          `json:"human_events"`
+	HumanUsers          int          `json:"human_users"`
+	InsufficientData    []string     `json:"insufficient_data,omitempty"` // Keys of the rates withheld as null
+	PageViews           int          `json:"page_views"`
+	PageViewsChange     OptionalRate `json:"page_views_change,omitzero"`
+	PrevPageViews       *int         `json:"prev_page_views,omitempty"`
+	PrevTotalEvents     *int         `json:"prev_total_events,omitempty"`
+	PrevTotalVisits     *int         `json:"prev_total_visits,omitempty"`
+	PrevUniqueUsers     *int         `json:"prev_unique_users,omitempty"`
+	PrevViewsPerVisit   *float64     `json:"prev_views_per_visit,omitempty"`
+	SessionsWithViews   *int         `json:"sessions_with_views,omitempty"`  // Set with the bounce rate
+	SinglePageSessions  *int         `json:"single_page_sessions,omitempty"` // Bounced sessions, set with the bounce rate
+	TotalEvents         int          `json:"total_events"`
+	TotalVisits         int          `json:"total_visits"`
+	UniqueUsers         int          `json:"unique_users"`
+	UsersChange         OptionalRate `json:"users_change,omitzero"`
+	ViewsPerVisit       float64      `json:"views_per_visit"`
+	ViewsPerVisitChange OptionalRate `json:"views_per_visit_change,omitzero"`
+	VisitsChange        OptionalRate `json:"visits_change,omitzero"`
+}
+
+// ChannelResult is the traffic of one channel
+type ChannelResult struct {
+	Channel        string  `json:"channel"`
+	ConversionRate float64 `json:"conversion_rate"` // Page views per visit
+	PageViews      int64   `json:"page_views"`
+	TotalEvents    int64   `json:"total_events"`
+	TotalVisits    int64   `json:"total_visits"`
+	UniqueUsers    int64   `json:"unique_users"`
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResultsEncodeLikeMaps(t *testing.T) {
+	singlePage, withViews := 3, 8
+	prevEvents, prevUsers, prevVisits, prevViews := 90, 20, 0, 40
+	prevViewsPerVisit := 2.0
+	meta := NewStatsMeta(true, 100)
+
+	tests := []struct {
+		name     string
+		result   interface{}
+		expected interface{}
+	}{
+		{
+			"Without previous period or bounce query",
+			TopStatsResult{Meta: meta, TotalEvents: 100, UniqueUsers: 10, BounceRate: RateOf(0), ViewsPerVisit: 1.5},
+			map[string]interface{}{
+				"_meta": meta, "total_events": 100, "unique_users": 10, "total_visits": 0, "page_views": 0,
+				"views_per_visit": 1.5, "avg_session_duration": 0.0, "bounce_rate": 0.0,
+				"bot_events": 0, "human_events": 0, "bot_users": 0, "human_users": 0, "bot_percentage": 0.0,
+			},
+		},
+		{
+			"With missing, null and set rates",
+			TopStatsResult{
+				Meta: meta, TotalEvents: 100, UniqueUsers: 10, TotalVisits: 12, PageViews: 50, ViewsPerVisit: 2.5,
+				AvgSessionDuration: 61.5, BotEvents: 5, HumanEvents: 95, BotUsers: 1, HumanUsers: 9, BotPercentage: 5,
+				BounceRate: NullRate(), SinglePageSessions: &singlePage, SessionsWithViews: &withViews,
+				PrevTotalEvents: &prevEvents, PrevUniqueUsers: &prevUsers, PrevTotalVisits: &prevVisits,
+				PrevPageViews: &prevViews, PrevViewsPerVisit: &prevViewsPerVisit,
+				EventsChange: RateOf(11.111), UsersChange: NullRate(), PageViewsChange: RateOf(25), ViewsPerVisitChange: RateOf(25),
+				InsufficientData: []string{"bounce_rate", "users_change"},
+			},
+			map[string]interface{}{
+				"_meta": meta, "total_events": 100, "unique_users": 10, "total_visits": 12, "page_views": 50,
+				"views_per_visit": 2.5, "avg_session_duration": 61.5, "bounce_rate": nil,
+				"single_page_sessions": 3, "sessions_with_views": 8,
+				"bot_events": 5, "human_events": 95, "bot_users": 1, "human_users": 9, "bot_percentage": 5.0,
+				"prev_total_events": 90, "prev_unique_users": 20, "prev_total_visits": 0, "prev_page_views": 40, "prev_views_per_visit": 2.0,
+				"events_change": 11.111, "users_change": nil, "page_views_change": 25.0, "views_per_visit_change": 25.0,
+				"insufficient_data": []string{"bounce_rate", "users_change"},
+			},
+		},
+		{
+			"Channel",
+			ChannelResult{Channel: "Search", TotalEvents: 20, UniqueUsers: 4, TotalVisits: 5, PageViews: 8, ConversionRate: 1.6},
+			map[string]interface{}{
+				"channel": "Search", "total_events": int64(20), "unique_users": int64(4), "total_visits": int64(5),
+				"page_views": int64(8), "conversion_rate": 1.6,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.result)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			expected, err := json.Marshal(tt.expected)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if string(got) != string(expected) {
+				t.Errorf("Expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
+
+func TestOptionalRateRoundTrip(t *testing.T) {
+	var decoded struct {
+		Set     OptionalRate `json:"set"`
+		Null    OptionalRate `json:"null"`
+		Missing OptionalRate `json:"missing"`
+	}
+	if err := json.Unmarshal([]byte(`{"set": 12.5, "null": null}`), &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Set.Value == nil || *decoded.Set.Value != 12.5 {
+		t.Errorf("Expected a rate of 12.5, got %+v", decoded.Set)
+	}
+	if !decoded.Null.IsNull() {
+		t.Errorf("Expected a null rate, got %+v", decoded.Null)
+	}
+	if !decoded.Missing.IsZero() {
+		t.Errorf("Expected a missing rate, got %+v", decoded.Missing)
+	}
+}
@@ -0,0 +1,29 @@
+package domain
+
+// MaxScreenDimension is the largest screen width or height accepted, in CSS pixels.
+// Anything larger is a client bug or junk, not a display.
+const MaxScreenDimension = 16384
+
+// Screen widths at which devices are classified as tablets and desktops
+const (
+	TabletMinWidth  = 768
+	DesktopMinWidth = 1024
+)
+
+// ScreenBucket is a range of screen widths reported together. MaxWidth is 0 for
+// the last, open-ended bucket.
+type ScreenBucket struct {
+	Name     string
+	MinWidth int
+	MaxWidth int
+}
+
+// ScreenBuckets are the widths /api/stats/screens reports, following common
+// responsive breakpoints, in ascending order
+var ScreenBuckets = []ScreenBucket{
+	{Name: "mobile", MinWidth: 1, MaxWidth: TabletMinWidth - 1},
+	{Name: "tablet", MinWidth: TabletMinWidth, MaxWidth: DesktopMinWidth - 1},
+	{Name: "laptop", MinWidth: DesktopMinWidth, MaxWidth: 1439},
+	{Name: "desktop", MinWidth: 1440, MaxWidth: 1919},
+	{Name: "wide", MinWidth: 1920},
+}
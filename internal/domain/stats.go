@@ -0,0 +1,326 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// Zone names must resolve on hosts and images without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// StatsSections are the optional parts of the stats response that can be picked
+// with the include parameter. The summary totals are always returned.
+var StatsSections = []string{
+	"top_events",
+	"timeline",
+	"top_pages",
+	"entry_pages",
+	"exit_pages",
+	"browsers",
+	"devices",
+	"os",
+	"top_countries",
+	"top_sources",
+	"trends",
+}
+
+// ParseStatsInclude parses a comma-separated list of stats sections into a set.
+// An empty list or "all" selects every section.
+func ParseStatsInclude(include string) (map[string]bool, error) {
+	sections := make(map[string]bool, len(StatsSections))
+	include = strings.TrimSpace(include)
+	if include == "" || include == "all" {
+		for _, section := range StatsSections {
+			sections[section] = true
+		}
+		return sections, nil
+	}
+
+	for _, name := range strings.Split(include, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			return ParseStatsInclude("all")
+		}
+		if !isStatsSection(name) {
+			return nil, fmt.Errorf("unknown stats section %q", name)
+		}
+		sections[name] = true
+	}
+	return sections, nil
+}
+
+func isStatsSection(name string) bool {
+	for _, section := range StatsSections {
+		if section == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats reports whose query plan can be asked for with explain=1
+const (
+	ReportOverview  = "overview"
+	ReportTimeline  = "timeline"
+	ReportPages     = "pages"
+	ReportCountries = "countries"
+	ReportLanguages = "languages"
+	ReportSources   = "sources"
+	ReportEvents    = "events"
+)
+
+// ErrUnknownReport is returned when explaining a report that has no explainable query
+var ErrUnknownReport = errors.New("unknown report")
+
+// ExactCounts reports whether the exact filter ("1" or "true") asks for exact
+// distinct counts. APPROX_COUNT_DISTINCT is off by a few percent, which is
+// noticeable on small datasets (97 users instead of 100).
+func ExactCounts(filters map[string]string) bool {
+	switch filters["exact"] {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+// StatsMeta tells clients how the numbers in a stats response were computed, so
+// estimates can be shown with error bars. Returned as "_meta".
+type StatsMeta struct {
+	Approximate   bool        `json:"approximate"`
+	DistinctCount string      `json:"distinct_count"`         // "hyperloglog" or "exact"
+	RowsScanned   int64       `json:"rows_scanned,omitempty"` // Events matching the filters, when known
+	SampleRate    float64     `json:"sample_rate,omitempty"`  // Share of events stored by ingestion sampling, omitted when nothing was sampled
+	Range         *StatsRange `json:"range,omitempty"`        // Dates the response covers, when known
+}
+
+// StatsRange is the resolved date range of a stats response, so clients sending a
+// period need not repeat the date math
+type StatsRange struct {
+	Start    string `json:"start"` // First day, YYYY-MM-DD
+	End      string `json:"end"`   // Last day, inclusive
+	TimeZone string `json:"tz"`
+	Period   string `json:"period,omitempty"` // The period the range was computed from
+}
+
+// NewStatsMeta describes a response computed with exact or approximate distinct counts
+func NewStatsMeta(exact bool, rowsScanned int64) StatsMeta {
+	meta := StatsMeta{Approximate: true, DistinctCount: "hyperloglog", RowsScanned: rowsScanned}
+	if exact {
+		meta.Approximate = false
+		meta.DistinctCount = "exact"
+	}
+	return meta
+}
+
+// Time bases stats can be bucketed and filtered by
+const (
+	TimeBasisEvent    = "event"    // Client-reported timestamp
+	TimeBasisReceived = "received" // Server ingestion time (received_at)
+)
+
+// ParseTimeBasis validates a time_basis value. Empty selects TimeBasisEvent.
+func ParseTimeBasis(basis string) (string, error) {
+	switch strings.TrimSpace(basis) {
+	case "", TimeBasisEvent:
+		return TimeBasisEvent, nil
+	case TimeBasisReceived:
+		return TimeBasisReceived, nil
+	}
+	return "", fmt.Errorf("unknown time_basis %q, expected %q or %q", basis, TimeBasisEvent, TimeBasisReceived)
+}
+
+// ParseTimeZone validates a tz value, an IANA time zone name such as "Asia/Tokyo".
+// Empty selects UTC. "Local" is rejected, the server zone means nothing to clients.
+func ParseTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name != "Local" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown tz %q, expected an IANA time zone name such as \"Europe/Berlin\"", name)
+}
+
+// Relative date ranges selectable with the period parameter
+const (
+	PeriodToday      = "today"
+	PeriodYesterday  = "yesterday"
+	Period7Days      = "7d"
+	Period30Days     = "30d"
+	PeriodThisMonth  = "this_month"
+	PeriodLastMonth  = "last_month"
+	PeriodYearToDate = "ytd"
+)
+
+// ParseDay returns the first and last instant of day, a YYYY-MM-DD date. Stats
+// queries shift stored timestamps to wall-clock time in the tz zone, so the instants
+// are wall-clock times too, in UTC, and select the whole day in that zone.
+func ParseDay(day string) (first, last time.Time, err error) {
+	first, err = time.Parse("2006-01-02", day)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return first, first.Add(24*time.Hour - time.Nanosecond), nil
+}
+
+// Periods are the accepted period values
+var Periods = []string{PeriodToday, PeriodYesterday, Period7Days, Period30Days, PeriodThisMonth, PeriodLastMonth, PeriodYearToDate}
+
+// PeriodRange returns the first and last day of period, at midnight in the zone of
+// today. Rolling periods include today: "7d" is today and the 6 days before it.
+func PeriodRange(period string, today time.Time) (first, last time.Time, err error) {
+	year, month, day := today.Date()
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, today.Location())
+	}
+
+	switch period {
+	case PeriodToday:
+		return date(year, month, day), date(year, month, day), nil
+	case PeriodYesterday:
+		return date(year, month, day-1), date(year, month, day-1), nil
+	case Period7Days:
+		return date(year, month, day-6), date(year, month, day), nil
+	case Period30Days:
+		return date(year, month, day-29), date(year, month, day), nil
+	case PeriodThisMonth:
+		return date(year, month, 1), date(year, month, day), nil
+	case PeriodLastMonth:
+		// Day 0 of a month is the last day of the one before
+		return date(year, month-1, 1), date(year, month, 0), nil
+	case PeriodYearToDate:
+		return date(year, time.January, 1), date(year, month, day), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown period %q, expected one of %s", period, strings.Join(Periods, ", "))
+}
+
+// Bounce definitions selectable with the bounce_mode filter
+const (
+	BounceSinglePageview = "single_pageview" // One page view, whatever else happened (default)
+	BounceSingleEvent    = "single_event"    // One event in total, which was a page view
+)
+
+// ParseBounceMode validates a bounce_mode value. Empty selects BounceSinglePageview.
+func ParseBounceMode(mode string) (string, error) {
+	switch strings.TrimSpace(mode) {
+	case "", BounceSinglePageview:
+		return BounceSinglePageview, nil
+	case BounceSingleEvent:
+		return BounceSingleEvent, nil
+	}
+	return "", fmt.Errorf("unknown bounce_mode %q, expected %q or %q", mode, BounceSinglePageview, BounceSingleEvent)
+}
+
+// Funnel scopes: what a step must share with the previous one to count as progress
+const (
+	FunnelScopeUser    = "user"    // Same user, any session (default)
+	FunnelScopeSession = "session" // Same session
+)
+
+// ParseFunnelScope validates a funnel scope. Empty selects FunnelScopeUser.
+func ParseFunnelScope(scope string) (string, error) {
+	switch strings.TrimSpace(scope) {
+	case "", FunnelScopeUser:
+		return FunnelScopeUser, nil
+	case FunnelScopeSession:
+		return FunnelScopeSession, nil
+	}
+	return "", fmt.Errorf("unknown scope %q, expected %q or %q", scope, FunnelScopeUser, FunnelScopeSession)
+}
+
+// Geographic levels top regions can be grouped by
+const (
+	RegionLevelContinent = "continent"
+	RegionLevelCountry   = "country" // Default
+	RegionLevelRegion    = "region"  // State or province, within its country
+)
+
+// ParseRegionLevel validates a region level. Empty selects RegionLevelCountry.
+func ParseRegionLevel(level string) (string, error) {
+	switch strings.TrimSpace(level) {
+	case "", RegionLevelCountry:
+		return RegionLevelCountry, nil
+	case RegionLevelContinent:
+		return RegionLevelContinent, nil
+	case RegionLevelRegion:
+		return RegionLevelRegion, nil
+	}
+	return "", fmt.Errorf("unknown level %q, expected %q, %q or %q", level, RegionLevelContinent, RegionLevelCountry, RegionLevelRegion)
+}
+
+// FilterFields are the filters whose values can be listed for filter menus, see
+// ParseFilterFields. Each name is also the filter key the value is applied with.
+var FilterFields = []string{
+	"country",
+	"browser",
+	"device",
+	"os",
+	"source",
+	"event",
+	"page",
+	"project",
+}
+
+// ParseFilterFields parses a comma-separated list of filter fields, keeping their
+// order and dropping duplicates. An empty list selects every field.
+func ParseFilterFields(fields string) ([]string, error) {
+	fields = strings.TrimSpace(fields)
+	if fields == "" {
+		return append([]string(nil), FilterFields...), nil
+	}
+
+	var parsed []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if !isFilterField(name) {
+			return nil, fmt.Errorf("unknown filter field %q", name)
+		}
+		seen[name] = true
+		parsed = append(parsed, name)
+	}
+	return parsed, nil
+}
+
+func isFilterField(name string) bool {
+	for _, field := range FilterFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterValue is one value of a filter field and how many events have it
+type FilterValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Where a lifetime unique user count comes from
+const (
+	LifetimeSourceSketch = "sketch" // The user sketch updated on each flush
+	LifetimeSourceScan   = "scan"   // A scan of every stored event
+)
+
+// ErrNoUserSketch is returned when rebuilding the user sketch under the table
+// backend, which counts lifetime users with a scan instead
+var ErrNoUserSketch = errors.New("the table backend keeps no user sketch")
+
+// LifetimeUsers is the number of distinct users across every stored event, an
+// estimate when it comes from the sketch
+type LifetimeUsers struct {
+	UniqueUsers int64  `json:"unique_users"`
+	Source      string `json:"source"` // LifetimeSourceSketch or LifetimeSourceScan
+}
@@ -0,0 +1,301 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatsInclude(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  string
+		expected []string
+		wantErr  bool
+	}{
+		{"Empty selects all", "", StatsSections, false},
+		{"All keyword", "all", StatsSections, false},
+		{"Subset", "timeline,top_pages", []string{"timeline", "top_pages"}, false},
+		{"Whitespace and empty items", " timeline , ,trends ", []string{"timeline", "trends"}, false},
+		{"All within a list", "timeline,all", StatsSections, false},
+		{"Unknown section", "timeline,pages", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections, err := ParseStatsInclude(tt.include)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q, got none", tt.include)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error for %q: %v", tt.include, err)
+			}
+			if len(sections) != len(tt.expected) {
+				t.Errorf("Expected %d sections, got %d: %v", len(tt.expected), len(sections), sections)
+			}
+			for _, section := range tt.expected {
+				if !sections[section] {
+					t.Errorf("Expected section %s to be included", section)
+				}
+			}
+		})
+	}
+}
+
+func TestExactCounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		filters  map[string]string
+		expected bool
+	}{
+		{"Unset", map[string]string{}, false},
+		{"One", map[string]string{"exact": "1"}, true},
+		{"True", map[string]string{"exact": "true"}, true},
+		{"Zero", map[string]string{"exact": "0"}, false},
+		{"Nil filters", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExactCounts(tt.filters); got != tt.expected {
+				t.Errorf("ExactCounts(%v) = %v, expected %v", tt.filters, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewStatsMeta(t *testing.T) {
+	approx := NewStatsMeta(false, 1200)
+	if !approx.Approximate || approx.DistinctCount != "hyperloglog" || approx.RowsScanned != 1200 {
+		t.Errorf("Unexpected approximate meta: %+v", approx)
+	}
+
+	exact := NewStatsMeta(true, 0)
+	if exact.Approximate || exact.DistinctCount != "exact" {
+		t.Errorf("Unexpected exact meta: %+v", exact)
+	}
+	if exact.SampleRate != 0 {
+		t.Errorf("Expected no sample rate without sampling, got %v", exact.SampleRate)
+	}
+}
+
+func TestParseTimeBasis(t *testing.T) {
+	tests := []struct {
+		name     string
+		basis    string
+		expected string
+		wantErr  bool
+	}{
+		{"Empty", "", TimeBasisEvent, false},
+		{"Event", "event", TimeBasisEvent, false},
+		{"Received", "received", TimeBasisReceived, false},
+		{"Unknown", "server", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimeBasis(tt.basis)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeBasis(%q) error = %v, wantErr %v", tt.basis, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseTimeBasis(%q) = %q, expected %q", tt.basis, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseTimeZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		tz       string
+		expected string
+		wantErr  bool
+	}{
+		{"Empty", "", "UTC", false},
+		{"UTC", "UTC", "UTC", false},
+		{"Tokyo", "Asia/Tokyo", "Asia/Tokyo", false},
+		{"Padded", " America/New_York ", "America/New_York", false},
+		{"Local", "Local", "", true},
+		{"Unknown", "Mars/Olympus_Mons", "", true},
+		{"Quote", "UTC'", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := ParseTimeZone(tt.tz)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeZone(%q) error = %v, wantErr %v", tt.tz, err, tt.wantErr)
+			}
+			if err == nil && loc.String() != tt.expected {
+				t.Errorf("ParseTimeZone(%q) = %q, expected %q", tt.tz, loc.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	first, last, err := ParseDay("2024-02-29")
+	if err != nil {
+		t.Fatalf("ParseDay failed: %v", err)
+	}
+	if expected := time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC); !first.Equal(expected) {
+		t.Errorf("Expected first instant %v, got %v", expected, first)
+	}
+	if expected := time.Date(2024, 2, 29, 23, 59, 59, 999999999, time.UTC); !last.Equal(expected) {
+		t.Errorf("Expected last instant %v, got %v", expected, last)
+	}
+
+	if _, _, err := ParseDay("2023-02-29"); err == nil {
+		t.Error("Expected an error for a day that does not exist")
+	}
+}
+
+func TestPeriodRange(t *testing.T) {
+	day := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name          string
+		period        string
+		today         time.Time
+		expectedFirst time.Time
+		expectedLast  time.Time
+		wantErr       bool
+	}{
+		{"Today", PeriodToday, day(2024, 3, 1), day(2024, 3, 1), day(2024, 3, 1), false},
+		{"Yesterday across a month", PeriodYesterday, day(2024, 3, 1), day(2024, 2, 29), day(2024, 2, 29), false},
+		{"Yesterday across a year", PeriodYesterday, day(2024, 1, 1), day(2023, 12, 31), day(2023, 12, 31), false},
+		{"7 days across a month", Period7Days, day(2024, 3, 3), day(2024, 2, 26), day(2024, 3, 3), false},
+		{"30 days across a month", Period30Days, day(2024, 3, 15), day(2024, 2, 15), day(2024, 3, 15), false},
+		{"This month on the first", PeriodThisMonth, day(2024, 3, 1), day(2024, 3, 1), day(2024, 3, 1), false},
+		{"This month on the last day", PeriodThisMonth, day(2024, 1, 31), day(2024, 1, 1), day(2024, 1, 31), false},
+		{"Last month in a leap year", PeriodLastMonth, day(2024, 3, 31), day(2024, 2, 1), day(2024, 2, 29), false},
+		{"Last month across a year", PeriodLastMonth, day(2024, 1, 15), day(2023, 12, 1), day(2023, 12, 31), false},
+		{"Last month after a 31-day month", PeriodLastMonth, day(2024, 4, 1), day(2024, 3, 1), day(2024, 3, 31), false},
+		{"Year to date", PeriodYearToDate, day(2024, 3, 1), day(2024, 1, 1), day(2024, 3, 1), false},
+		{"Year to date on January 1", PeriodYearToDate, day(2024, 1, 1), day(2024, 1, 1), day(2024, 1, 1), false},
+		{"Unknown", "last_week", day(2024, 3, 1), time.Time{}, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, last, err := PeriodRange(tt.period, tt.today)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PeriodRange(%q) error = %v, wantErr %v", tt.period, err, tt.wantErr)
+			}
+			if !first.Equal(tt.expectedFirst) || !last.Equal(tt.expectedLast) {
+				t.Errorf("PeriodRange(%q, %v) = %v to %v, expected %v to %v", tt.period, tt.today, first, last, tt.expectedFirst, tt.expectedLast)
+			}
+		})
+	}
+}
+
+func TestParseBounceMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		expected string
+		wantErr  bool
+	}{
+		{"Empty", "", BounceSinglePageview, false},
+		{"Single pageview", "single_pageview", BounceSinglePageview, false},
+		{"Single event", "single_event", BounceSingleEvent, false},
+		{"Unknown", "ga4", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBounceMode(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBounceMode(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseBounceMode(%q) = %q, expected %q", tt.mode, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseFunnelScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		scope    string
+		expected string
+		wantErr  bool
+	}{
+		{"Empty", "", FunnelScopeUser, false},
+		{"User", "user", FunnelScopeUser, false},
+		{"Session", "session", FunnelScopeSession, false},
+		{"Unknown", "device", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFunnelScope(tt.scope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFunnelScope(%q) error = %v, wantErr %v", tt.scope, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseFunnelScope(%q) = %q, expected %q", tt.scope, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseRegionLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    string
+		expected string
+		wantErr  bool
+	}{
+		{"Empty", "", RegionLevelCountry, false},
+		{"Continent", "continent", RegionLevelContinent, false},
+		{"Country", "country", RegionLevelCountry, false},
+		{"Region", "region", RegionLevelRegion, false},
+		{"Unknown", "city", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRegionLevel(tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRegionLevel(%q) error = %v, wantErr %v", tt.level, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseRegionLevel(%q) = %q, expected %q", tt.level, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseFilterFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   string
+		expected []string
+		wantErr  bool
+	}{
+		{"Empty selects all", "", FilterFields, false},
+		{"Subset in order", "event, country", []string{"event", "country"}, false},
+		{"Duplicates dropped", "browser,browser,,os", []string{"browser", "os"}, false},
+		{"Unknown field", "country,user_agent", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilterFields(tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilterFields(%q) error = %v, wantErr %v", tt.fields, err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("ParseFilterFields(%q) = %v, expected %v", tt.fields, got, tt.expected)
+			}
+		})
+	}
+}
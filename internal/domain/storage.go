@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+// StorageStats describes the stored events and the room they take on disk
+type StorageStats struct {
+	Backend     string        `json:"backend"`                // STORAGE_BACKEND: "parquet" or "table"
+	TotalEvents int64         `json:"total_events"`           // Stored events, not counting buffered ones
+	OldestEvent *time.Time    `json:"oldest_event,omitempty"` // Timestamp range of the stored events, unset when there are none
+	NewestEvent *time.Time    `json:"newest_event,omitempty"`
+	FileCount   int           `json:"file_count"`
+	TotalBytes  int64         `json:"total_bytes"` // On-disk size of the Parquet files
+	Files       []StorageFile `json:"files"`
+	Buffer      *BufferStats  `json:"buffer,omitempty"` // Unset under the table backend, which does not buffer
+}
+
+// StorageFile is one Parquet file of the stored events
+type StorageFile struct {
+	Path      string `json:"path"`
+	Bytes     int64  `json:"bytes"`
+	Rows      int64  `json:"rows"`
+	RowGroups int    `json:"row_groups"`
+}
+
+// BufferStats describes the events waiting in memory to be flushed to Parquet
+type BufferStats struct {
+	Events          int `json:"events"`            // Events in the buffer
+	FlushSize       int `json:"flush_size"`        // Buffered events that start a flush, PARQUET_BUFFER_SIZE
+	Capacity        int `json:"capacity"`          // Buffered events past which BUFFER_FULL_POLICY applies
+	FlushesInFlight int `json:"flushes_in_flight"` // Flushes writing taken events to disk
+}
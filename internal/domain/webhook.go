@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Webhook trigger kinds, see WebhookPayload.Trigger
+const (
+	WebhookTriggerEvent       = "event"
+	WebhookTriggerOnlineUsers = "online_users"
+)
+
+// Webhook is a URL that is POSTed a WebhookPayload whenever its trigger fires
+type Webhook struct {
+	Name    string         `json:"name"`
+	URL     string         `json:"url"`
+	Trigger WebhookTrigger `json:"trigger"`
+	// RateLimit is the most deliveries per minute, further triggers in the minute
+	// are dropped. Zero uses the default.
+	RateLimit int `json:"rate_limit,omitempty"`
+}
+
+// WebhookTrigger is the rule a webhook fires on. Exactly one of Event and
+// OnlineUsers is set.
+type WebhookTrigger struct {
+	Event       string `json:"event,omitempty"`        // Fires for every tracked event with this name
+	OnlineUsers int    `json:"online_users,omitempty"` // Fires when online users rise to this many
+	Project     string `json:"project,omitempty"`      // Only events of this project, for event triggers
+}
+
+// Validate reports whether the webhook has a name, an http(s) URL and one trigger
+func (w Webhook) Validate() error {
+	if w.Name == "" {
+		return errors.New("webhook name is required")
+	}
+	parsed, err := url.Parse(w.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("webhook url must be an http or https URL")
+	}
+	if (w.Trigger.Event == "") == (w.Trigger.OnlineUsers <= 0) {
+		return errors.New("webhook trigger needs exactly one of event or online_users")
+	}
+	if w.RateLimit < 0 {
+		return errors.New("webhook rate_limit must not be negative")
+	}
+	return nil
+}
+
+// WebhookPayload is the JSON body POSTed to a webhook
+type WebhookPayload struct {
+	Webhook     string    `json:"webhook"`
+	Trigger     string    `json:"trigger"`                // "event" or "online_users"
+	Event       *Event    `json:"event,omitempty"`        // The enriched event, for event triggers
+	OnlineUsers int       `json:"online_users,omitempty"` // Users online, for online_users triggers
+	Threshold   int       `json:"threshold,omitempty"`    // The trigger's online_users
+	SentAt      time.Time `json:"sent_at"`
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// MaxAnomalyWindow caps the rolling window, in timeline buckets
+const MaxAnomalyWindow = 90
+
+// GetAnomaliesHandler returns the timeline buckets of a metric that are unusually
+// far from the rolling mean of the buckets before them
+// Endpoint: GET /api/stats/anomalies
+func (h *EventHandler) GetAnomaliesHandler(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+
+	metric := filters["metric"]
+	if metric == "" {
+		metric = "users"
+	}
+	if err := parseAnomalyParams(r, metric, filters); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	anomalies, err := h.service.GetAnomalies(ctx, startDate, endDate, filters, metric)
+	if err != nil {
+		log.Printf("Error getting anomalies: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	h.writeStatsJSON(w, r, anomalies, time.Since(started), "anomalies")
+}
+
+// parseAnomalyParams validates metric and the sigma and window query parameters,
+// adding the latter to filters for the service
+func parseAnomalyParams(r *http.Request, metric string, filters map[string]string) error {
+	if !domain.IsTimelineMetric(metric) {
+		return fmt.Errorf("unknown metric %q", metric)
+	}
+
+	if value := r.URL.Query().Get("sigma"); value != "" {
+		sigma, err := strconv.ParseFloat(value, 64)
+		if err != nil || sigma <= 0 || math.IsInf(sigma, 0) || math.IsNaN(sigma) {
+			return fmt.Errorf("sigma must be a positive number")
+		}
+		filters["sigma"] = value
+	}
+
+	if value := r.URL.Query().Get("window"); value != "" {
+		window, err := strconv.Atoi(value)
+		if err != nil || window < domain.MinAnomalyHistory || window > MaxAnomalyWindow {
+			return fmt.Errorf("window must be between %d and %d", domain.MinAnomalyHistory, MaxAnomalyWindow)
+		}
+		filters["window"] = value
+	}
+	return nil
+}
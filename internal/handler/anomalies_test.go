@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestGetAnomaliesHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:  "Default metric",
+			query: "",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetAnomalies(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "users").
+					Return(&domain.AnomalyResult{Metric: "users", Anomalies: []domain.AnomalyPoint{}}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "Sigma and window",
+			query: "?metric=page_views&sigma=2.5&window=14",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetAnomalies(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "page_views").
+					DoAndReturn(func(_ context.Context, _, _ interface{}, filters map[string]string, metric string) (*domain.AnomalyResult, error) {
+						if filters["sigma"] != "2.5" || filters["window"] != "14" {
+							t.Errorf("Unexpected filters: %v", filters)
+						}
+						return &domain.AnomalyResult{Metric: metric}, nil
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unknown metric",
+			query:          "?metric=revenue",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid sigma",
+			query:          "?sigma=-1",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Window too small",
+			query:          "?window=2",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "Service error",
+			query: "",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetAnomalies(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("database error")).Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/anomalies"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetAnomaliesHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"container/list"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+const (
+	// DefaultDedupWindow is how long an event id is remembered unless DEDUP_WINDOW
+	// says otherwise, enough for client retries with backoff
+	DefaultDedupWindow = time.Hour
+	// DefaultDedupCapacity is how many event ids are remembered unless
+	// DEDUP_CAPACITY says otherwise, about 10 MB of memory
+	DefaultDedupCapacity = 100_000
+)
+
+// dedupWindow reads DEDUP_WINDOW, falling back to DefaultDedupWindow for missing or
+// invalid values
+func dedupWindow() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DEDUP_WINDOW")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultDedupWindow
+}
+
+// dedupCapacity reads DEDUP_CAPACITY, falling back to DefaultDedupCapacity. Zero
+// turns deduplication off.
+func dedupCapacity() int {
+	if n, err := strconv.Atoi(os.Getenv("DEDUP_CAPACITY")); err == nil && n >= 0 {
+		return n
+	}
+	return DefaultDedupCapacity
+}
+
+// eventDeduplicator remembers the ids of recently stored events so an event sent
+// again, such as by a client retrying a request whose response it never got, is
+// stored once. It is an LRU of at most capacity ids, each forgotten after window.
+// Ids only live in memory, so a restart forgets them.
+type eventDeduplicator struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // Of *seenEvent, most recently seen first
+	seen     map[string]*list.Element
+}
+
+type seenEvent struct {
+	key string
+	at  time.Time // First seen, the window is not extended by duplicates
+}
+
+func newEventDeduplicator(capacity int) *eventDeduplicator {
+	return &eventDeduplicator{capacity: capacity, order: list.New(), seen: map[string]*list.Element{}}
+}
+
+// dedupKey scopes an event id to its project, so projects cannot collide
+func dedupKey(event domain.Event) string {
+	return event.ProjectID + "\x00" + event.EventID
+}
+
+// claim reports whether key is new, that is not seen within window of now, and
+// remembers it if so
+func (d *eventDeduplicator) claim(key string, now time.Time, window time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if element, ok := d.seen[key]; ok {
+		seen := element.Value.(*seenEvent)
+		d.order.MoveToFront(element)
+		if now.Sub(seen.at) < window {
+			return false
+		}
+		seen.at = now
+		return true
+	}
+
+	d.seen[key] = d.order.PushFront(&seenEvent{key: key, at: now})
+	for d.order.Len() > d.capacity {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.seen, oldest.Value.(*seenEvent).key)
+	}
+	return true
+}
+
+// release forgets key, for a claimed event that could not be stored and may be
+// sent again
+func (d *eventDeduplicator) release(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if element, ok := d.seen[key]; ok {
+		d.order.Remove(element)
+		delete(d.seen, key)
+	}
+}
+
+// dropDuplicates removes the events whose event_id was already stored within
+// DEDUP_WINDOW, including repeats within events. Events without an id are kept.
+// It returns the events to store and a release func that forgets their ids again,
+// to be called when storing them fails.
+func (h *EventHandler) dropDuplicates(events []domain.Event, now time.Time) ([]domain.Event, func()) {
+	if h.dedup == nil {
+		return events, func() {}
+	}
+
+	window := dedupWindow()
+	kept := events[:0]
+	var claimed []string
+	var duplicates int64
+	for _, event := range events {
+		if event.EventID == "" {
+			kept = append(kept, event)
+			continue
+		}
+		key := dedupKey(event)
+		if !h.dedup.claim(key, now, window) {
+			duplicates++
+			continue
+		}
+		claimed = append(claimed, key)
+		kept = append(kept, event)
+	}
+
+	if duplicates > 0 {
+		total := h.dropped.duplicates.Add(duplicates)
+		log.Printf("♻️ Skipped %d duplicate events (%d since startup)", duplicates, total)
+	}
+	return kept, func() {
+		for _, key := range claimed {
+			h.dedup.release(key)
+		}
+	}
+}
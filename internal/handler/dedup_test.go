@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+	"go.uber.org/mock/gomock"
+)
+
+func TestEventDeduplicator(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := time.Hour
+
+	tests := []struct {
+		name     string
+		steps    func(d *eventDeduplicator)
+		key      string
+		at       time.Duration // After start
+		expected bool
+	}{
+		{"New key", func(d *eventDeduplicator) {}, "a", 0, true},
+		{"Seen within the window", func(d *eventDeduplicator) { d.claim("a", start, window) }, "a", 59 * time.Minute, false},
+		{"Seen before the window", func(d *eventDeduplicator) { d.claim("a", start, window) }, "a", time.Hour, true},
+		{"Duplicates do not extend the window", func(d *eventDeduplicator) {
+			d.claim("a", start, window)
+			d.claim("a", start.Add(30*time.Minute), window)
+		}, "a", time.Hour, true},
+		{"Released", func(d *eventDeduplicator) {
+			d.claim("a", start, window)
+			d.release("a")
+		}, "a", time.Minute, true},
+		{"Evicted by capacity", func(d *eventDeduplicator) {
+			d.claim("a", start, window)
+			d.claim("b", start, window)
+			d.claim("c", start, window)
+		}, "a", time.Minute, true},
+		{"Kept by a recent duplicate", func(d *eventDeduplicator) {
+			d.claim("a", start, window)
+			d.claim("b", start, window)
+			d.claim("a", start, window)
+			d.claim("c", start, window)
+		}, "a", time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newEventDeduplicator(2)
+			tt.steps(d)
+			if got := d.claim(tt.key, start.Add(tt.at), window); got != tt.expected {
+				t.Errorf("Expected claim to return %v, got %v", tt.expected, got)
+			}
+			if d.order.Len() != len(d.seen) || d.order.Len() > 2 {
+				t.Errorf("Expected at most 2 consistent entries, got %d in the list and %d in the map", d.order.Len(), len(d.seen))
+			}
+		})
+	}
+}
+
+func TestTrackBatchDeduplication(t *testing.T) {
+	body := `{"events":[
+		{"event_name":"page_view","user_id":"user1","event_id":"e1"},
+		{"event_name":"page_view","user_id":"user1","event_id":"e1","project_id":"other"},
+		{"event_name":"click","user_id":"user1"}
+	]}`
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		failures int   // Store failures before the batch is stored
+		stored   []int // Stored events, for each time the batch is sent
+		expected []int // Deduplicated events in the response, for each time the batch is sent
+	}{
+		{name: "Repeated ids stored once", stored: []int{3, 1}, expected: []int{0, 2}},
+		{name: "Ids released when storing fails", failures: 1, stored: []int{0, 3, 1}, expected: []int{0, 0, 2}},
+		{name: "Off with DEDUP_CAPACITY=0", env: map[string]string{"DEDUP_CAPACITY": "0"}, stored: []int{3, 3}, expected: []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var stored []int
+			calls := 0
+			mockService := mocks.NewMockEventService(ctrl)
+			mockService.EXPECT().
+				TrackEventBatch(gomock.Any()).
+				DoAndReturn(func(events []domain.Event) error {
+					calls++
+					if calls <= tt.failures {
+						stored = append(stored, 0)
+						return storage.ErrBufferFull
+					}
+					stored = append(stored, len(events))
+					return nil
+				}).
+				AnyTimes()
+
+			handler := NewEventHandler(mockService, nil)
+
+			for i, expected := range tt.expected {
+				req := httptest.NewRequest(http.MethodPost, "/api/track/batch", strings.NewReader(body))
+				w := httptest.NewRecorder()
+				handler.TrackBatchEvents(w, req)
+
+				if i < tt.failures {
+					if w.Code != http.StatusServiceUnavailable {
+						t.Fatalf("Request %d: expected status 503, got %d", i, w.Code)
+					}
+					continue
+				}
+				var response struct {
+					Deduplicated int `json:"deduplicated"`
+				}
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if response.Deduplicated != expected {
+					t.Errorf("Request %d: expected %d deduplicated events, got %d", i, expected, response.Deduplicated)
+				}
+			}
+
+			if len(stored) != len(tt.stored) {
+				t.Fatalf("Expected %v stored events, got %v", tt.stored, stored)
+			}
+			for i := range stored {
+				if stored[i] != tt.stored[i] {
+					t.Errorf("Expected %v stored events, got %v", tt.stored, stored)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestTrackEventIdempotencyKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockEventService(ctrl)
+	mockService.EXPECT().TrackEvent(gomock.Any()).Return(nil).Times(1)
+
+	handler := NewEventHandler(mockService, nil)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/track", strings.NewReader(`{"event_name":"signup","user_id":"user1"}`))
+		req.Header.Set("Idempotency-Key", "signup-user1")
+		w := httptest.NewRecorder()
+
+		handler.TrackEvent(w, req)
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"ok"`) {
+			t.Errorf("Request %d: expected 200 ok, got %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+}
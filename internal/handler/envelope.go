@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// ResponseMeta describes how a stats response was produced. It is only sent when the
+// client asks for the envelope with ?meta=1.
+type ResponseMeta struct {
+	QueryMs  int64     `json:"query_ms"`   // Time spent in the service call
+	Cached   bool      `json:"cached"`     // Always false until a response cache exists
+	Rows     int       `json:"rows"`       // Result rows across the response's lists, 1 for a single record
+	DataAsOf time.Time `json:"data_as_of"` // Events tracked after this are not in the response yet
+}
+
+// envelope wraps a stats response together with its ResponseMeta
+type envelope struct {
+	Data interface{}  `json:"data"`
+	Meta ResponseMeta `json:"meta"`
+}
+
+// wantsEnvelope reports whether the meta parameter ("1" or "true") asks for the envelope
+func wantsEnvelope(r *http.Request) bool {
+	switch r.URL.Query().Get("meta") {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+// writeStatsJSON encodes a stats response, bare by default or wrapped in an envelope
+// when requested. queryTime is how long the service call that produced data took.
+func (h *EventHandler) writeStatsJSON(w http.ResponseWriter, r *http.Request, data interface{}, queryTime time.Duration, name string) {
+	var body interface{} = data
+	if wantsEnvelope(r) {
+		body = envelope{
+			Data: data,
+			Meta: ResponseMeta{
+				QueryMs:  queryTime.Milliseconds(),
+				Rows:     resultRows(data),
+				DataAsOf: h.service.DataAsOf().UTC(),
+			},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error encoding %s: %v", name, err)
+	}
+}
+
+// resultRows counts the rows in a response: the length of a list, or the combined
+// length of the lists inside an object. An object without lists is a single row.
+func resultRows(data interface{}) int {
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return v.Len()
+	case reflect.Map:
+		rows, lists := 0, 0
+		iter := v.MapRange()
+		for iter.Next() {
+			value := iter.Value()
+			if value.Kind() == reflect.Interface {
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+				rows += value.Len()
+				lists++
+			}
+		}
+		if lists == 0 {
+			return 1
+		}
+		return rows
+	case reflect.Invalid:
+		return 0
+	}
+	return 1
+}
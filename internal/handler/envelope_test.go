@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestStatsEnvelope(t *testing.T) {
+	asOf := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	countries := []map[string]interface{}{
+		{"name": "Germany", "count": 120},
+		{"name": "Egypt", "count": 80},
+	}
+
+	tests := []struct {
+		name        string
+		queryParams string
+		envelope    bool
+	}{
+		{"Bare by default", "", false},
+		{"Envelope with meta=1", "?meta=1", true},
+		{"Envelope with meta=true", "?meta=true", true},
+		{"Bare with meta=0", "?meta=0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			mockService.EXPECT().GetTopCountries(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(countries, len(countries), nil)
+			if tt.envelope {
+				mockService.EXPECT().DataAsOf().Return(asOf)
+			}
+
+			handler := NewEventHandler(mockService, nil)
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/countries"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetTopCountriesHandler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+
+			if !tt.envelope {
+				var bare []map[string]interface{}
+				if err := json.NewDecoder(w.Body).Decode(&bare); err != nil {
+					t.Fatalf("Expected bare array response: %v", err)
+				}
+				if len(bare) != len(countries) {
+					t.Errorf("Expected %d countries, got %d", len(countries), len(bare))
+				}
+				return
+			}
+
+			var resp struct {
+				Data []map[string]interface{} `json:"data"`
+				Meta map[string]interface{}   `json:"meta"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode envelope: %v", err)
+			}
+			if len(resp.Data) != len(countries) {
+				t.Errorf("Expected %d countries in data, got %d", len(countries), len(resp.Data))
+			}
+			for _, key := range []string{"query_ms", "cached", "rows", "data_as_of"} {
+				if _, ok := resp.Meta[key]; !ok {
+					t.Errorf("Expected meta.%s", key)
+				}
+			}
+			if queryMs, _ := resp.Meta["query_ms"].(float64); queryMs < 0 {
+				t.Errorf("Expected non-negative query_ms, got %v", queryMs)
+			}
+			if cached := resp.Meta["cached"]; cached != false {
+				t.Errorf("Expected cached false, got %v", cached)
+			}
+			if rows := resp.Meta["rows"]; rows != float64(len(countries)) {
+				t.Errorf("Expected rows %d, got %v", len(countries), rows)
+			}
+			if dataAsOf := resp.Meta["data_as_of"]; dataAsOf != asOf.Format(time.RFC3339) {
+				t.Errorf("Expected data_as_of %s, got %v", asOf.Format(time.RFC3339), dataAsOf)
+			}
+		})
+	}
+}
+
+func TestResultRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     interface{}
+		expected int
+	}{
+		{"List", []map[string]interface{}{{}, {}, {}}, 3},
+		{"Empty list", []map[string]interface{}{}, 0},
+		{"Object with lists", map[string]interface{}{
+			"timeline":        []map[string]interface{}{{}, {}},
+			"timeline_format": "day",
+			"entry_pages":     []interface{}{1, 2, 3},
+		}, 5},
+		{"Single record", map[string]interface{}{"dau": 3, "mau": 10}, 1},
+		{"Nil", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resultRows(tt.data); got != tt.expected {
+				t.Errorf("resultRows() = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/mohamedelhefni/siraaj/internal/middleware"
+)
+
+// Error codes of JSON error responses, shared with the middleware. Clients should
+// branch on the code, the message is meant for people and may change.
+const (
+	ErrCodeInvalidRequest   = middleware.ErrCodeInvalidRequest
+	ErrCodeUnauthorized     = middleware.ErrCodeUnauthorized
+	ErrCodeForbidden        = middleware.ErrCodeForbidden
+	ErrCodeNotFound         = middleware.ErrCodeNotFound
+	ErrCodeMethodNotAllowed = middleware.ErrCodeMethodNotAllowed
+	ErrCodeConflict         = middleware.ErrCodeConflict
+	ErrCodeTooLarge         = middleware.ErrCodeTooLarge
+	ErrCodeInternal         = middleware.ErrCodeInternal
+	ErrCodeUnavailable      = middleware.ErrCodeUnavailable
+	ErrCodeTimeout          = middleware.ErrCodeTimeout
+	// ErrCodeBusy is a temporary overload, retry after the Retry-After delay
+	ErrCodeBusy = middleware.ErrCodeBusy
+)
+
+// errorDetail is the "error" member of every error response
+type errorDetail = middleware.ErrorDetail
+
+// writeError sends {"error": {"code": ..., "message": ...}} with status, see
+// middleware.WriteError
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	middleware.WriteError(w, status, code, message)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/middleware"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// errorMessage is the message of a JSON error response, or the raw body otherwise
+func errorMessage(w *httptest.ResponseRecorder) string {
+	var body struct {
+		Error errorDetail `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		return w.Body.String()
+	}
+	return body.Error.Message
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name            string
+		method          string
+		body            string
+		requestID       string
+		expectedStatus  int
+		expectedCode    string
+		expectedMessage string
+	}{
+		{
+			name:            "Invalid JSON with request id",
+			method:          http.MethodPost,
+			body:            `{`,
+			requestID:       "req-42",
+			expectedStatus:  http.StatusBadRequest,
+			expectedCode:    ErrCodeInvalidRequest,
+			expectedMessage: "Invalid JSON",
+		},
+		{
+			name:            "Validation error",
+			method:          http.MethodPost,
+			body:            `{"user_id":"user1"}`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedCode:    ErrCodeInvalidRequest,
+			expectedMessage: "event_name is required",
+		},
+		{
+			name:            "Method not allowed",
+			method:          http.MethodGet,
+			expectedStatus:  http.StatusMethodNotAllowed,
+			expectedCode:    ErrCodeMethodNotAllowed,
+			expectedMessage: "Method not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewEventHandler(mocks.NewMockEventService(gomock.NewController(t)), nil)
+
+			var h http.Handler = http.HandlerFunc(handler.TrackEvent)
+			if tt.requestID != "" {
+				h = middleware.RequestID(h)
+			}
+			req := httptest.NewRequest(tt.method, "/api/track", strings.NewReader(tt.body))
+			req.Header.Set(middleware.RequestIDHeader, tt.requestID)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected a JSON error, got Content-Type %q", ct)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Error response %q is not valid JSON: %v", w.Body.String(), err)
+			}
+
+			var detail map[string]string
+			if err := json.Unmarshal(body["error"], &detail); err != nil {
+				t.Fatalf("Expected an error object, got %s", body["error"])
+			}
+			if len(detail) != 2 || detail["code"] != tt.expectedCode || detail["message"] != tt.expectedMessage {
+				t.Errorf("Expected error {code: %q, message: %q}, got %v", tt.expectedCode, tt.expectedMessage, detail)
+			}
+
+			var id string
+			if raw, ok := body["request_id"]; ok {
+				if err := json.Unmarshal(raw, &id); err != nil {
+					t.Fatalf("Expected request_id to be a string, got %s", raw)
+				}
+			}
+			if id != tt.requestID {
+				t.Errorf("Expected request_id %q, got %q", tt.requestID, id)
+			}
+		})
+	}
+}
@@ -1,12 +1,19 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mohamedelhefni/siraaj/geolocation"
@@ -14,70 +21,99 @@ import (
 	"github.com/mohamedelhefni/siraaj/internal/channeldetector"
 	"github.com/mohamedelhefni/siraaj/internal/domain"
 	"github.com/mohamedelhefni/siraaj/internal/service"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
 )
 
 type EventHandler struct {
 	service    service.EventService
 	geoService *geolocation.Service
+
+	// Live streams
+	liveStreams  chan struct{} // One slot per open stream
+	liveInterval time.Duration
+	shutdown     chan struct{} // Closed by CloseStreams
+	shutdownOnce sync.Once
+
+	salt    *dailySalt // Salt of derived visitor ids and HASH_PII, see privacy.go
+	dropped droppedEvents
+	dedup   *eventDeduplicator // Ids of recently stored events, nil with DEDUP_CAPACITY=0
 }
 
 func NewEventHandler(service service.EventService, geoService *geolocation.Service) *EventHandler {
-	return &EventHandler{
-		service:    service,
-		geoService: geoService,
-	}
+	h := &EventHandler{
+		service:      service,
+		geoService:   geoService,
+		liveStreams:  make(chan struct{}, maxLiveStreams()),
+		liveInterval: LiveStreamInterval,
+		shutdown:     make(chan struct{}),
+		salt:         &dailySalt{},
+	}
+	if capacity := dedupCapacity(); capacity > 0 {
+		h.dedup = newEventDeduplicator(capacity)
+	}
+	return h
 }
 
 func (h *EventHandler) TrackEvent(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var event domain.Event
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxTrackBodySize)).Decode(&event); err != nil {
 		log.Printf("Error Unmarshal json: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeDecodeError(w, err)
 		return
 	}
-
-	// Set timestamp if not provided
-	if event.Timestamp.IsZero() {
-		event.Timestamp = time.Now()
+	if event.EventID == "" {
+		event.EventID = r.Header.Get("Idempotency-Key")
 	}
-
-	// Get IP from request
-	if event.IP == "" {
-		event.IP = getClientIP(r)
+	if err := validateEvent(event, time.Now()); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
 	}
 
-	// Enrich with geolocation data if service is available
-	if h.geoService != nil && event.Country == "" {
-		geo := h.geoService.LookupOrDefault(event.IP)
-		if geo != nil {
-			event.Country = geo.Country
-			if event.Country == "" {
-				event.Country = geo.CountryCode
-			}
-		}
+	// Dropped events are still acknowledged so clients do not retry them
+	if doNotTrack(r) {
+		h.dropDoNotTrack(1)
+		writeTracked(w)
+		return
 	}
 
-	// Detect if user agent belongs to a bot
-	event.IsBot = botdetector.IsBot(event.UserAgent)
+	if event.Language == "" {
+		event.Language = parseAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+	h.enrichEvent(&event, getClientIP(r), time.Now())
 	if event.IsBot {
 		log.Printf("🤖 Bot detected: %s", botdetector.GetBotName(event.UserAgent))
 	}
-
-	// Detect channel from referrer and URL
-	currentDomain := extractDomainFromURL(event.URL)
-	event.Channel = string(channeldetector.DetectChannel(event.Referrer, event.URL, currentDomain))
+	if len(h.dropUnwanted([]domain.Event{event})) == 0 {
+		writeTracked(w)
+		return
+	}
+	events, release := h.dropDuplicates([]domain.Event{event}, time.Now())
+	if len(events) == 0 {
+		writeTracked(w)
+		return
+	}
 
 	if err := h.service.TrackEvent(event); err != nil {
+		release()
+		if errors.Is(err, storage.ErrBufferFull) {
+			writeBufferFull(w)
+			return
+		}
 		log.Printf("Error tracking event: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
 		return
 	}
 
+	writeTracked(w)
+}
+
+// writeTracked acknowledges a tracked event
+func writeTracked(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{"status": "ok"}); err != nil {
 		log.Printf("Error encoding response: %v", err)
@@ -88,7 +124,7 @@ func (h *EventHandler) TrackEvent(w http.ResponseWriter, r *http.Request) {
 // Endpoint: POST /api/track/batch
 func (h *EventHandler) TrackBatchEvents(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -96,113 +132,119 @@ func (h *EventHandler) TrackBatchEvents(w http.ResponseWriter, r *http.Request)
 		Events []domain.Event `json:"events"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&batchRequest); err != nil {
+	maxEvents := maxBatchSize()
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, batchBodyLimit(maxEvents))).Decode(&batchRequest); err != nil {
 		log.Printf("Error decoding batch request: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeDecodeError(w, err)
 		return
 	}
 
 	if len(batchRequest.Events) == 0 {
-		http.Error(w, "No events provided", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "No events provided")
 		return
 	}
 
 	// Limit batch size to prevent abuse
-	const maxBatchSize = 100
-	if len(batchRequest.Events) > maxBatchSize {
-		http.Error(w, fmt.Sprintf("Batch size exceeds maximum of %d events", maxBatchSize), http.StatusBadRequest)
+	if len(batchRequest.Events) > maxEvents {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Batch size exceeds maximum of %d events", maxEvents))
 		return
 	}
 
-	clientIP := getClientIP(r)
+	// Invalid events are reported by index and the valid ones stored, so one
+	// malformed event does not cost the client the rest of the batch
 	now := time.Now()
-	botCount := 0
-
-	// Enrich all events in the batch
-	for i := range batchRequest.Events {
-		// Set timestamp if not provided
-		if batchRequest.Events[i].Timestamp.IsZero() {
-			batchRequest.Events[i].Timestamp = now
+	total := len(batchRequest.Events)
+	events := make([]domain.Event, 0, total)
+	rejected := []batchError{}
+	for i, event := range batchRequest.Events {
+		if err := validateEvent(event, now); err != nil {
+			rejected = append(rejected, batchError{Index: i, Error: err.Error()})
+			continue
 		}
+		events = append(events, event)
+	}
+	valid := len(events)
 
-		// Get IP from request if not set
-		if batchRequest.Events[i].IP == "" {
-			batchRequest.Events[i].IP = clientIP
-		}
+	if doNotTrack(r) {
+		h.dropDoNotTrack(valid)
+		events = nil
+	}
 
-		// Enrich with geolocation data if service is available
-		if h.geoService != nil && batchRequest.Events[i].Country == "" {
-			geo := h.geoService.LookupOrDefault(batchRequest.Events[i].IP)
-			if geo != nil {
-				batchRequest.Events[i].Country = geo.Country
-				if batchRequest.Events[i].Country == "" {
-					batchRequest.Events[i].Country = geo.CountryCode
-				}
-			}
-		}
+	clientIP := getClientIP(r)
+	language := parseAcceptLanguage(r.Header.Get("Accept-Language"))
+	botCount := 0
 
-		// Detect if user agent belongs to a bot
-		batchRequest.Events[i].IsBot = botdetector.IsBot(batchRequest.Events[i].UserAgent)
-		if batchRequest.Events[i].IsBot {
+	// Enrich all events in the batch
+	for i := range events {
+		if events[i].Language == "" {
+			events[i].Language = language
+		}
+		h.enrichEvent(&events[i], clientIP, now)
+		if events[i].IsBot {
 			botCount++
 		}
-
-		// Detect channel from referrer and URL
-		currentDomain := extractDomainFromURL(batchRequest.Events[i].URL)
-		batchRequest.Events[i].Channel = string(channeldetector.DetectChannel(
-			batchRequest.Events[i].Referrer,
-			batchRequest.Events[i].URL,
-			currentDomain,
-		))
 	}
+	events = h.dropUnwanted(events)
+	dropped := valid - len(events)
+	events, release := h.dropDuplicates(events, now)
 
 	// Track all events in a single batch operation
-	if err := h.service.TrackEventBatch(batchRequest.Events); err != nil {
-		log.Printf("Error tracking batch events: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	if len(events) > 0 {
+		if err := h.service.TrackEventBatch(events); err != nil {
+			release()
+			if errors.Is(err, storage.ErrBufferFull) {
+				writeBufferFull(w)
+				return
+			}
+			log.Printf("Error tracking batch events: %v", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+			return
+		}
 	}
 
 	// Log batch processing summary
 	if botCount > 0 {
-		log.Printf("📦 Batch processed: %d events (%d bots detected)", len(batchRequest.Events), botCount)
+		log.Printf("📦 Batch processed: %d events (%d bots detected)", len(events), botCount)
 	} else {
-		log.Printf("📦 Batch processed: %d events", len(batchRequest.Events))
+		log.Printf("📦 Batch processed: %d events", len(events))
 	}
 
-	// Prepare success response
-	w.Header().Set("Content-Type", "application/json")
+	// Prepare the response. Dropped and duplicate events count as successful, they
+	// were handled as asked and must not be retried.
+	status, code := "ok", http.StatusOK
+	switch {
+	case valid == 0:
+		status, code = "error", http.StatusBadRequest
+	case len(rejected) > 0:
+		status, code = "partial", http.StatusMultiStatus
+	}
 	response := map[string]interface{}{
-		"status":     "ok",
-		"total":      len(batchRequest.Events),
-		"successful": len(batchRequest.Events),
-		"failed":     0,
+		"status":       status,
+		"total":        total,
+		"successful":   valid,
+		"failed":       len(rejected),
+		"dropped":      dropped,
+		"deduplicated": valid - dropped - len(events),
+		"errors":       rejected,
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding batch response: %v", err)
 	}
 }
 
 func (h *EventHandler) GetStats(w http.ResponseWriter, r *http.Request) {
-	// Default to last 7 days
-	now := time.Now()
-	endDate := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 999999999, now.Location())
-	startDate := endDate.AddDate(0, 0, -7)
-	startDate = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, startDate.Location())
-
-	// Parse date range from query params
-	if start := r.URL.Query().Get("start"); start != "" {
-		if t, err := time.Parse("2006-01-02", start); err == nil {
-			// Set to beginning of day for start date
-			startDate = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
-		}
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
 	}
-	if end := r.URL.Query().Get("end"); end != "" {
-		if t, err := time.Parse("2006-01-02", end); err == nil {
-			// Set to end of day for the end date
-			endDate = time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 999999999, t.Location())
-		}
+	startDate, endDate, err := parseDateRange(r, time.Now(), loc)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
 	}
 
 	log.Printf("📅 Stats query: startDate=%v, endDate=%v", startDate, endDate)
@@ -252,36 +294,65 @@ func (h *EventHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	if page := r.URL.Query().Get("page"); page != "" {
 		filters["page"] = page
 	}
+	if exact := r.URL.Query().Get("exact"); exact != "" {
+		filters["exact"] = exact
+	}
+	if r.URL.Query().Get("tz") != "" || loc != time.UTC {
+		filters["tz"] = loc.String()
+	}
+	if period := r.URL.Query().Get("period"); slices.Contains(domain.Periods, period) {
+		filters["period"] = period
+	}
+	if basis := r.URL.Query().Get("time_basis"); basis != "" {
+		if _, err := domain.ParseTimeBasis(basis); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		filters["time_basis"] = basis
+	}
+	if mode := r.URL.Query().Get("bounce_mode"); mode != "" {
+		if _, err := domain.ParseBounceMode(mode); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		filters["bounce_mode"] = mode
+	}
+	if strip := r.URL.Query().Get("strip_query"); strip != "" {
+		if _, err := strconv.ParseBool(strip); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "strip_query must be a boolean")
+			return
+		}
+		filters["strip_query"] = strip
+	}
+	if include := r.URL.Query().Get("include"); include != "" {
+		if _, err := domain.ParseStatsInclude(include); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		filters["include"] = include
+	}
 
-	stats, err := h.service.GetStats(startDate, endDate, limit, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	stats, err := h.service.GetStats(ctx, startDate, endDate, limit, filters)
 	if err != nil {
 		log.Printf("Error getting stats: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(stats); err != nil {
-		log.Printf("Error encoding stats: %v", err)
-	}
+	h.writeStatsJSON(w, r, stats, time.Since(started), "stats")
 }
 
 func (h *EventHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
-	// Parse date range
-	now := time.Now()
-	endDate := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 999999999, now.Location())
-	startDate := endDate.AddDate(0, 0, -7)
-	startDate = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, startDate.Location())
-
-	if start := r.URL.Query().Get("start"); start != "" {
-		if t, err := time.Parse("2006-01-02", start); err == nil {
-			startDate = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
-		}
+	// Date range and the standard filters, plus the raw-event ones
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		filters["user_id"] = userID
 	}
-	if end := r.URL.Query().Get("end"); end != "" {
-		if t, err := time.Parse("2006-01-02", end); err == nil {
-			endDate = time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 999999999, t.Location())
-		}
+	if sessionID := r.URL.Query().Get("session_id"); sessionID != "" {
+		filters["session_id"] = sessionID
 	}
 
 	// Parse pagination parameters
@@ -304,10 +375,25 @@ func (h *EventHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	events, err := h.service.GetEvents(startDate, endDate, limit, offset)
+	// Keyset pagination: before is the next_cursor of the previous page
+	if before := r.URL.Query().Get("before"); before != "" {
+		if offset != 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "offset cannot be combined with before")
+			return
+		}
+		if _, err := domain.ParseEventCursor(before); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		filters["before"] = before
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	events, err := h.service.GetEvents(ctx, startDate, endDate, limit, offset, filters)
 	if err != nil {
 		log.Printf("Error getting events: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
@@ -329,10 +415,12 @@ func (h *EventHandler) GetOnlineUsers(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	online, err := h.service.GetOnlineUsers(timeWindow)
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	online, err := h.service.GetOnlineUsers(ctx, timeWindow)
 	if err != nil {
 		log.Printf("Error getting online users: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
@@ -343,10 +431,12 @@ func (h *EventHandler) GetOnlineUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *EventHandler) GetProjects(w http.ResponseWriter, r *http.Request) {
-	projects, err := h.service.GetProjects()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	projects, err := h.service.GetProjects(ctx)
 	if err != nil {
 		log.Printf("Error getting projects: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
@@ -368,9 +458,38 @@ func (h *EventHandler) Health(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Ready is the readiness probe: it checks that DuckDB answers, the data directory
+// is writable and stored events can be queried, answering 503 when any check
+// fails. Health stays the cheap liveness probe.
+// Endpoint: GET /api/health/ready
+func (h *EventHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	readiness := h.service.CheckReadiness(ctx)
+	status, code := "ok", http.StatusOK
+	if !readiness.Ready() {
+		status, code = "unavailable", http.StatusServiceUnavailable
+		for name, check := range readiness.Checks {
+			if check.Status == domain.CheckFailed {
+				log.Printf("❌ Readiness check %s failed: %s", name, check.Error)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": readiness.Checks,
+	}); err != nil {
+		log.Printf("Error encoding readiness response: %v", err)
+	}
+}
+
 func (h *EventHandler) GeoTest(w http.ResponseWriter, r *http.Request) {
 	if h.geoService == nil {
-		http.Error(w, "Geolocation service not available", http.StatusServiceUnavailable)
+		writeError(w, http.StatusServiceUnavailable, ErrCodeUnavailable, "Geolocation service not available")
 		return
 	}
 
@@ -386,6 +505,7 @@ func (h *EventHandler) GeoTest(w http.ResponseWriter, r *http.Request) {
 		"ip":           ip,
 		"country":      geo.Country,
 		"country_code": geo.CountryCode,
+		"region":       geo.Region,
 		"city":         geo.City,
 	}); err != nil {
 		log.Printf("Error encoding geo response: %v", err)
@@ -394,41 +514,485 @@ func (h *EventHandler) GeoTest(w http.ResponseWriter, r *http.Request) {
 
 func (h *EventHandler) GetFunnelAnalysis(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var request domain.FunnelRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Printf("Error decoding funnel request: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON")
 		return
 	}
 
-	// Validate request
-	if len(request.Steps) == 0 {
-		http.Error(w, "At least one funnel step is required", http.StatusBadRequest)
+	if err := validateFunnelRequest(request); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	result, err := h.service.GetFunnelAnalysis(ctx, request)
+	if err != nil {
+		log.Printf("Error getting funnel analysis: %v", err)
+		if ctx.Err() != nil {
+			writeQueryError(ctx, w)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Error analyzing funnel: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding funnel analysis response: %v", err)
+	}
+}
+
+// CompareSegments returns the overview stats of two filter sets side by side
+// Endpoint: POST /api/stats/compare
+func (h *EventHandler) CompareSegments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var request domain.CompareRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding compare request: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON")
 		return
 	}
 
 	if request.StartDate == "" || request.EndDate == "" {
-		http.Error(w, "Start date and end date are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "start_date and end_date are required")
+		return
+	}
+	start, err := time.Parse("2006-01-02", request.StartDate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("start_date must be YYYY-MM-DD, got %q", request.StartDate))
 		return
 	}
+	end, err := time.Parse("2006-01-02", request.EndDate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("end_date must be YYYY-MM-DD, got %q", request.EndDate))
+		return
+	}
+	if end.Before(start) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "end_date must not be before start_date")
+		return
+	}
+	startDate := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	endDate := time.Date(end.Year(), end.Month(), end.Day(), 23, 59, 59, 999999999, end.Location())
+
+	if request.A == nil {
+		request.A = map[string]string{}
+	}
+	if request.B == nil {
+		request.B = map[string]string{}
+	}
 
-	result, err := h.service.GetFunnelAnalysis(request)
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	result, err := h.service.CompareSegments(ctx, startDate, endDate, request.A, request.B)
 	if err != nil {
-		log.Printf("Error getting funnel analysis: %v", err)
-		http.Error(w, fmt.Sprintf("Error analyzing funnel: %v", err), http.StatusInternalServerError)
+		log.Printf("Error comparing segments: %v", err)
+		writeQueryError(ctx, w)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(result); err != nil {
-		log.Printf("Error encoding funnel analysis response: %v", err)
+		log.Printf("Error encoding compare response: %v", err)
 	}
 }
 
+// MaxFunnelSteps bounds the number of steps in a funnel request; every step adds a
+// self-join over the previous steps' users
+const MaxFunnelSteps = 20
+
+// MaxFunnelStepEventNames bounds the event names a single funnel step can match
+const MaxFunnelStepEventNames = 20
+
+// funnelFilterKeys are the global filters GetFunnelAnalysis applies
+var funnelFilterKeys = map[string]bool{
+	"project":    true,
+	"country":    true,
+	"browser":    true,
+	"device":     true,
+	"os":         true,
+	"channel":    true,
+	"source":     true,
+	"botFilter":  true,
+	"exact":      true,
+	"time_basis": true,
+	"tz":         true,
+}
+
+// funnelBreakdownKeys are the dimensions a funnel can be broken down by
+var funnelBreakdownKeys = map[string]bool{
+	"channel": true,
+	"device":  true,
+	"country": true,
+	"source":  true,
+}
+
+// funnelStepFilterKeys are the filters a single funnel step can narrow by
+var funnelStepFilterKeys = map[string]bool{
+	"country": true,
+	"browser": true,
+	"device":  true,
+	"os":      true,
+}
+
+// validateFunnelRequest checks a funnel request before it reaches the repository,
+// so mistakes are reported as precise 400s instead of SQL errors or silently
+// ignored filters
+func validateFunnelRequest(request domain.FunnelRequest) error {
+	if len(request.Steps) == 0 {
+		return errors.New("at least one funnel step is required")
+	}
+	if len(request.Steps) > MaxFunnelSteps {
+		return fmt.Errorf("at most %d funnel steps are allowed, got %d", MaxFunnelSteps, len(request.Steps))
+	}
+
+	if request.StartDate == "" || request.EndDate == "" {
+		return errors.New("start_date and end_date are required")
+	}
+	startDate, err := time.Parse("2006-01-02", request.StartDate)
+	if err != nil {
+		return fmt.Errorf("start_date must be YYYY-MM-DD, got %q", request.StartDate)
+	}
+	endDate, err := time.Parse("2006-01-02", request.EndDate)
+	if err != nil {
+		return fmt.Errorf("end_date must be YYYY-MM-DD, got %q", request.EndDate)
+	}
+	if endDate.Before(startDate) {
+		return errors.New("end_date must not be before start_date")
+	}
+
+	if request.ConversionWindowHours < 0 {
+		return errors.New("conversion_window_hours must not be negative")
+	}
+	if request.MaxFunnelDuration < 0 {
+		return errors.New("max_funnel_duration must not be negative")
+	}
+	if !request.InStrictOrder() && (request.ConversionWindowHours > 0 || request.MaxFunnelDuration > 0) {
+		return errors.New("conversion_window_hours and max_funnel_duration require strict_order")
+	}
+	if _, err := domain.ParseFunnelScope(request.Scope); err != nil {
+		return err
+	}
+	if request.BreakdownBy != "" && !funnelBreakdownKeys[request.BreakdownBy] {
+		return fmt.Errorf("breakdown_by must be one of channel, device, country or source, got %q", request.BreakdownBy)
+	}
+
+	for key := range request.Filters {
+		if !funnelFilterKeys[key] {
+			return fmt.Errorf("unknown filter %q", key)
+		}
+	}
+	switch request.Filters["botFilter"] {
+	case "", "bot", "human":
+	default:
+		return fmt.Errorf("botFilter must be \"bot\" or \"human\", got %q", request.Filters["botFilter"])
+	}
+	if _, err := domain.ParseTimeBasis(request.Filters["time_basis"]); err != nil {
+		return err
+	}
+	if _, err := domain.ParseTimeZone(request.Filters["tz"]); err != nil {
+		return err
+	}
+
+	for i, step := range request.Steps {
+		names := step.MatchedEventNames()
+		if len(names) == 0 {
+			return fmt.Errorf("step %d: event_name or event_names is required", i+1)
+		}
+		if len(names) > MaxFunnelStepEventNames {
+			return fmt.Errorf("step %d: at most %d event names are allowed, got %d", i+1, MaxFunnelStepEventNames, len(names))
+		}
+		for key := range step.Filters {
+			if !funnelStepFilterKeys[key] {
+				return fmt.Errorf("step %d: unknown filter %q", i+1, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// AdminReset deletes all stored events
+// Endpoint: POST /api/admin/reset (requires ALLOW_RESET=1 in addition to the admin key)
+func (h *EventHandler) AdminReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if os.Getenv("ALLOW_RESET") != "1" {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Reset is disabled, set ALLOW_RESET=1 to enable")
+		return
+	}
+
+	removed, err := h.service.ResetData()
+	if err != nil {
+		log.Printf("Error resetting data: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+
+	log.Printf("⚠️  All data reset via admin API (%d files removed)", removed)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        "ok",
+		"files_removed": removed,
+	}); err != nil {
+		log.Printf("Error encoding reset response: %v", err)
+	}
+}
+
+// AdminFlush writes buffered events to disk so they are immediately queryable
+// Endpoint: POST /api/admin/flush
+func (h *EventHandler) AdminFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	result, err := h.service.FlushEvents()
+	if err != nil {
+		log.Printf("Error flushing events: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding flush response: %v", err)
+	}
+}
+
+// AdminCompact merges small Parquet files now instead of waiting for the
+// compaction timer, and reports the files merged and their sizes
+// Endpoint: POST /api/admin/compact
+func (h *EventHandler) AdminCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Rewrites files, so like exports it is not bound by QUERY_TIMEOUT
+	result, err := h.service.CompactFiles(r.Context())
+	if err != nil {
+		if errors.Is(err, domain.ErrCompactionRunning) || errors.Is(err, domain.ErrNoCompaction) {
+			writeError(w, http.StatusConflict, ErrCodeConflict, err.Error())
+			return
+		}
+		log.Printf("Error compacting files after %d merged: %v", result.FilesMerged, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding compact response: %v", err)
+	}
+}
+
+// AdminStorage reports the stored events and their Parquet files, with sizes and
+// row counts, and the events buffered for the next flush
+// Endpoint: GET /api/admin/storage
+func (h *EventHandler) AdminStorage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	stats, err := h.service.GetStorageStats(ctx)
+	if err != nil {
+		log.Printf("Error getting storage stats: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("Error encoding storage stats: %v", err)
+	}
+}
+
+// AdminRebuildUserSketch recomputes the lifetime user sketch from the stored
+// Parquet files and returns the new count
+// Endpoint: POST /api/admin/lifetime/rebuild
+func (h *EventHandler) AdminRebuildUserSketch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Reads every file, so like exports it is not bound by QUERY_TIMEOUT
+	ctx := r.Context()
+	if err := h.service.RebuildUserSketch(ctx); err != nil {
+		if errors.Is(err, domain.ErrNoUserSketch) {
+			writeError(w, http.StatusConflict, ErrCodeConflict, err.Error())
+			return
+		}
+		log.Printf("Error rebuilding user sketch: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+
+	lifetime, err := h.service.GetLifetimeUniqueUsers(ctx)
+	if err != nil {
+		log.Printf("Error getting lifetime users: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lifetime); err != nil {
+		log.Printf("Error encoding rebuild response: %v", err)
+	}
+}
+
+// DebugSample returns a random sample of stored events so enrichment (channel,
+// country, bot detection) can be checked against real data
+func (h *EventHandler) DebugSample(w http.ResponseWriter, r *http.Request) {
+	n := 20
+	if nStr := r.URL.Query().Get("n"); nStr != "" {
+		var v int
+		if _, err := fmt.Sscanf(nStr, "%d", &v); err != nil || v <= 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "n must be a positive integer")
+			return
+		}
+		n = v
+		if n > 1000 {
+			n = 1000 // Cap at 1000
+		}
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	events, err := h.service.SampleEvents(ctx, n)
+	if err != nil {
+		log.Printf("Error sampling events: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+		"count":  len(events),
+	}); err != nil {
+		log.Printf("Error encoding sample response: %v", err)
+	}
+}
+
+// DebugRecent returns the last events accepted by this server from memory, so a
+// just-tracked event can be confirmed before it is flushed to storage
+// Endpoint: GET /api/debug/recent?limit=20
+func (h *EventHandler) DebugRecent(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var v int
+		if _, err := fmt.Sscanf(limitStr, "%d", &v); err != nil || v <= 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = v
+	}
+
+	events := h.service.RecentTracked(limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+		"count":  len(events),
+	}); err != nil {
+		log.Printf("Error encoding recent events response: %v", err)
+	}
+}
+
+// enrichEvent fills in server-side fields: timestamp, ingestion time, IP, language,
+// country and region, browser, OS and device, bot flag, channel, a visitor id for events sent without one and, when SESSION_ID_FALLBACK=synthesize,
+// a session id for events sent without one.
+// The IP and user id are anonymized last, see anonymizeEvent.
+func (h *EventHandler) enrichEvent(event *domain.Event, clientIP string, now time.Time) {
+	// Set timestamp if not provided
+	if event.Timestamp.IsZero() {
+		event.Timestamp = now
+	}
+
+	// Ingestion time is always server-assigned, whatever the client sent
+	event.ReceivedAt = now
+	// So is the sample rate, which stats are scaled up by, see SAMPLE_RATE
+	event.SampleRate = sampleRate()
+
+	// Get IP from request if not set
+	if event.IP == "" {
+		event.IP = clientIP
+	}
+
+	// Languages sent by the client are reduced to their primary subtag like the
+	// Accept-Language header
+	event.Language = parseAcceptLanguage(event.Language)
+
+	// Enrich with geolocation data if service is available
+	if h.geoService != nil && event.Country == "" {
+		geo := h.geoService.LookupOrDefault(event.IP)
+		if geo != nil {
+			event.Country = geo.Country
+			if event.Country == "" {
+				event.Country = geo.CountryCode
+			}
+			event.Region = geo.Region
+		}
+	}
+
+	// Cookieless visitor id for events sent without a user id
+	if event.UserID == "" {
+		event.UserID = h.deriveVisitorID(event, now)
+	}
+
+	// Browser, OS and device from the user agent, see UA_PARSE
+	applyUserAgent(event)
+	// or from the screen width, see DEVICE_FROM_SCREEN
+	applyScreenDevice(event)
+
+	// Detect if user agent belongs to a bot
+	event.IsBot = botdetector.IsBot(event.UserAgent)
+
+	// Detect channel from referrer and URL
+	currentDomain := extractDomainFromURL(event.URL)
+	event.Channel = string(channeldetector.DetectChannel(event.Referrer, event.URL, currentDomain))
+
+	if event.SessionID == "" && os.Getenv("SESSION_ID_FALLBACK") == "synthesize" {
+		event.SessionID = synthesizeSessionID(event)
+	}
+
+	h.anonymizeEvent(event, now)
+}
+
+// synthesizeSessionID derives a stable session id from the visitor and the UTC day,
+// so events from the same visitor on the same day share a session
+func synthesizeSessionID(event *domain.Event) string {
+	day := event.Timestamp.UTC().Format("2006-01-02")
+	sum := sha256.Sum256([]byte(event.UserID + "|" + event.IP + "|" + event.UserAgent + "|" + day))
+	return "syn_" + hex.EncodeToString(sum[:8])
+}
+
+// writeBufferFull tells the client to retry when storage is applying backpressure
+func writeBufferFull(w http.ResponseWriter) {
+	log.Printf("⚠️  Rejecting events: buffer full")
+	w.Header().Set("Retry-After", "1")
+	writeError(w, http.StatusServiceUnavailable, ErrCodeBusy, "Service busy, retry later")
+}
+
 func getClientIP(r *http.Request) string {
 	forwarded := r.Header.Get("X-Forwarded-For")
 	if forwarded != "" {
@@ -463,42 +1027,115 @@ func extractDomainFromURL(urlStr string) string {
 	return parsedURL.Hostname()
 }
 
+const (
+	// DefaultSessionsLimit is the page size of /api/sessions
+	DefaultSessionsLimit = 20
+	// MaxSessionsLimit caps the page size of /api/sessions; each session carries its events
+	MaxSessionsLimit = 100
+)
+
+// GetUserSessions returns a user's sessions, newest first, with their events in order
+// Endpoint: GET /api/sessions?user_id=...&limit=20&offset=0
+func (h *EventHandler) GetUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "user_id is required")
+		return
+	}
+
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+
+	limit := DefaultSessionsLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var v int
+		if _, err := fmt.Sscanf(limitStr, "%d", &v); err != nil || v <= 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = v
+		if limit > MaxSessionsLimit {
+			limit = MaxSessionsLimit
+		}
+	}
+
+	offset := 0
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		var v int
+		if _, err := fmt.Sscanf(offsetStr, "%d", &v); err != nil || v < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = v
+	}
+
+	// Ask for one extra session to know whether there is another page
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	sessions, err := h.service.GetUserSessions(ctx, userID, startDate, endDate, limit+1, offset, filters)
+	if err != nil {
+		log.Printf("Error getting user sessions: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	hasMore := len(sessions) > limit
+	if hasMore {
+		sessions = sessions[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":  userID,
+		"sessions": sessions,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+	}); err != nil {
+		log.Printf("Error encoding user sessions: %v", err)
+	}
+}
+
 // GetChannelsHandler returns traffic breakdown by channel
 func (h *EventHandler) GetChannelsHandler(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, _, filters := parseFiltersAndDates(r)
 
-	channels, err := h.service.GetChannels(startDate, endDate, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	channels, err := h.service.GetChannels(ctx, startDate, endDate, filters)
 	if err != nil {
 		log.Printf("Error getting channels: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(channels); err != nil {
-		log.Printf("Error encoding channels: %v", err)
-	}
+	// The response is an array, so the _meta other stats responses carry goes in headers
+	meta := domain.NewStatsMeta(domain.ExactCounts(filters), 0)
+	w.Header().Set("X-Stats-Approximate", strconv.FormatBool(meta.Approximate))
+	w.Header().Set("X-Stats-Distinct-Count", meta.DistinctCount)
+	h.writeStatsJSON(w, r, channels, time.Since(started), "channels")
+}
+
+// GetChannelLandingPagesHandler returns the top landing pages for each channel
+func (h *EventHandler) GetChannelLandingPagesHandler(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, limit, filters := parseFiltersAndDates(r)
+
+	// Streamed one channel at a time; the response is the same array as a buffered one
+	stream := newJSONArrayStream(w)
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	err := h.service.StreamChannelLandingPages(ctx, startDate, endDate, limit, filters, func(channel map[string]interface{}) error {
+		return stream.Write(channel)
+	})
+	stream.Close(ctx, err)
 }
 
 // parseFiltersAndDates is a helper to parse common query parameters
 func parseFiltersAndDates(r *http.Request) (startDate, endDate time.Time, limit int, filters map[string]string) {
-	// Default to last 7 days
-	now := time.Now()
-	endDate = time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 999999999, now.Location())
-	startDate = endDate.AddDate(0, 0, -7)
-	startDate = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, startDate.Location())
-
-	// Parse date range from query params
-	if start := r.URL.Query().Get("start"); start != "" {
-		if t, err := time.Parse("2006-01-02", start); err == nil {
-			startDate = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
-		}
-	}
-	if end := r.URL.Query().Get("end"); end != "" {
-		if t, err := time.Parse("2006-01-02", end); err == nil {
-			endDate = time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 999999999, t.Location())
-		}
-	}
+	// An invalid tz or period falls back to the default, like malformed dates to
+	// the default range
+	loc, _ := requestLocation(r)
+	startDate, endDate, _ = parseDateRange(r, time.Now(), loc)
 
 	// Parse limit parameter
 	limit = 50
@@ -544,142 +1181,410 @@ func parseFiltersAndDates(r *http.Request) (startDate, endDate time.Time, limit
 	if page := r.URL.Query().Get("page"); page != "" {
 		filters["page"] = page
 	}
+	if exact := r.URL.Query().Get("exact"); exact != "" {
+		filters["exact"] = exact
+	}
+	if r.URL.Query().Get("tz") != "" || loc != time.UTC {
+		filters["tz"] = loc.String()
+	}
+	if period := r.URL.Query().Get("period"); slices.Contains(domain.Periods, period) {
+		filters["period"] = period
+	}
+	// Invalid values fall back to the server default, like malformed dates
+	if basis := r.URL.Query().Get("time_basis"); basis != "" {
+		if _, err := domain.ParseTimeBasis(basis); err == nil {
+			filters["time_basis"] = basis
+		}
+	}
+	if mode := r.URL.Query().Get("bounce_mode"); mode != "" {
+		if _, err := domain.ParseBounceMode(mode); err == nil {
+			filters["bounce_mode"] = mode
+		}
+	}
+	if strip := r.URL.Query().Get("strip_query"); strip != "" {
+		if _, err := strconv.ParseBool(strip); err == nil {
+			filters["strip_query"] = strip
+		}
+	}
 
 	return
 }
 
+// requestLocation returns the zone of the tz query parameter, defaulting to
+// STATS_TZ and then UTC. An invalid tz is reported along with the default zone.
+func requestLocation(r *http.Request) (*time.Location, error) {
+	loc, err := domain.ParseTimeZone(os.Getenv("STATS_TZ"))
+	if err != nil {
+		loc = time.UTC
+	}
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		requested, err := domain.ParseTimeZone(tz)
+		if err != nil {
+			return loc, err
+		}
+		return requested, nil
+	}
+	return loc, nil
+}
+
+// parseDateRange returns the start and end query parameters as the first and last
+// instant of those days, defaulting to the 7 days before today and today. A period
+// parameter overrides them with a range counted back from today, see
+// domain.PeriodRange; an unknown one is reported along with the range the other
+// parameters give. Today is the current day in loc. Stats queries shift stored
+// timestamps to wall-clock time in the tz zone, so the days are returned as
+// wall-clock times too, in UTC.
+func parseDateRange(r *http.Request, now time.Time, loc *time.Location) (startDate, endDate time.Time, err error) {
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	endDate = today.Add(24*time.Hour - time.Nanosecond)
+	startDate = today.AddDate(0, 0, -7)
+
+	var periodErr error
+	if period := r.URL.Query().Get("period"); period != "" {
+		first, last, err := domain.PeriodRange(period, today)
+		if err == nil {
+			return first, last.Add(24*time.Hour - time.Nanosecond), nil
+		}
+		periodErr = err
+	}
+
+	if start := r.URL.Query().Get("start"); start != "" {
+		if first, _, err := domain.ParseDay(start); err == nil {
+			startDate = first
+		}
+	}
+	if end := r.URL.Query().Get("end"); end != "" {
+		if _, last, err := domain.ParseDay(end); err == nil {
+			endDate = last
+		}
+	}
+	return startDate, endDate, periodErr
+}
+
+// parseTopListParams adds the paging and order of the top lists to filters:
+// offset, sort ("count" or "name") and order ("asc" or "desc"). Invalid values are
+// dropped, leaving the default of the largest counts first.
+func parseTopListParams(r *http.Request, filters map[string]string) {
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		if n, err := strconv.Atoi(offset); err == nil && n >= 0 {
+			filters["offset"] = offset
+		}
+	}
+	switch sort := r.URL.Query().Get("sort"); sort {
+	case "count", "name":
+		filters["sort"] = sort
+	}
+	switch order := r.URL.Query().Get("order"); order {
+	case "asc", "desc":
+		filters["order"] = order
+	}
+}
+
 // GetTopStats returns main statistics (counts, rates, trends)
 func (h *EventHandler) GetTopStats(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, _, filters := parseFiltersAndDates(r)
+	if h.writeExplain(w, r, domain.ReportOverview, startDate, endDate, 0, filters) {
+		return
+	}
 
-	stats, err := h.service.GetTopStats(startDate, endDate, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	stats, err := h.service.GetTopStats(ctx, startDate, endDate, filters)
 	if err != nil {
 		log.Printf("Error getting top stats: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(stats); err != nil {
-		log.Printf("Error encoding top stats: %v", err)
-	}
+	h.writeStatsJSON(w, r, stats, time.Since(started), "top stats")
 }
 
 // GetTimeline returns timeline data for the main chart
 func (h *EventHandler) GetTimeline(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, _, filters := parseFiltersAndDates(r)
+	if h.writeExplain(w, r, domain.ReportTimeline, startDate, endDate, 0, filters) {
+		return
+	}
 
-	timeline, err := h.service.GetTimeline(startDate, endDate, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	timeline, err := h.service.GetTimeline(ctx, startDate, endDate, filters)
 	if err != nil {
 		log.Printf("Error getting timeline: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(timeline); err != nil {
-		log.Printf("Error encoding timeline: %v", err)
-	}
+	h.writeStatsJSON(w, r, timeline, time.Since(started), "timeline")
 }
 
 // GetTopPagesHandler returns top pages
 func (h *EventHandler) GetTopPagesHandler(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, limit, filters := parseFiltersAndDates(r)
+	parseTopListParams(r, filters)
+	if h.writeExplain(w, r, domain.ReportPages, startDate, endDate, limit, filters) {
+		return
+	}
 
-	pages, err := h.service.GetTopPages(startDate, endDate, limit, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	pages, err := h.service.GetTopPages(ctx, startDate, endDate, limit, filters)
 	if err != nil {
 		log.Printf("Error getting top pages: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(pages); err != nil {
-		log.Printf("Error encoding top pages: %v", err)
-	}
+	h.writeStatsJSON(w, r, pages, time.Since(started), "top pages")
 }
 
 // GetEntryExitPagesHandler returns entry and exit pages
 func (h *EventHandler) GetEntryExitPagesHandler(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, limit, filters := parseFiltersAndDates(r)
 
-	pages, err := h.service.GetEntryExitPages(startDate, endDate, limit, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	pages, err := h.service.GetEntryExitPages(ctx, startDate, endDate, limit, filters)
 	if err != nil {
 		log.Printf("Error getting entry/exit pages: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(pages); err != nil {
-		log.Printf("Error encoding entry/exit pages: %v", err)
-	}
+	h.writeStatsJSON(w, r, pages, time.Since(started), "entry/exit pages")
 }
 
 // GetTopCountriesHandler returns top countries
 func (h *EventHandler) GetTopCountriesHandler(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, limit, filters := parseFiltersAndDates(r)
+	parseTopListParams(r, filters)
+	if h.writeExplain(w, r, domain.ReportCountries, startDate, endDate, limit, filters) {
+		return
+	}
 
-	countries, err := h.service.GetTopCountries(startDate, endDate, limit, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	countries, total, err := h.service.GetTopCountries(ctx, startDate, endDate, limit, filters)
 	if err != nil {
 		log.Printf("Error getting top countries: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(countries); err != nil {
-		log.Printf("Error encoding top countries: %v", err)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	h.writeStatsJSON(w, r, countries, time.Since(started), "top countries")
+}
+
+// GetTopRegionsHandler returns the top continents, countries or regions
+// Endpoint: GET /api/stats/regions?level=continent|country|region
+func (h *EventHandler) GetTopRegionsHandler(w http.ResponseWriter, r *http.Request) {
+	level, err := domain.ParseRegionLevel(r.URL.Query().Get("level"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	startDate, endDate, limit, filters := parseFiltersAndDates(r)
+	parseTopListParams(r, filters)
+
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	regions, total, err := h.service.GetTopRegions(ctx, startDate, endDate, level, limit, filters)
+	if err != nil {
+		log.Printf("Error getting top regions: %v", err)
+		writeQueryError(ctx, w)
+		return
 	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	h.writeStatsJSON(w, r, regions, time.Since(started), "top regions")
+}
+
+// GetTopLanguagesHandler returns the top visitor languages
+func (h *EventHandler) GetTopLanguagesHandler(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, limit, filters := parseFiltersAndDates(r)
+	parseTopListParams(r, filters)
+	if h.writeExplain(w, r, domain.ReportLanguages, startDate, endDate, limit, filters) {
+		return
+	}
+
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	languages, total, err := h.service.GetTopLanguages(ctx, startDate, endDate, limit, filters)
+	if err != nil {
+		log.Printf("Error getting top languages: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	h.writeStatsJSON(w, r, languages, time.Since(started), "top languages")
+}
+
+// GetScreenSizesHandler returns events and visitors by screen width bucket
+func (h *EventHandler) GetScreenSizesHandler(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	sizes, err := h.service.GetScreenSizes(ctx, startDate, endDate, filters)
+	if err != nil {
+		log.Printf("Error getting screen sizes: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	h.writeStatsJSON(w, r, sizes, time.Since(started), "screen sizes")
 }
 
 // GetTopSourcesHandler returns top traffic sources
 func (h *EventHandler) GetTopSourcesHandler(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, limit, filters := parseFiltersAndDates(r)
+	parseTopListParams(r, filters)
+	if h.writeExplain(w, r, domain.ReportSources, startDate, endDate, limit, filters) {
+		return
+	}
 
-	sources, err := h.service.GetTopSources(startDate, endDate, limit, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	sources, total, err := h.service.GetTopSources(ctx, startDate, endDate, limit, filters)
 	if err != nil {
 		log.Printf("Error getting top sources: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(sources); err != nil {
-		log.Printf("Error encoding top sources: %v", err)
-	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	h.writeStatsJSON(w, r, sources, time.Since(started), "top sources")
 }
 
 // GetTopEventsHandler returns top events
 func (h *EventHandler) GetTopEventsHandler(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, limit, filters := parseFiltersAndDates(r)
+	parseTopListParams(r, filters)
+	if h.writeExplain(w, r, domain.ReportEvents, startDate, endDate, limit, filters) {
+		return
+	}
 
-	events, err := h.service.GetTopEvents(startDate, endDate, limit, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	events, total, err := h.service.GetTopEvents(ctx, startDate, endDate, limit, filters)
 	if err != nil {
 		log.Printf("Error getting top events: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(events); err != nil {
-		log.Printf("Error encoding top events: %v", err)
-	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	h.writeStatsJSON(w, r, events, time.Since(started), "top events")
 }
 
 // GetBrowsersDevicesOSHandler returns browsers, devices, and OS data
 func (h *EventHandler) GetBrowsersDevicesOSHandler(w http.ResponseWriter, r *http.Request) {
 	startDate, endDate, limit, filters := parseFiltersAndDates(r)
+	parseTopListParams(r, filters)
 
-	data, err := h.service.GetBrowsersDevicesOS(startDate, endDate, limit, filters)
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	data, err := h.service.GetBrowsersDevicesOS(ctx, startDate, endDate, limit, filters)
 	if err != nil {
 		log.Printf("Error getting browsers/devices/OS: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeQueryError(ctx, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding browsers/devices/OS: %v", err)
+	h.writeStatsJSON(w, r, data, time.Since(started), "browsers/devices/OS")
+}
+
+// GetStickinessHandler returns DAU, WAU, MAU and the DAU/MAU ratio ending at the end date
+func (h *EventHandler) GetStickinessHandler(w http.ResponseWriter, r *http.Request) {
+	_, endDate, _, filters := parseFiltersAndDates(r)
+
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	dau, wau, mau, dauMau, err := h.service.GetStickiness(ctx, endDate, filters)
+	if err != nil {
+		log.Printf("Error getting stickiness: %v", err)
+		writeQueryError(ctx, w)
+		return
 	}
+
+	h.writeStatsJSON(w, r, map[string]interface{}{
+		"date":    endDate.Format("2006-01-02"),
+		"dau":     dau,
+		"wau":     wau,
+		"mau":     mau,
+		"dau_mau": dauMau,
+	}, time.Since(started), "stickiness")
+}
+
+// GetLifetimeUsersHandler returns the estimated number of distinct users across
+// every stored event, ignoring the date range and filters
+func (h *EventHandler) GetLifetimeUsersHandler(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	lifetime, err := h.service.GetLifetimeUniqueUsers(ctx)
+	if err != nil {
+		log.Printf("Error getting lifetime users: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	h.writeStatsJSON(w, r, lifetime, time.Since(started), "lifetime users")
+}
+
+// GetNewVsReturningHandler returns users, visits and page views of new and
+// returning visitors in the date range
+func (h *EventHandler) GetNewVsReturningHandler(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	data, err := h.service.GetNewVsReturning(ctx, startDate, endDate, filters)
+	if err != nil {
+		log.Printf("Error getting new vs returning visitors: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	h.writeStatsJSON(w, r, data, time.Since(started), "new vs returning visitors")
+}
+
+// GetFilterValuesHandler returns the most frequent values of each requested filter
+// field, for populating filter menus
+// Endpoint: GET /api/filters?fields=country,browser,event
+func (h *EventHandler) GetFilterValuesHandler(w http.ResponseWriter, r *http.Request) {
+	fields, err := domain.ParseFilterFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+
+	started := time.Now()
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	values, err := h.service.GetFilterValues(ctx, startDate, endDate, fields, filters)
+	if err != nil {
+		log.Printf("Error getting filter values: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	h.writeStatsJSON(w, r, values, time.Since(started), "filter values")
 }
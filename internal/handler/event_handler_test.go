@@ -2,16 +2,22 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/mohamedelhefni/siraaj/geolocation"
 	"github.com/mohamedelhefni/siraaj/internal/domain"
 	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
 	"go.uber.org/mock/gomock"
 )
 
@@ -85,6 +91,22 @@ func TestTrackEvent(t *testing.T) {
 			expectedStatus: http.StatusInternalServerError,
 			expectedBody:   "Internal server error",
 		},
+		{
+			name:   "Buffer full",
+			method: http.MethodPost,
+			body: domain.Event{
+				EventName: "click",
+				UserID:    "user456",
+			},
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					TrackEvent(gomock.Any()).
+					Return(fmt.Errorf("write failed: %w", storage.ErrBufferFull)).
+					Times(1)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "Service busy",
+		},
 	}
 
 	for _, tt := range tests {
@@ -175,7 +197,7 @@ func TestGetStats(t *testing.T) {
 			queryParams: "",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetStats(gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
 					Return(map[string]interface{}{
 						"total_events": 1000,
 						"unique_users": 250,
@@ -194,7 +216,7 @@ func TestGetStats(t *testing.T) {
 			queryParams: "?start=2024-01-01&end=2024-01-31",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetStats(gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
 					Return(map[string]interface{}{
 						"total_events": 500,
 					}, nil).
@@ -212,8 +234,8 @@ func TestGetStats(t *testing.T) {
 			queryParams: "?project=myapp&country=Palestine&browser=Chrome",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetStats(gomock.Any(), gomock.Any(), 50, gomock.Any()).
-					DoAndReturn(func(start, end time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
 						if filters["project"] != "myapp" {
 							t.Error("Expected project filter to be 'myapp'")
 						}
@@ -235,7 +257,7 @@ func TestGetStats(t *testing.T) {
 			queryParams: "",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(nil, errors.New("database error")).
 					Times(1)
 			},
@@ -247,13 +269,156 @@ func TestGetStats(t *testing.T) {
 			queryParams: "?limit=100",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetStats(gomock.Any(), gomock.Any(), 100, gomock.Any()).
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 100, gomock.Any()).
 					Return(map[string]interface{}{"total_events": 200}, nil).
 					Times(1)
 			},
 			expectedStatus: http.StatusOK,
 			checkResponse:  func(t *testing.T, resp map[string]interface{}) {},
 		},
+		{
+			name:        "Include sections",
+			queryParams: "?include=timeline,top_pages",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+						if filters["include"] != "timeline,top_pages" {
+							t.Errorf("Expected include filter to be 'timeline,top_pages', got %q", filters["include"])
+						}
+						return map[string]interface{}{"total_events": 100}, nil
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse:  func(t *testing.T, resp map[string]interface{}) {},
+		},
+		{
+			name:        "Exact counts",
+			queryParams: "?exact=1",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+						if filters["exact"] != "1" {
+							t.Errorf("Expected exact filter to be '1', got %q", filters["exact"])
+						}
+						return map[string]interface{}{"unique_users": 100}, nil
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse:  func(t *testing.T, resp map[string]interface{}) {},
+		},
+		{
+			name:           "Unknown include section",
+			queryParams:    "?include=timeline,nope",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  nil,
+		},
+		{
+			name:        "Time zone",
+			queryParams: "?start=2024-03-01&end=2024-03-02&tz=Asia/Tokyo",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+						if filters["tz"] != "Asia/Tokyo" {
+							t.Errorf("Expected tz filter to be 'Asia/Tokyo', got %q", filters["tz"])
+						}
+						if !start.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+							t.Errorf("Expected the range to start on March 1, got %v", start)
+						}
+						return map[string]interface{}{"total_events": 100}, nil
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse:  func(t *testing.T, resp map[string]interface{}) {},
+		},
+		{
+			name:           "Unknown time zone",
+			queryParams:    "?tz=Mars/Olympus_Mons",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  nil,
+		},
+		{
+			name:        "Period",
+			queryParams: "?period=30d",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+						if filters["period"] != "30d" {
+							t.Errorf("Expected period filter to be '30d', got %q", filters["period"])
+						}
+						if days := end.Sub(start).Round(time.Hour) / (24 * time.Hour); days != 30 {
+							t.Errorf("Expected a 30 day range, got %v to %v", start, end)
+						}
+						return map[string]interface{}{"total_events": 100}, nil
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse:  func(t *testing.T, resp map[string]interface{}) {},
+		},
+		{
+			name:           "Unknown period",
+			queryParams:    "?period=fortnight",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  nil,
+		},
+		{
+			name:        "Bounce mode",
+			queryParams: "?bounce_mode=single_event",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+						if filters["bounce_mode"] != "single_event" {
+							t.Errorf("Expected bounce_mode filter to be 'single_event', got %q", filters["bounce_mode"])
+						}
+						return map[string]interface{}{"bounce_rate": 40.0}, nil
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse:  func(t *testing.T, resp map[string]interface{}) {},
+		},
+		{
+			name:           "Unknown bounce mode",
+			queryParams:    "?bounce_mode=ga4",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  nil,
+		},
+		{
+			name:        "Strip query",
+			queryParams: "?strip_query=0",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetStats(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
+					DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+						if filters["strip_query"] != "0" {
+							t.Errorf("Expected strip_query filter to be '0', got %q", filters["strip_query"])
+						}
+						return map[string]interface{}{"top_pages": []interface{}{}}, nil
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse:  func(t *testing.T, resp map[string]interface{}) {},
+		},
+		{
+			name:           "Invalid strip query",
+			queryParams:    "?strip_query=maybe",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse:  nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -298,7 +463,7 @@ func TestGetEvents(t *testing.T) {
 			queryParams: "",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetEvents(gomock.Any(), gomock.Any(), 100, 0).
+					GetEvents(gomock.Any(), gomock.Any(), gomock.Any(), 100, 0, map[string]string{}).
 					Return(map[string]interface{}{
 						"events": []interface{}{},
 						"total":  0,
@@ -312,7 +477,43 @@ func TestGetEvents(t *testing.T) {
 			queryParams: "?limit=50&offset=100",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetEvents(gomock.Any(), gomock.Any(), 50, 100).
+					GetEvents(gomock.Any(), gomock.Any(), gomock.Any(), 50, 100, map[string]string{}).
+					Return(map[string]interface{}{
+						"events": []interface{}{},
+						"total":  0,
+					}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "With filters",
+			queryParams: "?country=Egypt&browser=Firefox&event=signup&user_id=u1&session_id=s1",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetEvents(gomock.Any(), gomock.Any(), gomock.Any(), 100, 0, map[string]string{
+						"country":    "Egypt",
+						"browser":    "Firefox",
+						"event":      "signup",
+						"user_id":    "u1",
+						"session_id": "s1",
+					}).
+					Return(map[string]interface{}{
+						"events": []interface{}{},
+						"total":  0,
+					}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "With cursor",
+			queryParams: "?limit=50&before=" + domain.EventCursor{Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), ID: 7}.Encode(),
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetEvents(gomock.Any(), gomock.Any(), gomock.Any(), 50, 0, map[string]string{
+						"before": domain.EventCursor{Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), ID: 7}.Encode(),
+					}).
 					Return(map[string]interface{}{
 						"events": []interface{}{},
 						"total":  0,
@@ -321,12 +522,24 @@ func TestGetEvents(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "Invalid cursor",
+			queryParams:    "?before=nonsense",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Cursor with offset",
+			queryParams:    "?offset=100&before=" + domain.EventCursor{Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), ID: 7}.Encode(),
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:        "Service error",
 			queryParams: "",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetEvents(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					GetEvents(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(nil, errors.New("error")).
 					Times(1)
 			},
@@ -368,7 +581,7 @@ func TestGetOnlineUsers(t *testing.T) {
 			queryParams: "",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetOnlineUsers(5).
+					GetOnlineUsers(gomock.Any(), 5).
 					Return(map[string]interface{}{
 						"online_users": 42,
 					}, nil).
@@ -381,7 +594,7 @@ func TestGetOnlineUsers(t *testing.T) {
 			queryParams: "?window=10",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetOnlineUsers(10).
+					GetOnlineUsers(gomock.Any(), 10).
 					Return(map[string]interface{}{
 						"online_users": 50,
 					}, nil).
@@ -394,7 +607,7 @@ func TestGetOnlineUsers(t *testing.T) {
 			queryParams: "",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetOnlineUsers(gomock.Any()).
+					GetOnlineUsers(gomock.Any(), gomock.Any()).
 					Return(nil, errors.New("error")).
 					Times(1)
 			},
@@ -435,7 +648,7 @@ func TestGetProjects(t *testing.T) {
 			name: "Success",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetProjects().
+					GetProjects(gomock.Any()).
 					Return([]string{"project1", "project2"}, nil).
 					Times(1)
 			},
@@ -446,7 +659,7 @@ func TestGetProjects(t *testing.T) {
 			name: "Service error",
 			setupMock: func(m *mocks.MockEventService) {
 				m.EXPECT().
-					GetProjects().
+					GetProjects(gomock.Any()).
 					Return(nil, errors.New("error")).
 					Times(1)
 			},
@@ -539,6 +752,79 @@ func TestHealth(t *testing.T) {
 	}
 }
 
+func TestReady(t *testing.T) {
+	ok := domain.HealthCheck{Status: domain.CheckOK}
+	tests := []struct {
+		name           string
+		checks         map[string]domain.HealthCheck
+		expectedCode   int
+		expectedStatus string
+	}{
+		{
+			name:           "All checks pass",
+			checks:         map[string]domain.HealthCheck{"database": ok, "storage": ok, "query": ok},
+			expectedCode:   http.StatusOK,
+			expectedStatus: "ok",
+		},
+		{
+			name:           "Skipped checks do not fail",
+			checks:         map[string]domain.HealthCheck{"database": ok, "storage": {Status: domain.CheckSkipped}, "query": ok},
+			expectedCode:   http.StatusOK,
+			expectedStatus: "ok",
+		},
+		{
+			name: "Storage not writable",
+			checks: map[string]domain.HealthCheck{"database": ok, "query": ok,
+				"storage": {Status: domain.CheckFailed, Error: "data directory is not writable"}},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: "unavailable",
+		},
+		{
+			name: "Database down",
+			checks: map[string]domain.HealthCheck{"storage": ok,
+				"database": {Status: domain.CheckFailed, Error: "connection closed"},
+				"query":    {Status: domain.CheckFailed, Error: "connection closed"}},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: "unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			mockService.EXPECT().CheckReadiness(gomock.Any()).Return(domain.Readiness{Checks: tt.checks})
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/health/ready", nil)
+			w := httptest.NewRecorder()
+
+			handler.Ready(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status %d, got %d", tt.expectedCode, w.Code)
+			}
+			var resp struct {
+				Status string                        `json:"status"`
+				Checks map[string]domain.HealthCheck `json:"checks"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Status != tt.expectedStatus {
+				t.Errorf("Expected status %q, got %q", tt.expectedStatus, resp.Status)
+			}
+			for name, check := range tt.checks {
+				if resp.Checks[name] != check {
+					t.Errorf("Check %s: expected %+v, got %+v", name, check, resp.Checks[name])
+				}
+			}
+		})
+	}
+}
+
 func TestGeoTest(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -652,3 +938,1530 @@ func TestGetClientIP(t *testing.T) {
 		})
 	}
 }
+
+func TestAdminReset(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		allowReset     string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+		expectedFiles  float64
+	}{
+		{
+			name:           "Rejected without ALLOW_RESET",
+			method:         http.MethodPost,
+			allowReset:     "",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Rejected with ALLOW_RESET not 1",
+			method:         http.MethodPost,
+			allowReset:     "true",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Invalid method",
+			method:         http.MethodGet,
+			allowReset:     "1",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "Clears data with ALLOW_RESET",
+			method:     http.MethodPost,
+			allowReset: "1",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					ResetData().
+					Return(3, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedFiles:  3,
+		},
+		{
+			name:       "Service error",
+			method:     http.MethodPost,
+			allowReset: "1",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					ResetData().
+					Return(0, errors.New("disk error")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Setenv("ALLOW_RESET", tt.allowReset); err != nil {
+				t.Fatalf("Failed to set ALLOW_RESET env: %v", err)
+			}
+			defer func() {
+				if err := os.Unsetenv("ALLOW_RESET"); err != nil {
+					t.Logf("Warning: failed to unset ALLOW_RESET env: %v", err)
+				}
+			}()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/admin/reset", nil)
+			w := httptest.NewRecorder()
+
+			handler.AdminReset(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp map[string]interface{}
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp["files_removed"] != tt.expectedFiles {
+					t.Errorf("Expected files_removed %v, got %v", tt.expectedFiles, resp["files_removed"])
+				}
+			}
+		})
+	}
+}
+
+func TestGetFunnelAnalysisValidation(t *testing.T) {
+	step := `{"name":"Visit","event_name":"page_view"}`
+	manySteps := strings.TrimSuffix(strings.Repeat(step+",", MaxFunnelSteps+1), ",")
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Valid request",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","filters":{"project":"p1","botFilter":"human"}}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid JSON",
+			body:           `{"steps":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid JSON",
+		},
+		{
+			name:           "No steps",
+			body:           `{"steps":[],"start_date":"2024-01-01","end_date":"2024-01-31"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "at least one funnel step is required",
+		},
+		{
+			name:           "Too many steps",
+			body:           `{"steps":[` + manySteps + `],"start_date":"2024-01-01","end_date":"2024-01-31"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "at most 20 funnel steps are allowed",
+		},
+		{
+			name:           "Missing dates",
+			body:           `{"steps":[` + step + `]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "start_date and end_date are required",
+		},
+		{
+			name:           "Malformed start date",
+			body:           `{"steps":[` + step + `],"start_date":"01/01/2024","end_date":"2024-01-31"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "start_date must be YYYY-MM-DD",
+		},
+		{
+			name:           "Malformed end date",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-02-30"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "end_date must be YYYY-MM-DD",
+		},
+		{
+			name:           "End before start",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-31","end_date":"2024-01-01"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "end_date must not be before start_date",
+		},
+		{
+			name:           "Unknown global filter",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","filters":{"city":"Gaza"}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `unknown filter "city"`,
+		},
+		{
+			name:           "Invalid bot filter",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","filters":{"botFilter":"robots"}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "botFilter must be",
+		},
+		{
+			name:           "Unknown time zone",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","filters":{"tz":"Mars/Olympus"}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `unknown tz "Mars/Olympus"`,
+		},
+		{
+			name:           "Step without event name",
+			body:           `{"steps":[` + step + `,{"name":"Signup","url":"/signup"}],"start_date":"2024-01-01","end_date":"2024-01-31"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "step 2: event_name or event_names is required",
+		},
+		{
+			name:           "Conversion window",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","conversion_window_hours":24,"max_funnel_duration":168}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Negative conversion window",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","conversion_window_hours":-1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "conversion_window_hours must not be negative",
+		},
+		{
+			name:           "Negative max funnel duration",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","max_funnel_duration":-2}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "max_funnel_duration must not be negative",
+		},
+		{
+			name:           "Session scope",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","scope":"session"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unknown scope",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","scope":"device"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `unknown scope "device"`,
+		},
+		{
+			name:           "Any order",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","strict_order":false}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Window without strict order",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","strict_order":false,"conversion_window_hours":24}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "conversion_window_hours and max_funnel_duration require strict_order",
+		},
+		{
+			name:           "Breakdown by channel",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","breakdown_by":"channel","filters":{"source":"google.com"}}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unknown breakdown",
+			body:           `{"steps":[` + step + `],"start_date":"2024-01-01","end_date":"2024-01-31","breakdown_by":"browser"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `breakdown_by must be one of channel, device, country or source, got "browser"`,
+		},
+		{
+			name:           "Any-of step",
+			body:           `{"steps":[` + step + `,{"name":"Signup","event_names":["signup","oauth_signup"],"url_pattern":"/signup*"}],"start_date":"2024-01-01","end_date":"2024-01-31"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Too many step event names",
+			body:           `{"steps":[{"name":"Any","event_names":["e1","e2","e3","e4","e5","e6","e7","e8","e9","e10","e11","e12","e13","e14","e15","e16","e17","e18","e19","e20","e21"]}],"start_date":"2024-01-01","end_date":"2024-01-31"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "step 1: at most 20 event names are allowed, got 21",
+		},
+		{
+			name:           "Unknown step filter",
+			body:           `{"steps":[{"name":"Visit","event_name":"page_view","filters":{"project":"p1"}}],"start_date":"2024-01-01","end_date":"2024-01-31"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `step 1: unknown filter "project"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			if tt.expectedStatus == http.StatusOK {
+				mockService.EXPECT().
+					GetFunnelAnalysis(gomock.Any(), gomock.Any()).
+					Return(&domain.FunnelAnalysisResult{}, nil).
+					Times(1)
+			}
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/funnel", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.GetFunnelAnalysis(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedError != "" && !strings.Contains(errorMessage(w), tt.expectedError) {
+				t.Errorf("Expected error containing %q, got %q", tt.expectedError, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompareSegments(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:   "Valid request",
+			method: http.MethodPost,
+			body:   `{"start_date":"2024-01-01","end_date":"2024-01-31","a":{"browser":"Chrome"},"b":{"browser":"Safari"}}`,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					CompareSegments(gomock.Any(), gomock.Any(), gomock.Any(), map[string]string{"browser": "Chrome"}, map[string]string{"browser": "Safari"}).
+					DoAndReturn(func(_ context.Context, start, end time.Time, a, b map[string]string) (map[string]interface{}, error) {
+						if start.Day() != 1 || end.Day() != 31 || end.Hour() != 23 {
+							t.Errorf("Expected whole-day range, got %v to %v", start, end)
+						}
+						return map[string]interface{}{"a": map[string]interface{}{}, "b": map[string]interface{}{}, "deltas": map[string]interface{}{}}, nil
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid method",
+			method:         http.MethodGet,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "Invalid JSON",
+			method:         http.MethodPost,
+			body:           `{"a":`,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing dates",
+			method:         http.MethodPost,
+			body:           `{"a":{"browser":"Chrome"},"b":{"browser":"Safari"}}`,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "End before start",
+			method:         http.MethodPost,
+			body:           `{"start_date":"2024-02-01","end_date":"2024-01-01"}`,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Service error",
+			method: http.MethodPost,
+			body:   `{"start_date":"2024-01-01","end_date":"2024-01-31"}`,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					CompareSegments(gomock.Any(), gomock.Any(), gomock.Any(), map[string]string{}, map[string]string{}).
+					Return(nil, errors.New("database error")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/stats/compare", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.CompareSegments(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAdminFlush(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+		expectedResult domain.FlushResult
+	}{
+		{
+			name:   "Flushes buffered events",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					FlushEvents().
+					Return(domain.FlushResult{EventsFlushed: 42, File: "data/events/web/events_1.parquet", Files: []string{"data/events/web/events_1.parquet"}}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedResult: domain.FlushResult{EventsFlushed: 42, File: "data/events/web/events_1.parquet", Files: []string{"data/events/web/events_1.parquet"}},
+		},
+		{
+			name:   "Empty buffer",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					FlushEvents().
+					Return(domain.FlushResult{}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			expectedResult: domain.FlushResult{},
+		},
+		{
+			name:           "Invalid method",
+			method:         http.MethodGet,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "Service error",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					FlushEvents().
+					Return(domain.FlushResult{}, errors.New("copy failed")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/admin/flush", nil)
+			w := httptest.NewRecorder()
+
+			handler.AdminFlush(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp domain.FlushResult
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if !reflect.DeepEqual(resp, tt.expectedResult) {
+					t.Errorf("Expected %+v, got %+v", tt.expectedResult, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminCompact(t *testing.T) {
+	compacted := domain.CompactionResult{FilesMerged: 12, FilesWritten: 2, BytesBefore: 48 << 20, BytesAfter: 40 << 20}
+	tests := []struct {
+		name           string
+		method         string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:   "Compacts files",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().CompactFiles(gomock.Any()).Return(compacted, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Already running",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().CompactFiles(gomock.Any()).Return(domain.CompactionResult{}, domain.ErrCompactionRunning)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "Table backend",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().CompactFiles(gomock.Any()).Return(domain.CompactionResult{}, domain.ErrNoCompaction)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "Merge error",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().CompactFiles(gomock.Any()).Return(domain.CompactionResult{}, errors.New("merge failed"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Invalid method",
+			method:         http.MethodGet,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/admin/compact", nil)
+			w := httptest.NewRecorder()
+
+			handler.AdminCompact(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp domain.CompactionResult
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp != compacted {
+					t.Errorf("Expected %+v, got %+v", compacted, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminStorage(t *testing.T) {
+	newest := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	stats := domain.StorageStats{
+		Backend:     "parquet",
+		TotalEvents: 42,
+		NewestEvent: &newest,
+		FileCount:   1,
+		TotalBytes:  2048,
+		Files:       []domain.StorageFile{{Path: "data/events/web/events_1.parquet", Bytes: 2048, Rows: 42, RowGroups: 1}},
+		Buffer:      &domain.BufferStats{Events: 3, FlushSize: 10000, Capacity: 20000},
+	}
+	tests := []struct {
+		name           string
+		method         string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:   "Reports storage",
+			method: http.MethodGet,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetStorageStats(gomock.Any()).Return(stats, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Metadata error",
+			method: http.MethodGet,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetStorageStats(gomock.Any()).Return(domain.StorageStats{}, errors.New("corrupt file"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Invalid method",
+			method:         http.MethodPost,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/admin/storage", nil)
+			w := httptest.NewRecorder()
+
+			handler.AdminStorage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp domain.StorageStats
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if !reflect.DeepEqual(resp, stats) {
+					t.Errorf("Expected %+v, got %+v", stats, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminRebuildUserSketch(t *testing.T) {
+	rebuilt := domain.LifetimeUsers{UniqueUsers: 1234, Source: domain.LifetimeSourceSketch}
+	tests := []struct {
+		name           string
+		method         string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:   "Rebuilds the sketch",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().RebuildUserSketch(gomock.Any()).Return(nil)
+				m.EXPECT().GetLifetimeUniqueUsers(gomock.Any()).Return(rebuilt, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid method",
+			method:         http.MethodGet,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "Table backend",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().RebuildUserSketch(gomock.Any()).Return(domain.ErrNoUserSketch)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "Service error",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().RebuildUserSketch(gomock.Any()).Return(errors.New("read failed"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			w := httptest.NewRecorder()
+			NewEventHandler(mockService, nil).AdminRebuildUserSketch(w, httptest.NewRequest(tt.method, "/api/admin/lifetime/rebuild", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var resp domain.LifetimeUsers
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp != rebuilt {
+					t.Errorf("Expected %+v, got %+v", rebuilt, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestGetLifetimeUsersHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockEventService(ctrl)
+	expected := domain.LifetimeUsers{UniqueUsers: 98765, Source: domain.LifetimeSourceScan}
+	mockService.EXPECT().GetLifetimeUniqueUsers(gomock.Any()).Return(expected, nil)
+
+	w := httptest.NewRecorder()
+	NewEventHandler(mockService, nil).GetLifetimeUsersHandler(w, httptest.NewRequest(http.MethodGet, "/api/stats/lifetime", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp domain.LifetimeUsers
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp != expected {
+		t.Errorf("Expected %+v, got %+v", expected, resp)
+	}
+}
+
+func TestDebugSample(t *testing.T) {
+	sample := func(n int) []domain.Event {
+		events := make([]domain.Event, n)
+		for i := range events {
+			events[i] = domain.Event{ID: uint64(i + 1), EventName: "page_view", Channel: "Direct"}
+		}
+		return events
+	}
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+		maxEvents      int
+	}{
+		{
+			name:        "Default sample size",
+			queryParams: "",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().SampleEvents(gomock.Any(), 20).Return(sample(20), nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			maxEvents:      20,
+		},
+		{
+			name:        "Fewer stored events than requested",
+			queryParams: "?n=5",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().SampleEvents(gomock.Any(), 5).Return(sample(3), nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			maxEvents:      5,
+		},
+		{
+			name:        "Capped at 1000",
+			queryParams: "?n=5000",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().SampleEvents(gomock.Any(), 1000).Return(sample(10), nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+			maxEvents:      1000,
+		},
+		{
+			name:           "Invalid n",
+			queryParams:    "?n=zero",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Service error",
+			queryParams: "?n=5",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().SampleEvents(gomock.Any(), 5).Return(nil, errors.New("database error")).Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/debug/sample"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.DebugSample(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp struct {
+					Events []domain.Event `json:"events"`
+					Count  int            `json:"count"`
+				}
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(resp.Events) > tt.maxEvents {
+					t.Errorf("Expected at most %d events, got %d", tt.maxEvents, len(resp.Events))
+				}
+				if resp.Count != len(resp.Events) {
+					t.Errorf("Expected count %d to match events returned, got %d", len(resp.Events), resp.Count)
+				}
+			}
+		})
+	}
+}
+
+func TestGetChannelsHandlerMeta(t *testing.T) {
+	tests := []struct {
+		name                string
+		queryParams         string
+		expectedApproximate string
+		expectedAlgorithm   string
+	}{
+		{"Approximate by default", "", "true", "hyperloglog"},
+		{"Exact counts", "?exact=1", "false", "exact"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			mockService.EXPECT().
+				GetChannels(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Return([]domain.ChannelResult{{Channel: "Direct", TotalEvents: 10}}, nil).
+				Times(1)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/channels"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetChannelsHandler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			if got := w.Header().Get("X-Stats-Approximate"); got != tt.expectedApproximate {
+				t.Errorf("Expected X-Stats-Approximate %q, got %q", tt.expectedApproximate, got)
+			}
+			if got := w.Header().Get("X-Stats-Distinct-Count"); got != tt.expectedAlgorithm {
+				t.Errorf("Expected X-Stats-Distinct-Count %q, got %q", tt.expectedAlgorithm, got)
+			}
+
+			var resp []map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Expected response to stay an array: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetStickinessHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name: "Success",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetStickiness(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(25, 80, 100, 0.25, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Service error",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetStickiness(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(0, 0, 0, 0.0, errors.New("error")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/stickiness?end=2024-03-31", nil)
+			w := httptest.NewRecorder()
+
+			handler.GetStickinessHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp map[string]interface{}
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp["date"] != "2024-03-31" || resp["dau"] != 25.0 || resp["mau"] != 100.0 || resp["dau_mau"] != 0.25 {
+					t.Errorf("Unexpected stickiness response: %v", resp)
+				}
+			}
+		})
+	}
+}
+
+func TestGetNewVsReturningHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name: "Success",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetNewVsReturning(gomock.Any(), gomock.Any(), gomock.Any(), map[string]string{"project": "site"}).
+					Return(map[string]interface{}{
+						"total_users": 4,
+						"new":         map[string]interface{}{"users": 1, "visits": 1},
+						"returning":   map[string]interface{}{"users": 3, "visits": 5},
+					}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Service error",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetNewVsReturning(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("error")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/visitors?start=2024-03-01&end=2024-03-31&project=site", nil)
+			w := httptest.NewRecorder()
+
+			handler.GetNewVsReturningHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp map[string]interface{}
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				returning, _ := resp["returning"].(map[string]interface{})
+				if resp["total_users"] != 4.0 || returning["visits"] != 5.0 {
+					t.Errorf("Unexpected visitors response: %v", resp)
+				}
+			}
+		})
+	}
+}
+
+func TestGetScreenSizesHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name: "Success",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetScreenSizes(gomock.Any(), gomock.Any(), gomock.Any(), map[string]string{"project": "site"}).
+					Return([]map[string]interface{}{
+						{"bucket": "mobile", "min_width": 1, "max_width": 767, "events": 6, "visitors": 4, "percentage": 60.0},
+						{"bucket": "wide", "min_width": 1920, "max_width": nil, "events": 4, "visitors": 2, "percentage": 40.0},
+					}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Service error",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetScreenSizes(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("error")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/screens?start=2024-03-01&end=2024-03-31&project=site", nil)
+			w := httptest.NewRecorder()
+
+			handler.GetScreenSizesHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp []map[string]interface{}
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(resp) != 2 || resp[0]["bucket"] != "mobile" || resp[1]["max_width"] != nil {
+					t.Errorf("Unexpected screen sizes response: %v", resp)
+				}
+			}
+		})
+	}
+}
+
+func TestGetFilterValuesHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		queryParams    string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:        "Requested fields with filters",
+			queryParams: "?fields=country,event&browser=Firefox",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetFilterValues(gomock.Any(), gomock.Any(), gomock.Any(), []string{"country", "event"}, map[string]string{"browser": "Firefox"}).
+					Return(map[string][]domain.FilterValue{
+						"country": {{Value: "Egypt", Count: 12}},
+						"event":   {{Value: "page_view", Count: 30}},
+					}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "All fields by default",
+			queryParams: "",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetFilterValues(gomock.Any(), gomock.Any(), gomock.Any(), domain.FilterFields, map[string]string{}).
+					Return(map[string][]domain.FilterValue{}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unknown field",
+			queryParams:    "?fields=country,ip",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Service error",
+			queryParams: "?fields=os",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					GetFilterValues(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("error")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/filters"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetFilterValuesHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestEnrichEventSessionFallback(t *testing.T) {
+	handler := NewEventHandler(nil, nil)
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	ua := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+	newEvent := func(userID string, ts time.Time) domain.Event {
+		return domain.Event{EventName: "page_view", UserID: userID, UserAgent: ua, Timestamp: ts}
+	}
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		event := newEvent("user1", base)
+		handler.enrichEvent(&event, "203.0.113.1", base)
+		if event.SessionID != "" {
+			t.Errorf("Expected no session id without SESSION_ID_FALLBACK, got %q", event.SessionID)
+		}
+	})
+
+	if err := os.Setenv("SESSION_ID_FALLBACK", "synthesize"); err != nil {
+		t.Fatalf("Failed to set SESSION_ID_FALLBACK env: %v", err)
+	}
+	defer func() {
+		if err := os.Unsetenv("SESSION_ID_FALLBACK"); err != nil {
+			t.Logf("Warning: failed to unset SESSION_ID_FALLBACK env: %v", err)
+		}
+	}()
+
+	t.Run("Same visitor shares a session", func(t *testing.T) {
+		first := newEvent("user1", base)
+		second := newEvent("user1", base.Add(5*time.Minute))
+		handler.enrichEvent(&first, "203.0.113.1", base)
+		handler.enrichEvent(&second, "203.0.113.1", base)
+
+		if first.SessionID == "" {
+			t.Fatal("Expected a synthesized session id")
+		}
+		if first.SessionID != second.SessionID {
+			t.Errorf("Expected same session, got %q and %q", first.SessionID, second.SessionID)
+		}
+	})
+
+	t.Run("Different visitor gets a different session", func(t *testing.T) {
+		first := newEvent("user1", base)
+		other := newEvent("user2", base)
+		handler.enrichEvent(&first, "203.0.113.1", base)
+		handler.enrichEvent(&other, "203.0.113.1", base)
+
+		if first.SessionID == other.SessionID {
+			t.Errorf("Expected different sessions for different users, both got %q", first.SessionID)
+		}
+	})
+
+	t.Run("Provided session id is kept", func(t *testing.T) {
+		event := newEvent("user1", base)
+		event.SessionID = "session123"
+		handler.enrichEvent(&event, "203.0.113.1", base)
+
+		if event.SessionID != "session123" {
+			t.Errorf("Expected session123, got %q", event.SessionID)
+		}
+	})
+}
+
+func TestGetUserSessions(t *testing.T) {
+	sessions := func(n int) []domain.Session {
+		result := make([]domain.Session, n)
+		for i := range result {
+			result[i] = domain.Session{SessionID: fmt.Sprintf("s%d", i), UserID: "u1", Pages: []string{"/"}}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name            string
+		queryParams     string
+		setupMock       func(*mocks.MockEventService)
+		expectedStatus  int
+		expectedCount   int
+		expectedHasMore bool
+	}{
+		{
+			name:        "Default page",
+			queryParams: "?user_id=u1",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetUserSessions(gomock.Any(), "u1", gomock.Any(), gomock.Any(), DefaultSessionsLimit+1, 0, gomock.Any()).Return(sessions(3), nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  3,
+		},
+		{
+			name:        "More pages",
+			queryParams: "?user_id=u1&limit=2&offset=4",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetUserSessions(gomock.Any(), "u1", gomock.Any(), gomock.Any(), 3, 4, gomock.Any()).Return(sessions(3), nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedCount:   2,
+			expectedHasMore: true,
+		},
+		{
+			name:        "Limit capped",
+			queryParams: "?user_id=u1&limit=5000",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetUserSessions(gomock.Any(), "u1", gomock.Any(), gomock.Any(), MaxSessionsLimit+1, 0, gomock.Any()).Return(sessions(1), nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  1,
+		},
+		{
+			name:           "Missing user_id",
+			queryParams:    "",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid offset",
+			queryParams:    "?user_id=u1&offset=-1",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Service error",
+			queryParams: "?user_id=u1",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetUserSessions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+			req := httptest.NewRequest(http.MethodGet, "/api/sessions"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetUserSessions(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Sessions []domain.Session `json:"sessions"`
+				HasMore  bool             `json:"has_more"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(resp.Sessions) != tt.expectedCount {
+				t.Errorf("Expected %d sessions, got %d", tt.expectedCount, len(resp.Sessions))
+			}
+			if resp.HasMore != tt.expectedHasMore {
+				t.Errorf("Expected has_more %v, got %v", tt.expectedHasMore, resp.HasMore)
+			}
+		})
+	}
+}
+
+func TestTopListPaging(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected map[string]string // Paging filters passed to the service
+	}{
+		{name: "Defaults", query: "", expected: map[string]string{}},
+		{name: "Offset and sort", query: "?offset=50&sort=name&order=desc", expected: map[string]string{"offset": "50", "sort": "name", "order": "desc"}},
+		{name: "Invalid values are ignored", query: "?offset=-1&sort=country&order=up", expected: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			mockService.EXPECT().
+				GetTopCountries(gomock.Any(), gomock.Any(), gomock.Any(), 50, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _, _ time.Time, _ int, filters map[string]string) ([]map[string]interface{}, int, error) {
+					for _, key := range []string{"offset", "sort", "order"} {
+						if filters[key] != tt.expected[key] {
+							t.Errorf("Expected %s filter %q, got %q", key, tt.expected[key], filters[key])
+						}
+					}
+					return []map[string]interface{}{{"name": "US", "count": 3}}, 120, nil
+				}).
+				Times(1)
+
+			handler := NewEventHandler(mockService, nil)
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/countries"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetTopCountriesHandler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			if got := w.Header().Get("X-Total-Count"); got != "120" {
+				t.Errorf("Expected X-Total-Count 120, got %q", got)
+			}
+			var countries []map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&countries); err != nil || len(countries) != 1 {
+				t.Errorf("Expected the countries array to be unchanged, got %v (%v)", countries, err)
+			}
+		})
+	}
+}
+
+func TestGetTopRegionsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		level          string // Level passed to the service, empty when it must not be called
+		expectedStatus int
+	}{
+		{name: "Defaults to country", query: "", level: "country", expectedStatus: http.StatusOK},
+		{name: "Continent", query: "?level=continent", level: "continent", expectedStatus: http.StatusOK},
+		{name: "Region", query: "?level=region&offset=10", level: "region", expectedStatus: http.StatusOK},
+		{name: "Unknown level", query: "?level=city", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			if tt.level != "" {
+				mockService.EXPECT().
+					GetTopRegions(gomock.Any(), gomock.Any(), gomock.Any(), tt.level, 50, gomock.Any()).
+					Return([]map[string]interface{}{{"name": "Europe", "count": 3}}, 4, nil).
+					Times(1)
+			}
+
+			handler := NewEventHandler(mockService, nil)
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/regions"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetTopRegionsHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				if got := w.Header().Get("X-Total-Count"); got != "4" {
+					t.Errorf("Expected X-Total-Count 4, got %q", got)
+				}
+			} else if message := errorMessage(w); !strings.Contains(message, "unknown level") {
+				t.Errorf("Expected an unknown level error, got %q", message)
+			}
+		})
+	}
+}
+
+func TestGetTopStatsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	prevViewsPerVisit := 2.0
+	mockService := mocks.NewMockEventService(ctrl)
+	mockService.EXPECT().
+		GetTopStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&domain.TopStatsResult{
+			TotalVisits:         40,
+			PageViews:           100,
+			ViewsPerVisit:       2.5,
+			PrevViewsPerVisit:   &prevViewsPerVisit,
+			ViewsPerVisitChange: domain.RateOf(25),
+		}, nil).
+		Times(1)
+
+	handler := NewEventHandler(mockService, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/stats/overview?start=2024-01-01&end=2024-01-31", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetTopStats(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := map[string]float64{"views_per_visit": 2.5, "prev_views_per_visit": 2.0, "views_per_visit_change": 25}
+	for key, value := range expected {
+		if response[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, response[key])
+		}
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("LoadLocation failed: %v", err)
+	}
+	// Still March 1 in UTC, already March 2 in Tokyo
+	now := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		query         string
+		loc           *time.Location
+		expectedStart time.Time
+		expectedEnd   time.Time
+		wantErr       bool
+	}{
+		{
+			name:          "Default range in UTC",
+			loc:           time.UTC,
+			expectedStart: time.Date(2024, 2, 23, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 3, 1, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:          "Default range in Tokyo",
+			loc:           tokyo,
+			expectedStart: time.Date(2024, 2, 24, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 3, 2, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:          "Explicit days",
+			query:         "?start=2024-01-01&end=2024-01-31",
+			loc:           tokyo,
+			expectedStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 1, 31, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:          "Period today in UTC",
+			query:         "?period=today",
+			loc:           time.UTC,
+			expectedStart: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 3, 1, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:          "Period today in Tokyo",
+			query:         "?period=today",
+			loc:           tokyo,
+			expectedStart: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 3, 2, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:          "Period this month in Tokyo",
+			query:         "?period=this_month",
+			loc:           tokyo,
+			expectedStart: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 3, 2, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:          "Period overrides explicit days",
+			query:         "?period=last_month&start=2024-01-01&end=2024-01-31",
+			loc:           time.UTC,
+			expectedStart: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 2, 29, 23, 59, 59, 999999999, time.UTC),
+		},
+		{
+			name:          "Unknown period",
+			query:         "?period=fortnight&start=2024-01-01&end=2024-01-31",
+			loc:           time.UTC,
+			expectedStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 1, 31, 23, 59, 59, 999999999, time.UTC),
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/stats"+tt.query, nil)
+			start, end, err := parseDateRange(req, now, tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDateRange error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !start.Equal(tt.expectedStart) || !end.Equal(tt.expectedEnd) {
+				t.Errorf("Expected %v to %v, got %v to %v", tt.expectedStart, tt.expectedEnd, start, end)
+			}
+		})
+	}
+}
+
+func TestParseFiltersAndDatesSingleDay(t *testing.T) {
+	// The range must not depend on the zone the server runs in
+	local := time.Local
+	kiritimati, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Fatalf("LoadLocation failed: %v", err)
+	}
+	time.Local = kiritimati
+	t.Cleanup(func() { time.Local = local })
+
+	tests := []struct {
+		name       string
+		query      string
+		env        string
+		expectedTZ string
+	}{
+		{name: "UTC", query: "?start=2024-03-01&end=2024-03-01"},
+		{name: "Query zone", query: "?start=2024-03-01&end=2024-03-01&tz=Asia/Tokyo", expectedTZ: "Asia/Tokyo"},
+		{name: "Configured zone", query: "?start=2024-03-01&end=2024-03-01", env: "America/New_York", expectedTZ: "America/New_York"},
+		{name: "Query overrides configured zone", query: "?start=2024-03-01&end=2024-03-01&tz=UTC", env: "America/New_York", expectedTZ: "UTC"},
+		{name: "Invalid query zone", query: "?start=2024-03-01&end=2024-03-01&tz=Nowhere", env: "Asia/Tokyo", expectedTZ: "Asia/Tokyo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STATS_TZ", tt.env)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/overview"+tt.query, nil)
+			start, end, _, filters := parseFiltersAndDates(req)
+
+			expectedStart := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+			expectedEnd := time.Date(2024, 3, 1, 23, 59, 59, 999999999, time.UTC)
+			if !start.Equal(expectedStart) || !end.Equal(expectedEnd) {
+				t.Errorf("Expected %v to %v, got %v to %v", expectedStart, expectedEnd, start, end)
+			}
+			if filters["tz"] != tt.expectedTZ {
+				t.Errorf("Expected tz filter %q, got %q", tt.expectedTZ, filters["tz"])
+			}
+		})
+	}
+}
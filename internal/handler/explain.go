@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/middleware"
+)
+
+// writeExplain answers a request with explain=1 by the EXPLAIN ANALYZE plan of the
+// query of report, as plain text in place of the results, and reports whether it
+// did. The plan names the stored files, so it takes the admin key.
+func (h *EventHandler) writeExplain(w http.ResponseWriter, r *http.Request, report string, startDate, endDate time.Time, limit int, filters map[string]string) bool {
+	if explain, err := strconv.ParseBool(r.URL.Query().Get("explain")); err != nil || !explain {
+		return false
+	}
+
+	if err := middleware.CheckAdminKey(r); err != nil {
+		if errors.Is(err, middleware.ErrAdminDisabled) {
+			writeError(w, http.StatusForbidden, ErrCodeForbidden, "explain needs the admin API, which is disabled without ADMIN_API_KEY")
+		} else {
+			writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "explain needs the admin key")
+		}
+		return true
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	plan, err := h.service.ExplainStats(ctx, report, startDate, endDate, limit, filters)
+	if err != nil {
+		log.Printf("Error explaining %s: %v", report, err)
+		writeQueryError(ctx, w)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write([]byte(plan)); err != nil {
+		log.Printf("Error writing %s plan: %v", report, err)
+	}
+	return true
+}
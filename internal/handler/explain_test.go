@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExplain(t *testing.T) {
+	plan := "┌───────────────────────┐\n│      HASH_GROUP_BY      │\n└───────────────────────┘\n"
+	tests := []struct {
+		name           string
+		adminKey       string
+		url            string
+		headers        map[string]string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:     "Plan of a top list",
+			adminKey: "secret",
+			url:      "/api/stats/countries?start=2024-03-01&end=2024-03-31&limit=10&offset=20&explain=1",
+			headers:  map[string]string{"X-Admin-Key": "secret"},
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ExplainStats(gomock.Any(), domain.ReportCountries, gomock.Any(), gomock.Any(), 10, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, _, _ time.Time, _ int, filters map[string]string) (string, error) {
+						if filters["offset"] != "20" {
+							t.Errorf("Expected the paging in the filters, got %v", filters)
+						}
+						return plan, nil
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   plan,
+		},
+		{
+			name:     "Results without explain",
+			adminKey: "secret",
+			url:      "/api/stats/countries?explain=0",
+			headers:  map[string]string{"X-Admin-Key": "secret"},
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetTopCountries(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return([]map[string]interface{}{}, 0, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[]\n",
+		},
+		{
+			name:           "Wrong key",
+			adminKey:       "secret",
+			url:            "/api/stats/countries?explain=1",
+			headers:        map[string]string{"Authorization": "Bearer wrong"},
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Admin API disabled",
+			url:            "/api/stats/countries?explain=true",
+			headers:        map[string]string{"X-Admin-Key": "anything"},
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:     "Query error",
+			adminKey: "secret",
+			url:      "/api/stats/countries?explain=1",
+			headers:  map[string]string{"X-Admin-Key": "secret"},
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ExplainStats(gomock.Any(), domain.ReportCountries, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return("", errors.New("binder error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ADMIN_API_KEY", tt.adminKey)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			handler.GetTopCountriesHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestExplainReports(t *testing.T) {
+	// Every endpoint with explain=1 names its own report
+	tests := []struct {
+		report  string
+		handler func(*EventHandler) http.HandlerFunc
+	}{
+		{domain.ReportOverview, func(h *EventHandler) http.HandlerFunc { return h.GetTopStats }},
+		{domain.ReportTimeline, func(h *EventHandler) http.HandlerFunc { return h.GetTimeline }},
+		{domain.ReportPages, func(h *EventHandler) http.HandlerFunc { return h.GetTopPagesHandler }},
+		{domain.ReportCountries, func(h *EventHandler) http.HandlerFunc { return h.GetTopCountriesHandler }},
+		{domain.ReportLanguages, func(h *EventHandler) http.HandlerFunc { return h.GetTopLanguagesHandler }},
+		{domain.ReportSources, func(h *EventHandler) http.HandlerFunc { return h.GetTopSourcesHandler }},
+		{domain.ReportEvents, func(h *EventHandler) http.HandlerFunc { return h.GetTopEventsHandler }},
+	}
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	for _, tt := range tests {
+		t.Run(tt.report, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			mockService.EXPECT().ExplainStats(gomock.Any(), tt.report, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("plan", nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/stats?explain=1", nil)
+			req.Header.Set("X-Admin-Key", "secret")
+			w := httptest.NewRecorder()
+
+			tt.handler(NewEventHandler(mockService, nil))(w, req)
+
+			if w.Code != http.StatusOK || w.Body.String() != "plan" {
+				t.Errorf("Expected the plan, got %d: %q", w.Code, w.Body.String())
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+				t.Errorf("Expected a text/plain response, got %q", contentType)
+			}
+		})
+	}
+}
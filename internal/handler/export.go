@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// DefaultExportMaxRows is the most events a Parquet export may hold unless
+// EXPORT_MAX_ROWS says otherwise
+const DefaultExportMaxRows = 1_000_000
+
+// exportMaxRows reads EXPORT_MAX_ROWS, falling back to DefaultExportMaxRows for
+// missing or invalid values
+func exportMaxRows() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("EXPORT_MAX_ROWS"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return DefaultExportMaxRows
+}
+
+// ExportSQLiteHandler runs the standard reports for the date range and filters and
+// sends them as a SQLite database, to be opened with any SQLite client
+// Endpoint: POST /api/export/sqlite?start=2024-01-01&end=2024-01-31
+func (h *EventHandler) ExportSQLiteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+
+	// The database is built on disk, SQLite cannot write to a stream
+	path, err := createExportFile("siraaj-export-*.sqlite")
+	if err != nil {
+		log.Printf("Error creating export file: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+	defer removeExportFile(path)
+
+	// An export runs every report, so it is not bound by QUERY_TIMEOUT, only stopped
+	// when the client goes away
+	if err := h.service.ExportSQLite(r.Context(), startDate, endDate, filters, path); err != nil {
+		if errors.Is(err, domain.ErrSQLiteUnavailable) {
+			log.Printf("Error exporting stats: %v", err)
+			writeError(w, http.StatusServiceUnavailable, ErrCodeUnavailable, domain.ErrSQLiteUnavailable.Error())
+			return
+		}
+		log.Printf("Error exporting stats: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+
+	filename := fmt.Sprintf("siraaj-%s-to-%s.sqlite", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	sendExportFile(w, path, "application/vnd.sqlite3", filename)
+}
+
+// ExportParquetHandler sends the raw events matching the date range and filters as
+// a Parquet file, refusing with 413 when more than EXPORT_MAX_ROWS match
+// Endpoint: GET /api/export/parquet?start=2024-01-01&end=2024-01-31
+func (h *EventHandler) ExportParquetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+
+	path, err := createExportFile("siraaj-export-*.parquet")
+	if err != nil {
+		log.Printf("Error creating export file: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+	defer removeExportFile(path)
+
+	rows, err := h.service.ExportParquet(r.Context(), startDate, endDate, filters, path, exportMaxRows())
+	if err != nil {
+		var tooLarge *domain.ExportTooLargeError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, tooLarge.Error())
+			return
+		}
+		log.Printf("Error exporting events: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(rows, 10))
+	filename := fmt.Sprintf("siraaj-events-%s-to-%s.parquet", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	sendExportFile(w, path, "application/vnd.apache.parquet", filename)
+}
+
+// createExportFile reserves a temporary file for an export and returns its path
+func createExportFile(pattern string) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		removeExportFile(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// removeExportFile deletes an export file once it is sent
+func removeExportFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to remove export file: %v", err)
+	}
+}
+
+// sendExportFile streams the export at path as an attachment named filename
+func sendExportFile(w http.ResponseWriter, path, contentType, filename string) {
+	export, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening export file: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+	defer func() {
+		if err := export.Close(); err != nil {
+			log.Printf("Warning: failed to close export file: %v", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if info, err := export.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	if _, err := io.Copy(w, export); err != nil {
+		log.Printf("Error sending export: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExportSQLiteHandler(t *testing.T) {
+	const content = "SQLite format 3\x00"
+	var exportPath string
+
+	tests := []struct {
+		name           string
+		method         string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:   "Success",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					ExportSQLite(gomock.Any(), gomock.Any(), gomock.Any(), map[string]string{"project": "site"}, gomock.Any()).
+					DoAndReturn(func(_ context.Context, start, end time.Time, filters map[string]string, path string) error {
+						exportPath = path
+						return os.WriteFile(path, []byte(content), 0o600)
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Service error",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					ExportSQLite(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errors.New("error")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:   "SQLite extension missing",
+			method: http.MethodPost,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					ExportSQLite(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(fmt.Errorf("%w: no connection", domain.ErrSQLiteUnavailable)).
+					Times(1)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodGet,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/export/sqlite?start=2024-03-01&end=2024-03-31&project=site", nil)
+			w := httptest.NewRecorder()
+
+			handler.ExportSQLiteHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if w.Body.String() != content {
+				t.Errorf("Expected the export file as the body, got %q", w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/vnd.sqlite3" {
+				t.Errorf("Expected a SQLite content type, got %q", got)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="siraaj-2024-03-01-to-2024-03-31.sqlite"` {
+				t.Errorf("Unexpected Content-Disposition %q", got)
+			}
+			if _, err := os.Stat(exportPath); !os.IsNotExist(err) {
+				t.Errorf("Expected the export file to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExportParquetHandler(t *testing.T) {
+	const content = "PAR1"
+	var exportPath string
+
+	tests := []struct {
+		name           string
+		method         string
+		maxRows        string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:   "Success",
+			method: http.MethodGet,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					ExportParquet(gomock.Any(), gomock.Any(), gomock.Any(), map[string]string{"project": "site"}, gomock.Any(), int64(DefaultExportMaxRows)).
+					DoAndReturn(func(_ context.Context, start, end time.Time, filters map[string]string, path string, maxRows int64) (int64, error) {
+						exportPath = path
+						return 42, os.WriteFile(path, []byte(content), 0o600)
+					}).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:    "Too many rows",
+			method:  http.MethodGet,
+			maxRows: "100",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					ExportParquet(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), int64(100)).
+					Return(int64(150), &domain.ExportTooLargeError{Rows: 150, Limit: 100}).
+					Times(1)
+			},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:    "Invalid cap falls back to the default",
+			method:  http.MethodGet,
+			maxRows: "-5",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					ExportParquet(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), int64(DefaultExportMaxRows)).
+					Return(int64(0), errors.New("error")).
+					Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EXPORT_MAX_ROWS", tt.maxRows)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/export/parquet?start=2024-03-01&end=2024-03-31&project=site", nil)
+			w := httptest.NewRecorder()
+
+			handler.ExportParquetHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if w.Body.String() != content {
+				t.Errorf("Expected the export file as the body, got %q", w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/vnd.apache.parquet" {
+				t.Errorf("Expected a Parquet content type, got %q", got)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="siraaj-events-2024-03-01-to-2024-03-31.parquet"` {
+				t.Errorf("Unexpected Content-Disposition %q", got)
+			}
+			if got := w.Header().Get("X-Total-Count"); got != "42" {
+				t.Errorf("Expected X-Total-Count 42, got %q", got)
+			}
+			if _, err := os.Stat(exportPath); !os.IsNotExist(err) {
+				t.Errorf("Expected the export file to be removed, got %v", err)
+			}
+		})
+	}
+}
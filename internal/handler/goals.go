@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// MaxGoalNameLength caps goal names so they stay readable in the dashboard
+const MaxGoalNameLength = 100
+
+// Goals lists and creates goals
+// Endpoint: GET, POST /api/goals
+func (h *EventHandler) Goals(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		goals, err := h.service.GetGoals(ctx)
+		if err != nil {
+			log.Printf("Error getting goals: %v", err)
+			writeQueryError(ctx, w)
+			return
+		}
+		writeGoalJSON(w, http.StatusOK, goals)
+	case http.MethodPost:
+		goal, ok := decodeGoal(w, r)
+		if !ok {
+			return
+		}
+		created, err := h.service.CreateGoal(ctx, goal)
+		if err != nil {
+			writeGoalError(ctx, w, err, "creating")
+			return
+		}
+		writeGoalJSON(w, http.StatusCreated, created)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Goal reads, updates or deletes the goal whose id ends the path
+// Endpoint: GET, PUT, DELETE /api/goals/{id}
+func (h *EventHandler) Goal(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/goals/"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "goal id must be a positive integer")
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		goal, err := h.service.GetGoal(ctx, id)
+		if err != nil {
+			writeGoalError(ctx, w, err, "getting")
+			return
+		}
+		writeGoalJSON(w, http.StatusOK, goal)
+	case http.MethodPut:
+		goal, ok := decodeGoal(w, r)
+		if !ok {
+			return
+		}
+		goal.ID = id
+		updated, err := h.service.UpdateGoal(ctx, goal)
+		if err != nil {
+			writeGoalError(ctx, w, err, "updating")
+			return
+		}
+		writeGoalJSON(w, http.StatusOK, updated)
+	case http.MethodDelete:
+		if err := h.service.DeleteGoal(ctx, id); err != nil {
+			writeGoalError(ctx, w, err, "deleting")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// GetGoalConversions returns the conversions and conversion rate of every goal
+// Endpoint: GET /api/goals/conversions
+func (h *EventHandler) GetGoalConversions(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, _, filters := parseFiltersAndDates(r)
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	started := time.Now()
+	conversions, err := h.service.GetGoalConversions(ctx, startDate, endDate, filters)
+	if err != nil {
+		log.Printf("Error getting goal conversions: %v", err)
+		writeQueryError(ctx, w)
+		return
+	}
+
+	h.writeStatsJSON(w, r, conversions, time.Since(started), "goal conversions")
+}
+
+// decodeGoal reads and validates a goal from the request body, writing a 400 and
+// returning false when it is invalid
+func decodeGoal(w http.ResponseWriter, r *http.Request) (domain.Goal, bool) {
+	var goal domain.Goal
+	if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
+		log.Printf("Error decoding goal: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON")
+		return domain.Goal{}, false
+	}
+
+	goal.Name = strings.TrimSpace(goal.Name)
+	goal.EventName = strings.TrimSpace(goal.EventName)
+	goal.URL = strings.TrimSpace(goal.URL)
+	if err := validateGoal(goal); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return domain.Goal{}, false
+	}
+	return goal, true
+}
+
+func validateGoal(goal domain.Goal) error {
+	if goal.Name == "" {
+		return errors.New("goal name is required")
+	}
+	if len(goal.Name) > MaxGoalNameLength {
+		return fmt.Errorf("goal name must be at most %d characters", MaxGoalNameLength)
+	}
+	if goal.EventName == "" && goal.URL == "" {
+		return errors.New("goal needs an event_name, a url or both")
+	}
+	return nil
+}
+
+// writeGoalError maps goal store errors to 404, 409, 504 or 500
+func writeGoalError(ctx context.Context, w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, domain.ErrGoalNotFound):
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+	case errors.Is(err, domain.ErrGoalExists):
+		writeError(w, http.StatusConflict, ErrCodeConflict, err.Error())
+	default:
+		log.Printf("Error %s goal: %v", action, err)
+		writeQueryError(ctx, w)
+	}
+}
+
+func writeGoalJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding goal response: %v", err)
+	}
+}
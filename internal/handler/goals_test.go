@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestGoals(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:   "List goals",
+			method: http.MethodGet,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetGoals(gomock.Any()).Return([]domain.Goal{{ID: 1, Name: "Signup", EventName: "signup"}}, nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Create goal",
+			method: http.MethodPost,
+			body:   `{"name":" Signup ","event_name":"signup"}`,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					CreateGoal(gomock.Any(), domain.Goal{Name: "Signup", EventName: "signup"}).
+					Return(domain.Goal{ID: 1, Name: "Signup", EventName: "signup"}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Missing name",
+			method:         http.MethodPost,
+			body:           `{"event_name":"signup"}`,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing definition",
+			method:         http.MethodPost,
+			body:           `{"name":"Signup"}`,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Name too long",
+			method:         http.MethodPost,
+			body:           `{"name":"` + strings.Repeat("a", MaxGoalNameLength+1) + `","url":"/thanks"}`,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			method:         http.MethodPost,
+			body:           `{`,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Duplicate name",
+			method: http.MethodPost,
+			body:   `{"name":"Signup","url":"/signup"}`,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().CreateGoal(gomock.Any(), gomock.Any()).Return(domain.Goal{}, domain.ErrGoalExists).Times(1)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Method not allowed",
+			method:         http.MethodDelete,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/goals", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.Goals(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGoal(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+	}{
+		{
+			name:   "Get goal",
+			method: http.MethodGet,
+			path:   "/api/goals/3",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetGoal(gomock.Any(), int64(3)).Return(domain.Goal{ID: 3, Name: "Signup", EventName: "signup"}, nil).Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Unknown goal",
+			method: http.MethodGet,
+			path:   "/api/goals/9",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetGoal(gomock.Any(), int64(9)).Return(domain.Goal{}, domain.ErrGoalNotFound).Times(1)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invalid id",
+			method:         http.MethodGet,
+			path:           "/api/goals/abc",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Update goal",
+			method: http.MethodPut,
+			path:   "/api/goals/3",
+			body:   `{"name":"Thanks","url":"/thanks"}`,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().
+					UpdateGoal(gomock.Any(), domain.Goal{ID: 3, Name: "Thanks", URL: "/thanks"}).
+					Return(domain.Goal{ID: 3, Name: "Thanks", URL: "/thanks"}, nil).
+					Times(1)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Delete goal",
+			method: http.MethodDelete,
+			path:   "/api/goals/3",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().DeleteGoal(gomock.Any(), int64(3)).Return(nil).Times(1)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "Service error",
+			method: http.MethodDelete,
+			path:   "/api/goals/3",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().DeleteGoal(gomock.Any(), int64(3)).Return(errors.New("database error")).Times(1)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.Goal(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetGoalConversions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rate := 50.0
+	mockService := mocks.NewMockEventService(ctrl)
+	mockService.EXPECT().
+		GetGoalConversions(gomock.Any(), gomock.Any(), gomock.Any(), map[string]string{"project": "web"}).
+		Return([]domain.GoalConversion{{Goal: domain.Goal{ID: 1, Name: "Signup"}, Conversions: 2, Events: 3, ConversionRate: &rate}}, nil).
+		Times(1)
+
+	handler := NewEventHandler(mockService, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/goals/conversions?project=web", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetGoalConversions(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var conversions []domain.GoalConversion
+	if err := json.NewDecoder(w.Body).Decode(&conversions); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(conversions) != 1 || conversions[0].ConversionRate == nil || *conversions[0].ConversionRate != rate {
+		t.Errorf("Unexpected conversions: %+v", conversions)
+	}
+}
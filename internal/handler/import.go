@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// MaxImportBodySize caps the file uploaded to POST /api/admin/import
+const MaxImportBodySize = 1 << 30
+
+// importFormats maps the content types of an import upload to its format
+var importFormats = map[string]string{
+	"":                     domain.ImportFormatCSV,
+	"text/csv":             domain.ImportFormatCSV,
+	"application/x-ndjson": domain.ImportFormatNDJSON,
+	"application/ndjson":   domain.ImportFormatNDJSON,
+	"application/jsonl":    domain.ImportFormatNDJSON,
+}
+
+// AdminImport stores historical events uploaded as a CSV file, or NDJSON with an
+// application/x-ndjson content type, keeping their timestamps. Each record is
+// validated like a tracked event; invalid ones are reported by line and skipped,
+// unless strict=true, which rejects the whole file. With enrich=true each event
+// goes through the tracking enrichment (geolocation, user agent, bot flag, channel
+// and privacy settings); otherwise it is stored as given.
+// Endpoint: POST /api/admin/import?enrich=true&strict=true
+func (h *EventHandler) AdminImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	format, ok := importFormat(r.Header.Get("Content-Type"))
+	if !ok {
+		writeError(w, http.StatusUnsupportedMediaType, ErrCodeInvalidRequest, "Content-Type must be text/csv or application/x-ndjson")
+		return
+	}
+
+	enrich := false
+	if enrichStr := r.URL.Query().Get("enrich"); enrichStr != "" {
+		var err error
+		if enrich, err = strconv.ParseBool(enrichStr); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "enrich must be true or false")
+			return
+		}
+	}
+	strict := false
+	if strictStr := r.URL.Query().Get("strict"); strictStr != "" {
+		var err error
+		if strict, err = strconv.ParseBool(strictStr); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "strict must be true or false")
+			return
+		}
+	}
+
+	// DuckDB reads the upload from disk
+	path, err := createExportFile("siraaj-import-*." + format)
+	if err != nil {
+		log.Printf("Error creating import file: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+	defer removeExportFile(path)
+	if err := saveImportFile(path, http.MaxBytesReader(w, r.Body, MaxImportBodySize)); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		log.Printf("Error saving import file: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Failed to read request body")
+		return
+	}
+
+	if format == domain.ImportFormatCSV {
+		if err := checkImportHeader(path); err != nil {
+			if errors.Is(err, domain.ErrInvalidImport) {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+				return
+			}
+			log.Printf("Error reading import file: %v", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	// Records get the field checks of tracked events, but not the timestamp
+	// window, since imports are historical
+	now := time.Now()
+	result, err := h.service.ImportEvents(r.Context(), path, format, strict, func(event *domain.Event) error {
+		if err := validateEventFields(*event); err != nil {
+			return err
+		}
+		if enrich {
+			h.enrichImported(event, now)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidImport) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		log.Printf("Error importing events after %d records: %v", result.Imported, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		return
+	}
+
+	log.Printf("📥 Imported %d events (%d records skipped)", result.Imported, result.Skipped)
+
+	// Like batches, an import with skipped records stores the rest; a strict one
+	// stores nothing
+	code := http.StatusOK
+	switch {
+	case result.Skipped > 0 && result.Imported == 0:
+		code = http.StatusBadRequest
+	case result.Skipped > 0:
+		code = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding import response: %v", err)
+	}
+}
+
+// importFormat returns the import format of an upload's content type
+func importFormat(contentType string) (string, bool) {
+	mediaType := ""
+	if contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return "", false
+		}
+	}
+	format, ok := importFormats[mediaType]
+	return format, ok
+}
+
+// saveImportFile writes the uploaded file to path
+func saveImportFile(path string, body io.Reader) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = io.Copy(file, body)
+	return err
+}
+
+// checkImportHeader validates the header line of the import file at path
+func checkImportHeader(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Printf("Warning: failed to close import file: %v", err)
+		}
+	}()
+
+	header, err := csv.NewReader(file).Read()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: the file is empty, expected a header line", domain.ErrInvalidImport)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrInvalidImport, err)
+	}
+	// Spreadsheet exports often start with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	return domain.ValidateImportHeader(header)
+}
+
+// enrichImported enriches an imported event like a tracked one, keeping the
+// ingestion time and sample rate it was imported with
+func (h *EventHandler) enrichImported(event *domain.Event, now time.Time) {
+	receivedAt, sampleRate := event.ReceivedAt, event.SampleRate
+	h.enrichEvent(event, event.IP, now)
+	if !receivedAt.IsZero() {
+		event.ReceivedAt = receivedAt
+	}
+	if sampleRate > 0 {
+		event.SampleRate = sampleRate
+	}
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAdminImport(t *testing.T) {
+	const validCSV = "\ufefftimestamp,event_name,url,user_agent\n2024-03-01T10:00:00Z,page_view,/,Googlebot/2.1\n"
+	const validNDJSON = `{"timestamp":"2024-03-01T10:00:00Z","event_name":"page_view","url":"/","user_agent":"Googlebot/2.1"}` + "\n"
+	partial := domain.ImportResult{Imported: 1, Skipped: 1, Errors: []domain.ImportError{{Line: 3, Error: "event_name is required"}}}
+	failed := domain.ImportResult{Skipped: 1, Errors: []domain.ImportError{{Line: 2, Error: "event_name is required"}}}
+
+	// importRows stands in for the service, running prepare on the rows of the
+	// uploaded file
+	var prepared []domain.Event
+	importRows := func(result domain.ImportResult) func(context.Context, string, string, bool, func(*domain.Event) error) (domain.ImportResult, error) {
+		return func(_ context.Context, path, _ string, _ bool, prepare func(*domain.Event) error) (domain.ImportResult, error) {
+			if _, err := os.Stat(path); err != nil {
+				return domain.ImportResult{}, fmt.Errorf("expected the upload on disk: %w", err)
+			}
+			event := domain.Event{Timestamp: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), EventName: "page_view", URL: "/", UserAgent: "Googlebot/2.1"}
+			if err := prepare(&event); err != nil {
+				return domain.ImportResult{}, err
+			}
+			prepared = append(prepared, event)
+			return result, nil
+		}
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		query          string
+		contentType    string
+		body           string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+		expectedResult *domain.ImportResult
+		enriched       bool
+	}{
+		{
+			name:   "Success",
+			method: http.MethodPost,
+			body:   validCSV,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatCSV, false, gomock.Any()).
+					DoAndReturn(importRows(domain.ImportResult{Imported: 1, Errors: []domain.ImportError{}}))
+			},
+			expectedStatus: http.StatusOK,
+			expectedResult: &domain.ImportResult{Imported: 1, Errors: []domain.ImportError{}},
+		},
+		{
+			name:   "Enriched",
+			method: http.MethodPost,
+			query:  "?enrich=true",
+			body:   validCSV,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatCSV, false, gomock.Any()).
+					DoAndReturn(importRows(domain.ImportResult{Imported: 1, Errors: []domain.ImportError{}}))
+			},
+			expectedStatus: http.StatusOK,
+			expectedResult: &domain.ImportResult{Imported: 1, Errors: []domain.ImportError{}},
+			enriched:       true,
+		},
+		{
+			name:        "NDJSON",
+			method:      http.MethodPost,
+			contentType: "application/x-ndjson; charset=utf-8",
+			body:        validNDJSON,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatNDJSON, false, gomock.Any()).
+					DoAndReturn(importRows(domain.ImportResult{Imported: 1, Errors: []domain.ImportError{}}))
+			},
+			expectedStatus: http.StatusOK,
+			expectedResult: &domain.ImportResult{Imported: 1, Errors: []domain.ImportError{}},
+		},
+		{
+			name:        "Strict",
+			method:      http.MethodPost,
+			query:       "?strict=1",
+			contentType: "text/csv",
+			body:        validCSV,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatCSV, true, gomock.Any()).Return(failed, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedResult: &failed,
+		},
+		{
+			name:   "Some rows failed",
+			method: http.MethodPost,
+			body:   validCSV,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatCSV, false, gomock.Any()).Return(partial, nil)
+			},
+			expectedStatus: http.StatusMultiStatus,
+			expectedResult: &partial,
+		},
+		{
+			name:   "Every row failed",
+			method: http.MethodPost,
+			body:   validCSV,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatCSV, false, gomock.Any()).Return(failed, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedResult: &failed,
+		},
+		{
+			name:   "Malformed rows",
+			method: http.MethodPost,
+			body:   validCSV,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatCSV, false, gomock.Any()).
+					Return(domain.ImportResult{}, fmt.Errorf("%w: expected 4 values", domain.ErrInvalidImport))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "Service error",
+			method: http.MethodPost,
+			body:   validCSV,
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatCSV, false, gomock.Any()).Return(domain.ImportResult{}, errors.New("error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Unknown column",
+			method:         http.MethodPost,
+			body:           "timestamp,event_name,id\n2024-03-01T10:00:00Z,page_view,1\n",
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "NDJSON header is not checked as CSV",
+			method:      http.MethodPost,
+			contentType: "application/x-ndjson",
+			body:        "{}\n",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().ImportEvents(gomock.Any(), gomock.Any(), domain.ImportFormatNDJSON, false, gomock.Any()).Return(failed, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedResult: &failed,
+		},
+		{
+			name:           "Unsupported content type",
+			method:         http.MethodPost,
+			contentType:    "application/json",
+			body:           validNDJSON,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "Empty file",
+			method:         http.MethodPost,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid enrich",
+			method:         http.MethodPost,
+			query:          "?enrich=maybe",
+			body:           validCSV,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid strict",
+			method:         http.MethodPost,
+			query:          "?strict=maybe",
+			body:           validCSV,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodGet,
+			setupMock:      func(m *mocks.MockEventService) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+			prepared = nil
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(tt.method, "/api/admin/import"+tt.query, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			handler.AdminImport(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedResult != nil {
+				var result domain.ImportResult
+				if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if !reflect.DeepEqual(result, *tt.expectedResult) {
+					t.Errorf("Expected %+v, got %+v", *tt.expectedResult, result)
+				}
+			}
+			if len(prepared) == 1 {
+				event := prepared[0]
+				if !event.Timestamp.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)) {
+					t.Errorf("Expected the original timestamp to be kept, got %v", event.Timestamp)
+				}
+				if event.IsBot != tt.enriched {
+					t.Errorf("Expected the bot flag to be set only when enriching, got %v", event.IsBot)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/referrerspam"
+	"github.com/mohamedelhefni/siraaj/internal/uaparser"
+)
+
+// droppedEvents counts the events accepted but not stored since startup
+type droppedEvents struct {
+	doNotTrack atomic.Int64
+	bots       atomic.Int64
+	spam       atomic.Int64
+	sampled    atomic.Int64
+	duplicates atomic.Int64
+}
+
+// doNotTrack reports whether the request asks not to be tracked. DNT is honored
+// unless HONOR_DNT=0.
+func doNotTrack(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" && os.Getenv("HONOR_DNT") != "0"
+}
+
+// dropBots reports whether bot events are discarded at ingestion (DROP_BOTS=1)
+// instead of being stored and filtered out at query time
+func dropBots() bool {
+	return os.Getenv("DROP_BOTS") == "1"
+}
+
+// sampleRate reads SAMPLE_RATE, the share of visitors whose events are stored.
+// Values outside (0, 1] are ignored and every event is stored.
+func sampleRate() float64 {
+	rate, err := strconv.ParseFloat(os.Getenv("SAMPLE_RATE"), 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		return 1
+	}
+	return rate
+}
+
+// sampledIn reports whether events of the visitor userID are kept at rate. The
+// choice is a hash of the user id rather than a coin flip per event, so a visitor's
+// events are kept or dropped together and visitor and visit counts can be scaled
+// up like event counts.
+func sampledIn(userID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(userID))
+	// FNV alone leaves similar ids close together, the murmur3 finalizer spreads them
+	h := hash.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	// The top 53 bits as a fraction in [0, 1)
+	return float64(h>>11)/(1<<53) < rate
+}
+
+// applyUserAgent sets the browser, OS and device parsed from the user agent. By
+// default only the fields the client left empty are filled in; UA_PARSE=always
+// replaces client values, UA_PARSE=off leaves them alone.
+func applyUserAgent(event *domain.Event) {
+	mode := uaparser.Mode()
+	if mode == uaparser.ModeOff || event.UserAgent == "" {
+		return
+	}
+
+	parsed := uaparser.Parse(event.UserAgent)
+	set := func(field *string, value string) {
+		if value != "" && (*field == "" || mode == uaparser.ModeAlways) {
+			*field = value
+		}
+	}
+	set(&event.Browser, parsed.Browser)
+	set(&event.OS, parsed.OS)
+	set(&event.Device, parsed.Device)
+}
+
+// applyScreenDevice classifies the device by screen width instead of the user
+// agent when DEVICE_FROM_SCREEN=1 and the event has a width
+func applyScreenDevice(event *domain.Event) {
+	if os.Getenv("DEVICE_FROM_SCREEN") != "1" {
+		return
+	}
+	if device := uaparser.DeviceForWidth(event.ScreenWidth); device != "" {
+		event.Device = device
+	}
+}
+
+// dropDoNotTrack records n events discarded because of a DNT header
+func (h *EventHandler) dropDoNotTrack(n int) {
+	total := h.dropped.doNotTrack.Add(int64(n))
+	log.Printf("🚫 Dropped %d events with Do Not Track (%d since startup)", n, total)
+}
+
+// dropUnwanted removes the events that are not stored: bot events when DROP_BOTS is
+// on, spam referrals when REFERRER_SPAM=drop and visitors left out by SAMPLE_RATE.
+// It returns the events to store.
+func (h *EventHandler) dropUnwanted(events []domain.Event) []domain.Event {
+	bots, spam, sampling := dropBots(), referrerspam.Mode() == referrerspam.ModeDrop, sampleRate() < 1
+	if !bots && !spam && !sampling {
+		return events
+	}
+
+	kept := events[:0]
+	var droppedBots, droppedSpam, droppedSampled int64
+	for _, event := range events {
+		switch {
+		case bots && event.IsBot:
+			droppedBots++
+		case spam && referrerspam.IsSpamReferrer(event.Referrer):
+			droppedSpam++
+		case sampling && !sampledIn(event.UserID, event.StoredSampleRate()):
+			droppedSampled++
+		default:
+			kept = append(kept, event)
+		}
+	}
+
+	if droppedBots > 0 {
+		total := h.dropped.bots.Add(droppedBots)
+		log.Printf("🤖 Dropped %d bot events (%d since startup)", droppedBots, total)
+	}
+	if droppedSpam > 0 {
+		total := h.dropped.spam.Add(droppedSpam)
+		log.Printf("🚫 Dropped %d events with spam referrers (%d since startup)", droppedSpam, total)
+	}
+	if droppedSampled > 0 {
+		total := h.dropped.sampled.Add(droppedSampled)
+		log.Printf("🎲 Dropped %d events by sampling (%d since startup)", droppedSampled, total)
+	}
+	return kept
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	googlebot = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	chrome    = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+func TestTrackEventIngestionPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		dnt       string
+		userAgent string
+		referrer  string
+		stored    bool
+	}{
+		{name: "Stored by default", userAgent: chrome, stored: true},
+		{name: "Do Not Track", userAgent: chrome, dnt: "1"},
+		{name: "DNT 0 is tracked", userAgent: chrome, dnt: "0", stored: true},
+		{name: "DNT ignored with HONOR_DNT=0", env: map[string]string{"HONOR_DNT": "0"}, userAgent: chrome, dnt: "1", stored: true},
+		{name: "Bots stored by default", userAgent: googlebot, stored: true},
+		{name: "Bots dropped with DROP_BOTS", env: map[string]string{"DROP_BOTS": "1"}, userAgent: googlebot},
+		{name: "Humans kept with DROP_BOTS", env: map[string]string{"DROP_BOTS": "1"}, userAgent: chrome, stored: true},
+		{name: "Spam referrers stored by default", userAgent: chrome, referrer: "http://semalt.com/", stored: true},
+		{name: "Spam referrers dropped", env: map[string]string{"REFERRER_SPAM": "drop"}, userAgent: chrome, referrer: "http://semalt.com/"},
+		{name: "Real referrers kept", env: map[string]string{"REFERRER_SPAM": "drop"}, userAgent: chrome, referrer: "https://www.google.com/", stored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			if tt.stored {
+				mockService.EXPECT().TrackEvent(gomock.Any()).Return(nil).Times(1)
+			}
+
+			handler := NewEventHandler(mockService, nil)
+
+			body := `{"event_name":"page_view","user_id":"user1","user_agent":"` + tt.userAgent + `","referrer":"` + tt.referrer + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/track", strings.NewReader(body))
+			if tt.dnt != "" {
+				req.Header.Set("DNT", tt.dnt)
+			}
+			w := httptest.NewRecorder()
+
+			handler.TrackEvent(w, req)
+
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"ok"`) {
+				t.Errorf("Expected 200 ok, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTrackBatchIngestionPolicy(t *testing.T) {
+	body := `{"events":[
+		{"event_name":"page_view","user_id":"user1","user_agent":"` + chrome + `"},
+		{"event_name":"page_view","user_id":"crawler","user_agent":"` + googlebot + `"},
+		{"event_name":"click","user_id":"user1","user_agent":"` + chrome + `"}
+	]}`
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		dnt      bool
+		stored   []string // User ids of the stored events
+		expected int      // Dropped events in the response
+	}{
+		{name: "Stored by default", stored: []string{"user1", "crawler", "user1"}},
+		{name: "Do Not Track drops the batch", dnt: true, expected: 3},
+		{name: "DROP_BOTS drops only bots", env: map[string]string{"DROP_BOTS": "1"}, stored: []string{"user1", "user1"}, expected: 1},
+		{name: "SAMPLE_RATE drops whole visitors", env: map[string]string{"SAMPLE_RATE": "0.5"}, stored: []string{"crawler"}, expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			if len(tt.stored) > 0 {
+				mockService.EXPECT().
+					TrackEventBatch(gomock.Any()).
+					DoAndReturn(func(events []domain.Event) error {
+						if len(events) != len(tt.stored) {
+							t.Fatalf("Expected %d stored events, got %d", len(tt.stored), len(events))
+						}
+						for i, event := range events {
+							if event.UserID != tt.stored[i] {
+								t.Errorf("Event %d: expected user %s, got %s", i, tt.stored[i], event.UserID)
+							}
+							if event.SampleRate != sampleRate() {
+								t.Errorf("Event %d: expected sample rate %v, got %v", i, sampleRate(), event.SampleRate)
+							}
+						}
+						return nil
+					}).
+					Times(1)
+			}
+
+			handler := NewEventHandler(mockService, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/track/batch", strings.NewReader(body))
+			if tt.dnt {
+				req.Header.Set("DNT", "1")
+			}
+			w := httptest.NewRecorder()
+
+			handler.TrackBatchEvents(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				Total      int `json:"total"`
+				Successful int `json:"successful"`
+				Dropped    int `json:"dropped"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Total != 3 || response.Successful != 3 || response.Dropped != tt.expected {
+				t.Errorf("Unexpected response: %+v", response)
+			}
+		})
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected float64
+	}{
+		{"", 1},
+		{"0.1", 0.1},
+		{"1", 1},
+		{"0", 1},
+		{"-0.5", 1},
+		{"1.5", 1},
+		{"half", 1},
+	}
+	for _, tt := range tests {
+		t.Setenv("SAMPLE_RATE", tt.value)
+		if got := sampleRate(); got != tt.expected {
+			t.Errorf("SAMPLE_RATE=%q: expected %v, got %v", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestSampledIn(t *testing.T) {
+	const visitors = 10000
+	for _, rate := range []float64{0.01, 0.25, 0.5, 1} {
+		kept := 0
+		for i := 0; i < visitors; i++ {
+			userID := fmt.Sprintf("visitor-%d", i)
+			in := sampledIn(userID, rate)
+			if in != sampledIn(userID, rate) {
+				t.Fatalf("Expected the same choice for %s every time", userID)
+			}
+			// Visitors kept at a rate are kept at every higher rate
+			if in && !sampledIn(userID, math.Min(1, rate*2)) {
+				t.Errorf("Expected %s kept at %v to be kept at %v", userID, rate, rate*2)
+			}
+			if in {
+				kept++
+			}
+		}
+		if share := float64(kept) / visitors; math.Abs(share-rate) > 0.02 {
+			t.Errorf("Expected about %v of visitors kept, got %v", rate, share)
+		}
+	}
+}
+
+func TestApplyUserAgent(t *testing.T) {
+	iphone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1"
+
+	tests := []struct {
+		name     string
+		mode     string
+		event    domain.Event
+		expected [3]string // Browser, OS and device
+	}{
+		{name: "Fills empty fields", event: domain.Event{UserAgent: iphone}, expected: [3]string{"Safari", "iOS", "Mobile"}},
+		{name: "Keeps client values", event: domain.Event{UserAgent: iphone, Browser: "Chrome", Device: "Desktop"}, expected: [3]string{"Chrome", "iOS", "Desktop"}},
+		{name: "Always replaces client values", mode: "always", event: domain.Event{UserAgent: iphone, Browser: "Chrome", OS: "Windows", Device: "Desktop"}, expected: [3]string{"Safari", "iOS", "Mobile"}},
+		{name: "Always keeps values it cannot parse", mode: "always", event: domain.Event{UserAgent: "SomeClient/1.0", Browser: "Custom", OS: "Embedded"}, expected: [3]string{"Custom", "Embedded", "Desktop"}},
+		{name: "Off", mode: "off", event: domain.Event{UserAgent: iphone}, expected: [3]string{"", "", ""}},
+		{name: "No user agent", event: domain.Event{Browser: "Firefox"}, expected: [3]string{"Firefox", "", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("UA_PARSE", tt.mode)
+
+			event := tt.event
+			applyUserAgent(&event)
+			if got := [3]string{event.Browser, event.OS, event.Device}; got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestApplyScreenDevice(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		event    domain.Event
+		expected string
+	}{
+		{name: "Off by default", event: domain.Event{Device: "Desktop", ScreenWidth: 390}, expected: "Desktop"},
+		{name: "Mobile width", env: "1", event: domain.Event{Device: "Desktop", ScreenWidth: 390}, expected: "Mobile"},
+		{name: "Tablet width", env: "1", event: domain.Event{Device: "Mobile", ScreenWidth: 800}, expected: "Tablet"},
+		{name: "Desktop width", env: "1", event: domain.Event{Device: "Tablet", ScreenWidth: 1280}, expected: "Desktop"},
+		{name: "No width", env: "1", event: domain.Event{Device: "Mobile"}, expected: "Mobile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEVICE_FROM_SCREEN", tt.env)
+
+			event := tt.event
+			applyScreenDevice(&event)
+			if event.Device != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, event.Device)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MaxLanguageRanges is the most Accept-Language entries looked at, longer headers
+// are cut short rather than parsed in full
+const MaxLanguageRanges = 20
+
+// parseAcceptLanguage returns the primary language subtag, lowercased, of the
+// preferred language in an Accept-Language header: "en-US,en;q=0.9,ar;q=0.8" gives
+// "en". The entry with the highest quality wins, the first one on ties. Wildcards,
+// malformed tags and entries with q=0 are skipped, and an empty or unusable
+// header gives "". A bare tag such as "pt-BR" is accepted too.
+func parseAcceptLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for i, entry := range strings.Split(header, ",") {
+		if i == MaxLanguageRanges {
+			break
+		}
+
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		language := primarySubtag(strings.TrimSpace(tag))
+		if language == "" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = language, q
+		}
+	}
+	return best
+}
+
+// primarySubtag returns the language part of a tag such as "en-US" or "zh_Hant",
+// or "" when it is not 2 to 8 ASCII letters
+func primarySubtag(tag string) string {
+	language, _, _ := strings.Cut(tag, "-")
+	language, _, _ = strings.Cut(language, "_")
+	if len(language) < 2 || len(language) > 8 {
+		return ""
+	}
+	for _, c := range language {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return ""
+		}
+	}
+	return strings.ToLower(language)
+}
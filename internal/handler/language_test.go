@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"Empty", "", ""},
+		{"Single language", "fr", "fr"},
+		{"Region subtag", "en-US", "en"},
+		{"Quality values", "en-US,en;q=0.9", "en"},
+		{"Highest quality wins", "de;q=0.5, ar;q=0.9, en;q=0.7", "ar"},
+		{"First wins ties", "es,pt", "es"},
+		{"Implicit quality is 1", "fr;q=0.8,ja", "ja"},
+		{"Uppercase", "PT-BR", "pt"},
+		{"Underscore separator", "zh_Hant_TW", "zh"},
+		{"Wildcard skipped", "*,nl;q=0.5", "nl"},
+		{"Only wildcard", "*", ""},
+		{"Zero quality skipped", "en;q=0,sv;q=0.1", "sv"},
+		{"Invalid quality skipped", "en;q=high,it;q=0.3", "it"},
+		{"Out of range quality skipped", "en;q=2,it;q=0.3", "it"},
+		{"Malformed tag", "e1-US", ""},
+		{"Spaces", "  en-GB ; q=0.8 ,  de ; q=0.9 ", "de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAcceptLanguage(tt.header); got != tt.expected {
+				t.Errorf("parseAcceptLanguage(%q) = %q, expected %q", tt.header, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTrackEventLanguage(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		body           string
+		expected       string
+	}{
+		{"From header", "en-US,en;q=0.9", `{"event_name":"page_view"}`, "en"},
+		{"Highest quality", "de;q=0.4,ar;q=0.8", `{"event_name":"page_view"}`, "ar"},
+		{"Sent by the client", "fr", `{"event_name":"page_view","language":"pt-BR"}`, "pt"},
+		{"No header", "", `{"event_name":"page_view"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			mockService.EXPECT().TrackEvent(gomock.Any()).DoAndReturn(func(event domain.Event) error {
+				if event.Language != tt.expected {
+					t.Errorf("Expected language %q, got %q", tt.expected, event.Language)
+				}
+				return nil
+			}).Times(1)
+
+			// The batch endpoint applies the request's header to every event
+			mockService.EXPECT().TrackEventBatch(gomock.Any()).DoAndReturn(func(events []domain.Event) error {
+				for _, event := range events {
+					if event.Language != tt.expected {
+						t.Errorf("Expected batch language %q, got %q", tt.expected, event.Language)
+					}
+				}
+				return nil
+			}).Times(1)
+
+			handler := NewEventHandler(mockService, nil)
+			for _, req := range []*http.Request{
+				httptest.NewRequest(http.MethodPost, "/api/track", strings.NewReader(tt.body)),
+				httptest.NewRequest(http.MethodPost, "/api/track/batch", strings.NewReader(`{"events":[`+tt.body+`,`+tt.body+`]}`)),
+			} {
+				req.Header.Set("User-Agent", chrome)
+				if tt.acceptLanguage != "" {
+					req.Header.Set("Accept-Language", tt.acceptLanguage)
+				}
+				w := httptest.NewRecorder()
+				if req.URL.Path == "/api/track" {
+					handler.TrackEvent(w, req)
+				} else {
+					handler.TrackBatchEvents(w, req)
+				}
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected status 200 from %s, got %d: %s", req.URL.Path, w.Code, w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMaxLiveStreams caps concurrent /api/stream/live connections unless
+	// LIVE_STREAM_MAX is set; every stream runs its own queries on each tick
+	DefaultMaxLiveStreams = 50
+	// LiveStreamInterval is how often a live stream pushes fresh stats
+	LiveStreamInterval = 5 * time.Second
+	// LiveStreamEvents is the number of latest events sent with each update
+	LiveStreamEvents = 10
+	// liveStreamWindow is the online-users window in minutes, as in GetOnlineUsers
+	liveStreamWindow = 5
+)
+
+// maxLiveStreams reads LIVE_STREAM_MAX, falling back to DefaultMaxLiveStreams
+func maxLiveStreams() int {
+	if n, err := strconv.Atoi(os.Getenv("LIVE_STREAM_MAX")); err == nil && n >= 0 {
+		return n
+	}
+	return DefaultMaxLiveStreams
+}
+
+// LiveStream pushes online-user counts and the latest events with Server-Sent Events
+// Endpoint: GET /api/stream/live
+func (h *EventHandler) LiveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Streaming unsupported")
+		return
+	}
+
+	// Take a stream slot without waiting; a full server tells the client to retry later
+	select {
+	case h.liveStreams <- struct{}{}:
+		defer func() { <-h.liveStreams }()
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.liveInterval.Seconds())+1))
+		writeError(w, http.StatusServiceUnavailable, ErrCodeBusy, "Too many live streams")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(h.liveInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.writeLiveUpdate(w, r); err != nil {
+			return // Client went away
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.shutdown:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeLiveUpdate sends one "live" event, or an "error" event if the stats could not
+// be computed; the stream carries on either way. It only fails when the write does.
+func (h *EventHandler) writeLiveUpdate(w http.ResponseWriter, r *http.Request) error {
+	name := "live"
+	var payload interface{}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	online, err := h.service.GetOnlineUsers(ctx, liveStreamWindow)
+	if err == nil {
+		var events interface{}
+		events, err = h.service.GetRecentEvents(ctx, LiveStreamEvents)
+		if err == nil {
+			online["events"] = events
+			payload = online
+		}
+	}
+	if err != nil {
+		log.Printf("Error computing live stats: %v", err)
+		name = "error"
+		_, detail := queryErrorDetail(ctx)
+		payload = map[string]errorDetail{"error": detail}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
+
+// EventStream forwards tracked events to the client as they arrive, after enrichment,
+// so an integration can be checked in real time. Events are not persisted yet when
+// they are sent, and a client that cannot keep up misses events.
+// Endpoint: GET /api/stream/events?project=my-site
+func (h *EventHandler) EventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Streaming unsupported")
+		return
+	}
+
+	// Shares the LIVE_STREAM_MAX slots with LiveStream
+	select {
+	case h.liveStreams <- struct{}{}:
+		defer func() { <-h.liveStreams }()
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.liveInterval.Seconds())+1))
+		writeError(w, http.StatusServiceUnavailable, ErrCodeBusy, "Too many live streams")
+		return
+	}
+
+	events, unsubscribe := h.service.SubscribeEvents(r.URL.Query().Get("project"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comments keep idle connections open through proxies
+	ticker := time.NewTicker(h.liveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.shutdown:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Error encoding streamed event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: event\ndata: %s\n\n", data); err != nil {
+				return // Client went away
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// CloseStreams ends every open live stream so a graceful server shutdown does not
+// wait on them. Register it with http.Server.RegisterOnShutdown.
+func (h *EventHandler) CloseStreams() {
+	h.shutdownOnce.Do(func() { close(h.shutdown) })
+}
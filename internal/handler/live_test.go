@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// readSSEEvents reads n server-sent events from the stream, returning their names and data
+func readSSEEvents(t *testing.T, reader *bufio.Reader, n int) (names, data []string) {
+	t.Helper()
+	for len(data) < n {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read stream after %d events: %v", len(data), err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			names = append(names, strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return names, data
+}
+
+func TestLiveStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockEventService(ctrl)
+	mockService.EXPECT().
+		GetOnlineUsers(gomock.Any(), 5).
+		DoAndReturn(func(context.Context, int) (map[string]interface{}, error) {
+			return map[string]interface{}{"online_users": 3, "active_sessions": 4}, nil
+		}).
+		MinTimes(2)
+	gomock.InOrder(
+		mockService.EXPECT().GetRecentEvents(gomock.Any(), LiveStreamEvents).Return([]domain.Event{{ID: 1, EventName: "page_view"}}, nil),
+		mockService.EXPECT().GetRecentEvents(gomock.Any(), LiveStreamEvents).Return(nil, errors.New("database error")),
+		mockService.EXPECT().GetRecentEvents(gomock.Any(), LiveStreamEvents).Return([]domain.Event{}, nil).AnyTimes(),
+	)
+
+	handler := NewEventHandler(mockService, nil)
+	handler.liveInterval = 10 * time.Millisecond
+
+	server := httptest.NewServer(http.HandlerFunc(handler.LiveStream))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			t.Logf("Warning: failed to close body: %v", err)
+		}
+	}()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %q", ct)
+	}
+
+	names, data := readSSEEvents(t, bufio.NewReader(resp.Body), 3)
+	if names[0] != "live" || !strings.Contains(data[0], `"online_users":3`) || !strings.Contains(data[0], `"event_name":"page_view"`) {
+		t.Errorf("Unexpected first update: %s %s", names[0], data[0])
+	}
+	if names[1] != "error" {
+		t.Errorf("Expected failed update to be sent as an error event, got %s", names[1])
+	}
+	if names[2] != "live" {
+		t.Errorf("Expected stream to recover after an error, got %s", names[2])
+	}
+
+	// Disconnecting must free the stream slot
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(handler.liveStreams) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected stream slot to be released after client disconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLiveStreamLimit(t *testing.T) {
+	if err := os.Setenv("LIVE_STREAM_MAX", "1"); err != nil {
+		t.Fatalf("Failed to set LIVE_STREAM_MAX env: %v", err)
+	}
+	defer func() {
+		if err := os.Unsetenv("LIVE_STREAM_MAX"); err != nil {
+			t.Logf("Warning: failed to unset LIVE_STREAM_MAX env: %v", err)
+		}
+	}()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler := NewEventHandler(mocks.NewMockEventService(ctrl), nil)
+	handler.liveStreams <- struct{}{} // The only slot is taken
+
+	w := httptest.NewRecorder()
+	handler.LiveStream(w, httptest.NewRequest(http.MethodGet, "/api/stream/live", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+}
+
+func TestCloseStreams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockEventService(ctrl)
+	mockService.EXPECT().GetOnlineUsers(gomock.Any(), gomock.Any()).Return(map[string]interface{}{}, nil).AnyTimes()
+	mockService.EXPECT().GetRecentEvents(gomock.Any(), gomock.Any()).Return([]domain.Event{}, nil).AnyTimes()
+
+	handler := NewEventHandler(mockService, nil)
+	handler.liveInterval = time.Hour
+
+	done := make(chan struct{})
+	go func() {
+		handler.LiveStream(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stream/live", nil))
+		close(done)
+	}()
+
+	handler.CloseStreams()
+	handler.CloseStreams() // Safe to call twice
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected LiveStream to return after CloseStreams")
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	events := make(chan domain.Event, 1)
+	unsubscribed := make(chan struct{})
+	mockService := mocks.NewMockEventService(ctrl)
+	mockService.EXPECT().SubscribeEvents("my-site").Return((<-chan domain.Event)(events), func() { close(unsubscribed) })
+
+	handler := NewEventHandler(mockService, nil)
+	server := httptest.NewServer(http.HandlerFunc(handler.EventStream))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?project=my-site", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			t.Logf("Warning: failed to close body: %v", err)
+		}
+	}()
+
+	events <- domain.Event{EventName: "signup", ProjectID: "my-site", Channel: "Organic", IsBot: true}
+	names, data := readSSEEvents(t, bufio.NewReader(resp.Body), 1)
+	if names[0] != "event" {
+		t.Errorf("Expected an event message, got %s", names[0])
+	}
+	for _, want := range []string{`"event_name":"signup"`, `"channel":"Organic"`, `"is_bot":true`} {
+		if !strings.Contains(data[0], want) {
+			t.Errorf("Expected %s in %s", want, data[0])
+		}
+	}
+
+	// Disconnecting must end the subscription
+	cancel()
+	select {
+	case <-unsubscribed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected subscription to end after client disconnect")
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mohamedelhefni/siraaj/internal/openapi"
+)
+
+// OpenAPISpec serves spec as JSON. The document is encoded once, it does not
+// change while the server runs.
+// Endpoint: GET /api/openapi.json
+func OpenAPISpec(spec *openapi.Document) http.HandlerFunc {
+	body, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		// The spec is built from Go values, so this is a programming error
+		log.Fatalf("Error encoding OpenAPI spec: %v", err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body); err != nil {
+			log.Printf("Error writing OpenAPI spec: %v", err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/openapi"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	spec := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info:    openapi.Info{Title: "Test", Version: "1.0.0"},
+		Paths: map[string]*openapi.PathItem{
+			"/api/health": {Get: &openapi.Operation{OperationID: "getHealth", Summary: "Health", Responses: map[string]*openapi.Response{"200": {Description: "OK"}}}},
+		},
+	}
+	handler := OpenAPISpec(spec)
+
+	tests := []struct {
+		name           string
+		method         string
+		expectedStatus int
+	}{
+		{"GET", http.MethodGet, http.StatusOK},
+		{"Wrong method", http.MethodPost, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/openapi.json", nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Expected a JSON content type, got %q", got)
+			}
+			var served openapi.Document
+			if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+				t.Fatalf("Failed to decode spec: %v", err)
+			}
+			if served.OpenAPI != openapi.Version || served.Paths["/api/health"].Get.OperationID != "getHealth" {
+				t.Errorf("Unexpected spec served: %+v", served)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// anonymizeIP zeroes the host part of ip: the last octet of an IPv4 address and
+// the last 80 bits of an IPv6 address. Anything that does not parse as an IP is
+// dropped rather than stored raw.
+func anonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// dailySalt is a random salt that is replaced every UTC day. Old salts are never
+// kept, so hashes from different days (or before a restart) cannot be linked.
+type dailySalt struct {
+	mu   sync.Mutex
+	day  string
+	salt []byte
+}
+
+// hash returns prefix followed by value hashed with the salt of now's UTC day
+func (s *dailySalt) hash(prefix, value string, now time.Time) string {
+	day := now.UTC().Format("2006-01-02")
+
+	s.mu.Lock()
+	if s.day != day {
+		s.salt = make([]byte, 32)
+		if _, err := rand.Read(s.salt); err != nil {
+			panic("handler: failed to generate PII salt: " + err.Error())
+		}
+		s.day = day
+	}
+	mac := hmac.New(sha256.New, s.salt)
+	s.mu.Unlock()
+
+	mac.Write([]byte(value))
+	return prefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// deriveVisitorID returns a cookieless visitor id for an event sent without a
+// user id: a hash of its IP, user agent and site with the daily salt. The same
+// browser on the same site gets the same id until UTC midnight and an unrelated
+// one after, so visitors cannot be followed across days.
+func (h *EventHandler) deriveVisitorID(event *domain.Event, now time.Time) string {
+	site := extractDomainFromURL(event.URL)
+	if site == "" {
+		site = event.ProjectID
+	}
+	return h.salt.hash("v_", event.IP+"|"+event.UserAgent+"|"+site, now)
+}
+
+// anonymizeEvent applies the privacy settings to an enriched event, after
+// geolocation and session synthesis have used the raw values. ANONYMIZE_IP=1
+// truncates the IP; HASH_PII=1 replaces the user id and IP with daily salted
+// hashes, so a visitor is only recognizable within one UTC day.
+func (h *EventHandler) anonymizeEvent(event *domain.Event, now time.Time) {
+	if os.Getenv("ANONYMIZE_IP") == "1" && event.IP != "" {
+		event.IP = anonymizeIP(event.IP)
+	}
+	if os.Getenv("HASH_PII") == "1" {
+		if event.UserID != "" {
+			event.UserID = h.salt.hash("h_", event.UserID, now)
+		}
+		if event.IP != "" {
+			event.IP = h.salt.hash("h_", event.IP, now)
+		}
+	}
+}
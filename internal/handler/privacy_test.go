@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"203.0.113.195", "203.0.113.0"},
+		{"10.1.2.3", "10.1.2.0"},
+		{"255.255.255.255", "255.255.255.0"},
+		{"::ffff:198.51.100.7", "198.51.100.0"},
+		{"2001:db8:85a3:8d3:1319:8a2e:370:7348", "2001:db8:85a3::"},
+		{"2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", "2001:db8:ffff::"},
+		{"fe80::1", "fe80::"},
+		{"::1", "::"},
+		{"not-an-ip", ""},
+		{"203.0.113", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := anonymizeIP(tt.ip); got != tt.expected {
+				t.Errorf("anonymizeIP(%q) = %q, expected %q", tt.ip, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDailySalt(t *testing.T) {
+	salt := &dailySalt{}
+	day := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	first := salt.hash("h_", "user1", day)
+	if !strings.HasPrefix(first, "h_") || strings.Contains(first, "user1") {
+		t.Errorf("Expected an opaque hash, got %q", first)
+	}
+	if again := salt.hash("h_", "user1", day.Add(13*time.Hour)); again != first {
+		t.Errorf("Expected the same hash within a UTC day, got %q and %q", first, again)
+	}
+	if other := salt.hash("h_", "user2", day); other == first {
+		t.Error("Expected different values to hash differently")
+	}
+	if next := salt.hash("h_", "user1", day.AddDate(0, 0, 1)); next == first {
+		t.Error("Expected the salt to rotate the next day")
+	}
+}
+
+func TestEnrichEventPrivacy(t *testing.T) {
+	handler := NewEventHandler(nil, nil)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		event := domain.Event{EventName: "page_view", UserID: "user1"}
+		handler.enrichEvent(&event, "203.0.113.195", now)
+		if event.IP != "203.0.113.195" || event.UserID != "user1" {
+			t.Errorf("Expected raw values without privacy settings, got %q and %q", event.IP, event.UserID)
+		}
+	})
+
+	t.Run("Anonymize IP", func(t *testing.T) {
+		t.Setenv("ANONYMIZE_IP", "1")
+		event := domain.Event{EventName: "page_view", UserID: "user1"}
+		handler.enrichEvent(&event, "2001:db8:85a3:8d3:1319:8a2e:370:7348", now)
+		if event.IP != "2001:db8:85a3::" || event.UserID != "user1" {
+			t.Errorf("Expected only the IP to be truncated, got %q and %q", event.IP, event.UserID)
+		}
+	})
+
+	t.Run("Hash PII", func(t *testing.T) {
+		t.Setenv("HASH_PII", "1")
+		t.Setenv("SESSION_ID_FALLBACK", "synthesize")
+		event := domain.Event{EventName: "page_view", UserID: "user1"}
+		handler.enrichEvent(&event, "203.0.113.195", now)
+
+		raw := domain.Event{UserID: "user1", IP: "203.0.113.195", Timestamp: now}
+		if event.SessionID != synthesizeSessionID(&raw) {
+			t.Errorf("Expected the session id to be derived from the raw values, got %q", event.SessionID)
+		}
+		if !strings.HasPrefix(event.UserID, "h_") || !strings.HasPrefix(event.IP, "h_") {
+			t.Errorf("Expected hashed user id and IP, got %q and %q", event.UserID, event.IP)
+		}
+
+		second := domain.Event{EventName: "click", UserID: "user1"}
+		handler.enrichEvent(&second, "203.0.113.195", now.Add(time.Hour))
+		if second.UserID != event.UserID {
+			t.Errorf("Expected the same visitor to hash the same within a day, got %q and %q", event.UserID, second.UserID)
+		}
+	})
+}
+
+func TestDeriveVisitorID(t *testing.T) {
+	handler := NewEventHandler(nil, nil)
+	day := time.Date(2024, 1, 15, 0, 30, 0, 0, time.UTC)
+
+	visit := func(ip, url string, now time.Time) string {
+		event := domain.Event{EventName: "page_view", UserAgent: chrome, URL: url}
+		handler.enrichEvent(&event, ip, now)
+		return event.UserID
+	}
+
+	morning := visit("203.0.113.7", "https://example.com/", day)
+	if !strings.HasPrefix(morning, "v_") {
+		t.Fatalf("Expected a derived visitor id, got %q", morning)
+	}
+	if evening := visit("203.0.113.7", "https://example.com/pricing", day.Add(23*time.Hour)); evening != morning {
+		t.Errorf("Expected the same visitor within a day, got %q and %q", morning, evening)
+	}
+	if next := visit("203.0.113.7", "https://example.com/", day.AddDate(0, 0, 1)); next == morning {
+		t.Error("Expected a different visitor id after midnight")
+	}
+	if other := visit("198.51.100.2", "https://example.com/", day); other == morning {
+		t.Error("Expected a different visitor id for a different IP")
+	}
+	if site := visit("203.0.113.7", "https://other.example.org/", day); site == morning {
+		t.Error("Expected a different visitor id on a different site")
+	}
+
+	event := domain.Event{EventName: "page_view", UserID: "user1", UserAgent: chrome}
+	handler.enrichEvent(&event, "203.0.113.7", day)
+	if event.UserID != "user1" {
+		t.Errorf("Expected a client user id to be kept, got %q", event.UserID)
+	}
+}
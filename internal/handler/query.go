@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DefaultQueryTimeout is how long the queries of a request may run unless
+// QUERY_TIMEOUT says otherwise
+const DefaultQueryTimeout = 30 * time.Second
+
+// queryTimeout reads QUERY_TIMEOUT, falling back to DefaultQueryTimeout for missing
+// or invalid values. Zero turns the timeout off.
+func queryTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("QUERY_TIMEOUT")); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultQueryTimeout
+}
+
+// queryContext returns the context to run the queries of r with: canceled when the
+// client goes away, and once the query timeout has passed. Call cancel when done.
+func queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := queryTimeout()
+	if timeout == 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// writeQueryError answers a request whose queries failed: 504 when they ran out
+// of time, 500 otherwise. The context is checked rather than the query error,
+// since the database may report an interrupted query with an error of its own.
+func writeQueryError(ctx context.Context, w http.ResponseWriter) {
+	status, detail := queryErrorDetail(ctx)
+	writeError(w, status, detail.Code, detail.Message)
+}
+
+// queryErrorDetail returns the status and error of failed queries, see writeQueryError
+func queryErrorDetail(ctx context.Context) (int, errorDetail) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, errorDetail{
+			Code:    ErrCodeTimeout,
+			Message: fmt.Sprintf("query took longer than %s; narrow the date range or filters", queryTimeout()),
+		}
+	}
+	return http.StatusInternalServerError, errorDetail{Code: ErrCodeInternal, Message: "Internal server error"}
+}
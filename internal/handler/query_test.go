@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", DefaultQueryTimeout},
+		{"5s", 5 * time.Second},
+		{"0", 0},
+		{"-1s", DefaultQueryTimeout},
+		{"soon", DefaultQueryTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("QUERY_TIMEOUT", tt.value)
+		if got := queryTimeout(); got != tt.expected {
+			t.Errorf("QUERY_TIMEOUT=%q: expected %s, got %s", tt.value, tt.expected, got)
+		}
+	}
+}
+
+// waitForContext stands in for a query that runs until its context ends, as the
+// database does when it interrupts a query
+func waitForContext(ctx context.Context, _, _ time.Time, _ map[string]string) (*domain.TopStatsResult, error) {
+	<-ctx.Done()
+	return nil, errors.New("INTERRUPT Error: Interrupted!")
+}
+
+func TestQueriesTimeOut(t *testing.T) {
+	tests := []struct {
+		name           string
+		timeout        string
+		setupMock      func(*mocks.MockEventService)
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:    "Query outlives the timeout",
+			timeout: "20ms",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetTopStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(waitForContext)
+			},
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedCode:   ErrCodeTimeout,
+		},
+		{
+			name:    "Query fails within the timeout",
+			timeout: "1m",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetTopStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+		{
+			name:    "Query finishes within the timeout",
+			timeout: "1m",
+			setupMock: func(m *mocks.MockEventService) {
+				m.EXPECT().GetTopStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, _, _ time.Time, _ map[string]string) (*domain.TopStatsResult, error) {
+						if _, ok := ctx.Deadline(); !ok {
+							t.Error("Expected the query context to have a deadline")
+						}
+						return &domain.TopStatsResult{}, nil
+					})
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("QUERY_TIMEOUT", tt.timeout)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			tt.setupMock(mockService)
+			mockService.EXPECT().DataAsOf().Return(time.Now()).AnyTimes()
+
+			w := httptest.NewRecorder()
+			NewEventHandler(mockService, nil).GetTopStats(w, httptest.NewRequest(http.MethodGet, "/api/stats/overview", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedCode == "" {
+				return
+			}
+			var body struct {
+				Error errorDetail `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode error: %v", err)
+			}
+			if body.Error.Code != tt.expectedCode {
+				t.Errorf("Expected code %s, got %s (%s)", tt.expectedCode, body.Error.Code, body.Error.Message)
+			}
+		})
+	}
+}
+
+func TestQueriesStopWhenClientGoesAway(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockEventService(ctrl)
+	canceled := make(chan error, 1)
+	mockService.EXPECT().GetTopStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, start, end time.Time, filters map[string]string) (*domain.TopStatsResult, error) {
+			result, err := waitForContext(ctx, start, end, filters)
+			canceled <- ctx.Err()
+			return result, err
+		})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	r := httptest.NewRequest(http.MethodGet, "/api/stats/overview", nil).WithContext(ctx)
+	NewEventHandler(mockService, nil).GetTopStats(httptest.NewRecorder(), r)
+
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the query to be canceled with the request, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// jsonArrayStream writes a JSON array to the response one element at a time and
+// flushes after each, so clients get the first buckets of a large breakdown
+// without waiting for the whole result to be built in memory.
+type jsonArrayStream struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	flusher http.Flusher
+	started bool
+}
+
+func newJSONArrayStream(w http.ResponseWriter) *jsonArrayStream {
+	flusher, _ := w.(http.Flusher)
+	return &jsonArrayStream{w: w, enc: json.NewEncoder(w), flusher: flusher}
+}
+
+// Write encodes v as the next array element. The status line and headers are sent
+// with the first element, after which errors can no longer change the status.
+func (s *jsonArrayStream) Write(v interface{}) error {
+	sep := ","
+	if !s.started {
+		s.w.Header().Set("Content-Type", "application/json")
+		sep = "["
+		s.started = true
+	}
+	if _, err := s.w.Write([]byte(sep)); err != nil {
+		return err
+	}
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+// Close ends the array. If err is set before anything was written the response is
+// a JSON error, 504 when ctx ran out of time and 500 otherwise; once streaming has
+// started the array is truncated with a final {"error": {...}, "truncated": true}
+// element so clients can tell it is incomplete.
+func (s *jsonArrayStream) Close(ctx context.Context, err error) {
+	if err != nil {
+		log.Printf("Error streaming response: %v", err)
+		status, detail := queryErrorDetail(ctx)
+		if !s.started {
+			writeError(s.w, status, detail.Code, detail.Message)
+			return
+		}
+		if err := s.Write(map[string]interface{}{
+			"error":     detail,
+			"truncated": true,
+		}); err != nil {
+			return // Client went away, nothing more to send
+		}
+	}
+
+	if !s.started {
+		s.w.Header().Set("Content-Type", "application/json")
+		if _, err := s.w.Write([]byte("[")); err != nil {
+			return
+		}
+	}
+	if _, err := s.w.Write([]byte("]\n")); err != nil {
+		log.Printf("Error ending streamed response: %v", err)
+	}
+}
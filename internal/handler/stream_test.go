@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestGetChannelLandingPagesHandlerStreaming(t *testing.T) {
+	bucket := func(channel string) map[string]interface{} {
+		return map[string]interface{}{
+			"channel":       channel,
+			"sessions":      10,
+			"landing_pages": []map[string]interface{}{{"url": "/", "count": 10}},
+		}
+	}
+
+	t.Run("Writes each bucket as it is computed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		w := httptest.NewRecorder()
+		mockService := mocks.NewMockEventService(ctrl)
+		mockService.EXPECT().
+			StreamChannelLandingPages(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string, emit func(map[string]interface{}) error) error {
+				for i, channel := range []string{"Direct", "Organic", "Social"} {
+					if err := emit(bucket(channel)); err != nil {
+						return err
+					}
+					// The bucket must be on the wire before the next one is computed
+					if !w.Flushed {
+						t.Errorf("Expected response to be flushed after bucket %d", i+1)
+					}
+					if got := strings.Count(w.Body.String(), `"channel"`); got != i+1 {
+						t.Errorf("Expected %d buckets written so far, got %d", i+1, got)
+					}
+				}
+				return nil
+			}).
+			Times(1)
+
+		handler := NewEventHandler(mockService, nil)
+		handler.GetChannelLandingPagesHandler(w, httptest.NewRequest(http.MethodGet, "/api/stats/channel-landings", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var resp []map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode streamed response: %v", err)
+		}
+		if len(resp) != 3 || resp[2]["channel"] != "Social" {
+			t.Errorf("Expected 3 buckets ending with Social, got %v", resp)
+		}
+	})
+
+	t.Run("Error mid-stream truncates with marker", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockService := mocks.NewMockEventService(ctrl)
+		mockService.EXPECT().
+			StreamChannelLandingPages(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, start, end time.Time, limit int, filters map[string]string, emit func(map[string]interface{}) error) error {
+				if err := emit(bucket("Direct")); err != nil {
+					return err
+				}
+				return errors.New("connection lost")
+			}).
+			Times(1)
+
+		w := httptest.NewRecorder()
+		handler := NewEventHandler(mockService, nil)
+		handler.GetChannelLandingPagesHandler(w, httptest.NewRequest(http.MethodGet, "/api/stats/channel-landings", nil))
+
+		var resp []map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Expected truncated response to still be valid JSON: %v", err)
+		}
+		if len(resp) != 2 {
+			t.Fatalf("Expected 1 bucket plus error marker, got %v", resp)
+		}
+		if resp[1]["truncated"] != true || resp[1]["error"] == nil {
+			t.Errorf("Expected final element to be an error marker, got %v", resp[1])
+		}
+	})
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Error before first bucket", errors.New("query failed"), http.StatusInternalServerError, `{"error":{"code":"internal_error","message":"Internal server error"}}` + "\n"},
+		{"No buckets", nil, http.StatusOK, "[]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			mockService.EXPECT().
+				StreamChannelLandingPages(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(tt.err).
+				Times(1)
+
+			w := httptest.NewRecorder()
+			handler := NewEventHandler(mockService, nil)
+			handler.GetChannelLandingPagesHandler(w, httptest.NewRequest(http.MethodGet, "/api/stats/channel-landings", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Body.String(); got != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TrackerMaxAge is how long browsers and CDNs may cache the tracker before
+// revalidating it. Sites load it from an unversioned URL, so upgrades reach them
+// within this time.
+const TrackerMaxAge = time.Hour
+
+//go:embed tracker.js
+var trackerScript []byte
+
+// trackerETag changes with the embedded script, so a new release is fetched on the
+// first revalidation
+var trackerETag = func() string {
+	sum := sha256.Sum256(trackerScript)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}()
+
+// TrackerScript serves the embedded tracking snippet. Conditional requests are
+// answered with 304 when the script has not changed.
+// Endpoint: GET /siraaj.js
+func TrackerScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(TrackerMaxAge.Seconds())))
+	w.Header().Set("ETag", trackerETag)
+	// Sites on other origins load the script, see Cross-Origin-Resource-Policy
+	w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+	http.ServeContent(w, r, "siraaj.js", time.Time{}, bytes.NewReader(trackerScript))
+}
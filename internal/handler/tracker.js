@@ -0,0 +1,131 @@
+/*
+ * Siraaj tracker, served by the server at /siraaj.js.
+ *
+ *   <script defer src="https://analytics.example.com/siraaj.js" data-project="my-site"></script>
+ *
+ * Page views are tracked on load and on history navigation, custom events with
+ * siraaj.track("signup"). Events are sent to /api/track/batch in batches. Nothing is
+ * tracked when the browser sends Do Not Track or Global Privacy Control.
+ *
+ * Attributes of the script tag:
+ *   data-project  project id of the events
+ *   data-api      server to send to, the script's own origin by default
+ *   data-auto     "false" to track page views only through siraaj.pageview()
+ */
+(function () {
+  "use strict";
+
+  var script = document.currentScript;
+  if (!script || window.siraaj) return;
+
+  var api = (script.getAttribute("data-api") || new URL(script.src).origin).replace(/\/$/, "");
+  var project = script.getAttribute("data-project") || "";
+  var auto = script.getAttribute("data-auto") !== "false";
+
+  var BATCH_SIZE = 20;
+  var FLUSH_DELAY = 2000;
+  var SESSION_TIMEOUT = 30 * 60 * 1000;
+
+  var dnt = navigator.doNotTrack || window.doNotTrack || navigator.msDoNotTrack;
+  var disabled = dnt === "1" || dnt === "yes" || navigator.globalPrivacyControl === true;
+
+  var queue = [];
+  var timer = null;
+  var lastURL = null;
+
+  // Sessions live in sessionStorage and end after 30 idle minutes. The visitor is
+  // left to the server, which derives a cookieless id.
+  function sessionID() {
+    var now = Date.now();
+    var id, seen;
+    try {
+      id = sessionStorage.getItem("siraaj_session");
+      seen = parseInt(sessionStorage.getItem("siraaj_seen"), 10);
+    } catch (e) {}
+    if (!id || !seen || now - seen > SESSION_TIMEOUT) {
+      id = now.toString(36) + Math.random().toString(36).slice(2, 10);
+    }
+    try {
+      sessionStorage.setItem("siraaj_session", id);
+      sessionStorage.setItem("siraaj_seen", String(now));
+    } catch (e) {}
+    return id;
+  }
+
+  function send(events, keepalive) {
+    fetch(api + "/api/track/batch", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ events: events }),
+      keepalive: keepalive,
+      credentials: "omit"
+    }).catch(function () {});
+  }
+
+  // flush sends the queue. Leaving the page uses keepalive requests, which the
+  // browser finishes after the page is gone.
+  function flush(leaving) {
+    clearTimeout(timer);
+    timer = null;
+    while (queue.length) {
+      send(queue.splice(0, BATCH_SIZE), !!leaving);
+    }
+  }
+
+  // track queues an event. Page views after a history navigation pass the previous
+  // URL as their referrer.
+  function track(name, referrer) {
+    if (disabled || !name) return;
+    queue.push({
+      event_name: String(name),
+      timestamp: new Date().toISOString(),
+      session_id: sessionID(),
+      url: location.href,
+      referrer: referrer || document.referrer,
+      screen_width: screen.width,
+      screen_height: screen.height,
+      language: navigator.language,
+      project_id: project
+    });
+    if (queue.length >= BATCH_SIZE) {
+      flush(false);
+    } else if (!timer) {
+      timer = setTimeout(flush, FLUSH_DELAY);
+    }
+  }
+
+  function pageview() {
+    if (location.href === lastURL) return;
+    var previous = lastURL;
+    lastURL = location.href;
+    track("page_view", previous);
+  }
+
+  window.siraaj = {
+    track: function (name) {
+      track(name);
+    },
+    pageview: pageview,
+    flush: function () {
+      flush(false);
+    }
+  };
+
+  document.addEventListener("visibilitychange", function () {
+    if (document.visibilityState === "hidden") flush(true);
+  });
+  window.addEventListener("pagehide", function () {
+    flush(true);
+  });
+
+  if (auto) {
+    // Single page apps change the URL through the history API
+    var pushState = history.pushState;
+    history.pushState = function () {
+      pushState.apply(this, arguments);
+      pageview();
+    };
+    window.addEventListener("popstate", pageview);
+    pageview();
+  }
+})();
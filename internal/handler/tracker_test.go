@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrackerScript(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		ifNoneMatch    string
+		expectedStatus int
+		expectedBody   bool
+	}{
+		{"GET", http.MethodGet, "", http.StatusOK, true},
+		{"HEAD", http.MethodHead, "", http.StatusOK, false},
+		{"Unchanged", http.MethodGet, trackerETag, http.StatusNotModified, false},
+		{"Changed", http.MethodGet, `"0000"`, http.StatusOK, true},
+		{"Wrong method", http.MethodPost, "", http.StatusMethodNotAllowed, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/siraaj.js", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+
+			TrackerScript(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus == http.StatusMethodNotAllowed {
+				return
+			}
+
+			// 304 responses leave the content headers out
+			if got := w.Header().Get("Content-Type"); tt.expectedStatus == http.StatusOK && got != "text/javascript; charset=utf-8" {
+				t.Errorf("Expected a JavaScript content type, got %q", got)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+				t.Errorf("Expected the script to be cacheable for an hour, got %q", got)
+			}
+			if got := w.Header().Get("ETag"); got != trackerETag {
+				t.Errorf("Expected ETag %s, got %q", trackerETag, got)
+			}
+			if tt.expectedBody && !bytes.Equal(w.Body.Bytes(), trackerScript) {
+				t.Errorf("Expected the embedded script, got %d bytes", w.Body.Len())
+			}
+			if !tt.expectedBody && w.Body.Len() != 0 {
+				t.Errorf("Expected no body, got %d bytes", w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestTrackerScriptContent(t *testing.T) {
+	// The tracker and the batch endpoint must agree on the path and fields
+	for _, want := range []string{"/api/track/batch", "data-project", "doNotTrack", "event_name", "screen_width", "referrer"} {
+		if !bytes.Contains(trackerScript, []byte(want)) {
+			t.Errorf("Expected the tracker to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// Limits on tracked events. The tracking endpoints are public, so anything larger
+// is rejected before it reaches storage.
+const (
+	// MaxTrackBodySize caps the body of POST /api/track
+	MaxTrackBodySize = 64 << 10
+	// MaxBatchBodySize caps the body of POST /api/track/batch. Larger batch sizes
+	// get MaxBatchEventSize per event when that is more.
+	MaxBatchBodySize  = 1 << 20
+	MaxBatchEventSize = 10 << 10
+	// DefaultMaxBatchSize is the most events a batch may hold, unless
+	// TRACK_MAX_BATCH_SIZE says otherwise
+	DefaultMaxBatchSize = 100
+
+	MaxEventNameLength = 200
+	MaxURLLength       = 2048 // url and referrer
+	MaxUserAgentLength = 1024
+	MaxIDLength        = 256 // user_id, session_id, project_id and event_id
+	MaxClientLabel     = 100 // browser, os, device, country, region and language sent by the client
+
+	// DefaultMaxFutureSkew is how far ahead of the server clock a timestamp may be
+	DefaultMaxFutureSkew = time.Hour
+	// DefaultMaxEventAge is how far back a timestamp may be, leaving room for
+	// offline queues and backfills
+	DefaultMaxEventAge = 30 * 24 * time.Hour
+)
+
+// timestampLimits returns the accepted skew around now, from TRACK_MAX_FUTURE_SKEW
+// and TRACK_MAX_EVENT_AGE, falling back to the defaults for missing or invalid values
+func timestampLimits() (future, past time.Duration) {
+	future, past = DefaultMaxFutureSkew, DefaultMaxEventAge
+	if d, err := time.ParseDuration(os.Getenv("TRACK_MAX_FUTURE_SKEW")); err == nil && d >= 0 {
+		future = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("TRACK_MAX_EVENT_AGE")); err == nil && d > 0 {
+		past = d
+	}
+	return future, past
+}
+
+// maxBatchSize returns the most events a batch may hold, from TRACK_MAX_BATCH_SIZE,
+// falling back to DefaultMaxBatchSize for missing or invalid values
+func maxBatchSize() int {
+	if n, err := strconv.Atoi(os.Getenv("TRACK_MAX_BATCH_SIZE")); err == nil && n > 0 {
+		return n
+	}
+	return DefaultMaxBatchSize
+}
+
+// batchBodyLimit caps the body of a batch of up to size events
+func batchBodyLimit(size int) int64 {
+	return max(MaxBatchBodySize, int64(size)*MaxBatchEventSize)
+}
+
+// batchError reports an event of a batch that was rejected
+type batchError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// validateEvent checks a decoded event against the limits. A missing timestamp is
+// valid, the server fills it in.
+func validateEvent(event domain.Event, now time.Time) error {
+	if err := validateEventFields(event); err != nil {
+		return err
+	}
+
+	if !event.Timestamp.IsZero() {
+		future, past := timestampLimits()
+		if event.Timestamp.After(now.Add(future)) {
+			return fmt.Errorf("timestamp is more than %v in the future", future)
+		}
+		if event.Timestamp.Before(now.Add(-past)) {
+			return fmt.Errorf("timestamp is more than %v in the past", past)
+		}
+	}
+	return nil
+}
+
+// validateEventFields checks the fields of an event against the limits, leaving
+// out its timestamp, which imports of historical events do not bound
+func validateEventFields(event domain.Event) error {
+	if strings.TrimSpace(event.EventName) == "" {
+		return errors.New("event_name is required")
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"event_name", event.EventName, MaxEventNameLength},
+		{"url", event.URL, MaxURLLength},
+		{"referrer", event.Referrer, MaxURLLength},
+		{"user_agent", event.UserAgent, MaxUserAgentLength},
+		{"user_id", event.UserID, MaxIDLength},
+		{"session_id", event.SessionID, MaxIDLength},
+		{"project_id", event.ProjectID, MaxIDLength},
+		{"event_id", event.EventID, MaxIDLength},
+		{"browser", event.Browser, MaxClientLabel},
+		{"os", event.OS, MaxClientLabel},
+		{"device", event.Device, MaxClientLabel},
+		{"country", event.Country, MaxClientLabel},
+		{"region", event.Region, MaxClientLabel},
+		{"language", event.Language, MaxClientLabel},
+	}
+	for _, field := range fields {
+		if len(field.value) > field.max {
+			return fmt.Errorf("%s must be at most %d bytes", field.name, field.max)
+		}
+	}
+
+	if event.SessionDuration < 0 {
+		return errors.New("session_duration cannot be negative")
+	}
+
+	dimensions := []struct {
+		name  string
+		value int
+	}{
+		{"screen_width", event.ScreenWidth},
+		{"screen_height", event.ScreenHeight},
+	}
+	for _, dimension := range dimensions {
+		if dimension.value < 0 || dimension.value > domain.MaxScreenDimension {
+			return fmt.Errorf("%s must be between 0 and %d", dimension.name, domain.MaxScreenDimension)
+		}
+	}
+	return nil
+}
+
+// writeDecodeError answers a body that failed to decode: 413 when it exceeded the
+// size cap, 400 otherwise
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+		return
+	}
+	writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON")
+}
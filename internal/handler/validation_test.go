@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestTrackEventValidation(t *testing.T) {
+	now := time.Now().UTC()
+	event := func(fields string) string {
+		return `{"event_name":"page_view","user_id":"user1"` + fields + `}`
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		body     string
+		status   int
+		expected string
+	}{
+		{name: "Valid event", body: event(`,"url":"https://example.com/"`), status: http.StatusOK},
+		{name: "Missing timestamp is filled in", body: event(""), status: http.StatusOK},
+		{name: "Missing event_name", body: `{"user_id":"user1"}`, status: http.StatusBadRequest, expected: "event_name is required"},
+		{name: "Blank event_name", body: `{"event_name":"  ","user_id":"user1"}`, status: http.StatusBadRequest, expected: "event_name is required"},
+		{name: "Long event_name", body: `{"event_name":"` + strings.Repeat("a", MaxEventNameLength+1) + `"}`, status: http.StatusBadRequest, expected: "event_name must be at most 200 bytes"},
+		{name: "Long url", body: event(`,"url":"https://example.com/` + strings.Repeat("a", MaxURLLength) + `"`), status: http.StatusBadRequest, expected: "url must be at most 2048 bytes"},
+		{name: "Long referrer", body: event(`,"referrer":"` + strings.Repeat("a", MaxURLLength+1) + `"`), status: http.StatusBadRequest, expected: "referrer must be at most 2048 bytes"},
+		{name: "Long user_agent", body: event(`,"user_agent":"` + strings.Repeat("a", MaxUserAgentLength+1) + `"`), status: http.StatusBadRequest, expected: "user_agent must be at most 1024 bytes"},
+		{name: "Long session_id", body: event(`,"session_id":"` + strings.Repeat("a", MaxIDLength+1) + `"`), status: http.StatusBadRequest, expected: "session_id must be at most 256 bytes"},
+		{name: "Negative session_duration", body: event(`,"session_duration":-5`), status: http.StatusBadRequest, expected: "session_duration cannot be negative"},
+		{name: "Screen size", body: event(`,"screen_width":1920,"screen_height":1080`), status: http.StatusOK},
+		{name: "Negative screen_width", body: event(`,"screen_width":-1`), status: http.StatusBadRequest, expected: "screen_width must be between 0 and 16384"},
+		{name: "Huge screen_height", body: event(`,"screen_height":100000`), status: http.StatusBadRequest, expected: "screen_height must be between 0 and 16384"},
+		{name: "Timestamp in the future", body: event(`,"timestamp":"` + now.Add(2*time.Hour).Format(time.RFC3339) + `"`), status: http.StatusBadRequest, expected: "timestamp is more than 1h0m0s in the future"},
+		{name: "Timestamp slightly ahead", body: event(`,"timestamp":"` + now.Add(time.Minute).Format(time.RFC3339) + `"`), status: http.StatusOK},
+		{name: "Timestamp too old", body: event(`,"timestamp":"` + now.Add(-31*24*time.Hour).Format(time.RFC3339) + `"`), status: http.StatusBadRequest, expected: "timestamp is more than 720h0m0s in the past"},
+		{name: "Future skew from env", env: map[string]string{"TRACK_MAX_FUTURE_SKEW": "5m"}, body: event(`,"timestamp":"` + now.Add(10*time.Minute).Format(time.RFC3339) + `"`), status: http.StatusBadRequest, expected: "timestamp is more than 5m0s in the future"},
+		{name: "Event age from env", env: map[string]string{"TRACK_MAX_EVENT_AGE": "8760h"}, body: event(`,"timestamp":"` + now.Add(-60*24*time.Hour).Format(time.RFC3339) + `"`), status: http.StatusOK},
+		{name: "Invalid env falls back", env: map[string]string{"TRACK_MAX_FUTURE_SKEW": "soon"}, body: event(`,"timestamp":"` + now.Add(2*time.Hour).Format(time.RFC3339) + `"`), status: http.StatusBadRequest, expected: "in the future"},
+		{name: "Oversized body", body: event(`,"properties":{"blob":"` + strings.Repeat("a", MaxTrackBodySize) + `"}`), status: http.StatusRequestEntityTooLarge, expected: "Request body exceeds 65536 bytes"},
+		{name: "Invalid JSON", body: `{`, status: http.StatusBadRequest, expected: "Invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			if tt.status == http.StatusOK {
+				mockService.EXPECT().TrackEvent(gomock.Any()).Return(nil).Times(1)
+			}
+
+			handler := NewEventHandler(mockService, nil)
+			req := httptest.NewRequest(http.MethodPost, "/api/track", strings.NewReader(tt.body))
+			req.Header.Set("User-Agent", chrome)
+			w := httptest.NewRecorder()
+
+			handler.TrackEvent(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.expected != "" && !strings.Contains(w.Body.String(), tt.expected) {
+				t.Errorf("Expected body to contain %q, got %q", tt.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTrackBatchValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		body     string
+		code     int
+		status   string
+		stored   []string // Event names of the stored events
+		failed   []batchError
+		expected string // Plain error body, for rejected requests
+	}{
+		{
+			name:   "Valid batch",
+			body:   `{"events":[{"event_name":"page_view"},{"event_name":"click"}]}`,
+			code:   http.StatusOK,
+			status: "ok",
+			stored: []string{"page_view", "click"},
+		},
+		{
+			name:   "Invalid events are reported by index",
+			body:   `{"events":[{"event_name":"page_view"},{"event_name":""},{"event_name":"click"},{"event_name":"signup","session_duration":-1}]}`,
+			code:   http.StatusMultiStatus,
+			status: "partial",
+			stored: []string{"page_view", "click"},
+			failed: []batchError{
+				{Index: 1, Error: "event_name is required"},
+				{Index: 3, Error: "session_duration cannot be negative"},
+			},
+		},
+		{
+			name:   "No valid events",
+			body:   `{"events":[{"event_name":""},{"user_id":"user1"}]}`,
+			code:   http.StatusBadRequest,
+			status: "error",
+			failed: []batchError{
+				{Index: 0, Error: "event_name is required"},
+				{Index: 1, Error: "event_name is required"},
+			},
+		},
+		{
+			name:     "Batch size from env",
+			env:      map[string]string{"TRACK_MAX_BATCH_SIZE": "1"},
+			body:     `{"events":[{"event_name":"page_view"},{"event_name":"click"}]}`,
+			code:     http.StatusBadRequest,
+			expected: "Batch size exceeds maximum of 1 events",
+		},
+		{
+			name:     "Oversized batch body",
+			body:     fmt.Sprintf(`{"events":[{"event_name":"page_view","url":"%s"}]}`, strings.Repeat("a", MaxBatchBodySize)),
+			code:     http.StatusRequestEntityTooLarge,
+			expected: "Request body exceeds 1048576 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockEventService(ctrl)
+			if len(tt.stored) > 0 {
+				mockService.EXPECT().
+					TrackEventBatch(gomock.Any()).
+					DoAndReturn(func(events []domain.Event) error {
+						if len(events) != len(tt.stored) {
+							t.Fatalf("Expected %d stored events, got %d", len(tt.stored), len(events))
+						}
+						for i, event := range events {
+							if event.EventName != tt.stored[i] {
+								t.Errorf("Event %d: expected %s, got %s", i, tt.stored[i], event.EventName)
+							}
+						}
+						return nil
+					}).
+					Times(1)
+			}
+
+			handler := NewEventHandler(mockService, nil)
+			req := httptest.NewRequest(http.MethodPost, "/api/track/batch", strings.NewReader(tt.body))
+			req.Header.Set("User-Agent", chrome)
+			w := httptest.NewRecorder()
+
+			handler.TrackBatchEvents(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if tt.expected != "" {
+				if !strings.Contains(w.Body.String(), tt.expected) {
+					t.Errorf("Expected body to contain %q, got %q", tt.expected, w.Body.String())
+				}
+				return
+			}
+
+			var response struct {
+				Status     string       `json:"status"`
+				Total      int          `json:"total"`
+				Successful int          `json:"successful"`
+				Failed     int          `json:"failed"`
+				Errors     []batchError `json:"errors"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Status != tt.status {
+				t.Errorf("Expected status %q, got %q", tt.status, response.Status)
+			}
+			if response.Successful != len(tt.stored) || response.Failed != len(tt.failed) || response.Total != len(tt.stored)+len(tt.failed) {
+				t.Errorf("Unexpected counts: %+v", response)
+			}
+			if len(response.Errors) != len(tt.failed) || (len(tt.failed) > 0 && !reflect.DeepEqual(response.Errors, tt.failed)) {
+				t.Errorf("Expected errors %+v, got %+v", tt.failed, response.Errors)
+			}
+		})
+	}
+}
+
+func TestBatchBodyLimit(t *testing.T) {
+	tests := []struct {
+		size     int
+		expected int64
+	}{
+		{size: 1, expected: MaxBatchBodySize},
+		{size: DefaultMaxBatchSize, expected: MaxBatchBodySize},
+		{size: 1000, expected: 1000 * MaxBatchEventSize},
+	}
+	for _, tt := range tests {
+		if got := batchBodyLimit(tt.size); got != tt.expected {
+			t.Errorf("batchBodyLimit(%d) = %d, expected %d", tt.size, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Package hll estimates the number of distinct values seen with a HyperLogLog
+// sketch: a fixed 16 KiB of registers, each keeping the longest run of leading
+// zero bits among the hashes of the values it was given. Sketches of different
+// value sets merge into the sketch of their union, so one can be kept up to date
+// incrementally instead of recounting every value.
+package hll
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision is the number of hash bits picking a register. The standard
+	// error of an estimate is 1.04/sqrt(2^Precision), about 0.8%.
+	Precision = 14
+
+	registers = 1 << Precision
+	version   = 1
+)
+
+// Sketch is a HyperLogLog sketch. The zero value is not usable; call New. It is
+// not safe for concurrent use.
+type Sketch struct {
+	registers []uint8
+}
+
+// New returns an empty sketch
+func New() *Sketch {
+	return &Sketch{registers: make([]uint8, registers)}
+}
+
+// hash is FNV-1a followed by the MurmurHash3 finalizer, since HyperLogLog needs
+// every bit of the hash to be evenly distributed
+func hash(value string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Add records value
+func (s *Sketch) Add(value string) {
+	h := hash(value)
+	index := h >> (64 - Precision)
+	// The guard bit bounds the run when the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(h<<Precision|1<<(Precision-1)) + 1)
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// Merge adds the values recorded by other
+func (s *Sketch) Merge(other *Sketch) {
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Estimate returns the estimated number of distinct values added. Small counts
+// use linear counting over the empty registers, which is exact in practice for a
+// few thousand values.
+func (s *Sketch) Estimate() uint64 {
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(registers)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// MarshalBinary encodes the sketch as a version byte, the precision and the
+// registers
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 2+registers)
+	data = append(data, version, Precision)
+	return append(data, s.registers...), nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return errors.New("hll: sketch too short")
+	}
+	if data[0] != version || data[1] != Precision {
+		return fmt.Errorf("hll: unsupported sketch version %d with precision %d", data[0], data[1])
+	}
+	if len(data) != 2+registers {
+		return fmt.Errorf("hll: expected %d registers, got %d", registers, len(data)-2)
+	}
+	s.registers = append(make([]uint8, 0, registers), data[2:]...)
+	return nil
+}
@@ -0,0 +1,84 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// within reports whether estimate is within tolerance (a fraction) of exact
+func within(estimate, exact uint64, tolerance float64) bool {
+	return math.Abs(float64(estimate)-float64(exact)) <= tolerance*float64(exact)
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		distinct  int
+		tolerance float64
+	}{
+		{0, 0},
+		{1, 0},
+		{100, 0.01},
+		{5000, 0.02},
+		{100000, 0.03},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.distinct), func(t *testing.T) {
+			sketch := New()
+			for i := 0; i < tt.distinct; i++ {
+				sketch.Add(fmt.Sprintf("user-%d", i))
+				// Repeats do not count
+				sketch.Add(fmt.Sprintf("user-%d", i/2))
+			}
+			if estimate := sketch.Estimate(); !within(estimate, uint64(tt.distinct), tt.tolerance) {
+				t.Errorf("Expected about %d, got %d", tt.distinct, estimate)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b, union := New(), New(), New()
+	for i := 0; i < 3000; i++ {
+		a.Add(fmt.Sprintf("user-%d", i))
+		union.Add(fmt.Sprintf("user-%d", i))
+	}
+	for i := 2000; i < 5000; i++ {
+		b.Add(fmt.Sprintf("user-%d", i))
+		union.Add(fmt.Sprintf("user-%d", i))
+	}
+
+	a.Merge(b)
+	if a.Estimate() != union.Estimate() {
+		t.Errorf("Expected the merged sketch to match the sketch of the union: %d, got %d", union.Estimate(), a.Estimate())
+	}
+	if !within(a.Estimate(), 5000, 0.02) {
+		t.Errorf("Expected about 5000, got %d", a.Estimate())
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	sketch := New()
+	for i := 0; i < 1000; i++ {
+		sketch.Add(fmt.Sprintf("user-%d", i))
+	}
+	data, err := sketch.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	var decoded Sketch
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.Estimate() != sketch.Estimate() {
+		t.Errorf("Expected %d after a round trip, got %d", sketch.Estimate(), decoded.Estimate())
+	}
+
+	for _, invalid := range [][]byte{nil, {version}, {version + 1, Precision}, data[:len(data)-1]} {
+		if err := new(Sketch).UnmarshalBinary(invalid); err == nil {
+			t.Errorf("Expected an error for %d bytes", len(invalid))
+		}
+	}
+}
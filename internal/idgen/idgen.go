@@ -0,0 +1,109 @@
+// Package idgen generates event ids that stay unique across restarts and across
+// instances. Ids are time-ordered 64-bit values laid out Snowflake-style:
+//
+//	milliseconds since Epoch << 22 | instance << 12 | sequence
+//
+// so each instance can issue 4096 ids per millisecond without coordination.
+package idgen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// InstanceBits is the width of the instance id
+	InstanceBits = 10
+	// SequenceBits is the width of the per-millisecond sequence
+	SequenceBits = 12
+	// MaxInstance is the largest instance id
+	MaxInstance = 1<<InstanceBits - 1
+
+	maxSequence = 1<<SequenceBits - 1
+)
+
+// Epoch is time zero of the id timestamps; 41 bits of milliseconds last until 2093
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator issues increasing ids for one instance. It is safe for concurrent use.
+type Generator struct {
+	mu       sync.Mutex
+	instance uint64
+	now      func() time.Time
+	lastMs   int64
+	sequence uint64
+}
+
+// New returns a generator for instance, which must be between 0 and MaxInstance
+func New(instance int) (*Generator, error) {
+	if instance < 0 || instance > MaxInstance {
+		return nil, fmt.Errorf("instance id must be between 0 and %d, got %d", MaxInstance, instance)
+	}
+	return &Generator{instance: uint64(instance), now: time.Now}, nil
+}
+
+// Next returns a new id, greater than every id the generator issued before. When
+// the clock goes backwards or the sequence runs out within a millisecond, it keeps
+// counting from the last timestamp instead of repeating ids.
+func (g *Generator) Next() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.now().Sub(Epoch).Milliseconds()
+	if ms < g.lastMs {
+		ms = g.lastMs
+	}
+	if ms == g.lastMs {
+		g.sequence = (g.sequence + 1) & maxSequence
+		if g.sequence == 0 {
+			ms++
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = ms
+
+	return uint64(ms)<<(InstanceBits+SequenceBits) | g.instance<<SequenceBits | g.sequence
+}
+
+// Time returns when id was issued, to the millisecond
+func Time(id uint64) time.Time {
+	return Epoch.Add(time.Duration(id>>(InstanceBits+SequenceBits)) * time.Millisecond)
+}
+
+// Instance returns the instance that issued id
+func Instance(id uint64) int {
+	return int(id >> SequenceBits & MaxInstance)
+}
+
+var (
+	mu     sync.RWMutex
+	shared = &Generator{now: time.Now}
+)
+
+// SetInstance selects the instance id of the ids Next issues. Instances writing to
+// shared storage, or whose data is merged later, need distinct ids.
+func SetInstance(instance int) error {
+	g, err := New(instance)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Start past the last millisecond used, so ids keep increasing even when the new
+	// instance id is lower than the old one
+	shared.mu.Lock()
+	g.lastMs = shared.lastMs + 1
+	shared.mu.Unlock()
+	shared = g
+	return nil
+}
+
+// Next returns a new event id from the process-wide generator
+func Next() uint64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	return shared.Next()
+}
@@ -0,0 +1,131 @@
+package idgen
+
+import (
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for generators under test
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestGenerator(t *testing.T, instance int, c *clock) *Generator {
+	t.Helper()
+	g, err := New(instance)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	g.now = c.now
+	return g
+}
+
+func TestNextIsMonotonicAndUniqueAcrossRestarts(t *testing.T) {
+	c := &clock{t: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+	seen := make(map[uint64]bool)
+	var last uint64
+
+	issue := func(g *Generator, n int) {
+		for i := 0; i < n; i++ {
+			id := g.Next()
+			if seen[id] {
+				t.Fatalf("Duplicate id %d", id)
+			}
+			if id <= last {
+				t.Fatalf("Id %d is not greater than the previous id %d", id, last)
+			}
+			seen[id] = true
+			last = id
+		}
+	}
+
+	// Several process lifetimes, each restarting with fresh state a little later.
+	// The old scheme restarted at 1 every time.
+	for restart := 0; restart < 5; restart++ {
+		g := newTestGenerator(t, 3, c)
+		issue(g, 100)
+		c.t = c.t.Add(time.Millisecond)
+		issue(g, 100)
+		c.t = c.t.Add(time.Second)
+	}
+}
+
+func TestNextWithinOneMillisecond(t *testing.T) {
+	c := &clock{t: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+	g := newTestGenerator(t, 0, c)
+
+	// More ids than the sequence holds borrow the following milliseconds
+	var last uint64
+	for i := 0; i < 3*(maxSequence+1); i++ {
+		id := g.Next()
+		if id <= last {
+			t.Fatalf("Id %d is not greater than the previous id %d", id, last)
+		}
+		last = id
+	}
+	if got := Time(last); !got.Equal(c.t.Add(2 * time.Millisecond)) {
+		t.Errorf("Expected the last id to borrow two milliseconds, got %v", got)
+	}
+}
+
+func TestNextWhenClockGoesBackwards(t *testing.T) {
+	c := &clock{t: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+	g := newTestGenerator(t, 0, c)
+
+	before := g.Next()
+	c.t = c.t.Add(-time.Minute)
+	if after := g.Next(); after <= before {
+		t.Errorf("Expected ids to keep increasing when the clock goes back, got %d after %d", after, before)
+	}
+}
+
+func TestInstancesDoNotCollide(t *testing.T) {
+	c := &clock{t: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+	a := newTestGenerator(t, 1, c)
+	b := newTestGenerator(t, 2, c)
+
+	seen := make(map[uint64]bool)
+	for i := 0; i < 1000; i++ {
+		for _, id := range []uint64{a.Next(), b.Next()} {
+			if seen[id] {
+				t.Fatalf("Duplicate id %d across instances", id)
+			}
+			seen[id] = true
+		}
+	}
+
+	id := b.Next()
+	if Instance(id) != 2 {
+		t.Errorf("Expected instance 2, got %d", Instance(id))
+	}
+	if got := Time(id); !got.Equal(c.t) {
+		t.Errorf("Expected id time %v, got %v", c.t, got)
+	}
+}
+
+func TestNewRejectsInvalidInstance(t *testing.T) {
+	for _, instance := range []int{-1, MaxInstance + 1} {
+		if _, err := New(instance); err == nil {
+			t.Errorf("Expected error for instance %d", instance)
+		}
+	}
+	if err := SetInstance(MaxInstance + 1); err == nil {
+		t.Error("Expected SetInstance to reject an invalid instance")
+	}
+}
+
+func TestSetInstance(t *testing.T) {
+	t.Cleanup(func() { _ = SetInstance(0) })
+
+	before := Next()
+	if err := SetInstance(7); err != nil {
+		t.Fatalf("SetInstance failed: %v", err)
+	}
+	after := Next()
+	if Instance(after) != 7 {
+		t.Errorf("Expected instance 7, got %d", Instance(after))
+	}
+	if after <= before {
+		t.Errorf("Expected ids to keep increasing after SetInstance, got %d after %d", after, before)
+	}
+}
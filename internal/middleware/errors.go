@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Error codes of JSON error responses. Clients should branch on the code, the
+// message is meant for people and may change.
+const (
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeForbidden        = "forbidden"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeConflict         = "conflict"
+	ErrCodeTooLarge         = "payload_too_large"
+	ErrCodeInternal         = "internal_error"
+	ErrCodeUnavailable      = "unavailable"
+	ErrCodeTimeout          = "timeout"
+	// ErrCodeBusy is a temporary overload, retry after the Retry-After delay
+	ErrCodeBusy = "busy"
+)
+
+// ErrorDetail is the "error" member of every error response
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// WriteError sends {"error": {"code": ..., "message": ...}} with status. The id
+// the RequestID middleware put on the response is added as request_id, so a
+// failure a client reports can be found in the logs. Middleware and handlers all
+// report errors this way, so API clients parse a single format.
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	body := struct {
+		Error     ErrorDetail `json:"error"`
+		RequestID string      `json:"request_id,omitempty"`
+	}{
+		Error:     ErrorDetail{Code: code, Message: message},
+		RequestID: w.Header().Get(RequestIDHeader),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error encoding error response: %v", err)
+	}
+}
@@ -1,34 +1,267 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// RequestIDHeader carries the id of a request, from the client or generated
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps ids taken from clients, longer ones are replaced
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID gives every request an id: the client's X-Request-ID when it is a
+// plausible id, otherwise a random UUID. The id is stored in the request context
+// for handlers and the access log, and echoed in the response header so clients
+// can quote it when reporting a problem.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns the id RequestID stored in ctx, or empty without one
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts short ids of letters, digits and . _ : - so client ids
+// cannot inject anything into headers or logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == ':', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Printf("Warning: failed to generate request id: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// responseWriter records the status code and size of a response for the access log
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Flush keeps streaming responses working through the wrapper
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Logging writes an access log line per request. LOG_FORMAT=json writes JSON lines
+// for log aggregation, anything else the plain text format.
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		duration := time.Since(start)
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestID := RequestIDFromContext(r.Context())
+		if requestID == "" {
+			requestID = r.Header.Get(RequestIDHeader)
+		}
+
+		if os.Getenv("LOG_FORMAT") != "json" {
+			log.Printf("%s %s %d %dB %s", r.Method, r.RequestURI, status, rw.bytes, duration)
+			return
+		}
+
+		attrs := []any{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", rw.bytes),
+			slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+			slog.String("client_ip", clientIP(r)),
+		}
+		if requestID != "" {
+			attrs = append(attrs, slog.String("request_id", requestID))
+		}
+		slog.New(slog.NewJSONHandler(log.Writer(), nil)).Info("request", attrs...)
 	})
 }
 
+// clientIP is the address of the client, behind proxies that set X-Forwarded-For
+// or X-Real-IP
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// Default CORS settings, overridden by CORS_ALLOW_METHODS and CORS_ALLOW_HEADERS
+const (
+	DefaultCORSMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	DefaultCORSHeaders = "Content-Type, Authorization, X-Admin-Key, X-Request-ID"
+)
+
+// corsConfig is the CORS policy read from the environment
+type corsConfig struct {
+	origins     []string // Allowed origins, unless anyOrigin
+	anyOrigin   bool
+	credentials bool
+	methods     string
+	headers     string
+	maxAge      time.Duration
+}
+
+// loadCORSConfig reads the CORS policy: CORS is a comma-separated allowlist of
+// origins, defaulting to "*" for any origin
+func loadCORSConfig() corsConfig {
+	config := corsConfig{
+		credentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "1",
+		methods:     DefaultCORSMethods,
+		headers:     DefaultCORSHeaders,
+	}
+	for _, origin := range strings.Split(os.Getenv("CORS"), ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		switch origin {
+		case "":
+		case "*":
+			config.anyOrigin = true
+		default:
+			config.origins = append(config.origins, origin)
+		}
+	}
+	if len(config.origins) == 0 {
+		config.anyOrigin = true
+	}
+
+	if methods := os.Getenv("CORS_ALLOW_METHODS"); methods != "" {
+		config.methods = methods
+	}
+	if headers := os.Getenv("CORS_ALLOW_HEADERS"); headers != "" {
+		config.headers = headers
+	}
+	if maxAge, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE")); err == nil && maxAge > 0 {
+		config.maxAge = maxAge
+	}
+	return config
+}
+
+// allowedOrigin is the Access-Control-Allow-Origin for a request from origin, or
+// empty when the origin is not allowed. Browsers refuse "*" on credentialed
+// requests, so the origin is echoed instead when credentials are allowed.
+func (c corsConfig) allowedOrigin(origin string) string {
+	if c.anyOrigin {
+		if c.credentials && origin != "" {
+			return origin
+		}
+		return "*"
+	}
+	for _, allowed := range c.origins {
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// CORS sets the CORS headers for allowed origins and answers preflight requests.
+// Requests from other origins are served without CORS headers, so browsers block
+// their responses, and their preflight requests are refused.
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cors := os.Getenv("CORS")
-		if cors == "" {
-			cors = "*"
+		config := loadCORSConfig()
+		origin := r.Header.Get("Origin")
+
+		// The response depends on the Origin header unless every origin gets "*"
+		if !config.anyOrigin || config.credentials {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		allowed := config.allowedOrigin(origin)
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			w.Header().Set("Access-Control-Allow-Methods", config.methods)
+			w.Header().Set("Access-Control-Allow-Headers", config.headers)
+			w.Header().Set("Access-Control-Expose-Headers", "X-Stats-Approximate, X-Stats-Distinct-Count, X-Total-Count, X-Request-ID")
+			if config.credentials && allowed != "*" {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if config.maxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(config.maxAge.Seconds())))
+			}
 		}
-		w.Header().Set("Access-Control-Allow-Origin", cors)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
+			if allowed == "" && origin != "" {
+				WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Origin not allowed")
+				return
+			}
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -93,6 +326,50 @@ func BasicAuth(next http.Handler) http.Handler {
 	})
 }
 
+// Errors of CheckAdminKey
+var (
+	// ErrAdminDisabled is returned when no ADMIN_API_KEY is configured
+	ErrAdminDisabled = errors.New("admin API is disabled")
+	// ErrAdminUnauthorized is returned when the request has no key or a wrong one
+	ErrAdminUnauthorized = errors.New("unauthorized")
+)
+
+// CheckAdminKey checks the admin API key of a request, sent as "Authorization:
+// Bearer <key>" or X-Admin-Key, against ADMIN_API_KEY. Handlers of public routes
+// use it for admin-only options.
+func CheckAdminKey(r *http.Request) error {
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	if adminKey == "" {
+		return ErrAdminDisabled
+	}
+
+	key := r.Header.Get("X-Admin-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+		return ErrAdminUnauthorized
+	}
+	return nil
+}
+
+// AdminAuth middleware protects admin routes with an API key
+// The key is read from ADMIN_API_KEY and sent as "Authorization: Bearer <key>" or X-Admin-Key.
+// Unlike BasicAuth, admin routes are disabled entirely when no key is configured.
+func AdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch err := CheckAdminKey(r); err {
+		case nil:
+			next.ServeHTTP(w, r)
+		case ErrAdminDisabled:
+			WriteError(w, http.StatusForbidden, ErrCodeForbidden, "Admin API is disabled")
+		default:
+			WriteError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized")
+		}
+	})
+}
+
 // requireAuth sends a 401 Unauthorized response with WWW-Authenticate header
 func requireAuth(w http.ResponseWriter) {
 	w.Header().Set("WWW-Authenticate", `Basic realm="Siraaj Dashboard"`)
@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -31,54 +36,255 @@ func TestLogging(t *testing.T) {
 	}
 }
 
+func TestLoggingStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		handler  http.HandlerFunc
+		expected string
+	}{
+		{
+			name:     "Text",
+			handler:  http.NotFound,
+			expected: "GET /api/missing?x=1 404 19B",
+		},
+		{
+			name:     "Implicit 200",
+			format:   "text",
+			handler:  func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("OK")) },
+			expected: "GET /api/missing?x=1 200 2B",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOG_FORMAT", tt.format)
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			rec := httptest.NewRecorder()
+			Logging(tt.handler).ServeHTTP(rec, httptest.NewRequest("GET", "/api/missing?x=1", nil))
+
+			if !strings.Contains(buf.String(), tt.expected) {
+				t.Errorf("Expected log line to contain %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestLoggingJSON(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "json")
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	req := httptest.NewRequest("POST", "/api/missing?x=1", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	req.Header.Set("X-Request-ID", "req-42")
+	rec := httptest.NewRecorder()
+
+	Logging(http.HandlerFunc(http.NotFound)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", rec.Code)
+	}
+
+	var entry struct {
+		Msg        string   `json:"msg"`
+		Method     string   `json:"method"`
+		Path       string   `json:"path"`
+		Status     int      `json:"status"`
+		Bytes      int      `json:"bytes"`
+		DurationMs *float64 `json:"duration_ms"`
+		ClientIP   string   `json:"client_ip"`
+		RequestID  string   `json:"request_id"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry.Msg != "request" || entry.Method != "POST" || entry.Path != "/api/missing" {
+		t.Errorf("Unexpected request fields: %+v", entry)
+	}
+	if entry.Status != http.StatusNotFound {
+		t.Errorf("Expected status 404 in the log, got %d", entry.Status)
+	}
+	if entry.Bytes != rec.Body.Len() {
+		t.Errorf("Expected %d bytes in the log, got %d", rec.Body.Len(), entry.Bytes)
+	}
+	if entry.DurationMs == nil {
+		t.Error("Expected duration_ms in the log")
+	}
+	if entry.ClientIP != "203.0.113.7" {
+		t.Errorf("Expected client IP 203.0.113.7, got %q", entry.ClientIP)
+	}
+	if entry.RequestID != "req-42" {
+		t.Errorf("Expected request id req-42, got %q", entry.RequestID)
+	}
+}
+
+func TestLoggingKeepsFlusher(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("Expected the logged response writer to implement http.Flusher")
+		}
+	})
+	Logging(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/live", nil))
+}
+
+func TestRequestID(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	tests := []struct {
+		name     string
+		incoming string
+		expected string // Empty when a new id is expected
+	}{
+		{name: "Incoming id is kept", incoming: "req-42", expected: "req-42"},
+		{name: "Missing id is generated"},
+		{name: "Unsafe id is replaced", incoming: "bad id\r\ninjected"},
+		{name: "Long id is replaced", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest("GET", "/api/test", nil)
+			req.Header.Set(RequestIDHeader, tt.incoming)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			echoed := rec.Header().Get(RequestIDHeader)
+			if echoed != seen {
+				t.Errorf("Expected the response header %q to match the context id %q", echoed, seen)
+			}
+			if tt.expected != "" {
+				if seen != tt.expected {
+					t.Errorf("Expected id %q, got %q", tt.expected, seen)
+				}
+			} else if !uuidPattern.MatchString(seen) {
+				t.Errorf("Expected a generated UUID, got %q", seen)
+			}
+		})
+	}
+
+	if RequestIDFromContext(httptest.NewRequest("GET", "/", nil).Context()) != "" {
+		t.Error("Expected no id outside the middleware")
+	}
+}
+
 func TestCORS(t *testing.T) {
 	tests := []struct {
-		name           string
-		method         string
-		corsEnv        string
-		expectedOrigin string
-		expectedStatus int
+		name                string
+		method              string
+		origin              string
+		env                 map[string]string
+		expectedOrigin      string // Empty when no CORS headers are expected
+		expectedStatus      int
+		expectedCredentials string
+		expectedVary        string
+		expectedMaxAge      string
+		expectedMethods     string
 	}{
 		{
 			name:           "GET request with default CORS",
 			method:         "GET",
-			corsEnv:        "",
+			origin:         "https://example.com",
+			expectedOrigin: "*",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Request without origin",
+			method:         "GET",
 			expectedOrigin: "*",
 			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "POST request with custom CORS",
+			name:           "Allowed origin",
 			method:         "POST",
-			corsEnv:        "https://example.com",
+			origin:         "https://example.com",
+			env:            map[string]string{"CORS": "https://example.com"},
 			expectedOrigin: "https://example.com",
 			expectedStatus: http.StatusOK,
+			expectedVary:   "Origin",
+		},
+		{
+			name:           "Allowed origin from a list",
+			method:         "POST",
+			origin:         "https://app.example.com",
+			env:            map[string]string{"CORS": "https://example.com, https://app.example.com/"},
+			expectedOrigin: "https://app.example.com",
+			expectedStatus: http.StatusOK,
+			expectedVary:   "Origin",
+		},
+		{
+			name:           "Disallowed origin",
+			method:         "POST",
+			origin:         "https://evil.example.org",
+			env:            map[string]string{"CORS": "https://example.com,https://app.example.com"},
+			expectedStatus: http.StatusOK,
+			expectedVary:   "Origin",
+		},
+		{
+			name:                "Credentials with an allowed origin",
+			method:              "GET",
+			origin:              "https://example.com",
+			env:                 map[string]string{"CORS": "https://example.com", "CORS_ALLOW_CREDENTIALS": "1"},
+			expectedOrigin:      "https://example.com",
+			expectedStatus:      http.StatusOK,
+			expectedCredentials: "true",
+			expectedVary:        "Origin",
+		},
+		{
+			name:                "Credentials with any origin echo the origin",
+			method:              "GET",
+			origin:              "https://example.com",
+			env:                 map[string]string{"CORS": "*", "CORS_ALLOW_CREDENTIALS": "1"},
+			expectedOrigin:      "https://example.com",
+			expectedStatus:      http.StatusOK,
+			expectedCredentials: "true",
+			expectedVary:        "Origin",
 		},
 		{
 			name:           "OPTIONS preflight request",
 			method:         "OPTIONS",
-			corsEnv:        "*",
+			origin:         "https://example.com",
+			env:            map[string]string{"CORS": "*"},
 			expectedOrigin: "*",
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:            "Preflight from an allowed origin",
+			method:          "OPTIONS",
+			origin:          "https://example.com",
+			env:             map[string]string{"CORS": "https://example.com", "CORS_ALLOW_METHODS": "GET, POST", "CORS_MAX_AGE": "10m"},
+			expectedOrigin:  "https://example.com",
+			expectedStatus:  http.StatusOK,
+			expectedVary:    "Origin",
+			expectedMaxAge:  "600",
+			expectedMethods: "GET, POST",
+		},
+		{
+			name:           "Preflight from a disallowed origin",
+			method:         "OPTIONS",
+			origin:         "https://evil.example.org",
+			env:            map[string]string{"CORS": "https://example.com"},
+			expectedStatus: http.StatusForbidden,
+			expectedVary:   "Origin",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Set environment variable
-			if tt.corsEnv != "" {
-				if err := os.Setenv("CORS", tt.corsEnv); err != nil {
-					t.Fatalf("Failed to set CORS env: %v", err)
-				}
-			} else {
-				if err := os.Unsetenv("CORS"); err != nil {
-					t.Fatalf("Failed to unset CORS env: %v", err)
-				}
+			t.Setenv("CORS", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
 			}
-			defer func() {
-				if err := os.Unsetenv("CORS"); err != nil {
-					t.Logf("Warning: failed to unset CORS env: %v", err)
-				}
-			}()
 
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
@@ -90,6 +296,12 @@ func TestCORS(t *testing.T) {
 			middleware := CORS(handler)
 
 			req := httptest.NewRequest(tt.method, "/api/test", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == "OPTIONS" {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
 			rec := httptest.NewRecorder()
 
 			middleware.ServeHTTP(rec, req)
@@ -97,18 +309,43 @@ func TestCORS(t *testing.T) {
 			if rec.Code != tt.expectedStatus {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
 			}
+			if rec.Code == http.StatusForbidden {
+				if code := errorCode(t, rec); code != ErrCodeForbidden {
+					t.Errorf("Expected error code %q, got %q", ErrCodeForbidden, code)
+				}
+			}
 
 			origin := rec.Header().Get("Access-Control-Allow-Origin")
 			if origin != tt.expectedOrigin {
 				t.Errorf("Expected Access-Control-Allow-Origin to be '%s', got '%s'", tt.expectedOrigin, origin)
 			}
 
-			methods := rec.Header().Get("Access-Control-Allow-Methods")
-			if methods == "" {
-				t.Error("Expected Access-Control-Allow-Methods header to be set")
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.expectedCredentials {
+				t.Errorf("Expected Access-Control-Allow-Credentials to be '%s', got '%s'", tt.expectedCredentials, got)
+			}
+			if got := rec.Header().Get("Vary"); got != tt.expectedVary {
+				t.Errorf("Expected Vary to be '%s', got '%s'", tt.expectedVary, got)
+			}
+			if got := rec.Header().Get("Access-Control-Max-Age"); got != tt.expectedMaxAge {
+				t.Errorf("Expected Access-Control-Max-Age to be '%s', got '%s'", tt.expectedMaxAge, got)
 			}
 
+			methods := rec.Header().Get("Access-Control-Allow-Methods")
 			headers := rec.Header().Get("Access-Control-Allow-Headers")
+			if tt.expectedOrigin == "" {
+				if methods != "" || headers != "" {
+					t.Error("Expected no CORS headers for a disallowed origin")
+				}
+				return
+			}
+
+			expectedMethods := tt.expectedMethods
+			if expectedMethods == "" {
+				expectedMethods = DefaultCORSMethods
+			}
+			if methods != expectedMethods {
+				t.Errorf("Expected Access-Control-Allow-Methods to be '%s', got '%s'", expectedMethods, methods)
+			}
 			if headers == "" {
 				t.Error("Expected Access-Control-Allow-Headers header to be set")
 			}
@@ -146,3 +383,104 @@ func TestCORSChaining(t *testing.T) {
 		t.Error("Expected CORS headers to be set in chained middleware")
 	}
 }
+
+// errorCode returns the code of the JSON error response rec recorded
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected a JSON error response, got Content-Type %q", got)
+	}
+	var body struct {
+		Error ErrorDetail `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode error response %q: %v", rec.Body.String(), err)
+	}
+	return body.Error.Code
+}
+
+// adminErrorCodes are the error codes AdminAuth rejects requests with
+var adminErrorCodes = map[int]string{
+	http.StatusUnauthorized: ErrCodeUnauthorized,
+	http.StatusForbidden:    ErrCodeForbidden,
+}
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		name           string
+		adminKey       string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "Disabled without ADMIN_API_KEY",
+			adminKey:       "",
+			headers:        map[string]string{"X-Admin-Key": "anything"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Missing key",
+			adminKey:       "secret",
+			headers:        map[string]string{},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Wrong key",
+			adminKey:       "secret",
+			headers:        map[string]string{"X-Admin-Key": "wrong"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "X-Admin-Key header",
+			adminKey:       "secret",
+			headers:        map[string]string{"X-Admin-Key": "secret"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Bearer token",
+			adminKey:       "secret",
+			headers:        map[string]string{"Authorization": "Bearer secret"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Basic auth is not accepted",
+			adminKey:       "secret",
+			headers:        map[string]string{"Authorization": "Basic c2VjcmV0"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Setenv("ADMIN_API_KEY", tt.adminKey); err != nil {
+				t.Fatalf("Failed to set ADMIN_API_KEY env: %v", err)
+			}
+			defer func() {
+				if err := os.Unsetenv("ADMIN_API_KEY"); err != nil {
+					t.Logf("Warning: failed to unset ADMIN_API_KEY env: %v", err)
+				}
+			}()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/reset", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+
+			AdminAuth(handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if expected := adminErrorCodes[tt.expectedStatus]; expected != "" {
+				if code := errorCode(t, rec); code != expected {
+					t.Errorf("Expected error code %q, got %q", expected, code)
+				}
+			}
+		})
+	}
+}
@@ -1,3 +1,6 @@
+// Package migrations manages the DuckDB schema. The events table is the write
+// target when Parquet storage is disabled and the read fallback until the first
+// Parquet file is flushed; all DDL here is DuckDB SQL and is not portable.
 package migrations
 
 import (
@@ -87,6 +90,83 @@ var migrations = []Migration{
 		DROP INDEX IF EXISTS idx_day_device;
 		DROP INDEX IF EXISTS idx_day_os`,
 	},
+	{
+		Version:     4,
+		Description: "Add received_at ingestion time column",
+		Up: `ALTER TABLE events ADD COLUMN IF NOT EXISTS received_at TIMESTAMP;
+		UPDATE events SET received_at = timestamp WHERE received_at IS NULL;`,
+		Down: `ALTER TABLE events DROP COLUMN IF EXISTS received_at`,
+	},
+	{
+		Version:     5,
+		Description: "Create goals table",
+		Up: `CREATE SEQUENCE IF NOT EXISTS goal_id_sequence START 1;
+		CREATE TABLE IF NOT EXISTS goals (
+			id BIGINT PRIMARY KEY DEFAULT nextval('goal_id_sequence'),
+			name VARCHAR NOT NULL UNIQUE,
+			event_name VARCHAR,
+			url VARCHAR,
+			created_at TIMESTAMP NOT NULL
+		);`,
+		Down: `DROP TABLE IF EXISTS goals;
+		DROP SEQUENCE IF EXISTS goal_id_sequence;`,
+	},
+	{
+		Version:     6,
+		Description: "Add region column",
+		Up:          `ALTER TABLE events ADD COLUMN IF NOT EXISTS region VARCHAR`,
+		Down:        `ALTER TABLE events DROP COLUMN IF EXISTS region`,
+	},
+	{
+		Version:     7,
+		Description: "Add language column",
+		Up:          `ALTER TABLE events ADD COLUMN IF NOT EXISTS language VARCHAR`,
+		Down:        `ALTER TABLE events DROP COLUMN IF EXISTS language`,
+	},
+	{
+		Version:     8,
+		Description: "Add screen size columns",
+		Up: `ALTER TABLE events ADD COLUMN IF NOT EXISTS screen_width INTEGER;
+		ALTER TABLE events ADD COLUMN IF NOT EXISTS screen_height INTEGER;`,
+		Down: `ALTER TABLE events DROP COLUMN IF EXISTS screen_width;
+		ALTER TABLE events DROP COLUMN IF EXISTS screen_height;`,
+	},
+	{
+		Version:     9,
+		Description: "Add sample rate column",
+		Up:          `ALTER TABLE events ADD COLUMN IF NOT EXISTS sample_rate DOUBLE DEFAULT 1`,
+		Down:        `ALTER TABLE events DROP COLUMN IF EXISTS sample_rate`,
+	},
+	{
+		Version:     10,
+		Description: "Create daily_stats table",
+		Up: `CREATE TABLE IF NOT EXISTS daily_stats (
+			date_day DATE NOT NULL,
+			project_id VARCHAR,
+			event_name VARCHAR,
+			country VARCHAR,
+			language VARCHAR,
+			browser VARCHAR,
+			device VARCHAR,
+			os VARCHAR,
+			source VARCHAR,
+			is_bot BOOLEAN,
+			events BIGINT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_daily_stats_day ON daily_stats(date_day);`,
+		Down: `DROP TABLE IF EXISTS daily_stats`,
+	},
+	{
+		Version:     11,
+		Description: "Add page and channel to daily_stats",
+		// The stored days have neither, so they are cleared and recomputed in full
+		// by the next refresh
+		Up: `DELETE FROM daily_stats;
+		ALTER TABLE daily_stats ADD COLUMN IF NOT EXISTS url VARCHAR;
+		ALTER TABLE daily_stats ADD COLUMN IF NOT EXISTS channel VARCHAR;`,
+		Down: `ALTER TABLE daily_stats DROP COLUMN IF EXISTS channel;
+		ALTER TABLE daily_stats DROP COLUMN IF EXISTS url;`,
+	},
 }
 
 func initMigrationTable(db *sql.DB) error {
@@ -109,9 +189,24 @@ func getCurrentVersion(db *sql.DB) (int, error) {
 	return version, nil
 }
 
+// checkEngine verifies the connection is DuckDB before any DDL runs
+func checkEngine(db *sql.DB) (string, error) {
+	var version string
+	if err := db.QueryRow("SELECT library_version FROM pragma_version()").Scan(&version); err != nil {
+		return "", fmt.Errorf("migrations require DuckDB, could not detect engine version: %w", err)
+	}
+	return version, nil
+}
+
 func Migrate(db *sql.DB) error {
 	log.Println("Running database migrations...")
 
+	version, err := checkEngine(db)
+	if err != nil {
+		return err
+	}
+	log.Printf("Database engine: DuckDB %s", version)
+
 	if err := initMigrationTable(db); err != nil {
 		return fmt.Errorf("failed to initialize migration table: %v", err)
 	}
@@ -10,6 +10,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 	time "time"
 
@@ -41,6 +42,49 @@ func (m *MockEventRepository) EXPECT() *MockEventRepositoryMockRecorder {
 	return m.recorder
 }
 
+// CheckReadiness mocks base method.
+func (m *MockEventRepository) CheckReadiness(ctx context.Context) domain.Readiness {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckReadiness", ctx)
+	ret0, _ := ret[0].(domain.Readiness)
+	return ret0
+}
+
+// CheckReadiness indicates an expected call of CheckReadiness.
+func (mr *MockEventRepositoryMockRecorder) CheckReadiness(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckReadiness", reflect.TypeOf((*MockEventRepository)(nil).CheckReadiness), ctx)
+}
+
+// Close mocks base method.
+func (m *MockEventRepository) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockEventRepositoryMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockEventRepository)(nil).Close))
+}
+
+// Compact mocks base method.
+func (m *MockEventRepository) Compact(ctx context.Context) (domain.CompactionResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Compact", ctx)
+	ret0, _ := ret[0].(domain.CompactionResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Compact indicates an expected call of Compact.
+func (mr *MockEventRepositoryMockRecorder) Compact(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Compact", reflect.TypeOf((*MockEventRepository)(nil).Compact), ctx)
+}
+
 // Create mocks base method.
 func (m *MockEventRepository) Create(event domain.Event) error {
 	m.ctrl.T.Helper()
@@ -69,212 +113,645 @@ func (mr *MockEventRepositoryMockRecorder) CreateBatch(events any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBatch", reflect.TypeOf((*MockEventRepository)(nil).CreateBatch), events)
 }
 
+// CreateGoal mocks base method.
+func (m *MockEventRepository) CreateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateGoal", ctx, goal)
+	ret0, _ := ret[0].(domain.Goal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateGoal indicates an expected call of CreateGoal.
+func (mr *MockEventRepositoryMockRecorder) CreateGoal(ctx, goal any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateGoal", reflect.TypeOf((*MockEventRepository)(nil).CreateGoal), ctx, goal)
+}
+
+// DataAsOf mocks base method.
+func (m *MockEventRepository) DataAsOf() time.Time {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DataAsOf")
+	ret0, _ := ret[0].(time.Time)
+	return ret0
+}
+
+// DataAsOf indicates an expected call of DataAsOf.
+func (mr *MockEventRepositoryMockRecorder) DataAsOf() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DataAsOf", reflect.TypeOf((*MockEventRepository)(nil).DataAsOf))
+}
+
+// DeleteGoal mocks base method.
+func (m *MockEventRepository) DeleteGoal(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteGoal", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteGoal indicates an expected call of DeleteGoal.
+func (mr *MockEventRepositoryMockRecorder) DeleteGoal(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteGoal", reflect.TypeOf((*MockEventRepository)(nil).DeleteGoal), ctx, id)
+}
+
+// ExplainStats mocks base method.
+func (m *MockEventRepository) ExplainStats(ctx context.Context, report string, startDate, endDate time.Time, limit int, filters map[string]string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExplainStats", ctx, report, startDate, endDate, limit, filters)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExplainStats indicates an expected call of ExplainStats.
+func (mr *MockEventRepositoryMockRecorder) ExplainStats(ctx, report, startDate, endDate, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExplainStats", reflect.TypeOf((*MockEventRepository)(nil).ExplainStats), ctx, report, startDate, endDate, limit, filters)
+}
+
+// ExportParquet mocks base method.
+func (m *MockEventRepository) ExportParquet(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string, maxRows int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportParquet", ctx, startDate, endDate, filters, path, maxRows)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportParquet indicates an expected call of ExportParquet.
+func (mr *MockEventRepositoryMockRecorder) ExportParquet(ctx, startDate, endDate, filters, path, maxRows any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportParquet", reflect.TypeOf((*MockEventRepository)(nil).ExportParquet), ctx, startDate, endDate, filters, path, maxRows)
+}
+
+// Flush mocks base method.
+func (m *MockEventRepository) Flush() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush.
+func (mr *MockEventRepositoryMockRecorder) Flush() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockEventRepository)(nil).Flush))
+}
+
+// FlushSync mocks base method.
+func (m *MockEventRepository) FlushSync() (domain.FlushResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FlushSync")
+	ret0, _ := ret[0].(domain.FlushResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FlushSync indicates an expected call of FlushSync.
+func (mr *MockEventRepositoryMockRecorder) FlushSync() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FlushSync", reflect.TypeOf((*MockEventRepository)(nil).FlushSync))
+}
+
 // GetBrowsersDevicesOS mocks base method.
-func (m *MockEventRepository) GetBrowsersDevicesOS(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
+func (m *MockEventRepository) GetBrowsersDevicesOS(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetBrowsersDevicesOS", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetBrowsersDevicesOS", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetBrowsersDevicesOS indicates an expected call of GetBrowsersDevicesOS.
-func (mr *MockEventRepositoryMockRecorder) GetBrowsersDevicesOS(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetBrowsersDevicesOS(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBrowsersDevicesOS", reflect.TypeOf((*MockEventRepository)(nil).GetBrowsersDevicesOS), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBrowsersDevicesOS", reflect.TypeOf((*MockEventRepository)(nil).GetBrowsersDevicesOS), ctx, startDate, endDate, limit, filters)
 }
 
-// GetChannels mocks base method.
-func (m *MockEventRepository) GetChannels(startDate, endDate time.Time, filters map[string]string) ([]map[string]any, error) {
+// GetChannelLandingPages mocks base method.
+func (m *MockEventRepository) GetChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetChannels", startDate, endDate, filters)
+	ret := m.ctrl.Call(m, "GetChannelLandingPages", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].([]map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// GetChannelLandingPages indicates an expected call of GetChannelLandingPages.
+func (mr *MockEventRepositoryMockRecorder) GetChannelLandingPages(ctx, startDate, endDate, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChannelLandingPages", reflect.TypeOf((*MockEventRepository)(nil).GetChannelLandingPages), ctx, startDate, endDate, limit, filters)
+}
+
+// GetChannels mocks base method.
+func (m *MockEventRepository) GetChannels(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.ChannelResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChannels", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].([]domain.ChannelResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // GetChannels indicates an expected call of GetChannels.
-func (mr *MockEventRepositoryMockRecorder) GetChannels(startDate, endDate, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetChannels(ctx, startDate, endDate, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChannels", reflect.TypeOf((*MockEventRepository)(nil).GetChannels), startDate, endDate, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChannels", reflect.TypeOf((*MockEventRepository)(nil).GetChannels), ctx, startDate, endDate, filters)
 }
 
 // GetEntryExitPages mocks base method.
-func (m *MockEventRepository) GetEntryExitPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
+func (m *MockEventRepository) GetEntryExitPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetEntryExitPages", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetEntryExitPages", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetEntryExitPages indicates an expected call of GetEntryExitPages.
-func (mr *MockEventRepositoryMockRecorder) GetEntryExitPages(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetEntryExitPages(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntryExitPages", reflect.TypeOf((*MockEventRepository)(nil).GetEntryExitPages), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntryExitPages", reflect.TypeOf((*MockEventRepository)(nil).GetEntryExitPages), ctx, startDate, endDate, limit, filters)
 }
 
 // GetEvents mocks base method.
-func (m *MockEventRepository) GetEvents(startDate, endDate time.Time, limit, offset int) (map[string]any, error) {
+func (m *MockEventRepository) GetEvents(ctx context.Context, startDate, endDate time.Time, limit, offset int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetEvents", startDate, endDate, limit, offset)
+	ret := m.ctrl.Call(m, "GetEvents", ctx, startDate, endDate, limit, offset, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetEvents indicates an expected call of GetEvents.
-func (mr *MockEventRepositoryMockRecorder) GetEvents(startDate, endDate, limit, offset any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetEvents(ctx, startDate, endDate, limit, offset, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvents", reflect.TypeOf((*MockEventRepository)(nil).GetEvents), ctx, startDate, endDate, limit, offset, filters)
+}
+
+// GetFilterValues mocks base method.
+func (m *MockEventRepository) GetFilterValues(ctx context.Context, startDate, endDate time.Time, fields []string, filters map[string]string) (map[string][]domain.FilterValue, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFilterValues", ctx, startDate, endDate, fields, filters)
+	ret0, _ := ret[0].(map[string][]domain.FilterValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFilterValues indicates an expected call of GetFilterValues.
+func (mr *MockEventRepositoryMockRecorder) GetFilterValues(ctx, startDate, endDate, fields, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvents", reflect.TypeOf((*MockEventRepository)(nil).GetEvents), startDate, endDate, limit, offset)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFilterValues", reflect.TypeOf((*MockEventRepository)(nil).GetFilterValues), ctx, startDate, endDate, fields, filters)
 }
 
 // GetFunnelAnalysis mocks base method.
-func (m *MockEventRepository) GetFunnelAnalysis(request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
+func (m *MockEventRepository) GetFunnelAnalysis(ctx context.Context, request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetFunnelAnalysis", request)
+	ret := m.ctrl.Call(m, "GetFunnelAnalysis", ctx, request)
 	ret0, _ := ret[0].(*domain.FunnelAnalysisResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetFunnelAnalysis indicates an expected call of GetFunnelAnalysis.
-func (mr *MockEventRepositoryMockRecorder) GetFunnelAnalysis(request any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetFunnelAnalysis(ctx, request any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFunnelAnalysis", reflect.TypeOf((*MockEventRepository)(nil).GetFunnelAnalysis), request)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFunnelAnalysis", reflect.TypeOf((*MockEventRepository)(nil).GetFunnelAnalysis), ctx, request)
+}
+
+// GetGoal mocks base method.
+func (m *MockEventRepository) GetGoal(ctx context.Context, id int64) (domain.Goal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGoal", ctx, id)
+	ret0, _ := ret[0].(domain.Goal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGoal indicates an expected call of GetGoal.
+func (mr *MockEventRepositoryMockRecorder) GetGoal(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGoal", reflect.TypeOf((*MockEventRepository)(nil).GetGoal), ctx, id)
+}
+
+// GetGoalConversions mocks base method.
+func (m *MockEventRepository) GetGoalConversions(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.GoalConversion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGoalConversions", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].([]domain.GoalConversion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGoalConversions indicates an expected call of GetGoalConversions.
+func (mr *MockEventRepositoryMockRecorder) GetGoalConversions(ctx, startDate, endDate, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGoalConversions", reflect.TypeOf((*MockEventRepository)(nil).GetGoalConversions), ctx, startDate, endDate, filters)
+}
+
+// GetGoals mocks base method.
+func (m *MockEventRepository) GetGoals(ctx context.Context) ([]domain.Goal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGoals", ctx)
+	ret0, _ := ret[0].([]domain.Goal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGoals indicates an expected call of GetGoals.
+func (mr *MockEventRepositoryMockRecorder) GetGoals(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGoals", reflect.TypeOf((*MockEventRepository)(nil).GetGoals), ctx)
+}
+
+// GetLifetimeUniqueUsers mocks base method.
+func (m *MockEventRepository) GetLifetimeUniqueUsers(ctx context.Context) (domain.LifetimeUsers, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLifetimeUniqueUsers", ctx)
+	ret0, _ := ret[0].(domain.LifetimeUsers)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLifetimeUniqueUsers indicates an expected call of GetLifetimeUniqueUsers.
+func (mr *MockEventRepositoryMockRecorder) GetLifetimeUniqueUsers(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLifetimeUniqueUsers", reflect.TypeOf((*MockEventRepository)(nil).GetLifetimeUniqueUsers), ctx)
+}
+
+// GetNewVsReturning mocks base method.
+func (m *MockEventRepository) GetNewVsReturning(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNewVsReturning", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].(map[string]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNewVsReturning indicates an expected call of GetNewVsReturning.
+func (mr *MockEventRepositoryMockRecorder) GetNewVsReturning(ctx, startDate, endDate, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNewVsReturning", reflect.TypeOf((*MockEventRepository)(nil).GetNewVsReturning), ctx, startDate, endDate, filters)
 }
 
 // GetOnlineUsers mocks base method.
-func (m *MockEventRepository) GetOnlineUsers(timeWindow int) (map[string]any, error) {
+func (m *MockEventRepository) GetOnlineUsers(ctx context.Context, timeWindow int) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOnlineUsers", timeWindow)
+	ret := m.ctrl.Call(m, "GetOnlineUsers", ctx, timeWindow)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetOnlineUsers indicates an expected call of GetOnlineUsers.
-func (mr *MockEventRepositoryMockRecorder) GetOnlineUsers(timeWindow any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetOnlineUsers(ctx, timeWindow any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOnlineUsers", reflect.TypeOf((*MockEventRepository)(nil).GetOnlineUsers), timeWindow)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOnlineUsers", reflect.TypeOf((*MockEventRepository)(nil).GetOnlineUsers), ctx, timeWindow)
 }
 
 // GetProjects mocks base method.
-func (m *MockEventRepository) GetProjects() ([]string, error) {
+func (m *MockEventRepository) GetProjects(ctx context.Context) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetProjects")
+	ret := m.ctrl.Call(m, "GetProjects", ctx)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetProjects indicates an expected call of GetProjects.
-func (mr *MockEventRepositoryMockRecorder) GetProjects() *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetProjects(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProjects", reflect.TypeOf((*MockEventRepository)(nil).GetProjects))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProjects", reflect.TypeOf((*MockEventRepository)(nil).GetProjects), ctx)
+}
+
+// GetRecentEvents mocks base method.
+func (m *MockEventRepository) GetRecentEvents(ctx context.Context, limit int) ([]domain.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRecentEvents", ctx, limit)
+	ret0, _ := ret[0].([]domain.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRecentEvents indicates an expected call of GetRecentEvents.
+func (mr *MockEventRepositoryMockRecorder) GetRecentEvents(ctx, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecentEvents", reflect.TypeOf((*MockEventRepository)(nil).GetRecentEvents), ctx, limit)
+}
+
+// GetScreenSizes mocks base method.
+func (m *MockEventRepository) GetScreenSizes(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]map[string]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScreenSizes", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].([]map[string]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetScreenSizes indicates an expected call of GetScreenSizes.
+func (mr *MockEventRepositoryMockRecorder) GetScreenSizes(ctx, startDate, endDate, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScreenSizes", reflect.TypeOf((*MockEventRepository)(nil).GetScreenSizes), ctx, startDate, endDate, filters)
 }
 
 // GetStats mocks base method.
-func (m *MockEventRepository) GetStats(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
+func (m *MockEventRepository) GetStats(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetStats", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetStats", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetStats indicates an expected call of GetStats.
-func (mr *MockEventRepositoryMockRecorder) GetStats(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetStats(ctx, startDate, endDate, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockEventRepository)(nil).GetStats), ctx, startDate, endDate, limit, filters)
+}
+
+// GetStickiness mocks base method.
+func (m *MockEventRepository) GetStickiness(ctx context.Context, endDate time.Time, filters map[string]string) (int, int, int, float64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStickiness", ctx, endDate, filters)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(int)
+	ret3, _ := ret[3].(float64)
+	ret4, _ := ret[4].(error)
+	return ret0, ret1, ret2, ret3, ret4
+}
+
+// GetStickiness indicates an expected call of GetStickiness.
+func (mr *MockEventRepositoryMockRecorder) GetStickiness(ctx, endDate, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockEventRepository)(nil).GetStats), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStickiness", reflect.TypeOf((*MockEventRepository)(nil).GetStickiness), ctx, endDate, filters)
+}
+
+// GetStorageStats mocks base method.
+func (m *MockEventRepository) GetStorageStats(ctx context.Context) (domain.StorageStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStorageStats", ctx)
+	ret0, _ := ret[0].(domain.StorageStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStorageStats indicates an expected call of GetStorageStats.
+func (mr *MockEventRepositoryMockRecorder) GetStorageStats(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStorageStats", reflect.TypeOf((*MockEventRepository)(nil).GetStorageStats), ctx)
 }
 
 // GetTimeline mocks base method.
-func (m *MockEventRepository) GetTimeline(startDate, endDate time.Time, filters map[string]string) (map[string]any, error) {
+func (m *MockEventRepository) GetTimeline(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTimeline", startDate, endDate, filters)
+	ret := m.ctrl.Call(m, "GetTimeline", ctx, startDate, endDate, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetTimeline indicates an expected call of GetTimeline.
-func (mr *MockEventRepositoryMockRecorder) GetTimeline(startDate, endDate, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetTimeline(ctx, startDate, endDate, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTimeline", reflect.TypeOf((*MockEventRepository)(nil).GetTimeline), startDate, endDate, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTimeline", reflect.TypeOf((*MockEventRepository)(nil).GetTimeline), ctx, startDate, endDate, filters)
 }
 
 // GetTopCountries mocks base method.
-func (m *MockEventRepository) GetTopCountries(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, error) {
+func (m *MockEventRepository) GetTopCountries(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopCountries", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetTopCountries", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].([]map[string]any)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetTopCountries indicates an expected call of GetTopCountries.
-func (mr *MockEventRepositoryMockRecorder) GetTopCountries(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetTopCountries(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopCountries", reflect.TypeOf((*MockEventRepository)(nil).GetTopCountries), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopCountries", reflect.TypeOf((*MockEventRepository)(nil).GetTopCountries), ctx, startDate, endDate, limit, filters)
 }
 
 // GetTopEvents mocks base method.
-func (m *MockEventRepository) GetTopEvents(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, error) {
+func (m *MockEventRepository) GetTopEvents(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopEvents", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetTopEvents", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].([]map[string]any)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetTopEvents indicates an expected call of GetTopEvents.
-func (mr *MockEventRepositoryMockRecorder) GetTopEvents(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetTopEvents(ctx, startDate, endDate, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopEvents", reflect.TypeOf((*MockEventRepository)(nil).GetTopEvents), ctx, startDate, endDate, limit, filters)
+}
+
+// GetTopLanguages mocks base method.
+func (m *MockEventRepository) GetTopLanguages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTopLanguages", ctx, startDate, endDate, limit, filters)
+	ret0, _ := ret[0].([]map[string]any)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTopLanguages indicates an expected call of GetTopLanguages.
+func (mr *MockEventRepositoryMockRecorder) GetTopLanguages(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopEvents", reflect.TypeOf((*MockEventRepository)(nil).GetTopEvents), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopLanguages", reflect.TypeOf((*MockEventRepository)(nil).GetTopLanguages), ctx, startDate, endDate, limit, filters)
 }
 
 // GetTopPages mocks base method.
-func (m *MockEventRepository) GetTopPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
+func (m *MockEventRepository) GetTopPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopPages", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetTopPages", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetTopPages indicates an expected call of GetTopPages.
-func (mr *MockEventRepositoryMockRecorder) GetTopPages(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetTopPages(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopPages", reflect.TypeOf((*MockEventRepository)(nil).GetTopPages), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopPages", reflect.TypeOf((*MockEventRepository)(nil).GetTopPages), ctx, startDate, endDate, limit, filters)
+}
+
+// GetTopRegions mocks base method.
+func (m *MockEventRepository) GetTopRegions(ctx context.Context, startDate, endDate time.Time, level string, limit int, filters map[string]string) ([]map[string]any, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTopRegions", ctx, startDate, endDate, level, limit, filters)
+	ret0, _ := ret[0].([]map[string]any)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTopRegions indicates an expected call of GetTopRegions.
+func (mr *MockEventRepositoryMockRecorder) GetTopRegions(ctx, startDate, endDate, level, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopRegions", reflect.TypeOf((*MockEventRepository)(nil).GetTopRegions), ctx, startDate, endDate, level, limit, filters)
 }
 
 // GetTopSources mocks base method.
-func (m *MockEventRepository) GetTopSources(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, error) {
+func (m *MockEventRepository) GetTopSources(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopSources", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetTopSources", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].([]map[string]any)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetTopSources indicates an expected call of GetTopSources.
-func (mr *MockEventRepositoryMockRecorder) GetTopSources(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetTopSources(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopSources", reflect.TypeOf((*MockEventRepository)(nil).GetTopSources), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopSources", reflect.TypeOf((*MockEventRepository)(nil).GetTopSources), ctx, startDate, endDate, limit, filters)
 }
 
 // GetTopStats mocks base method.
-func (m *MockEventRepository) GetTopStats(startDate, endDate time.Time, filters map[string]string) (map[string]any, error) {
+func (m *MockEventRepository) GetTopStats(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (*domain.TopStatsResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopStats", startDate, endDate, filters)
-	ret0, _ := ret[0].(map[string]any)
+	ret := m.ctrl.Call(m, "GetTopStats", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].(*domain.TopStatsResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetTopStats indicates an expected call of GetTopStats.
-func (mr *MockEventRepositoryMockRecorder) GetTopStats(startDate, endDate, filters any) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) GetTopStats(ctx, startDate, endDate, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopStats", reflect.TypeOf((*MockEventRepository)(nil).GetTopStats), ctx, startDate, endDate, filters)
+}
+
+// GetUserSessions mocks base method.
+func (m *MockEventRepository) GetUserSessions(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int, filters map[string]string) ([]domain.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserSessions", ctx, userID, startDate, endDate, limit, offset, filters)
+	ret0, _ := ret[0].([]domain.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserSessions indicates an expected call of GetUserSessions.
+func (mr *MockEventRepositoryMockRecorder) GetUserSessions(ctx, userID, startDate, endDate, limit, offset, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSessions", reflect.TypeOf((*MockEventRepository)(nil).GetUserSessions), ctx, userID, startDate, endDate, limit, offset, filters)
+}
+
+// ReadCSV mocks base method.
+func (m *MockEventRepository) ReadCSV(ctx context.Context, path string, fn func([]string, []string) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadCSV", ctx, path, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReadCSV indicates an expected call of ReadCSV.
+func (mr *MockEventRepositoryMockRecorder) ReadCSV(ctx, path, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadCSV", reflect.TypeOf((*MockEventRepository)(nil).ReadCSV), ctx, path, fn)
+}
+
+// RebuildUserSketch mocks base method.
+func (m *MockEventRepository) RebuildUserSketch(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RebuildUserSketch", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RebuildUserSketch indicates an expected call of RebuildUserSketch.
+func (mr *MockEventRepositoryMockRecorder) RebuildUserSketch(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RebuildUserSketch", reflect.TypeOf((*MockEventRepository)(nil).RebuildUserSketch), ctx)
+}
+
+// Reset mocks base method.
+func (m *MockEventRepository) Reset() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockEventRepositoryMockRecorder) Reset() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockEventRepository)(nil).Reset))
+}
+
+// SampleEvents mocks base method.
+func (m *MockEventRepository) SampleEvents(ctx context.Context, n int) ([]domain.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SampleEvents", ctx, n)
+	ret0, _ := ret[0].([]domain.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SampleEvents indicates an expected call of SampleEvents.
+func (mr *MockEventRepositoryMockRecorder) SampleEvents(ctx, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SampleEvents", reflect.TypeOf((*MockEventRepository)(nil).SampleEvents), ctx, n)
+}
+
+// StartDailyStats mocks base method.
+func (m *MockEventRepository) StartDailyStats(ctx context.Context) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "StartDailyStats", ctx)
+}
+
+// StartDailyStats indicates an expected call of StartDailyStats.
+func (mr *MockEventRepositoryMockRecorder) StartDailyStats(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartDailyStats", reflect.TypeOf((*MockEventRepository)(nil).StartDailyStats), ctx)
+}
+
+// StreamChannelLandingPages mocks base method.
+func (m *MockEventRepository) StreamChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string, emit func(map[string]any) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamChannelLandingPages", ctx, startDate, endDate, limit, filters, emit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamChannelLandingPages indicates an expected call of StreamChannelLandingPages.
+func (mr *MockEventRepositoryMockRecorder) StreamChannelLandingPages(ctx, startDate, endDate, limit, filters, emit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamChannelLandingPages", reflect.TypeOf((*MockEventRepository)(nil).StreamChannelLandingPages), ctx, startDate, endDate, limit, filters, emit)
+}
+
+// UpdateGoal mocks base method.
+func (m *MockEventRepository) UpdateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateGoal", ctx, goal)
+	ret0, _ := ret[0].(domain.Goal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateGoal indicates an expected call of UpdateGoal.
+func (mr *MockEventRepositoryMockRecorder) UpdateGoal(ctx, goal any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateGoal", reflect.TypeOf((*MockEventRepository)(nil).UpdateGoal), ctx, goal)
+}
+
+// WriteSQLite mocks base method.
+func (m *MockEventRepository) WriteSQLite(path string, tables []domain.ExportTable) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteSQLite", path, tables)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteSQLite indicates an expected call of WriteSQLite.
+func (mr *MockEventRepositoryMockRecorder) WriteSQLite(path, tables any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopStats", reflect.TypeOf((*MockEventRepository)(nil).GetTopStats), startDate, endDate, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteSQLite", reflect.TypeOf((*MockEventRepository)(nil).WriteSQLite), path, tables)
 }
@@ -10,6 +10,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 	time "time"
 
@@ -41,214 +42,709 @@ func (m *MockEventService) EXPECT() *MockEventServiceMockRecorder {
 	return m.recorder
 }
 
+// CheckReadiness mocks base method.
+func (m *MockEventService) CheckReadiness(ctx context.Context) domain.Readiness {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckReadiness", ctx)
+	ret0, _ := ret[0].(domain.Readiness)
+	return ret0
+}
+
+// CheckReadiness indicates an expected call of CheckReadiness.
+func (mr *MockEventServiceMockRecorder) CheckReadiness(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckReadiness", reflect.TypeOf((*MockEventService)(nil).CheckReadiness), ctx)
+}
+
+// CompactFiles mocks base method.
+func (m *MockEventService) CompactFiles(ctx context.Context) (domain.CompactionResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompactFiles", ctx)
+	ret0, _ := ret[0].(domain.CompactionResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompactFiles indicates an expected call of CompactFiles.
+func (mr *MockEventServiceMockRecorder) CompactFiles(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompactFiles", reflect.TypeOf((*MockEventService)(nil).CompactFiles), ctx)
+}
+
+// Close mocks base method.
+func (m *MockEventService) Close(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockEventServiceMockRecorder) Close(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockEventService)(nil).Close), ctx)
+}
+
+// CompareSegments mocks base method.
+func (m *MockEventService) CompareSegments(ctx context.Context, startDate, endDate time.Time, a, b map[string]string) (map[string]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareSegments", ctx, startDate, endDate, a, b)
+	ret0, _ := ret[0].(map[string]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareSegments indicates an expected call of CompareSegments.
+func (mr *MockEventServiceMockRecorder) CompareSegments(ctx, startDate, endDate, a, b any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareSegments", reflect.TypeOf((*MockEventService)(nil).CompareSegments), ctx, startDate, endDate, a, b)
+}
+
+// CreateGoal mocks base method.
+func (m *MockEventService) CreateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateGoal", ctx, goal)
+	ret0, _ := ret[0].(domain.Goal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateGoal indicates an expected call of CreateGoal.
+func (mr *MockEventServiceMockRecorder) CreateGoal(ctx, goal any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateGoal", reflect.TypeOf((*MockEventService)(nil).CreateGoal), ctx, goal)
+}
+
+// DataAsOf mocks base method.
+func (m *MockEventService) DataAsOf() time.Time {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DataAsOf")
+	ret0, _ := ret[0].(time.Time)
+	return ret0
+}
+
+// DataAsOf indicates an expected call of DataAsOf.
+func (mr *MockEventServiceMockRecorder) DataAsOf() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DataAsOf", reflect.TypeOf((*MockEventService)(nil).DataAsOf))
+}
+
+// DeleteGoal mocks base method.
+func (m *MockEventService) DeleteGoal(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteGoal", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteGoal indicates an expected call of DeleteGoal.
+func (mr *MockEventServiceMockRecorder) DeleteGoal(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteGoal", reflect.TypeOf((*MockEventService)(nil).DeleteGoal), ctx, id)
+}
+
+// ExplainStats mocks base method.
+func (m *MockEventService) ExplainStats(ctx context.Context, report string, startDate, endDate time.Time, limit int, filters map[string]string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExplainStats", ctx, report, startDate, endDate, limit, filters)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExplainStats indicates an expected call of ExplainStats.
+func (mr *MockEventServiceMockRecorder) ExplainStats(ctx, report, startDate, endDate, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExplainStats", reflect.TypeOf((*MockEventService)(nil).ExplainStats), ctx, report, startDate, endDate, limit, filters)
+}
+
+// ExportParquet mocks base method.
+func (m *MockEventService) ExportParquet(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string, maxRows int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportParquet", ctx, startDate, endDate, filters, path, maxRows)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportParquet indicates an expected call of ExportParquet.
+func (mr *MockEventServiceMockRecorder) ExportParquet(ctx, startDate, endDate, filters, path, maxRows any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportParquet", reflect.TypeOf((*MockEventService)(nil).ExportParquet), ctx, startDate, endDate, filters, path, maxRows)
+}
+
+// ExportSQLite mocks base method.
+func (m *MockEventService) ExportSQLite(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportSQLite", ctx, startDate, endDate, filters, path)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportSQLite indicates an expected call of ExportSQLite.
+func (mr *MockEventServiceMockRecorder) ExportSQLite(ctx, startDate, endDate, filters, path any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportSQLite", reflect.TypeOf((*MockEventService)(nil).ExportSQLite), ctx, startDate, endDate, filters, path)
+}
+
+// FlushEvents mocks base method.
+func (m *MockEventService) FlushEvents() (domain.FlushResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FlushEvents")
+	ret0, _ := ret[0].(domain.FlushResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FlushEvents indicates an expected call of FlushEvents.
+func (mr *MockEventServiceMockRecorder) FlushEvents() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FlushEvents", reflect.TypeOf((*MockEventService)(nil).FlushEvents))
+}
+
+// GetAnomalies mocks base method.
+func (m *MockEventService) GetAnomalies(ctx context.Context, startDate, endDate time.Time, filters map[string]string, metric string) (*domain.AnomalyResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAnomalies", ctx, startDate, endDate, filters, metric)
+	ret0, _ := ret[0].(*domain.AnomalyResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAnomalies indicates an expected call of GetAnomalies.
+func (mr *MockEventServiceMockRecorder) GetAnomalies(ctx, startDate, endDate, filters, metric any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAnomalies", reflect.TypeOf((*MockEventService)(nil).GetAnomalies), ctx, startDate, endDate, filters, metric)
+}
+
 // GetBrowsersDevicesOS mocks base method.
-func (m *MockEventService) GetBrowsersDevicesOS(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
+func (m *MockEventService) GetBrowsersDevicesOS(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetBrowsersDevicesOS", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetBrowsersDevicesOS", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetBrowsersDevicesOS indicates an expected call of GetBrowsersDevicesOS.
-func (mr *MockEventServiceMockRecorder) GetBrowsersDevicesOS(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetBrowsersDevicesOS(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBrowsersDevicesOS", reflect.TypeOf((*MockEventService)(nil).GetBrowsersDevicesOS), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBrowsersDevicesOS", reflect.TypeOf((*MockEventService)(nil).GetBrowsersDevicesOS), ctx, startDate, endDate, limit, filters)
 }
 
-// GetChannels mocks base method.
-func (m *MockEventService) GetChannels(startDate, endDate time.Time, filters map[string]string) ([]map[string]any, error) {
+// GetChannelLandingPages mocks base method.
+func (m *MockEventService) GetChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetChannels", startDate, endDate, filters)
+	ret := m.ctrl.Call(m, "GetChannelLandingPages", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].([]map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// GetChannelLandingPages indicates an expected call of GetChannelLandingPages.
+func (mr *MockEventServiceMockRecorder) GetChannelLandingPages(ctx, startDate, endDate, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChannelLandingPages", reflect.TypeOf((*MockEventService)(nil).GetChannelLandingPages), ctx, startDate, endDate, limit, filters)
+}
+
+// GetChannels mocks base method.
+func (m *MockEventService) GetChannels(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.ChannelResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChannels", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].([]domain.ChannelResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // GetChannels indicates an expected call of GetChannels.
-func (mr *MockEventServiceMockRecorder) GetChannels(startDate, endDate, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetChannels(ctx, startDate, endDate, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChannels", reflect.TypeOf((*MockEventService)(nil).GetChannels), startDate, endDate, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChannels", reflect.TypeOf((*MockEventService)(nil).GetChannels), ctx, startDate, endDate, filters)
 }
 
 // GetEntryExitPages mocks base method.
-func (m *MockEventService) GetEntryExitPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
+func (m *MockEventService) GetEntryExitPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetEntryExitPages", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetEntryExitPages", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetEntryExitPages indicates an expected call of GetEntryExitPages.
-func (mr *MockEventServiceMockRecorder) GetEntryExitPages(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetEntryExitPages(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntryExitPages", reflect.TypeOf((*MockEventService)(nil).GetEntryExitPages), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntryExitPages", reflect.TypeOf((*MockEventService)(nil).GetEntryExitPages), ctx, startDate, endDate, limit, filters)
 }
 
 // GetEvents mocks base method.
-func (m *MockEventService) GetEvents(startDate, endDate time.Time, limit, offset int) (map[string]any, error) {
+func (m *MockEventService) GetEvents(ctx context.Context, startDate, endDate time.Time, limit, offset int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetEvents", startDate, endDate, limit, offset)
+	ret := m.ctrl.Call(m, "GetEvents", ctx, startDate, endDate, limit, offset, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetEvents indicates an expected call of GetEvents.
-func (mr *MockEventServiceMockRecorder) GetEvents(startDate, endDate, limit, offset any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetEvents(ctx, startDate, endDate, limit, offset, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvents", reflect.TypeOf((*MockEventService)(nil).GetEvents), ctx, startDate, endDate, limit, offset, filters)
+}
+
+// GetFilterValues mocks base method.
+func (m *MockEventService) GetFilterValues(ctx context.Context, startDate, endDate time.Time, fields []string, filters map[string]string) (map[string][]domain.FilterValue, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFilterValues", ctx, startDate, endDate, fields, filters)
+	ret0, _ := ret[0].(map[string][]domain.FilterValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFilterValues indicates an expected call of GetFilterValues.
+func (mr *MockEventServiceMockRecorder) GetFilterValues(ctx, startDate, endDate, fields, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvents", reflect.TypeOf((*MockEventService)(nil).GetEvents), startDate, endDate, limit, offset)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFilterValues", reflect.TypeOf((*MockEventService)(nil).GetFilterValues), ctx, startDate, endDate, fields, filters)
 }
 
 // GetFunnelAnalysis mocks base method.
-func (m *MockEventService) GetFunnelAnalysis(request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
+func (m *MockEventService) GetFunnelAnalysis(ctx context.Context, request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetFunnelAnalysis", request)
+	ret := m.ctrl.Call(m, "GetFunnelAnalysis", ctx, request)
 	ret0, _ := ret[0].(*domain.FunnelAnalysisResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetFunnelAnalysis indicates an expected call of GetFunnelAnalysis.
-func (mr *MockEventServiceMockRecorder) GetFunnelAnalysis(request any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetFunnelAnalysis(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFunnelAnalysis", reflect.TypeOf((*MockEventService)(nil).GetFunnelAnalysis), ctx, request)
+}
+
+// GetGoal mocks base method.
+func (m *MockEventService) GetGoal(ctx context.Context, id int64) (domain.Goal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGoal", ctx, id)
+	ret0, _ := ret[0].(domain.Goal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGoal indicates an expected call of GetGoal.
+func (mr *MockEventServiceMockRecorder) GetGoal(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGoal", reflect.TypeOf((*MockEventService)(nil).GetGoal), ctx, id)
+}
+
+// GetGoalConversions mocks base method.
+func (m *MockEventService) GetGoalConversions(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.GoalConversion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGoalConversions", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].([]domain.GoalConversion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGoalConversions indicates an expected call of GetGoalConversions.
+func (mr *MockEventServiceMockRecorder) GetGoalConversions(ctx, startDate, endDate, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGoalConversions", reflect.TypeOf((*MockEventService)(nil).GetGoalConversions), ctx, startDate, endDate, filters)
+}
+
+// GetGoals mocks base method.
+func (m *MockEventService) GetGoals(ctx context.Context) ([]domain.Goal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGoals", ctx)
+	ret0, _ := ret[0].([]domain.Goal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGoals indicates an expected call of GetGoals.
+func (mr *MockEventServiceMockRecorder) GetGoals(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGoals", reflect.TypeOf((*MockEventService)(nil).GetGoals), ctx)
+}
+
+// GetLifetimeUniqueUsers mocks base method.
+func (m *MockEventService) GetLifetimeUniqueUsers(ctx context.Context) (domain.LifetimeUsers, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLifetimeUniqueUsers", ctx)
+	ret0, _ := ret[0].(domain.LifetimeUsers)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLifetimeUniqueUsers indicates an expected call of GetLifetimeUniqueUsers.
+func (mr *MockEventServiceMockRecorder) GetLifetimeUniqueUsers(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLifetimeUniqueUsers", reflect.TypeOf((*MockEventService)(nil).GetLifetimeUniqueUsers), ctx)
+}
+
+// GetNewVsReturning mocks base method.
+func (m *MockEventService) GetNewVsReturning(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNewVsReturning", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].(map[string]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNewVsReturning indicates an expected call of GetNewVsReturning.
+func (mr *MockEventServiceMockRecorder) GetNewVsReturning(ctx, startDate, endDate, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFunnelAnalysis", reflect.TypeOf((*MockEventService)(nil).GetFunnelAnalysis), request)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNewVsReturning", reflect.TypeOf((*MockEventService)(nil).GetNewVsReturning), ctx, startDate, endDate, filters)
 }
 
 // GetOnlineUsers mocks base method.
-func (m *MockEventService) GetOnlineUsers(timeWindow int) (map[string]any, error) {
+func (m *MockEventService) GetOnlineUsers(ctx context.Context, timeWindow int) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOnlineUsers", timeWindow)
+	ret := m.ctrl.Call(m, "GetOnlineUsers", ctx, timeWindow)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetOnlineUsers indicates an expected call of GetOnlineUsers.
-func (mr *MockEventServiceMockRecorder) GetOnlineUsers(timeWindow any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetOnlineUsers(ctx, timeWindow any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOnlineUsers", reflect.TypeOf((*MockEventService)(nil).GetOnlineUsers), timeWindow)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOnlineUsers", reflect.TypeOf((*MockEventService)(nil).GetOnlineUsers), ctx, timeWindow)
 }
 
 // GetProjects mocks base method.
-func (m *MockEventService) GetProjects() ([]string, error) {
+func (m *MockEventService) GetProjects(ctx context.Context) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetProjects")
+	ret := m.ctrl.Call(m, "GetProjects", ctx)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetProjects indicates an expected call of GetProjects.
-func (mr *MockEventServiceMockRecorder) GetProjects() *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetProjects(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProjects", reflect.TypeOf((*MockEventService)(nil).GetProjects))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProjects", reflect.TypeOf((*MockEventService)(nil).GetProjects), ctx)
+}
+
+// GetRecentEvents mocks base method.
+func (m *MockEventService) GetRecentEvents(ctx context.Context, limit int) ([]domain.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRecentEvents", ctx, limit)
+	ret0, _ := ret[0].([]domain.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRecentEvents indicates an expected call of GetRecentEvents.
+func (mr *MockEventServiceMockRecorder) GetRecentEvents(ctx, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecentEvents", reflect.TypeOf((*MockEventService)(nil).GetRecentEvents), ctx, limit)
+}
+
+// GetScreenSizes mocks base method.
+func (m *MockEventService) GetScreenSizes(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]map[string]any, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScreenSizes", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].([]map[string]any)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetScreenSizes indicates an expected call of GetScreenSizes.
+func (mr *MockEventServiceMockRecorder) GetScreenSizes(ctx, startDate, endDate, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScreenSizes", reflect.TypeOf((*MockEventService)(nil).GetScreenSizes), ctx, startDate, endDate, filters)
 }
 
 // GetStats mocks base method.
-func (m *MockEventService) GetStats(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
+func (m *MockEventService) GetStats(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetStats", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetStats", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetStats indicates an expected call of GetStats.
-func (mr *MockEventServiceMockRecorder) GetStats(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetStats(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockEventService)(nil).GetStats), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockEventService)(nil).GetStats), ctx, startDate, endDate, limit, filters)
+}
+
+// GetStickiness mocks base method.
+func (m *MockEventService) GetStickiness(ctx context.Context, endDate time.Time, filters map[string]string) (int, int, int, float64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStickiness", ctx, endDate, filters)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(int)
+	ret3, _ := ret[3].(float64)
+	ret4, _ := ret[4].(error)
+	return ret0, ret1, ret2, ret3, ret4
+}
+
+// GetStickiness indicates an expected call of GetStickiness.
+func (mr *MockEventServiceMockRecorder) GetStickiness(ctx, endDate, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStickiness", reflect.TypeOf((*MockEventService)(nil).GetStickiness), ctx, endDate, filters)
+}
+
+// GetStorageStats mocks base method.
+func (m *MockEventService) GetStorageStats(ctx context.Context) (domain.StorageStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStorageStats", ctx)
+	ret0, _ := ret[0].(domain.StorageStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStorageStats indicates an expected call of GetStorageStats.
+func (mr *MockEventServiceMockRecorder) GetStorageStats(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStorageStats", reflect.TypeOf((*MockEventService)(nil).GetStorageStats), ctx)
 }
 
 // GetTimeline mocks base method.
-func (m *MockEventService) GetTimeline(startDate, endDate time.Time, filters map[string]string) (map[string]any, error) {
+func (m *MockEventService) GetTimeline(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTimeline", startDate, endDate, filters)
+	ret := m.ctrl.Call(m, "GetTimeline", ctx, startDate, endDate, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetTimeline indicates an expected call of GetTimeline.
-func (mr *MockEventServiceMockRecorder) GetTimeline(startDate, endDate, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetTimeline(ctx, startDate, endDate, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTimeline", reflect.TypeOf((*MockEventService)(nil).GetTimeline), startDate, endDate, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTimeline", reflect.TypeOf((*MockEventService)(nil).GetTimeline), ctx, startDate, endDate, filters)
 }
 
 // GetTopCountries mocks base method.
-func (m *MockEventService) GetTopCountries(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, error) {
+func (m *MockEventService) GetTopCountries(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopCountries", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetTopCountries", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].([]map[string]any)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetTopCountries indicates an expected call of GetTopCountries.
-func (mr *MockEventServiceMockRecorder) GetTopCountries(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetTopCountries(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopCountries", reflect.TypeOf((*MockEventService)(nil).GetTopCountries), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopCountries", reflect.TypeOf((*MockEventService)(nil).GetTopCountries), ctx, startDate, endDate, limit, filters)
 }
 
 // GetTopEvents mocks base method.
-func (m *MockEventService) GetTopEvents(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, error) {
+func (m *MockEventService) GetTopEvents(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopEvents", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetTopEvents", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].([]map[string]any)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetTopEvents indicates an expected call of GetTopEvents.
-func (mr *MockEventServiceMockRecorder) GetTopEvents(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetTopEvents(ctx, startDate, endDate, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopEvents", reflect.TypeOf((*MockEventService)(nil).GetTopEvents), ctx, startDate, endDate, limit, filters)
+}
+
+// GetTopLanguages mocks base method.
+func (m *MockEventService) GetTopLanguages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTopLanguages", ctx, startDate, endDate, limit, filters)
+	ret0, _ := ret[0].([]map[string]any)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTopLanguages indicates an expected call of GetTopLanguages.
+func (mr *MockEventServiceMockRecorder) GetTopLanguages(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopEvents", reflect.TypeOf((*MockEventService)(nil).GetTopEvents), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopLanguages", reflect.TypeOf((*MockEventService)(nil).GetTopLanguages), ctx, startDate, endDate, limit, filters)
 }
 
 // GetTopPages mocks base method.
-func (m *MockEventService) GetTopPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
+func (m *MockEventService) GetTopPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]any, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopPages", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetTopPages", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].(map[string]any)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetTopPages indicates an expected call of GetTopPages.
-func (mr *MockEventServiceMockRecorder) GetTopPages(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetTopPages(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopPages", reflect.TypeOf((*MockEventService)(nil).GetTopPages), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopPages", reflect.TypeOf((*MockEventService)(nil).GetTopPages), ctx, startDate, endDate, limit, filters)
+}
+
+// GetTopRegions mocks base method.
+func (m *MockEventService) GetTopRegions(ctx context.Context, startDate, endDate time.Time, level string, limit int, filters map[string]string) ([]map[string]any, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTopRegions", ctx, startDate, endDate, level, limit, filters)
+	ret0, _ := ret[0].([]map[string]any)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTopRegions indicates an expected call of GetTopRegions.
+func (mr *MockEventServiceMockRecorder) GetTopRegions(ctx, startDate, endDate, level, limit, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopRegions", reflect.TypeOf((*MockEventService)(nil).GetTopRegions), ctx, startDate, endDate, level, limit, filters)
 }
 
 // GetTopSources mocks base method.
-func (m *MockEventService) GetTopSources(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, error) {
+func (m *MockEventService) GetTopSources(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]any, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopSources", startDate, endDate, limit, filters)
+	ret := m.ctrl.Call(m, "GetTopSources", ctx, startDate, endDate, limit, filters)
 	ret0, _ := ret[0].([]map[string]any)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetTopSources indicates an expected call of GetTopSources.
-func (mr *MockEventServiceMockRecorder) GetTopSources(startDate, endDate, limit, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetTopSources(ctx, startDate, endDate, limit, filters any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopSources", reflect.TypeOf((*MockEventService)(nil).GetTopSources), startDate, endDate, limit, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopSources", reflect.TypeOf((*MockEventService)(nil).GetTopSources), ctx, startDate, endDate, limit, filters)
 }
 
 // GetTopStats mocks base method.
-func (m *MockEventService) GetTopStats(startDate, endDate time.Time, filters map[string]string) (map[string]any, error) {
+func (m *MockEventService) GetTopStats(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (*domain.TopStatsResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetTopStats", startDate, endDate, filters)
-	ret0, _ := ret[0].(map[string]any)
+	ret := m.ctrl.Call(m, "GetTopStats", ctx, startDate, endDate, filters)
+	ret0, _ := ret[0].(*domain.TopStatsResult)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetTopStats indicates an expected call of GetTopStats.
-func (mr *MockEventServiceMockRecorder) GetTopStats(startDate, endDate, filters any) *gomock.Call {
+func (mr *MockEventServiceMockRecorder) GetTopStats(ctx, startDate, endDate, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopStats", reflect.TypeOf((*MockEventService)(nil).GetTopStats), ctx, startDate, endDate, filters)
+}
+
+// GetUserSessions mocks base method.
+func (m *MockEventService) GetUserSessions(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int, filters map[string]string) ([]domain.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserSessions", ctx, userID, startDate, endDate, limit, offset, filters)
+	ret0, _ := ret[0].([]domain.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserSessions indicates an expected call of GetUserSessions.
+func (mr *MockEventServiceMockRecorder) GetUserSessions(ctx, userID, startDate, endDate, limit, offset, filters any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSessions", reflect.TypeOf((*MockEventService)(nil).GetUserSessions), ctx, userID, startDate, endDate, limit, offset, filters)
+}
+
+// ImportEvents mocks base method.
+func (m *MockEventService) ImportEvents(ctx context.Context, path, format string, strict bool, prepare func(*domain.Event) error) (domain.ImportResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportEvents", ctx, path, format, strict, prepare)
+	ret0, _ := ret[0].(domain.ImportResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportEvents indicates an expected call of ImportEvents.
+func (mr *MockEventServiceMockRecorder) ImportEvents(ctx, path, format, strict, prepare any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopStats", reflect.TypeOf((*MockEventService)(nil).GetTopStats), startDate, endDate, filters)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportEvents", reflect.TypeOf((*MockEventService)(nil).ImportEvents), ctx, path, format, strict, prepare)
+}
+
+// RebuildUserSketch mocks base method.
+func (m *MockEventService) RebuildUserSketch(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RebuildUserSketch", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RebuildUserSketch indicates an expected call of RebuildUserSketch.
+func (mr *MockEventServiceMockRecorder) RebuildUserSketch(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RebuildUserSketch", reflect.TypeOf((*MockEventService)(nil).RebuildUserSketch), ctx)
+}
+
+// RecentTracked mocks base method.
+func (m *MockEventService) RecentTracked(limit int) []domain.Event {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecentTracked", limit)
+	ret0, _ := ret[0].([]domain.Event)
+	return ret0
+}
+
+// RecentTracked indicates an expected call of RecentTracked.
+func (mr *MockEventServiceMockRecorder) RecentTracked(limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecentTracked", reflect.TypeOf((*MockEventService)(nil).RecentTracked), limit)
+}
+
+// ResetData mocks base method.
+func (m *MockEventService) ResetData() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetData")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetData indicates an expected call of ResetData.
+func (mr *MockEventServiceMockRecorder) ResetData() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetData", reflect.TypeOf((*MockEventService)(nil).ResetData))
+}
+
+// SampleEvents mocks base method.
+func (m *MockEventService) SampleEvents(ctx context.Context, n int) ([]domain.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SampleEvents", ctx, n)
+	ret0, _ := ret[0].([]domain.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SampleEvents indicates an expected call of SampleEvents.
+func (mr *MockEventServiceMockRecorder) SampleEvents(ctx, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SampleEvents", reflect.TypeOf((*MockEventService)(nil).SampleEvents), ctx, n)
+}
+
+// StreamChannelLandingPages mocks base method.
+func (m *MockEventService) StreamChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string, emit func(map[string]any) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamChannelLandingPages", ctx, startDate, endDate, limit, filters, emit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamChannelLandingPages indicates an expected call of StreamChannelLandingPages.
+func (mr *MockEventServiceMockRecorder) StreamChannelLandingPages(ctx, startDate, endDate, limit, filters, emit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamChannelLandingPages", reflect.TypeOf((*MockEventService)(nil).StreamChannelLandingPages), ctx, startDate, endDate, limit, filters, emit)
+}
+
+// SubscribeEvents mocks base method.
+func (m *MockEventService) SubscribeEvents(project string) (<-chan domain.Event, func()) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeEvents", project)
+	ret0, _ := ret[0].(<-chan domain.Event)
+	ret1, _ := ret[1].(func())
+	return ret0, ret1
+}
+
+// SubscribeEvents indicates an expected call of SubscribeEvents.
+func (mr *MockEventServiceMockRecorder) SubscribeEvents(project any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeEvents", reflect.TypeOf((*MockEventService)(nil).SubscribeEvents), project)
 }
 
 // TrackEvent mocks base method.
@@ -278,3 +774,18 @@ func (mr *MockEventServiceMockRecorder) TrackEventBatch(events any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrackEventBatch", reflect.TypeOf((*MockEventService)(nil).TrackEventBatch), events)
 }
+
+// UpdateGoal mocks base method.
+func (m *MockEventService) UpdateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateGoal", ctx, goal)
+	ret0, _ := ret[0].(domain.Goal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateGoal indicates an expected call of UpdateGoal.
+func (mr *MockEventServiceMockRecorder) UpdateGoal(ctx, goal any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateGoal", reflect.TypeOf((*MockEventService)(nil).UpdateGoal), ctx, goal)
+}
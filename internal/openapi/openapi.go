@@ -0,0 +1,252 @@
+// Package openapi holds the types of an OpenAPI 3 document, enough of the
+// specification to describe the Siraaj API and generate clients from it.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI specification version documents are written in
+const Version = "3.0.3"
+
+// Document is the root of an OpenAPI document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL the API is served from
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups operations in generated clients and documentation
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of one path by HTTP method
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+// Operations returns the operations of the path by HTTP method
+func (p *PathItem) Operations() map[string]*Operation {
+	operations := map[string]*Operation{}
+	for method, op := range map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPost:   p.Post,
+		http.MethodPut:    p.Put,
+		http.MethodDelete: p.Delete,
+	} {
+		if op != nil {
+			operations[method] = op
+		}
+	}
+	return operations
+}
+
+// Operation is one method of a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a query, path or header parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // query, path or header
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation accepts
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is one status of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Header is a response header
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType is the schema of a body in one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema describes a JSON value. Ref, when set, points to a schema in the
+// components and the other fields are left empty.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Components holds the schemas and security schemes operations refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way of authenticating requests
+type SecurityScheme struct {
+	Type   string `json:"type"` // http or apiKey
+	Scheme string `json:"scheme,omitempty"`
+	Name   string `json:"name,omitempty"`
+	In     string `json:"in,omitempty"`
+}
+
+// Ref returns a schema pointing to the component schema name
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ArrayOf returns an array schema of items
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// MapOf returns an object schema whose values all follow values
+func MapOf(values *Schema) *Schema {
+	return &Schema{Type: "object", AdditionalProperties: values}
+}
+
+// JSON returns the content of a JSON body following schema
+func JSON(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
+
+// JSONTyper is implemented by types whose JSON encoding is not what their Go kind
+// suggests, such as a struct that encodes as a number
+type JSONTyper interface {
+	JSONType() (typ string, nullable bool)
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	jsonTyperType = reflect.TypeOf((*JSONTyper)(nil)).Elem()
+)
+
+// SchemaOf describes the JSON encoding of v, a value of a struct, slice, map or
+// basic type, from its Go type and json tags. Pointer fields are nullable and
+// interface fields accept any value. Types implementing JSONTyper are described by
+// the type they report. A struct nested in itself, such as a funnel
+// breakdown, is described as a plain object below the first level.
+func SchemaOf(v interface{}) *Schema {
+	return schemaOfType(reflect.TypeOf(v), map[reflect.Type]bool{})
+}
+
+// schemaOfType describes t; open holds the struct types being described, to stop
+// at recursive ones
+func schemaOfType(t reflect.Type, open map[reflect.Type]bool) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	if t.Kind() != reflect.Ptr && t.Implements(jsonTyperType) {
+		typ, nullable := reflect.Zero(t).Interface().(JSONTyper).JSONType()
+		return &Schema{Type: typ, Nullable: nullable}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := schemaOfType(t.Elem(), open)
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return ArrayOf(schemaOfType(t.Elem(), open))
+	case reflect.Map:
+		return MapOf(schemaOfType(t.Elem(), open))
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if open[t] {
+			return &Schema{Type: "object", Description: "A nested " + t.Name()}
+		}
+		open[t] = true
+		defer delete(open, t)
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(schema, t, open)
+		return schema
+	}
+	// Interfaces and anything else JSON can hold
+	return &Schema{}
+}
+
+// addFields adds the JSON fields of struct type t to schema, flattening embedded
+// structs as encoding/json does
+func addFields(schema *Schema, t reflect.Type, open map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(schema, field.Type, open)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = schemaOfType(field.Type, open)
+	}
+}
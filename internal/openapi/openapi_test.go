@@ -0,0 +1,86 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type embedded struct {
+	Source string `json:"source"`
+}
+
+// percent encodes as a nullable number
+type percent struct{ value *float64 }
+
+func (percent) JSONType() (string, bool) { return "number", true }
+
+type sample struct {
+	embedded
+	ID       int64          `json:"id"`
+	Name     string         `json:"name,omitempty"`
+	Rate     *float64       `json:"rate"`
+	At       time.Time      `json:"at"`
+	Tags     []string       `json:"tags"`
+	Counts   map[string]int `json:"counts"`
+	Value    interface{}    `json:"value"`
+	Share    percent        `json:"share"`
+	Untagged bool
+	Skipped  string `json:"-"`
+	private  string
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema := SchemaOf(sample{})
+
+	if schema.Type != "object" {
+		t.Fatalf("Expected an object, got %q", schema.Type)
+	}
+	expected := map[string]*Schema{
+		"source":   {Type: "string"},
+		"id":       {Type: "integer", Format: "int64"},
+		"name":     {Type: "string"},
+		"rate":     {Type: "number", Format: "double", Nullable: true},
+		"at":       {Type: "string", Format: "date-time"},
+		"tags":     {Type: "array", Items: &Schema{Type: "string"}},
+		"counts":   {Type: "object", AdditionalProperties: &Schema{Type: "integer", Format: "int32"}},
+		"value":    {},
+		"share":    {Type: "number", Nullable: true},
+		"Untagged": {Type: "boolean"},
+	}
+	if !reflect.DeepEqual(schema.Properties, expected) {
+		for name, got := range schema.Properties {
+			if !reflect.DeepEqual(got, expected[name]) {
+				t.Errorf("Property %s: expected %+v, got %+v", name, expected[name], got)
+			}
+		}
+		t.Errorf("Expected properties %v, got %v", len(expected), len(schema.Properties))
+	}
+}
+
+type tree struct {
+	Name     string  `json:"name"`
+	Children []*tree `json:"children"`
+}
+
+func TestSchemaOfRecursiveType(t *testing.T) {
+	schema := SchemaOf(tree{})
+
+	children := schema.Properties["children"]
+	if children == nil || children.Items == nil {
+		t.Fatalf("Expected a children array, got %+v", children)
+	}
+	if nested := children.Items; nested.Type != "object" || nested.Properties != nil || !nested.Nullable {
+		t.Errorf("Expected the nested tree as a plain nullable object, got %+v", nested)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	get, del := &Operation{OperationID: "get"}, &Operation{OperationID: "delete"}
+	item := &PathItem{Get: get, Delete: del}
+
+	expected := map[string]*Operation{"GET": get, "DELETE": del}
+	if got := item.Operations(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,153 @@
+// Package referrerspam recognizes referrer spam: fake referrals sent by spam
+// domains to get their name into analytics reports.
+package referrerspam
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Modes of handling spam referrers, selected with REFERRER_SPAM
+const (
+	ModeExclude = "exclude" // Store the events but leave them out of the top sources (default)
+	ModeDrop    = "drop"    // Discard the events at ingestion
+	ModeOff     = "off"     // Treat spam referrers like any other
+)
+
+// Mode returns the mode selected by REFERRER_SPAM, falling back to ModeExclude for
+// missing or unknown values
+func Mode() string {
+	switch mode := os.Getenv("REFERRER_SPAM"); mode {
+	case ModeDrop, ModeOff:
+		return mode
+	default:
+		return ModeExclude
+	}
+}
+
+// defaultBlocklist holds well-known referrer spam domains
+var defaultBlocklist = []string{
+	"100dollars-seo.com",
+	"4webmasters.org",
+	"7makemoneyonline.com",
+	"best-seo-offer.com",
+	"best-seo-solution.com",
+	"blackhatworth.com",
+	"buttons-for-website.com",
+	"buttons-for-your-website.com",
+	"cenoval.ru",
+	"darodar.com",
+	"econom.co",
+	"floating-share-buttons.com",
+	"free-share-buttons.com",
+	"get-free-traffic-now.com",
+	"hulfingtonpost.com",
+	"humanorightswatch.org",
+	"ilovevitaly.com",
+	"kambasoft.com",
+	"o-o-6-o-o.com",
+	"priceg.com",
+	"rank-checker.online",
+	"savetubevideo.com",
+	"semalt.com",
+	"seo-platform.com",
+	"simple-share-buttons.com",
+	"site-auditor.online",
+	"social-buttons.com",
+	"trafficmonetize.org",
+}
+
+var (
+	mu      sync.RWMutex
+	domains = append([]string(nil), defaultBlocklist...)
+	pattern = compile(domains)
+)
+
+// compile returns a case-insensitive RE2 pattern matching a referrer, full URL or
+// bare host, whose host is one of domains or a subdomain of one
+func compile(domains []string) *regexp.Regexp {
+	quoted := make([]string, len(domains))
+	for i, domain := range domains {
+		quoted[i] = regexp.QuoteMeta(domain)
+	}
+	return regexp.MustCompile(`^(?:[a-z][a-z0-9+.-]*://)?(?:[^/?#@]*@)?(?:[^/?#:]*\.)?(?:` + strings.Join(quoted, "|") + `)\.?(?:[:/?#]|$)`)
+}
+
+// IsSpamReferrer reports whether referrer comes from a blocklisted domain
+func IsSpamReferrer(referrer string) bool {
+	referrer = strings.ToLower(strings.TrimSpace(referrer))
+	if referrer == "" {
+		return false
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return pattern.MatchString(referrer)
+}
+
+// Pattern returns the regular expression IsSpamReferrer matches lowercased
+// referrers against. It is RE2 syntax, so queries can use it with regexp_matches.
+func Pattern() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return pattern.String()
+}
+
+// LoadFile adds the domains listed in path to the blocklist, one per line. Blank
+// lines and lines starting with # are ignored.
+func LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open referrer spam list: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Printf("Warning: failed to close referrer spam list: %v", err)
+		}
+	}()
+
+	var loaded []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(line, "/ \t") {
+			return fmt.Errorf("invalid referrer spam domain %q", line)
+		}
+		loaded = append(loaded, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read referrer spam list: %w", err)
+	}
+
+	Add(loaded...)
+	return nil
+}
+
+// Add adds domains to the blocklist
+func Add(extra ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	seen := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		seen[domain] = true
+	}
+	for _, domain := range extra {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+		if domain != "" && !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	pattern = compile(domains)
+}
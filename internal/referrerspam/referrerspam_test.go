@@ -0,0 +1,93 @@
+package referrerspam
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsSpamReferrer(t *testing.T) {
+	tests := []struct {
+		name     string
+		referrer string
+		expected bool
+	}{
+		// Known spam
+		{"Semalt URL", "http://semalt.com/", true},
+		{"Semalt subdomain", "https://forum.semalt.com/crawler.php?u=example.com", true},
+		{"Buttons for website", "buttons-for-website.com", true},
+		{"Darodar uppercase", "HTTP://DARODAR.COM/", true},
+		{"Ilovevitaly with port", "http://ilovevitaly.com:8080/page", true},
+		{"Trailing dot", "https://semalt.com./", true},
+
+		// Legitimate referrers
+		{"Google", "https://www.google.com/", false},
+		{"Direct", "", false},
+		{"Similar suffix", "https://notsemalt.com/", false},
+		{"Spam domain in path", "https://example.com/semalt.com", false},
+		{"Spam domain in query", "https://example.com/?ref=darodar.com", false},
+		{"Spam domain as prefix", "https://semalt.com.example.org/", false},
+		{"Hacker News", "https://news.ycombinator.com/item?id=1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSpamReferrer(tt.referrer); got != tt.expected {
+				t.Errorf("IsSpamReferrer(%q) = %v, expected %v", tt.referrer, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spam.txt")
+	list := "# Local additions\n\nspammy-seo.example\nWWW.Fake-Traffic.test\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if IsSpamReferrer("https://spammy-seo.example/") {
+		t.Fatal("Expected the domain not to be listed before loading")
+	}
+	if err := LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	for _, referrer := range []string{"https://spammy-seo.example/", "http://fake-traffic.test", "http://www.fake-traffic.test/x", "semalt.com"} {
+		if !IsSpamReferrer(referrer) {
+			t.Errorf("Expected %q to be spam after loading", referrer)
+		}
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.txt")
+	if err := os.WriteFile(invalid, []byte("http://example.com/path\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFile(invalid); err == nil {
+		t.Error("Expected an error for a URL instead of a domain")
+	}
+	if err := LoadFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestMode(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"", ModeExclude},
+		{"exclude", ModeExclude},
+		{"drop", ModeDrop},
+		{"off", ModeOff},
+		{"bogus", ModeExclude},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("REFERRER_SPAM", tt.value)
+			if got := Mode(); got != tt.expected {
+				t.Errorf("Mode() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is where and when digests are sent
+type Config struct {
+	Schedule   *Schedule
+	Project    string   // Only report on this project, "" for all
+	Dir        string   // Write each digest to an HTML file in this directory
+	Recipients []string // Email each digest to these addresses
+	SMTPAddr   string   // host:port of the SMTP server
+	SMTPUser   string
+	SMTPPass   string
+	From       string
+}
+
+// ConfigFromEnv reads the report configuration. Reports are enabled by setting
+// REPORT_DIR, REPORT_RECIPIENTS or both; it returns nil when neither is set.
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{
+		Project: os.Getenv("REPORT_PROJECT"),
+		Dir:     os.Getenv("REPORT_DIR"),
+	}
+	for _, recipient := range strings.Split(os.Getenv("REPORT_RECIPIENTS"), ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			cfg.Recipients = append(cfg.Recipients, recipient)
+		}
+	}
+	if cfg.Dir == "" && len(cfg.Recipients) == 0 {
+		return nil, nil
+	}
+
+	expr := os.Getenv("REPORT_SCHEDULE")
+	if expr == "" {
+		expr = DefaultSchedule
+	}
+	schedule, err := ParseSchedule(expr)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Schedule = schedule
+
+	if len(cfg.Recipients) > 0 {
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, errors.New("SMTP_HOST is required to email reports")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		cfg.SMTPAddr = net.JoinHostPort(host, port)
+		cfg.SMTPUser = os.Getenv("SMTP_USERNAME")
+		cfg.SMTPPass = os.Getenv("SMTP_PASSWORD")
+		cfg.From = os.Getenv("SMTP_FROM")
+		if cfg.From == "" {
+			cfg.From = cfg.SMTPUser
+		}
+		if cfg.From == "" {
+			return nil, errors.New("SMTP_FROM is required to email reports")
+		}
+	}
+	return cfg, nil
+}
+
+// sendMail is smtp.SendMail, replaced in tests
+var sendMail = smtp.SendMail
+
+// deliver writes the rendered digest to Dir and emails it to Recipients
+func (c Config) deliver(digest *Digest, html []byte) error {
+	if c.Dir != "" {
+		if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+		name := "siraaj-report-" + digest.End.Format("2006-01-02")
+		if digest.Project != "" {
+			name += "-" + filepath.Base(digest.Project)
+		}
+		if err := os.WriteFile(filepath.Join(c.Dir, name+".html"), html, 0o644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+
+	if len(c.Recipients) > 0 {
+		var auth smtp.Auth
+		if c.SMTPUser != "" {
+			host, _, _ := net.SplitHostPort(c.SMTPAddr)
+			auth = smtp.PlainAuth("", c.SMTPUser, c.SMTPPass, host)
+		}
+		if err := sendMail(c.SMTPAddr, auth, c.From, c.Recipients, c.message(digest, html)); err != nil {
+			return fmt.Errorf("failed to email report: %w", err)
+		}
+	}
+	return nil
+}
+
+// message is the email for digest, with html as its body
+func (c Config) message(digest *Digest, html []byte) []byte {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.Recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", digest.Subject())
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.Write(html)
+	return []byte(msg.String())
+}
@@ -0,0 +1,281 @@
+// Package report builds a periodic HTML digest of the dashboard's headline stats
+// and sends it by email or writes it to a directory.
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+const (
+	// DigestDays is the length of the period a digest covers
+	DigestDays = 7
+	// DigestLimit is the number of pages and sources listed
+	DigestLimit = 10
+)
+
+// Source is the part of the event service a digest is built from, so the digest
+// shows the same numbers as the dashboard
+type Source interface {
+	GetTopStats(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (*domain.TopStatsResult, error)
+	GetTopPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetTopSources(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetChannels(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.ChannelResult, error)
+}
+
+// Metric is a headline number and its change from the previous period
+type Metric struct {
+	Label  string
+	Value  string
+	Change *float64 // Percent, nil when there is nothing to compare with
+}
+
+// Row is a page or source and its event count
+type Row struct {
+	Name  string
+	Count int64
+}
+
+// ChannelRow is a traffic channel's totals
+type ChannelRow struct {
+	Channel   string
+	Users     int64
+	Visits    int64
+	PageViews int64
+}
+
+// Digest is the content of one report
+type Digest struct {
+	Project    string
+	Start      time.Time
+	End        time.Time
+	Metrics    []Metric
+	TopPages   []Row
+	TopSources []Row
+	Channels   []ChannelRow
+}
+
+// Build gathers the digest for the DigestDays full days before now. Period over
+// period changes compare with the DigestDays before that, as the dashboard does.
+func Build(ctx context.Context, src Source, now time.Time, filters map[string]string) (*Digest, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := today.AddDate(0, 0, -DigestDays)
+	end := today.Add(-time.Nanosecond)
+
+	stats, err := src.GetTopStats(ctx, start, end, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top stats: %w", err)
+	}
+	pages, err := src.GetTopPages(ctx, start, end, DigestLimit, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top pages: %w", err)
+	}
+	sources, _, err := src.GetTopSources(ctx, start, end, DigestLimit, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top sources: %w", err)
+	}
+	channels, err := src.GetChannels(ctx, start, end, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels: %w", err)
+	}
+
+	digest := &Digest{
+		Project: filters["project"],
+		Start:   start,
+		End:     end,
+		Metrics: []Metric{
+			{Label: "Unique visitors", Value: formatCount(stats.UniqueUsers), Change: stats.UsersChange.Value},
+			{Label: "Visits", Value: formatCount(stats.TotalVisits), Change: stats.VisitsChange.Value},
+			{Label: "Page views", Value: formatCount(stats.PageViews), Change: stats.PageViewsChange.Value},
+			{Label: "Events", Value: formatCount(stats.TotalEvents), Change: stats.EventsChange.Value},
+			{Label: "Bounce rate", Value: formatPercent(stats.BounceRate.Value)},
+			{Label: "Visit duration", Value: formatDuration(stats.AvgSessionDuration)},
+		},
+	}
+
+	topPages, _ := pages["top_pages"].([]map[string]interface{})
+	for _, page := range topPages {
+		digest.TopPages = append(digest.TopPages, Row{Name: fmt.Sprint(page["url"]), Count: toInt64(page["count"])})
+	}
+	for _, source := range sources {
+		digest.TopSources = append(digest.TopSources, Row{Name: fmt.Sprint(source["name"]), Count: toInt64(source["count"])})
+	}
+	for _, channel := range channels {
+		digest.Channels = append(digest.Channels, ChannelRow{
+			Channel:   channel.Channel,
+			Users:     channel.UniqueUsers,
+			Visits:    channel.TotalVisits,
+			PageViews: channel.PageViews,
+		})
+	}
+	return digest, nil
+}
+
+// Subject is the email subject of the digest
+func (d *Digest) Subject() string {
+	subject := fmt.Sprintf("Siraaj report %s to %s", d.Start.Format("Jan 2"), d.End.Format("Jan 2, 2006"))
+	if d.Project != "" {
+		subject += " (" + d.Project + ")"
+	}
+	return subject
+}
+
+// Days is the length of the digest's period
+func (d *Digest) Days() int {
+	return DigestDays
+}
+
+// Render returns the digest as an HTML document
+func Render(d *Digest) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := digestTemplate.Execute(&buf, d); err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Reporter sends a digest on every tick of its schedule
+type Reporter struct {
+	src Source
+	cfg Config
+}
+
+// New returns a Reporter for cfg. Call Run to start it.
+func New(src Source, cfg Config) *Reporter {
+	return &Reporter{src: src, cfg: cfg}
+}
+
+// Run sends a digest at every scheduled time until ctx is cancelled. Failed
+// reports are logged and the next one is still sent.
+func (r *Reporter) Run(ctx context.Context) {
+	for {
+		next := r.cfg.Schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("Warning: report schedule never fires, reports disabled")
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := r.Send(ctx, next); err != nil {
+			log.Printf("Error sending report: %v", err)
+		}
+	}
+}
+
+// Send builds the digest as of now and delivers it
+func (r *Reporter) Send(ctx context.Context, now time.Time) error {
+	filters := map[string]string{}
+	if r.cfg.Project != "" {
+		filters["project"] = r.cfg.Project
+	}
+
+	digest, err := Build(ctx, r.src, now, filters)
+	if err != nil {
+		return err
+	}
+	html, err := Render(digest)
+	if err != nil {
+		return err
+	}
+	return r.cfg.deliver(digest, html)
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+func formatCount(value interface{}) string {
+	s := fmt.Sprint(toInt64(value))
+	var out []byte
+	for i := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// formatPercent formats a rate, which is nil when it was suppressed
+func formatPercent(rate *float64) string {
+	if rate == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%%", *rate)
+}
+
+func formatDuration(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).Round(time.Second).String()
+}
+
+func formatChange(change *float64) string {
+	if change == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", *change)
+}
+
+func changeColor(change *float64) string {
+	switch {
+	case change == nil || *change == 0:
+		return "#6b7280"
+	case *change > 0:
+		return "#059669"
+	default:
+		return "#dc2626"
+	}
+}
+
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"change":      formatChange,
+	"changeColor": changeColor,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family: -apple-system, Segoe UI, Helvetica, Arial, sans-serif; color: #111827; max-width: 640px; margin: 0 auto; padding: 24px;">
+<h1 style="font-size: 20px; margin: 0 0 4px;">Siraaj report{{if .Project}}: {{.Project}}{{end}}</h1>
+<p style="color: #6b7280; margin: 0 0 24px;">{{.Start.Format "Mon, Jan 2"}} to {{.End.Format "Mon, Jan 2, 2006"}}, changes compared with the {{.Days}} days before</p>
+<table style="width: 100%; border-collapse: collapse; margin-bottom: 24px;">
+{{range .Metrics}}<tr>
+<td style="padding: 6px 0; border-bottom: 1px solid #e5e7eb;">{{.Label}}</td>
+<td style="padding: 6px 0; border-bottom: 1px solid #e5e7eb; text-align: right; font-weight: 600;">{{.Value}}</td>
+<td style="padding: 6px 0 6px 12px; border-bottom: 1px solid #e5e7eb; text-align: right; color: {{changeColor .Change}};">{{if .Change}}{{change .Change}}{{end}}</td>
+</tr>
+{{end}}</table>
+{{if .TopPages}}<h2 style="font-size: 16px;">Top pages</h2>
+<table style="width: 100%; border-collapse: collapse; margin-bottom: 24px;">
+{{range .TopPages}}<tr><td style="padding: 4px 0; border-bottom: 1px solid #e5e7eb;">{{.Name}}</td><td style="padding: 4px 0; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}{{if .TopSources}}<h2 style="font-size: 16px;">Top sources</h2>
+<table style="width: 100%; border-collapse: collapse; margin-bottom: 24px;">
+{{range .TopSources}}<tr><td style="padding: 4px 0; border-bottom: 1px solid #e5e7eb;">{{.Name}}</td><td style="padding: 4px 0; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Channels}}<h2 style="font-size: 16px;">Channels</h2>
+<table style="width: 100%; border-collapse: collapse;">
+<tr style="color: #6b7280;"><th style="text-align: left; font-weight: normal;">Channel</th><th style="text-align: right; font-weight: normal;">Visitors</th><th style="text-align: right; font-weight: normal;">Visits</th><th style="text-align: right; font-weight: normal;">Page views</th></tr>
+{{range .Channels}}<tr><td style="padding: 4px 0; border-bottom: 1px solid #e5e7eb;">{{.Channel}}</td><td style="padding: 4px 0; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Users}}</td><td style="padding: 4px 0; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.Visits}}</td><td style="padding: 4px 0; border-bottom: 1px solid #e5e7eb; text-align: right;">{{.PageViews}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,149 @@
+package report
+
+import (
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestBuild(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 14, 23, 59, 59, 999999999, time.UTC)
+	filters := map[string]string{"project": "shop"}
+
+	mockService := mocks.NewMockEventService(ctrl)
+	mockService.EXPECT().GetTopStats(gomock.Any(), start, end, filters).Return(&domain.TopStatsResult{
+		UniqueUsers:        1200,
+		TotalVisits:        1500,
+		PageViews:          4200,
+		TotalEvents:        5000,
+		BounceRate:         domain.RateOf(41.5),
+		AvgSessionDuration: 95,
+		UsersChange:        domain.RateOf(12.5),
+		VisitsChange:       domain.RateOf(-4),
+		PageViewsChange:    domain.NullRate(), // Suppressed below RATE_MIN_SAMPLE
+	}, nil)
+	mockService.EXPECT().GetTopPages(gomock.Any(), start, end, DigestLimit, filters).Return(map[string]interface{}{
+		"top_pages": []map[string]interface{}{{"url": "/pricing", "count": 900}},
+	}, nil)
+	mockService.EXPECT().GetTopSources(gomock.Any(), start, end, DigestLimit, filters).Return([]map[string]interface{}{
+		{"name": "google.com", "count": 300},
+	}, 1, nil)
+	mockService.EXPECT().GetChannels(gomock.Any(), start, end, filters).Return([]domain.ChannelResult{
+		{Channel: "Organic", UniqueUsers: 400, TotalVisits: 450, PageViews: 1000},
+	}, nil)
+
+	digest, err := Build(t.Context(), mockService, now, filters)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if digest.Metrics[0].Value != "1,200" || digest.Metrics[0].Change == nil || *digest.Metrics[0].Change != 12.5 {
+		t.Errorf("Unexpected visitors metric: %+v", digest.Metrics[0])
+	}
+	if digest.Metrics[2].Change != nil {
+		t.Errorf("Expected a suppressed page views change, got %v", *digest.Metrics[2].Change)
+	}
+	if digest.Metrics[4].Value != "41.5%" || digest.Metrics[5].Value != "1m35s" {
+		t.Errorf("Unexpected rate metrics: %+v", digest.Metrics[4:])
+	}
+	if len(digest.TopPages) != 1 || digest.TopPages[0] != (Row{Name: "/pricing", Count: 900}) {
+		t.Errorf("Unexpected top pages: %+v", digest.TopPages)
+	}
+	if len(digest.Channels) != 1 || digest.Channels[0].Visits != 450 {
+		t.Errorf("Unexpected channels: %+v", digest.Channels)
+	}
+
+	html, err := Render(digest)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	for _, want := range []string{"Siraaj report: shop", "1,200", "12.5%", "-4.0%", "/pricing", "google.com", "Organic"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("Expected rendered report to contain %q", want)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var sentTo []string
+	var sent []byte
+	sendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:587" || from != "reports@example.com" || auth == nil {
+			t.Errorf("Unexpected SMTP settings: %s %s %v", addr, from, auth)
+		}
+		sentTo, sent = to, msg
+		return nil
+	}
+	defer func() { sendMail = smtp.SendMail }()
+
+	cfg := Config{
+		Dir:        t.TempDir(),
+		Recipients: []string{"team@example.com", "ceo@example.com"},
+		SMTPAddr:   "smtp.example.com:587",
+		SMTPUser:   "reports@example.com",
+		From:       "reports@example.com",
+	}
+	digest := &Digest{
+		Start: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, 1, 14, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := cfg.deliver(digest, []byte("<p>report</p>")); err != nil {
+		t.Fatalf("deliver failed: %v", err)
+	}
+
+	written, err := os.ReadFile(filepath.Join(cfg.Dir, "siraaj-report-2024-01-14.html"))
+	if err != nil || string(written) != "<p>report</p>" {
+		t.Errorf("Expected the report file to be written, got %q, %v", written, err)
+	}
+	if len(sentTo) != 2 {
+		t.Errorf("Expected 2 recipients, got %v", sentTo)
+	}
+	for _, want := range []string{"Subject: Siraaj report Jan 8 to Jan 14, 2024\r\n", "Content-Type: text/html", "<p>report</p>"} {
+		if !strings.Contains(string(sent), want) {
+			t.Errorf("Expected email to contain %q, got %q", want, sent)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("REPORT_DIR", "")
+	t.Setenv("REPORT_RECIPIENTS", "")
+	if cfg, err := ConfigFromEnv(); cfg != nil || err != nil {
+		t.Errorf("Expected reports to be disabled, got %+v, %v", cfg, err)
+	}
+
+	t.Setenv("REPORT_RECIPIENTS", "team@example.com, ceo@example.com")
+	t.Setenv("SMTP_HOST", "")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("Expected an error without SMTP_HOST")
+	}
+
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_USERNAME", "reports@example.com")
+	t.Setenv("REPORT_SCHEDULE", "0 9 * * 5")
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+	if cfg.SMTPAddr != "smtp.example.com:587" || cfg.From != "reports@example.com" || len(cfg.Recipients) != 2 {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	t.Setenv("REPORT_SCHEDULE", "every monday")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("Expected an error for an invalid schedule")
+	}
+}
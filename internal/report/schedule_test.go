@@ -0,0 +1,69 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// Wednesday
+	from := time.Date(2024, 1, 10, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"0 8 * * 1", time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 9, 45, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2024, 1, 11, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)},
+		{"0 7 * * 0", time.Date(2024, 1, 14, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * 7", time.Date(2024, 1, 14, 7, 0, 0, 0, time.UTC)},
+		{"0 6 1,15 * *", time.Date(2024, 1, 15, 6, 0, 0, 0, time.UTC)},
+		{"0 6 29 2 *", time.Date(2024, 2, 29, 6, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either matches
+		{"0 0 20 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseSchedule failed: %v", err)
+			}
+			if got := schedule.Next(from); !got.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestScheduleNeverMatches(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected no next time, got %v", next)
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"0 8 * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("Expected an error for %q", expr)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// bounceMode returns the bounce definition selected by the bounce_mode filter,
+// falling back to single_pageview for missing or unknown values
+func bounceMode(filters map[string]string) string {
+	mode, err := domain.ParseBounceMode(filters["bounce_mode"])
+	if err != nil {
+		return domain.BounceSinglePageview
+	}
+	return mode
+}
+
+// bounceCondition is the condition on a session's view_count and event_count that
+// makes it a bounce under mode
+func bounceCondition(mode string) string {
+	if mode == domain.BounceSingleEvent {
+		return "view_count = 1 AND event_count = 1"
+	}
+	return "view_count = 1"
+}
+
+// bouncedSessionsQuery counts the bounced sessions among the rows matching
+// whereClause. Both modes count against sessions with at least one page view.
+func bouncedSessionsQuery(source, whereClause, mode string) string {
+	return fmt.Sprintf(`
+			WITH session_counts AS (
+				SELECT
+					session_id,
+					COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as view_count,
+					COUNT(*) as event_count
+				FROM %s
+				WHERE %s
+				GROUP BY session_id
+			)
+			SELECT COUNT(*) as single_page_sessions
+			FROM session_counts
+			WHERE %s
+		`, source, whereClause, bounceCondition(mode))
+}
+
+// bounceTimelineQuery returns the bounce_rate timeline: the percentage of sessions
+// with page views that bounced, per dateColumn bucket
+func bounceTimelineQuery(dateColumn, source, whereClause, mode string) string {
+	return fmt.Sprintf(`
+				WITH session_counts AS (
+					SELECT
+						%s as date,
+						session_id,
+						COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as view_count,
+						COUNT(*) as event_count
+					FROM %s
+					WHERE %s
+					GROUP BY date, session_id
+				)
+				SELECT
+					date,
+					CAST(COUNT(CASE WHEN %s THEN 1 END) AS FLOAT) * 100.0 / NULLIF(COUNT(CASE WHEN view_count > 0 THEN 1 END), 0) as count
+				FROM session_counts
+				GROUP BY date
+				ORDER BY date
+			`, dateColumn, source, whereClause, bounceCondition(mode))
+}
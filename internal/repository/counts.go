@@ -0,0 +1,13 @@
+package repository
+
+import "strings"
+
+// distinctCounts returns query with every APPROX_COUNT_DISTINCT(x) replaced by
+// COUNT(DISTINCT x) when exact is set. Queries are written with the approximate
+// form so both modes share one definition.
+func distinctCounts(query string, exact bool) string {
+	if !exact {
+		return query
+	}
+	return strings.ReplaceAll(query, "APPROX_COUNT_DISTINCT(", "COUNT(DISTINCT ")
+}
@@ -0,0 +1,16 @@
+package repository
+
+import "testing"
+
+func TestDistinctCounts(t *testing.T) {
+	query := "SELECT APPROX_COUNT_DISTINCT(user_id), APPROX_COUNT_DISTINCT( CASE WHEN is_bot THEN user_id END) FROM events"
+
+	if got := distinctCounts(query, false); got != query {
+		t.Errorf("Expected query unchanged when not exact, got %q", got)
+	}
+
+	expected := "SELECT COUNT(DISTINCT user_id), COUNT(DISTINCT  CASE WHEN is_bot THEN user_id END) FROM events"
+	if got := distinctCounts(query, true); got != expected {
+		t.Errorf("distinctCounts() = %q, expected %q", got, expected)
+	}
+}
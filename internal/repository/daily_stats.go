@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// The daily_stats table holds the number of events of each UTC day per project,
+// event name, page, country, language, browser, device, OS, referrer domain,
+// channel and bot flag. Top lists that only count events read it instead of
+// scanning raw events when it covers their date range, see eventCountSource.
+// Visitors and visits are distinct counts, which cannot be added up across days
+// or dimensions, so they are not stored and the queries needing them always read
+// raw events.
+//
+// Events can be stored for days the rollup already covers: late tracked events, up
+// to TRACK_MAX_EVENT_AGE old, and imported history. Writes mark the oldest such day
+// stale; queries reaching it read raw events until the next refresh recomputes
+// from it, see markDailyStatsStale.
+
+const (
+	// DefaultDailyStatsInterval is how often daily_stats is refreshed unless
+	// DAILY_STATS_INTERVAL says otherwise
+	DefaultDailyStatsInterval = time.Hour
+
+	// DefaultDailyStatsLookbackDays is how many days before today each refresh
+	// recomputes, for events that arrive after their day has ended
+	DefaultDailyStatsLookbackDays = 3
+)
+
+// dailyStatsUnsupportedFilters are the filters on columns daily_stats does not have
+var dailyStatsUnsupportedFilters = []string{"source", "user_id", "session_id"}
+
+// dailyStatsInterval reads DAILY_STATS_INTERVAL, falling back to
+// DefaultDailyStatsInterval for missing or invalid values. Zero turns the rollup off.
+func dailyStatsInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DAILY_STATS_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultDailyStatsInterval
+}
+
+// dailyStatsLookbackDays reads DAILY_STATS_LOOKBACK_DAYS, falling back to
+// DefaultDailyStatsLookbackDays for missing or invalid values
+func dailyStatsLookbackDays() int {
+	if days, err := strconv.Atoi(os.Getenv("DAILY_STATS_LOOKBACK_DAYS")); err == nil && days >= 0 {
+		return days
+	}
+	return DefaultDailyStatsLookbackDays
+}
+
+// utcDay returns the start of the UTC day of t
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StartDailyStats refreshes daily_stats right away and then every
+// DAILY_STATS_INTERVAL in the background, until ctx is canceled. Close waits for
+// the refresh to stop, so cancel ctx before closing the repository.
+func (r *eventRepository) StartDailyStats(ctx context.Context) {
+	interval := dailyStatsInterval()
+	if interval == 0 {
+		log.Println("Daily stats disabled; top lists read raw events")
+		return
+	}
+	log.Printf("✓ Daily stats refreshed every %s", interval)
+
+	r.jobs.Add(1)
+	go func() {
+		defer r.jobs.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := r.refreshDailyStats(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				log.Printf("Warning: failed to refresh daily stats: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// refreshDailyStats recomputes the daily_stats rows of every day before today (UTC)
+// that is not stored yet, within the lookback or marked stale, in one transaction so
+// queries never see a day half written. Afterwards queries ending before today may
+// use the rollup.
+func (r *eventRepository) refreshDailyStats(ctx context.Context, now time.Time) (err error) {
+	today := utcDay(now)
+
+	// The stale days stay excluded from the rollup while they are recomputed, and
+	// are marked again if that fails. Days written from here on are marked for the
+	// next refresh.
+	stale := r.takeDailyStatsStale()
+	defer func() {
+		if err != nil && stale != 0 {
+			r.markDailyStatsStaleFrom(stale)
+		}
+		r.dailyStatsRefreshing.Store(0)
+	}()
+
+	// Buffered events, including the ones marking stale days, are written first
+	if _, err := r.FlushSync(); err != nil {
+		return fmt.Errorf("failed to flush events: %w", err)
+	}
+
+	var latest sql.NullTime
+	if err := r.db.QueryRowContext(ctx, "SELECT MAX(date_day) FROM daily_stats").Scan(&latest); err != nil {
+		return fmt.Errorf("failed to read daily stats: %w", err)
+	}
+
+	// Without stored days the whole history is computed
+	condition := "date_day < CAST(? AS DATE)"
+	args := []interface{}{today}
+	var from time.Time
+	if latest.Valid {
+		from = today.AddDate(0, 0, -dailyStatsLookbackDays())
+		if next := utcDay(latest.Time).AddDate(0, 0, 1); next.Before(from) {
+			from = next
+		}
+		if stale != 0 && stale < from.Unix() {
+			from = time.Unix(stale, 0).UTC()
+		}
+		condition += " AND date_day >= CAST(? AS DATE)"
+		args = append(args, from)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Warning: failed to roll back daily stats: %v", err)
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM daily_stats WHERE "+condition, args...); err != nil {
+		return fmt.Errorf("failed to clear daily stats: %w", err)
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO daily_stats (
+			date_day, project_id, event_name, url, country, language,
+			browser, device, os, source, channel, is_bot, events
+		)
+		SELECT
+			CAST(date_day AS DATE), project_id, event_name, url, country, language,
+			browser, device, os, %s, channel, is_bot, COUNT(*)
+		FROM %s
+		WHERE %s
+		GROUP BY ALL
+	`, referrerDomainSQL("referrer"), r.getParquetSource(nil), condition)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to compute daily stats: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit daily stats: %w", err)
+	}
+
+	r.dailyStatsThrough.Store(today.AddDate(0, 0, -1).Unix())
+	return nil
+}
+
+// takeDailyStatsStale moves the stale mark to the refreshing mark and returns it.
+// The refreshing mark is set before the stale one is cleared, so dailyStatsCover
+// never sees the stale days unmarked.
+func (r *eventRepository) takeDailyStatsStale() int64 {
+	for {
+		stale := r.dailyStatsStale.Load()
+		r.dailyStatsRefreshing.Store(stale)
+		if r.dailyStatsStale.CompareAndSwap(stale, 0) {
+			return stale
+		}
+	}
+}
+
+// markDailyStatsStale marks the oldest past day of events just written stale.
+// Writes mark after storing, so a refresh taking the mark flushes their events
+// before recomputing.
+func (r *eventRepository) markDailyStatsStale(events ...domain.Event) {
+	today := utcDay(time.Now()).Unix()
+	oldest := today
+	for _, event := range events {
+		oldest = min(oldest, utcDay(event.Timestamp).Unix())
+	}
+	if oldest < today {
+		r.markDailyStatsStaleFrom(oldest)
+	}
+}
+
+// markDailyStatsStaleFrom marks the day starting at Unix time day stale, unless an
+// older one already is
+func (r *eventRepository) markDailyStatsStaleFrom(day int64) {
+	for {
+		marked := r.dailyStatsStale.Load()
+		if marked != 0 && marked <= day {
+			return
+		}
+		if r.dailyStatsStale.CompareAndSwap(marked, day) {
+			return
+		}
+	}
+}
+
+// dailyStatsCover reports whether daily_stats can answer an event count up to
+// endDate: it has been refreshed through that day, no day up to it is stale, days
+// are UTC days of event time as stored, and no filter needs a column it leaves out
+func (r *eventRepository) dailyStatsCover(endDate time.Time, filters map[string]string) bool {
+	through := r.dailyStatsThrough.Load()
+	day := utcDay(endDate).Unix()
+	if through == 0 || day > through {
+		return false
+	}
+	for _, stale := range []int64{r.dailyStatsStale.Load(), r.dailyStatsRefreshing.Load()} {
+		if stale != 0 && day >= stale {
+			return false
+		}
+	}
+	if timeBasis(filters) != domain.TimeBasisEvent || timeZone(filters) != "UTC" {
+		return false
+	}
+	for _, key := range dailyStatsUnsupportedFilters {
+		if filters[key] != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// eventCountSource returns the FROM source and the expression counting its events
+// for a query up to endDate: daily_stats when it covers the query, and the raw
+// events otherwise. rollup tells which, since daily_stats has a source column of
+// referrer domains instead of referrer.
+func (r *eventRepository) eventCountSource(endDate time.Time, filters map[string]string) (source, count string, rollup bool) {
+	if r.dailyStatsCover(endDate, filters) {
+		return "daily_stats", "CAST(SUM(events) AS BIGINT)", true
+	}
+	return r.getStatsSource(filters), "COUNT(*)", false
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestDailyStatsCover(t *testing.T) {
+	t.Setenv("TIME_BASIS", "")
+	t.Setenv("STATS_TZ", "")
+	through := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		through  time.Time
+		endDate  time.Time
+		filters  map[string]string
+		expected bool
+	}{
+		{"Not refreshed yet", time.Time{}, through, nil, false},
+		{"Ends on the last day covered", through, through.Add(23*time.Hour + 59*time.Minute), nil, true},
+		{"Ends earlier", through, through.AddDate(0, -1, 0), nil, true},
+		{"Ends after the last day covered", through, through.AddDate(0, 0, 1), nil, false},
+		{"Covered dimension filters", through, through, map[string]string{"country": "EG", "browser": "Firefox", "event": "signup", "page": "/pricing", "botFilter": "human", "project": "site"}, true},
+		{"Source filter", through, through, map[string]string{"source": "google.com"}, false},
+		{"User filter", through, through, map[string]string{"user_id": "u1"}, false},
+		{"Session filter", through, through, map[string]string{"session_id": "s1"}, false},
+		{"Received time basis", through, through, map[string]string{"time_basis": domain.TimeBasisReceived}, false},
+		{"Other time zone", through, through, map[string]string{"tz": "Africa/Cairo"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &eventRepository{}
+			if !tt.through.IsZero() {
+				repo.dailyStatsThrough.Store(tt.through.Unix())
+			}
+			if got := repo.dailyStatsCover(tt.endDate, tt.filters); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMarkDailyStatsStale(t *testing.T) {
+	t.Setenv("TIME_BASIS", "")
+	t.Setenv("STATS_TZ", "")
+	today := utcDay(time.Now())
+	repo := &eventRepository{}
+	repo.dailyStatsThrough.Store(today.AddDate(0, 0, -1).Unix())
+
+	// Events of today are not in the rollup yet, so they mark nothing
+	repo.markDailyStatsStale(domain.Event{Timestamp: today.Add(time.Hour)})
+	if got := repo.dailyStatsStale.Load(); got != 0 {
+		t.Fatalf("Expected no stale day for today's events, got %v", time.Unix(got, 0).UTC())
+	}
+
+	repo.markDailyStatsStale(
+		domain.Event{Timestamp: today.AddDate(0, 0, -2).Add(5 * time.Hour)},
+		domain.Event{Timestamp: today.AddDate(0, 0, -10).Add(23 * time.Hour)},
+		domain.Event{Timestamp: today},
+	)
+	repo.markDailyStatsStale(domain.Event{Timestamp: today.AddDate(0, 0, -4)})
+	if got, expected := repo.dailyStatsStale.Load(), today.AddDate(0, 0, -10).Unix(); got != expected {
+		t.Errorf("Expected the oldest day %v marked, got %v", time.Unix(expected, 0).UTC(), time.Unix(got, 0).UTC())
+	}
+
+	filters := map[string]string{}
+	if !repo.dailyStatsCover(today.AddDate(0, 0, -11), filters) {
+		t.Error("Expected daily_stats to cover ranges ending before the stale day")
+	}
+	if repo.dailyStatsCover(today.AddDate(0, 0, -10), filters) || repo.dailyStatsCover(today.AddDate(0, 0, -1), filters) {
+		t.Error("Expected ranges reaching the stale day to read raw events")
+	}
+
+	// The same holds for the days a running refresh recomputes
+	if stale := repo.takeDailyStatsStale(); stale != today.AddDate(0, 0, -10).Unix() || repo.dailyStatsStale.Load() != 0 {
+		t.Errorf("Expected the stale mark moved to the refreshing mark, got %v", time.Unix(stale, 0).UTC())
+	}
+	if repo.dailyStatsCover(today.AddDate(0, 0, -1), filters) {
+		t.Error("Expected ranges reaching the days being recomputed to read raw events")
+	}
+}
+
+func TestDailyStatsMatchRawEvents(t *testing.T) {
+	repo := newTestRepository(t).(*eventRepository)
+	now := time.Now().UTC()
+	today := utcDay(now)
+
+	var events []domain.Event
+	for day := 1; day <= 5; day++ {
+		timestamp := today.AddDate(0, 0, -day).Add(12 * time.Hour)
+		for i := 0; i < day; i++ {
+			events = append(events,
+				domain.Event{Timestamp: timestamp, EventName: "page_view", URL: "/", Country: "EG", Browser: "Firefox", Device: "Desktop", OS: "Linux", Language: "ar", Referrer: "https://www.google.com/search"},
+				domain.Event{Timestamp: timestamp, EventName: "signup", URL: "/pricing", Country: "US", Browser: "Chrome", Device: "Mobile", OS: "Android", Language: "en"},
+				domain.Event{Timestamp: timestamp, EventName: "page_view", URL: "/", Country: "US", Referrer: "http://semalt.com/"},
+			)
+		}
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := today.AddDate(0, 0, -7), today.AddDate(0, 0, -1)
+	topLists := func(filters map[string]string) map[string]interface{} {
+		lists := map[string]interface{}{}
+		var err error
+		if lists["countries"], _, err = repo.GetTopCountries(t.Context(), start, end, 10, filters); err != nil {
+			t.Fatalf("GetTopCountries failed: %v", err)
+		}
+		if lists["languages"], _, err = repo.GetTopLanguages(t.Context(), start, end, 10, filters); err != nil {
+			t.Fatalf("GetTopLanguages failed: %v", err)
+		}
+		if lists["sources"], _, err = repo.GetTopSources(t.Context(), start, end, 10, filters); err != nil {
+			t.Fatalf("GetTopSources failed: %v", err)
+		}
+		if lists["events"], _, err = repo.GetTopEvents(t.Context(), start, end, 10, filters); err != nil {
+			t.Fatalf("GetTopEvents failed: %v", err)
+		}
+		if lists["browsers"], err = repo.GetBrowsersDevicesOS(t.Context(), start, end, 10, filters); err != nil {
+			t.Fatalf("GetBrowsersDevicesOS failed: %v", err)
+		}
+		if lists["pages"], err = repo.GetTopPages(t.Context(), start, end, 10, filters); err != nil {
+			t.Fatalf("GetTopPages failed: %v", err)
+		}
+		return lists
+	}
+
+	filterSets := []map[string]string{{}, {"country": "US"}, {"event": "page_view"}, {"page": "/pricing"}}
+	raw := make([]map[string]interface{}, len(filterSets))
+	for i, filters := range filterSets {
+		raw[i] = topLists(filters)
+	}
+
+	if err := repo.refreshDailyStats(t.Context(), now); err != nil {
+		t.Fatalf("refreshDailyStats failed: %v", err)
+	}
+	for i, filters := range filterSets {
+		if _, _, rollup := repo.eventCountSource(end, filters); !rollup {
+			t.Fatalf("Expected daily_stats to cover %v", filters)
+		}
+		if got := topLists(filters); !reflect.DeepEqual(got, raw[i]) {
+			t.Errorf("Filters %v: expected daily_stats to match raw events\nraw:    %v\nrollup: %v", filters, raw[i], got)
+		}
+	}
+
+	// A late event within the lookback is picked up by the next refresh
+	late := domain.Event{Timestamp: today.AddDate(0, 0, -2), EventName: "page_view", URL: "/", Country: "FR"}
+	if err := repo.Create(late); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := repo.refreshDailyStats(t.Context(), now); err != nil {
+		t.Fatalf("refreshDailyStats failed: %v", err)
+	}
+	countries, _, err := repo.GetTopCountries(t.Context(), start, end, 10, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetTopCountries failed: %v", err)
+	}
+	found := false
+	for _, country := range countries {
+		found = found || country["name"] == "FR"
+	}
+	if !found {
+		t.Errorf("Expected the late event to be counted after a refresh, got %v", countries)
+	}
+
+	// So is a backdated event older than the lookback: queries read raw events until
+	// the refresh recomputes its day
+	backdated := domain.Event{Timestamp: today.AddDate(0, 0, -6).Add(9 * time.Hour), EventName: "page_view", URL: "/", Country: "JP"}
+	if err := repo.Create(backdated); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	hasCountry := func(name string) bool {
+		t.Helper()
+		countries, _, err := repo.GetTopCountries(t.Context(), start, end, 10, map[string]string{})
+		if err != nil {
+			t.Fatalf("GetTopCountries failed: %v", err)
+		}
+		for _, country := range countries {
+			if country["name"] == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasCountry("JP") {
+		t.Error("Expected the backdated event to be counted before the refresh")
+	}
+	if err := repo.refreshDailyStats(t.Context(), now); err != nil {
+		t.Fatalf("refreshDailyStats failed: %v", err)
+	}
+	if _, _, rollup := repo.eventCountSource(end, map[string]string{}); !rollup {
+		t.Fatal("Expected daily_stats to cover the range again after the refresh")
+	}
+	if !hasCountry("JP") {
+		t.Error("Expected the backdated event to be counted after the refresh")
+	}
+
+	if _, err := repo.Reset(); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if _, _, rollup := repo.eventCountSource(end, map[string]string{}); rollup {
+		t.Error("Expected Reset to stop queries from using daily_stats")
+	}
+	var rows int
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM daily_stats").Scan(&rows); err != nil || rows != 0 {
+		t.Errorf("Expected Reset to clear daily_stats, got %d rows (%v)", rows, err)
+	}
+}
+
+func TestDailyStatsImportedHistory(t *testing.T) {
+	repo := newTestRepository(t).(*eventRepository)
+	now := time.Now().UTC()
+	today := utcDay(now)
+	yesterday := today.AddDate(0, 0, -1)
+
+	if err := repo.Create(domain.Event{Timestamp: yesterday, EventName: "page_view", URL: "/", Country: "EG"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := repo.refreshDailyStats(t.Context(), now); err != nil {
+		t.Fatalf("refreshDailyStats failed: %v", err)
+	}
+
+	// Imports store their events with CreateBatch, here two months of history,
+	// long before the lookback
+	var history []domain.Event
+	for day := 30; day <= 90; day++ {
+		history = append(history, domain.Event{Timestamp: today.AddDate(0, 0, -day).Add(8 * time.Hour), EventName: "page_view", URL: "/", Country: "BR"})
+	}
+	if err := repo.CreateBatch(history); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	countBR := func() int {
+		t.Helper()
+		countries, _, err := repo.GetTopCountries(t.Context(), today.AddDate(0, 0, -120), yesterday, 10, map[string]string{})
+		if err != nil {
+			t.Fatalf("GetTopCountries failed: %v", err)
+		}
+		for _, country := range countries {
+			if country["name"] == "BR" {
+				count, _ := country["count"].(int)
+				return count
+			}
+		}
+		return 0
+	}
+	if got := countBR(); got != len(history) {
+		t.Errorf("Expected %d imported events counted before the refresh, got %d", len(history), got)
+	}
+	if err := repo.refreshDailyStats(t.Context(), now); err != nil {
+		t.Fatalf("refreshDailyStats failed: %v", err)
+	}
+	if _, _, rollup := repo.eventCountSource(yesterday, map[string]string{}); !rollup {
+		t.Fatal("Expected daily_stats to cover the range after the refresh")
+	}
+	if got := countBR(); got != len(history) {
+		t.Errorf("Expected %d imported events counted from daily_stats, got %d", len(history), got)
+	}
+}
@@ -0,0 +1,48 @@
+package repository
+
+import "fmt"
+
+// sessionDuration is a session's duration in seconds, for a query grouped by
+// session_id: the time between its first and last event. The session_duration
+// column is reported by the client and can be wrong or spoofed, so it is only used
+// for single-event sessions, which have no span to measure.
+const sessionDuration = `CASE
+			WHEN COUNT(*) > 1 THEN epoch(MAX(timestamp)) - epoch(MIN(timestamp))
+			ELSE MAX(session_duration)
+		END`
+
+// sessionDurationsCTE returns a CTE named session_durations with one duration per
+// session of the rows in from
+func sessionDurationsCTE(from string) string {
+	return fmt.Sprintf(`session_durations AS (
+		SELECT %s AS duration
+		FROM %s
+		WHERE session_id IS NOT NULL AND session_id != ''
+		GROUP BY session_id
+	)`, sessionDuration, from)
+}
+
+// avgSessionDuration is the average of session_durations, ignoring empty sessions
+const avgSessionDuration = `(SELECT AVG(duration) FROM session_durations WHERE duration > 0)`
+
+// sessionDurationTimelineQuery returns the visit_duration timeline: the average
+// derived session duration per dateColumn bucket
+func sessionDurationTimelineQuery(dateColumn, source, whereClause string) string {
+	return fmt.Sprintf(`
+		WITH bucket_sessions AS (
+			SELECT
+				%s AS date,
+				%s AS duration
+			FROM %s
+			WHERE %s
+				AND session_id IS NOT NULL AND session_id != ''
+			GROUP BY date, session_id
+		)
+		SELECT
+			date,
+			AVG(CASE WHEN duration > 0 THEN duration END) as count
+		FROM bucket_sessions
+		GROUP BY date
+		ORDER BY date
+	`, dateColumn, sessionDuration, source, whereClause)
+}
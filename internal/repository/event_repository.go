@@ -1,41 +1,104 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/idgen"
+	"github.com/mohamedelhefni/siraaj/internal/referrerspam"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
 )
 
 const (
 	// Batch insert size for optimal performance
 	BatchInsertSize = 5000
+	// MaxSessionEvents caps the events returned per session by GetUserSessions
+	MaxSessionEvents = 500
+	// MaxFunnelBreakdownValues caps the dimension values a funnel breakdown analyzes;
+	// each value runs the whole funnel again
+	MaxFunnelBreakdownValues = 10
 )
 
 type EventRepository interface {
 	Create(event domain.Event) error
 	CreateBatch(events []domain.Event) error
-	GetEvents(startDate, endDate time.Time, limit, offset int) (map[string]interface{}, error)
-	GetStats(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
-	GetOnlineUsers(timeWindow int) (map[string]interface{}, error)
-	GetProjects() ([]string, error)
-	GetFunnelAnalysis(request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error)
+	GetEvents(ctx context.Context, startDate, endDate time.Time, limit, offset int, filters map[string]string) (map[string]interface{}, error)
+	GetStats(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetOnlineUsers(ctx context.Context, timeWindow int) (map[string]interface{}, error)
+	GetRecentEvents(ctx context.Context, limit int) ([]domain.Event, error)
+	GetProjects(ctx context.Context) ([]string, error)
+	GetFunnelAnalysis(ctx context.Context, request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error)
 
 	// New focused endpoints
-	GetTopStats(startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error)
-	GetTimeline(startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error)
-	GetTopPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
-	GetTopCountries(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error)
-	GetTopSources(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error)
-	GetTopEvents(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error)
-	GetBrowsersDevicesOS(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
-	GetEntryExitPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetTopStats(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (*domain.TopStatsResult, error)
+	GetTimeline(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error)
+	// ExplainStats returns the EXPLAIN ANALYZE plan of the main query of a report, one of the domain.Report names
+	ExplainStats(ctx context.Context, report string, startDate, endDate time.Time, limit int, filters map[string]string) (string, error)
+	GetTopPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetTopCountries(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetTopRegions(ctx context.Context, startDate, endDate time.Time, level string, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetTopLanguages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetScreenSizes(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]map[string]interface{}, error)
+	WriteSQLite(path string, tables []domain.ExportTable) error
+	ExportParquet(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string, maxRows int64) (int64, error)
+	ReadCSV(ctx context.Context, path string, fn func(header, values []string) error) error
+	GetTopSources(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetTopEvents(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetBrowsersDevicesOS(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetEntryExitPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetStickiness(ctx context.Context, endDate time.Time, filters map[string]string) (dau, wau, mau int, dauMau float64, err error)
+	GetNewVsReturning(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error)
+	GetUserSessions(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int, filters map[string]string) ([]domain.Session, error)
+	GetFilterValues(ctx context.Context, startDate, endDate time.Time, fields []string, filters map[string]string) (map[string][]domain.FilterValue, error)
 
 	// Channel analytics
-	GetChannels(startDate, endDate time.Time, filters map[string]string) ([]map[string]interface{}, error)
+	GetChannels(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.ChannelResult, error)
+	GetChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error)
+	StreamChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string, emit func(map[string]interface{}) error) error
+
+	// Goals
+	CreateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error)
+	GetGoals(ctx context.Context) ([]domain.Goal, error)
+	GetGoal(ctx context.Context, id int64) (domain.Goal, error)
+	UpdateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error)
+	DeleteGoal(ctx context.Context, id int64) error
+	GetGoalConversions(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.GoalConversion, error)
+
+	// Reset deletes all stored events, returning the number of Parquet files removed
+	Reset() (int, error)
+
+	// FlushSync writes buffered events to disk before returning, for read-after-write
+	FlushSync() (domain.FlushResult, error)
+
+	// Compact merges small Parquet files now instead of on the compaction timer
+	Compact(ctx context.Context) (domain.CompactionResult, error)
+
+	// Lifetime unique users, see lifetime.go
+	GetLifetimeUniqueUsers(ctx context.Context) (domain.LifetimeUsers, error)
+	RebuildUserSketch(ctx context.Context) error
+
+	// GetStorageStats describes the stored events and their files, see storage_stats.go
+	GetStorageStats(ctx context.Context) (domain.StorageStats, error)
+
+	// SampleEvents returns up to n randomly chosen stored events, for debugging enrichment
+	SampleEvents(ctx context.Context, n int) ([]domain.Event, error)
+
+	// DataAsOf returns how fresh queryable data is; events tracked later are not visible yet
+	DataAsOf() time.Time
+
+	// CheckReadiness checks that events can be stored and queried, see health.go
+	CheckReadiness(ctx context.Context) domain.Readiness
+
+	// StartDailyStats keeps the daily_stats rollup fresh until ctx is canceled, see daily_stats.go
+	StartDailyStats(ctx context.Context)
 
 	// Flush and Close for graceful shutdown
 	Flush() error
@@ -43,25 +106,44 @@ type EventRepository interface {
 }
 
 type eventRepository struct {
-	db         *sql.DB
-	buffer     []domain.Event
-	insertStmt *sql.Stmt
+	db             *sql.DB
+	buffer         []domain.Event
+	insertStmt     *sql.Stmt
+	parquetStorage *storage.ParquetStorage
+	closeOnce      sync.Once
+	closeErr       error
+
+	// Background jobs such as the daily_stats refresh, waited for by Close
+	jobs sync.WaitGroup
+	// Unix time of the last day daily_stats covers, 0 before the first refresh
+	dailyStatsThrough atomic.Int64
+	// Unix time of the oldest past day events were written for since the last
+	// refresh started, and of the one the running refresh recomputes from, 0 for none
+	dailyStatsStale      atomic.Int64
+	dailyStatsRefreshing atomic.Int64
 }
 
-func NewEventRepository(db *sql.DB) EventRepository {
-	repo := &eventRepository{
-		db:     db,
-		buffer: make([]domain.Event, 0, BatchInsertSize),
-	}
-
-	stmt, err := db.Prepare(`
+// insertEventQuery inserts a single event into the events table
+const insertEventQuery = `
 		INSERT INTO events (
 			id, timestamp, date_hour, date_day, date_month,
 			event_name, user_id, session_id, session_duration,
 			url, referrer, user_agent, ip, country,
-			browser, os, device, is_bot, project_id, channel
-		) VALUES (nextval('id_sequence'), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`)
+			browser, os, device, is_bot, project_id, channel, received_at, region, language,
+			screen_width, screen_height, sample_rate
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+// NewEventRepository creates a repository backed by Parquet files when parquetStorage
+// is set, and by the DuckDB events table (STORAGE_BACKEND=table) when it is nil
+func NewEventRepository(db *sql.DB, parquetStorage *storage.ParquetStorage) EventRepository {
+	repo := &eventRepository{
+		db:             db,
+		buffer:         make([]domain.Event, 0, BatchInsertSize),
+		parquetStorage: parquetStorage,
+	}
+
+	stmt, err := db.Prepare(insertEventQuery)
 	if err != nil {
 		log.Printf("Warning: failed to prepare insert statement: %v", err)
 	} else {
@@ -71,27 +153,156 @@ func NewEventRepository(db *sql.DB) EventRepository {
 	return repo
 }
 
+// getParquetSource returns the FROM source for analytics queries: the Parquet files
+// once any have been flushed, otherwise the events table. With a project filter
+// only that project's partition is read; pass nil to read every project.
+func (r *eventRepository) getParquetSource(filters map[string]string) string {
+	if r.parquetStorage == nil {
+		return "events"
+	}
+	if project := filters["project"]; project != "" {
+		if count, err := r.parquetStorage.GetProjectFileCount(project); err != nil || count == 0 {
+			return "events"
+		}
+		return fmt.Sprintf("read_parquet('%s', union_by_name=true)", r.parquetStorage.GetProjectFilePath(project))
+	}
+	if count, err := r.parquetStorage.GetFileCount(); err != nil || count == 0 {
+		return "events"
+	}
+	return fmt.Sprintf("read_parquet('%s', union_by_name=true)", r.parquetStorage.GetFilePath())
+}
+
+// timeBasis returns the time basis for a stats query: the time_basis filter, then
+// the TIME_BASIS environment variable, defaulting to the client event timestamp
+func timeBasis(filters map[string]string) string {
+	if filters["time_basis"] != "" {
+		if basis, err := domain.ParseTimeBasis(filters["time_basis"]); err == nil {
+			return basis
+		}
+	}
+	if basis, err := domain.ParseTimeBasis(os.Getenv("TIME_BASIS")); err == nil {
+		return basis
+	}
+	return domain.TimeBasisEvent
+}
+
+// timeZone returns the IANA name of the zone stats are bucketed in: the tz filter,
+// then the STATS_TZ environment variable, defaulting to UTC
+func timeZone(filters map[string]string) string {
+	if filters["tz"] != "" {
+		if loc, err := domain.ParseTimeZone(filters["tz"]); err == nil {
+			return loc.String()
+		}
+	}
+	if loc, err := domain.ParseTimeZone(os.Getenv("STATS_TZ")); err == nil {
+		return loc.String()
+	}
+	return "UTC"
+}
+
+// statsMeta is the _meta of a stats response, with the date range it covers
+func statsMeta(exact bool, rowsScanned int64, startDate, endDate time.Time, filters map[string]string) domain.StatsMeta {
+	meta := domain.NewStatsMeta(exact, rowsScanned)
+	meta.Range = &domain.StatsRange{
+		Start:    startDate.Format("2006-01-02"),
+		End:      endDate.Format("2006-01-02"),
+		TimeZone: timeZone(filters),
+		Period:   filters["period"],
+	}
+	return meta
+}
+
+// getStatsSource returns the FROM source for stats queries. Under the received time
+// basis, timestamp and the date_* bucket columns are recomputed from received_at, so
+// date filters, timelines and day/month rollups all follow ingestion time. With a tz
+// filter they are shifted from UTC to wall-clock time in that zone, so days start at
+// local midnight.
+func (r *eventRepository) getStatsSource(filters map[string]string) string {
+	source := r.getParquetSource(filters)
+	received := timeBasis(filters) == domain.TimeBasisReceived
+	zone := timeZone(filters)
+	if !received && zone == "UTC" {
+		return source
+	}
+
+	timestamp := "timestamp"
+	if received {
+		timestamp = "COALESCE(received_at, timestamp)"
+	}
+	if zone != "UTC" {
+		// Stored timestamps are UTC without a zone
+		timestamp = fmt.Sprintf("timezone('%s', timezone('UTC', %s))", sqlString(zone), timestamp)
+	}
+
+	// The events table stores day and month buckets as DATE, Parquet files as TIMESTAMP
+	bucketType := "TIMESTAMP"
+	if source == "events" {
+		bucketType = "DATE"
+	}
+	return fmt.Sprintf(`(
+		SELECT * REPLACE (
+			%[1]s AS timestamp,
+			date_trunc('hour', %[1]s) AS date_hour,
+			CAST(date_trunc('day', %[1]s) AS %[2]s) AS date_day,
+			CAST(date_trunc('month', %[1]s) AS %[2]s) AS date_month
+		)
+		FROM %[3]s
+	)`, timestamp, bucketType, source)
+}
+
+func (r *eventRepository) DataAsOf() time.Time {
+	if r.parquetStorage != nil {
+		if lastFlush := r.parquetStorage.LastFlush(); !lastFlush.IsZero() {
+			return lastFlush
+		}
+	}
+	// Table inserts, and the table fallback used before the first flush, are visible immediately
+	return time.Now()
+}
+
 func (r *eventRepository) Create(event domain.Event) error {
 	if event.ProjectID == "" {
 		event.ProjectID = "default"
 	}
 
 	event.Timestamp = event.Timestamp.UTC()
+	if event.ReceivedAt.IsZero() {
+		event.ReceivedAt = time.Now()
+	}
+	event.ReceivedAt = event.ReceivedAt.UTC()
+	event.ID = idgen.Next()
+
+	if r.parquetStorage != nil {
+		if err := r.parquetStorage.Write(event); err != nil {
+			return err
+		}
+		r.markDailyStatsStale(event)
+		return nil
+	}
 
 	dateHour := event.Timestamp.Truncate(time.Hour)
 	dateDay := time.Date(event.Timestamp.Year(), event.Timestamp.Month(), event.Timestamp.Day(), 0, 0, 0, 0, time.UTC)
 	dateMonth := time.Date(event.Timestamp.Year(), event.Timestamp.Month(), 1, 0, 0, 0, 0, time.UTC)
 
-	if r.insertStmt != nil {
-		_, err := r.insertStmt.Exec(
-			event.Timestamp, dateHour, dateDay, dateMonth,
-			event.EventName, event.UserID, event.SessionID, event.SessionDuration,
-			event.URL, event.Referrer, event.UserAgent, event.IP, event.Country,
-			event.Browser, event.OS, event.Device, event.IsBot, event.ProjectID, event.Channel,
-		)
-		return err
+	args := []interface{}{
+		event.ID, event.Timestamp, dateHour, dateDay, dateMonth,
+		event.EventName, event.UserID, event.SessionID, event.SessionDuration,
+		event.URL, event.Referrer, event.UserAgent, event.IP, event.Country,
+		event.Browser, event.OS, event.Device, event.IsBot, event.ProjectID, event.Channel, event.ReceivedAt, event.Region, event.Language,
+		event.ScreenWidth, event.ScreenHeight, event.StoredSampleRate(),
 	}
 
+	var err error
+	if r.insertStmt != nil {
+		_, err = r.insertStmt.Exec(args...)
+	} else {
+		// Preparing failed at startup, so the event would otherwise be lost
+		_, err = r.db.Exec(insertEventQuery, args...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert event: %w", err)
+	}
+	r.markDailyStatsStale(event)
 	return nil
 }
 
@@ -100,11 +311,25 @@ func (r *eventRepository) CreateBatch(events []domain.Event) error {
 		return nil
 	}
 
+	now := time.Now()
 	for i := range events {
 		if events[i].ProjectID == "" {
 			events[i].ProjectID = "default"
 		}
 		events[i].Timestamp = events[i].Timestamp.UTC()
+		if events[i].ReceivedAt.IsZero() {
+			events[i].ReceivedAt = now
+		}
+		events[i].ReceivedAt = events[i].ReceivedAt.UTC()
+		events[i].ID = idgen.Next()
+	}
+
+	if r.parquetStorage != nil {
+		if err := r.parquetStorage.WriteBatch(events); err != nil {
+			return err
+		}
+		r.markDailyStatsStale(events...)
+		return nil
 	}
 
 	tx, err := r.db.Begin()
@@ -118,75 +343,133 @@ func (r *eventRepository) CreateBatch(events []domain.Event) error {
 	}()
 
 	valueStrings := make([]string, 0, len(events))
-	valueArgs := make([]interface{}, 0, len(events)*19)
+	valueArgs := make([]interface{}, 0, len(events)*26)
 
 	for _, event := range events {
 		dateHour := event.Timestamp.Truncate(time.Hour)
 		dateDay := time.Date(event.Timestamp.Year(), event.Timestamp.Month(), event.Timestamp.Day(), 0, 0, 0, 0, time.UTC)
 		dateMonth := time.Date(event.Timestamp.Year(), event.Timestamp.Month(), 1, 0, 0, 0, 0, time.UTC)
 
-		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 		valueArgs = append(valueArgs,
-			0, // Placeholder for ID, will be replaced with nextval in the query
-			event.Timestamp, dateHour, dateDay, dateMonth,
+			event.ID, event.Timestamp, dateHour, dateDay, dateMonth,
 			event.EventName, event.UserID, event.SessionID, event.SessionDuration,
 			event.URL, event.Referrer, event.UserAgent, event.IP, event.Country,
-			event.Browser, event.OS, event.Device, event.IsBot, event.ProjectID, event.Channel,
+			event.Browser, event.OS, event.Device, event.IsBot, event.ProjectID, event.Channel, event.ReceivedAt, event.Region, event.Language,
+			event.ScreenWidth, event.ScreenHeight, event.StoredSampleRate(),
 		)
 	}
 
-	// Build the query with placeholders, then replace the ID placeholders with nextval
-	placeholderQuery := fmt.Sprintf(`
+	query := fmt.Sprintf(`
 		INSERT INTO events (
 			id, timestamp, date_hour, date_day, date_month,
 			event_name, user_id, session_id, session_duration,
 			url, referrer, user_agent, ip, country,
-			browser, os, device, is_bot, project_id, channel
+			browser, os, device, is_bot, project_id, channel, received_at, region, language,
+			screen_width, screen_height, sample_rate
 		) VALUES %s
 	`, strings.Join(valueStrings, ","))
 
-	// Replace the first ? in each row with nextval('id_sequence')
-	// This is safe because we know the first ? in each (?, ?, ...) is for ID
-	query := strings.ReplaceAll(placeholderQuery, "(?, ", "(nextval('id_sequence'), ")
-
-	// Remove the placeholder ID values from valueArgs
-	filteredArgs := make([]interface{}, 0, len(events)*19)
-	for i := 0; i < len(events); i++ {
-		// Skip the first argument (ID placeholder) for each event
-		start := i * 20
-		filteredArgs = append(filteredArgs, valueArgs[start+1:start+20]...)
-	}
-
-	_, err = tx.Exec(query, filteredArgs...)
+	_, err = tx.Exec(query, valueArgs...)
 	if err != nil {
 		return fmt.Errorf("failed to insert batch: %w", err)
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.markDailyStatsStale(events...)
+	return nil
 }
 
 func (r *eventRepository) Flush() error {
+	if r.parquetStorage != nil {
+		return r.parquetStorage.Flush()
+	}
 	return nil // No buffering needed with direct inserts
 }
 
-func (r *eventRepository) Close() error {
-	if r.insertStmt != nil {
-		return r.insertStmt.Close()
+func (r *eventRepository) Reset() (int, error) {
+	if _, err := r.db.Exec("DELETE FROM events"); err != nil {
+		return 0, fmt.Errorf("failed to clear events table: %w", err)
 	}
-	return nil
+	r.dailyStatsThrough.Store(0)
+	r.dailyStatsStale.Store(0)
+	if _, err := r.db.Exec("DELETE FROM daily_stats"); err != nil {
+		return 0, fmt.Errorf("failed to clear daily stats: %w", err)
+	}
+	if r.parquetStorage != nil {
+		return r.parquetStorage.Reset()
+	}
+	return 0, nil
+}
+
+func (r *eventRepository) FlushSync() (domain.FlushResult, error) {
+	if r.parquetStorage != nil {
+		return r.parquetStorage.FlushSync()
+	}
+	return domain.FlushResult{}, nil // Table inserts are visible immediately
 }
 
-func (r *eventRepository) GetEvents(startDate, endDate time.Time, limit, offset int) (map[string]interface{}, error) {
-	query := `
+// Compact runs a compaction pass of Parquet storage, returning
+// domain.ErrNoCompaction under the table backend
+func (r *eventRepository) Compact(ctx context.Context) (domain.CompactionResult, error) {
+	if r.parquetStorage == nil {
+		return domain.CompactionResult{}, domain.ErrNoCompaction
+	}
+	return r.parquetStorage.Compact(ctx)
+}
+
+// Close waits for background jobs, releases the insert statement and shuts down
+// Parquet storage
+// Safe to call multiple times; later calls return the result of the first
+func (r *eventRepository) Close() error {
+	r.closeOnce.Do(func() {
+		r.jobs.Wait()
+		if r.insertStmt != nil {
+			if err := r.insertStmt.Close(); err != nil {
+				log.Printf("Warning: failed to close insert statement: %v", err)
+			}
+		}
+		if r.parquetStorage != nil {
+			r.closeErr = r.parquetStorage.Close()
+		}
+	})
+	return r.closeErr
+}
+
+// GetEvents returns a page of raw events matching filters, newest first, with the
+// total number of matching events. With a "before" cursor in filters the page starts
+// after that event (keyset pagination) and offset is ignored.
+func (r *eventRepository) GetEvents(ctx context.Context, startDate, endDate time.Time, limit, offset int, filters map[string]string) (map[string]interface{}, error) {
+	source := r.getStatsSource(filters)
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
+
+	pageClause, pageArgs := whereClause, args
+	pagination := domain.PaginationOffset
+	if before := filters["before"]; before != "" {
+		cursor, err := domain.ParseEventCursor(before)
+		if err != nil {
+			return nil, err
+		}
+		pageClause += " AND (timestamp < ? OR (timestamp = ? AND id < ?))"
+		pageArgs = append(append([]interface{}{}, args...), cursor.Timestamp, cursor.Timestamp, cursor.ID)
+		pagination = domain.PaginationCursor
+		offset = 0
+	}
+
+	// One extra row tells whether there is a next page. id breaks timestamp ties so
+	// the order, and therefore the cursor, is stable.
+	query := fmt.Sprintf(`
 		SELECT id, timestamp, event_name, user_id, session_id, session_duration, url, referrer,
 			user_agent, ip, country, browser, os, device, is_bot, project_id, channel
-		FROM events
-		WHERE date_day >= CAST(? AS DATE) AND date_day <= CAST(? AS DATE)
-		ORDER BY timestamp DESC
+		FROM %s
+		WHERE %s
+		ORDER BY timestamp DESC, id DESC
 		LIMIT ? OFFSET ?
-	`
+	`, source, pageClause)
 
-	rows, err := r.db.Query(query, startDate, endDate, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, append(pageArgs, limit+1, offset)...)
 	if err != nil {
 		return nil, err
 	}
@@ -211,25 +494,82 @@ func (r *eventRepository) GetEvents(startDate, endDate time.Time, limit, offset
 		events = append(events, e)
 	}
 
+	var nextCursor interface{}
+	if len(events) > limit {
+		events = events[:limit]
+		if limit > 0 {
+			last := events[len(events)-1]
+			nextCursor = domain.EventCursor{Timestamp: last.Timestamp, ID: last.ID}.Encode()
+		}
+	}
+
 	// Get total count
 	var total int64
-	countQuery := `SELECT COUNT(*) FROM events WHERE date_day >= CAST(? AS DATE) AND date_day <= CAST(? AS DATE)`
-	err = r.db.QueryRow(countQuery, startDate, endDate).Scan(&total)
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, source, whereClause)
+	err = r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, err
 	}
 
 	return map[string]interface{}{
-		"events": events,
-		"total":  total,
-		"limit":  limit,
-		"offset": offset,
+		"events":      events,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+		"next_cursor": nextCursor,
+		"_meta":       domain.NewEventsPageMeta(pagination),
 	}, nil
 }
 
-func (r *eventRepository) GetStats(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+func (r *eventRepository) SampleEvents(ctx context.Context, n int) ([]domain.Event, error) {
+	source := r.getParquetSource(nil)
+	// The sample size cannot be a bound parameter, n is an int so formatting is safe
+	query := fmt.Sprintf(`
+		SELECT id, timestamp, event_name, user_id, session_id, session_duration, url, referrer,
+			user_agent, ip, country, browser, os, device, is_bot, project_id, channel
+		FROM %s
+		USING SAMPLE %d ROWS
+	`, source, n)
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	events := []domain.Event{}
+	for rows.Next() {
+		var e domain.Event
+		err := rows.Scan(
+			&e.ID, &e.Timestamp, &e.EventName, &e.UserID, &e.SessionID, &e.SessionDuration,
+			&e.URL, &e.Referrer, &e.UserAgent, &e.IP, &e.Country,
+			&e.Browser, &e.OS, &e.Device, &e.IsBot, &e.ProjectID, &e.Channel,
+		)
+		if err != nil {
+			log.Printf("Error scanning event: %v", err)
+			continue
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *eventRepository) GetStats(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+	source := r.getStatsSource(filters)
+	exact := domain.ExactCounts(filters)
+	minSample := minSampleSize()
 	stats := make(map[string]interface{})
 
+	sections, err := domain.ParseStatsInclude(filters["include"])
+	if err != nil {
+		return nil, err
+	}
+
 	if limit <= 0 {
 		limit = 10
 	}
@@ -243,8 +583,8 @@ func (r *eventRepository) GetStats(startDate, endDate time.Time, limit int, filt
 		args = append(args, projectID)
 	}
 	if source, ok := filters["source"]; ok && source != "" {
-		whereClause += " AND referrer = ?"
-		args = append(args, source)
+		whereClause += " AND " + sourceCondition("referrer")
+		args = append(args, source, source)
 	}
 	if country, ok := filters["country"]; ok && country != "" {
 		whereClause += " AND country = ?"
@@ -267,8 +607,9 @@ func (r *eventRepository) GetStats(startDate, endDate time.Time, limit int, filt
 		args = append(args, eventName)
 	}
 	if page, ok := filters["page"]; ok && page != "" {
-		whereClause += " AND url = ?"
-		args = append(args, page)
+		condition, pageArgs := pageCondition("url", page, filters)
+		whereClause += " AND " + condition
+		args = append(args, pageArgs...)
 	}
 	if botFilter, ok := filters["botFilter"]; ok && botFilter != "" {
 		switch botFilter {
@@ -286,14 +627,16 @@ func (r *eventRepository) GetStats(startDate, endDate time.Time, limit int, filt
 	optimizedQuery := fmt.Sprintf(`
 	WITH date_filtered AS (
 		SELECT 
+			timestamp,
 			user_id,
 			session_id,
 			event_name,
 			session_duration,
 			is_bot
-		FROM events 
+		FROM %s 
 		WHERE %s
 	),
+	%s,
 	event_stats AS (
 		SELECT 
 			COUNT(*) as total_events,
@@ -301,7 +644,7 @@ func (r *eventRepository) GetStats(startDate, endDate time.Time, limit int, filt
 			APPROX_COUNT_DISTINCT(session_id) as total_visits,
 			COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views,
 			APPROX_COUNT_DISTINCT(CASE WHEN event_name = 'page_view' THEN session_id END) as sessions_with_views,
-			AVG(CASE WHEN session_duration > 0 THEN session_duration END) as avg_session_duration,
+			%s as avg_session_duration,
 			COUNT(CASE WHEN is_bot = TRUE THEN 1 END) as bot_events,
 			COUNT(CASE WHEN is_bot = FALSE THEN 1 END) as human_events,
 			APPROX_COUNT_DISTINCT(CASE WHEN is_bot = TRUE THEN user_id END) as bot_users,
@@ -309,13 +652,13 @@ func (r *eventRepository) GetStats(startDate, endDate time.Time, limit int, filt
 		FROM date_filtered
 	)
 	SELECT * FROM event_stats;
-	`, whereClause)
+	`, source, whereClause, sessionDurationsCTE("date_filtered"), avgSessionDuration)
 
 	var totalEvents, uniqueUsers, totalVisits, pageViews, sessionsWithViews int
 	var avgSessionDuration sql.NullFloat64
 	var botEvents, humanEvents, botUsers, humanUsers int
 
-	err := r.db.QueryRow(optimizedQuery, args...).Scan(
+	err = r.db.QueryRowContext(ctx, distinctCounts(optimizedQuery, exact), args...).Scan(
 		&totalEvents, &uniqueUsers, &totalVisits, &pageViews, &sessionsWithViews,
 		&avgSessionDuration, &botEvents, &humanEvents, &botUsers, &humanUsers,
 	)
@@ -324,6 +667,7 @@ func (r *eventRepository) GetStats(startDate, endDate time.Time, limit int, filt
 	}
 
 	stats["total_events"] = totalEvents
+	stats["_meta"] = statsMeta(exact, int64(totalEvents), startDate, endDate, filters)
 	stats["unique_users"] = uniqueUsers
 	stats["total_visits"] = totalVisits
 	stats["page_views"] = pageViews
@@ -346,650 +690,618 @@ func (r *eventRepository) GetStats(startDate, endDate time.Time, limit int, filt
 		stats["bot_percentage"] = 0.0
 	}
 
-	// Calculate bounce rate: sessions with only 1 page view / total sessions
-	// Optimized to avoid nested aggregation
-	var bounceRate float64
+	// Calculate bounce rate: bounced sessions / sessions with page views, where a
+	// bounce is a single page view or a single event depending on bounce_mode
+	stats["bounce_rate"] = 0.0
 	if totalVisits > 0 {
-		bounceRateQuery := fmt.Sprintf(`
-			WITH session_view_counts AS (
-				SELECT 
-					session_id,
-					COUNT(*) as view_count
-				FROM events 
-				WHERE %s AND event_name = 'page_view'
-				GROUP BY session_id
-			)
-			SELECT COUNT(*) as single_page_sessions
-			FROM session_view_counts
-			WHERE view_count = 1
-		`, whereClause)
+		bounceRateQuery := bouncedSessionsQuery(source, whereClause, bounceMode(filters))
 
 		var singlePageSessions int
-		err = r.db.QueryRow(bounceRateQuery, args...).Scan(&singlePageSessions)
+		err = r.db.QueryRowContext(ctx, bounceRateQuery, args...).Scan(&singlePageSessions)
 		if err == nil && sessionsWithViews > 0 {
-			bounceRate = float64(singlePageSessions) / float64(sessionsWithViews) * 100
+			setRate(stats, "bounce_rate", int64(singlePageSessions), int64(sessionsWithViews), minSample)
+			stats["single_page_sessions"] = singlePageSessions
+			stats["sessions_with_views"] = sessionsWithViews
 		}
 	}
-	stats["bounce_rate"] = bounceRate
 
-	// Top Events with optimized query
-	query := fmt.Sprintf(`
-		SELECT event_name, COUNT(*) as count 
-		FROM events 
-		WHERE %s
-		GROUP BY event_name 
-		ORDER BY count DESC 
-		LIMIT ?
-	`, whereClause)
+	// Shared by the ranked-list queries below
+	var query string
 	queryArgs := append(args, limit)
 
-	topEventsRows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if topEventsRows != nil {
-			if err := topEventsRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
-			}
+	if sections["top_events"] {
+		// Top Events with optimized query
+		query = fmt.Sprintf(`
+			SELECT event_name, COUNT(*) as count 
+			FROM %s 
+			WHERE %s
+			GROUP BY event_name 
+			ORDER BY count DESC 
+			LIMIT ?
+		`, source, whereClause)
+
+		topEventsRows, err := r.db.QueryContext(ctx, query, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	topEvents := []map[string]interface{}{}
-	for topEventsRows.Next() {
-		var name string
-		var count int
-		if err := topEventsRows.Scan(&name, &count); err != nil {
-			continue
+		defer func() {
+			if topEventsRows != nil {
+				if err := topEventsRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		topEvents := []map[string]interface{}{}
+		for topEventsRows.Next() {
+			var name string
+			var count int
+			if err := topEventsRows.Scan(&name, &count); err != nil {
+				continue
+			}
+			topEvents = append(topEvents, map[string]interface{}{
+				"name":  name,
+				"count": count,
+			})
 		}
-		topEvents = append(topEvents, map[string]interface{}{
-			"name":  name,
-			"count": count,
-		})
+		stats["top_events"] = topEvents
 	}
-	stats["top_events"] = topEvents
-
-	// Events over time with dynamic granularity based on date range
-	timelineDuration := endDate.Sub(startDate)
-	var timelineQuery string
-	var timeFormat string
 
-	// Determine what metric to display in timeline
-	metric := filters["metric"]
-	var selectClause string
-	switch metric {
-	case "users":
-		selectClause = "APPROX_COUNT_DISTINCT( user_id) as count"
-	case "visits":
-		selectClause = "APPROX_COUNT_DISTINCT( session_id) as count"
-	case "page_views":
-		selectClause = "COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as count"
-	case "events":
-		selectClause = "COUNT(*) as count"
-	case "views_per_visit":
-		selectClause = "CAST(COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) AS FLOAT) / NULLIF(APPROX_COUNT_DISTINCT( session_id), 0) as count"
-	case "bounce_rate":
-		// For bounce rate in timeline, we need to use a different approach
-		// We'll calculate it per time period using a window function or aggregation
-		// This is a simplified version that's much faster
-		selectClause = `
-			CASE 
-				WHEN APPROX_COUNT_DISTINCT( session_id) = 0 THEN 0
-				ELSE CAST(SUM(CASE WHEN event_name = 'page_view' THEN 1 ELSE 0 END) AS FLOAT) * 100.0 / NULLIF(APPROX_COUNT_DISTINCT( session_id), 0)
-			END as count`
-	case "visit_duration":
-		selectClause = "AVG(CASE WHEN session_duration > 0 THEN session_duration END) as count"
-	default: // Default to users
-		selectClause = "APPROX_COUNT_DISTINCT( user_id) as count"
-	}
+	if sections["timeline"] {
+		// Events over time with dynamic granularity based on date range
+		timelineDuration := endDate.Sub(startDate)
+		var timelineQuery string
+		var timeFormat string
 
-	// Determine granularity based on date range
-	if timelineDuration <= 24*time.Hour {
-		// For today or single day: show hourly data
-		if metric == "bounce_rate" {
-			// Special optimized query for bounce rate
-			timelineQuery = fmt.Sprintf(`
-				WITH session_page_counts AS (
+		// Determine what metric to display in timeline
+		metric := filters["metric"]
+		var selectClause string
+		switch metric {
+		case "users":
+			selectClause = "APPROX_COUNT_DISTINCT( user_id) as count"
+		case "visits":
+			selectClause = "APPROX_COUNT_DISTINCT( session_id) as count"
+		case "page_views":
+			selectClause = "COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as count"
+		case "events":
+			selectClause = "COUNT(*) as count"
+		case "views_per_visit":
+			selectClause = "CAST(COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) AS FLOAT) / NULLIF(APPROX_COUNT_DISTINCT( session_id), 0) as count"
+		case "bounce_rate":
+			// For bounce rate in timeline, we need to use a different approach
+			// We'll calculate it per time period using a window function or aggregation
+			// This is a simplified version that's much faster
+			selectClause = `
+				CASE 
+					WHEN APPROX_COUNT_DISTINCT( session_id) = 0 THEN 0
+					ELSE CAST(SUM(CASE WHEN event_name = 'page_view' THEN 1 ELSE 0 END) AS FLOAT) * 100.0 / NULLIF(APPROX_COUNT_DISTINCT( session_id), 0)
+				END as count`
+		case "visit_duration":
+			// Averaged per session rather than per event, see sessionDurationTimelineQuery
+		default: // Default to users
+			selectClause = "APPROX_COUNT_DISTINCT( user_id) as count"
+		}
+
+		// Determine granularity based on date range
+		if timelineDuration <= 24*time.Hour {
+			// For today or single day: show hourly data
+			if metric == "bounce_rate" {
+				timelineQuery = bounceTimelineQuery("date_hour", source, whereClause, bounceMode(filters))
+			} else if metric == "visit_duration" {
+				timelineQuery = sessionDurationTimelineQuery("date_hour", source, whereClause)
+			} else {
+				timelineQuery = fmt.Sprintf(`
 					SELECT 
-						date_hour as date,
-						session_id,
-						COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_view_count
-					FROM events 
+						date_hour AS date,
+						%s
+					FROM %s 
 					WHERE %s
-					GROUP BY date, session_id
-				)
-				SELECT 
-					date,
-					CAST(COUNT(CASE WHEN page_view_count = 1 THEN 1 END) AS FLOAT) * 100.0 / NULLIF(COUNT(*), 0) as count
-				FROM session_page_counts
-				GROUP BY date
-				ORDER BY date
-			`, whereClause)
-		} else {
-			timelineQuery = fmt.Sprintf(`
-				SELECT 
-					date_hour AS date,
-					%s
-				FROM events 
-				WHERE %s
-				GROUP BY date 
-				ORDER BY date
-			`, selectClause, whereClause)
-		}
-		timeFormat = "hour"
-	} else if timelineDuration <= 90*24*time.Hour {
-		// For up to 3 months: show daily data
-		if metric == "bounce_rate" {
-			// Special optimized query for bounce rate
-			timelineQuery = fmt.Sprintf(`
-				WITH session_page_counts AS (
+					GROUP BY date 
+					ORDER BY date
+				`, selectClause, source, whereClause)
+			}
+			timeFormat = "hour"
+		} else if timelineDuration <= 90*24*time.Hour {
+			// For up to 3 months: show daily data
+			if metric == "bounce_rate" {
+				timelineQuery = bounceTimelineQuery("date_day", source, whereClause, bounceMode(filters))
+			} else if metric == "visit_duration" {
+				timelineQuery = sessionDurationTimelineQuery("date_day", source, whereClause)
+			} else {
+				timelineQuery = fmt.Sprintf(`
 					SELECT 
-						date_day as date,
-						session_id,
-						COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_view_count
-					FROM events 
+						date_day as date, 
+						%s
+					FROM %s 
 					WHERE %s
-					GROUP BY date, session_id
-				)
-				SELECT 
-					date,
-					CAST(COUNT(CASE WHEN page_view_count = 1 THEN 1 END) AS FLOAT) * 100.0 / NULLIF(COUNT(*), 0) as count
-				FROM session_page_counts
-				GROUP BY date
-				ORDER BY date
-			`, whereClause)
+					GROUP BY date 
+					ORDER BY date
+				`, selectClause, source, whereClause)
+			}
+			timeFormat = "day"
 		} else {
-			timelineQuery = fmt.Sprintf(`
-				SELECT 
-					date_day as date, 
-					%s
-				FROM events 
-				WHERE %s
-				GROUP BY date 
-				ORDER BY date
-			`, selectClause, whereClause)
-		}
-		timeFormat = "day"
-	} else {
-		// For more than 3 months: show monthly data
-		if metric == "bounce_rate" {
-			// Special optimized query for bounce rate
-			timelineQuery = fmt.Sprintf(`
-				WITH session_page_counts AS (
+			// For more than 3 months: show monthly data
+			if metric == "bounce_rate" {
+				timelineQuery = bounceTimelineQuery("date_month", source, whereClause, bounceMode(filters))
+			} else if metric == "visit_duration" {
+				timelineQuery = sessionDurationTimelineQuery("date_month", source, whereClause)
+			} else {
+				timelineQuery = fmt.Sprintf(`
 					SELECT 
-						date_month as date,
-						session_id,
-						COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_view_count
-					FROM events 
+						date_month as date, 
+						%s
+					FROM %s 
 					WHERE %s
-					GROUP BY date, session_id
-				)
-				SELECT 
-					date,
-					CAST(COUNT(CASE WHEN page_view_count = 1 THEN 1 END) AS FLOAT) * 100.0 / NULLIF(COUNT(*), 0) as count
-				FROM session_page_counts
-				GROUP BY date
-				ORDER BY date
-			`, whereClause)
-		} else {
-			timelineQuery = fmt.Sprintf(`
-				SELECT 
-					date_month as date, 
-					%s
-				FROM events 
-				WHERE %s
-				GROUP BY date 
-				ORDER BY date
-			`, selectClause, whereClause)
-		}
-		timeFormat = "month"
-	}
-
-	timelineRows, err := r.db.Query(timelineQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if timelineRows != nil {
-			if err := timelineRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
+					GROUP BY date 
+					ORDER BY date
+				`, selectClause, source, whereClause)
 			}
+			timeFormat = "month"
 		}
-	}()
 
-	timeline := []map[string]interface{}{}
-	for timelineRows.Next() {
-		var date string
-		var count sql.NullFloat64
-		if err := timelineRows.Scan(&date, &count); err != nil {
-			log.Printf("Error scanning timeline row: %v", err)
-			continue
+		timelineRows, err := r.db.QueryContext(ctx, distinctCounts(timelineQuery, exact), args...)
+		if err != nil {
+			return nil, err
 		}
+		defer func() {
+			if timelineRows != nil {
+				if err := timelineRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		timeline := []map[string]interface{}{}
+		for timelineRows.Next() {
+			var date string
+			var count sql.NullFloat64
+			if err := timelineRows.Scan(&date, &count); err != nil {
+				log.Printf("Error scanning timeline row: %v", err)
+				continue
+			}
 
-		// Use float64 value if valid, otherwise 0
-		countValue := 0.0
-		if count.Valid {
-			countValue = count.Float64
-		}
+			// Use float64 value if valid, otherwise 0
+			countValue := 0.0
+			if count.Valid {
+				countValue = count.Float64
+			}
 
-		timeline = append(timeline, map[string]interface{}{
-			"date":  date,
-			"count": countValue,
-		})
+			timeline = append(timeline, map[string]interface{}{
+				"date":  date,
+				"count": countValue,
+			})
+		}
+		stats["timeline"] = timeline
+		stats["timeline_format"] = timeFormat
 	}
-	stats["timeline"] = timeline
-	stats["timeline_format"] = timeFormat
 
-	// Top pages
-	query = fmt.Sprintf(`
-		SELECT url, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND url IS NOT NULL AND url != ''
-		GROUP BY url 
-		ORDER BY count DESC 
-		LIMIT ?
-	`, whereClause)
+	if sections["top_pages"] {
+		// Top pages
+		query = fmt.Sprintf(`
+			SELECT %s as page, COUNT(*) as count 
+			FROM %s 
+			WHERE %s AND url IS NOT NULL AND url != ''
+			GROUP BY page 
+			ORDER BY count DESC 
+			LIMIT ?
+		`, topPagesColumn(filters), source, whereClause)
 
-	topPagesRows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if topPagesRows != nil {
-			if err := topPagesRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
-			}
+		topPagesRows, err := r.db.QueryContext(ctx, query, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	topPages := []map[string]interface{}{}
-	for topPagesRows.Next() {
-		var url string
-		var count int
-		if err := topPagesRows.Scan(&url, &count); err != nil {
-			continue
+		defer func() {
+			if topPagesRows != nil {
+				if err := topPagesRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		topPages := []map[string]interface{}{}
+		for topPagesRows.Next() {
+			var url string
+			var count int
+			if err := topPagesRows.Scan(&url, &count); err != nil {
+				continue
+			}
+			topPages = append(topPages, map[string]interface{}{
+				"url":   url,
+				"count": count,
+			})
 		}
-		topPages = append(topPages, map[string]interface{}{
-			"url":   url,
-			"count": count,
-		})
+		stats["top_pages"] = topPages
 	}
-	stats["top_pages"] = topPages
-
-	// Entry Pages (first page in each session)
-	// Using ROW_NUMBER() instead of DISTINCT ON for better DuckDB performance
-	entryPagesQuery := fmt.Sprintf(`
-		WITH ranked_pages AS (
-			SELECT 
-				session_id, 
-				url,
-				ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp ASC) AS rn
-			FROM events 
-			WHERE %s AND event_name = 'page_view' AND url IS NOT NULL AND url != ''
-		),
-		entry_pages AS (
-			SELECT session_id, url
-			FROM ranked_pages
-			WHERE rn = 1
-		)
-		SELECT url, COUNT(*) as count
-		FROM entry_pages
-		GROUP BY url
-		ORDER BY count DESC
-		LIMIT ?
-	`, whereClause)
 
-	entryPagesRows, err := r.db.Query(entryPagesQuery, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if entryPagesRows != nil {
-			if err := entryPagesRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
-			}
+	if sections["entry_pages"] {
+		// Entry Pages (first page in each session)
+		// Using ROW_NUMBER() instead of DISTINCT ON for better DuckDB performance
+		entryPagesQuery := fmt.Sprintf(`
+			WITH ranked_pages AS (
+				SELECT 
+					session_id, 
+					%s AS url,
+					ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp ASC) AS rn
+				FROM %s 
+				WHERE %s AND event_name = 'page_view' AND url IS NOT NULL AND url != ''
+			),
+			entry_pages AS (
+				SELECT session_id, url
+				FROM ranked_pages
+				WHERE rn = 1
+			)
+			SELECT url, COUNT(*) as count
+			FROM entry_pages
+			GROUP BY url
+			ORDER BY count DESC
+			LIMIT ?
+		`, topPagesColumn(filters), source, whereClause)
+
+		entryPagesRows, err := r.db.QueryContext(ctx, entryPagesQuery, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	entryPages := []map[string]interface{}{}
-	for entryPagesRows.Next() {
-		var url string
-		var count int
-		if err := entryPagesRows.Scan(&url, &count); err != nil {
-			continue
+		defer func() {
+			if entryPagesRows != nil {
+				if err := entryPagesRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		entryPages := []map[string]interface{}{}
+		for entryPagesRows.Next() {
+			var url string
+			var count int
+			if err := entryPagesRows.Scan(&url, &count); err != nil {
+				continue
+			}
+			entryPages = append(entryPages, map[string]interface{}{
+				"url":   url,
+				"count": count,
+			})
 		}
-		entryPages = append(entryPages, map[string]interface{}{
-			"url":   url,
-			"count": count,
-		})
+		stats["entry_pages"] = entryPages
 	}
-	stats["entry_pages"] = entryPages
 
-	// Exit Pages (last page in each session)
-	// Using ROW_NUMBER() instead of DISTINCT ON for better DuckDB performance
-	exitPagesQuery := fmt.Sprintf(`
-		WITH ranked_pages AS (
-			SELECT 
-				session_id, 
-				url,
-				ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp DESC) AS rn
-			FROM events 
-			WHERE %s AND event_name = 'page_view' AND url IS NOT NULL AND url != ''
-		),
-		exit_pages AS (
-			SELECT session_id, url
-			FROM ranked_pages
-			WHERE rn = 1
-		)
-		SELECT url, COUNT(*) as count
-		FROM exit_pages
-		GROUP BY url
-		ORDER BY count DESC
-		LIMIT ?
-	`, whereClause)
-
-	exitPagesRows, err := r.db.Query(exitPagesQuery, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if exitPagesRows != nil {
-			if err := exitPagesRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
-			}
+	if sections["exit_pages"] {
+		// Exit Pages (last page in each session)
+		// Using ROW_NUMBER() instead of DISTINCT ON for better DuckDB performance
+		exitPagesQuery := fmt.Sprintf(`
+			WITH ranked_pages AS (
+				SELECT 
+					session_id, 
+					%s AS url,
+					ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp DESC) AS rn
+				FROM %s 
+				WHERE %s AND event_name = 'page_view' AND url IS NOT NULL AND url != ''
+			),
+			exit_pages AS (
+				SELECT session_id, url
+				FROM ranked_pages
+				WHERE rn = 1
+			)
+			SELECT url, COUNT(*) as count
+			FROM exit_pages
+			GROUP BY url
+			ORDER BY count DESC
+			LIMIT ?
+		`, topPagesColumn(filters), source, whereClause)
+
+		exitPagesRows, err := r.db.QueryContext(ctx, exitPagesQuery, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	exitPages := []map[string]interface{}{}
-	for exitPagesRows.Next() {
-		var url string
-		var count int
-		if err := exitPagesRows.Scan(&url, &count); err != nil {
-			continue
+		defer func() {
+			if exitPagesRows != nil {
+				if err := exitPagesRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		exitPages := []map[string]interface{}{}
+		for exitPagesRows.Next() {
+			var url string
+			var count int
+			if err := exitPagesRows.Scan(&url, &count); err != nil {
+				continue
+			}
+			exitPages = append(exitPages, map[string]interface{}{
+				"url":   url,
+				"count": count,
+			})
+		}
+		stats["exit_pages"] = exitPages
+	}
+
+	if sections["browsers"] {
+		// Browsers
+		query = fmt.Sprintf(`
+			SELECT browser, COUNT(*) as count 
+			FROM %s 
+			WHERE %s AND browser IS NOT NULL AND browser != ''
+			GROUP BY browser 
+			ORDER BY count DESC
+			LIMIT ?
+		`, source, whereClause)
+
+		browsersRows, err := r.db.QueryContext(ctx, query, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-		exitPages = append(exitPages, map[string]interface{}{
-			"url":   url,
-			"count": count,
-		})
-	}
-	stats["exit_pages"] = exitPages
-
-	// Browsers
-	query = fmt.Sprintf(`
-		SELECT browser, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND browser IS NOT NULL AND browser != ''
-		GROUP BY browser 
-		ORDER BY count DESC
-		LIMIT ?
-	`, whereClause)
-
-	browsersRows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if browsersRows != nil {
-			if err := browsersRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
+		defer func() {
+			if browsersRows != nil {
+				if err := browsersRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		browsers := []map[string]interface{}{}
+		for browsersRows.Next() {
+			var browser string
+			var count int
+			if err := browsersRows.Scan(&browser, &count); err != nil {
+				continue
 			}
+			browsers = append(browsers, map[string]interface{}{
+				"name":  browser,
+				"count": count,
+			})
+		}
+		stats["browsers"] = browsers
+	}
+
+	if sections["devices"] {
+		// Devices
+		query = fmt.Sprintf(`
+			SELECT device, COUNT(*) as count 
+			FROM %s 
+			WHERE %s AND device IS NOT NULL AND device != ''
+			GROUP BY device 
+			ORDER BY count DESC
+			LIMIT ?
+		`, source, whereClause)
+
+		devicesRows, err := r.db.QueryContext(ctx, query, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	browsers := []map[string]interface{}{}
-	for browsersRows.Next() {
-		var browser string
-		var count int
-		if err := browsersRows.Scan(&browser, &count); err != nil {
-			continue
+		defer func() {
+			if devicesRows != nil {
+				if err := devicesRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		devices := []map[string]interface{}{}
+		for devicesRows.Next() {
+			var device string
+			var count int
+			if err := devicesRows.Scan(&device, &count); err != nil {
+				continue
+			}
+			devices = append(devices, map[string]interface{}{
+				"name":  device,
+				"count": count,
+			})
+		}
+		stats["devices"] = devices
+	}
+
+	if sections["os"] {
+		// Operating Systems
+		query = fmt.Sprintf(`
+			SELECT os, COUNT(*) as count 
+			FROM %s 
+			WHERE %s AND os IS NOT NULL AND os != ''
+			GROUP BY os 
+			ORDER BY count DESC
+			LIMIT ?
+		`, source, whereClause)
+
+		osRows, err := r.db.QueryContext(ctx, query, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-		browsers = append(browsers, map[string]interface{}{
-			"name":  browser,
-			"count": count,
-		})
-	}
-	stats["browsers"] = browsers
-
-	// Devices
-	query = fmt.Sprintf(`
-		SELECT device, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND device IS NOT NULL AND device != ''
-		GROUP BY device 
-		ORDER BY count DESC
-		LIMIT ?
-	`, whereClause)
-
-	devicesRows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if devicesRows != nil {
-			if err := devicesRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
+		defer func() {
+			if osRows != nil {
+				if err := osRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		operatingSystems := []map[string]interface{}{}
+		for osRows.Next() {
+			var os string
+			var count int
+			if err := osRows.Scan(&os, &count); err != nil {
+				continue
 			}
+			operatingSystems = append(operatingSystems, map[string]interface{}{
+				"name":  os,
+				"count": count,
+			})
+		}
+		stats["os"] = operatingSystems
+	}
+
+	if sections["top_countries"] {
+		// Top Countries
+		query = fmt.Sprintf(`
+			SELECT country, COUNT(*) as count 
+			FROM %s 
+			WHERE %s AND country IS NOT NULL AND country != ''
+			GROUP BY country 
+			ORDER BY count DESC 
+			LIMIT ?
+		`, source, whereClause)
+
+		countriesRows, err := r.db.QueryContext(ctx, query, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	devices := []map[string]interface{}{}
-	for devicesRows.Next() {
-		var device string
-		var count int
-		if err := devicesRows.Scan(&device, &count); err != nil {
-			continue
+		defer func() {
+			if countriesRows != nil {
+				if err := countriesRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		topCountries := []map[string]interface{}{}
+		for countriesRows.Next() {
+			var country string
+			var count int
+			if err := countriesRows.Scan(&country, &count); err != nil {
+				continue
+			}
+			topCountries = append(topCountries, map[string]interface{}{
+				"name":  country,
+				"count": count,
+			})
 		}
-		devices = append(devices, map[string]interface{}{
-			"name":  device,
-			"count": count,
-		})
+		stats["top_countries"] = topCountries
 	}
-	stats["devices"] = devices
 
-	// Operating Systems
-	query = fmt.Sprintf(`
-		SELECT os, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND os IS NOT NULL AND os != ''
-		GROUP BY os 
-		ORDER BY count DESC
-		LIMIT ?
-	`, whereClause)
-
-	osRows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if osRows != nil {
-			if err := osRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
-			}
+	if sections["top_sources"] {
+		// Top Sources (Referrers) with URL parsing
+		query = fmt.Sprintf(`
+			SELECT 
+				CASE 
+					WHEN %[1]s = '' OR %[1]s IS NULL THEN 'Direct'
+					ELSE %[1]s
+				END as source,
+				COUNT(*) as count 
+			FROM %[2]s 
+			WHERE %[3]s
+			GROUP BY source 
+			ORDER BY count DESC 
+			LIMIT ?
+		`, topSourcesColumn(filters), source, whereClause)
+
+		sourcesRows, err := r.db.QueryContext(ctx, query, queryArgs...)
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	operatingSystems := []map[string]interface{}{}
-	for osRows.Next() {
-		var os string
-		var count int
-		if err := osRows.Scan(&os, &count); err != nil {
-			continue
+		defer func() {
+			if sourcesRows != nil {
+				if err := sourcesRows.Close(); err != nil {
+					log.Printf("Warning: failed to close rows: %v", err)
+				}
+			}
+		}()
+
+		topSources := []map[string]interface{}{}
+		for sourcesRows.Next() {
+			var referrer string
+			var count int
+			if err := sourcesRows.Scan(&referrer, &count); err != nil {
+				continue
+			}
+			topSources = append(topSources, map[string]interface{}{
+				"name":  referrer,
+				"count": count,
+			})
 		}
-		operatingSystems = append(operatingSystems, map[string]interface{}{
-			"name":  os,
-			"count": count,
-		})
+		stats["top_sources"] = topSources
 	}
-	stats["os"] = operatingSystems
 
-	// Top Countries
-	query = fmt.Sprintf(`
-		SELECT country, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND country IS NOT NULL AND country != ''
-		GROUP BY country 
-		ORDER BY count DESC 
-		LIMIT ?
-	`, whereClause)
+	if sections["trends"] {
+		// Calculate trends by comparing with previous period
+		duration := endDate.Sub(startDate)
+		prevStartDate := startDate.Add(-duration)
+		prevEndDate := startDate
 
-	countriesRows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if countriesRows != nil {
-			if err := countriesRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
-			}
-		}
-	}()
+		prevWhereClause := "timestamp BETWEEN ? AND ?"
+		prevArgs := []interface{}{prevStartDate, prevEndDate}
 
-	topCountries := []map[string]interface{}{}
-	for countriesRows.Next() {
-		var country string
-		var count int
-		if err := countriesRows.Scan(&country, &count); err != nil {
-			continue
+		// Apply same filters to previous period
+		if projectID, ok := filters["project"]; ok && projectID != "" {
+			prevWhereClause += " AND project_id = ?"
+			prevArgs = append(prevArgs, projectID)
 		}
-		topCountries = append(topCountries, map[string]interface{}{
-			"name":  country,
-			"count": count,
-		})
-	}
-	stats["top_countries"] = topCountries
-
-	// Top Sources (Referrers) with URL parsing
-	query = fmt.Sprintf(`
-		SELECT 
-			CASE 
-				WHEN referrer = '' OR referrer IS NULL THEN 'Direct'
-				ELSE referrer
-			END as source,
-			COUNT(*) as count 
-		FROM events 
-		WHERE %s
-		GROUP BY source 
-		ORDER BY count DESC 
-		LIMIT ?
-	`, whereClause)
-
-	sourcesRows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if sourcesRows != nil {
-			if err := sourcesRows.Close(); err != nil {
-				log.Printf("Warning: failed to close rows: %v", err)
-			}
+		if source, ok := filters["source"]; ok && source != "" {
+			prevWhereClause += " AND " + sourceCondition("referrer")
+			prevArgs = append(prevArgs, source, source)
 		}
-	}()
-
-	topSources := []map[string]interface{}{}
-	for sourcesRows.Next() {
-		var referrer string
-		var count int
-		if err := sourcesRows.Scan(&referrer, &count); err != nil {
-			continue
+		if country, ok := filters["country"]; ok && country != "" {
+			prevWhereClause += " AND country = ?"
+			prevArgs = append(prevArgs, country)
 		}
-		topSources = append(topSources, map[string]interface{}{
-			"name":  referrer,
-			"count": count,
-		})
-	}
-	stats["top_sources"] = topSources
-
-	// Calculate trends by comparing with previous period
-	duration := endDate.Sub(startDate)
-	prevStartDate := startDate.Add(-duration)
-	prevEndDate := startDate
-
-	prevWhereClause := "timestamp BETWEEN ? AND ?"
-	prevArgs := []interface{}{prevStartDate, prevEndDate}
-
-	// Apply same filters to previous period
-	if projectID, ok := filters["project"]; ok && projectID != "" {
-		prevWhereClause += " AND project_id = ?"
-		prevArgs = append(prevArgs, projectID)
-	}
-	if source, ok := filters["source"]; ok && source != "" {
-		prevWhereClause += " AND referrer = ?"
-		prevArgs = append(prevArgs, source)
-	}
-	if country, ok := filters["country"]; ok && country != "" {
-		prevWhereClause += " AND country = ?"
-		prevArgs = append(prevArgs, country)
-	}
-	if browser, ok := filters["browser"]; ok && browser != "" {
-		prevWhereClause += " AND browser = ?"
-		prevArgs = append(prevArgs, browser)
-	}
-	if device, ok := filters["device"]; ok && device != "" {
-		prevWhereClause += " AND device = ?"
-		prevArgs = append(prevArgs, device)
-	}
-	if os, ok := filters["os"]; ok && os != "" {
-		prevWhereClause += " AND os = ?"
-		prevArgs = append(prevArgs, os)
-	}
-	if eventName, ok := filters["event"]; ok && eventName != "" {
-		prevWhereClause += " AND event_name = ?"
-		prevArgs = append(prevArgs, eventName)
-	}
-	if page, ok := filters["page"]; ok && page != "" {
-		prevWhereClause += " AND url = ?"
-		prevArgs = append(prevArgs, page)
-	}
-
-	prevQuery := fmt.Sprintf(`
-		SELECT 
-			COUNT(*) as total_events,
-			APPROX_COUNT_DISTINCT( user_id) as unique_users,
-			APPROX_COUNT_DISTINCT( session_id) as total_visits,
-			COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views
-		FROM events 
-		WHERE %s
-	`, prevWhereClause)
-
-	var prevTotalEvents, prevUniqueUsers, prevTotalVisits, prevPageViews int
-	err = r.db.QueryRow(prevQuery, prevArgs...).Scan(&prevTotalEvents, &prevUniqueUsers, &prevTotalVisits, &prevPageViews)
-	if err == nil {
-		stats["prev_total_events"] = prevTotalEvents
-		stats["prev_unique_users"] = prevUniqueUsers
-		stats["prev_total_visits"] = prevTotalVisits
-		stats["prev_page_views"] = prevPageViews
-
-		// Calculate percentage changes
-		if prevTotalEvents > 0 {
-			stats["events_change"] = float64(totalEvents-prevTotalEvents) / float64(prevTotalEvents) * 100
+		if browser, ok := filters["browser"]; ok && browser != "" {
+			prevWhereClause += " AND browser = ?"
+			prevArgs = append(prevArgs, browser)
+		}
+		if device, ok := filters["device"]; ok && device != "" {
+			prevWhereClause += " AND device = ?"
+			prevArgs = append(prevArgs, device)
 		}
-		if prevUniqueUsers > 0 {
-			stats["users_change"] = float64(uniqueUsers-prevUniqueUsers) / float64(prevUniqueUsers) * 100
+		if os, ok := filters["os"]; ok && os != "" {
+			prevWhereClause += " AND os = ?"
+			prevArgs = append(prevArgs, os)
 		}
-		if prevTotalVisits > 0 {
-			stats["visits_change"] = float64(totalVisits-prevTotalVisits) / float64(prevTotalVisits) * 100
+		if eventName, ok := filters["event"]; ok && eventName != "" {
+			prevWhereClause += " AND event_name = ?"
+			prevArgs = append(prevArgs, eventName)
 		}
-		if prevPageViews > 0 {
-			stats["page_views_change"] = float64(pageViews-prevPageViews) / float64(prevPageViews) * 100
+		if page, ok := filters["page"]; ok && page != "" {
+			condition, pageArgs := pageCondition("url", page, filters)
+			prevWhereClause += " AND " + condition
+			prevArgs = append(prevArgs, pageArgs...)
+		}
+
+		prevQuery := fmt.Sprintf(`
+			SELECT 
+				COUNT(*) as total_events,
+				APPROX_COUNT_DISTINCT( user_id) as unique_users,
+				APPROX_COUNT_DISTINCT( session_id) as total_visits,
+				COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views
+			FROM %s 
+			WHERE %s
+		`, source, prevWhereClause)
+
+		var prevTotalEvents, prevUniqueUsers, prevTotalVisits, prevPageViews int
+		err = r.db.QueryRowContext(ctx, distinctCounts(prevQuery, exact), prevArgs...).Scan(&prevTotalEvents, &prevUniqueUsers, &prevTotalVisits, &prevPageViews)
+		if err == nil {
+			stats["prev_total_events"] = prevTotalEvents
+			stats["prev_unique_users"] = prevUniqueUsers
+			stats["prev_total_visits"] = prevTotalVisits
+			stats["prev_page_views"] = prevPageViews
+
+			// Calculate percentage changes
+			setRate(stats, "events_change", int64(totalEvents-prevTotalEvents), int64(prevTotalEvents), minSample)
+			setRate(stats, "users_change", int64(uniqueUsers-prevUniqueUsers), int64(prevUniqueUsers), minSample)
+			setRate(stats, "visits_change", int64(totalVisits-prevTotalVisits), int64(prevTotalVisits), minSample)
+			setRate(stats, "page_views_change", int64(pageViews-prevPageViews), int64(prevPageViews), minSample)
 		}
 	}
 
+	// Optional parts are left out when their query fails, which must not turn a
+	// timeout into a partial result
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	return stats, nil
 }
 
-func (r *eventRepository) GetOnlineUsers(timeWindow int) (map[string]interface{}, error) {
+func (r *eventRepository) GetOnlineUsers(ctx context.Context, timeWindow int) (map[string]interface{}, error) {
 	cutoffTime := time.Now().Add(-time.Duration(timeWindow) * time.Minute)
 
-	query := `
+	query := fmt.Sprintf(`
 		SELECT 
 			APPROX_COUNT_DISTINCT( user_id) as online_users,
 			APPROX_COUNT_DISTINCT( session_id) as active_sessions
-		FROM events 
+		FROM %s 
 		WHERE timestamp >= ?
-	`
+	`, r.getParquetSource(nil))
 
 	var onlineUsers, activeSessions int
-	err := r.db.QueryRow(query, cutoffTime).Scan(&onlineUsers, &activeSessions)
+	err := r.db.QueryRowContext(ctx, query, cutoffTime).Scan(&onlineUsers, &activeSessions)
 	if err != nil {
 		return nil, err
 	}
@@ -1002,10 +1314,48 @@ func (r *eventRepository) GetOnlineUsers(timeWindow int) (map[string]interface{}
 	}, nil
 }
 
-func (r *eventRepository) GetProjects() ([]string, error) {
-	query := `SELECT DISTINCT project_id FROM events WHERE project_id IS NOT NULL AND project_id != '' ORDER BY project_id`
+// GetRecentEvents returns the latest stored events, newest first
+func (r *eventRepository) GetRecentEvents(ctx context.Context, limit int) ([]domain.Event, error) {
+	query := fmt.Sprintf(`
+		SELECT id, timestamp, event_name, user_id, session_id, session_duration, url, referrer,
+			user_agent, ip, country, browser, os, device, is_bot, project_id, channel
+		FROM %s
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, r.getParquetSource(nil))
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	events := []domain.Event{}
+	for rows.Next() {
+		var e domain.Event
+		err := rows.Scan(
+			&e.ID, &e.Timestamp, &e.EventName, &e.UserID, &e.SessionID, &e.SessionDuration,
+			&e.URL, &e.Referrer, &e.UserAgent, &e.IP, &e.Country,
+			&e.Browser, &e.OS, &e.Device, &e.IsBot, &e.ProjectID, &e.Channel,
+		)
+		if err != nil {
+			log.Printf("Error scanning event: %v", err)
+			continue
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *eventRepository) GetProjects(ctx context.Context) ([]string, error) {
+	query := fmt.Sprintf(`SELECT DISTINCT project_id FROM %s WHERE project_id IS NOT NULL AND project_id != '' ORDER BY project_id`, r.getParquetSource(nil))
+
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -1028,121 +1378,56 @@ func (r *eventRepository) GetProjects() ([]string, error) {
 	return projects, nil
 }
 
-func (r *eventRepository) GetFunnelAnalysis(request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
+func (r *eventRepository) GetFunnelAnalysis(ctx context.Context, request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
+	if request.BreakdownBy != "" {
+		return r.getFunnelBreakdown(ctx, request)
+	}
+
+	// Counts are always exact: funnels have far fewer users than whole-site stats,
+	// and approximate counts could show a step with more users than the one before
+	source := r.getStatsSource(request.Filters)
 	if len(request.Steps) == 0 {
 		return nil, fmt.Errorf("at least one funnel step is required")
 	}
 
-	// Parse dates
-	startDate, err := time.Parse("2006-01-02", request.StartDate)
+	// The dates are days in the tz zone, which the source shifts timestamps to
+	startDate, _, err := domain.ParseDay(request.StartDate)
 	if err != nil {
 		return nil, fmt.Errorf("invalid start date: %v", err)
 	}
-	endDate, err := time.Parse("2006-01-02", request.EndDate)
+	_, endDate, err := domain.ParseDay(request.EndDate)
 	if err != nil {
 		return nil, fmt.Errorf("invalid end date: %v", err)
 	}
 
-	// Set to beginning and end of day
-	startDate = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, startDate.Location())
-	endDate = time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 23, 59, 59, 999999999, endDate.Location())
-
-	result := &domain.FunnelAnalysisResult{
-		Steps:     make([]domain.FunnelStepResult, len(request.Steps)),
-		TimeRange: fmt.Sprintf("%s to %s", request.StartDate, request.EndDate),
-	}
-
-	// Build base WHERE clause for global filters
-	baseWhereClause := "timestamp BETWEEN ? AND ?"
-	baseArgs := []interface{}{startDate, endDate}
-
-	if projectID, ok := request.Filters["project"]; ok && projectID != "" {
-		baseWhereClause += " AND project_id = ?"
-		baseArgs = append(baseArgs, projectID)
-	}
-	if country, ok := request.Filters["country"]; ok && country != "" {
-		baseWhereClause += " AND country = ?"
-		baseArgs = append(baseArgs, country)
-	}
-	if browser, ok := request.Filters["browser"]; ok && browser != "" {
-		baseWhereClause += " AND browser = ?"
-		baseArgs = append(baseArgs, browser)
-	}
-	if device, ok := request.Filters["device"]; ok && device != "" {
-		baseWhereClause += " AND device = ?"
-		baseArgs = append(baseArgs, device)
-	}
-	if os, ok := request.Filters["os"]; ok && os != "" {
-		baseWhereClause += " AND os = ?"
-		baseArgs = append(baseArgs, os)
+	minSample := minSampleSize()
+	scope, err := domain.ParseFunnelScope(request.Scope)
+	if err != nil {
+		return nil, err
 	}
-	if botFilter, ok := request.Filters["botFilter"]; ok && botFilter != "" {
-		switch botFilter {
-		case "bot":
-			baseWhereClause += " AND is_bot = TRUE"
-		case "human":
-			baseWhereClause += " AND is_bot = FALSE"
-		}
+	result := &domain.FunnelAnalysisResult{
+		Steps:                 make([]domain.FunnelStepResult, len(request.Steps)),
+		TimeRange:             fmt.Sprintf("%s to %s", request.StartDate, request.EndDate),
+		ConversionWindowHours: request.ConversionWindowHours,
+		MaxFunnelDuration:     request.MaxFunnelDuration,
+		Scope:                 scope,
+		StrictOrder:           request.InStrictOrder(),
 	}
 
 	// For each step, calculate metrics
-	var previousUserCount int64 = 0
-	var totalUsers int64 = 0
+	// Rates are over users, or over sessions in session scope
+	var previousCount int64 = 0
+	var totalCount int64 = 0
 
 	for i, step := range request.Steps {
-		// Build WHERE clause for this step
-		stepWhereClause := baseWhereClause
-		stepArgs := make([]interface{}, len(baseArgs))
-		copy(stepArgs, baseArgs)
-
-		// Add event name filter
-		if step.EventName != "" {
-			stepWhereClause += " AND event_name = ?"
-			stepArgs = append(stepArgs, step.EventName)
-		}
-
-		// Add URL filter if specified
-		if step.URL != "" {
-			stepWhereClause += " AND url = ?"
-			stepArgs = append(stepArgs, step.URL)
-		}
-
-		// Add step-specific filters
-		for key, value := range step.Filters {
-			switch key {
-			case "country":
-				stepWhereClause += " AND country = ?"
-				stepArgs = append(stepArgs, value)
-			case "browser":
-				stepWhereClause += " AND browser = ?"
-				stepArgs = append(stepArgs, value)
-			case "device":
-				stepWhereClause += " AND device = ?"
-				stepArgs = append(stepArgs, value)
-			case "os":
-				stepWhereClause += " AND os = ?"
-				stepArgs = append(stepArgs, value)
-			}
+		stepQuery := funnelStepQuery(source, startDate, endDate, request, scope, i)
+		var userCount, sessionCount, eventCount int64
+		err := r.db.QueryRowContext(ctx, stepQuery.query, stepQuery.args...).Scan(&userCount, &sessionCount, &eventCount)
+		if err != nil {
+			return nil, fmt.Errorf("error querying step %d: %v", i+1, err)
 		}
 
-		// If this is not the first step, we need to filter for users who completed previous steps
 		if i == 0 {
-			// First step: count all matching users
-			query := fmt.Sprintf(`
-				SELECT 
-					APPROX_COUNT_DISTINCT( user_id) as user_count,
-					APPROX_COUNT_DISTINCT( session_id) as session_count,
-					COUNT(*) as event_count
-				FROM events 
-				WHERE %s
-			`, stepWhereClause)
-
-			var userCount, sessionCount, eventCount int64
-			err := r.db.QueryRow(query, stepArgs...).Scan(&userCount, &sessionCount, &eventCount)
-			if err != nil {
-				return nil, fmt.Errorf("error querying step %d: %v", i+1, err)
-			}
-
 			result.Steps[i] = domain.FunnelStepResult{
 				Step:           step,
 				UserCount:      userCount,
@@ -1153,223 +1438,43 @@ func (r *eventRepository) GetFunnelAnalysis(request domain.FunnelRequest) (*doma
 				DropoffRate:    0.0,
 			}
 
-			totalUsers = userCount
-			previousUserCount = userCount
-			result.TotalUsers = totalUsers
+			totalCount = funnelCount(scope, userCount, sessionCount)
+			previousCount = totalCount
+			result.TotalUsers = userCount
 
 		} else {
-			// Subsequent steps: only count users who completed all previous steps
-			// Build a CTE that finds users who completed all previous steps in order
-			var cteBuilder strings.Builder
-			cteBuilder.WriteString("WITH ")
-
-			// Collect all arguments for all CTEs
-			var allCteArgs []interface{}
-
-			// Create CTEs for each previous step
-			for j := 0; j <= i; j++ {
-				if j > 0 {
-					cteBuilder.WriteString(", ")
-				}
-
-				prevStep := request.Steps[j]
-				cteName := fmt.Sprintf("step_%d", j+1)
-
-				// Build WHERE for this CTE
-				var cteWhereClause string
-				var cteArgs []interface{}
-
-				if j == 0 {
-					// First step: simple query without joins
-					cteWhereClause = baseWhereClause
-					cteArgs = make([]interface{}, len(baseArgs))
-					copy(cteArgs, baseArgs)
-
-					if prevStep.EventName != "" {
-						cteWhereClause += " AND event_name = ?"
-						cteArgs = append(cteArgs, prevStep.EventName)
-					}
-					if prevStep.URL != "" {
-						cteWhereClause += " AND url = ?"
-						cteArgs = append(cteArgs, prevStep.URL)
-					}
-
-					for key, value := range prevStep.Filters {
-						switch key {
-						case "country":
-							cteWhereClause += " AND country = ?"
-							cteArgs = append(cteArgs, value)
-						case "browser":
-							cteWhereClause += " AND browser = ?"
-							cteArgs = append(cteArgs, value)
-						case "device":
-							cteWhereClause += " AND device = ?"
-							cteArgs = append(cteArgs, value)
-						case "os":
-							cteWhereClause += " AND os = ?"
-							cteArgs = append(cteArgs, value)
-						}
-					}
-
-					fmt.Fprintf(&cteBuilder, "%s AS (SELECT user_id, session_id, timestamp FROM events WHERE %s)", cteName, cteWhereClause)
-					allCteArgs = append(allCteArgs, cteArgs...)
-				} else {
-					// Subsequent steps: join with previous step
-					// Build WHERE clause with e. prefix
-					cteWhereClause = "e.timestamp BETWEEN ? AND ?"
-					cteArgs = []interface{}{startDate, endDate}
-
-					// Add global filters with e. prefix
-					if projectID, ok := request.Filters["project"]; ok && projectID != "" {
-						cteWhereClause += " AND e.project_id = ?"
-						cteArgs = append(cteArgs, projectID)
-					}
-					if country, ok := request.Filters["country"]; ok && country != "" {
-						cteWhereClause += " AND e.country = ?"
-						cteArgs = append(cteArgs, country)
-					}
-					if browser, ok := request.Filters["browser"]; ok && browser != "" {
-						cteWhereClause += " AND e.browser = ?"
-						cteArgs = append(cteArgs, browser)
-					}
-					if device, ok := request.Filters["device"]; ok && device != "" {
-						cteWhereClause += " AND e.device = ?"
-						cteArgs = append(cteArgs, device)
-					}
-					if os, ok := request.Filters["os"]; ok && os != "" {
-						cteWhereClause += " AND e.os = ?"
-						cteArgs = append(cteArgs, os)
-					}
-					if botFilter, ok := request.Filters["botFilter"]; ok && botFilter != "" {
-						switch botFilter {
-						case "bot":
-							cteWhereClause += " AND e.is_bot = TRUE"
-						case "human":
-							cteWhereClause += " AND e.is_bot = FALSE"
-						}
-					}
-
-					if prevStep.EventName != "" {
-						cteWhereClause += " AND e.event_name = ?"
-						cteArgs = append(cteArgs, prevStep.EventName)
-					}
-					if prevStep.URL != "" {
-						cteWhereClause += " AND e.url = ?"
-						cteArgs = append(cteArgs, prevStep.URL)
-					}
-
-					for key, value := range prevStep.Filters {
-						switch key {
-						case "country":
-							cteWhereClause += " AND e.country = ?"
-							cteArgs = append(cteArgs, value)
-						case "browser":
-							cteWhereClause += " AND e.browser = ?"
-							cteArgs = append(cteArgs, value)
-						case "device":
-							cteWhereClause += " AND e.device = ?"
-							cteArgs = append(cteArgs, value)
-						case "os":
-							cteWhereClause += " AND e.os = ?"
-							cteArgs = append(cteArgs, value)
-						}
-					}
-
-					prevCteName := fmt.Sprintf("step_%d", j)
-					fmt.Fprintf(&cteBuilder, "%s AS (SELECT e.user_id, e.session_id, e.timestamp FROM events e INNER JOIN %s prev ON e.user_id = prev.user_id AND e.timestamp > prev.timestamp WHERE %s)", cteName, prevCteName, cteWhereClause)
-					allCteArgs = append(allCteArgs, cteArgs...)
-				}
-			}
-
-			// Main query to count users who reached this step
-			currentCteName := fmt.Sprintf("step_%d", i+1)
-			mainQuery := fmt.Sprintf(`
-				%s
-				SELECT 
-					APPROX_COUNT_DISTINCT( user_id) as user_count,
-					APPROX_COUNT_DISTINCT( session_id) as session_count,
-					COUNT(*) as event_count
-				FROM %s
-			`, cteBuilder.String(), currentCteName)
-
-			var userCount, sessionCount, eventCount int64
-			err := r.db.QueryRow(mainQuery, allCteArgs...).Scan(&userCount, &sessionCount, &eventCount)
-			if err != nil {
-				return nil, fmt.Errorf("error querying step %d: %v", i+1, err)
-			}
-
-			// Calculate conversion rates
-			conversionRate := 0.0
-			if previousUserCount > 0 {
-				conversionRate = float64(userCount) / float64(previousUserCount) * 100
-			}
-
-			overallRate := 0.0
-			if totalUsers > 0 {
-				overallRate = float64(userCount) / float64(totalUsers) * 100
-			}
+			// Calculate conversion rates, leaving them at zero when the previous
+			// step has too few users to be meaningful
+			count := funnelCount(scope, userCount, sessionCount)
+			conversionRate, conversionOK := sampleRate(count, previousCount, minSample)
+			overallRate, _ := sampleRate(count, totalCount, minSample)
+			insufficient := previousCount > 0 && !conversionOK
 
 			dropoffRate := 100.0 - conversionRate
+			if insufficient {
+				dropoffRate = 0
+			}
 
 			result.Steps[i] = domain.FunnelStepResult{
-				Step:           step,
-				UserCount:      userCount,
-				SessionCount:   sessionCount,
-				EventCount:     eventCount,
-				ConversionRate: conversionRate,
-				OverallRate:    overallRate,
-				DropoffRate:    dropoffRate,
+				Step:             step,
+				UserCount:        userCount,
+				SessionCount:     sessionCount,
+				EventCount:       eventCount,
+				ConversionRate:   conversionRate,
+				OverallRate:      overallRate,
+				DropoffRate:      dropoffRate,
+				InsufficientData: insufficient,
 			}
 
-			previousUserCount = userCount
+			previousCount = count
 		}
 
-		// Calculate average and median time to next step (if not the last step)
-		if i < len(request.Steps)-1 {
-			nextStep := request.Steps[i+1]
-
-			// Build next step WHERE clause
-			nextStepWhereClause := baseWhereClause
-			nextStepArgs := make([]interface{}, len(baseArgs))
-			copy(nextStepArgs, baseArgs)
-
-			if nextStep.EventName != "" {
-				nextStepWhereClause += " AND event_name = ?"
-				nextStepArgs = append(nextStepArgs, nextStep.EventName)
-			}
-			if nextStep.URL != "" {
-				nextStepWhereClause += " AND url = ?"
-				nextStepArgs = append(nextStepArgs, nextStep.URL)
-			}
-
-			// Optimized time calculation using epoch_ms for better performance
-			timeQuery := fmt.Sprintf(`
-				WITH current_step AS (
-					SELECT user_id, epoch_ms(timestamp) as ts_ms
-					FROM events 
-					WHERE %s
-				),
-				next_step AS (
-					SELECT user_id, epoch_ms(timestamp) as ts_ms
-					FROM events 
-					WHERE %s
-				),
-				time_diffs AS (
-					SELECT (n.ts_ms - c.ts_ms) / 1000.0 as time_diff_seconds
-					FROM current_step c
-					INNER JOIN next_step n ON c.user_id = n.user_id AND n.ts_ms > c.ts_ms
-				)
-				SELECT 
-					AVG(time_diff_seconds) as avg_time,
-					APPROX_QUANTILE(time_diff_seconds, 0.5) as median_time
-				FROM time_diffs
-			`, stepWhereClause, nextStepWhereClause)
-
-			// Combine args for the time query
-			timeQueryArgs := append(stepArgs, nextStepArgs...)
-
+		// Calculate average and median time to next step (if not the last step).
+		// Timings assume the steps happen in order, so they are skipped otherwise.
+		if i < len(request.Steps)-1 && result.StrictOrder {
+			timeQuery := funnelTimeToNextQuery(source, startDate, endDate, request, scope, i)
 			var avgTime, medianTime sql.NullFloat64
-			err := r.db.QueryRow(timeQuery, timeQueryArgs...).Scan(&avgTime, &medianTime)
+			err := r.db.QueryRowContext(ctx, timeQuery.query, timeQuery.args...).Scan(&avgTime, &medianTime)
 			if err == nil {
 				if avgTime.Valid {
 					result.Steps[i].AvgTimeToNext = avgTime.Float64
@@ -1386,73 +1491,29 @@ func (r *eventRepository) GetFunnelAnalysis(request domain.FunnelRequest) (*doma
 		lastStep := result.Steps[len(result.Steps)-1]
 		result.CompletedUsers = lastStep.UserCount
 
-		if result.TotalUsers > 0 {
-			result.CompletionRate = float64(result.CompletedUsers) / float64(result.TotalUsers) * 100
+		if totalCount > 0 {
+			var ok bool
+			completed := funnelCount(scope, lastStep.UserCount, lastStep.SessionCount)
+			result.CompletionRate, ok = sampleRate(completed, totalCount, minSample)
+			result.InsufficientData = !ok
 		}
 
 		// Calculate average time to complete entire funnel
-		if len(request.Steps) > 1 {
-			firstStep := request.Steps[0]
-			lastStepDef := request.Steps[len(request.Steps)-1]
-
-			// Build WHERE clauses
-			firstWhereClause := baseWhereClause
-			firstArgs := make([]interface{}, len(baseArgs))
-			copy(firstArgs, baseArgs)
-			if firstStep.EventName != "" {
-				firstWhereClause += " AND event_name = ?"
-				firstArgs = append(firstArgs, firstStep.EventName)
-			}
-			if firstStep.URL != "" {
-				firstWhereClause += " AND url = ?"
-				firstArgs = append(firstArgs, firstStep.URL)
-			}
-
-			lastWhereClause := baseWhereClause
-			lastArgs := make([]interface{}, len(baseArgs))
-			copy(lastArgs, baseArgs)
-			if lastStepDef.EventName != "" {
-				lastWhereClause += " AND event_name = ?"
-				lastArgs = append(lastArgs, lastStepDef.EventName)
-			}
-			if lastStepDef.URL != "" {
-				lastWhereClause += " AND url = ?"
-				lastArgs = append(lastArgs, lastStepDef.URL)
-			}
-
-			// Optimized completion time calculation using epoch_ms
-			completionTimeQuery := fmt.Sprintf(`
-				WITH first_step AS (
-					SELECT user_id, MIN(epoch_ms(timestamp)) as first_time_ms
-					FROM events 
-					WHERE %s
-					GROUP BY user_id
-				),
-				last_step AS (
-					SELECT user_id, MAX(epoch_ms(timestamp)) as last_time_ms
-					FROM events 
-					WHERE %s
-					GROUP BY user_id
-				),
-				completion_times AS (
-					SELECT (l.last_time_ms - f.first_time_ms) / 1000.0 as completion_seconds
-					FROM first_step f
-					INNER JOIN last_step l ON f.user_id = l.user_id AND l.last_time_ms > f.first_time_ms
-				)
-				SELECT AVG(completion_seconds) as avg_completion
-				FROM completion_times
-			`, firstWhereClause, lastWhereClause)
-
-			completionArgs := append(firstArgs, lastArgs...)
-
+		if len(request.Steps) > 1 && result.StrictOrder {
+			completionQuery := funnelCompletionQuery(source, startDate, endDate, request, scope)
 			var avgCompletion sql.NullFloat64
-			err := r.db.QueryRow(completionTimeQuery, completionArgs...).Scan(&avgCompletion)
+			err := r.db.QueryRowContext(ctx, completionQuery.query, completionQuery.args...).Scan(&avgCompletion)
 			if err == nil && avgCompletion.Valid {
 				result.AvgCompletion = avgCompletion.Float64
 			}
 		}
 	}
 
+	// Timings are best effort, but a timeout fails the whole analysis
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
@@ -1466,8 +1527,8 @@ func buildWhereClause(startDate, endDate time.Time, filters map[string]string) (
 		args = append(args, projectID)
 	}
 	if source, ok := filters["source"]; ok && source != "" {
-		whereClause += " AND referrer = ?"
-		args = append(args, source)
+		whereClause += " AND " + sourceCondition("referrer")
+		args = append(args, source, source)
 	}
 	if country, ok := filters["country"]; ok && country != "" {
 		whereClause += " AND country = ?"
@@ -1490,8 +1551,17 @@ func buildWhereClause(startDate, endDate time.Time, filters map[string]string) (
 		args = append(args, eventName)
 	}
 	if page, ok := filters["page"]; ok && page != "" {
-		whereClause += " AND url = ?"
-		args = append(args, page)
+		condition, pageArgs := pageCondition("url", page, filters)
+		whereClause += " AND " + condition
+		args = append(args, pageArgs...)
+	}
+	if userID, ok := filters["user_id"]; ok && userID != "" {
+		whereClause += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if sessionID, ok := filters["session_id"]; ok && sessionID != "" {
+		whereClause += " AND session_id = ?"
+		args = append(args, sessionID)
 	}
 	if botFilter, ok := filters["botFilter"]; ok && botFilter != "" {
 		switch botFilter {
@@ -1513,8 +1583,11 @@ func buildWhereClause(startDate, endDate time.Time, filters map[string]string) (
 		case "events":
 			// No additional filter needed for all events
 		case "bounce_rate":
-			// Bounce rate is calculated from page_view events
-			whereClause += " AND event_name = 'page_view'"
+			// Bounce rate is calculated from page_view events, unless bounces are
+			// single-event sessions, which needs every event of the session
+			if bounceMode(filters) != domain.BounceSingleEvent {
+				whereClause += " AND event_name = 'page_view'"
+			}
 		case "visit_duration":
 			// Visit duration uses all events in a session
 		case "views_per_visit":
@@ -1527,132 +1600,211 @@ func buildWhereClause(startDate, endDate time.Time, filters map[string]string) (
 }
 
 // GetTopStats returns the main statistics (counts, rates, etc.)
-func (r *eventRepository) GetTopStats(startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error) {
+func (r *eventRepository) GetTopStats(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (*domain.TopStatsResult, error) {
+	source := r.getStatsSource(filters)
+	exact := domain.ExactCounts(filters)
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
 
 	// Get current period stats
-	query := fmt.Sprintf(`
-		SELECT 
-			COUNT(*) as total_events,
-			APPROX_COUNT_DISTINCT( user_id) as unique_users,
-			APPROX_COUNT_DISTINCT( session_id) as total_visits,
-			COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views,
-			APPROX_COUNT_DISTINCT( CASE WHEN event_name = 'page_view' THEN session_id END) as sessions_with_views,
-			AVG(CASE WHEN session_duration > 0 THEN session_duration END) as avg_session_duration,
-			COUNT(CASE WHEN is_bot = TRUE THEN 1 END) as bot_events,
-			COUNT(CASE WHEN is_bot = FALSE THEN 1 END) as human_events,
-			APPROX_COUNT_DISTINCT( CASE WHEN is_bot = TRUE THEN user_id END) as bot_users,
-			APPROX_COUNT_DISTINCT( CASE WHEN is_bot = FALSE THEN user_id END) as human_users
-		FROM events 
-		WHERE %s
-	`, whereClause)
+	current := topStatsQuery(source, startDate, endDate, filters)
 
 	var totalEvents, uniqueUsers, totalVisits, pageViews, sessionsWithViews int
 	var botEvents, humanEvents, botUsers, humanUsers int
-	var avgSessionDuration sql.NullFloat64
+	var avgSessionDuration, weighted sql.NullFloat64
 
-	fmt.Println("query is", query, args)
-	err := r.db.QueryRow(query, args...).Scan(
+	err := r.db.QueryRowContext(ctx, current.query, current.args...).Scan(
 		&totalEvents, &uniqueUsers, &totalVisits, &pageViews, &sessionsWithViews,
-		&avgSessionDuration, &botEvents, &humanEvents, &botUsers, &humanUsers,
+		&avgSessionDuration, &botEvents, &humanEvents, &botUsers, &humanUsers, &weighted,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	stats := make(map[string]interface{})
-	stats["total_events"] = totalEvents
-	stats["unique_users"] = uniqueUsers
-	stats["total_visits"] = totalVisits
-	stats["page_views"] = pageViews
+	// Counts of sampled events are scaled up to estimates of all events. Rates are
+	// ratios of counts scaled alike and are left as sampled.
+	scale := sampleScale(totalEvents, weighted.Float64)
+	minSample := minSampleSize()
+	stats := &domain.TopStatsResult{
+		Meta:          statsMeta(exact, int64(totalEvents), startDate, endDate, filters),
+		TotalEvents:   scaleCount(totalEvents, scale),
+		UniqueUsers:   scaleCount(uniqueUsers, scale),
+		TotalVisits:   scaleCount(totalVisits, scale),
+		PageViews:     scaleCount(pageViews, scale),
+		ViewsPerVisit: viewsPerVisit(pageViews, sessionsWithViews),
+		// Bot statistics
+		BotEvents:   scaleCount(botEvents, scale),
+		HumanEvents: scaleCount(humanEvents, scale),
+		BotUsers:    scaleCount(botUsers, scale),
+		HumanUsers:  scaleCount(humanUsers, scale),
+	}
+	if scale != 1 {
+		stats.Meta.Approximate = true
+		stats.Meta.SampleRate = 1 / scale
+	}
 
 	// Average session duration
 	if avgSessionDuration.Valid {
-		stats["avg_session_duration"] = avgSessionDuration.Float64
-	} else {
-		stats["avg_session_duration"] = 0.0
+		stats.AvgSessionDuration = avgSessionDuration.Float64
 	}
 
 	// Calculate bounce rate
-	var bounceRate float64
+	stats.BounceRate = domain.RateOf(0)
 	if sessionsWithViews > 0 {
-		bounceRateQuery := fmt.Sprintf(`
-			WITH session_view_counts AS (
-				SELECT 
-					session_id,
-					COUNT(*) as view_count
-				FROM events 
-				WHERE %s AND event_name = 'page_view'
-				GROUP BY session_id
-			)
-			SELECT COUNT(*) as single_page_sessions
-			FROM session_view_counts
-			WHERE view_count = 1
-		`, whereClause)
+		bounceRateQuery := bouncedSessionsQuery(source, whereClause, bounceMode(filters))
 
 		var singlePageSessions int
-		err = r.db.QueryRow(bounceRateQuery, args...).Scan(&singlePageSessions)
+		err = r.db.QueryRowContext(ctx, bounceRateQuery, args...).Scan(&singlePageSessions)
 		if err == nil {
-			bounceRate = float64(singlePageSessions) / float64(sessionsWithViews) * 100
+			stats.BounceRate = topStatsRate(stats, "bounce_rate", optionalRate(int64(singlePageSessions), int64(sessionsWithViews), minSample))
+			bounced, withViews := scaleCount(singlePageSessions, scale), scaleCount(sessionsWithViews, scale)
+			stats.SinglePageSessions = &bounced
+			stats.SessionsWithViews = &withViews
 		}
 	}
-	stats["bounce_rate"] = bounceRate
-
-	// Bot statistics
-	stats["bot_events"] = botEvents
-	stats["human_events"] = humanEvents
-	stats["bot_users"] = botUsers
-	stats["human_users"] = humanUsers
 
 	if totalEvents > 0 {
-		stats["bot_percentage"] = float64(botEvents) / float64(totalEvents) * 100
-	} else {
-		stats["bot_percentage"] = 0.0
+		stats.BotPercentage = float64(botEvents) / float64(totalEvents) * 100
 	}
 
 	// Calculate trends by comparing with previous period
-	duration := endDate.Sub(startDate)
-	prevStartDate := startDate.Add(-duration)
-	prevEndDate := startDate
+	prevQuery := previousTopStatsQuery(source, startDate, endDate, filters)
+
+	var prevTotalEvents, prevUniqueUsers, prevTotalVisits, prevPageViews, prevSessionsWithViews int
+	var prevWeighted sql.NullFloat64
+	err = r.db.QueryRowContext(ctx, prevQuery.query, prevQuery.args...).Scan(&prevTotalEvents, &prevUniqueUsers, &prevTotalVisits, &prevPageViews, &prevSessionsWithViews, &prevWeighted)
+	if err == nil {
+		prevViewsPerVisit := viewsPerVisit(prevPageViews, prevSessionsWithViews)
+		// The previous period may have been sampled at another rate
+		prevScale := sampleScale(prevTotalEvents, prevWeighted.Float64)
+		prevTotalEvents = scaleCount(prevTotalEvents, prevScale)
+		prevUniqueUsers = scaleCount(prevUniqueUsers, prevScale)
+		prevTotalVisits = scaleCount(prevTotalVisits, prevScale)
+		prevPageViews = scaleCount(prevPageViews, prevScale)
+		stats.PrevTotalEvents = &prevTotalEvents
+		stats.PrevUniqueUsers = &prevUniqueUsers
+		stats.PrevTotalVisits = &prevTotalVisits
+		stats.PrevPageViews = &prevPageViews
+		stats.PrevViewsPerVisit = &prevViewsPerVisit
+
+		stats.EventsChange = topStatsRate(stats, "events_change", optionalRate(int64(stats.TotalEvents-prevTotalEvents), int64(prevTotalEvents), minSample))
+		stats.UsersChange = topStatsRate(stats, "users_change", optionalRate(int64(stats.UniqueUsers-prevUniqueUsers), int64(prevUniqueUsers), minSample))
+		stats.VisitsChange = topStatsRate(stats, "visits_change", optionalRate(int64(stats.TotalVisits-prevTotalVisits), int64(prevTotalVisits), minSample))
+		stats.PageViewsChange = topStatsRate(stats, "page_views_change", optionalRate(int64(stats.PageViews-prevPageViews), int64(prevPageViews), minSample))
+		stats.ViewsPerVisitChange = topStatsRate(stats, "views_per_visit_change", optionalChange(stats.ViewsPerVisit, prevViewsPerVisit, int64(prevSessionsWithViews), minSample))
+	}
+
+	// Bounce rate and comparison are skipped on error, a timeout is not
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
 
-	prevWhereClause, prevArgs := buildWhereClause(prevStartDate, prevEndDate, filters)
-	prevQuery := fmt.Sprintf(`
+// topStatsQuery is the current-period query of GetTopStats
+func topStatsQuery(source string, startDate, endDate time.Time, filters map[string]string) statsQuery {
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
+	query := fmt.Sprintf(`
+		WITH filtered AS (
+			SELECT * FROM %s WHERE %s
+		),
+		%s
 		SELECT 
 			COUNT(*) as total_events,
 			APPROX_COUNT_DISTINCT( user_id) as unique_users,
 			APPROX_COUNT_DISTINCT( session_id) as total_visits,
-			COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views
-		FROM events 
+			COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views,
+			APPROX_COUNT_DISTINCT( CASE WHEN event_name = 'page_view' THEN session_id END) as sessions_with_views,
+			%s as avg_session_duration,
+			COUNT(CASE WHEN is_bot = TRUE THEN 1 END) as bot_events,
+			COUNT(CASE WHEN is_bot = FALSE THEN 1 END) as human_events,
+			APPROX_COUNT_DISTINCT( CASE WHEN is_bot = TRUE THEN user_id END) as bot_users,
+			APPROX_COUNT_DISTINCT( CASE WHEN is_bot = FALSE THEN user_id END) as human_users,
+			%s as weighted_events
+		FROM filtered
+	`, source, whereClause, sessionDurationsCTE("filtered"), avgSessionDuration, weightedEvents)
+	return statsQuery{query: distinctCounts(query, domain.ExactCounts(filters)), args: args}
+}
+
+// previousTopStatsQuery is the query of GetTopStats for the period of the same
+// length just before startDate, which the changes are computed against
+func previousTopStatsQuery(source string, startDate, endDate time.Time, filters map[string]string) statsQuery {
+	duration := endDate.Sub(startDate)
+	whereClause, args := buildWhereClause(startDate.Add(-duration), startDate, filters)
+	query := fmt.Sprintf(`
+		SELECT 
+			COUNT(*) as total_events,
+			APPROX_COUNT_DISTINCT( user_id) as unique_users,
+			APPROX_COUNT_DISTINCT( session_id) as total_visits,
+			COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views,
+			APPROX_COUNT_DISTINCT( CASE WHEN event_name = 'page_view' THEN session_id END) as sessions_with_views,
+			%s as weighted_events
+		FROM %s 
 		WHERE %s
-	`, prevWhereClause)
+	`, weightedEvents, source, whereClause)
+	return statsQuery{query: distinctCounts(query, domain.ExactCounts(filters)), args: args}
+}
 
-	var prevTotalEvents, prevUniqueUsers, prevTotalVisits, prevPageViews int
-	err = r.db.QueryRow(prevQuery, prevArgs...).Scan(&prevTotalEvents, &prevUniqueUsers, &prevTotalVisits, &prevPageViews)
-	if err == nil {
-		stats["prev_total_events"] = prevTotalEvents
-		stats["prev_unique_users"] = prevUniqueUsers
-		stats["prev_total_visits"] = prevTotalVisits
-		stats["prev_page_views"] = prevPageViews
+// topStatsRate returns rate, listing key under the insufficient data of stats when
+// the rate is null, as markInsufficient does for map results
+func topStatsRate(stats *domain.TopStatsResult, key string, rate domain.OptionalRate) domain.OptionalRate {
+	if rate.IsNull() {
+		stats.InsufficientData = append(stats.InsufficientData, key)
+	}
+	return rate
+}
 
-		if prevTotalEvents > 0 {
-			stats["events_change"] = float64(totalEvents-prevTotalEvents) / float64(prevTotalEvents) * 100
-		}
-		if prevUniqueUsers > 0 {
-			stats["users_change"] = float64(uniqueUsers-prevUniqueUsers) / float64(prevUniqueUsers) * 100
+// viewsPerVisit is page views per session with a page view, as the views_per_visit
+// timeline metric computes it
+func viewsPerVisit(pageViews, sessionsWithViews int) float64 {
+	if sessionsWithViews == 0 {
+		return 0
+	}
+	return float64(pageViews) / float64(sessionsWithViews)
+}
+
+// GetTimeline returns timeline data for visualization
+func (r *eventRepository) GetTimeline(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error) {
+	query, timeFormat := timelineQuery(r.getStatsSource(filters), startDate, endDate, filters)
+	rows, err := r.db.QueryContext(ctx, query.query, query.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
 		}
-		if prevTotalVisits > 0 {
-			stats["visits_change"] = float64(totalVisits-prevTotalVisits) / float64(prevTotalVisits) * 100
+	}()
+
+	timeline := []map[string]interface{}{}
+	for rows.Next() {
+		var date string
+		var count sql.NullFloat64
+		if err := rows.Scan(&date, &count); err != nil {
+			log.Printf("Error scanning timeline row: %v", err)
+			continue
 		}
-		if prevPageViews > 0 {
-			stats["page_views_change"] = float64(pageViews-prevPageViews) / float64(prevPageViews) * 100
+
+		countValue := 0.0
+		if count.Valid {
+			countValue = count.Float64
 		}
+
+		timeline = append(timeline, map[string]interface{}{
+			"date":  date,
+			"count": countValue,
+		})
 	}
 
-	return stats, nil
+	return map[string]interface{}{
+		"timeline":        timeline,
+		"timeline_format": timeFormat,
+	}, nil
 }
 
-// GetTimeline returns timeline data for visualization
-func (r *eventRepository) GetTimeline(startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error) {
+// timelineQuery is the query of GetTimeline, with the "hour", "day" or "month"
+// buckets it picks for the length of the date range
+func timelineQuery(source string, startDate, endDate time.Time, filters map[string]string) (statsQuery, string) {
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
 
 	// Determine what metric to display
@@ -1676,194 +1828,104 @@ func (r *eventRepository) GetTimeline(startDate, endDate time.Time, filters map[
 				ELSE CAST(SUM(CASE WHEN event_name = 'page_view' THEN 1 ELSE 0 END) AS FLOAT) * 100.0 / NULLIF(APPROX_COUNT_DISTINCT( session_id), 0)
 			END as count`
 	case "visit_duration":
-		selectClause = "AVG(CASE WHEN session_duration > 0 THEN session_duration END) as count"
+		// Averaged per session rather than per event, see sessionDurationTimelineQuery
 	default:
 		selectClause = "APPROX_COUNT_DISTINCT( user_id) as count"
 	}
 
 	// Determine granularity based on date range
 	timelineDuration := endDate.Sub(startDate)
-	var timelineQuery string
+	var query string
 	var timeFormat string
 
 	if timelineDuration <= 24*time.Hour {
 		// Hourly data
 		if metric == "bounce_rate" {
-			timelineQuery = fmt.Sprintf(`
-				WITH session_page_counts AS (
-					SELECT 
-						date_hour as date,
-						session_id,
-						COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_view_count
-					FROM events 
-					WHERE %s
-					GROUP BY date, session_id
-				)
-				SELECT 
-					date,
-					CAST(COUNT(CASE WHEN page_view_count = 1 THEN 1 END) AS FLOAT) * 100.0 / NULLIF(COUNT(*), 0) as count
-				FROM session_page_counts
-				GROUP BY date
-				ORDER BY date
-			`, whereClause)
+			query = bounceTimelineQuery("date_hour", source, whereClause, bounceMode(filters))
+		} else if metric == "visit_duration" {
+			query = sessionDurationTimelineQuery("date_hour", source, whereClause)
 		} else {
-			timelineQuery = fmt.Sprintf(`
+			query = fmt.Sprintf(`
 				SELECT 
 					date_hour as date, 
 					%s
-				FROM events 
+				FROM %s 
 				WHERE %s
 				GROUP BY date 
 				ORDER BY date
-			`, selectClause, whereClause)
+			`, selectClause, source, whereClause)
 		}
 		timeFormat = "hour"
 	} else if timelineDuration <= 90*24*time.Hour {
 		// Daily data
 		if metric == "bounce_rate" {
-			timelineQuery = fmt.Sprintf(`
-				WITH session_page_counts AS (
-					SELECT 
-						date_day as date,
-						session_id,
-						COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_view_count
-					FROM events 
-					WHERE %s
-					GROUP BY date, session_id
-				)
-				SELECT 
-					date,
-					CAST(COUNT(CASE WHEN page_view_count = 1 THEN 1 END) AS FLOAT) * 100.0 / NULLIF(COUNT(*), 0) as count
-				FROM session_page_counts
-				GROUP BY date
-				ORDER BY date
-			`, whereClause)
+			query = bounceTimelineQuery("date_day", source, whereClause, bounceMode(filters))
+		} else if metric == "visit_duration" {
+			query = sessionDurationTimelineQuery("date_day", source, whereClause)
 		} else {
-			timelineQuery = fmt.Sprintf(`
+			query = fmt.Sprintf(`
 				SELECT 
 					date_day as date, 
 					%s
-				FROM events 
+				FROM %s 
 				WHERE %s
 				GROUP BY date 
 				ORDER BY date
-			`, selectClause, whereClause)
+			`, selectClause, source, whereClause)
 		}
 		timeFormat = "day"
 	} else {
 		// Monthly data
 		if metric == "bounce_rate" {
-			timelineQuery = fmt.Sprintf(`
-				WITH session_page_counts AS (
-					SELECT 
-						date_month as date,
-						session_id,
-						COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_view_count
-					FROM events 
-					WHERE %s
-					GROUP BY date, session_id
-				)
-				SELECT 
-					date,
-					CAST(COUNT(CASE WHEN page_view_count = 1 THEN 1 END) AS FLOAT) * 100.0 / NULLIF(COUNT(*), 0) as count
-				FROM session_page_counts
-				GROUP BY date
-				ORDER BY date
-			`, whereClause)
+			query = bounceTimelineQuery("date_month", source, whereClause, bounceMode(filters))
+		} else if metric == "visit_duration" {
+			query = sessionDurationTimelineQuery("date_month", source, whereClause)
 		} else {
-			timelineQuery = fmt.Sprintf(`
+			query = fmt.Sprintf(`
 				SELECT 
 					date_month as date, 
 					%s
-				FROM events 
+				FROM %s 
 				WHERE %s
 				GROUP BY date 
 				ORDER BY date
-			`, selectClause, whereClause)
+			`, selectClause, source, whereClause)
 		}
 		timeFormat = "month"
 	}
 
-	rows, err := r.db.Query(timelineQuery, args...)
+	return statsQuery{query: distinctCounts(query, domain.ExactCounts(filters)), args: args}, timeFormat
+}
+
+// GetTopPages returns a page of the top pages and the number of pages
+func (r *eventRepository) GetTopPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+	topPages, total, err := r.queryTopList(ctx, r.topPagesQuery(startDate, endDate, filters), "url", limit, filters)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("Warning: failed to close rows: %v", err)
-		}
-	}()
-
-	timeline := []map[string]interface{}{}
-	for rows.Next() {
-		var date string
-		var count sql.NullFloat64
-		if err := rows.Scan(&date, &count); err != nil {
-			log.Printf("Error scanning timeline row: %v", err)
-			continue
-		}
-
-		countValue := 0.0
-		if count.Valid {
-			countValue = count.Float64
-		}
-
-		timeline = append(timeline, map[string]interface{}{
-			"date":  date,
-			"count": countValue,
-		})
-	}
 
 	return map[string]interface{}{
-		"timeline":        timeline,
-		"timeline_format": timeFormat,
+		"top_pages": topPages,
+		"total":     total,
 	}, nil
 }
 
-// GetTopPages returns top pages with entry/exit pages
-func (r *eventRepository) GetTopPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+// topPagesQuery is the grouped query of GetTopPages
+func (r *eventRepository) topPagesQuery(startDate, endDate time.Time, filters map[string]string) statsQuery {
+	source, count, _ := r.eventCountSource(endDate, filters)
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
-	queryArgs := append(args, limit)
 
-	// Top pages
-	query := fmt.Sprintf(`
-		SELECT url, COUNT(*) as count 
-		FROM events 
+	grouped := fmt.Sprintf(`
+		SELECT %s as name, %s as count 
+		FROM %s 
 		WHERE %s AND url IS NOT NULL AND url != ''
-		GROUP BY url 
-		ORDER BY count DESC 
-		LIMIT ?
-	`, whereClause)
-
-	rows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("Warning: failed to close rows: %v", err)
-		}
-	}()
-
-	topPages := []map[string]interface{}{}
-	for rows.Next() {
-		var url string
-		var count int
-		if err := rows.Scan(&url, &count); err != nil {
-			continue
-		}
-		topPages = append(topPages, map[string]interface{}{
-			"url":   url,
-			"count": count,
-		})
-	}
-
-	return map[string]interface{}{
-		"top_pages": topPages,
-	}, nil
+		GROUP BY name
+	`, topPagesColumn(filters), count, source, whereClause)
+	return statsQuery{query: grouped, args: args}
 }
 
-func (r *eventRepository) GetEntryExitPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+func (r *eventRepository) GetEntryExitPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+	source := r.getStatsSource(filters)
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
 	queryArgs := append(args, limit)
 
@@ -1872,10 +1934,10 @@ func (r *eventRepository) GetEntryExitPages(startDate, endDate time.Time, limit
 WITH ordered AS (
     SELECT
         session_id,
-        url,
+        %s AS url,
         event_name,
         timestamp
-    FROM events
+    FROM %s
     WHERE %s
         AND event_name = 'page_view'
         AND url IS NOT NULL
@@ -1920,9 +1982,9 @@ SELECT * FROM (
     ORDER BY count DESC
     LIMIT %d
 ) AS exit_query
-	`, whereClause, limit, limit)
+	`, topPagesColumn(filters), source, whereClause, limit, limit)
 
-	rows, err := r.db.Query(query, queryArgs...)
+	rows, err := r.db.QueryContext(ctx, query, queryArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -1955,23 +2017,64 @@ SELECT * FROM (
 	}, nil
 }
 
-// GetTopCountries returns top countries
-func (r *eventRepository) GetTopCountries(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error) {
+// GetUserSessions reconstructs a user's sessions, newest first, each with its events in
+// order. Sessions are paginated with limit and offset; events beyond MaxSessionEvents
+// in a session are left out and the session is marked truncated.
+func (r *eventRepository) GetUserSessions(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int, filters map[string]string) ([]domain.Session, error) {
+	source := r.getStatsSource(filters)
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
-	queryArgs := append(args, limit)
+	queryArgs := append(args, userID, limit, offset)
 
 	query := fmt.Sprintf(`
-		SELECT country, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND country IS NOT NULL AND country != ''
-		GROUP BY country 
-		ORDER BY count DESC 
-		LIMIT ?
-	`, whereClause)
-
-	rows, err := r.db.Query(query, queryArgs...)
+WITH user_events AS (
+    SELECT
+        session_id,
+        timestamp,
+        event_name,
+        COALESCE(url, '') AS url,
+        COALESCE(device, '') AS device,
+        COALESCE(browser, '') AS browser,
+        COALESCE(os, '') AS os,
+        COALESCE(country, '') AS country,
+        COALESCE(channel, '') AS channel,
+        ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp ASC, id ASC) AS step
+    FROM %s
+    WHERE %s
+        AND user_id = ?
+        AND session_id IS NOT NULL
+        AND session_id != ''
+),
+sessions AS (
+    SELECT
+        session_id,
+        MIN(timestamp) AS start_time,
+        MAX(timestamp) AS end_time,
+        COUNT(*) AS event_count,
+        COALESCE(arg_min(url, step) FILTER (WHERE event_name = 'page_view' AND url != ''), '') AS entry_page,
+        COALESCE(arg_max(url, step) FILTER (WHERE event_name = 'page_view' AND url != ''), '') AS exit_page,
+        arg_min(device, step) AS device,
+        arg_min(browser, step) AS browser,
+        arg_min(os, step) AS os,
+        arg_min(country, step) AS country,
+        arg_min(channel, step) AS channel
+    FROM user_events
+    GROUP BY session_id
+    ORDER BY start_time DESC, session_id
+    LIMIT ? OFFSET ?
+)
+SELECT
+    s.session_id, s.start_time, s.end_time, s.event_count, s.entry_page, s.exit_page,
+    s.device, s.browser, s.os, s.country, s.channel,
+    e.timestamp, e.event_name, e.url
+FROM sessions s
+JOIN user_events e ON e.session_id = s.session_id
+WHERE e.step <= %d
+ORDER BY s.start_time DESC, s.session_id, e.step
+	`, source, whereClause, MaxSessionEvents)
+
+	rows, err := r.db.QueryContext(ctx, query, queryArgs...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("query failed: %w", err)
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
@@ -1979,82 +2082,188 @@ func (r *eventRepository) GetTopCountries(startDate, endDate time.Time, limit in
 		}
 	}()
 
-	countries := []map[string]interface{}{}
+	sessions := []domain.Session{}
 	for rows.Next() {
-		var country string
-		var count int
-		if err := rows.Scan(&country, &count); err != nil {
-			continue
-		}
-		countries = append(countries, map[string]interface{}{
-			"name":  country,
-			"count": count,
-		})
+		var session domain.Session
+		var event domain.SessionEvent
+		if err := rows.Scan(
+			&session.SessionID, &session.StartTime, &session.EndTime, &session.EventCount,
+			&session.EntryPage, &session.ExitPage,
+			&session.Device, &session.Browser, &session.OS, &session.Country, &session.Channel,
+			&event.Timestamp, &event.EventName, &event.URL,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session row: %w", err)
+		}
+
+		// Rows arrive grouped by session, in step order
+		if len(sessions) == 0 || sessions[len(sessions)-1].SessionID != session.SessionID {
+			session.UserID = userID
+			session.Duration = int(session.EndTime.Sub(session.StartTime).Seconds())
+			session.Truncated = session.EventCount > MaxSessionEvents
+			session.Pages = []string{}
+			session.Events = []domain.SessionEvent{}
+			sessions = append(sessions, session)
+		}
+
+		current := &sessions[len(sessions)-1]
+		current.Events = append(current.Events, event)
+		if event.EventName == "page_view" && event.URL != "" {
+			current.Pages = append(current.Pages, event.URL)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return countries, nil
+	return sessions, nil
 }
 
-// GetTopSources returns top referrer sources
-func (r *eventRepository) GetTopSources(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error) {
+// GetTopCountries returns a page of the top countries and the number of countries
+func (r *eventRepository) GetTopCountries(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return r.queryTopList(ctx, r.topCountriesQuery(startDate, endDate, filters), "name", limit, filters)
+}
+
+// topCountriesQuery is the grouped query of GetTopCountries
+func (r *eventRepository) topCountriesQuery(startDate, endDate time.Time, filters map[string]string) statsQuery {
+	source, count, _ := r.eventCountSource(endDate, filters)
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
-	queryArgs := append(args, limit)
 
-	query := fmt.Sprintf(`
+	grouped := fmt.Sprintf(`
+		SELECT country as name, %s as count 
+		FROM %s 
+		WHERE %s AND country IS NOT NULL AND country != ''
+		GROUP BY country
+	`, count, source, whereClause)
+	return statsQuery{query: grouped, args: args}
+}
+
+// GetTopLanguages returns a page of the top visitor languages, as primary language
+// subtags such as "en", and the number of languages
+func (r *eventRepository) GetTopLanguages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return r.queryTopList(ctx, r.topLanguagesQuery(startDate, endDate, filters), "name", limit, filters)
+}
+
+// topLanguagesQuery is the grouped query of GetTopLanguages
+func (r *eventRepository) topLanguagesQuery(startDate, endDate time.Time, filters map[string]string) statsQuery {
+	source, count, _ := r.eventCountSource(endDate, filters)
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
+
+	grouped := fmt.Sprintf(`
+		SELECT language as name, %s as count 
+		FROM %s 
+		WHERE %s AND language IS NOT NULL AND language != ''
+		GROUP BY language
+	`, count, source, whereClause)
+	return statsQuery{query: grouped, args: args}
+}
+
+// GetTopSources returns a page of the top referrer sources, grouped by domain, and
+// the number of sources. With a source filter it drills down into the full
+// referrer URLs of that source.
+func (r *eventRepository) GetTopSources(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return r.queryTopList(ctx, r.topSourcesQuery(startDate, endDate, filters), "name", limit, filters)
+}
+
+// topSourcesQuery is the grouped query of GetTopSources
+func (r *eventRepository) topSourcesQuery(startDate, endDate time.Time, filters map[string]string) statsQuery {
+	source, count, rollup := r.eventCountSource(endDate, filters)
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
+
+	// daily_stats stores referrers as domains, which the spam pattern matches too
+	column, referrer := topSourcesColumn(filters), "referrer"
+	if rollup {
+		column, referrer = "source", "source"
+	}
+	if referrerspam.Mode() == referrerspam.ModeExclude {
+		whereClause += fmt.Sprintf(" AND NOT regexp_matches(lower(COALESCE(%s, '')), ?)", referrer)
+		args = append(args, referrerspam.Pattern())
+	}
+
+	grouped := fmt.Sprintf(`
 		SELECT 
 			CASE 
-				WHEN referrer = '' OR referrer IS NULL THEN 'Direct'
-				ELSE referrer
-			END as source,
-			COUNT(*) as count 
-		FROM events 
+				WHEN %[1]s = '' OR %[1]s IS NULL THEN 'Direct'
+				ELSE %[1]s
+			END as name,
+			%[2]s as count 
+		FROM %[3]s 
+		WHERE %[4]s
+		GROUP BY name
+	`, column, count, source, whereClause)
+	return statsQuery{query: grouped, args: args}
+}
+
+// GetTopEvents returns a page of the top event names and the number of names
+func (r *eventRepository) GetTopEvents(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return r.queryTopList(ctx, r.topEventsQuery(startDate, endDate, filters), "name", limit, filters)
+}
+
+// topEventsQuery is the grouped query of GetTopEvents
+func (r *eventRepository) topEventsQuery(startDate, endDate time.Time, filters map[string]string) statsQuery {
+	source, count, _ := r.eventCountSource(endDate, filters)
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
+
+	grouped := fmt.Sprintf(`
+		SELECT event_name as name, %s as count 
+		FROM %s 
 		WHERE %s
-		GROUP BY source 
-		ORDER BY count DESC 
-		LIMIT ?
-	`, whereClause)
+		GROUP BY event_name
+	`, count, source, whereClause)
+	return statsQuery{query: grouped, args: args}
+}
 
-	rows, err := r.db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("Warning: failed to close rows: %v", err)
-		}
-	}()
+// GetBrowsersDevicesOS returns a page each of the top browsers, devices and
+// operating systems, with the number of each under "totals"
+func (r *eventRepository) GetBrowsersDevicesOS(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+	source, count, _ := r.eventCountSource(endDate, filters)
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
 
-	sources := []map[string]interface{}{}
-	for rows.Next() {
-		var source string
-		var count int
-		if err := rows.Scan(&source, &count); err != nil {
-			continue
+	result := make(map[string]interface{})
+	totals := make(map[string]int)
+	for _, list := range []struct{ key, column string }{
+		{"browsers", "browser"},
+		{"devices", "device"},
+		{"os", "os"},
+	} {
+		grouped := fmt.Sprintf(`
+			SELECT %[1]s as name, %[2]s as count 
+			FROM %[3]s 
+			WHERE %[4]s AND %[1]s IS NOT NULL AND %[1]s != ''
+			GROUP BY %[1]s
+		`, list.column, count, source, whereClause)
+
+		items, total, err := r.queryTopList(ctx, statsQuery{query: grouped, args: args}, "name", limit, filters)
+		if err != nil {
+			return nil, err
 		}
-		sources = append(sources, map[string]interface{}{
-			"name":  source,
-			"count": count,
-		})
+		result[list.key] = items
+		totals[list.key] = total
 	}
+	result["totals"] = totals
 
-	return sources, nil
+	return result, nil
 }
 
-// GetTopEvents returns top event names
-func (r *eventRepository) GetTopEvents(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error) {
+// GetChannels returns traffic breakdown by channel with optional filters
+func (r *eventRepository) GetChannels(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.ChannelResult, error) {
+	source := r.getStatsSource(filters)
+	exact := domain.ExactCounts(filters)
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
-	queryArgs := append(args, limit)
 
 	query := fmt.Sprintf(`
-		SELECT event_name, COUNT(*) as count 
-		FROM events 
+		SELECT 
+			COALESCE(channel, 'Unknown') as channel_name,
+			COUNT(*) as total_events,
+			APPROX_COUNT_DISTINCT( user_id) as unique_users,
+			APPROX_COUNT_DISTINCT( session_id) as total_visits,
+			COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views
+		FROM %s 
 		WHERE %s
-		GROUP BY event_name 
-		ORDER BY count DESC 
-		LIMIT ?
-	`, whereClause)
+		GROUP BY channel 
+		ORDER BY total_events DESC
+	`, source, whereClause)
 
-	rows, err := r.db.Query(query, queryArgs...)
+	rows, err := r.db.QueryContext(ctx, distinctCounts(query, exact), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -2064,154 +2273,197 @@ func (r *eventRepository) GetTopEvents(startDate, endDate time.Time, limit int,
 		}
 	}()
 
-	events := []map[string]interface{}{}
+	channels := []domain.ChannelResult{}
 	for rows.Next() {
-		var name string
-		var count int
-		if err := rows.Scan(&name, &count); err != nil {
+		var channel domain.ChannelResult
+		if err := rows.Scan(&channel.Channel, &channel.TotalEvents, &channel.UniqueUsers, &channel.TotalVisits, &channel.PageViews); err != nil {
+			log.Printf("Error scanning channel row: %v", err)
 			continue
 		}
-		events = append(events, map[string]interface{}{
-			"name":  name,
-			"count": count,
-		})
+
+		// Calculate conversion rate (page views per visit)
+		if channel.TotalVisits > 0 {
+			channel.ConversionRate = float64(channel.PageViews) / float64(channel.TotalVisits)
+		}
+
+		channels = append(channels, channel)
 	}
 
-	return events, nil
+	return channels, nil
+}
+
+// GetChannelLandingPages returns, for each channel, the top entry pages of sessions
+// acquired through it. A session's channel is the channel of its first page view.
+func (r *eventRepository) GetChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error) {
+	channels := []map[string]interface{}{}
+	err := r.StreamChannelLandingPages(ctx, startDate, endDate, limit, filters, func(channel map[string]interface{}) error {
+		channels = append(channels, channel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return channels, nil
 }
 
-// GetBrowsersDevicesOS returns browsers, devices, and operating systems
-func (r *eventRepository) GetBrowsersDevicesOS(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+// StreamChannelLandingPages computes the same buckets as GetChannelLandingPages but
+// passes each channel to emit as soon as its rows are read. An error from emit stops
+// the scan and is returned.
+func (r *eventRepository) StreamChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string, emit func(map[string]interface{}) error) error {
+	source := r.getStatsSource(filters)
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
 	queryArgs := append(args, limit)
 
-	result := make(map[string]interface{})
-
-	// Browsers
-	browsersQuery := fmt.Sprintf(`
-		SELECT browser, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND browser IS NOT NULL AND browser != ''
-		GROUP BY browser 
-		ORDER BY count DESC
-		LIMIT ?
-	`, whereClause)
+	query := fmt.Sprintf(`
+		WITH entries AS (
+			SELECT
+				COALESCE(channel, 'Unknown') AS channel_name,
+				url,
+				ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp ASC) AS rn
+			FROM %s
+			WHERE %s
+				AND event_name = 'page_view'
+				AND url IS NOT NULL
+				AND url != ''
+		),
+		landing_counts AS (
+			SELECT channel_name, url, COUNT(*) AS sessions
+			FROM entries
+			WHERE rn = 1
+			GROUP BY channel_name, url
+		),
+		ranked AS (
+			SELECT
+				channel_name,
+				url,
+				sessions,
+				CAST(SUM(sessions) OVER (PARTITION BY channel_name) AS BIGINT) AS channel_sessions,
+				ROW_NUMBER() OVER (PARTITION BY channel_name ORDER BY sessions DESC, url) AS rank
+			FROM landing_counts
+		)
+		SELECT channel_name, url, sessions, channel_sessions
+		FROM ranked
+		WHERE rank <= ?
+		ORDER BY channel_sessions DESC, channel_name, rank
+	`, source, whereClause)
 
-	browsersRows, err := r.db.Query(browsersQuery, queryArgs...)
+	rows, err := r.db.QueryContext(ctx, query, queryArgs...)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("query failed: %w", err)
 	}
 	defer func() {
-		if err := browsersRows.Close(); err != nil {
+		if err := rows.Close(); err != nil {
 			log.Printf("Warning: failed to close rows: %v", err)
 		}
 	}()
 
-	browsers := []map[string]interface{}{}
-	for browsersRows.Next() {
-		var browser string
-		var count int
-		if err := browsersRows.Scan(&browser, &count); err != nil {
+	// Rows arrive grouped by channel, so a bucket is complete when the channel changes
+	var current map[string]interface{}
+	for rows.Next() {
+		var channelName, url string
+		var sessions, channelSessions int64
+		if err := rows.Scan(&channelName, &url, &sessions, &channelSessions); err != nil {
+			log.Printf("Error scanning channel landing page row: %v", err)
 			continue
 		}
-		browsers = append(browsers, map[string]interface{}{
-			"name":  browser,
-			"count": count,
-		})
-	}
-	result["browsers"] = browsers
 
-	// Devices
-	devicesQuery := fmt.Sprintf(`
-		SELECT device, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND device IS NOT NULL AND device != ''
-		GROUP BY device 
-		ORDER BY count DESC
-		LIMIT ?
-	`, whereClause)
-
-	devicesRows, err := r.db.Query(devicesQuery, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if err := devicesRows.Close(); err != nil {
-			log.Printf("Warning: failed to close rows: %v", err)
+		if current == nil || current["channel"] != channelName {
+			if current != nil {
+				if err := emit(current); err != nil {
+					return err
+				}
+			}
+			current = map[string]interface{}{
+				"channel":       channelName,
+				"sessions":      channelSessions,
+				"landing_pages": []map[string]interface{}{},
+			}
 		}
-	}()
+		current["landing_pages"] = append(current["landing_pages"].([]map[string]interface{}),
+			map[string]interface{}{"url": url, "count": sessions})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-	devices := []map[string]interface{}{}
-	for devicesRows.Next() {
-		var device string
-		var count int
-		if err := devicesRows.Scan(&device, &count); err != nil {
-			continue
-		}
-		devices = append(devices, map[string]interface{}{
-			"name":  device,
-			"count": count,
-		})
+	if current != nil {
+		return emit(current)
 	}
-	result["devices"] = devices
+	return nil
+}
 
-	// Operating Systems
-	osQuery := fmt.Sprintf(`
-		SELECT os, COUNT(*) as count 
-		FROM events 
-		WHERE %s AND os IS NOT NULL AND os != ''
-		GROUP BY os 
-		ORDER BY count DESC
-		LIMIT ?
-	`, whereClause)
+// GetStickiness returns distinct active users over the trailing day, 7 days and 30 days
+// ending at endDate, along with the DAU/MAU ratio
+func (r *eventRepository) GetStickiness(ctx context.Context, endDate time.Time, filters map[string]string) (dau, wau, mau int, dauMau float64, err error) {
+	source := r.getStatsSource(filters)
+	dayStart := endDate
+	weekStart := endDate.AddDate(0, 0, -6)
+	monthStart := endDate.AddDate(0, 0, -29)
 
-	osRows, err := r.db.Query(osQuery, queryArgs...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if err := osRows.Close(); err != nil {
-			log.Printf("Warning: failed to close rows: %v", err)
-		}
-	}()
+	whereClause, args := buildWhereClause(monthStart, endDate, filters)
 
-	operatingSystems := []map[string]interface{}{}
-	for osRows.Next() {
-		var os string
-		var count int
-		if err := osRows.Scan(&os, &count); err != nil {
-			continue
-		}
-		operatingSystems = append(operatingSystems, map[string]interface{}{
-			"name":  os,
-			"count": count,
-		})
+	query := fmt.Sprintf(`
+		SELECT 
+			APPROX_COUNT_DISTINCT(CASE WHEN date_day >= CAST(? AS DATE) THEN user_id END) as dau,
+			APPROX_COUNT_DISTINCT(CASE WHEN date_day >= CAST(? AS DATE) THEN user_id END) as wau,
+			APPROX_COUNT_DISTINCT(user_id) as mau
+		FROM %s 
+		WHERE %s
+	`, source, whereClause)
+
+	queryArgs := append([]interface{}{dayStart, weekStart}, args...)
+	if err = r.db.QueryRowContext(ctx, distinctCounts(query, domain.ExactCounts(filters)), queryArgs...).Scan(&dau, &wau, &mau); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("failed to get stickiness: %w", err)
 	}
-	result["os"] = operatingSystems
 
-	return result, nil
+	if mau > 0 {
+		dauMau = float64(dau) / float64(mau)
+	}
+	return dau, wau, mau, dauMau, nil
 }
 
-// GetChannels returns traffic breakdown by channel with optional filters
-func (r *eventRepository) GetChannels(startDate, endDate time.Time, filters map[string]string) ([]map[string]interface{}, error) {
+// GetNewVsReturning splits the users active in the range into new users, whose
+// first-ever event falls within the range, and returning users, first seen before
+// it, with visit metrics for each group. First-ever events are looked up across
+// all stored events of the project, not just the range. Events without a user id
+// are left out.
+func (r *eventRepository) GetNewVsReturning(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error) {
+	source := r.getStatsSource(filters)
 	whereClause, args := buildWhereClause(startDate, endDate, filters)
 
+	firstSeenWhere := "user_id IS NOT NULL AND user_id != ''"
+	firstSeenArgs := []interface{}{}
+	if projectID := filters["project"]; projectID != "" {
+		firstSeenWhere += " AND project_id = ?"
+		firstSeenArgs = append(firstSeenArgs, projectID)
+	}
+
 	query := fmt.Sprintf(`
+		WITH first_seen AS (
+			SELECT user_id, CAST(MIN(date_day) AS DATE) AS first_day
+			FROM %s
+			WHERE %s
+			GROUP BY user_id
+		),
+		filtered AS (
+			SELECT * FROM %s WHERE %s
+		)
 		SELECT 
-			COALESCE(channel, 'Unknown') as channel_name,
-			COUNT(*) as total_events,
-			APPROX_COUNT_DISTINCT( user_id) as unique_users,
-			APPROX_COUNT_DISTINCT( session_id) as total_visits,
-			COUNT(CASE WHEN event_name = 'page_view' THEN 1 END) as page_views
-		FROM events 
-		WHERE %s
-		GROUP BY channel 
-		ORDER BY total_events DESC
-	`, whereClause)
-
-	rows, err := r.db.Query(query, args...)
+			CASE WHEN f.first_day >= CAST(? AS DATE) THEN 'new' ELSE 'returning' END AS visitor_type,
+			APPROX_COUNT_DISTINCT(e.user_id) as users,
+			APPROX_COUNT_DISTINCT(e.session_id) as visits,
+			COUNT(*) as events,
+			COUNT(CASE WHEN e.event_name = 'page_view' THEN 1 END) as page_views,
+			APPROX_COUNT_DISTINCT(CASE WHEN e.event_name = 'page_view' THEN e.session_id END) as sessions_with_views
+		FROM filtered e
+		JOIN first_seen f ON f.user_id = e.user_id
+		GROUP BY visitor_type
+	`, source, firstSeenWhere, source, whereClause)
+
+	queryArgs := append(append(firstSeenArgs, args...), startDate)
+	rows, err := r.db.QueryContext(ctx, distinctCounts(query, domain.ExactCounts(filters)), queryArgs...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get new vs returning visitors: %w", err)
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
@@ -2219,30 +2471,43 @@ func (r *eventRepository) GetChannels(startDate, endDate time.Time, filters map[
 		}
 	}()
 
-	channels := []map[string]interface{}{}
+	groups := map[string]map[string]interface{}{}
+	totalUsers := 0
+	for _, visitorType := range []string{"new", "returning"} {
+		groups[visitorType] = map[string]interface{}{
+			"users":           0,
+			"visits":          0,
+			"events":          0,
+			"page_views":      0,
+			"views_per_visit": 0.0,
+		}
+	}
 	for rows.Next() {
-		var channelName string
-		var totalEvents, uniqueUsers, totalVisits, pageViews int64
-		if err := rows.Scan(&channelName, &totalEvents, &uniqueUsers, &totalVisits, &pageViews); err != nil {
-			log.Printf("Error scanning channel row: %v", err)
-			continue
+		var visitorType string
+		var users, visits, events, pageViews, sessionsWithViews int
+		if err := rows.Scan(&visitorType, &users, &visits, &events, &pageViews, &sessionsWithViews); err != nil {
+			return nil, fmt.Errorf("failed to scan new vs returning visitors: %w", err)
+		}
+		groups[visitorType] = map[string]interface{}{
+			"users":           users,
+			"visits":          visits,
+			"events":          events,
+			"page_views":      pageViews,
+			"views_per_visit": viewsPerVisit(pageViews, sessionsWithViews),
 		}
+		totalUsers += users
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get new vs returning visitors: %w", err)
+	}
 
-		// Calculate conversion rate (page views per visit)
-		conversionRate := 0.0
-		if totalVisits > 0 {
-			conversionRate = float64(pageViews) / float64(totalVisits)
+	result := map[string]interface{}{"total_users": totalUsers}
+	for visitorType, group := range groups {
+		group["percentage"] = 0.0
+		if totalUsers > 0 {
+			group["percentage"] = float64(group["users"].(int)) / float64(totalUsers) * 100
 		}
-
-		channels = append(channels, map[string]interface{}{
-			"channel":         channelName,
-			"total_events":    totalEvents,
-			"unique_users":    uniqueUsers,
-			"total_visits":    totalVisits,
-			"page_views":      pageViews,
-			"conversion_rate": conversionRate,
-		})
+		result[visitorType] = group
 	}
-
-	return channels, nil
+	return result, nil
 }
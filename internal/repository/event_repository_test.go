@@ -0,0 +1,1750 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/duckdb/duckdb-go/v2"
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/migrations"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+	"github.com/mohamedelhefni/siraaj/internal/urlpattern"
+)
+
+// newTestRepository creates a table-backed repository on an in-memory DuckDB database,
+// skipping when the driver is unavailable
+func newTestRepository(t *testing.T) EventRepository {
+	t.Helper()
+
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Skipf("DuckDB driver not available: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Skipf("DuckDB not available: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Warning: failed to close database: %v", err)
+		}
+	})
+
+	if err := migrations.Migrate(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	repo := NewEventRepository(db, nil)
+	t.Cleanup(func() {
+		if err := repo.Close(); err != nil {
+			t.Logf("Warning: failed to close repository: %v", err)
+		}
+	})
+	return repo
+}
+
+func TestCloseIsIdempotent(t *testing.T) {
+	repo := &eventRepository{}
+
+	if err := repo.Close(); err != nil {
+		t.Fatalf("First Close failed: %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Second Close failed: %v", err)
+	}
+}
+
+func TestProjectFilterReadsOnlyItsPartition(t *testing.T) {
+	repo := newTestRepository(t).(*eventRepository)
+	dir := t.TempDir()
+	ps, err := storage.NewParquetStorage(repo.db, dir, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+	repo.parquetStorage = ps
+
+	now := time.Now()
+	if err := repo.CreateBatch([]domain.Event{
+		{Timestamp: now, EventName: "page_view", UserID: "u1", ProjectID: "web"},
+		{Timestamp: now, EventName: "page_view", UserID: "u2", ProjectID: "web"},
+		{Timestamp: now, EventName: "signup", UserID: "u3", ProjectID: "app"},
+	}); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+	if _, err := repo.FlushSync(); err != nil {
+		t.Fatalf("FlushSync failed: %v", err)
+	}
+
+	// Any read of the other project's partition now fails
+	if err := os.WriteFile(filepath.Join(dir, "app", "events_corrupt.parquet"), []byte("not parquet"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+	events, _, err := repo.GetTopEvents(t.Context(), start, end, 10, map[string]string{"project": "web"})
+	if err != nil {
+		t.Fatalf("Expected a web-only query to skip the app partition, got %v", err)
+	}
+	if len(events) != 1 || events[0]["name"] != "page_view" {
+		t.Errorf("Expected only the web page views, got %v", events)
+	}
+
+	if _, _, err := repo.GetTopEvents(t.Context(), start, end, 10, nil); err == nil {
+		t.Error("Expected an unfiltered query to read the app partition and fail")
+	}
+}
+
+func TestTableBackend(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	if source := repo.(*eventRepository).getParquetSource(nil); source != "events" {
+		t.Fatalf("Expected the events table as source, got %s", source)
+	}
+
+	if err := repo.Create(domain.Event{Timestamp: now, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := repo.CreateBatch([]domain.Event{
+		{Timestamp: now, EventName: "page_view", UserID: "u2", SessionID: "s2", URL: "/pricing"},
+		{Timestamp: now, EventName: "signup", UserID: "u2", SessionID: "s2", URL: "/pricing"},
+	}); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	// Inserts are visible without a flush
+	if err := repo.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if result, err := repo.FlushSync(); err != nil || result.EventsFlushed != 0 {
+		t.Errorf("Expected FlushSync to have nothing to write, got %+v, %v", result, err)
+	}
+	if asOf := repo.DataAsOf(); now.Sub(asOf) > 0 {
+		t.Errorf("Expected data to be fresh, got %v", asOf)
+	}
+
+	start, end := now.AddDate(0, 0, -1), now.AddDate(0, 0, 1)
+	events, err := repo.GetEvents(t.Context(), start, end, 10, 0, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetEvents failed: %v", err)
+	}
+	if events["total"] != int64(3) {
+		t.Errorf("Expected 3 stored events, got %v", events["total"])
+	}
+	ids := make(map[uint64]bool)
+	for _, event := range events["events"].([]domain.Event) {
+		if event.ID == 0 || ids[event.ID] {
+			t.Errorf("Expected unique non-zero ids, got %d twice or zero", event.ID)
+		}
+		ids[event.ID] = true
+	}
+
+	removed, err := repo.Reset()
+	if err != nil || removed != 0 {
+		t.Fatalf("Reset failed: %d, %v", removed, err)
+	}
+	events, err = repo.GetEvents(t.Context(), start, end, 10, 0, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetEvents failed: %v", err)
+	}
+	if events["total"] != int64(0) {
+		t.Errorf("Expected no events after reset, got %v", events["total"])
+	}
+}
+
+func TestGetStickiness(t *testing.T) {
+	repo := newTestRepository(t)
+	endDate := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	// 2 users active on the end date, 4 within the week, 8 within the month,
+	// and one user outside the 30-day window who must not be counted
+	activity := map[string]time.Time{
+		"u1": endDate.Add(-time.Hour),
+		"u2": endDate.Add(-2 * time.Hour),
+		"u3": endDate.AddDate(0, 0, -3),
+		"u4": endDate.AddDate(0, 0, -6),
+		"u5": endDate.AddDate(0, 0, -10),
+		"u6": endDate.AddDate(0, 0, -15),
+		"u7": endDate.AddDate(0, 0, -20),
+		"u8": endDate.AddDate(0, 0, -29),
+		"u9": endDate.AddDate(0, 0, -45),
+	}
+
+	events := []domain.Event{}
+	for userID, ts := range activity {
+		events = append(events,
+			domain.Event{Timestamp: ts, EventName: "page_view", UserID: userID, SessionID: userID + "-s"},
+			domain.Event{Timestamp: ts, EventName: "click", UserID: userID, SessionID: userID + "-s"},
+		)
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	// Exact counts, APPROX_COUNT_DISTINCT can be off by one on this few users
+	dau, wau, mau, dauMau, err := repo.GetStickiness(t.Context(), endDate, map[string]string{"exact": "1"})
+	if err != nil {
+		t.Fatalf("GetStickiness failed: %v", err)
+	}
+
+	if dau != 2 || wau != 4 || mau != 8 {
+		t.Errorf("Expected dau=2 wau=4 mau=8, got dau=%d wau=%d mau=%d", dau, wau, mau)
+	}
+	if dauMau != 0.25 {
+		t.Errorf("Expected DAU/MAU 0.25, got %v", dauMau)
+	}
+}
+
+func TestGetNewVsReturning(t *testing.T) {
+	repo := newTestRepository(t)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	event := func(userID, sessionID, name string, ts time.Time) domain.Event {
+		return domain.Event{Timestamp: ts, EventName: name, UserID: userID, SessionID: sessionID, URL: "/"}
+	}
+	events := []domain.Event{
+		// Returning: first seen in February, back in March for two visits
+		event("old", "old-feb", "page_view", start.AddDate(0, 0, -10)),
+		event("old", "old-1", "page_view", start.AddDate(0, 0, 2)),
+		event("old", "old-1", "page_view", start.AddDate(0, 0, 2).Add(time.Minute)),
+		event("old", "old-2", "page_view", start.AddDate(0, 0, 5)),
+		// New: first seen in March, one visit with three page views
+		event("fresh", "fresh-1", "page_view", start.AddDate(0, 0, 8)),
+		event("fresh", "fresh-1", "page_view", start.AddDate(0, 0, 8).Add(time.Minute)),
+		event("fresh", "fresh-1", "page_view", start.AddDate(0, 0, 8).Add(2*time.Minute)),
+		event("fresh", "fresh-1", "signup", start.AddDate(0, 0, 8).Add(3*time.Minute)),
+		// Only active before the range, not counted at all
+		event("gone", "gone-1", "page_view", start.AddDate(0, 0, -20)),
+		// No user id, left out
+		event("", "anon-1", "page_view", start.AddDate(0, 0, 3)),
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	result, err := repo.GetNewVsReturning(t.Context(), start, end, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetNewVsReturning failed: %v", err)
+	}
+
+	if result["total_users"] != 2 {
+		t.Errorf("Expected 2 users, got %v", result["total_users"])
+	}
+	newUsers := result["new"].(map[string]interface{})
+	if newUsers["users"] != 1 || newUsers["visits"] != 1 || newUsers["events"] != 4 ||
+		newUsers["page_views"] != 3 || newUsers["views_per_visit"] != 3.0 || newUsers["percentage"] != 50.0 {
+		t.Errorf("Unexpected new visitors: %v", newUsers)
+	}
+	returning := result["returning"].(map[string]interface{})
+	if returning["users"] != 1 || returning["visits"] != 2 || returning["page_views"] != 3 || returning["views_per_visit"] != 1.5 {
+		t.Errorf("Unexpected returning visitors: %v", returning)
+	}
+
+	// Starting the range in February makes the returning user new
+	result, err = repo.GetNewVsReturning(t.Context(), start.AddDate(0, 0, -15), end, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetNewVsReturning failed: %v", err)
+	}
+	if users := result["new"].(map[string]interface{})["users"]; users != 2 {
+		t.Errorf("Expected 2 new users, got %v", users)
+	}
+}
+
+func TestGetChannelLandingPages(t *testing.T) {
+	repo := newTestRepository(t)
+	day := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	pageView := func(session, url, channel string, offset time.Duration) domain.Event {
+		return domain.Event{
+			Timestamp: day.Add(offset),
+			EventName: "page_view",
+			UserID:    "user-" + session,
+			SessionID: session,
+			URL:       url,
+			Channel:   channel,
+		}
+	}
+
+	events := []domain.Event{
+		// Organic sessions land on /blog twice and /pricing once
+		pageView("s1", "/blog", "Organic", 0),
+		pageView("s1", "/pricing", "Organic", time.Minute),
+		pageView("s2", "/blog", "Organic", 0),
+		pageView("s3", "/pricing", "Organic", 0),
+		// A social session landing on /launch, later pages must not count as landings
+		pageView("s4", "/launch", "Social", 0),
+		pageView("s4", "/blog", "Social", time.Minute),
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	channels, err := repo.GetChannelLandingPages(t.Context(), day.Add(-time.Hour), day.Add(time.Hour), 10, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetChannelLandingPages failed: %v", err)
+	}
+
+	if len(channels) != 2 {
+		t.Fatalf("Expected 2 channels, got %d: %v", len(channels), channels)
+	}
+
+	organic := channels[0]
+	if organic["channel"] != "Organic" || organic["sessions"] != int64(3) {
+		t.Errorf("Expected Organic with 3 sessions first, got %v", organic)
+	}
+	organicPages := organic["landing_pages"].([]map[string]interface{})
+	if len(organicPages) != 2 || organicPages[0]["url"] != "/blog" || organicPages[0]["count"] != int64(2) {
+		t.Errorf("Expected /blog as top Organic landing page with 2 sessions, got %v", organicPages)
+	}
+
+	social := channels[1]
+	socialPages := social["landing_pages"].([]map[string]interface{})
+	if social["channel"] != "Social" || len(socialPages) != 1 || socialPages[0]["url"] != "/launch" {
+		t.Errorf("Expected Social to land only on /launch, got %v", social)
+	}
+}
+
+func TestGetStatsInclude(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	if err := repo.Create(domain.Event{Timestamp: now, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	stats, err := repo.GetStats(t.Context(), now.AddDate(0, 0, -1), now, 10, map[string]string{"include": "timeline,top_pages"})
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+
+	for _, key := range []string{"total_events", "timeline", "top_pages"} {
+		if _, ok := stats[key]; !ok {
+			t.Errorf("Expected %s in response", key)
+		}
+	}
+	for _, key := range []string{"top_events", "browsers", "top_sources", "prev_total_events"} {
+		if _, ok := stats[key]; ok {
+			t.Errorf("Expected %s to be omitted", key)
+		}
+	}
+
+	if _, err := repo.GetStats(t.Context(), now.AddDate(0, 0, -1), now, 10, map[string]string{"include": "unknown"}); err == nil {
+		t.Error("Expected error for unknown section")
+	}
+}
+
+func TestTimeBasis(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	backdated := today.AddDate(0, 0, -3).Add(12 * time.Hour)
+
+	// Sent today, but stamped three days ago by the client
+	if err := repo.Create(domain.Event{Timestamp: backdated, ReceivedAt: now, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	start := today.AddDate(0, 0, -6)
+	end := today.Add(24*time.Hour - time.Nanosecond)
+	tests := []struct {
+		basis    string
+		expected string
+	}{
+		{domain.TimeBasisEvent, backdated.Format("2006-01-02")},
+		{domain.TimeBasisReceived, today.Format("2006-01-02")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.basis, func(t *testing.T) {
+			filters := map[string]string{"time_basis": tt.basis, "metric": "events"}
+			result, err := repo.GetTimeline(t.Context(), start, end, filters)
+			if err != nil {
+				t.Fatalf("GetTimeline failed: %v", err)
+			}
+
+			timeline := result["timeline"].([]map[string]interface{})
+			if len(timeline) != 1 {
+				t.Fatalf("Expected 1 bucket, got %v", timeline)
+			}
+			if date := timeline[0]["date"].(string); !strings.HasPrefix(date, tt.expected) {
+				t.Errorf("Expected event in the %s bucket, got %s", tt.expected, date)
+			}
+
+			// Date filters follow the same basis
+			stats, err := repo.GetTopStats(t.Context(), today, end, filters)
+			if err != nil {
+				t.Fatalf("GetTopStats failed: %v", err)
+			}
+			wantToday := 0
+			if tt.basis == domain.TimeBasisReceived {
+				wantToday = 1
+			}
+			if got := stats.TotalEvents; got != wantToday {
+				t.Errorf("Expected %d events received today, got %d", wantToday, got)
+			}
+		})
+	}
+}
+
+func TestTimeZone(t *testing.T) {
+	repo := newTestRepository(t)
+
+	// 23:30 on March 1 in UTC is 08:30 on March 2 in Tokyo and 18:30 on March 1 in New York
+	late := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+	if err := repo.Create(domain.Event{Timestamp: late, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	start := time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 3, 23, 59, 59, 999999999, time.UTC)
+	tests := []struct {
+		tz       string
+		expected string
+	}{
+		{"", "2024-03-01"},
+		{"Asia/Tokyo", "2024-03-02"},
+		{"America/New_York", "2024-03-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tz, func(t *testing.T) {
+			filters := map[string]string{"tz": tt.tz, "metric": "events"}
+			result, err := repo.GetTimeline(t.Context(), start, end, filters)
+			if err != nil {
+				t.Fatalf("GetTimeline failed: %v", err)
+			}
+
+			timeline := result["timeline"].([]map[string]interface{})
+			if len(timeline) != 1 {
+				t.Fatalf("Expected 1 bucket, got %v", timeline)
+			}
+			if date := timeline[0]["date"].(string); !strings.HasPrefix(date, tt.expected) {
+				t.Errorf("Expected event in the %s bucket, got %s", tt.expected, date)
+			}
+
+			// Day filters follow the zone too
+			day, _ := time.Parse("2006-01-02", tt.expected)
+			stats, err := repo.GetTopStats(t.Context(), day, day.Add(24*time.Hour-time.Nanosecond), filters)
+			if err != nil {
+				t.Fatalf("GetTopStats failed: %v", err)
+			}
+			if got := stats.TotalEvents; got != 1 {
+				t.Errorf("Expected 1 event on %s, got %d", tt.expected, got)
+			}
+			meta := stats.Meta
+			if meta.Range == nil || meta.Range.Start != tt.expected || meta.Range.End != tt.expected {
+				t.Errorf("Expected a _meta range of %s, got %+v", tt.expected, meta.Range)
+			}
+		})
+	}
+}
+
+func TestSingleDayRange(t *testing.T) {
+	repo := newTestRepository(t)
+
+	events := []domain.Event{
+		{Timestamp: time.Date(2024, 2, 29, 14, 59, 59, 0, time.UTC), EventName: "tokyo_feb_29"},
+		{Timestamp: time.Date(2024, 2, 29, 15, 0, 0, 0, time.UTC), EventName: "tokyo_mar_1_start"},
+		{Timestamp: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), EventName: "utc_mar_1_start"},
+		{Timestamp: time.Date(2024, 3, 1, 14, 59, 59, 0, time.UTC), EventName: "tokyo_mar_1_end"},
+		{Timestamp: time.Date(2024, 3, 1, 23, 59, 59, 999000000, time.UTC), EventName: "utc_mar_1_end"},
+		{Timestamp: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), EventName: "utc_mar_2"},
+	}
+	for i := range events {
+		events[i].UserID, events[i].SessionID, events[i].URL = "u1", "s1", "/"
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	// start=end=2024-03-01, as the handler passes it
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24*time.Hour - time.Nanosecond)
+	tests := []struct {
+		tz       string
+		expected []string
+	}{
+		{"", []string{"tokyo_mar_1_end", "utc_mar_1_end", "utc_mar_1_start"}},
+		{"Asia/Tokyo", []string{"tokyo_mar_1_end", "tokyo_mar_1_start", "utc_mar_1_start"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tz, func(t *testing.T) {
+			items, _, err := repo.GetTopEvents(t.Context(), start, end, 10, map[string]string{"tz": tt.tz, "sort": "name"})
+			if err != nil {
+				t.Fatalf("GetTopEvents failed: %v", err)
+			}
+			var names []string
+			for _, item := range items {
+				names = append(names, item["name"].(string))
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestGetUserSessions(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Minute)
+
+	events := []domain.Event{
+		// Older session: landing, signup, pricing
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/", Device: "Mobile", Browser: "Safari"},
+		{Timestamp: base.Add(30 * time.Second), EventName: "signup", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: base.Add(90 * time.Second), EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/pricing"},
+		// Newer session
+		{Timestamp: base.Add(time.Hour), EventName: "page_view", UserID: "u1", SessionID: "s2", URL: "/docs", Device: "Desktop"},
+		// Another user
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s3", URL: "/"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	sessions, err := repo.GetUserSessions(t.Context(), "u1", start, end, 10, 0, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetUserSessions failed: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].SessionID != "s2" {
+		t.Errorf("Expected newest session first, got %s", sessions[0].SessionID)
+	}
+
+	s1 := sessions[1]
+	if s1.EntryPage != "/" || s1.ExitPage != "/pricing" {
+		t.Errorf("Expected entry / and exit /pricing, got %s and %s", s1.EntryPage, s1.ExitPage)
+	}
+	if s1.Duration != 90 || s1.EventCount != 3 || s1.Device != "Mobile" {
+		t.Errorf("Unexpected session summary: %+v", s1)
+	}
+	if len(s1.Events) != 3 || s1.Events[1].EventName != "signup" {
+		t.Errorf("Expected events in order, got %+v", s1.Events)
+	}
+	if len(s1.Pages) != 2 || s1.Pages[0] != "/" || s1.Pages[1] != "/pricing" {
+		t.Errorf("Expected page path [/ /pricing], got %v", s1.Pages)
+	}
+
+	page, err := repo.GetUserSessions(t.Context(), "u1", start, end, 1, 1, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetUserSessions failed: %v", err)
+	}
+	if len(page) != 1 || page[0].SessionID != "s1" {
+		t.Errorf("Expected second page to hold s1, got %+v", page)
+	}
+}
+
+func TestDerivedSessionDuration(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	// s1 spans 120s but claims 9999s; s2 has a single event, so its client value is kept
+	events := []domain.Event{
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", SessionDuration: 9999},
+		{Timestamp: base.Add(60 * time.Second), EventName: "click", UserID: "u1", SessionID: "s1", SessionDuration: 9999},
+		{Timestamp: base.Add(120 * time.Second), EventName: "page_view", UserID: "u1", SessionID: "s1", SessionDuration: 9999},
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s2", SessionDuration: 30},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	const derived = (120.0 + 30.0) / 2
+	const stored = (9999.0*3 + 30.0) / 4 // Per-event average of the client column
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+
+	stats, err := repo.GetTopStats(t.Context(), start, end, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetTopStats failed: %v", err)
+	}
+	if got := stats.AvgSessionDuration; got != derived {
+		t.Errorf("Expected derived avg_session_duration %v (stored column gives %v), got %v", derived, stored, got)
+	}
+	// 3 page views over the 2 sessions that have one, as the views_per_visit timeline
+	if got := stats.ViewsPerVisit; got != 1.5 {
+		t.Errorf("Expected views_per_visit 1.5, got %v", got)
+	}
+
+	full, err := repo.GetStats(t.Context(), start, end, 10, map[string]string{"include": "timeline", "metric": "visit_duration"})
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if got := full["avg_session_duration"].(float64); got != derived {
+		t.Errorf("Expected GetStats avg_session_duration %v, got %v", derived, got)
+	}
+
+	timeline, err := repo.GetTimeline(t.Context(), start, end, map[string]string{"metric": "visit_duration"})
+	if err != nil {
+		t.Fatalf("GetTimeline failed: %v", err)
+	}
+	points := timeline["timeline"].([]map[string]interface{})
+	if len(points) != 1 || points[0]["count"].(float64) != derived {
+		t.Errorf("Expected one visit_duration point of %v, got %v", derived, points)
+	}
+}
+
+func TestTopStatsSampling(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	// Two visitors kept at a sample rate of 0.25, standing for eight
+	events := []domain.Event{
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/", SampleRate: 0.25},
+		{Timestamp: base, EventName: "signup", UserID: "u1", SessionID: "s1", URL: "/", SampleRate: 0.25},
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s2", URL: "/", SampleRate: 0.25},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	stats, err := repo.GetTopStats(t.Context(), base.AddDate(0, 0, -1), base.AddDate(0, 0, 1), map[string]string{"exact": "1"})
+	if err != nil {
+		t.Fatalf("GetTopStats failed: %v", err)
+	}
+	if stats.TotalEvents != 12 || stats.PageViews != 8 || stats.UniqueUsers != 8 || stats.TotalVisits != 8 {
+		t.Errorf("Expected counts scaled by 4, got %d events, %d page views, %d users and %d visits",
+			stats.TotalEvents, stats.PageViews, stats.UniqueUsers, stats.TotalVisits)
+	}
+	if stats.ViewsPerVisit != 1 {
+		t.Errorf("Expected views_per_visit to stay 1, got %v", stats.ViewsPerVisit)
+	}
+	if stats.Meta.SampleRate != 0.25 || !stats.Meta.Approximate {
+		t.Errorf("Expected an approximate _meta with sample rate 0.25, got %+v", stats.Meta)
+	}
+}
+
+func TestBounceMode(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	events := []domain.Event{
+		// s1: one page view, nothing else
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/"},
+		// s2: one page view followed by custom events
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base.Add(time.Minute), EventName: "video_play", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base.Add(2 * time.Minute), EventName: "signup", UserID: "u2", SessionID: "s2", URL: "/"},
+		// s3: two page views
+		{Timestamp: base, EventName: "page_view", UserID: "u3", SessionID: "s3", URL: "/"},
+		{Timestamp: base.Add(time.Minute), EventName: "page_view", UserID: "u3", SessionID: "s3", URL: "/pricing"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	tests := []struct {
+		mode    string
+		bounced int
+	}{
+		{"", 2}, // single_pageview: s1 and s2
+		{domain.BounceSinglePageview, 2},
+		{domain.BounceSingleEvent, 1}, // Only s1
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	for _, tt := range tests {
+		t.Run("mode="+tt.mode, func(t *testing.T) {
+			filters := map[string]string{"bounce_mode": tt.mode, "include": "timeline", "metric": "bounce_rate"}
+			for name, bounced := range map[string]func() (int, error){
+				"GetStats": func() (int, error) {
+					stats, err := repo.GetStats(t.Context(), start, end, 10, filters)
+					if err != nil {
+						return 0, err
+					}
+					n, _ := stats["single_page_sessions"].(int)
+					return n, nil
+				},
+				"GetTopStats": func() (int, error) {
+					stats, err := repo.GetTopStats(t.Context(), start, end, filters)
+					if err != nil || stats.SinglePageSessions == nil {
+						return 0, err
+					}
+					return *stats.SinglePageSessions, nil
+				},
+			} {
+				got, err := bounced()
+				if err != nil {
+					t.Fatalf("%s failed: %v", name, err)
+				}
+				if got != tt.bounced {
+					t.Errorf("%s: expected %d bounced sessions, got %v", name, tt.bounced, got)
+				}
+			}
+
+			timeline, err := repo.GetTimeline(t.Context(), start, end, filters)
+			if err != nil {
+				t.Fatalf("GetTimeline failed: %v", err)
+			}
+			points := timeline["timeline"].([]map[string]interface{})
+			want := float64(tt.bounced) * 100 / 3
+			if len(points) != 1 || math.Abs(points[0]["count"].(float64)-want) > 0.01 {
+				t.Errorf("Expected one bounce_rate point of %v, got %v", want, points)
+			}
+		})
+	}
+}
+
+func TestGoals(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	// 4 visitors: two sign up, one of them also reaches /thanks
+	events := []domain.Event{
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: base, EventName: "signup", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/thanks"},
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base, EventName: "signup", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base, EventName: "signup", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base, EventName: "page_view", UserID: "u3", SessionID: "s3", URL: "/"},
+		{Timestamp: base, EventName: "page_view", UserID: "u4", SessionID: "s4", URL: "/pricing"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	signup, err := repo.CreateGoal(t.Context(), domain.Goal{Name: "Signup", EventName: "signup"})
+	if err != nil {
+		t.Fatalf("CreateGoal failed: %v", err)
+	}
+	thanks, err := repo.CreateGoal(t.Context(), domain.Goal{Name: "Thank you page", EventName: "page_view", URL: "/thanks"})
+	if err != nil {
+		t.Fatalf("CreateGoal failed: %v", err)
+	}
+	if signup.ID == 0 || thanks.ID == signup.ID {
+		t.Fatalf("Expected distinct goal ids, got %d and %d", signup.ID, thanks.ID)
+	}
+	if _, err := repo.CreateGoal(t.Context(), domain.Goal{Name: "Signup", URL: "/signup"}); err != domain.ErrGoalExists {
+		t.Errorf("Expected ErrGoalExists for a duplicate name, got %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	conversions, err := repo.GetGoalConversions(t.Context(), start, end, map[string]string{"metric": "page_views"})
+	if err != nil {
+		t.Fatalf("GetGoalConversions failed: %v", err)
+	}
+	if len(conversions) != 2 {
+		t.Fatalf("Expected 2 goals, got %d", len(conversions))
+	}
+	expected := []struct {
+		conversions, events int64
+		rate                float64
+	}{
+		{2, 3, 50},
+		{1, 1, 25},
+	}
+	for i, want := range expected {
+		got := conversions[i]
+		if got.Conversions != want.conversions || got.Events != want.events {
+			t.Errorf("%s: expected %d conversions from %d events, got %d from %d",
+				got.Goal.Name, want.conversions, want.events, got.Conversions, got.Events)
+		}
+		if got.ConversionRate == nil || math.Abs(*got.ConversionRate-want.rate) > 0.001 {
+			t.Errorf("%s: expected rate %.1f, got %v", got.Goal.Name, want.rate, got.ConversionRate)
+		}
+	}
+
+	thanks.Name = "Thanks"
+	updated, err := repo.UpdateGoal(t.Context(), thanks)
+	if err != nil {
+		t.Fatalf("UpdateGoal failed: %v", err)
+	}
+	if !updated.CreatedAt.Equal(thanks.CreatedAt) {
+		t.Errorf("Expected UpdateGoal to keep created_at %v, got %v", thanks.CreatedAt, updated.CreatedAt)
+	}
+	if got, err := repo.GetGoal(t.Context(), thanks.ID); err != nil || got.Name != "Thanks" {
+		t.Errorf("Expected renamed goal, got %+v (%v)", got, err)
+	}
+
+	if err := repo.DeleteGoal(t.Context(), signup.ID); err != nil {
+		t.Fatalf("DeleteGoal failed: %v", err)
+	}
+	if err := repo.DeleteGoal(t.Context(), signup.ID); err != domain.ErrGoalNotFound {
+		t.Errorf("Expected ErrGoalNotFound deleting twice, got %v", err)
+	}
+	if _, err := repo.GetGoal(t.Context(), signup.ID); err != domain.ErrGoalNotFound {
+		t.Errorf("Expected ErrGoalNotFound, got %v", err)
+	}
+	goals, err := repo.GetGoals(t.Context())
+	if err != nil || len(goals) != 1 {
+		t.Errorf("Expected 1 goal left, got %d (%v)", len(goals), err)
+	}
+}
+
+func TestFunnelAnyOfStep(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+
+	// u1 signs up by email, u2 with OAuth, u3 only visits, u4 signs up without visiting
+	events := []domain.Event{
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/signup/email"},
+		{Timestamp: base.Add(time.Minute), EventName: "signup", UserID: "u1", SessionID: "s1", URL: "/signup/email"},
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s2", URL: "/signup/oauth"},
+		{Timestamp: base.Add(time.Minute), EventName: "oauth_signup", UserID: "u2", SessionID: "s2", URL: "/signup/oauth"},
+		{Timestamp: base, EventName: "page_view", UserID: "u3", SessionID: "s3", URL: "/signup/email"},
+		{Timestamp: base, EventName: "signup", UserID: "u4", SessionID: "s4", URL: "/"},
+		{Timestamp: base, EventName: "page_view", UserID: "u5", SessionID: "s5", URL: "/pricing"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	day := base.Format("2006-01-02")
+	result, err := repo.GetFunnelAnalysis(t.Context(), domain.FunnelRequest{
+		Steps: []domain.FunnelStep{
+			{Name: "Signup page", EventName: "page_view", URLPattern: "/signup/*"},
+			{Name: "Signed up", EventNames: []string{"signup", "oauth_signup"}},
+		},
+		StartDate: day,
+		EndDate:   day,
+	})
+	if err != nil {
+		t.Fatalf("GetFunnelAnalysis failed: %v", err)
+	}
+
+	if got := result.Steps[0].UserCount; got != 3 {
+		t.Errorf("Expected 3 users on the signup pages, got %d", got)
+	}
+	if got := result.Steps[1].UserCount; got != 2 {
+		t.Errorf("Expected 2 users to sign up either way, got %d", got)
+	}
+	if result.CompletedUsers != 2 {
+		t.Errorf("Expected 2 completed users, got %d", result.CompletedUsers)
+	}
+}
+
+func TestFunnelTimeZone(t *testing.T) {
+	repo := newTestRepository(t)
+
+	// Still March 1 in UTC, already March 2 in Tokyo
+	late := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+	events := []domain.Event{
+		{Timestamp: late, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: late.Add(time.Minute), EventName: "signup", UserID: "u1", SessionID: "s1", URL: "/"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		day      string
+		filters  map[string]string
+		expected int64
+	}{
+		{"UTC day", "2024-03-01", nil, 1},
+		{"Next UTC day", "2024-03-02", nil, 0},
+		{"Tokyo day", "2024-03-02", map[string]string{"tz": "Asia/Tokyo"}, 1},
+		{"Previous Tokyo day", "2024-03-01", map[string]string{"tz": "Asia/Tokyo"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := repo.GetFunnelAnalysis(t.Context(), domain.FunnelRequest{
+				Steps:     []domain.FunnelStep{{Name: "Visit", EventName: "page_view"}, {Name: "Signed up", EventName: "signup"}},
+				StartDate: tt.day,
+				EndDate:   tt.day,
+				Filters:   tt.filters,
+			})
+			if err != nil {
+				t.Fatalf("GetFunnelAnalysis failed: %v", err)
+			}
+			if result.Steps[0].UserCount != tt.expected || result.CompletedUsers != tt.expected {
+				t.Errorf("Expected %d users through the funnel, got %d entering and %d completing", tt.expected, result.Steps[0].UserCount, result.CompletedUsers)
+			}
+		})
+	}
+}
+
+func TestFunnelConversionWindow(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().AddDate(0, 0, -3).Truncate(24 * time.Hour)
+
+	// u1 converts within an hour, u2 after 5 hours, u3 after two days
+	events := []domain.Event{
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: base.Add(30 * time.Minute), EventName: "signup", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: base.Add(45 * time.Minute), EventName: "purchase", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base.Add(5 * time.Hour), EventName: "signup", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base.Add(9 * time.Hour), EventName: "purchase", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base, EventName: "page_view", UserID: "u3", SessionID: "s3", URL: "/"},
+		{Timestamp: base.Add(48 * time.Hour), EventName: "signup", UserID: "u3", SessionID: "s4", URL: "/"},
+		{Timestamp: base.Add(49 * time.Hour), EventName: "purchase", UserID: "u3", SessionID: "s4", URL: "/"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		windowHours      int
+		maxDuration      int
+		expectedSignups  int64
+		expectedPurchase int64
+	}{
+		{"No limits", 0, 0, 3, 3},
+		{"Six hour window", 6, 0, 2, 2},
+		{"One hour window", 1, 0, 1, 1},
+		{"Six hour window, eight hour funnel", 6, 8, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := repo.GetFunnelAnalysis(t.Context(), domain.FunnelRequest{
+				Steps: []domain.FunnelStep{
+					{Name: "Visit", EventName: "page_view"},
+					{Name: "Signup", EventName: "signup"},
+					{Name: "Purchase", EventName: "purchase"},
+				},
+				StartDate:             base.Format("2006-01-02"),
+				EndDate:               base.AddDate(0, 0, 3).Format("2006-01-02"),
+				ConversionWindowHours: tt.windowHours,
+				MaxFunnelDuration:     tt.maxDuration,
+			})
+			if err != nil {
+				t.Fatalf("GetFunnelAnalysis failed: %v", err)
+			}
+
+			if got := result.Steps[1].UserCount; got != tt.expectedSignups {
+				t.Errorf("Expected %d signups, got %d", tt.expectedSignups, got)
+			}
+			if got := result.Steps[2].UserCount; got != tt.expectedPurchase {
+				t.Errorf("Expected %d purchases, got %d", tt.expectedPurchase, got)
+			}
+			if result.ConversionWindowHours != tt.windowHours || result.MaxFunnelDuration != tt.maxDuration {
+				t.Errorf("Expected window %d/%d in the result, got %d/%d",
+					tt.windowHours, tt.maxDuration, result.ConversionWindowHours, result.MaxFunnelDuration)
+			}
+		})
+	}
+}
+
+func TestFunnelScope(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(24 * time.Hour).Add(-12 * time.Hour)
+
+	// u1 checks out in one session. u2 adds to cart, leaves, and pays in a later
+	// session. u3 has two sessions that both reach the cart and neither pays.
+	events := []domain.Event{
+		{Timestamp: base, EventName: "add_to_cart", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: base.Add(time.Minute), EventName: "purchase", UserID: "u1", SessionID: "s1", URL: "/"},
+		{Timestamp: base, EventName: "add_to_cart", UserID: "u2", SessionID: "s2", URL: "/"},
+		{Timestamp: base.Add(2 * time.Hour), EventName: "purchase", UserID: "u2", SessionID: "s3", URL: "/"},
+		{Timestamp: base, EventName: "add_to_cart", UserID: "u3", SessionID: "s4", URL: "/"},
+		{Timestamp: base.Add(3 * time.Hour), EventName: "add_to_cart", UserID: "u3", SessionID: "s5", URL: "/"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	tests := []struct {
+		scope          string
+		purchasers     int64
+		completionRate float64
+	}{
+		{domain.FunnelScopeUser, 2, 2.0 / 3 * 100},    // u1 and u2 of 3 users
+		{domain.FunnelScopeSession, 1, 1.0 / 4 * 100}, // s1 of 4 sessions
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			result, err := repo.GetFunnelAnalysis(t.Context(), domain.FunnelRequest{
+				Steps: []domain.FunnelStep{
+					{Name: "Cart", EventName: "add_to_cart"},
+					{Name: "Purchase", EventName: "purchase"},
+				},
+				StartDate: base.Format("2006-01-02"),
+				EndDate:   base.AddDate(0, 0, 1).Format("2006-01-02"),
+				Scope:     tt.scope,
+			})
+			if err != nil {
+				t.Fatalf("GetFunnelAnalysis failed: %v", err)
+			}
+
+			if result.Scope != tt.scope {
+				t.Errorf("Expected scope %q in the result, got %q", tt.scope, result.Scope)
+			}
+			if got := result.Steps[1].UserCount; got != tt.purchasers {
+				t.Errorf("Expected %d purchasers, got %d", tt.purchasers, got)
+			}
+			if math.Abs(result.CompletionRate-tt.completionRate) > 0.001 {
+				t.Errorf("Expected completion rate %.2f, got %.2f", tt.completionRate, result.CompletionRate)
+			}
+			if math.Abs(result.Steps[1].ConversionRate-tt.completionRate) > 0.001 {
+				t.Errorf("Expected conversion rate %.2f, got %.2f", tt.completionRate, result.Steps[1].ConversionRate)
+			}
+		})
+	}
+}
+
+func TestFunnelStrictOrder(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(24 * time.Hour).Add(-12 * time.Hour)
+
+	// u1 signs up after visiting the pricing page, u2 before it, u3 only visits
+	events := []domain.Event{
+		{Timestamp: base, EventName: "pricing_view", UserID: "u1", SessionID: "s1", URL: "/pricing"},
+		{Timestamp: base.Add(time.Minute), EventName: "signup", UserID: "u1", SessionID: "s1", URL: "/signup"},
+		{Timestamp: base, EventName: "signup", UserID: "u2", SessionID: "s2", URL: "/signup"},
+		{Timestamp: base.Add(time.Minute), EventName: "pricing_view", UserID: "u2", SessionID: "s2", URL: "/pricing"},
+		{Timestamp: base, EventName: "pricing_view", UserID: "u3", SessionID: "s3", URL: "/pricing"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	anyOrder := false
+	tests := []struct {
+		name        string
+		strictOrder *bool
+		strict      bool
+		signups     int64
+	}{
+		{"Strict order by default", nil, true, 1}, // u1
+		{"Any order", &anyOrder, false, 2},        // u1 and u2
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := repo.GetFunnelAnalysis(t.Context(), domain.FunnelRequest{
+				Steps: []domain.FunnelStep{
+					{Name: "Pricing", EventName: "pricing_view"},
+					{Name: "Signup", EventName: "signup"},
+				},
+				StartDate:   base.Format("2006-01-02"),
+				EndDate:     base.AddDate(0, 0, 1).Format("2006-01-02"),
+				StrictOrder: tt.strictOrder,
+			})
+			if err != nil {
+				t.Fatalf("GetFunnelAnalysis failed: %v", err)
+			}
+
+			if result.StrictOrder != tt.strict {
+				t.Errorf("Expected strict_order %v in the result, got %v", tt.strict, result.StrictOrder)
+			}
+			if result.TotalUsers != 3 {
+				t.Errorf("Expected 3 users entering, got %d", result.TotalUsers)
+			}
+			if got := result.Steps[1].UserCount; got != tt.signups {
+				t.Errorf("Expected %d signups, got %d", tt.signups, got)
+			}
+			if !tt.strict && (result.Steps[0].AvgTimeToNext != 0 || result.AvgCompletion != 0) {
+				t.Errorf("Expected no timings without strict order, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestFunnelBreakdown(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(24 * time.Hour).Add(-12 * time.Hour)
+
+	// Three Organic visitors of which two sign up, one Direct visitor who does not
+	var events []domain.Event
+	for i, visitor := range []struct {
+		channel string
+		signup  bool
+	}{
+		{"Organic", true},
+		{"Organic", true},
+		{"Organic", false},
+		{"Direct", false},
+	} {
+		user := fmt.Sprintf("u%d", i+1)
+		events = append(events, domain.Event{Timestamp: base, EventName: "page_view", UserID: user, SessionID: user, URL: "/", Channel: visitor.channel})
+		if visitor.signup {
+			events = append(events, domain.Event{Timestamp: base.Add(time.Minute), EventName: "signup", UserID: user, SessionID: user, URL: "/", Channel: visitor.channel})
+		}
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	result, err := repo.GetFunnelAnalysis(t.Context(), domain.FunnelRequest{
+		Steps: []domain.FunnelStep{
+			{Name: "Visit", EventName: "page_view"},
+			{Name: "Signup", EventName: "signup"},
+		},
+		StartDate:   base.Format("2006-01-02"),
+		EndDate:     base.Format("2006-01-02"),
+		BreakdownBy: "channel",
+	})
+	if err != nil {
+		t.Fatalf("GetFunnelAnalysis failed: %v", err)
+	}
+
+	if result.TotalUsers != 4 || result.CompletedUsers != 2 {
+		t.Errorf("Expected 2 of 4 users overall, got %d of %d", result.CompletedUsers, result.TotalUsers)
+	}
+	if result.BreakdownBy != "channel" || result.BreakdownTruncated {
+		t.Errorf("Unexpected breakdown metadata: %q, truncated %v", result.BreakdownBy, result.BreakdownTruncated)
+	}
+	if len(result.Breakdown) != 2 {
+		t.Fatalf("Expected 2 channels, got %d", len(result.Breakdown))
+	}
+
+	expected := []struct {
+		value            string
+		total, completed int64
+	}{
+		{"Organic", 3, 2},
+		{"Direct", 1, 0},
+	}
+	for i, want := range expected {
+		got := result.Breakdown[i]
+		if got.Value != want.value {
+			t.Errorf("Breakdown %d: expected %q, got %q", i, want.value, got.Value)
+		}
+		if got.Result.TotalUsers != want.total || got.Result.CompletedUsers != want.completed {
+			t.Errorf("%s: expected %d of %d users, got %d of %d",
+				want.value, want.completed, want.total, got.Result.CompletedUsers, got.Result.TotalUsers)
+		}
+	}
+}
+
+func TestFunnelCountsNonIncreasing(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(24 * time.Hour).Add(-12 * time.Hour)
+
+	// Enough users for approximate distinct counts to drift: every user views the
+	// landing page, most view pricing, and a shrinking share go on to sign up and buy
+	const users = 300
+	steps := []string{"landing", "pricing", "signup", "purchase"}
+	var events []domain.Event
+	for i := 0; i < users; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		reached := 1 + i%len(steps)
+		if i%50 == 0 {
+			reached = len(steps)
+		}
+		for s := 0; s < reached; s++ {
+			events = append(events, domain.Event{
+				Timestamp: base.Add(time.Duration(s) * time.Minute),
+				EventName: steps[s],
+				UserID:    user,
+				SessionID: user,
+				URL:       "/",
+			})
+		}
+	}
+	// Stored in chunks, a single multi-row insert of every event is slow
+	for chunk := range slices.Chunk(events, 200) {
+		if err := repo.CreateBatch(chunk); err != nil {
+			t.Fatalf("CreateBatch failed: %v", err)
+		}
+	}
+
+	request := domain.FunnelRequest{
+		StartDate: base.Format("2006-01-02"),
+		EndDate:   base.Format("2006-01-02"),
+		Filters:   map[string]string{},
+	}
+	for _, step := range steps {
+		request.Steps = append(request.Steps, domain.FunnelStep{Name: step, EventName: step})
+	}
+
+	result, err := repo.GetFunnelAnalysis(t.Context(), request)
+	if err != nil {
+		t.Fatalf("GetFunnelAnalysis failed: %v", err)
+	}
+
+	if result.Steps[0].UserCount != users {
+		t.Errorf("Expected exactly %d users at the first step, got %d", users, result.Steps[0].UserCount)
+	}
+	for i := 1; i < len(result.Steps); i++ {
+		if result.Steps[i].UserCount > result.Steps[i-1].UserCount {
+			t.Errorf("Step %d has more users (%d) than step %d (%d)",
+				i+1, result.Steps[i].UserCount, i, result.Steps[i-1].UserCount)
+		}
+		if result.Steps[i].ConversionRate > 100 {
+			t.Errorf("Step %d converts at %.2f%%", i+1, result.Steps[i].ConversionRate)
+		}
+	}
+}
+
+func TestGetEventsFilters(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	events := []domain.Event{
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/", Country: "Egypt", Browser: "Firefox"},
+		{Timestamp: base.Add(time.Minute), EventName: "signup", UserID: "u1", SessionID: "s1", URL: "/", Country: "Egypt", Browser: "Firefox"},
+		{Timestamp: base.Add(2 * time.Minute), EventName: "page_view", UserID: "u1", SessionID: "s2", URL: "/", Country: "Egypt", Browser: "Firefox"},
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s3", URL: "/", Country: "Germany", Browser: "Chrome"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		filters  map[string]string
+		expected int64
+	}{
+		{"No filters", map[string]string{}, 4},
+		{"Country", map[string]string{"country": "Egypt"}, 3},
+		{"Browser and event", map[string]string{"browser": "Firefox", "event": "page_view"}, 2},
+		{"User", map[string]string{"user_id": "u2"}, 1},
+		{"Session", map[string]string{"session_id": "s1"}, 2},
+		{"No match", map[string]string{"country": "Egypt", "user_id": "u2"}, 0},
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A page smaller than the result set must still report the filtered total
+			result, err := repo.GetEvents(t.Context(), start, end, 1, 0, tt.filters)
+			if err != nil {
+				t.Fatalf("GetEvents failed: %v", err)
+			}
+			if total := result["total"].(int64); total != tt.expected {
+				t.Errorf("Expected total %d, got %d", tt.expected, total)
+			}
+			page, _ := result["events"].([]domain.Event)
+			if want := min(int(tt.expected), 1); len(page) != want {
+				t.Errorf("Expected %d events on the page, got %d", want, len(page))
+			}
+		})
+	}
+}
+
+func TestGetEventsKeysetMatchesOffset(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	// Pairs of events share a timestamp so pages must break ties by id
+	var events []domain.Event
+	for i := 0; i < 25; i++ {
+		events = append(events, domain.Event{
+			Timestamp: base.Add(time.Duration(i/2) * time.Second),
+			EventName: "page_view",
+			UserID:    fmt.Sprintf("u%d", i),
+			SessionID: fmt.Sprintf("s%d", i),
+			URL:       "/",
+		})
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	const pageSize = 4
+	cursor := ""
+	for offset := 0; offset < len(events); offset += pageSize {
+		byOffset, err := repo.GetEvents(t.Context(), start, end, pageSize, offset, map[string]string{})
+		if err != nil {
+			t.Fatalf("GetEvents with offset %d failed: %v", offset, err)
+		}
+		filters := map[string]string{}
+		if cursor != "" {
+			filters["before"] = cursor
+		}
+		byCursor, err := repo.GetEvents(t.Context(), start, end, pageSize, 0, filters)
+		if err != nil {
+			t.Fatalf("GetEvents with cursor failed: %v", err)
+		}
+
+		offsetPage := byOffset["events"].([]domain.Event)
+		cursorPage := byCursor["events"].([]domain.Event)
+		if len(offsetPage) != len(cursorPage) {
+			t.Fatalf("Page at offset %d: %d events by offset, %d by cursor", offset, len(offsetPage), len(cursorPage))
+		}
+		for i := range offsetPage {
+			if offsetPage[i].ID != cursorPage[i].ID {
+				t.Errorf("Page at offset %d, row %d: id %d by offset, %d by cursor", offset, i, offsetPage[i].ID, cursorPage[i].ID)
+			}
+		}
+		if total := byCursor["total"].(int64); total != int64(len(events)) {
+			t.Errorf("Expected total %d with a cursor, got %d", len(events), total)
+		}
+
+		next, _ := byCursor["next_cursor"].(string)
+		if last := offset+pageSize >= len(events); last != (next == "") {
+			t.Errorf("Page at offset %d: unexpected next_cursor %q", offset, next)
+		}
+		cursor = next
+	}
+}
+
+func TestGetFilterValues(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	events := []domain.Event{
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/", Country: "Egypt", Browser: "Firefox"},
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s2", URL: "/", Country: "Egypt", Browser: "Chrome"},
+		{Timestamp: base, EventName: "signup", UserID: "u2", SessionID: "s2", URL: "/", Country: "Egypt", Browser: "Chrome"},
+		{Timestamp: base, EventName: "page_view", UserID: "u3", SessionID: "s3", URL: "/", Country: "Germany", Browser: "Chrome"},
+		{Timestamp: base, EventName: "page_view", UserID: "u4", SessionID: "s4", URL: "/", Country: "", Browser: "Safari"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	values, err := repo.GetFilterValues(t.Context(), start, end, []string{"country", "browser", "event"}, map[string]string{"country": "Egypt"})
+	if err != nil {
+		t.Fatalf("GetFilterValues failed: %v", err)
+	}
+
+	expected := map[string][]domain.FilterValue{
+		// The country filter does not narrow its own list, and empty values are skipped
+		"country": {{Value: "Egypt", Count: 3}, {Value: "Germany", Count: 1}},
+		"browser": {{Value: "Chrome", Count: 2}, {Value: "Firefox", Count: 1}},
+		"event":   {{Value: "page_view", Count: 2}, {Value: "signup", Count: 1}},
+	}
+	for field, want := range expected {
+		got := values[field]
+		if len(got) != len(want) {
+			t.Errorf("%s: expected %v, got %v", field, want, got)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: expected %v, got %v", field, want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestTopSourcesExcludesReferrerSpam(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	events := []domain.Event{
+		{Timestamp: base, EventName: "page_view", UserID: "u1", SessionID: "s1", URL: "/", Referrer: "https://www.google.com/"},
+		{Timestamp: base, EventName: "page_view", UserID: "u2", SessionID: "s2", URL: "/", Referrer: "http://semalt.com/"},
+		{Timestamp: base, EventName: "page_view", UserID: "u3", SessionID: "s3", URL: "/", Referrer: "http://forum.semalt.com/crawler.php"},
+		{Timestamp: base, EventName: "page_view", UserID: "u4", SessionID: "s4", URL: "/"},
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	sourceNames := func() map[string]bool {
+		sources, _, err := repo.GetTopSources(t.Context(), start, end, 10, map[string]string{})
+		if err != nil {
+			t.Fatalf("GetTopSources failed: %v", err)
+		}
+		names := make(map[string]bool)
+		for _, source := range sources {
+			names[source["name"].(string)] = true
+		}
+		return names
+	}
+
+	names := sourceNames()
+	if len(names) != 2 || !names["google.com"] || !names["Direct"] {
+		t.Errorf("Expected only google and direct sources, got %v", names)
+	}
+
+	t.Setenv("REFERRER_SPAM", "off")
+	if names := sourceNames(); len(names) != 4 {
+		t.Errorf("Expected spam sources to be listed with REFERRER_SPAM=off, got %v", names)
+	}
+}
+
+func TestTopListPaging(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	// US 3 events, DE 2, FR 2, EG 1
+	var events []domain.Event
+	for i, country := range []string{"US", "US", "US", "DE", "DE", "FR", "FR", "EG"} {
+		events = append(events, domain.Event{Timestamp: base, EventName: "page_view", UserID: fmt.Sprintf("u%d", i), SessionID: fmt.Sprintf("s%d", i), URL: "/", Country: country})
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	tests := []struct {
+		name     string
+		limit    int
+		filters  map[string]string
+		expected []string
+	}{
+		{"Default order", 10, map[string]string{}, []string{"US", "DE", "FR", "EG"}},
+		{"First page", 2, map[string]string{}, []string{"US", "DE"}},
+		{"Second page", 2, map[string]string{"offset": "2"}, []string{"FR", "EG"}},
+		{"Past the end", 2, map[string]string{"offset": "10"}, []string{}},
+		{"By name", 10, map[string]string{"sort": "name"}, []string{"DE", "EG", "FR", "US"}},
+		{"By name descending", 2, map[string]string{"sort": "name", "order": "desc"}, []string{"US", "FR"}},
+		{"Least first", 10, map[string]string{"order": "asc"}, []string{"EG", "DE", "FR", "US"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			countries, total, err := repo.GetTopCountries(t.Context(), start, end, tt.limit, tt.filters)
+			if err != nil {
+				t.Fatalf("GetTopCountries failed: %v", err)
+			}
+			if total != 4 {
+				t.Errorf("Expected 4 countries in total, got %d", total)
+			}
+			names := []string{}
+			for _, country := range countries {
+				names = append(names, country["name"].(string))
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+
+	data, err := repo.GetBrowsersDevicesOS(t.Context(), start, end, 10, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetBrowsersDevicesOS failed: %v", err)
+	}
+	if totals, ok := data["totals"].(map[string]int); !ok || totals["browsers"] != 0 {
+		t.Errorf("Expected totals for events without browsers to be 0, got %v", data["totals"])
+	}
+}
+
+func TestGetTopRegions(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	geo := []struct{ country, region string }{
+		{"Germany", "Bavaria"},
+		{"France", "Île-de-France"},
+		{"France", "Île-de-France"},
+		{"Palestine", ""},
+		{"Egypt", "Cairo Governorate"},
+		{"United States", "Georgia"},
+		{"Georgia", "Tbilisi"},
+		{"Unknown", ""},
+	}
+	var events []domain.Event
+	for i, g := range geo {
+		events = append(events, domain.Event{Timestamp: base, EventName: "page_view", UserID: fmt.Sprintf("u%d", i), SessionID: fmt.Sprintf("s%d", i), URL: "/", Country: g.country, Region: g.region})
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	counts := func(level string) map[string]int {
+		rows, _, err := repo.GetTopRegions(t.Context(), start, end, level, 10, map[string]string{})
+		if err != nil {
+			t.Fatalf("GetTopRegions(%s) failed: %v", level, err)
+		}
+		got := make(map[string]int)
+		for _, row := range rows {
+			name := row["name"].(string)
+			if country, ok := row["country"]; ok {
+				name += ", " + country.(string)
+			}
+			got[name] = row["count"].(int)
+		}
+		return got
+	}
+
+	expected := map[string]int{"Europe": 3, "Asia": 2, "Africa": 1, "North America": 1, "Unknown": 1}
+	if got := counts("continent"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected continents %v, got %v", expected, got)
+	}
+	expected = map[string]int{"Germany": 1, "France": 2, "Palestine": 1, "Egypt": 1, "United States": 1, "Georgia": 1, "Unknown": 1}
+	if got := counts("country"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected countries %v, got %v", expected, got)
+	}
+	// Events without a region are left out, and Georgia the state stays apart from Georgia the country
+	expected = map[string]int{"Bavaria, Germany": 1, "Île-de-France, France": 2, "Cairo Governorate, Egypt": 1, "Georgia, United States": 1, "Tbilisi, Georgia": 1}
+	if got := counts("region"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected regions %v, got %v", expected, got)
+	}
+}
+
+func TestGetTopLanguages(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	var events []domain.Event
+	for i, language := range []string{"en", "en", "ar", "en", "", "fr", "ar"} {
+		events = append(events, domain.Event{Timestamp: base, EventName: "page_view", UserID: fmt.Sprintf("u%d", i), SessionID: fmt.Sprintf("s%d", i), URL: "/", Language: language})
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	languages, total, err := repo.GetTopLanguages(t.Context(), base.AddDate(0, 0, -1), base.AddDate(0, 0, 1), 10, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetTopLanguages failed: %v", err)
+	}
+	expected := []map[string]interface{}{
+		{"name": "en", "count": 3},
+		{"name": "ar", "count": 2},
+		{"name": "fr", "count": 1},
+	}
+	if total != 3 || !reflect.DeepEqual(languages, expected) {
+		t.Errorf("Expected %v of 3, got %v of %d", expected, languages, total)
+	}
+}
+
+func TestGetScreenSizes(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	var events []domain.Event
+	for i, width := range []int{390, 414, 390, 1280, 1920, 2560, 0} {
+		events = append(events, domain.Event{Timestamp: base, EventName: "page_view", UserID: fmt.Sprintf("u%d", i%5), SessionID: fmt.Sprintf("s%d", i), URL: "/", ScreenWidth: width})
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	sizes, err := repo.GetScreenSizes(t.Context(), base.AddDate(0, 0, -1), base.AddDate(0, 0, 1), map[string]string{"exact": "true"})
+	if err != nil {
+		t.Fatalf("GetScreenSizes failed: %v", err)
+	}
+	if len(sizes) != len(domain.ScreenBuckets) {
+		t.Fatalf("Expected %d buckets, got %v", len(domain.ScreenBuckets), sizes)
+	}
+
+	expected := map[string][2]int{
+		"mobile":  {3, 3},
+		"tablet":  {0, 0},
+		"laptop":  {1, 1},
+		"desktop": {0, 0},
+		"wide":    {2, 2},
+	}
+	for i, size := range sizes {
+		name := size["bucket"].(string)
+		if name != domain.ScreenBuckets[i].Name {
+			t.Errorf("Expected bucket %d to be %s, got %s", i, domain.ScreenBuckets[i].Name, name)
+		}
+		if got := [2]int{size["events"].(int), size["visitors"].(int)}; got != expected[name] {
+			t.Errorf("Expected %s events and visitors %v, got %v", name, expected[name], got)
+		}
+	}
+	if sizes[0]["percentage"].(float64) != 50 {
+		t.Errorf("Expected mobile at 50%%, got %v", sizes[0]["percentage"])
+	}
+	if sizes[len(sizes)-1]["max_width"] != nil {
+		t.Errorf("Expected no max_width for the last bucket, got %v", sizes[len(sizes)-1]["max_width"])
+	}
+}
+
+func TestTopSourcesGroupByDomain(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	referrers := []string{
+		"https://google.com/",
+		"https://www.google.com/search?q=x",
+		"https://google.com",
+		"https://news.ycombinator.com/item?id=1",
+		"",
+	}
+	events := make([]domain.Event, len(referrers))
+	for i, referrer := range referrers {
+		events[i] = domain.Event{Timestamp: base, EventName: "page_view", UserID: fmt.Sprintf("u%d", i), SessionID: fmt.Sprintf("s%d", i), URL: "/", Referrer: referrer}
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	counts := func(filters map[string]string) map[string]int {
+		sources, _, err := repo.GetTopSources(t.Context(), start, end, 10, filters)
+		if err != nil {
+			t.Fatalf("GetTopSources failed: %v", err)
+		}
+		result := make(map[string]int)
+		for _, source := range sources {
+			result[source["name"].(string)] = source["count"].(int)
+		}
+		return result
+	}
+
+	domains := counts(map[string]string{})
+	if len(domains) != 3 || domains["google.com"] != 3 || domains["news.ycombinator.com"] != 1 || domains["Direct"] != 1 {
+		t.Errorf("Unexpected sources by domain: %v", domains)
+	}
+
+	// Drilling down into a domain lists its full referrer URLs
+	urls := counts(map[string]string{"source": "google.com"})
+	if len(urls) != 3 || urls["https://www.google.com/search?q=x"] != 1 {
+		t.Errorf("Unexpected google.com referrers: %v", urls)
+	}
+
+	// Each referrer normalizes the same way in Go and SQL
+	for _, referrer := range referrers {
+		var normalized string
+		if err := repo.(*eventRepository).db.QueryRow(fmt.Sprintf("SELECT %s FROM (SELECT CAST(? AS VARCHAR) AS referrer)", referrerDomainSQL("referrer")), referrer).Scan(&normalized); err != nil {
+			t.Fatalf("Failed to normalize %q: %v", referrer, err)
+		}
+		if want := domain.NormalizeReferrer(referrer); normalized != want {
+			t.Errorf("SQL normalized %q to %q, Go to %q", referrer, normalized, want)
+		}
+	}
+}
+
+func TestTopPagesGroupByURLPattern(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	if err := urlpattern.Set([]urlpattern.Rule{
+		{Pattern: `[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`, Template: ":uuid"},
+		{Pattern: `/product/\d+`, Template: "/product/:id"},
+	}); err != nil {
+		t.Fatalf("Failed to set URL patterns: %v", err)
+	}
+	t.Cleanup(func() { _ = urlpattern.Set(nil) })
+
+	urls := []string{
+		"https://example.com/product/123",
+		"https://example.com/product/456",
+		"https://example.com/product/456",
+		"https://example.com/orders/3f2b8c1e-9a4d-4e6f-8b2a-1c5d7e9f0a3b",
+		"https://example.com/about",
+	}
+	events := make([]domain.Event, len(urls))
+	for i, url := range urls {
+		events[i] = domain.Event{Timestamp: base, EventName: "page_view", UserID: fmt.Sprintf("u%d", i), SessionID: fmt.Sprintf("s%d", i), URL: url}
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	counts := func(filters map[string]string) map[string]int {
+		result, err := repo.GetTopPages(t.Context(), start, end, 10, filters)
+		if err != nil {
+			t.Fatalf("GetTopPages failed: %v", err)
+		}
+		pages := make(map[string]int)
+		for _, page := range result["top_pages"].([]map[string]interface{}) {
+			pages[page["url"].(string)] = page["count"].(int)
+		}
+		return pages
+	}
+
+	patterns := counts(map[string]string{})
+	if len(patterns) != 3 || patterns["https://example.com/product/:id"] != 3 || patterns["https://example.com/orders/:uuid"] != 1 {
+		t.Errorf("Unexpected pages by pattern: %v", patterns)
+	}
+
+	// Drilling down into a pattern lists its raw URLs
+	raw := counts(map[string]string{"page": "https://example.com/product/:id"})
+	if len(raw) != 2 || raw["https://example.com/product/456"] != 2 {
+		t.Errorf("Unexpected product URLs: %v", raw)
+	}
+
+	entryExit, err := repo.GetEntryExitPages(t.Context(), start, end, 10, map[string]string{})
+	if err != nil {
+		t.Fatalf("GetEntryExitPages failed: %v", err)
+	}
+	if entries := entryExit["entry_pages"].([]map[string]interface{}); len(entries) != 3 {
+		t.Errorf("Expected entry pages grouped by pattern, got %v", entries)
+	}
+
+	// Each URL normalizes the same way in Go and SQL
+	for _, url := range urls {
+		var normalized string
+		if err := repo.(*eventRepository).db.QueryRow(fmt.Sprintf("SELECT %s FROM (SELECT CAST(? AS VARCHAR) AS url)", urlpattern.SQL("url")), url).Scan(&normalized); err != nil {
+			t.Fatalf("Failed to normalize %q: %v", url, err)
+		}
+		if want := urlpattern.Normalize(url); normalized != want {
+			t.Errorf("SQL normalized %q to %q, Go to %q", url, normalized, want)
+		}
+	}
+}
+
+func TestTopPagesStripQuery(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	urls := []string{
+		"https://example.com/search?q=shoes",
+		"https://example.com/search?q=hats#results",
+		"https://example.com/search#top",
+		"https://example.com/about?utm_source=newsletter",
+	}
+	events := make([]domain.Event, len(urls))
+	for i, url := range urls {
+		events[i] = domain.Event{Timestamp: base, EventName: "page_view", UserID: fmt.Sprintf("u%d", i), SessionID: fmt.Sprintf("s%d", i), URL: url}
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start, end := base.AddDate(0, 0, -1), base.AddDate(0, 0, 1)
+	counts := func(filters map[string]string) map[string]int {
+		result, err := repo.GetTopPages(t.Context(), start, end, 10, filters)
+		if err != nil {
+			t.Fatalf("GetTopPages failed: %v", err)
+		}
+		pages := make(map[string]int)
+		for _, page := range result["top_pages"].([]map[string]interface{}) {
+			pages[page["url"].(string)] = page["count"].(int)
+		}
+		return pages
+	}
+
+	if pages := counts(map[string]string{}); len(pages) != 4 {
+		t.Errorf("Expected full URLs by default, got %v", pages)
+	}
+
+	paths := counts(map[string]string{"strip_query": "1"})
+	if len(paths) != 2 || paths["https://example.com/search"] != 3 || paths["https://example.com/about"] != 1 {
+		t.Errorf("Unexpected pages by path: %v", paths)
+	}
+
+	// Drilling down into a path lists its full URLs
+	search := counts(map[string]string{"strip_query": "1", "page": "https://example.com/search"})
+	if len(search) != 3 {
+		t.Errorf("Expected the full search URLs, got %v", search)
+	}
+}
+
+func TestQueriesStopWhenContextIsCanceled(t *testing.T) {
+	repo := newTestRepository(t).(*eventRepository)
+
+	// Enough events that the stats take far longer than the context lives
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := repo.db.Exec(`
+		INSERT INTO events (id, timestamp, date_hour, date_day, date_month, event_name, user_id, session_id, url)
+		SELECT i, ?::TIMESTAMP + to_seconds(i % 86400), ?::TIMESTAMP, ?::DATE, ?::DATE,
+			'page_view', concat('user', i % 100000), concat('session', i % 500000), concat('/page', i % 1000)
+		FROM range(3000000) t(i)
+	`, day, day, day, day); err != nil {
+		t.Fatalf("Failed to insert events: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	started := time.Now()
+	_, err := repo.GetStats(ctx, day, day.Add(24*time.Hour-time.Second), 10, map[string]string{})
+	if err == nil {
+		t.Skipf("Stats finished in %s, before the context was canceled", time.Since(started))
+	}
+	if ctx.Err() == nil {
+		t.Fatalf("Expected the query to fail because of the context, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected the query to stop soon after cancellation, took %s", elapsed)
+	}
+
+	// The interrupted connection goes back to the pool in a usable state
+	if _, err := repo.GetOnlineUsers(t.Context(), 5); err != nil {
+		t.Errorf("Expected queries to work after a canceled one, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// statsQuery is a SQL query and its arguments. Stats queries are built apart from
+// running them, so their plan can be explained and their SQL tested without a
+// database.
+type statsQuery struct {
+	query string
+	args  []interface{}
+}
+
+// explainedReports builds the main query of each report ExplainStats accepts, the
+// one its Get method runs
+var explainedReports = map[string]func(r *eventRepository, startDate, endDate time.Time, limit int, filters map[string]string) statsQuery{
+	domain.ReportOverview: func(r *eventRepository, startDate, endDate time.Time, _ int, filters map[string]string) statsQuery {
+		return topStatsQuery(r.getStatsSource(filters), startDate, endDate, filters)
+	},
+	domain.ReportTimeline: func(r *eventRepository, startDate, endDate time.Time, _ int, filters map[string]string) statsQuery {
+		query, _ := timelineQuery(r.getStatsSource(filters), startDate, endDate, filters)
+		return query
+	},
+	domain.ReportPages: func(r *eventRepository, startDate, endDate time.Time, limit int, filters map[string]string) statsQuery {
+		return topListQuery(r.topPagesQuery(startDate, endDate, filters), limit, filters)
+	},
+	domain.ReportCountries: func(r *eventRepository, startDate, endDate time.Time, limit int, filters map[string]string) statsQuery {
+		return topListQuery(r.topCountriesQuery(startDate, endDate, filters), limit, filters)
+	},
+	domain.ReportLanguages: func(r *eventRepository, startDate, endDate time.Time, limit int, filters map[string]string) statsQuery {
+		return topListQuery(r.topLanguagesQuery(startDate, endDate, filters), limit, filters)
+	},
+	domain.ReportSources: func(r *eventRepository, startDate, endDate time.Time, limit int, filters map[string]string) statsQuery {
+		return topListQuery(r.topSourcesQuery(startDate, endDate, filters), limit, filters)
+	},
+	domain.ReportEvents: func(r *eventRepository, startDate, endDate time.Time, limit int, filters map[string]string) statsQuery {
+		return topListQuery(r.topEventsQuery(startDate, endDate, filters), limit, filters)
+	},
+}
+
+// ExplainStats runs the main query of report under EXPLAIN ANALYZE and returns the
+// plan DuckDB prints, with the time and rows of each operator. The query runs in
+// full, so the plan takes as long as the report.
+func (r *eventRepository) ExplainStats(ctx context.Context, report string, startDate, endDate time.Time, limit int, filters map[string]string) (string, error) {
+	build, ok := explainedReports[report]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", domain.ErrUnknownReport, report)
+	}
+	query := build(r, startDate, endDate, limit, filters)
+
+	rows, err := r.db.QueryContext(ctx, "EXPLAIN ANALYZE "+query.query, query.args...)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	// Rows of explain_key and explain_value, the plan text is in the value
+	var plan strings.Builder
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return "", err
+		}
+		plan.WriteString(value)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return plan.String(), nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestExplainedReports(t *testing.T) {
+	repo := &eventRepository{}
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	reports := []string{
+		domain.ReportOverview, domain.ReportTimeline, domain.ReportPages, domain.ReportCountries,
+		domain.ReportLanguages, domain.ReportSources, domain.ReportEvents,
+	}
+	for _, report := range reports {
+		build, ok := explainedReports[report]
+		if !ok {
+			t.Errorf("Expected a query for report %q", report)
+			continue
+		}
+		query := build(repo, start, end, 50, map[string]string{"project": "web"})
+		if !strings.Contains(query.query, "project_id = ?") || !slices.Contains(query.args, interface{}("web")) {
+			t.Errorf("%s: expected the project filter, got %s with %v", report, query.query, query.args)
+		}
+	}
+
+	if _, err := repo.ExplainStats(t.Context(), "screens", start, end, 50, map[string]string{}); !errors.Is(err, domain.ErrUnknownReport) {
+		t.Errorf("Expected ErrUnknownReport, got %v", err)
+	}
+}
+
+func TestExplainStats(t *testing.T) {
+	repo := newTestRepository(t)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if err := repo.CreateBatch([]domain.Event{
+		{Timestamp: start.Add(time.Hour), EventName: "page_view", Country: "EG", ProjectID: "web"},
+	}); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+	if err := repo.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	plan, err := repo.ExplainStats(t.Context(), domain.ReportCountries, start, start.AddDate(0, 1, 0), 10, map[string]string{"project": "web"})
+	if err != nil {
+		t.Fatalf("ExplainStats failed: %v", err)
+	}
+	if !strings.Contains(plan, "HASH_GROUP_BY") {
+		t.Errorf("Expected the analyzed plan, got %q", plan)
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// exportInsertRows is the most rows inserted by one statement
+const exportInsertRows = 500
+
+// exportEventColumns are the event fields written to a Parquet export, leaving out
+// the date bucket columns the storage layer adds for queries
+const exportEventColumns = `id, timestamp, received_at, event_name, user_id, session_id, session_duration,
+	url, referrer, user_agent, ip, country, region, language, browser, os, device,
+	screen_width, screen_height, is_bot, project_id, channel, sample_rate`
+
+// exportSeq names the export databases, so concurrent exports attach under
+// different aliases
+var exportSeq atomic.Int64
+
+// WriteSQLite writes tables to the SQLite database at path, which must be new or
+// empty. It goes through DuckDB's sqlite extension, which DuckDB installs on first
+// use; without it the error is domain.ErrSQLiteUnavailable.
+func (r *eventRepository) WriteSQLite(path string, tables []domain.ExportTable) (err error) {
+	if _, err := r.db.Exec("LOAD sqlite"); err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrSQLiteUnavailable, err)
+	}
+
+	alias := fmt.Sprintf("sqlite_export_%d", exportSeq.Add(1))
+	if _, err := r.db.Exec(fmt.Sprintf("ATTACH '%s' AS %s (TYPE SQLITE)", sqlString(path), alias)); err != nil {
+		return fmt.Errorf("failed to open SQLite export: %w", err)
+	}
+	defer func() {
+		if _, detachErr := r.db.Exec("DETACH " + alias); detachErr != nil && err == nil {
+			err = fmt.Errorf("failed to close SQLite export: %w", detachErr)
+		}
+	}()
+
+	for _, table := range tables {
+		if err := r.writeExportTable(alias, table); err != nil {
+			return fmt.Errorf("failed to write %s to SQLite export: %w", table.Name, err)
+		}
+	}
+	return nil
+}
+
+// writeExportTable creates table in the attached database alias and inserts its rows
+func (r *eventRepository) writeExportTable(alias string, table domain.ExportTable) error {
+	columns := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		columns[i] = fmt.Sprintf(`"%s" %s`, column.Name, column.Type)
+	}
+	if _, err := r.db.Exec(fmt.Sprintf(`CREATE TABLE %s."%s" (%s)`, alias, table.Name, strings.Join(columns, ", "))); err != nil {
+		return err
+	}
+
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ") + ")"
+	for start := 0; start < len(table.Rows); start += exportInsertRows {
+		chunk := table.Rows[start:min(start+exportInsertRows, len(table.Rows))]
+		values := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*len(table.Columns))
+		for i, rowValues := range chunk {
+			values[i] = row
+			args = append(args, rowValues...)
+		}
+		query := fmt.Sprintf(`INSERT INTO %s."%s" VALUES %s`, alias, table.Name, strings.Join(values, ", "))
+		if _, err := r.db.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportParquet writes the events matching the date range and filters to a Parquet
+// file at path, oldest first, and returns how many there were. When more than
+// maxRows match nothing is written and the error is a *domain.ExportTooLargeError.
+func (r *eventRepository) ExportParquet(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string, maxRows int64) (int64, error) {
+	source := r.getStatsSource(filters)
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
+
+	var rows int64
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", source, whereClause)
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&rows); err != nil {
+		return 0, fmt.Errorf("failed to count export rows: %w", err)
+	}
+	if rows > maxRows {
+		return rows, &domain.ExportTooLargeError{Rows: rows, Limit: maxRows}
+	}
+
+	query := fmt.Sprintf(`
+		COPY (
+			SELECT %s
+			FROM %s
+			WHERE %s
+			ORDER BY timestamp, id
+		) TO '%s' (FORMAT 'PARQUET', CODEC 'ZSTD')
+	`, exportEventColumns, source, whereClause, sqlString(path))
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to write Parquet export: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestWriteSQLite(t *testing.T) {
+	repo := newTestRepository(t).(*eventRepository)
+	path := filepath.Join(t.TempDir(), "export.sqlite")
+
+	tables := []domain.ExportTable{
+		{
+			Name:    "pages",
+			Columns: []domain.ExportColumn{{Name: "url", Type: domain.ExportText}, {Name: "count", Type: domain.ExportInteger}},
+			Rows:    [][]interface{}{{"/", int64(3)}, {"/pricing", int64(1)}},
+		},
+		{
+			Name:    "channels",
+			Columns: []domain.ExportColumn{{Name: "channel", Type: domain.ExportText}, {Name: "conversion_rate", Type: domain.ExportReal}},
+		},
+	}
+	err := repo.WriteSQLite(path, tables)
+	if errors.Is(err, domain.ErrSQLiteUnavailable) {
+		t.Skipf("DuckDB's sqlite extension is not available: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("WriteSQLite failed: %v", err)
+	}
+
+	// Read the file back through a fresh attachment, as a SQLite client would see it
+	if _, err := repo.db.Exec("ATTACH '" + sqlString(path) + "' AS exported (TYPE SQLITE, READ_ONLY)"); err != nil {
+		t.Fatalf("Failed to open export: %v", err)
+	}
+	defer func() {
+		if _, err := repo.db.Exec("DETACH exported"); err != nil {
+			t.Errorf("Failed to close export: %v", err)
+		}
+	}()
+
+	result, err := repo.db.Query("SELECT url, count FROM exported.pages ORDER BY url")
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	defer result.Close()
+	var pages [][]interface{}
+	for result.Next() {
+		var url string
+		var count int64
+		if err := result.Scan(&url, &count); err != nil {
+			t.Fatalf("Failed to scan export: %v", err)
+		}
+		pages = append(pages, []interface{}{url, count})
+	}
+	if !reflect.DeepEqual(pages, tables[0].Rows) {
+		t.Errorf("Expected pages %v, got %v", tables[0].Rows, pages)
+	}
+
+	var channels int
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM exported.channels").Scan(&channels); err != nil || channels != 0 {
+		t.Errorf("Expected an empty channels table, got %d rows (%v)", channels, err)
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	repo := newTestRepository(t)
+
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	events := []domain.Event{
+		{Timestamp: base.Add(2 * time.Hour), EventName: "signup", ProjectID: "web"},
+		{Timestamp: base, EventName: "page_view", ProjectID: "web"},
+		{Timestamp: base.Add(time.Hour), EventName: "page_view", ProjectID: "app"},
+		{Timestamp: base.AddDate(0, 0, 5), EventName: "page_view", ProjectID: "web"},
+	}
+	for i := range events {
+		events[i].UserID, events[i].SessionID, events[i].URL = "u1", "s1", "/"
+	}
+	if err := repo.CreateBatch(events); err != nil {
+		t.Fatalf("CreateBatch failed: %v", err)
+	}
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24*time.Hour - time.Nanosecond)
+	filters := map[string]string{"project": "web"}
+	path := filepath.Join(t.TempDir(), "events.parquet")
+
+	rows, err := repo.ExportParquet(t.Context(), start, end, filters, path, 10)
+	if err != nil {
+		t.Fatalf("ExportParquet failed: %v", err)
+	}
+	if rows != 2 {
+		t.Errorf("Expected 2 rows, got %d", rows)
+	}
+
+	result, err := repo.(*eventRepository).db.Query("SELECT event_name FROM read_parquet('" + sqlString(path) + "')")
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	defer result.Close()
+	var names []string
+	for result.Next() {
+		var name string
+		if err := result.Scan(&name); err != nil {
+			t.Fatalf("Failed to scan export: %v", err)
+		}
+		names = append(names, name)
+	}
+	if expected := []string{"page_view", "signup"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v in timestamp order, got %v", expected, names)
+	}
+
+	// Over the cap nothing is written
+	_, err = repo.ExportParquet(t.Context(), start, end, filters, filepath.Join(t.TempDir(), "capped.parquet"), 1)
+	var tooLarge *domain.ExportTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Rows != 2 || tooLarge.Limit != 1 {
+		t.Errorf("Expected an ExportTooLargeError for 2 rows over 1, got %v", err)
+	}
+}
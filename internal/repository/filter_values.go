@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// MaxFilterValues caps the values listed per field by GetFilterValues
+const MaxFilterValues = 200
+
+// filterValueColumns maps each of domain.FilterFields to its column
+var filterValueColumns = map[string]string{
+	"country": "country",
+	"browser": "browser",
+	"device":  "device",
+	"os":      "os",
+	"source":  referrerDomainSQL("referrer"),
+	"event":   "event_name",
+	"page":    "url",
+	"project": "project_id",
+}
+
+// GetFilterValues returns, for each field, its most frequent values among the events
+// matching filters. A field's own filter is ignored when listing its values, so a
+// menu still offers the alternatives to the current selection.
+func (r *eventRepository) GetFilterValues(ctx context.Context, startDate, endDate time.Time, fields []string, filters map[string]string) (map[string][]domain.FilterValue, error) {
+	values := make(map[string][]domain.FilterValue, len(fields))
+
+	for _, field := range fields {
+		column, ok := filterValueColumns[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field %q", field)
+		}
+
+		others := make(map[string]string, len(filters))
+		for key, value := range filters {
+			if key != field {
+				others[key] = value
+			}
+		}
+		source := r.getStatsSource(others)
+		whereClause, args := buildWhereClause(startDate, endDate, others)
+		if field == "page" {
+			// Offer pages as the top pages list them
+			column = pageSQL(column, others)
+		}
+
+		query := fmt.Sprintf(`
+			SELECT %[1]s, COUNT(*) as count
+			FROM %[2]s
+			WHERE %[3]s AND %[1]s IS NOT NULL AND %[1]s != ''
+			GROUP BY %[1]s
+			ORDER BY count DESC, %[1]s
+			LIMIT %[4]d
+		`, column, source, whereClause, MaxFilterValues)
+
+		fieldValues, err := r.queryFilterValues(ctx, query, args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s values: %w", field, err)
+		}
+		values[field] = fieldValues
+	}
+
+	return values, nil
+}
+
+func (r *eventRepository) queryFilterValues(ctx context.Context, query string, args []interface{}) ([]domain.FilterValue, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	values := []domain.FilterValue{}
+	for rows.Next() {
+		var value domain.FilterValue
+		if err := rows.Scan(&value.Value, &value.Count); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
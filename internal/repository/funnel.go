@@ -0,0 +1,430 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// funnelStepMatch returns the " AND ..." conditions selecting the events that complete
+// step, with prefix ("" or "e.") qualifying the columns
+func funnelStepMatch(step domain.FunnelStep, prefix string) (string, []interface{}) {
+	var clause strings.Builder
+	var args []interface{}
+
+	switch names := step.MatchedEventNames(); len(names) {
+	case 0:
+	case 1:
+		clause.WriteString(" AND " + prefix + "event_name = ?")
+		args = append(args, names[0])
+	default:
+		clause.WriteString(" AND " + prefix + "event_name IN (?" + strings.Repeat(", ?", len(names)-1) + ")")
+		for _, name := range names {
+			args = append(args, name)
+		}
+	}
+
+	if step.URL != "" {
+		clause.WriteString(" AND " + prefix + "url = ?")
+		args = append(args, step.URL)
+	}
+	if step.URLPattern != "" {
+		clause.WriteString(" AND " + prefix + `url LIKE ? ESCAPE '\'`)
+		args = append(args, globToLike(step.URLPattern))
+	}
+
+	return clause.String(), args
+}
+
+// globToLike converts a glob (* any run of characters, ? one character) to a LIKE
+// pattern, escaping the characters LIKE would otherwise treat as wildcards
+func globToLike(glob string) string {
+	var pattern strings.Builder
+	for _, c := range glob {
+		switch c {
+		case '*':
+			pattern.WriteByte('%')
+		case '?':
+			pattern.WriteByte('_')
+		case '%', '_', '\\':
+			pattern.WriteByte('\\')
+			pattern.WriteRune(c)
+		default:
+			pattern.WriteRune(c)
+		}
+	}
+	return pattern.String()
+}
+
+// windowCondition returns an " AND ..." condition keeping a millisecond difference
+// within hours, or nothing when hours is not positive
+func windowCondition(diffMs string, hours int) string {
+	if hours <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" AND %s <= %d", diffMs, int64(hours)*int64(time.Hour/time.Millisecond))
+}
+
+// funnelCount returns the count funnel rates are computed over: users, or sessions
+// in session scope
+func funnelCount(scope string, users, sessions int64) int64 {
+	if scope == domain.FunnelScopeSession {
+		return sessions
+	}
+	return users
+}
+
+// funnelGroupColumns returns the columns identifying one journey through the funnel
+func funnelGroupColumns(scope string) string {
+	if scope == domain.FunnelScopeSession {
+		return "user_id, session_id"
+	}
+	return "user_id"
+}
+
+// sessionCondition returns the " AND ..." condition joining two step aliases on the
+// same session, or nothing outside session scope
+func sessionCondition(scope, left, right string) string {
+	if scope != domain.FunnelScopeSession {
+		return ""
+	}
+	return fmt.Sprintf(" AND %s.session_id = %s.session_id", left, right)
+}
+
+// funnelFilterClause builds the WHERE clause of the funnel's date range and global
+// filters, with prefix ("" or "e.") qualifying the columns
+func funnelFilterClause(startDate, endDate time.Time, filters map[string]string, prefix string) (string, []interface{}) {
+	whereClause := prefix + "timestamp BETWEEN ? AND ?"
+	args := []interface{}{startDate, endDate}
+
+	for _, filter := range []struct{ key, column string }{
+		{"project", "project_id"},
+		{"country", "country"},
+		{"browser", "browser"},
+		{"device", "device"},
+		{"os", "os"},
+		{"channel", "channel"},
+	} {
+		if value := filters[filter.key]; value != "" {
+			whereClause += " AND " + prefix + filter.column + " = ?"
+			args = append(args, value)
+		}
+	}
+	if value := filters["source"]; value != "" {
+		whereClause += " AND " + sourceCondition(prefix+"referrer")
+		args = append(args, value, value)
+	}
+
+	switch filters["botFilter"] {
+	case "bot":
+		whereClause += " AND " + prefix + "is_bot = TRUE"
+	case "human":
+		whereClause += " AND " + prefix + "is_bot = FALSE"
+	}
+
+	return whereClause, args
+}
+
+// funnelStepFilters are the step filters a funnel step may set, with their column,
+// in the order their conditions are added
+var funnelStepFilters = []struct{ key, column string }{
+	{"country", "country"},
+	{"browser", "browser"},
+	{"device", "device"},
+	{"os", "os"},
+}
+
+// funnelStepWhere returns the " AND ..." conditions of step: the events completing
+// it, see funnelStepMatch, and the step's own filters
+func funnelStepWhere(step domain.FunnelStep, prefix string) (string, []interface{}) {
+	clause, args := funnelStepMatch(step, prefix)
+	for _, filter := range funnelStepFilters {
+		if value, ok := step.Filters[filter.key]; ok {
+			clause += " AND " + prefix + filter.column + " = ?"
+			args = append(args, value)
+		}
+	}
+	return clause, args
+}
+
+// funnelStepQuery counts the users, sessions and events reaching step i of request.
+// Past the first step these are the ones that completed every earlier step in
+// order, within the conversion window and the funnel's maximum duration, or in any
+// order when the request is not in strict order, see funnelAnyOrderQuery.
+func funnelStepQuery(source string, startDate, endDate time.Time, request domain.FunnelRequest, scope string, i int) statsQuery {
+	if i > 0 && !request.InStrictOrder() {
+		return funnelAnyOrderQuery(source, startDate, endDate, request, scope, i)
+	}
+	if i == 0 {
+		whereClause, args := funnelFilterClause(startDate, endDate, request.Filters, "")
+		match, matchArgs := funnelStepWhere(request.Steps[0], "")
+		query := fmt.Sprintf(`
+			SELECT
+				COUNT(DISTINCT user_id) as user_count,
+				COUNT(DISTINCT session_id) as session_count,
+				COUNT(*) as event_count
+			FROM %s
+			WHERE %s
+		`, source, whereClause+match)
+		return statsQuery{query: query, args: append(args, matchArgs...)}
+	}
+
+	// A CTE per step, each joined to the one before it
+	var cteBuilder strings.Builder
+	cteBuilder.WriteString("WITH ")
+	var args []interface{}
+	for j := 0; j <= i; j++ {
+		if j > 0 {
+			cteBuilder.WriteString(", ")
+		}
+		cteName := fmt.Sprintf("step_%d", j+1)
+
+		if j == 0 {
+			// First step: simple query without joins
+			whereClause, whereArgs := funnelFilterClause(startDate, endDate, request.Filters, "")
+			match, matchArgs := funnelStepWhere(request.Steps[j], "")
+			fmt.Fprintf(&cteBuilder, "%s AS (SELECT user_id, session_id, timestamp, timestamp AS first_timestamp FROM %s WHERE %s)", cteName, source, whereClause+match)
+			args = append(args, whereArgs...)
+			args = append(args, matchArgs...)
+			continue
+		}
+
+		// The step must follow the previous one, within the conversion window
+		// and the funnel's maximum duration when they are set
+		joinClause := "e.user_id = prev.user_id AND e.timestamp > prev.timestamp"
+		if scope == domain.FunnelScopeSession {
+			joinClause += " AND e.session_id = prev.session_id"
+		}
+		if request.ConversionWindowHours > 0 {
+			joinClause += " AND e.timestamp <= prev.timestamp + to_hours(CAST(? AS BIGINT))"
+			args = append(args, request.ConversionWindowHours)
+		}
+		if request.MaxFunnelDuration > 0 {
+			joinClause += " AND e.timestamp <= prev.first_timestamp + to_hours(CAST(? AS BIGINT))"
+			args = append(args, request.MaxFunnelDuration)
+		}
+
+		whereClause, whereArgs := funnelFilterClause(startDate, endDate, request.Filters, "e.")
+		match, matchArgs := funnelStepWhere(request.Steps[j], "e.")
+		fmt.Fprintf(&cteBuilder, "%s AS (SELECT e.user_id, e.session_id, e.timestamp, prev.first_timestamp FROM %s e INNER JOIN step_%d prev ON %s WHERE %s)", cteName, source, j, joinClause, whereClause+match)
+		args = append(args, whereArgs...)
+		args = append(args, matchArgs...)
+	}
+
+	query := fmt.Sprintf(`
+		%s
+		SELECT 
+			COUNT(DISTINCT user_id) as user_count,
+			COUNT(DISTINCT session_id) as session_count,
+			COUNT(*) as event_count
+		FROM step_%d
+	`, cteBuilder.String(), i+1)
+	return statsQuery{query: query, args: args}
+}
+
+// funnelAnyOrderQuery counts the users, sessions and events reaching step i of
+// request regardless of sequence: the step's events by the users (sessions in
+// session scope) found in every step up to i, the intersection of their sets
+func funnelAnyOrderQuery(source string, startDate, endDate time.Time, request domain.FunnelRequest, scope string, i int) statsQuery {
+	columns := funnelGroupColumns(scope)
+	whereClause, whereArgs := funnelFilterClause(startDate, endDate, request.Filters, "")
+
+	var args []interface{}
+	reached := make([]string, 0, i+1)
+	for j := 0; j <= i; j++ {
+		match, matchArgs := funnelStepWhere(request.Steps[j], "")
+		reached = append(reached, fmt.Sprintf("SELECT %s FROM %s WHERE %s", columns, source, whereClause+match))
+		args = append(append(args, whereArgs...), matchArgs...)
+	}
+
+	stepWhere, stepArgs := funnelFilterClause(startDate, endDate, request.Filters, "e.")
+	match, matchArgs := funnelStepWhere(request.Steps[i], "e.")
+	query := fmt.Sprintf(`
+		WITH reached AS (
+			%s
+		)
+		SELECT
+			COUNT(DISTINCT e.user_id) as user_count,
+			COUNT(DISTINCT e.session_id) as session_count,
+			COUNT(*) as event_count
+		FROM %s e
+		WHERE %s AND EXISTS (SELECT 1 FROM reached r WHERE r.user_id = e.user_id%s)
+	`, strings.Join(reached, "\n\t\t\tINTERSECT\n\t\t\t"), source, stepWhere+match, sessionCondition(scope, "r", "e"))
+	args = append(append(args, stepArgs...), matchArgs...)
+	return statsQuery{query: query, args: args}
+}
+
+// funnelTimeToNextQuery returns the average and median seconds from step i of
+// request to the step after it
+func funnelTimeToNextQuery(source string, startDate, endDate time.Time, request domain.FunnelRequest, scope string, i int) statsQuery {
+	whereClause, whereArgs := funnelFilterClause(startDate, endDate, request.Filters, "")
+	current, currentArgs := funnelStepWhere(request.Steps[i], "")
+	next, nextArgs := funnelStepMatch(request.Steps[i+1], "")
+
+	// Optimized time calculation using epoch_ms for better performance
+	query := fmt.Sprintf(`
+		WITH current_step AS (
+			SELECT user_id, session_id, epoch_ms(timestamp) as ts_ms
+			FROM %s 
+			WHERE %s
+		),
+		next_step AS (
+			SELECT user_id, session_id, epoch_ms(timestamp) as ts_ms
+			FROM %s 
+			WHERE %s
+		),
+		time_diffs AS (
+			SELECT (n.ts_ms - c.ts_ms) / 1000.0 as time_diff_seconds
+			FROM current_step c
+			INNER JOIN next_step n ON c.user_id = n.user_id AND n.ts_ms > c.ts_ms%s%s
+		)
+		SELECT 
+			AVG(time_diff_seconds) as avg_time,
+			APPROX_QUANTILE(time_diff_seconds, 0.5) as median_time
+		FROM time_diffs
+	`, source, whereClause+current, source, whereClause+next, sessionCondition(scope, "c", "n"), windowCondition("n.ts_ms - c.ts_ms", request.ConversionWindowHours))
+
+	var args []interface{}
+	args = append(append(args, whereArgs...), currentArgs...)
+	args = append(append(args, whereArgs...), nextArgs...)
+	return statsQuery{query: query, args: args}
+}
+
+// funnelCompletionQuery returns the average seconds from the first step of request
+// to its last
+func funnelCompletionQuery(source string, startDate, endDate time.Time, request domain.FunnelRequest, scope string) statsQuery {
+	whereClause, whereArgs := funnelFilterClause(startDate, endDate, request.Filters, "")
+	first, firstArgs := funnelStepMatch(request.Steps[0], "")
+	last, lastArgs := funnelStepMatch(request.Steps[len(request.Steps)-1], "")
+
+	// Optimized completion time calculation using epoch_ms
+	query := fmt.Sprintf(`
+		WITH first_step AS (
+			SELECT %[1]s, MIN(epoch_ms(timestamp)) as first_time_ms
+			FROM %[2]s 
+			WHERE %[3]s
+			GROUP BY %[1]s
+		),
+		last_step AS (
+			SELECT %[1]s, MAX(epoch_ms(timestamp)) as last_time_ms
+			FROM %[2]s 
+			WHERE %[4]s
+			GROUP BY %[1]s
+		),
+		completion_times AS (
+			SELECT (l.last_time_ms - f.first_time_ms) / 1000.0 as completion_seconds
+			FROM first_step f
+			INNER JOIN last_step l ON f.user_id = l.user_id AND l.last_time_ms > f.first_time_ms%[5]s%[6]s
+		)
+		SELECT AVG(completion_seconds) as avg_completion
+		FROM completion_times
+	`, funnelGroupColumns(scope), source, whereClause+first, whereClause+last, sessionCondition(scope, "f", "l"), windowCondition("l.last_time_ms - f.first_time_ms", request.MaxFunnelDuration))
+
+	var args []interface{}
+	args = append(append(args, whereArgs...), firstArgs...)
+	args = append(append(args, whereArgs...), lastArgs...)
+	return statsQuery{query: query, args: args}
+}
+
+// funnelBreakdownQuery returns the values of the breakdown column with the most
+// users entering the funnel, one more than MaxFunnelBreakdownValues to tell when
+// some were left out
+func funnelBreakdownQuery(source, column string, startDate, endDate time.Time, request domain.FunnelRequest) statsQuery {
+	whereClause, args := funnelFilterClause(startDate, endDate, request.Filters, "")
+	match, matchArgs := funnelStepMatch(request.Steps[0], "")
+	query := fmt.Sprintf(`
+		SELECT %[1]s, COUNT(DISTINCT user_id) as users
+		FROM %[2]s
+		WHERE %[3]s%[4]s AND %[1]s IS NOT NULL AND %[1]s != ''
+		GROUP BY %[1]s
+		ORDER BY users DESC, %[1]s
+		LIMIT %[5]d
+	`, column, source, whereClause, match, MaxFunnelBreakdownValues+1)
+	return statsQuery{query: query, args: append(args, matchArgs...)}
+}
+
+// funnelBreakdownColumns maps the dimensions a funnel can be broken down by to their
+// column. Each dimension is also a global funnel filter, see funnelFilterClause.
+var funnelBreakdownColumns = map[string]string{
+	"channel": "channel",
+	"device":  "device",
+	"country": "country",
+	"source":  referrerDomainSQL("referrer"),
+}
+
+// getFunnelBreakdown runs the funnel overall and once per value of the breakdown
+// dimension, for the values with the most users entering the funnel
+func (r *eventRepository) getFunnelBreakdown(ctx context.Context, request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
+	column, ok := funnelBreakdownColumns[request.BreakdownBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown breakdown_by %q", request.BreakdownBy)
+	}
+
+	dimension := request.BreakdownBy
+	request.BreakdownBy = ""
+	result, err := r.GetFunnelAnalysis(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	result.BreakdownBy = dimension
+	result.Breakdown = []domain.FunnelBreakdownResult{}
+
+	// GetFunnelAnalysis has validated the dates
+	startDate, _, _ := domain.ParseDay(request.StartDate)
+	_, endDate, _ := domain.ParseDay(request.EndDate)
+
+	values, err := r.funnelBreakdownValues(ctx, funnelBreakdownQuery(r.getStatsSource(request.Filters), column, startDate, endDate, request))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s values: %w", dimension, err)
+	}
+	if len(values) > MaxFunnelBreakdownValues {
+		values = values[:MaxFunnelBreakdownValues]
+		result.BreakdownTruncated = true
+	}
+
+	for _, value := range values {
+		filters := make(map[string]string, len(request.Filters)+1)
+		for key, v := range request.Filters {
+			filters[key] = v
+		}
+		filters[dimension] = value
+
+		segment := request
+		segment.Filters = filters
+		segmentResult, err := r.GetFunnelAnalysis(ctx, segment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to analyze funnel for %s %q: %w", dimension, value, err)
+		}
+		result.Breakdown = append(result.Breakdown, domain.FunnelBreakdownResult{Value: value, Result: segmentResult})
+	}
+
+	return result, nil
+}
+
+// funnelBreakdownValues reads the dimension values returned by a breakdown query
+func (r *eventRepository) funnelBreakdownValues(ctx context.Context, query statsQuery) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, query.query, query.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		var users int64
+		if err := rows.Scan(&value, &users); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
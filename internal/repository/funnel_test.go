@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestFunnelStepMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		step           domain.FunnelStep
+		prefix         string
+		expectedClause string
+		expectedArgs   []interface{}
+	}{
+		{
+			name:           "Single event",
+			step:           domain.FunnelStep{EventName: "signup"},
+			expectedClause: " AND event_name = ?",
+			expectedArgs:   []interface{}{"signup"},
+		},
+		{
+			name:           "Any of",
+			step:           domain.FunnelStep{EventName: "signup", EventNames: []string{"oauth_signup"}},
+			prefix:         "e.",
+			expectedClause: " AND e.event_name IN (?, ?)",
+			expectedArgs:   []interface{}{"signup", "oauth_signup"},
+		},
+		{
+			name:           "URL and pattern",
+			step:           domain.FunnelStep{EventNames: []string{"page_view"}, URL: "/pricing", URLPattern: "/blog/*"},
+			expectedClause: ` AND event_name = ? AND url = ? AND url LIKE ? ESCAPE '\'`,
+			expectedArgs:   []interface{}{"page_view", "/pricing", "/blog/%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args := funnelStepMatch(tt.step, tt.prefix)
+			if clause != tt.expectedClause {
+				t.Errorf("Expected clause %q, got %q", tt.expectedClause, clause)
+			}
+			if len(args) != len(tt.expectedArgs) {
+				t.Fatalf("Expected args %v, got %v", tt.expectedArgs, args)
+			}
+			for i := range args {
+				if args[i] != tt.expectedArgs[i] {
+					t.Errorf("Expected args %v, got %v", tt.expectedArgs, args)
+				}
+			}
+		})
+	}
+}
+
+func TestGlobToLike(t *testing.T) {
+	tests := []struct {
+		glob     string
+		expected string
+	}{
+		{"/blog/*", "/blog/%"},
+		{"/p?ge", "/p_ge"},
+		{"/100%_off", `/100\%\_off`},
+		{`/a\b`, `/a\\b`},
+		{"/exact", "/exact"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			if got := globToLike(tt.glob); got != tt.expected {
+				t.Errorf("globToLike(%q) = %q, expected %q", tt.glob, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWindowCondition(t *testing.T) {
+	tests := []struct {
+		hours    int
+		expected string
+	}{
+		{0, ""},
+		{-1, ""},
+		{1, " AND n.ts_ms - c.ts_ms <= 3600000"},
+		{24, " AND n.ts_ms - c.ts_ms <= 86400000"},
+	}
+
+	for _, tt := range tests {
+		if got := windowCondition("n.ts_ms - c.ts_ms", tt.hours); got != tt.expected {
+			t.Errorf("windowCondition(%d) = %q, expected %q", tt.hours, got, tt.expected)
+		}
+	}
+}
+
+func TestFunnelScopeHelpers(t *testing.T) {
+	if got := funnelCount(domain.FunnelScopeUser, 10, 25); got != 10 {
+		t.Errorf("Expected user scope to count users, got %d", got)
+	}
+	if got := funnelCount(domain.FunnelScopeSession, 10, 25); got != 25 {
+		t.Errorf("Expected session scope to count sessions, got %d", got)
+	}
+	if got := sessionCondition(domain.FunnelScopeUser, "c", "n"); got != "" {
+		t.Errorf("Expected no session condition in user scope, got %q", got)
+	}
+	if got := sessionCondition(domain.FunnelScopeSession, "c", "n"); got != " AND c.session_id = n.session_id" {
+		t.Errorf("Unexpected session condition %q", got)
+	}
+}
+
+func TestFunnelFilterClause(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+
+	clause, args := funnelFilterClause(start, end, map[string]string{
+		"project":   "web",
+		"channel":   "Organic",
+		"source":    "google.com",
+		"botFilter": "human",
+		"exact":     "1",
+	}, "e.")
+
+	expected := "e.timestamp BETWEEN ? AND ? AND e.project_id = ? AND e.channel = ? AND " + sourceCondition("e.referrer") + " AND e.is_bot = FALSE"
+	if clause != expected {
+		t.Errorf("Expected clause %q, got %q", expected, clause)
+	}
+	if len(args) != 6 || args[2] != "web" || args[3] != "Organic" || args[4] != "google.com" || args[5] != "google.com" {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// Goals live in the DuckDB goals table in both storage modes, they are
+// configuration rather than event data
+
+// CreateGoal stores a new goal and returns it with its id and creation time
+func (r *eventRepository) CreateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error) {
+	if err := r.checkGoalName(ctx, goal.Name, 0); err != nil {
+		return domain.Goal{}, err
+	}
+
+	// DuckDB keeps microseconds, so the time returned matches later reads
+	goal.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO goals (name, event_name, url, created_at) VALUES (?, ?, ?, ?) RETURNING id`,
+		goal.Name, goal.EventName, goal.URL, goal.CreatedAt,
+	).Scan(&goal.ID)
+	if err != nil {
+		return domain.Goal{}, fmt.Errorf("failed to create goal: %w", err)
+	}
+	return goal, nil
+}
+
+// GetGoals returns every goal, oldest first
+func (r *eventRepository) GetGoals(ctx context.Context) ([]domain.Goal, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, COALESCE(event_name, ''), COALESCE(url, ''), created_at FROM goals ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query goals: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	goals := []domain.Goal{}
+	for rows.Next() {
+		var goal domain.Goal
+		if err := rows.Scan(&goal.ID, &goal.Name, &goal.EventName, &goal.URL, &goal.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan goal: %w", err)
+		}
+		goals = append(goals, goal)
+	}
+	return goals, rows.Err()
+}
+
+// GetGoal returns the goal with id, or domain.ErrGoalNotFound
+func (r *eventRepository) GetGoal(ctx context.Context, id int64) (domain.Goal, error) {
+	var goal domain.Goal
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, name, COALESCE(event_name, ''), COALESCE(url, ''), created_at FROM goals WHERE id = ?`, id,
+	).Scan(&goal.ID, &goal.Name, &goal.EventName, &goal.URL, &goal.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Goal{}, domain.ErrGoalNotFound
+	}
+	if err != nil {
+		return domain.Goal{}, fmt.Errorf("failed to get goal: %w", err)
+	}
+	return goal, nil
+}
+
+// UpdateGoal replaces the name and definition of goal.ID, keeping its creation time
+func (r *eventRepository) UpdateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error) {
+	existing, err := r.GetGoal(ctx, goal.ID)
+	if err != nil {
+		return domain.Goal{}, err
+	}
+	if err := r.checkGoalName(ctx, goal.Name, goal.ID); err != nil {
+		return domain.Goal{}, err
+	}
+
+	if _, err := r.db.ExecContext(ctx,
+		`UPDATE goals SET name = ?, event_name = ?, url = ? WHERE id = ?`,
+		goal.Name, goal.EventName, goal.URL, goal.ID,
+	); err != nil {
+		return domain.Goal{}, fmt.Errorf("failed to update goal: %w", err)
+	}
+	goal.CreatedAt = existing.CreatedAt
+	return goal, nil
+}
+
+// DeleteGoal removes the goal with id, or returns domain.ErrGoalNotFound
+func (r *eventRepository) DeleteGoal(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM goals WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete goal: %w", err)
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return domain.ErrGoalNotFound
+	}
+	return nil
+}
+
+// checkGoalName returns domain.ErrGoalExists when a goal other than id has name
+func (r *eventRepository) checkGoalName(ctx context.Context, name string, id int64) error {
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM goals WHERE name = ? AND id != ?`, name, id).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check goal name: %w", err)
+	}
+	if count > 0 {
+		return domain.ErrGoalExists
+	}
+	return nil
+}
+
+// goalFilters returns filters narrowed to the events that reach goal. The goal's
+// event name and URL replace any event and page filters, and the metric filter is
+// dropped so it cannot restrict matches to page views.
+func goalFilters(goal domain.Goal, filters map[string]string) map[string]string {
+	matched := make(map[string]string, len(filters)+2)
+	for key, value := range filters {
+		matched[key] = value
+	}
+	delete(matched, "metric")
+	delete(matched, "event")
+	delete(matched, "page")
+	if goal.EventName != "" {
+		matched["event"] = goal.EventName
+	}
+	if goal.URL != "" {
+		matched["page"] = goal.URL
+	}
+	return matched
+}
+
+// GetGoalConversions returns, for every goal, the unique visitors who reached it in
+// the date range and their share of all unique visitors matching filters
+func (r *eventRepository) GetGoalConversions(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.GoalConversion, error) {
+	goals, err := r.GetGoals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exact := domain.ExactCounts(filters)
+	minSample := minSampleSize()
+	source := r.getStatsSource(filters)
+
+	audience := make(map[string]string, len(filters))
+	for key, value := range filters {
+		audience[key] = value
+	}
+	delete(audience, "metric")
+
+	whereClause, args := buildWhereClause(startDate, endDate, audience)
+	var visitors int64
+	query := distinctCounts(fmt.Sprintf(`SELECT APPROX_COUNT_DISTINCT(user_id) FROM %s WHERE %s`, source, whereClause), exact)
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&visitors); err != nil {
+		return nil, fmt.Errorf("failed to count visitors: %w", err)
+	}
+
+	conversions := make([]domain.GoalConversion, 0, len(goals))
+	for _, goal := range goals {
+		conversion := domain.GoalConversion{Goal: goal}
+
+		whereClause, args := buildWhereClause(startDate, endDate, goalFilters(goal, filters))
+		query := distinctCounts(fmt.Sprintf(`
+			SELECT APPROX_COUNT_DISTINCT(user_id), COUNT(*)
+			FROM %s
+			WHERE %s
+		`, source, whereClause), exact)
+		if err := r.db.QueryRowContext(ctx, query, args...).Scan(&conversion.Conversions, &conversion.Events); err != nil {
+			return nil, fmt.Errorf("failed to count conversions for goal %q: %w", goal.Name, err)
+		}
+
+		if rate, ok := sampleRate(conversion.Conversions, visitors, minSample); ok {
+			conversion.ConversionRate = &rate
+		} else if visitors > 0 {
+			conversion.InsufficientData = true
+		}
+		conversions = append(conversions, conversion)
+	}
+
+	return conversions, nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// Names of the readiness checks
+const (
+	CheckDatabase = "database" // DuckDB answers a trivial query
+	CheckStorage  = "storage"  // New Parquet files can be written
+	CheckQuery    = "query"    // The event source, Parquet files or table, can be queried
+)
+
+// CheckReadiness runs the readiness checks. The query check counts the events of
+// the last minute, which reads every Parquet file's metadata without scanning the
+// data, so unreadable files fail it quickly.
+func (r *eventRepository) CheckReadiness(ctx context.Context) domain.Readiness {
+	readiness := domain.Readiness{Checks: map[string]domain.HealthCheck{}}
+	run := func(name string, check func() error) {
+		started := time.Now()
+		result := domain.HealthCheck{Status: domain.CheckOK}
+		if err := check(); err != nil {
+			result = domain.HealthCheck{Status: domain.CheckFailed, Error: err.Error()}
+		}
+		result.DurationMs = time.Since(started).Milliseconds()
+		readiness.Checks[name] = result
+	}
+
+	run(CheckDatabase, func() error {
+		var one int
+		return r.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	})
+	if r.parquetStorage != nil {
+		run(CheckStorage, r.parquetStorage.CheckWritable)
+	} else {
+		readiness.Checks[CheckStorage] = domain.HealthCheck{Status: domain.CheckSkipped}
+	}
+	run(CheckQuery, func() error {
+		now := time.Now().UTC()
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE timestamp >= ? AND timestamp < ?", r.getParquetSource(nil))
+		var count int64
+		return r.db.QueryRowContext(ctx, query, now.Add(-time.Minute), now).Scan(&count)
+	})
+	return readiness
+}
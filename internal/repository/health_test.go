@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+)
+
+func TestCheckReadiness(t *testing.T) {
+	tests := []struct {
+		name     string
+		parquet  bool
+		breakIt  func(t *testing.T, repo *eventRepository, dir string)
+		expected map[string]string // Status by check
+	}{
+		{
+			name:     "Table backend",
+			expected: map[string]string{CheckDatabase: domain.CheckOK, CheckStorage: domain.CheckSkipped, CheckQuery: domain.CheckOK},
+		},
+		{
+			name:     "Parquet backend",
+			parquet:  true,
+			expected: map[string]string{CheckDatabase: domain.CheckOK, CheckStorage: domain.CheckOK, CheckQuery: domain.CheckOK},
+		},
+		{
+			name:    "Data directory gone",
+			parquet: true,
+			breakIt: func(t *testing.T, repo *eventRepository, dir string) {
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatalf("Failed to remove data directory: %v", err)
+				}
+			},
+			expected: map[string]string{CheckDatabase: domain.CheckOK, CheckStorage: domain.CheckFailed, CheckQuery: domain.CheckOK},
+		},
+		{
+			name:    "Unreadable Parquet file",
+			parquet: true,
+			breakIt: func(t *testing.T, repo *eventRepository, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "events_corrupt.parquet"), []byte("not parquet"), 0644); err != nil {
+					t.Fatalf("Failed to write file: %v", err)
+				}
+			},
+			expected: map[string]string{CheckDatabase: domain.CheckOK, CheckStorage: domain.CheckOK, CheckQuery: domain.CheckFailed},
+		},
+		{
+			name: "Database closed",
+			breakIt: func(t *testing.T, repo *eventRepository, dir string) {
+				if err := repo.db.Close(); err != nil {
+					t.Fatalf("Failed to close database: %v", err)
+				}
+			},
+			expected: map[string]string{CheckDatabase: domain.CheckFailed, CheckStorage: domain.CheckSkipped, CheckQuery: domain.CheckFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t).(*eventRepository)
+			dir := t.TempDir()
+			if tt.parquet {
+				ps, err := storage.NewParquetStorage(repo.db, dir, 0, time.Hour)
+				if err != nil {
+					t.Fatalf("Failed to create Parquet storage: %v", err)
+				}
+				repo.parquetStorage = ps
+			}
+			if tt.breakIt != nil {
+				tt.breakIt(t, repo, dir)
+			}
+
+			readiness := repo.CheckReadiness(t.Context())
+			for name, expected := range tt.expected {
+				check := readiness.Checks[name]
+				if check.Status != expected {
+					t.Errorf("Check %s: expected %s, got %s (%s)", name, expected, check.Status, check.Error)
+				}
+				if (check.Status == domain.CheckFailed) != (check.Error != "") {
+					t.Errorf("Check %s: expected an error exactly when failed, got %+v", name, check)
+				}
+			}
+			if ready := readiness.Ready(); ready != (tt.breakIt == nil) {
+				t.Errorf("Expected ready to be %v, got %v", tt.breakIt == nil, ready)
+			}
+		})
+	}
+}
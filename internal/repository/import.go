@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// importCSVSource reads every value of an import file as text, so a value that
+// does not parse fails only its own row, see domain.ParseImportRow. The reader is
+// strict: a row with the wrong number of values fails the file instead of being
+// padded, and the sniffer may not skip leading rows it cannot make sense of.
+func importCSVSource(path string) string {
+	return fmt.Sprintf(`read_csv('%s', header=true, all_varchar=true, delim=',', quote='"', escape='"', skip=0, strict_mode=true, null_padding=false)`, sqlString(path))
+}
+
+// ReadCSV streams the rows of the CSV file at path through DuckDB, in file order,
+// calling fn with the header and each row's values; empty values are "". The whole
+// file is checked to be well-formed CSV before the first row is passed on, so a
+// malformed file fails with domain.ErrInvalidImport having passed on nothing.
+func (r *eventRepository) ReadCSV(ctx context.Context, path string, fn func(header, values []string) error) error {
+	source := importCSVSource(path)
+
+	// hash(t) makes DuckDB parse every column, not just count the lines
+	var rowCount int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM (SELECT * FROM "+source+") AS t WHERE hash(t) IS NOT NULL").Scan(&rowCount); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %v", domain.ErrInvalidImport, err)
+	}
+	if rowCount == 0 {
+		return nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT * FROM "+source)
+	if err != nil {
+		return fmt.Errorf("failed to read import file: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	header, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to read import header: %w", err)
+	}
+	scanned := make([]sql.NullString, len(header))
+	dest := make([]interface{}, len(header))
+	for i := range scanned {
+		dest[i] = &scanned[i]
+	}
+	values := make([]string, len(header))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to read import row: %w", err)
+		}
+		for i, value := range scanned {
+			values[i] = value.String
+		}
+		if err := fn(header, values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read import file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestReadCSV(t *testing.T) {
+	repo := newTestRepository(t).(*eventRepository)
+
+	tests := []struct {
+		name     string
+		content  string
+		expected [][]string
+		wantErr  error
+	}{
+		{
+			name:     "Rows in file order",
+			content:  "timestamp,event_name,url\n2024-03-01T10:00:00Z,page_view,/\n2024-03-01T09:00:00Z,\"sign,up\",\n",
+			expected: [][]string{{"2024-03-01T10:00:00Z", "page_view", "/"}, {"2024-03-01T09:00:00Z", "sign,up", ""}},
+		},
+		{
+			name:    "Header only",
+			content: "timestamp,event_name\n",
+		},
+		{
+			name:    "Ragged row",
+			content: "timestamp,event_name\n2024-03-01T10:00:00Z,page_view\n2024-03-01T10:00:00Z,page_view,extra,values\n",
+			wantErr: domain.ErrInvalidImport,
+		},
+		{
+			name:    "Ragged row past the sniffed sample",
+			content: "timestamp,event_name\n" + strings.Repeat("2024-03-01T10:00:00Z,page_view\n", 30000) + "2024-03-01T10:00:00Z,page_view,extra\n",
+			wantErr: domain.ErrInvalidImport,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "import.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write import file: %v", err)
+			}
+
+			var rows [][]string
+			err := repo.ReadCSV(t.Context(), path, func(header, values []string) error {
+				if !reflect.DeepEqual(header[:2], []string{"timestamp", "event_name"}) {
+					t.Errorf("Unexpected header %v", header)
+				}
+				rows = append(rows, append([]string(nil), values...))
+				return nil
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+				if len(rows) != 0 {
+					t.Errorf("Expected no rows from a malformed file, got %v", rows)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCSV failed: %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// GetLifetimeUniqueUsers counts the distinct users across every stored event.
+// Parquet storage estimates it from its user sketch without touching the files;
+// the table backend, or Parquet storage while its sketch is being rebuilt, counts
+// them exactly with a scan of the events instead.
+func (r *eventRepository) GetLifetimeUniqueUsers(ctx context.Context) (domain.LifetimeUsers, error) {
+	if r.parquetStorage != nil {
+		if users, ok := r.parquetStorage.UniqueUsers(); ok {
+			return domain.LifetimeUsers{UniqueUsers: int64(users), Source: domain.LifetimeSourceSketch}, nil
+		}
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(DISTINCT user_id)
+		FROM %s
+		WHERE user_id IS NOT NULL AND user_id != ''
+	`, r.getParquetSource(nil))
+	lifetime := domain.LifetimeUsers{Source: domain.LifetimeSourceScan}
+	if err := r.db.QueryRowContext(ctx, query).Scan(&lifetime.UniqueUsers); err != nil {
+		return domain.LifetimeUsers{}, fmt.Errorf("failed to count lifetime users: %w", err)
+	}
+	return lifetime, nil
+}
+
+// RebuildUserSketch recomputes the user sketch of Parquet storage from its files,
+// returning domain.ErrNoUserSketch under the table backend
+func (r *eventRepository) RebuildUserSketch(ctx context.Context) error {
+	if r.parquetStorage == nil {
+		return domain.ErrNoUserSketch
+	}
+	return r.parquetStorage.RebuildUserSketch(ctx)
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+)
+
+func TestGetLifetimeUniqueUsers(t *testing.T) {
+	for _, parquet := range []bool{false, true} {
+		t.Run(fmt.Sprintf("parquet=%v", parquet), func(t *testing.T) {
+			repo := newTestRepository(t).(*eventRepository)
+			expectedSource := domain.LifetimeSourceScan
+			if parquet {
+				ps, err := storage.NewParquetStorage(repo.db, t.TempDir(), 0, time.Hour)
+				if err != nil {
+					t.Fatalf("Failed to create Parquet storage: %v", err)
+				}
+				repo.parquetStorage = ps
+				expectedSource = domain.LifetimeSourceSketch
+			}
+
+			var events []domain.Event
+			for i := 0; i < 40; i++ {
+				events = append(events, domain.Event{Timestamp: time.Now(), EventName: "page_view", UserID: fmt.Sprintf("u%d", i%25)})
+			}
+			if err := repo.CreateBatch(events); err != nil {
+				t.Fatalf("CreateBatch failed: %v", err)
+			}
+			if _, err := repo.FlushSync(); err != nil {
+				t.Fatalf("FlushSync failed: %v", err)
+			}
+
+			lifetime, err := repo.GetLifetimeUniqueUsers(t.Context())
+			if err != nil {
+				t.Fatalf("GetLifetimeUniqueUsers failed: %v", err)
+			}
+			if lifetime.Source != expectedSource {
+				t.Errorf("Expected source %q, got %q", expectedSource, lifetime.Source)
+			}
+			// The scan is exact; the sketch is an estimate, see internal/hll
+			tolerance := 0.0
+			if parquet {
+				tolerance = 0.05
+			}
+			if diff := math.Abs(float64(lifetime.UniqueUsers - 25)); diff > 25*tolerance {
+				t.Errorf("Expected about 25 users, got %d", lifetime.UniqueUsers)
+			}
+
+			err = repo.RebuildUserSketch(t.Context())
+			if parquet && err != nil {
+				t.Errorf("RebuildUserSketch failed: %v", err)
+			}
+			if !parquet && !errors.Is(err, domain.ErrNoUserSketch) {
+				t.Errorf("Expected ErrNoUserSketch under the table backend, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/mohamedelhefni/siraaj/internal/urlpattern"
+)
+
+// stripQuery reports whether pages are reported without their query string and
+// fragment: the strip_query filter, then STRIP_QUERY=1, defaulting to full URLs
+func stripQuery(filters map[string]string) bool {
+	if strip, err := strconv.ParseBool(filters["strip_query"]); err == nil {
+		return strip
+	}
+	return os.Getenv("STRIP_QUERY") == "1"
+}
+
+// pageSQL is column as pages are reported: without its query string and fragment
+// when stripQuery, then rewritten by the URL patterns
+func pageSQL(column string, filters map[string]string) string {
+	if stripQuery(filters) {
+		column = fmt.Sprintf("split_part(split_part(%s, '#', 1), '?', 1)", column)
+	}
+	return urlpattern.SQL(column)
+}
+
+// pageCondition is the condition of the page filter on column with its arguments.
+// It matches a page as listed by the top pages, or a raw URL as listed when
+// drilling down into one.
+func pageCondition(column, page string, filters map[string]string) (string, []interface{}) {
+	reported := pageSQL(column, filters)
+	if reported == column {
+		return column + " = ?", []interface{}{page}
+	}
+	return fmt.Sprintf("(%s = ? OR %s = ?)", column, reported), []interface{}{page, page}
+}
+
+// topPagesColumn is what the top, entry and exit pages are grouped by: the page as
+// reported, or the raw URLs when a page filter drills down into one
+func topPagesColumn(filters map[string]string) string {
+	if filters["page"] != "" {
+		return "url"
+	}
+	return pageSQL("url", filters)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/urlpattern"
+)
+
+func TestPageCondition(t *testing.T) {
+	stripped := "split_part(split_part(url, '#', 1), '?', 1)"
+
+	tests := []struct {
+		name      string
+		env       string
+		filters   map[string]string
+		condition string
+		args      int
+	}{
+		{"Full URLs by default", "", map[string]string{}, "url = ?", 1},
+		{"Strip query filter", "", map[string]string{"strip_query": "1"}, "(url = ? OR " + stripped + " = ?)", 2},
+		{"Strip query from env", "1", map[string]string{}, "(url = ? OR " + stripped + " = ?)", 2},
+		{"Filter overrides env", "1", map[string]string{"strip_query": "false"}, "url = ?", 1},
+		{"Invalid filter falls back to env", "1", map[string]string{"strip_query": "maybe"}, "(url = ? OR " + stripped + " = ?)", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STRIP_QUERY", tt.env)
+			condition, args := pageCondition("url", "/search", tt.filters)
+			if condition != tt.condition {
+				t.Errorf("Expected condition %s, got %s", tt.condition, condition)
+			}
+			if len(args) != tt.args {
+				t.Errorf("Expected %d args, got %d", tt.args, len(args))
+			}
+		})
+	}
+}
+
+func TestTopPagesColumn(t *testing.T) {
+	t.Setenv("STRIP_QUERY", "1")
+	if err := urlpattern.Set([]urlpattern.Rule{{Pattern: `/\d+\b`, Template: "/:id"}}); err != nil {
+		t.Fatalf("Failed to set URL patterns: %v", err)
+	}
+	t.Cleanup(func() { _ = urlpattern.Set(nil) })
+
+	// Patterns apply to the stripped path
+	expected := `regexp_replace(split_part(split_part(url, '#', 1), '?', 1), '/\d+\b', '/:id', 'g')`
+	if got := topPagesColumn(map[string]string{}); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	// Drilling down lists the raw URLs
+	if got := topPagesColumn(map[string]string{"page": "/product/:id"}); got != "url" {
+		t.Errorf("Expected raw URLs when drilling down, got %s", got)
+	}
+}
@@ -0,0 +1,363 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// placeholders counts the ? placeholders of query, skipping those inside string
+// literals such as the referrer domain regex
+func placeholders(query string) int {
+	count, quoted := 0, false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			count++
+		}
+	}
+	return count
+}
+
+// checkPlaceholders fails the test when query has not exactly one argument per
+// placeholder
+func checkPlaceholders(t *testing.T, name string, query statsQuery) {
+	t.Helper()
+	if n := placeholders(query.query); n != len(query.args) {
+		t.Errorf("%s: %d placeholders but %d arguments %v in %s", name, n, len(query.args), query.args, query.query)
+	}
+}
+
+// queryFilterSets are filter combinations every stats query builder must handle
+var queryFilterSets = []map[string]string{
+	{},
+	{"project": "web"},
+	{"project": "web", "source": "google.com", "country": "EG"},
+	{"browser": "Firefox", "device": "Desktop", "os": "Linux", "event": "signup"},
+	{"page": "/blog", "strip_query": "true", "user_id": "u1", "session_id": "s1"},
+	{"page": "/pricing", "source": "github.com", "botFilter": "human", "exact": "1"},
+	{"metric": "bounce_rate", "bounce_mode": domain.BounceSingleEvent, "tz": "Africa/Cairo"},
+	{"metric": "visit_duration", "time_basis": domain.TimeBasisReceived},
+	{"metric": "views_per_visit", "offset": "50", "sort": "name", "order": "desc"},
+}
+
+func TestPlaceholders(t *testing.T) {
+	if n := placeholders(`url LIKE ? ESCAPE '\' AND regexp_matches(referrer, '^(?:www\.)?') AND x = ?`); n != 2 {
+		t.Errorf("Expected 2 placeholders outside literals, got %d", n)
+	}
+}
+
+func TestBuildWhereClause(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		filters        map[string]string
+		expectedArgs   []interface{}
+		expectedClause []string
+		unexpected     string
+	}{
+		{
+			name:           "Date range only",
+			filters:        map[string]string{},
+			expectedArgs:   []interface{}{start, end},
+			expectedClause: []string{"date_day >= CAST(? AS DATE) AND date_day <= CAST(? AS DATE)"},
+		},
+		{
+			name:           "Filters in a fixed order",
+			filters:        map[string]string{"os": "Linux", "country": "EG", "project": "web", "event": "signup"},
+			expectedArgs:   []interface{}{start, end, "web", "EG", "Linux", "signup"},
+			expectedClause: []string{"project_id = ? AND country = ? AND os = ? AND event_name = ?"},
+		},
+		{
+			name:           "Source matches the URL or its domain",
+			filters:        map[string]string{"source": "google.com", "device": "Mobile"},
+			expectedArgs:   []interface{}{start, end, "google.com", "google.com", "Mobile"},
+			expectedClause: []string{"(referrer = ? OR ", "device = ?"},
+		},
+		{
+			name:           "Stripped page matches both forms",
+			filters:        map[string]string{"page": "/blog", "strip_query": "true", "user_id": "u1"},
+			expectedArgs:   []interface{}{start, end, "/blog", "/blog", "u1"},
+			expectedClause: []string{"(url = ? OR ", "user_id = ?"},
+		},
+		{
+			name:           "Bot filter and metric add no arguments",
+			filters:        map[string]string{"botFilter": "bot", "metric": "page_views"},
+			expectedArgs:   []interface{}{start, end},
+			expectedClause: []string{"is_bot = TRUE", "event_name = 'page_view'"},
+		},
+		{
+			name:           "Unknown bot filter is ignored",
+			filters:        map[string]string{"botFilter": "robots"},
+			expectedArgs:   []interface{}{start, end},
+			expectedClause: []string{"date_day <= CAST(? AS DATE)"},
+			unexpected:     "is_bot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args := buildWhereClause(start, end, tt.filters)
+			if !reflect.DeepEqual(args, tt.expectedArgs) {
+				t.Errorf("Expected args %v, got %v", tt.expectedArgs, args)
+			}
+			for _, expected := range tt.expectedClause {
+				if !strings.Contains(clause, expected) {
+					t.Errorf("Expected %q in %s", expected, clause)
+				}
+			}
+			if tt.unexpected != "" && strings.Contains(clause, tt.unexpected) {
+				t.Errorf("Expected no %q in %s", tt.unexpected, clause)
+			}
+			checkPlaceholders(t, "where clause", statsQuery{query: clause, args: args})
+		})
+	}
+}
+
+func TestStatsQueryPlaceholders(t *testing.T) {
+	repo := &eventRepository{}
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ranges := []time.Time{start.Add(24 * time.Hour), start.AddDate(0, 1, 0), start.AddDate(1, 0, 0)}
+
+	for i, filters := range queryFilterSets {
+		t.Run(fmt.Sprintf("filters %d", i), func(t *testing.T) {
+			for _, end := range ranges {
+				checkPlaceholders(t, "top stats", topStatsQuery("events", start, end, filters))
+				checkPlaceholders(t, "previous top stats", previousTopStatsQuery("events", start, end, filters))
+				for _, metric := range domain.TimelineMetrics {
+					withMetric := map[string]string{"metric": metric}
+					for key, value := range filters {
+						if key != "metric" {
+							withMetric[key] = value
+						}
+					}
+					query, _ := timelineQuery("events", start, end, withMetric)
+					checkPlaceholders(t, "timeline "+metric, query)
+				}
+			}
+
+			end := start.AddDate(0, 1, 0)
+			whereClause, args := buildWhereClause(start, end, filters)
+			checkPlaceholders(t, "bounced sessions", statsQuery{query: bouncedSessionsQuery("events", whereClause, bounceMode(filters)), args: args})
+			for name, grouped := range map[string]statsQuery{
+				"pages":     repo.topPagesQuery(start, end, filters),
+				"countries": repo.topCountriesQuery(start, end, filters),
+				"languages": repo.topLanguagesQuery(start, end, filters),
+				"sources":   repo.topSourcesQuery(start, end, filters),
+				"events":    repo.topEventsQuery(start, end, filters),
+			} {
+				checkPlaceholders(t, name, grouped)
+				checkPlaceholders(t, name+" page", topListQuery(grouped, 50, filters, "country"))
+			}
+		})
+	}
+}
+
+func TestFunnelQueryPlaceholders(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+	steps := []domain.FunnelStep{
+		{EventName: "page_view", URL: "/pricing", Filters: map[string]string{"os": "Linux", "country": "EG"}},
+		{EventName: "signup", EventNames: []string{"register", "join"}, URLPattern: "/signup?step=*"},
+		{EventName: "purchase", Filters: map[string]string{"device": "Desktop", "browser": "Firefox", "language": "ar"}},
+	}
+	anyOrder := false
+
+	tests := []struct {
+		name    string
+		request domain.FunnelRequest
+	}{
+		{"No filters", domain.FunnelRequest{Steps: steps}},
+		{"Global filters", domain.FunnelRequest{Steps: steps, Filters: map[string]string{"project": "web", "source": "google.com", "channel": "Organic", "botFilter": "human"}}},
+		{"Conversion window", domain.FunnelRequest{Steps: steps, ConversionWindowHours: 24}},
+		{"Both windows in session scope", domain.FunnelRequest{Steps: steps, ConversionWindowHours: 2, MaxFunnelDuration: 48, Scope: domain.FunnelScopeSession, Filters: map[string]string{"country": "EG"}}},
+		{"Any order", domain.FunnelRequest{Steps: steps, StrictOrder: &anyOrder, Filters: map[string]string{"project": "web", "source": "google.com"}}},
+		{"Any order in session scope", domain.FunnelRequest{Steps: steps, StrictOrder: &anyOrder, Scope: domain.FunnelScopeSession}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := domain.ParseFunnelScope(tt.request.Scope)
+			if err != nil {
+				t.Fatalf("ParseFunnelScope failed: %v", err)
+			}
+			for i := range tt.request.Steps {
+				checkPlaceholders(t, fmt.Sprintf("step %d", i+1), funnelStepQuery("events", start, end, tt.request, scope, i))
+				if i < len(tt.request.Steps)-1 {
+					checkPlaceholders(t, fmt.Sprintf("time to step %d", i+2), funnelTimeToNextQuery("events", start, end, tt.request, scope, i))
+				}
+			}
+			checkPlaceholders(t, "completion", funnelCompletionQuery("events", start, end, tt.request, scope))
+			checkPlaceholders(t, "breakdown", funnelBreakdownQuery("events", funnelBreakdownColumns["source"], start, end, tt.request))
+		})
+	}
+}
+
+func TestFunnelStepQueryArgs(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+	request := domain.FunnelRequest{
+		Steps: []domain.FunnelStep{
+			{EventName: "page_view", Filters: map[string]string{"os": "Linux", "country": "EG"}},
+			{EventName: "signup", URL: "/signup"},
+		},
+		Filters:               map[string]string{"project": "web"},
+		ConversionWindowHours: 24,
+		MaxFunnelDuration:     72,
+	}
+
+	// Step CTEs in order, each with its join window before its WHERE arguments
+	query := funnelStepQuery("events", start, end, request, domain.FunnelScopeUser, 1)
+	expected := []interface{}{
+		start, end, "web", "page_view", "EG", "Linux",
+		24, 72, start, end, "web", "signup", "/signup",
+	}
+	if !reflect.DeepEqual(query.args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, query.args)
+	}
+	for _, fragment := range []string{
+		"step_1 AS (SELECT user_id, session_id, timestamp, timestamp AS first_timestamp FROM events WHERE timestamp BETWEEN ? AND ? AND project_id = ? AND event_name = ? AND country = ? AND os = ?)",
+		"INNER JOIN step_1 prev ON e.user_id = prev.user_id AND e.timestamp > prev.timestamp AND e.timestamp <= prev.timestamp + to_hours(CAST(? AS BIGINT)) AND e.timestamp <= prev.first_timestamp + to_hours(CAST(? AS BIGINT))",
+		"FROM step_2",
+	} {
+		if !strings.Contains(query.query, fragment) {
+			t.Errorf("Expected %q in %s", fragment, query.query)
+		}
+	}
+
+	// The step filters are added in the same order on every call
+	first := funnelStepQuery("events", start, end, request, domain.FunnelScopeUser, 0)
+	for i := 0; i < 10; i++ {
+		if again := funnelStepQuery("events", start, end, request, domain.FunnelScopeUser, 0); again.query != first.query || !reflect.DeepEqual(again.args, first.args) {
+			t.Fatalf("Expected the same query on every call, got %s with %v", again.query, again.args)
+		}
+	}
+}
+
+func TestFunnelAnyOrderQuery(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+	anyOrder := false
+	request := domain.FunnelRequest{
+		Steps: []domain.FunnelStep{
+			{EventName: "page_view", Filters: map[string]string{"country": "EG"}},
+			{EventName: "signup"},
+			{EventName: "purchase"},
+		},
+		Filters:     map[string]string{"project": "web"},
+		StrictOrder: &anyOrder,
+	}
+
+	// The user sets of every step so far intersect, then the step's events are counted
+	query := funnelStepQuery("events", start, end, request, domain.FunnelScopeUser, 2)
+	expected := []interface{}{
+		start, end, "web", "page_view", "EG",
+		start, end, "web", "signup",
+		start, end, "web", "purchase",
+		start, end, "web", "purchase",
+	}
+	if !reflect.DeepEqual(query.args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, query.args)
+	}
+	for _, fragment := range []string{
+		"SELECT user_id FROM events WHERE timestamp BETWEEN ? AND ? AND project_id = ? AND event_name = ? AND country = ?\n\t\t\tINTERSECT\n\t\t\tSELECT user_id FROM events",
+		"WHERE e.timestamp BETWEEN ? AND ? AND e.project_id = ? AND e.event_name = ? AND EXISTS (SELECT 1 FROM reached r WHERE r.user_id = e.user_id)",
+	} {
+		if !strings.Contains(query.query, fragment) {
+			t.Errorf("Expected %q in %s", fragment, query.query)
+		}
+	}
+	if strings.Contains(query.query, "e.timestamp > prev.timestamp") {
+		t.Errorf("Expected no ordering between steps, got %s", query.query)
+	}
+
+	session := funnelStepQuery("events", start, end, request, domain.FunnelScopeSession, 1)
+	for _, fragment := range []string{"SELECT user_id, session_id FROM events", "r.user_id = e.user_id AND r.session_id = e.session_id"} {
+		if !strings.Contains(session.query, fragment) {
+			t.Errorf("Expected %q in %s", fragment, session.query)
+		}
+	}
+
+	// The first step is the same in either mode
+	strict := request
+	strict.StrictOrder = nil
+	if first, strictFirst := funnelStepQuery("events", start, end, request, domain.FunnelScopeUser, 0), funnelStepQuery("events", start, end, strict, domain.FunnelScopeUser, 0); first.query != strictFirst.query {
+		t.Errorf("Expected the same first step, got %s and %s", first.query, strictFirst.query)
+	}
+}
+
+func TestTopStatsQuery(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	query := topStatsQuery("events", start, end, map[string]string{"country": "EG"})
+	if !strings.Contains(query.query, "APPROX_COUNT_DISTINCT(") {
+		t.Errorf("Expected approximate distinct counts, got %s", query.query)
+	}
+	_, args := buildWhereClause(start, end, map[string]string{"country": "EG"})
+	if !reflect.DeepEqual(query.args, args) {
+		t.Errorf("Expected the where clause arguments %v, got %v", args, query.args)
+	}
+
+	exact := topStatsQuery("events", start, end, map[string]string{"exact": "1"})
+	if strings.Contains(exact.query, "APPROX_COUNT_DISTINCT(") {
+		t.Errorf("Expected exact distinct counts, got %s", exact.query)
+	}
+}
+
+func TestTimelineQuery(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		end            time.Time
+		metric         string
+		expectedFormat string
+		expectedBucket string
+	}{
+		{"One day is hourly", start.Add(24 * time.Hour), "visits", "hour", "date_hour as date"},
+		{"A month is daily", start.AddDate(0, 1, 0), "page_views", "day", "date_day as date"},
+		{"A year is monthly", start.AddDate(1, 0, 0), "events", "month", "date_month as date"},
+		{"Bounce rate", start.AddDate(0, 1, 0), "bounce_rate", "day", "date_day"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, format := timelineQuery("events", start, tt.end, map[string]string{"metric": tt.metric})
+			if format != tt.expectedFormat {
+				t.Errorf("Expected format %q, got %q", tt.expectedFormat, format)
+			}
+			if !strings.Contains(query.query, tt.expectedBucket) {
+				t.Errorf("Expected the query to bucket by %q, got %s", tt.expectedBucket, query.query)
+			}
+			if strings.Count(query.query, "?") != len(query.args) {
+				t.Errorf("Expected an argument per placeholder, got %d for %s", len(query.args), query.query)
+			}
+		})
+	}
+}
+
+func TestTopListQuery(t *testing.T) {
+	grouped := statsQuery{query: "SELECT country as name, COUNT(*) as count FROM events WHERE project_id = ? GROUP BY country", args: []interface{}{"web"}}
+
+	page := topListQuery(grouped, 10, map[string]string{"offset": "20", "sort": "name"}, "country")
+	if !strings.Contains(page.query, "SELECT name, count, country, COUNT(*) OVER () AS total") {
+		t.Errorf("Expected the extra column selected, got %s", page.query)
+	}
+	if !strings.Contains(page.query, "ORDER BY name ASC, count DESC") {
+		t.Errorf("Expected the sort filter applied, got %s", page.query)
+	}
+	if expected := []interface{}{"web", 10, 20}; !reflect.DeepEqual(page.args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, page.args)
+	}
+	if len(grouped.args) != 1 {
+		t.Errorf("Expected the grouped arguments left alone, got %v", grouped.args)
+	}
+}
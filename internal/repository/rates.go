@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// minSampleSize returns the smallest denominator a rate is reported for, read from
+// RATE_MIN_SAMPLE. Zero (the default) reports every rate.
+func minSampleSize() int64 {
+	value, err := strconv.ParseInt(os.Getenv("RATE_MIN_SAMPLE"), 10, 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+// sampleRate returns numerator/denominator as a percentage. ok is false when the
+// denominator is below minSample, in which case the rate should not be shown.
+func sampleRate(numerator, denominator, minSample int64) (rate float64, ok bool) {
+	if denominator <= 0 || denominator < minSample {
+		return 0, false
+	}
+	return float64(numerator) / float64(denominator) * 100, true
+}
+
+// optionalRate returns numerator/denominator as a percentage: missing for an empty
+// denominator and null when the denominator is below minSample
+func optionalRate(numerator, denominator, minSample int64) domain.OptionalRate {
+	if denominator <= 0 {
+		return domain.OptionalRate{}
+	}
+	if rate, ok := sampleRate(numerator, denominator, minSample); ok {
+		return domain.RateOf(rate)
+	}
+	return domain.NullRate()
+}
+
+// optionalChange returns the percentage change from previous to current, for
+// metrics that are not counts. sample is what previous was measured on; below
+// minSample the change is null as with optionalRate. It is missing without a
+// previous value.
+func optionalChange(current, previous float64, sample, minSample int64) domain.OptionalRate {
+	if sample <= 0 || previous == 0 {
+		return domain.OptionalRate{}
+	}
+	if sample < minSample {
+		return domain.NullRate()
+	}
+	return domain.RateOf((current - previous) / previous * 100)
+}
+
+// setRate stores a rate in stats, or null plus an "insufficient_data" marker when
+// the denominator is too small. Nothing is stored for an empty denominator.
+func setRate(stats map[string]interface{}, key string, numerator, denominator, minSample int64) {
+	setOptional(stats, key, optionalRate(numerator, denominator, minSample))
+}
+
+// setChange stores the change optionalChange computes in stats like setRate
+func setChange(stats map[string]interface{}, key string, current, previous float64, sample, minSample int64) {
+	setOptional(stats, key, optionalChange(current, previous, sample, minSample))
+}
+
+// setOptional stores rate under key unless it is missing, marking a null rate
+func setOptional(stats map[string]interface{}, key string, rate domain.OptionalRate) {
+	switch {
+	case !rate.Set:
+	case rate.IsNull():
+		markInsufficient(stats, key)
+	default:
+		stats[key] = *rate.Value
+	}
+}
+
+// markInsufficient nulls key and lists it under "insufficient_data"
+func markInsufficient(stats map[string]interface{}, key string) {
+	stats[key] = nil
+	insufficient, _ := stats["insufficient_data"].([]string)
+	stats["insufficient_data"] = append(insufficient, key)
+}
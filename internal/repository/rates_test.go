@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSampleRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		numerator   int64
+		denominator int64
+		minSample   int64
+		expected    float64
+		ok          bool
+	}{
+		{"Threshold disabled", 1, 4, 0, 25, true},
+		{"Below threshold", 1, 3, 10, 0, false},
+		{"At threshold", 5, 10, 10, 50, true},
+		{"Above threshold", 30, 40, 10, 75, true},
+		{"Empty denominator", 0, 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, ok := sampleRate(tt.numerator, tt.denominator, tt.minSample)
+			if ok != tt.ok || rate != tt.expected {
+				t.Errorf("sampleRate(%d, %d, %d) = (%v, %v), expected (%v, %v)",
+					tt.numerator, tt.denominator, tt.minSample, rate, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSetRateSuppression(t *testing.T) {
+	stats := map[string]interface{}{}
+
+	setRate(stats, "bounce_rate", 2, 3, 10)
+	setRate(stats, "users_change", 5, 20, 10)
+	setRate(stats, "events_change", 5, 0, 10)
+
+	if v, ok := stats["bounce_rate"]; !ok || v != nil {
+		t.Errorf("Expected bounce_rate to be suppressed as nil, got %v", v)
+	}
+	if v := stats["users_change"]; v != 25.0 {
+		t.Errorf("Expected users_change to be 25, got %v", v)
+	}
+	if _, ok := stats["events_change"]; ok {
+		t.Error("Expected events_change to be omitted for an empty denominator")
+	}
+
+	insufficient, _ := stats["insufficient_data"].([]string)
+	if len(insufficient) != 1 || insufficient[0] != "bounce_rate" {
+		t.Errorf("Expected insufficient_data to be [bounce_rate], got %v", insufficient)
+	}
+}
+
+func TestSetChange(t *testing.T) {
+	stats := map[string]interface{}{}
+
+	setChange(stats, "views_per_visit_change", 3, 2, 40, 10)
+	setChange(stats, "small_change", 3, 2, 5, 10)
+	setChange(stats, "new_change", 3, 0, 40, 10)
+	setChange(stats, "empty_change", 3, 2, 0, 10)
+
+	if v := stats["views_per_visit_change"]; v != 50.0 {
+		t.Errorf("Expected views_per_visit_change to be 50, got %v", v)
+	}
+	if v, ok := stats["small_change"]; !ok || v != nil {
+		t.Errorf("Expected small_change to be suppressed as nil, got %v", v)
+	}
+	for _, key := range []string{"new_change", "empty_change"} {
+		if _, ok := stats[key]; ok {
+			t.Errorf("Expected %s to be omitted without a previous value", key)
+		}
+	}
+	insufficient, _ := stats["insufficient_data"].([]string)
+	if len(insufficient) != 1 || insufficient[0] != "small_change" {
+		t.Errorf("Expected insufficient_data to be [small_change], got %v", insufficient)
+	}
+}
+
+func TestViewsPerVisit(t *testing.T) {
+	if got := viewsPerVisit(10, 4); got != 2.5 {
+		t.Errorf("Expected 2.5 views per visit, got %v", got)
+	}
+	if got := viewsPerVisit(0, 0); got != 0 {
+		t.Errorf("Expected 0 views per visit without sessions, got %v", got)
+	}
+}
+
+func TestMinSampleSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		expected int64
+	}{
+		{"Unset", "", 0},
+		{"Configured", "30", 30},
+		{"Invalid", "lots", 0},
+		{"Negative", "-5", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Setenv("RATE_MIN_SAMPLE", tt.env); err != nil {
+				t.Fatalf("Failed to set RATE_MIN_SAMPLE env: %v", err)
+			}
+			defer func() {
+				if err := os.Unsetenv("RATE_MIN_SAMPLE"); err != nil {
+					t.Logf("Warning: failed to unset RATE_MIN_SAMPLE env: %v", err)
+				}
+			}()
+
+			if got := minSampleSize(); got != tt.expected {
+				t.Errorf("minSampleSize() with %q = %d, expected %d", tt.env, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/geolocation"
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// continentTable is a VALUES list of lowercased country keys and their continents,
+// built from the geolocation country table, to join stored countries against
+var continentTable = func() string {
+	index := geolocation.ContinentIndex()
+	keys := make([]string, 0, len(index))
+	for key := range index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := make([]string, len(keys))
+	for i, key := range keys {
+		rows[i] = fmt.Sprintf("('%s', '%s')", sqlString(key), sqlString(index[key]))
+	}
+	return fmt.Sprintf("(VALUES %s) continents(country_key, continent)", strings.Join(rows, ", "))
+}()
+
+// sqlString escapes s for use inside a single-quoted SQL literal
+func sqlString(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// GetTopRegions returns a page of the top geographic areas at level, and the number
+// of areas. Continents are derived from the stored country, countries outside the
+// table count as "Unknown". Regions are listed with their country, since names such
+// as Georgia repeat across countries.
+func (r *eventRepository) GetTopRegions(ctx context.Context, startDate, endDate time.Time, level string, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	source := r.getStatsSource(filters)
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
+
+	switch level {
+	case domain.RegionLevelContinent:
+		grouped := fmt.Sprintf(`
+			SELECT COALESCE(continents.continent, '%s') as name, COUNT(*) as count 
+			FROM %s 
+			LEFT JOIN %s ON continents.country_key = lower(trim(country))
+			WHERE %s AND country IS NOT NULL AND country != ''
+			GROUP BY name
+		`, geolocation.UnknownContinent, source, continentTable, whereClause)
+		return r.queryTopList(ctx, statsQuery{query: grouped, args: args}, "name", limit, filters)
+
+	case domain.RegionLevelRegion:
+		grouped := fmt.Sprintf(`
+			SELECT region as name, COALESCE(country, '') as country, COUNT(*) as count 
+			FROM %s 
+			WHERE %s AND region IS NOT NULL AND region != ''
+			GROUP BY region, country
+		`, source, whereClause)
+		return r.queryTopList(ctx, statsQuery{query: grouped, args: args}, "name", limit, filters, "country")
+	}
+
+	return r.GetTopCountries(ctx, startDate, endDate, limit, filters)
+}
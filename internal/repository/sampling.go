@@ -0,0 +1,28 @@
+package repository
+
+import "math"
+
+// weightedEvents sums the events each stored event stands for under ingestion
+// sampling (SAMPLE_RATE). Rows written before sampling existed count once.
+const weightedEvents = "SUM(1.0 / COALESCE(NULLIF(sample_rate, 0), 1))"
+
+// sampleScale is the factor that turns counts of stored events into estimates of
+// all events: the events they stand for over the events stored. With one sample
+// rate over the range it is 1/rate. Sampling keeps or drops whole visitors, so
+// visitor and visit counts scale by the same factor; across a change of rate they
+// are scaled by the average, which weighs the rates by events rather than visitors.
+func sampleScale(storedEvents int, weighted float64) float64 {
+	if storedEvents == 0 || weighted <= float64(storedEvents) {
+		return 1
+	}
+	return weighted / float64(storedEvents)
+}
+
+// scaleCount scales a count of stored events or visitors by scale, rounding to the
+// nearest whole number
+func scaleCount(n int, scale float64) int {
+	if scale == 1 {
+		return n
+	}
+	return int(math.Round(float64(n) * scale))
+}
@@ -0,0 +1,46 @@
+package repository
+
+import "testing"
+
+func TestSampleScale(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   int
+		weighted float64
+		expected float64
+	}{
+		{"Not sampled", 1000, 1000, 1},
+		{"No events", 0, 0, 1},
+		{"One rate", 100, 1000, 10},
+		{"Half the range at 0.1", 200, 1100, 5.5}, // 100 events at 0.1 and 100 unsampled
+		{"Rows without a rate", 10, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sampleScale(tt.stored, tt.weighted); got != tt.expected {
+				t.Errorf("sampleScale(%d, %v) = %v, expected %v", tt.stored, tt.weighted, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScaleCount(t *testing.T) {
+	tests := []struct {
+		n        int
+		scale    float64
+		expected int
+	}{
+		{42, 1, 42},
+		{42, 10, 420},
+		{3, 1 / 0.3, 10},
+		{7, 1.5, 11}, // 10.5 rounds up
+		{0, 10, 0},
+	}
+
+	for _, tt := range tests {
+		if got := scaleCount(tt.n, tt.scale); got != tt.expected {
+			t.Errorf("scaleCount(%d, %v) = %d, expected %d", tt.n, tt.scale, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// screenBucketCase is a CASE expression naming the domain.ScreenBuckets bucket of
+// screen_width
+var screenBucketCase = func() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, bucket := range domain.ScreenBuckets {
+		if bucket.MaxWidth == 0 {
+			fmt.Fprintf(&b, " WHEN screen_width >= %d THEN '%s'", bucket.MinWidth, sqlString(bucket.Name))
+			continue
+		}
+		fmt.Fprintf(&b, " WHEN screen_width BETWEEN %d AND %d THEN '%s'", bucket.MinWidth, bucket.MaxWidth, sqlString(bucket.Name))
+	}
+	b.WriteString(" END")
+	return b.String()
+}()
+
+// GetScreenSizes returns the events and visitors of each screen width bucket, in
+// the order of domain.ScreenBuckets. Every bucket is listed, empty ones with zero
+// counts. Events without a screen width are left out.
+func (r *eventRepository) GetScreenSizes(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]map[string]interface{}, error) {
+	source := r.getStatsSource(filters)
+	whereClause, args := buildWhereClause(startDate, endDate, filters)
+
+	query := fmt.Sprintf(`
+		SELECT
+			%s as bucket,
+			COUNT(*) as events,
+			APPROX_COUNT_DISTINCT(user_id) as visitors
+		FROM %s
+		WHERE %s AND screen_width > 0
+		GROUP BY bucket
+	`, screenBucketCase, source, whereClause)
+
+	rows, err := r.db.QueryContext(ctx, distinctCounts(query, domain.ExactCounts(filters)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get screen sizes: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	type counts struct{ events, visitors int }
+	byBucket := map[string]counts{}
+	totalEvents := 0
+	for rows.Next() {
+		var bucket string
+		var c counts
+		if err := rows.Scan(&bucket, &c.events, &c.visitors); err != nil {
+			return nil, fmt.Errorf("failed to scan screen sizes: %w", err)
+		}
+		byBucket[bucket] = c
+		totalEvents += c.events
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get screen sizes: %w", err)
+	}
+
+	sizes := make([]map[string]interface{}, 0, len(domain.ScreenBuckets))
+	for _, bucket := range domain.ScreenBuckets {
+		c := byBucket[bucket.Name]
+		var maxWidth interface{}
+		if bucket.MaxWidth > 0 {
+			maxWidth = bucket.MaxWidth
+		}
+		percentage := 0.0
+		if totalEvents > 0 {
+			percentage = float64(c.events) / float64(totalEvents) * 100
+		}
+		sizes = append(sizes, map[string]interface{}{
+			"bucket":     bucket.Name,
+			"min_width":  bucket.MinWidth,
+			"max_width":  maxWidth,
+			"events":     c.events,
+			"visitors":   c.visitors,
+			"percentage": percentage,
+		})
+	}
+	return sizes, nil
+}
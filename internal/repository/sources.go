@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// referrerDomainSQL is column reduced to its bare domain, the SQL twin of
+// domain.NormalizeReferrer. Empty and missing referrers give an empty string.
+func referrerDomainSQL(column string) string {
+	return fmt.Sprintf(`regexp_replace(lower(regexp_extract(trim(COALESCE(%s, '')), '%s', 1)), '^www\.|\.$', '', 'g')`,
+		column, domain.ReferrerHostPattern)
+}
+
+// sourceCondition is the condition of the source filter on column, taking two
+// copies of the filter value. It matches a domain as listed by the top sources, or
+// a full referrer URL as listed when drilling down into one.
+func sourceCondition(column string) string {
+	return fmt.Sprintf("(%s = ? OR %s = ?)", column, referrerDomainSQL(column))
+}
+
+// topSourcesColumn is what the top sources are grouped by: the referrer domain, or
+// the full referrer URLs when a source filter drills down into one domain
+func topSourcesColumn(filters map[string]string) string {
+	if filters["source"] != "" {
+		return "referrer"
+	}
+	return referrerDomainSQL("referrer")
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+)
+
+// GetStorageStats describes the stored events: under Parquet storage its files,
+// sizes and buffer, under the table backend the events table
+func (r *eventRepository) GetStorageStats(ctx context.Context) (domain.StorageStats, error) {
+	if r.parquetStorage != nil {
+		stats, err := r.parquetStorage.Stats(ctx)
+		stats.Backend = string(storage.BackendParquet)
+		return stats, err
+	}
+
+	stats := domain.StorageStats{Backend: string(storage.BackendTable), Files: []domain.StorageFile{}}
+	var oldest, newest sql.NullTime
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*), MIN(timestamp), MAX(timestamp) FROM events").
+		Scan(&stats.TotalEvents, &oldest, &newest); err != nil {
+		return domain.StorageStats{}, fmt.Errorf("failed to count events: %w", err)
+	}
+	if oldest.Valid {
+		t := oldest.Time.UTC()
+		stats.OldestEvent = &t
+	}
+	if newest.Valid {
+		t := newest.Time.UTC()
+		stats.NewestEvent = &t
+	}
+	return stats, nil
+}
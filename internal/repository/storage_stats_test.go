@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+)
+
+func TestGetStorageStats(t *testing.T) {
+	for _, parquet := range []bool{false, true} {
+		t.Run(fmt.Sprintf("parquet=%v", parquet), func(t *testing.T) {
+			repo := newTestRepository(t).(*eventRepository)
+			expectedBackend := storage.BackendTable
+			if parquet {
+				ps, err := storage.NewParquetStorage(repo.db, t.TempDir(), 0, time.Hour)
+				if err != nil {
+					t.Fatalf("Failed to create Parquet storage: %v", err)
+				}
+				repo.parquetStorage = ps
+				expectedBackend = storage.BackendParquet
+			}
+
+			oldest := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+			newest := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+			if err := repo.CreateBatch([]domain.Event{
+				{Timestamp: newest, EventName: "page_view", ProjectID: "web"},
+				{Timestamp: oldest, EventName: "page_view", ProjectID: "web"},
+				{Timestamp: oldest, EventName: "signup", ProjectID: "app"},
+			}); err != nil {
+				t.Fatalf("CreateBatch failed: %v", err)
+			}
+			if _, err := repo.FlushSync(); err != nil {
+				t.Fatalf("FlushSync failed: %v", err)
+			}
+
+			stats, err := repo.GetStorageStats(t.Context())
+			if err != nil {
+				t.Fatalf("GetStorageStats failed: %v", err)
+			}
+			if stats.Backend != string(expectedBackend) || stats.TotalEvents != 3 {
+				t.Errorf("Expected 3 events under %s, got %+v", expectedBackend, stats)
+			}
+			if stats.OldestEvent == nil || !stats.OldestEvent.Equal(oldest) || stats.NewestEvent == nil || !stats.NewestEvent.Equal(newest) {
+				t.Errorf("Expected events from %v to %v, got %v to %v", oldest, newest, stats.OldestEvent, stats.NewestEvent)
+			}
+
+			if !parquet {
+				if stats.FileCount != 0 || len(stats.Files) != 0 || stats.Buffer != nil {
+					t.Errorf("Expected no files or buffer under the table backend, got %+v", stats)
+				}
+				return
+			}
+			// One file per project partition
+			if stats.FileCount != 2 || len(stats.Files) != 2 {
+				t.Fatalf("Expected 2 files, got %+v", stats.Files)
+			}
+			var rows, bytes int64
+			for _, file := range stats.Files {
+				if file.RowGroups != 1 || file.Bytes == 0 {
+					t.Errorf("Expected one row group and a size for %s, got %+v", file.Path, file)
+				}
+				rows += file.Rows
+				bytes += file.Bytes
+			}
+			if rows != 3 || bytes != stats.TotalBytes {
+				t.Errorf("Expected file rows and sizes to add up, got %d rows and %d of %d bytes", rows, bytes, stats.TotalBytes)
+			}
+			if stats.Buffer == nil || stats.Buffer.Events != 0 || stats.Buffer.FlushSize != storage.DefaultBufferSize {
+				t.Errorf("Expected an empty buffer of the default size, got %+v", stats.Buffer)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// topListOrder is the ORDER BY of a top list: the sort filter picks "count"
+// (default) or "name", and order picks "asc" or "desc", defaulting to the largest
+// counts and to names from A to Z. The other column breaks ties so pages do not
+// overlap.
+func topListOrder(filters map[string]string) string {
+	sortBy, tieBreak := "count", "name ASC"
+	order := "DESC"
+	if filters["sort"] == "name" {
+		sortBy, tieBreak = "name", "count DESC"
+		order = "ASC"
+	}
+	switch filters["order"] {
+	case "asc":
+		order = "ASC"
+	case "desc":
+		order = "DESC"
+	}
+	return fmt.Sprintf("%s %s, %s", sortBy, order, tieBreak)
+}
+
+// topListOffset is the offset filter, 0 when missing or invalid
+func topListOffset(filters map[string]string) int {
+	if offset, err := strconv.Atoi(filters["offset"]); err == nil && offset > 0 {
+		return offset
+	}
+	return 0
+}
+
+// topListQuery is one page of grouped, a query of name and count columns grouped
+// by name, with the number of names across all pages as a total column. Extra
+// columns of grouped are selected after count.
+func topListQuery(grouped statsQuery, limit int, filters map[string]string, extra ...string) statsQuery {
+	columns := "name, count"
+	for _, column := range extra {
+		columns += ", " + column
+	}
+	query := fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER () AS total
+		FROM (%s) grouped
+		ORDER BY %s
+		LIMIT ? OFFSET ?
+	`, columns, grouped.query, topListOrder(filters))
+
+	args := append(append([]interface{}{}, grouped.args...), limit, topListOffset(filters))
+	return statsQuery{query: query, args: args}
+}
+
+// queryTopList runs one page of grouped, see topListQuery, and returns it as
+// {key: name, "count": count} rows, along with the number of names across all
+// pages. Extra string columns of grouped are copied into the rows under their own
+// names.
+func (r *eventRepository) queryTopList(ctx context.Context, grouped statsQuery, key string, limit int, filters map[string]string, extra ...string) ([]map[string]interface{}, int, error) {
+	offset := topListOffset(filters)
+	page := topListQuery(grouped, limit, filters, extra...)
+	rows, err := r.db.QueryContext(ctx, page.query, page.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	items := []map[string]interface{}{}
+	total := 0
+	for rows.Next() {
+		var name string
+		var count int
+		values := make([]sql.NullString, len(extra))
+		dest := []interface{}{&name, &count}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(append(dest, &total)...); err != nil {
+			continue
+		}
+		item := map[string]interface{}{
+			key:     name,
+			"count": count,
+		}
+		for i, column := range extra {
+			item[column] = values[i].String
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// A page past the end has no rows to carry the total
+	if len(items) == 0 && offset > 0 {
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM (%s) grouped", grouped.query)
+		if err := r.db.QueryRowContext(ctx, countQuery, grouped.args...).Scan(&total); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return items, total, nil
+}
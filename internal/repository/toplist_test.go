@@ -0,0 +1,44 @@
+package repository
+
+import "testing"
+
+func TestTopListOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		filters  map[string]string
+		expected string
+	}{
+		{"Default", map[string]string{}, "count DESC, name ASC"},
+		{"Count ascending", map[string]string{"sort": "count", "order": "asc"}, "count ASC, name ASC"},
+		{"Name", map[string]string{"sort": "name"}, "name ASC, count DESC"},
+		{"Name descending", map[string]string{"sort": "name", "order": "desc"}, "name DESC, count DESC"},
+		{"Unknown sort", map[string]string{"sort": "country; DROP TABLE events"}, "count DESC, name ASC"},
+		{"Unknown order", map[string]string{"order": "sideways"}, "count DESC, name ASC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := topListOrder(tt.filters); got != tt.expected {
+				t.Errorf("topListOrder(%v) = %q, expected %q", tt.filters, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTopListOffset(t *testing.T) {
+	tests := []struct {
+		offset   string
+		expected int
+	}{
+		{"", 0},
+		{"50", 50},
+		{"-5", 0},
+		{"ten", 0},
+	}
+
+	for _, tt := range tests {
+		if got := topListOffset(map[string]string{"offset": tt.offset}); got != tt.expected {
+			t.Errorf("topListOffset(%q) = %d, expected %d", tt.offset, got, tt.expected)
+		}
+	}
+}
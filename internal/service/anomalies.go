@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// countMetrics are the timeline metrics where a missing bucket means zero. Rates
+// and averages have no value for an empty bucket, so their gaps are left alone.
+var countMetrics = map[string]bool{
+	"users":      true,
+	"visits":     true,
+	"page_views": true,
+	"events":     true,
+}
+
+// timelineLayouts are the date formats timeline buckets come back in
+var timelineLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// GetAnomalies flags the buckets of metric's timeline that are more than sigma
+// standard deviations from the rolling mean of the preceding window buckets. The
+// statistics run here over the GetTimeline result so they do not depend on the
+// database. sigma and window are read from filters, falling back to the defaults.
+func (s *eventService) GetAnomalies(ctx context.Context, startDate, endDate time.Time, filters map[string]string, metric string) (*domain.AnomalyResult, error) {
+	if metric == "" {
+		metric = "users"
+	}
+	sigma := domain.DefaultAnomalySigma
+	if value, err := strconv.ParseFloat(filters["sigma"], 64); err == nil && value > 0 {
+		sigma = value
+	}
+	window := domain.DefaultAnomalyWindow
+	if value, err := strconv.Atoi(filters["window"]); err == nil && value > 0 {
+		window = value
+	}
+
+	timelineFilters := make(map[string]string, len(filters)+1)
+	for key, value := range filters {
+		timelineFilters[key] = value
+	}
+	timelineFilters["metric"] = metric
+
+	timeline, err := s.repo.GetTimeline(ctx, startDate, endDate, timelineFilters)
+	if err != nil {
+		return nil, err
+	}
+	points, ok := timeline["timeline"].([]map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected timeline result %T", timeline["timeline"])
+	}
+	format, _ := timeline["timeline_format"].(string)
+
+	dates, values := timelineSeries(points)
+	if countMetrics[metric] {
+		dates, values = fillTimelineGaps(dates, values, format)
+	}
+
+	return &domain.AnomalyResult{
+		Metric:         metric,
+		TimelineFormat: format,
+		Sigma:          sigma,
+		Window:         window,
+		Buckets:        len(values),
+		Anomalies:      detectAnomalies(dates, values, window, sigma),
+	}, nil
+}
+
+// timelineSeries splits timeline points into their dates and values
+func timelineSeries(points []map[string]interface{}) ([]string, []float64) {
+	dates := make([]string, 0, len(points))
+	values := make([]float64, 0, len(points))
+	for _, point := range points {
+		date, _ := point["date"].(string)
+		value, _ := point["count"].(float64)
+		dates = append(dates, date)
+		values = append(values, value)
+	}
+	return dates, values
+}
+
+// fillTimelineGaps inserts zero buckets for the hours, days or months with no
+// events, so a drop to nothing is seen as one. The series is returned unchanged
+// when its dates cannot be parsed.
+func fillTimelineGaps(dates []string, values []float64, format string) ([]string, []float64) {
+	if len(dates) < 2 {
+		return dates, values
+	}
+
+	var step func(time.Time) time.Time
+	switch format {
+	case "hour":
+		step = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case "day":
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "month":
+		step = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return dates, values
+	}
+
+	times := make([]time.Time, len(dates))
+	for i, date := range dates {
+		t, ok := parseTimelineDate(date)
+		if !ok {
+			return dates, values
+		}
+		times[i] = t
+	}
+
+	filledDates := []string{dates[0]}
+	filledValues := []float64{values[0]}
+	for i := 1; i < len(times); i++ {
+		for t := step(times[i-1]); t.Before(times[i]); t = step(t) {
+			filledDates = append(filledDates, t.Format(timelineLayoutOf(dates[i])))
+			filledValues = append(filledValues, 0)
+		}
+		filledDates = append(filledDates, dates[i])
+		filledValues = append(filledValues, values[i])
+	}
+	return filledDates, filledValues
+}
+
+func parseTimelineDate(date string) (time.Time, bool) {
+	for _, layout := range timelineLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timelineLayoutOf returns the layout date is written in, so filled buckets match
+func timelineLayoutOf(date string) string {
+	for _, layout := range timelineLayouts {
+		if _, err := time.Parse(layout, date); err == nil {
+			return layout
+		}
+	}
+	return time.RFC3339
+}
+
+// detectAnomalies compares each value with the mean and standard deviation of the
+// window values before it. Buckets with fewer than MinAnomalyHistory predecessors,
+// or a perfectly flat history, are not judged.
+func detectAnomalies(dates []string, values []float64, window int, sigma float64) []domain.AnomalyPoint {
+	anomalies := []domain.AnomalyPoint{}
+	for i := range values {
+		from := i - window
+		if from < 0 {
+			from = 0
+		}
+		history := values[from:i]
+		if len(history) < domain.MinAnomalyHistory {
+			continue
+		}
+
+		mean, stddev := meanStddev(history)
+		if stddev == 0 {
+			continue
+		}
+		deviation := (values[i] - mean) / stddev
+		if math.Abs(deviation) <= sigma {
+			continue
+		}
+
+		direction := "spike"
+		if deviation < 0 {
+			direction = "drop"
+		}
+		anomalies = append(anomalies, domain.AnomalyPoint{
+			Date:      dates[i],
+			Value:     values[i],
+			Expected:  mean,
+			Lower:     mean - sigma*stddev,
+			Upper:     mean + sigma*stddev,
+			Deviation: deviation,
+			Direction: direction,
+		})
+	}
+	return anomalies
+}
+
+// meanStddev returns the mean and sample standard deviation of values
+func meanStddev(values []float64) (mean, stddev float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)-1))
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func dayTimeline(counts ...float64) map[string]interface{} {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeline := []map[string]interface{}{}
+	for i, count := range counts {
+		timeline = append(timeline, map[string]interface{}{
+			"date":  start.AddDate(0, 0, i).Format(time.RFC3339),
+			"count": count,
+		})
+	}
+	return map[string]interface{}{"timeline": timeline, "timeline_format": "day"}
+}
+
+func TestGetAnomalies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 10, 23, 59, 59, 0, time.UTC)
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTimeline(gomock.Any(), start, end, map[string]string{"project": "web", "metric": "visits"}).
+		Return(dayTimeline(10, 12, 11, 9, 10, 11, 50, 10, 0, 11), nil)
+
+	result, err := NewEventService(mockRepo).GetAnomalies(t.Context(), start, end, map[string]string{"project": "web"}, "visits")
+	if err != nil {
+		t.Fatalf("GetAnomalies failed: %v", err)
+	}
+
+	if result.Metric != "visits" || result.TimelineFormat != "day" || result.Sigma != 3 || result.Window != 7 {
+		t.Errorf("Unexpected result settings: %+v", result)
+	}
+	if len(result.Anomalies) != 1 {
+		t.Fatalf("Expected 1 anomaly, got %+v", result.Anomalies)
+	}
+	spike := result.Anomalies[0]
+	if spike.Value != 50 || spike.Direction != "spike" || spike.Deviation <= 3 {
+		t.Errorf("Unexpected spike: %+v", spike)
+	}
+	if math.Abs(spike.Expected-10.5) > 1e-9 || spike.Lower >= spike.Expected || spike.Upper <= spike.Expected {
+		t.Errorf("Unexpected expected range: %+v", spike)
+	}
+}
+
+func TestGetAnomaliesOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 10, 23, 59, 59, 0, time.UTC)
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTimeline(gomock.Any(), start, end, gomock.Any()).
+		Return(dayTimeline(10, 12, 11, 9, 10, 11, 2), nil)
+
+	result, err := NewEventService(mockRepo).GetAnomalies(t.Context(), start, end, map[string]string{"sigma": "2", "window": "3"}, "")
+	if err != nil {
+		t.Fatalf("GetAnomalies failed: %v", err)
+	}
+	if result.Metric != "users" || result.Sigma != 2 || result.Window != 3 {
+		t.Errorf("Unexpected result settings: %+v", result)
+	}
+	if len(result.Anomalies) != 1 || result.Anomalies[0].Direction != "drop" {
+		t.Errorf("Expected one drop, got %+v", result.Anomalies)
+	}
+}
+
+func TestFillTimelineGaps(t *testing.T) {
+	dates := []string{"2024-01-01 00:00:00", "2024-01-04 00:00:00"}
+	filledDates, filledValues := fillTimelineGaps(dates, []float64{5, 7}, "day")
+
+	expectedDates := []string{"2024-01-01 00:00:00", "2024-01-02 00:00:00", "2024-01-03 00:00:00", "2024-01-04 00:00:00"}
+	expectedValues := []float64{5, 0, 0, 7}
+	if len(filledDates) != len(expectedDates) {
+		t.Fatalf("Expected %v, got %v", expectedDates, filledDates)
+	}
+	for i := range expectedDates {
+		if filledDates[i] != expectedDates[i] || filledValues[i] != expectedValues[i] {
+			t.Errorf("Bucket %d: expected %s=%v, got %s=%v", i, expectedDates[i], expectedValues[i], filledDates[i], filledValues[i])
+		}
+	}
+
+	// Unparseable dates are left alone
+	unparsed, _ := fillTimelineGaps([]string{"a", "b"}, []float64{1, 2}, "day")
+	if len(unparsed) != 2 {
+		t.Errorf("Expected unparseable series unchanged, got %v", unparsed)
+	}
+}
+
+func TestDetectAnomaliesSkipsShortAndFlatHistory(t *testing.T) {
+	dates := []string{"1", "2", "3", "4", "5"}
+
+	if anomalies := detectAnomalies(dates[:3], []float64{1, 1, 100}, 7, 3); len(anomalies) != 0 {
+		t.Errorf("Expected no anomalies without enough history, got %+v", anomalies)
+	}
+	if anomalies := detectAnomalies(dates, []float64{5, 5, 5, 5, 100}, 7, 3); len(anomalies) != 0 {
+		t.Errorf("Expected no anomalies after a flat history, got %+v", anomalies)
+	}
+}
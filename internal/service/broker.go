@@ -0,0 +1,74 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// EventStreamBuffer is the number of events queued per subscriber. A subscriber that
+// falls further behind misses events instead of holding up ingestion.
+const EventStreamBuffer = 256
+
+// subscriber receives tracked events, optionally only those of one project
+type subscriber struct {
+	events  chan domain.Event
+	project string
+}
+
+// eventBroker is an in-process pub/sub of tracked events. Publishing never blocks:
+// events are dropped for subscribers whose buffer is full.
+type eventBroker struct {
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[*subscriber]struct{})}
+}
+
+// subscribe registers a subscriber for project ("" for every project). The returned
+// function unsubscribes and closes the channel; it is safe to call more than once.
+func (b *eventBroker) subscribe(project string) (<-chan domain.Event, func()) {
+	sub := &subscriber{events: make(chan domain.Event, EventStreamBuffer), project: project}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, sub)
+			b.mu.Unlock()
+			close(sub.events)
+		})
+	}
+}
+
+// publish delivers events to every matching subscriber without waiting on any of them
+func (b *eventBroker) publish(events ...domain.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(b.subscribers) == 0 {
+		return
+	}
+
+	for _, event := range events {
+		// Stored events always have a project, see eventRepository.Create
+		if event.ProjectID == "" {
+			event.ProjectID = "default"
+		}
+		for sub := range b.subscribers {
+			if sub.project != "" && sub.project != event.ProjectID {
+				continue
+			}
+			select {
+			case sub.events <- event:
+			default: // Slow subscriber, drop
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestEventBroker(t *testing.T) {
+	broker := newEventBroker()
+
+	all, unsubscribeAll := broker.subscribe("")
+	defer unsubscribeAll()
+	site, unsubscribeSite := broker.subscribe("my-site")
+
+	broker.publish(domain.Event{EventName: "page_view", ProjectID: "my-site"}, domain.Event{EventName: "click"})
+
+	if got := (<-all).EventName; got != "page_view" {
+		t.Errorf("Expected page_view first, got %s", got)
+	}
+	if got := <-all; got.EventName != "click" || got.ProjectID != "default" {
+		t.Errorf("Expected click in the default project, got %+v", got)
+	}
+	if got := (<-site).EventName; got != "page_view" {
+		t.Errorf("Expected page_view for my-site, got %s", got)
+	}
+	select {
+	case event := <-site:
+		t.Errorf("Expected other projects to be filtered out, got %+v", event)
+	default:
+	}
+
+	unsubscribeSite()
+	unsubscribeSite() // Safe to call twice
+	if _, ok := <-site; ok {
+		t.Error("Expected channel to be closed after unsubscribing")
+	}
+	broker.publish(domain.Event{EventName: "page_view", ProjectID: "my-site"}) // Must not panic
+}
+
+func TestEventBrokerSlowSubscriber(t *testing.T) {
+	broker := newEventBroker()
+	slow, unsubscribe := broker.subscribe("")
+	defer unsubscribe()
+
+	// Nobody reads from slow; publishing past its buffer must drop, not block
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < EventStreamBuffer*2; i++ {
+			broker.publish(domain.Event{EventName: "page_view"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected publish to not block on a slow subscriber")
+	}
+	if len(slow) != EventStreamBuffer {
+		t.Errorf("Expected %d buffered events, got %d", EventStreamBuffer, len(slow))
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// DefaultFunnelCacheTTL is how long a funnel result is reused unless
+// FUNNEL_CACHE_TTL says otherwise
+const DefaultFunnelCacheTTL = time.Minute
+
+// MaxStatsCacheEntries bounds the results a statsCache keeps
+const MaxStatsCacheEntries = 1000
+
+// funnelCacheTTL reads FUNNEL_CACHE_TTL, falling back to DefaultFunnelCacheTTL for
+// missing or invalid values. Zero turns the cache off.
+func funnelCacheTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("FUNNEL_CACHE_TTL")); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultFunnelCacheTTL
+}
+
+// statsCache keeps the results of expensive stats queries for a TTL, keyed by
+// their request. Events tracked meanwhile show up once the entry expires; a reset
+// or an import clears the cache, since they change past periods too. Cached values
+// are shared between callers and must not be modified.
+type statsCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]statsCacheEntry
+}
+
+type statsCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{ttl: ttl, now: time.Now, entries: make(map[string]statsCacheEntry)}
+}
+
+// get returns the value cached under key, unless it has expired
+func (c *statsCache) get(key string) (interface{}, bool) {
+	if c.ttl == 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// put caches value under key for the TTL. When the cache is full, expired entries
+// are dropped, then the one closest to expiring.
+func (c *statsCache) put(key string, value interface{}) {
+	if c.ttl == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= MaxStatsCacheEntries {
+		oldest := ""
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			} else if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		if len(c.entries) >= MaxStatsCacheEntries {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = statsCacheEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+// clear drops every cached value
+func (c *statsCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// funnelCacheKey identifies a funnel request by a hash of its steps, dates, filters
+// and options. Filter maps are encoded with sorted keys, so equal requests get
+// equal keys.
+func funnelCacheKey(request domain.FunnelRequest) string {
+	encoded, _ := json.Marshal(request)
+	sum := sha256.Sum256(encoded)
+	return "funnel:" + hex.EncodeToString(sum[:])
+}
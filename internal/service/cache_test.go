@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestFunnelCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	request := domain.FunnelRequest{
+		Steps: []domain.FunnelStep{
+			{Name: "Visit", EventName: "page_view"},
+			{Name: "Signup", EventName: "signup"},
+		},
+		StartDate: "2024-03-01",
+		EndDate:   "2024-03-31",
+		Filters:   map[string]string{"project": "web", "country": "EG"},
+	}
+	changed := request
+	changed.Steps = []domain.FunnelStep{request.Steps[0], {Name: "Signup", EventName: "register"}}
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().GetFunnelAnalysis(gomock.Any(), request).Return(&domain.FunnelAnalysisResult{TotalUsers: 10}, nil).Times(1)
+	mockRepo.EXPECT().GetFunnelAnalysis(gomock.Any(), changed).Return(&domain.FunnelAnalysisResult{TotalUsers: 4}, nil).Times(1)
+
+	service := NewEventService(mockRepo)
+	first, err := service.GetFunnelAnalysis(t.Context(), request)
+	if err != nil {
+		t.Fatalf("GetFunnelAnalysis failed: %v", err)
+	}
+
+	// The same request with its filters built in another order hits the cache
+	same := request
+	same.Filters = map[string]string{"country": "EG", "project": "web"}
+	second, err := service.GetFunnelAnalysis(t.Context(), same)
+	if err != nil {
+		t.Fatalf("GetFunnelAnalysis failed: %v", err)
+	}
+	if second != first {
+		t.Errorf("Expected the cached result, got %+v", second)
+	}
+
+	// A changed step misses it
+	other, err := service.GetFunnelAnalysis(t.Context(), changed)
+	if err != nil {
+		t.Fatalf("GetFunnelAnalysis failed: %v", err)
+	}
+	if other.TotalUsers != 4 {
+		t.Errorf("Expected the changed funnel analyzed, got %+v", other)
+	}
+}
+
+func TestFunnelCacheSkipsErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	request := domain.FunnelRequest{Steps: []domain.FunnelStep{{EventName: "page_view"}}}
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	gomock.InOrder(
+		mockRepo.EXPECT().GetFunnelAnalysis(gomock.Any(), request).Return(nil, errors.New("timeout")),
+		mockRepo.EXPECT().GetFunnelAnalysis(gomock.Any(), request).Return(&domain.FunnelAnalysisResult{}, nil),
+		mockRepo.EXPECT().Reset().Return(0, nil),
+		mockRepo.EXPECT().GetFunnelAnalysis(gomock.Any(), request).Return(&domain.FunnelAnalysisResult{}, nil),
+	)
+
+	service := NewEventService(mockRepo)
+	if _, err := service.GetFunnelAnalysis(t.Context(), request); err == nil {
+		t.Fatal("Expected the error")
+	}
+	// The failure was not cached, the result is, and a reset drops it
+	for i := 0; i < 2; i++ {
+		if _, err := service.GetFunnelAnalysis(t.Context(), request); err != nil {
+			t.Fatalf("GetFunnelAnalysis failed: %v", err)
+		}
+	}
+	if _, err := service.ResetData(); err != nil {
+		t.Fatalf("ResetData failed: %v", err)
+	}
+	if _, err := service.GetFunnelAnalysis(t.Context(), request); err != nil {
+		t.Fatalf("GetFunnelAnalysis failed: %v", err)
+	}
+}
+
+func TestStatsCache(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	cache := newStatsCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.put("a", 1)
+	if value, ok := cache.get("a"); !ok || value != 1 {
+		t.Errorf("Expected 1, got %v, %v", value, ok)
+	}
+	now = now.Add(time.Minute)
+	if _, ok := cache.get("a"); ok {
+		t.Error("Expected the entry expired after the TTL")
+	}
+
+	// A full cache drops the entry closest to expiring
+	for i := 0; i < MaxStatsCacheEntries; i++ {
+		cache.put(fmt.Sprintf("key_%d", i), i)
+		now = now.Add(time.Millisecond)
+	}
+	cache.put("new", -1)
+	if _, ok := cache.get("key_0"); ok {
+		t.Error("Expected the oldest entry evicted")
+	}
+	if _, ok := cache.get("key_1"); !ok {
+		t.Error("Expected the other entries kept")
+	}
+	if len(cache.entries) != MaxStatsCacheEntries {
+		t.Errorf("Expected %d entries, got %d", MaxStatsCacheEntries, len(cache.entries))
+	}
+
+	cache.clear()
+	if _, ok := cache.get("new"); ok {
+		t.Error("Expected the cache cleared")
+	}
+
+	disabled := newStatsCache(0)
+	disabled.put("a", 1)
+	if _, ok := disabled.get("a"); ok {
+		t.Error("Expected nothing cached with a zero TTL")
+	}
+}
+
+func TestFunnelCacheTTL(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", DefaultFunnelCacheTTL},
+		{"5m", 5 * time.Minute},
+		{"0", 0},
+		{"-1s", DefaultFunnelCacheTTL},
+		{"soon", DefaultFunnelCacheTTL},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("FUNNEL_CACHE_TTL", tt.value)
+		if got := funnelCacheTTL(); got != tt.expected {
+			t.Errorf("funnelCacheTTL() with %q = %s, expected %s", tt.value, got, tt.expected)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/mohamedelhefni/siraaj/internal/domain"
@@ -10,39 +12,113 @@ import (
 type EventService interface {
 	TrackEvent(event domain.Event) error
 	TrackEventBatch(events []domain.Event) error
-	GetEvents(startDate, endDate time.Time, limit, offset int) (map[string]interface{}, error)
-	GetStats(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
-	GetOnlineUsers(timeWindow int) (map[string]interface{}, error)
-	GetProjects() ([]string, error)
-	GetFunnelAnalysis(request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error)
+	GetEvents(ctx context.Context, startDate, endDate time.Time, limit, offset int, filters map[string]string) (map[string]interface{}, error)
+	GetStats(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetOnlineUsers(ctx context.Context, timeWindow int) (map[string]interface{}, error)
+	GetRecentEvents(ctx context.Context, limit int) ([]domain.Event, error)
+	GetProjects(ctx context.Context) ([]string, error)
+	GetFunnelAnalysis(ctx context.Context, request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error)
 
 	// New focused endpoints
-	GetTopStats(startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error)
-	GetTimeline(startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error)
-	GetTopPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
-	GetTopCountries(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error)
-	GetTopSources(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error)
-	GetTopEvents(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error)
-	GetBrowsersDevicesOS(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
-	GetEntryExitPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetTopStats(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (*domain.TopStatsResult, error)
+	GetTimeline(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error)
+	// ExplainStats returns the EXPLAIN ANALYZE plan of the main query of a report, one of the domain.Report names
+	ExplainStats(ctx context.Context, report string, startDate, endDate time.Time, limit int, filters map[string]string) (string, error)
+	GetTopPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetTopCountries(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetTopRegions(ctx context.Context, startDate, endDate time.Time, level string, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetTopLanguages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetScreenSizes(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]map[string]interface{}, error)
+	GetTopSources(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetTopEvents(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error)
+	GetBrowsersDevicesOS(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetEntryExitPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error)
+	GetStickiness(ctx context.Context, endDate time.Time, filters map[string]string) (dau, wau, mau int, dauMau float64, err error)
+	GetLifetimeUniqueUsers(ctx context.Context) (domain.LifetimeUsers, error)
+	GetNewVsReturning(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error)
+	GetUserSessions(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int, filters map[string]string) ([]domain.Session, error)
+	GetFilterValues(ctx context.Context, startDate, endDate time.Time, fields []string, filters map[string]string) (map[string][]domain.FilterValue, error)
+	GetAnomalies(ctx context.Context, startDate, endDate time.Time, filters map[string]string, metric string) (*domain.AnomalyResult, error)
 
 	// Channel analytics
-	GetChannels(startDate, endDate time.Time, filters map[string]string) ([]map[string]interface{}, error)
+	GetChannels(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.ChannelResult, error)
+	GetChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error)
+	StreamChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string, emit func(map[string]interface{}) error) error
+
+	// Goals
+	CreateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error)
+	GetGoals(ctx context.Context) ([]domain.Goal, error)
+	GetGoal(ctx context.Context, id int64) (domain.Goal, error)
+	UpdateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error)
+	DeleteGoal(ctx context.Context, id int64) error
+	GetGoalConversions(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.GoalConversion, error)
+
+	// Admin
+	ResetData() (int, error)
+	FlushEvents() (domain.FlushResult, error)
+	CompactFiles(ctx context.Context) (domain.CompactionResult, error)
+	GetStorageStats(ctx context.Context) (domain.StorageStats, error)
+	SampleEvents(ctx context.Context, n int) ([]domain.Event, error)
+	RecentTracked(limit int) []domain.Event
+	SubscribeEvents(project string) (<-chan domain.Event, func())
+	DataAsOf() time.Time
+	CheckReadiness(ctx context.Context) domain.Readiness
+	RebuildUserSketch(ctx context.Context) error
+
+	// Segment comparison
+	CompareSegments(ctx context.Context, startDate, endDate time.Time, a, b map[string]string) (map[string]interface{}, error)
+
+	// Export
+	ExportSQLite(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string) error
+	ExportParquet(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string, maxRows int64) (int64, error)
+
+	// Import
+	ImportEvents(ctx context.Context, path, format string, strict bool, prepare func(*domain.Event) error) (domain.ImportResult, error)
+
+	// Close stops webhook deliveries from being queued and waits until ctx ends for
+	// the queued ones to be sent. Call it once tracking has stopped.
+	Close(ctx context.Context) error
 }
 
 type eventService struct {
-	repo repository.EventRepository
+	repo   repository.EventRepository
+	recent *recentEvents
+	broker *eventBroker
+	hooks  *webhookDispatcher
+	// Funnel results, see GetFunnelAnalysis
+	funnels *statsCache
 }
 
 func NewEventService(repo repository.EventRepository) EventService {
-	return &eventService{repo: repo}
+	return &eventService{
+		repo:    repo,
+		recent:  newRecentEvents(recentEventsSize()),
+		broker:  newEventBroker(),
+		funnels: newStatsCache(funnelCacheTTL()),
+		hooks: newWebhookDispatcher(webhooksFromEnv(), func() (int, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), WebhookTimeout)
+			defer cancel()
+			online, err := repo.GetOnlineUsers(ctx, WebhookOnlineWindow)
+			if err != nil {
+				return 0, err
+			}
+			count, _ := online["online_users"].(int)
+			return count, nil
+		}),
+	}
 }
 
 func (s *eventService) TrackEvent(event domain.Event) error {
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
 	}
-	return s.repo.Create(event)
+	if err := s.repo.Create(event); err != nil {
+		return err
+	}
+	s.recent.add(event)
+	s.broker.publish(event)
+	s.hooks.dispatch(event)
+	return nil
 }
 
 func (s *eventService) TrackEventBatch(events []domain.Event) error {
@@ -52,61 +128,271 @@ func (s *eventService) TrackEventBatch(events []domain.Event) error {
 			events[i].Timestamp = now
 		}
 	}
-	return s.repo.CreateBatch(events)
+	if err := s.repo.CreateBatch(events); err != nil {
+		return err
+	}
+	s.recent.add(events...)
+	s.broker.publish(events...)
+	s.hooks.dispatch(events...)
+	return nil
+}
+
+func (s *eventService) GetEvents(ctx context.Context, startDate, endDate time.Time, limit, offset int, filters map[string]string) (map[string]interface{}, error) {
+	return s.repo.GetEvents(ctx, startDate, endDate, limit, offset, filters)
+}
+
+func (s *eventService) GetStats(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+	return s.repo.GetStats(ctx, startDate, endDate, limit, filters)
+}
+
+func (s *eventService) GetOnlineUsers(ctx context.Context, timeWindow int) (map[string]interface{}, error) {
+	return s.repo.GetOnlineUsers(ctx, timeWindow)
+}
+
+func (s *eventService) GetRecentEvents(ctx context.Context, limit int) ([]domain.Event, error) {
+	return s.repo.GetRecentEvents(ctx, limit)
+}
+
+func (s *eventService) GetProjects(ctx context.Context) ([]string, error) {
+	return s.repo.GetProjects(ctx)
+}
+
+// GetFunnelAnalysis analyzes the funnel, reusing the result of an identical request
+// for FUNNEL_CACHE_TTL
+func (s *eventService) GetFunnelAnalysis(ctx context.Context, request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
+	key := funnelCacheKey(request)
+	if cached, ok := s.funnels.get(key); ok {
+		return cached.(*domain.FunnelAnalysisResult), nil
+	}
+
+	result, err := s.repo.GetFunnelAnalysis(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	s.funnels.put(key, result)
+	return result, nil
+}
+
+func (s *eventService) GetTopStats(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (*domain.TopStatsResult, error) {
+	return s.repo.GetTopStats(ctx, startDate, endDate, filters)
+}
+
+func (s *eventService) GetTimeline(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error) {
+	return s.repo.GetTimeline(ctx, startDate, endDate, filters)
+}
+
+func (s *eventService) ExplainStats(ctx context.Context, report string, startDate, endDate time.Time, limit int, filters map[string]string) (string, error) {
+	return s.repo.ExplainStats(ctx, report, startDate, endDate, limit, filters)
+}
+
+func (s *eventService) GetTopPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+	return s.repo.GetTopPages(ctx, startDate, endDate, limit, filters)
+}
+
+func (s *eventService) GetTopCountries(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return s.repo.GetTopCountries(ctx, startDate, endDate, limit, filters)
+}
+
+func (s *eventService) GetTopRegions(ctx context.Context, startDate, endDate time.Time, level string, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return s.repo.GetTopRegions(ctx, startDate, endDate, level, limit, filters)
+}
+
+func (s *eventService) GetTopLanguages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return s.repo.GetTopLanguages(ctx, startDate, endDate, limit, filters)
+}
+
+func (s *eventService) GetScreenSizes(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]map[string]interface{}, error) {
+	return s.repo.GetScreenSizes(ctx, startDate, endDate, filters)
+}
+
+func (s *eventService) GetTopSources(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return s.repo.GetTopSources(ctx, startDate, endDate, limit, filters)
+}
+
+func (s *eventService) GetTopEvents(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, int, error) {
+	return s.repo.GetTopEvents(ctx, startDate, endDate, limit, filters)
 }
 
-func (s *eventService) GetEvents(startDate, endDate time.Time, limit, offset int) (map[string]interface{}, error) {
-	return s.repo.GetEvents(startDate, endDate, limit, offset)
+func (s *eventService) GetBrowsersDevicesOS(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+	return s.repo.GetBrowsersDevicesOS(ctx, startDate, endDate, limit, filters)
 }
 
-func (s *eventService) GetStats(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
-	return s.repo.GetStats(startDate, endDate, limit, filters)
+func (s *eventService) GetEntryExitPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
+	return s.repo.GetEntryExitPages(ctx, startDate, endDate, limit, filters)
 }
 
-func (s *eventService) GetOnlineUsers(timeWindow int) (map[string]interface{}, error) {
-	return s.repo.GetOnlineUsers(timeWindow)
+func (s *eventService) GetStickiness(ctx context.Context, endDate time.Time, filters map[string]string) (dau, wau, mau int, dauMau float64, err error) {
+	return s.repo.GetStickiness(ctx, endDate, filters)
 }
 
-func (s *eventService) GetProjects() ([]string, error) {
-	return s.repo.GetProjects()
+func (s *eventService) GetLifetimeUniqueUsers(ctx context.Context) (domain.LifetimeUsers, error) {
+	return s.repo.GetLifetimeUniqueUsers(ctx)
 }
 
-func (s *eventService) GetFunnelAnalysis(request domain.FunnelRequest) (*domain.FunnelAnalysisResult, error) {
-	return s.repo.GetFunnelAnalysis(request)
+func (s *eventService) GetNewVsReturning(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error) {
+	return s.repo.GetNewVsReturning(ctx, startDate, endDate, filters)
 }
 
-func (s *eventService) GetTopStats(startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error) {
-	return s.repo.GetTopStats(startDate, endDate, filters)
+func (s *eventService) GetFilterValues(ctx context.Context, startDate, endDate time.Time, fields []string, filters map[string]string) (map[string][]domain.FilterValue, error) {
+	return s.repo.GetFilterValues(ctx, startDate, endDate, fields, filters)
 }
 
-func (s *eventService) GetTimeline(startDate, endDate time.Time, filters map[string]string) (map[string]interface{}, error) {
-	return s.repo.GetTimeline(startDate, endDate, filters)
+func (s *eventService) GetUserSessions(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int, filters map[string]string) ([]domain.Session, error) {
+	return s.repo.GetUserSessions(ctx, userID, startDate, endDate, limit, offset, filters)
 }
 
-func (s *eventService) GetTopPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
-	return s.repo.GetTopPages(startDate, endDate, limit, filters)
+func (s *eventService) GetChannels(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.ChannelResult, error) {
+	return s.repo.GetChannels(ctx, startDate, endDate, filters)
 }
 
-func (s *eventService) GetTopCountries(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error) {
-	return s.repo.GetTopCountries(startDate, endDate, limit, filters)
+func (s *eventService) GetChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error) {
+	return s.repo.GetChannelLandingPages(ctx, startDate, endDate, limit, filters)
 }
 
-func (s *eventService) GetTopSources(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error) {
-	return s.repo.GetTopSources(startDate, endDate, limit, filters)
+func (s *eventService) StreamChannelLandingPages(ctx context.Context, startDate, endDate time.Time, limit int, filters map[string]string, emit func(map[string]interface{}) error) error {
+	return s.repo.StreamChannelLandingPages(ctx, startDate, endDate, limit, filters, emit)
 }
 
-func (s *eventService) GetTopEvents(startDate, endDate time.Time, limit int, filters map[string]string) ([]map[string]interface{}, error) {
-	return s.repo.GetTopEvents(startDate, endDate, limit, filters)
+func (s *eventService) CreateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error) {
+	return s.repo.CreateGoal(ctx, goal)
 }
 
-func (s *eventService) GetBrowsersDevicesOS(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
-	return s.repo.GetBrowsersDevicesOS(startDate, endDate, limit, filters)
+func (s *eventService) GetGoals(ctx context.Context) ([]domain.Goal, error) {
+	return s.repo.GetGoals(ctx)
 }
 
-func (s *eventService) GetEntryExitPages(startDate, endDate time.Time, limit int, filters map[string]string) (map[string]interface{}, error) {
-	return s.repo.GetEntryExitPages(startDate, endDate, limit, filters)
+func (s *eventService) GetGoal(ctx context.Context, id int64) (domain.Goal, error) {
+	return s.repo.GetGoal(ctx, id)
 }
 
-func (s *eventService) GetChannels(startDate, endDate time.Time, filters map[string]string) ([]map[string]interface{}, error) {
-	return s.repo.GetChannels(startDate, endDate, filters)
+func (s *eventService) UpdateGoal(ctx context.Context, goal domain.Goal) (domain.Goal, error) {
+	return s.repo.UpdateGoal(ctx, goal)
+}
+
+func (s *eventService) DeleteGoal(ctx context.Context, id int64) error {
+	return s.repo.DeleteGoal(ctx, id)
+}
+
+func (s *eventService) GetGoalConversions(ctx context.Context, startDate, endDate time.Time, filters map[string]string) ([]domain.GoalConversion, error) {
+	return s.repo.GetGoalConversions(ctx, startDate, endDate, filters)
+}
+
+func (s *eventService) ResetData() (int, error) {
+	defer s.funnels.clear()
+	return s.repo.Reset()
+}
+
+func (s *eventService) FlushEvents() (domain.FlushResult, error) {
+	return s.repo.FlushSync()
+}
+
+func (s *eventService) CompactFiles(ctx context.Context) (domain.CompactionResult, error) {
+	return s.repo.Compact(ctx)
+}
+
+func (s *eventService) GetStorageStats(ctx context.Context) (domain.StorageStats, error) {
+	return s.repo.GetStorageStats(ctx)
+}
+
+func (s *eventService) SampleEvents(ctx context.Context, n int) ([]domain.Event, error) {
+	return s.repo.SampleEvents(ctx, n)
+}
+
+// RecentTracked returns the last events accepted by this process, newest first,
+// including ones that have not been flushed to storage yet
+func (s *eventService) RecentTracked(limit int) []domain.Event {
+	return s.recent.latest(limit)
+}
+
+func (s *eventService) DataAsOf() time.Time {
+	return s.repo.DataAsOf()
+}
+
+func (s *eventService) CheckReadiness(ctx context.Context) domain.Readiness {
+	return s.repo.CheckReadiness(ctx)
+}
+
+func (s *eventService) RebuildUserSketch(ctx context.Context) error {
+	return s.repo.RebuildUserSketch(ctx)
+}
+
+func (s *eventService) Close(ctx context.Context) error {
+	return s.hooks.Close(ctx)
+}
+
+// SubscribeEvents returns a channel of events as they are tracked, for project or
+// every project when empty, and a function that ends the subscription. Events are
+// dropped rather than queued without bound when the subscriber falls behind.
+func (s *eventService) SubscribeEvents(project string) (<-chan domain.Event, func()) {
+	return s.broker.subscribe(project)
+}
+
+// comparedMetrics are the GetTopStats metrics reported with deltas by
+// CompareSegments, by their JSON key
+var comparedMetrics = map[string]func(*domain.TopStatsResult) interface{}{
+	"total_events":         func(s *domain.TopStatsResult) interface{} { return s.TotalEvents },
+	"unique_users":         func(s *domain.TopStatsResult) interface{} { return s.UniqueUsers },
+	"total_visits":         func(s *domain.TopStatsResult) interface{} { return s.TotalVisits },
+	"views_per_visit":      func(s *domain.TopStatsResult) interface{} { return s.ViewsPerVisit },
+	"bounce_rate":          func(s *domain.TopStatsResult) interface{} { return s.BounceRate.Value },
+	"avg_session_duration": func(s *domain.TopStatsResult) interface{} { return s.AvgSessionDuration },
+}
+
+// CompareSegments runs GetTopStats for two filter sets over the same period and
+// returns both results plus per-metric differences from A to B
+func (s *eventService) CompareSegments(ctx context.Context, startDate, endDate time.Time, a, b map[string]string) (map[string]interface{}, error) {
+	statsA, err := s.repo.GetTopStats(ctx, startDate, endDate, a)
+	if err != nil {
+		return nil, fmt.Errorf("segment a: %w", err)
+	}
+	statsB, err := s.repo.GetTopStats(ctx, startDate, endDate, b)
+	if err != nil {
+		return nil, fmt.Errorf("segment b: %w", err)
+	}
+
+	deltas := make(map[string]domain.MetricDelta, len(comparedMetrics))
+	for metric, value := range comparedMetrics {
+		deltas[metric] = metricDelta(value(statsA), value(statsB))
+	}
+
+	return map[string]interface{}{
+		"a":      statsA,
+		"b":      statsB,
+		"deltas": deltas,
+	}, nil
+}
+
+// metricDelta compares two stat values; values that are missing or suppressed
+// (nil) leave the difference and percent change null
+func metricDelta(a, b interface{}) domain.MetricDelta {
+	delta := domain.MetricDelta{A: a, B: b}
+	aValue, aOK := toFloat(a)
+	bValue, bOK := toFloat(b)
+	if !aOK || !bOK {
+		return delta
+	}
+
+	difference := bValue - aValue
+	delta.Difference = &difference
+	if aValue != 0 {
+		percent := difference / aValue * 100
+		delta.PercentChange = &percent
+	}
+	return delta
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case *float64:
+		if n != nil {
+			return *n, true
+		}
+	}
+	return 0, false
 }
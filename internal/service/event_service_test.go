@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCompareSegments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+	chrome := map[string]string{"browser": "Chrome"}
+	safari := map[string]string{"browser": "Safari"}
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().GetTopStats(gomock.Any(), start, end, chrome).Return(&domain.TopStatsResult{
+		TotalEvents:        1000,
+		UniqueUsers:        200,
+		TotalVisits:        0,
+		BounceRate:         domain.RateOf(40),
+		AvgSessionDuration: 120,
+	}, nil)
+	mockRepo.EXPECT().GetTopStats(gomock.Any(), start, end, safari).Return(&domain.TopStatsResult{
+		TotalEvents:        1500,
+		UniqueUsers:        150,
+		TotalVisits:        10,
+		BounceRate:         domain.NullRate(), // Suppressed below RATE_MIN_SAMPLE
+		AvgSessionDuration: 90,
+	}, nil)
+
+	result, err := NewEventService(mockRepo).CompareSegments(t.Context(), start, end, chrome, safari)
+	if err != nil {
+		t.Fatalf("CompareSegments failed: %v", err)
+	}
+
+	deltas, ok := result["deltas"].(map[string]domain.MetricDelta)
+	if !ok {
+		t.Fatalf("Expected deltas map, got %T", result["deltas"])
+	}
+
+	tests := []struct {
+		metric          string
+		expectedDiff    *float64
+		expectedPercent *float64
+	}{
+		{"total_events", ptr(500), ptr(50)},
+		{"unique_users", ptr(-50), ptr(-25)},
+		{"total_visits", ptr(10), nil}, // No percentage change from zero
+		{"bounce_rate", nil, nil},      // Suppressed on one side
+		{"avg_session_duration", ptr(-30), ptr(-25)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			delta, ok := deltas[tt.metric]
+			if !ok {
+				t.Fatalf("Expected delta for %s", tt.metric)
+			}
+			if !equalPtr(delta.Difference, tt.expectedDiff) {
+				t.Errorf("Expected difference %v, got %v", deref(tt.expectedDiff), deref(delta.Difference))
+			}
+			if !equalPtr(delta.PercentChange, tt.expectedPercent) {
+				t.Errorf("Expected percent change %v, got %v", deref(tt.expectedPercent), deref(delta.PercentChange))
+			}
+		})
+	}
+
+	if result["a"] == nil || result["b"] == nil {
+		t.Error("Expected both segment results in response")
+	}
+}
+
+func TestCompareSegmentsError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().GetTopStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("database error"))
+
+	if _, err := NewEventService(mockRepo).CompareSegments(t.Context(), time.Now(), time.Now(), nil, nil); err == nil {
+		t.Error("Expected error when a segment query fails")
+	}
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func equalPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func deref(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
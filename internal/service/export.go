@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// ExportLimit is the most rows of each top list written to an export
+const ExportLimit = 1000
+
+// exportTimelineMetrics are the columns of the export's timeline table
+var exportTimelineMetrics = []string{"users", "visits", "page_views", "events"}
+
+// ExportSQLite runs the standard reports for the date range and writes them to the
+// SQLite database at path: pages, sources, countries, timeline and channels, and an
+// export_info table recording the range and filters they were run with
+func (s *eventService) ExportSQLite(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string) error {
+	tables, err := s.exportTables(ctx, startDate, endDate, filters, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.repo.WriteSQLite(path, tables)
+}
+
+// ExportParquet writes the raw events of the date range to a Parquet file at path
+func (s *eventService) ExportParquet(ctx context.Context, startDate, endDate time.Time, filters map[string]string, path string, maxRows int64) (int64, error) {
+	return s.repo.ExportParquet(ctx, startDate, endDate, filters, path, maxRows)
+}
+
+// exportTables runs the reports of an export
+func (s *eventService) exportTables(ctx context.Context, startDate, endDate time.Time, filters map[string]string, now time.Time) ([]domain.ExportTable, error) {
+	text := func(name string) domain.ExportColumn { return domain.ExportColumn{Name: name, Type: domain.ExportText} }
+	integer := func(name string) domain.ExportColumn {
+		return domain.ExportColumn{Name: name, Type: domain.ExportInteger}
+	}
+	decimal := func(name string) domain.ExportColumn { return domain.ExportColumn{Name: name, Type: domain.ExportReal} }
+
+	pages, err := s.repo.GetTopPages(ctx, startDate, endDate, ExportLimit, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top pages: %w", err)
+	}
+	topPages, _ := pages["top_pages"].([]map[string]interface{})
+	pagesTable := domain.ExportTable{Name: "pages", Columns: []domain.ExportColumn{text("url"), integer("count")}}
+	for _, page := range topPages {
+		pagesTable.Rows = append(pagesTable.Rows, []interface{}{page["url"], page["count"]})
+	}
+
+	sources, _, err := s.repo.GetTopSources(ctx, startDate, endDate, ExportLimit, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top sources: %w", err)
+	}
+	sourcesTable := domain.ExportTable{Name: "sources", Columns: []domain.ExportColumn{text("name"), integer("count")}}
+	for _, source := range sources {
+		sourcesTable.Rows = append(sourcesTable.Rows, []interface{}{source["name"], source["count"]})
+	}
+
+	countries, _, err := s.repo.GetTopCountries(ctx, startDate, endDate, ExportLimit, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top countries: %w", err)
+	}
+	countriesTable := domain.ExportTable{Name: "countries", Columns: []domain.ExportColumn{text("name"), integer("count")}}
+	for _, country := range countries {
+		countriesTable.Rows = append(countriesTable.Rows, []interface{}{country["name"], country["count"]})
+	}
+
+	timelineTable, format, err := s.exportTimeline(ctx, startDate, endDate, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := s.repo.GetChannels(ctx, startDate, endDate, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels: %w", err)
+	}
+	channelsTable := domain.ExportTable{Name: "channels", Columns: []domain.ExportColumn{
+		text("channel"), integer("total_events"), integer("unique_users"), integer("total_visits"), integer("page_views"), decimal("conversion_rate"),
+	}}
+	for _, channel := range channels {
+		channelsTable.Rows = append(channelsTable.Rows, []interface{}{
+			channel.Channel, channel.TotalEvents, channel.UniqueUsers, channel.TotalVisits, channel.PageViews, channel.ConversionRate,
+		})
+	}
+
+	info := domain.ExportTable{Name: "export_info", Columns: []domain.ExportColumn{text("key"), text("value")}}
+	info.Rows = [][]interface{}{
+		{"start", startDate.Format("2006-01-02")},
+		{"end", endDate.Format("2006-01-02")},
+		{"timeline_format", format},
+		{"generated_at", now.UTC().Format(time.RFC3339)},
+	}
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		info.Rows = append(info.Rows, []interface{}{"filter." + key, filters[key]})
+	}
+
+	return []domain.ExportTable{pagesTable, sourcesTable, countriesTable, timelineTable, channelsTable, info}, nil
+}
+
+// exportTimeline runs the timeline once per exportTimelineMetrics and joins them on
+// date into one table. It also returns the timeline granularity.
+func (s *eventService) exportTimeline(ctx context.Context, startDate, endDate time.Time, filters map[string]string) (domain.ExportTable, string, error) {
+	table := domain.ExportTable{Name: "timeline", Columns: []domain.ExportColumn{{Name: "date", Type: domain.ExportText}}}
+	counts := map[string][]interface{}{}
+	var dates []string
+	var format string
+
+	for i, metric := range exportTimelineMetrics {
+		table.Columns = append(table.Columns, domain.ExportColumn{Name: metric, Type: domain.ExportInteger})
+
+		metricFilters := make(map[string]string, len(filters)+1)
+		for key, value := range filters {
+			metricFilters[key] = value
+		}
+		metricFilters["metric"] = metric
+
+		timeline, err := s.repo.GetTimeline(ctx, startDate, endDate, metricFilters)
+		if err != nil {
+			return table, "", fmt.Errorf("failed to get %s timeline: %w", metric, err)
+		}
+		points, _ := timeline["timeline"].([]map[string]interface{})
+		format, _ = timeline["timeline_format"].(string)
+		for _, point := range points {
+			date := fmt.Sprint(point["date"])
+			if counts[date] == nil {
+				counts[date] = make([]interface{}, len(exportTimelineMetrics))
+				for j := range counts[date] {
+					counts[date][j] = int64(0)
+				}
+				dates = append(dates, date)
+			}
+			value, _ := point["count"].(float64)
+			counts[date][i] = int64(math.Round(value))
+		}
+	}
+
+	sort.Strings(dates)
+	for _, date := range dates {
+		table.Rows = append(table.Rows, append([]interface{}{date}, counts[date]...))
+	}
+	return table, format, nil
+}
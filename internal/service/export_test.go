@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExportSQLite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 2, 23, 59, 59, 0, time.UTC)
+	filters := map[string]string{"project": "web"}
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().GetTopPages(gomock.Any(), start, end, ExportLimit, filters).
+		Return(map[string]interface{}{"top_pages": []map[string]interface{}{{"url": "/", "count": 10}}, "total": 1}, nil)
+	mockRepo.EXPECT().GetTopSources(gomock.Any(), start, end, ExportLimit, filters).
+		Return([]map[string]interface{}{{"name": "google.com", "count": 4}}, 1, nil)
+	mockRepo.EXPECT().GetTopCountries(gomock.Any(), start, end, ExportLimit, filters).
+		Return([]map[string]interface{}{{"name": "PS", "count": 7}}, 1, nil)
+	for metric, counts := range map[string][]float64{"users": {3, 4}, "visits": {5, 6}, "page_views": {8}, "events": {9, 12}} {
+		mockRepo.EXPECT().GetTimeline(gomock.Any(), start, end, map[string]string{"project": "web", "metric": metric}).
+			Return(dayTimeline(counts...), nil)
+	}
+	mockRepo.EXPECT().GetChannels(gomock.Any(), start, end, filters).
+		Return([]domain.ChannelResult{{Channel: "Search", TotalEvents: 20, UniqueUsers: 4, TotalVisits: 5, PageViews: 8, ConversionRate: 12.5}}, nil)
+
+	var tables []domain.ExportTable
+	mockRepo.EXPECT().WriteSQLite("/tmp/export.sqlite", gomock.Any()).
+		DoAndReturn(func(path string, written []domain.ExportTable) error {
+			tables = written
+			return nil
+		})
+
+	if err := NewEventService(mockRepo).ExportSQLite(t.Context(), start, end, filters, "/tmp/export.sqlite"); err != nil {
+		t.Fatalf("ExportSQLite failed: %v", err)
+	}
+
+	byName := map[string]domain.ExportTable{}
+	var names []string
+	for _, table := range tables {
+		byName[table.Name] = table
+		names = append(names, table.Name)
+	}
+	if expected := []string{"pages", "sources", "countries", "timeline", "channels", "export_info"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected tables %v, got %v", expected, names)
+	}
+
+	if rows := byName["pages"].Rows; !reflect.DeepEqual(rows, [][]interface{}{{"/", 10}}) {
+		t.Errorf("Unexpected pages rows: %v", rows)
+	}
+	if rows := byName["channels"].Rows; len(rows) != 1 || len(rows[0]) != len(byName["channels"].Columns) || rows[0][0] != "Search" {
+		t.Errorf("Unexpected channels rows: %v", rows)
+	}
+
+	// Metrics are joined on date, with zeros where a metric has no bucket
+	timeline := byName["timeline"]
+	expectedTimeline := [][]interface{}{
+		{"2024-01-01T00:00:00Z", int64(3), int64(5), int64(8), int64(9)},
+		{"2024-01-02T00:00:00Z", int64(4), int64(6), int64(0), int64(12)},
+	}
+	if len(timeline.Columns) != 5 || !reflect.DeepEqual(timeline.Rows, expectedTimeline) {
+		t.Errorf("Unexpected timeline: %v %v", timeline.Columns, timeline.Rows)
+	}
+
+	info := map[string]interface{}{}
+	for _, row := range byName["export_info"].Rows {
+		info[row[0].(string)] = row[1]
+	}
+	if info["start"] != "2024-01-01" || info["end"] != "2024-01-02" || info["timeline_format"] != "day" || info["filter.project"] != "web" || info["generated_at"] == nil {
+		t.Errorf("Unexpected export info: %v", info)
+	}
+}
+
+func TestExportSQLiteReportError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().GetTopPages(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("database error"))
+
+	err := NewEventService(mockRepo).ExportSQLite(t.Context(), time.Now(), time.Now(), map[string]string{}, "/tmp/export.sqlite")
+	if err == nil {
+		t.Fatal("Expected an error when a report fails")
+	}
+}
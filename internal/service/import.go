@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+)
+
+const (
+	// ImportBatchSize is the most imported events stored at once
+	ImportBatchSize = 1000
+	// MaxImportLineSize caps an NDJSON import line
+	MaxImportLineSize = 1 << 20
+	// importRetryDelay is how long an import waits for the buffer to drain when
+	// storage rejects a batch under BUFFER_FULL_POLICY=reject
+	importRetryDelay = 100 * time.Millisecond
+)
+
+// ImportEvents stores the historical events of the import file at path, in format
+// domain.ImportFormatCSV, whose header has been checked with
+// domain.ValidateImportHeader, or domain.ImportFormatNDJSON. Each parsed event goes
+// through prepare, which may enrich it or reject it with an error, and is stored
+// with its original timestamp. Records that fail are reported by line and skipped;
+// when strict, the file is validated first and nothing is stored if any record
+// fails. Imported events skip the live stream, recent events and webhooks. The
+// repository marks their days stale in the daily_stats rollup, so top lists read
+// them from raw events until the rollup is recomputed.
+func (s *eventService) ImportEvents(ctx context.Context, path, format string, strict bool, prepare func(*domain.Event) error) (domain.ImportResult, error) {
+	if strict {
+		result, err := s.importFile(ctx, path, format, prepare, nil)
+		if err != nil || result.Skipped > 0 {
+			result.Imported = 0 // Nothing was stored, see importFile
+			return result, err
+		}
+	}
+
+	batch := make([]domain.Event, 0, ImportBatchSize)
+	var imported int
+	result, err := s.importFile(ctx, path, format, prepare, func(event domain.Event) error {
+		batch = append(batch, event)
+		if len(batch) < ImportBatchSize {
+			return nil
+		}
+		if err := s.storeImported(ctx, batch); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	})
+	if err == nil {
+		if err = s.storeImported(ctx, batch); err == nil {
+			imported += len(batch)
+		}
+	}
+	result.Imported = imported
+	if imported > 0 {
+		// Imported events fall in past periods that cached funnels may cover
+		s.funnels.clear()
+	}
+	return result, err
+}
+
+// importFile parses and prepares each record of the import file at path, passing
+// the valid events to store and collecting the errors of the others. With a nil
+// store the file is only validated, and Imported counts the valid records.
+func (s *eventService) importFile(ctx context.Context, path, format string, prepare func(*domain.Event) error, store func(domain.Event) error) (domain.ImportResult, error) {
+	result := domain.ImportResult{Errors: []domain.ImportError{}}
+	record := func(line int, event domain.Event, err error) error {
+		if err == nil {
+			err = prepare(&event)
+		}
+		if err != nil {
+			result.Skipped++
+			if len(result.Errors) < domain.MaxImportErrors {
+				result.Errors = append(result.Errors, domain.ImportError{Line: line, Error: err.Error()})
+			}
+			return nil
+		}
+		result.Imported++
+		if store == nil {
+			return nil
+		}
+		return store(event)
+	}
+
+	if format == domain.ImportFormatNDJSON {
+		return result, readNDJSON(ctx, path, record)
+	}
+
+	// Rows are counted as one line each, after the header on line 1
+	line := 1
+	err := s.repo.ReadCSV(ctx, path, func(header, values []string) error {
+		line++
+		event, err := domain.ParseImportRow(header, values)
+		return record(line, event, err)
+	})
+	return result, err
+}
+
+// readNDJSON calls fn with the event parsed from each non-blank line of the NDJSON
+// file at path, or the error parsing it
+func readNDJSON(ctx context.Context, path string, fn func(line int, event domain.Event, err error) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Printf("Warning: failed to close import file: %v", err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64<<10), MaxImportLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if line%ImportBatchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		text := scanner.Bytes()
+		if line == 1 {
+			text = bytes.TrimPrefix(text, []byte("\ufeff"))
+		}
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		event, err := domain.ParseImportJSON(text)
+		if err := fn(line, event, err); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("%w: line %d is longer than %d bytes", domain.ErrInvalidImport, line+1, MaxImportLineSize)
+		}
+		return fmt.Errorf("failed to read import file: %w", err)
+	}
+	return nil
+}
+
+// storeImported stores a batch of imported events, waiting out backpressure
+// instead of failing the import
+func (s *eventService) storeImported(ctx context.Context, events []domain.Event) error {
+	for {
+		err := s.repo.CreateBatch(events)
+		if !errors.Is(err, storage.ErrBufferFull) {
+			if err != nil {
+				return fmt.Errorf("failed to store imported events: %w", err)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(importRetryDelay):
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+	"go.uber.org/mock/gomock"
+)
+
+// malformedCSV has a valid row between rows that fail to parse or validate
+const malformedCSV = `timestamp,event_name,url,screen_width
+2024-03-01T10:00:00Z,page_view,/,1280
+yesterday,page_view,/,1280
+2024-03-01T10:05:00Z,,/pricing,1280
+2024-03-01T10:06:00Z,signup,/signup,wide
+2024-03-01T10:07:00Z,rejected,/,1280
+2024-03-01 10:08:00,purchase,/checkout,
+`
+
+// readCSVString stands in for the repository, reading rows from content
+func readCSVString(content string) func(context.Context, string, func(header, values []string) error) error {
+	return func(_ context.Context, _ string, fn func(header, values []string) error) error {
+		records, err := csv.NewReader(strings.NewReader(content)).ReadAll()
+		if err != nil {
+			return fmt.Errorf("%w: %v", domain.ErrInvalidImport, err)
+		}
+		for _, values := range records[1:] {
+			if err := fn(records[0], values); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// prepareImported rejects events named "rejected", like validation in the handler
+func prepareImported(event *domain.Event) error {
+	if event.EventName == "rejected" {
+		return errors.New("rejected by prepare")
+	}
+	event.Channel = "Direct"
+	return nil
+}
+
+func TestImportEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// One more valid row than a batch holds, after a row that does not parse and
+	// one that prepare rejects
+	content := "timestamp,event_name\n2024-03-01T10:00:00Z,page_view\nnot a time,page_view\n2024-03-01T10:00:00Z,rejected\n"
+	for i := 0; i < ImportBatchSize; i++ {
+		content += fmt.Sprintf("2024-03-01T10:00:00Z,event_%d\n", i)
+	}
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().ReadCSV(gomock.Any(), "/tmp/import.csv", gomock.Any()).DoAndReturn(readCSVString(content))
+	var stored []domain.Event
+	gomock.InOrder(
+		// The full batch is stored once the buffer drains
+		mockRepo.EXPECT().CreateBatch(gomock.Len(ImportBatchSize)).Return(storage.ErrBufferFull),
+		mockRepo.EXPECT().CreateBatch(gomock.Len(ImportBatchSize)).DoAndReturn(func(events []domain.Event) error {
+			stored = append(stored, events...)
+			return nil
+		}),
+		mockRepo.EXPECT().CreateBatch(gomock.Len(1)).DoAndReturn(func(events []domain.Event) error {
+			stored = append(stored, events...)
+			return nil
+		}),
+	)
+
+	result, err := NewEventService(mockRepo).ImportEvents(t.Context(), "/tmp/import.csv", domain.ImportFormatCSV, false, prepareImported)
+	if err != nil {
+		t.Fatalf("ImportEvents failed: %v", err)
+	}
+
+	expected := domain.ImportResult{
+		Imported: ImportBatchSize + 1,
+		Skipped:  2,
+		Errors: []domain.ImportError{
+			{Line: 3, Error: `timestamp: invalid value "not a time": expected an RFC 3339 or "YYYY-MM-DD HH:MM:SS" timestamp`},
+			{Line: 4, Error: "rejected by prepare"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+	if len(stored) != ImportBatchSize+1 || stored[0].EventName != "page_view" || stored[0].Channel != "Direct" {
+		t.Errorf("Expected the prepared events in file order, got %d starting with %+v", len(stored), stored[0])
+	}
+}
+
+func TestImportEventsMalformedCSV(t *testing.T) {
+	expectedErrors := []domain.ImportError{
+		{Line: 3, Error: `timestamp: invalid value "yesterday": expected an RFC 3339 or "YYYY-MM-DD HH:MM:SS" timestamp`},
+		{Line: 4, Error: "event_name is required"},
+		{Line: 5, Error: `screen_width: invalid value "wide": invalid syntax`},
+		{Line: 6, Error: "rejected by prepare"},
+	}
+
+	tests := []struct {
+		name     string
+		strict   bool
+		expected domain.ImportResult
+		stored   []string
+	}{
+		{
+			name:     "Valid rows are imported",
+			expected: domain.ImportResult{Imported: 2, Skipped: 4, Errors: expectedErrors},
+			stored:   []string{"page_view", "purchase"},
+		},
+		{
+			name:     "Strict stores nothing",
+			strict:   true,
+			expected: domain.ImportResult{Skipped: 4, Errors: expectedErrors},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockEventRepository(ctrl)
+			mockRepo.EXPECT().ReadCSV(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(readCSVString(malformedCSV))
+			var stored []string
+			if tt.stored != nil {
+				mockRepo.EXPECT().CreateBatch(gomock.Any()).DoAndReturn(func(events []domain.Event) error {
+					for _, event := range events {
+						stored = append(stored, event.EventName)
+					}
+					return nil
+				})
+			}
+
+			result, err := NewEventService(mockRepo).ImportEvents(t.Context(), "/tmp/import.csv", domain.ImportFormatCSV, tt.strict, prepareImported)
+			if err != nil {
+				t.Fatalf("ImportEvents failed: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, result)
+			}
+			if !reflect.DeepEqual(stored, tt.stored) {
+				t.Errorf("Expected %v stored, got %v", tt.stored, stored)
+			}
+		})
+	}
+}
+
+func TestImportEventsStrict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// A valid file is read once to validate it and once to store it
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().ReadCSV(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(readCSVString("timestamp,event_name\n2024-03-01T10:00:00Z,page_view\n")).Times(2)
+	mockRepo.EXPECT().CreateBatch(gomock.Len(1)).Return(nil)
+
+	result, err := NewEventService(mockRepo).ImportEvents(t.Context(), "/tmp/import.csv", domain.ImportFormatCSV, true, prepareImported)
+	if err != nil {
+		t.Fatalf("ImportEvents failed: %v", err)
+	}
+	expected := domain.ImportResult{Imported: 1, Errors: []domain.ImportError{}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestImportEventsNDJSON(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	content := "\ufeff" + `{"timestamp":"2024-03-01T10:00:00Z","event_name":"page_view","screen_width":1280}` + "\n" +
+		"\n" +
+		`{"timestamp":"2024-03-01T10:01:00Z","event_name":"page_view","screen_width":"wide"}` + "\n" +
+		`{"timestamp":"2024-03-01T10:02:00Z","event_name":"rejected"}` + "\n" +
+		`not json` + "\n" +
+		`{"timestamp":"2024-03-01T10:03:00Z","event_name":"signup","id":7}` + "\n" +
+		`{"timestamp":"2024-03-01 10:04:00","event_name":"purchase"}`
+	path := filepath.Join(t.TempDir(), "import.ndjson")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write import file: %v", err)
+	}
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	var stored []string
+	mockRepo.EXPECT().CreateBatch(gomock.Any()).DoAndReturn(func(events []domain.Event) error {
+		for _, event := range events {
+			stored = append(stored, event.EventName)
+		}
+		return nil
+	})
+
+	result, err := NewEventService(mockRepo).ImportEvents(t.Context(), path, domain.ImportFormatNDJSON, false, prepareImported)
+	if err != nil {
+		t.Fatalf("ImportEvents failed: %v", err)
+	}
+	if result.Imported != 2 || result.Skipped != 4 {
+		t.Errorf("Expected 2 imported and 4 skipped, got %+v", result)
+	}
+	var lines []int
+	for _, importErr := range result.Errors {
+		lines = append(lines, importErr.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{3, 4, 5, 6}) {
+		t.Errorf("Expected errors on lines 3 to 6, got %+v", result.Errors)
+	}
+	if !reflect.DeepEqual(stored, []string{"page_view", "purchase"}) {
+		t.Errorf("Expected the valid events stored, got %v", stored)
+	}
+}
+
+func TestImportEventsInvalidFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().ReadCSV(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(fmt.Errorf("%w: expected 2 values per row", domain.ErrInvalidImport))
+
+	_, err := NewEventService(mockRepo).ImportEvents(t.Context(), "/tmp/import.csv", domain.ImportFormatCSV, false, func(*domain.Event) error { return nil })
+	if !errors.Is(err, domain.ErrInvalidImport) {
+		t.Errorf("Expected ErrInvalidImport, got %v", err)
+	}
+
+	// NDJSON lines have a size limit
+	path := filepath.Join(t.TempDir(), "import.ndjson")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", MaxImportLineSize+1)), 0644); err != nil {
+		t.Fatalf("Failed to write import file: %v", err)
+	}
+	_, err = NewEventService(mockRepo).ImportEvents(t.Context(), path, domain.ImportFormatNDJSON, false, func(*domain.Event) error { return nil })
+	if !errors.Is(err, domain.ErrInvalidImport) {
+		t.Errorf("Expected ErrInvalidImport for a long line, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// DefaultRecentEventsSize is the number of tracked events kept in memory unless
+// RECENT_EVENTS_SIZE is set
+const DefaultRecentEventsSize = 100
+
+// recentEventsSize reads RECENT_EVENTS_SIZE, falling back to DefaultRecentEventsSize.
+// Zero disables the buffer.
+func recentEventsSize() int {
+	if n, err := strconv.Atoi(os.Getenv("RECENT_EVENTS_SIZE")); err == nil && n >= 0 {
+		return n
+	}
+	return DefaultRecentEventsSize
+}
+
+// recentEvents is a fixed-size ring buffer of the last tracked events. Events are
+// buffered before they are flushed to Parquet, so this is the only place a
+// just-tracked event can be seen right away.
+type recentEvents struct {
+	mu     sync.Mutex
+	events []domain.Event
+	next   int // Slot the next event is written to
+	count  int
+}
+
+func newRecentEvents(size int) *recentEvents {
+	return &recentEvents{events: make([]domain.Event, size)}
+}
+
+// add records events, overwriting the oldest once the buffer is full
+func (b *recentEvents) add(events ...domain.Event) {
+	if len(b.events) == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, event := range events {
+		b.events[b.next] = event
+		b.next = (b.next + 1) % len(b.events)
+		if b.count < len(b.events) {
+			b.count++
+		}
+	}
+}
+
+// latest returns up to limit events, newest first. limit <= 0 returns all of them.
+func (b *recentEvents) latest(limit int) []domain.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if limit <= 0 || limit > b.count {
+		limit = b.count
+	}
+
+	events := make([]domain.Event, limit)
+	for i := range events {
+		events[i] = b.events[(b.next-1-i+len(b.events))%len(b.events)]
+	}
+	return events
+}
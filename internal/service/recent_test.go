@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRecentEvents(t *testing.T) {
+	buffer := newRecentEvents(3)
+	if got := buffer.latest(10); len(got) != 0 {
+		t.Fatalf("Expected empty buffer, got %v", got)
+	}
+
+	for i := 1; i <= 5; i++ {
+		buffer.add(domain.Event{EventName: fmt.Sprintf("event_%d", i)})
+	}
+
+	tests := []struct {
+		name     string
+		limit    int
+		expected []string
+	}{
+		{"All", 0, []string{"event_5", "event_4", "event_3"}},
+		{"Limited", 2, []string{"event_5", "event_4"}},
+		{"Above size", 10, []string{"event_5", "event_4", "event_3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buffer.latest(tt.limit)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %d events, got %d", len(tt.expected), len(got))
+			}
+			for i, name := range tt.expected {
+				if got[i].EventName != name {
+					t.Errorf("Event %d: expected %s, got %s", i, name, got[i].EventName)
+				}
+			}
+		})
+	}
+
+	disabled := newRecentEvents(0)
+	disabled.add(domain.Event{EventName: "page_view"})
+	if got := disabled.latest(10); len(got) != 0 {
+		t.Errorf("Expected disabled buffer to stay empty, got %v", got)
+	}
+}
+
+func TestTrackEventRecent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockEventRepository(ctrl)
+	mockRepo.EXPECT().Create(gomock.Any()).Return(nil)
+	mockRepo.EXPECT().CreateBatch(gomock.Any()).Return(nil)
+
+	svc := NewEventService(mockRepo)
+	if err := svc.TrackEvent(domain.Event{EventName: "signup", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("TrackEvent failed: %v", err)
+	}
+
+	// Visible immediately, with no flush in between
+	recent := svc.RecentTracked(10)
+	if len(recent) != 1 || recent[0].EventName != "signup" {
+		t.Fatalf("Expected tracked event in recent buffer, got %v", recent)
+	}
+
+	if err := svc.TrackEventBatch([]domain.Event{{EventName: "click"}, {EventName: "purchase"}}); err != nil {
+		t.Fatalf("TrackEventBatch failed: %v", err)
+	}
+	recent = svc.RecentTracked(10)
+	if len(recent) != 3 || recent[0].EventName != "purchase" || recent[2].EventName != "signup" {
+		t.Errorf("Expected batch events newest first, got %v", recent)
+	}
+}
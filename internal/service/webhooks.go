@@ -0,0 +1,319 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+const (
+	// DefaultWebhookRateLimit is the deliveries per minute of a webhook without rate_limit
+	DefaultWebhookRateLimit = 60
+	// WebhookQueueSize is the number of deliveries waiting for a worker. Triggers
+	// past it are dropped so tracking never waits on a slow endpoint.
+	WebhookQueueSize = 1024
+	// WebhookWorkers is the number of deliveries in flight at once
+	WebhookWorkers = 4
+	// WebhookMaxAttempts is the number of tries per delivery, with doubling backoff
+	WebhookMaxAttempts = 4
+	// WebhookTimeout bounds a single delivery attempt
+	WebhookTimeout = 10 * time.Second
+	// WebhookOnlineCheckInterval is how often online_users triggers query online users
+	WebhookOnlineCheckInterval = 30 * time.Second
+	// WebhookOnlineWindow is the window, in minutes, a user counts as online for
+	WebhookOnlineWindow = 5
+)
+
+// webhooksFromEnv loads the webhooks configured in the JSON file at WEBHOOKS_FILE.
+// A bad file is logged and disables webhooks rather than stopping tracking.
+func webhooksFromEnv() []domain.Webhook {
+	path := os.Getenv("WEBHOOKS_FILE")
+	if path == "" {
+		return nil
+	}
+	hooks, err := loadWebhooks(path)
+	if err != nil {
+		log.Printf("Warning: webhooks disabled: %v", err)
+		return nil
+	}
+	log.Printf("Loaded %d webhooks from %s", len(hooks), path)
+	return hooks
+}
+
+// loadWebhooks reads and validates a JSON array of webhooks
+func loadWebhooks(path string) ([]domain.Webhook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhooks file: %w", err)
+	}
+	var hooks []domain.Webhook
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, fmt.Errorf("failed to parse webhooks file: %w", err)
+	}
+	for i, hook := range hooks {
+		if err := hook.Validate(); err != nil {
+			return nil, fmt.Errorf("webhook %d: %w", i+1, err)
+		}
+	}
+	return hooks, nil
+}
+
+// webhookTarget is a configured webhook and its delivery state
+type webhookTarget struct {
+	hook domain.Webhook
+
+	mu          sync.Mutex
+	windowStart time.Time // Start of the current rate limit minute
+	sent        int       // Deliveries queued in the current minute
+	above       bool      // Online users were at or over the threshold at the last check
+}
+
+// allow reports whether another delivery fits in the webhook's rate limit
+func (t *webhookTarget) allow(now time.Time) bool {
+	limit := t.hook.RateLimit
+	if limit == 0 {
+		limit = DefaultWebhookRateLimit
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.windowStart) >= time.Minute {
+		t.windowStart = now
+		t.sent = 0
+	}
+	if t.sent >= limit {
+		return false
+	}
+	t.sent++
+	return true
+}
+
+type webhookDelivery struct {
+	target  *webhookTarget
+	payload domain.WebhookPayload
+}
+
+// webhookDispatcher evaluates webhook triggers as events are tracked and delivers
+// the payloads from background workers. Dispatching never blocks: deliveries over a
+// webhook's rate limit or past a full queue are dropped, as are deliveries once
+// Close has been called.
+type webhookDispatcher struct {
+	events      []*webhookTarget // Event triggers
+	online      []*webhookTarget // Online users triggers
+	onlineUsers func() (int, error)
+	queue       chan webhookDelivery
+	client      *http.Client
+	backoff     time.Duration // Wait before the first retry, doubled after each
+	workers     sync.WaitGroup
+
+	intake sync.RWMutex // Held for writing to close queue, for reading to send on it
+	closed bool
+
+	mu              sync.Mutex
+	lastOnlineCheck time.Time
+	checkingOnline  bool
+}
+
+// newWebhookDispatcher starts the workers for hooks. onlineUsers counts the users
+// online now and is only called for online_users triggers.
+func newWebhookDispatcher(hooks []domain.Webhook, onlineUsers func() (int, error)) *webhookDispatcher {
+	d := &webhookDispatcher{
+		onlineUsers: onlineUsers,
+		queue:       make(chan webhookDelivery, WebhookQueueSize),
+		client:      &http.Client{Timeout: WebhookTimeout},
+		backoff:     time.Second,
+	}
+	for _, hook := range hooks {
+		target := &webhookTarget{hook: hook}
+		if hook.Trigger.OnlineUsers > 0 {
+			d.online = append(d.online, target)
+		} else {
+			d.events = append(d.events, target)
+		}
+	}
+
+	if len(hooks) > 0 {
+		d.workers.Add(WebhookWorkers)
+		for i := 0; i < WebhookWorkers; i++ {
+			go d.run()
+		}
+	}
+	return d
+}
+
+// Close stops queueing deliveries and waits for the workers to send the ones
+// already queued, retries included. When ctx ends first it returns ctx's error and
+// the workers carry on in the background.
+func (d *webhookDispatcher) Close(ctx context.Context) error {
+	d.intake.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.intake.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries still queued: %w", ctx.Err())
+	}
+}
+
+// dispatch queues a delivery for every event trigger matching events, and checks
+// the online users triggers when they are due
+func (d *webhookDispatcher) dispatch(events ...domain.Event) {
+	for _, event := range events {
+		// Stored events always have a project, see eventRepository.Create
+		if event.ProjectID == "" {
+			event.ProjectID = "default"
+		}
+		for _, target := range d.events {
+			trigger := target.hook.Trigger
+			if trigger.Event != event.EventName || (trigger.Project != "" && trigger.Project != event.ProjectID) {
+				continue
+			}
+			d.enqueue(target, domain.WebhookPayload{
+				Webhook: target.hook.Name,
+				Trigger: domain.WebhookTriggerEvent,
+				Event:   &event,
+			})
+		}
+	}
+
+	if len(d.online) > 0 {
+		d.checkOnlineUsers()
+	}
+}
+
+func (d *webhookDispatcher) enqueue(target *webhookTarget, payload domain.WebhookPayload) {
+	d.intake.RLock()
+	defer d.intake.RUnlock()
+	if d.closed || !target.allow(time.Now()) {
+		return
+	}
+	select {
+	case d.queue <- webhookDelivery{target: target, payload: payload}:
+	default:
+		log.Printf("Warning: webhook queue full, dropping delivery to %s", target.hook.Name)
+	}
+}
+
+// checkOnlineUsers counts online users in the background, at most once per
+// WebhookOnlineCheckInterval, and fires the triggers whose threshold was crossed
+// upwards since the last check
+func (d *webhookDispatcher) checkOnlineUsers() {
+	d.mu.Lock()
+	if d.checkingOnline || time.Since(d.lastOnlineCheck) < WebhookOnlineCheckInterval {
+		d.mu.Unlock()
+		return
+	}
+	d.checkingOnline = true
+	d.lastOnlineCheck = time.Now()
+	d.mu.Unlock()
+
+	go func() {
+		defer func() {
+			d.mu.Lock()
+			d.checkingOnline = false
+			d.mu.Unlock()
+		}()
+
+		online, err := d.onlineUsers()
+		if err != nil {
+			log.Printf("Error counting online users for webhooks: %v", err)
+			return
+		}
+		for _, target := range d.online {
+			threshold := target.hook.Trigger.OnlineUsers
+
+			target.mu.Lock()
+			crossed := online >= threshold && !target.above
+			target.above = online >= threshold
+			target.mu.Unlock()
+
+			if crossed {
+				d.enqueue(target, domain.WebhookPayload{
+					Webhook:     target.hook.Name,
+					Trigger:     domain.WebhookTriggerOnlineUsers,
+					OnlineUsers: online,
+					Threshold:   threshold,
+				})
+			}
+		}
+	}()
+}
+
+func (d *webhookDispatcher) run() {
+	defer d.workers.Done()
+	for delivery := range d.queue {
+		d.deliver(delivery)
+	}
+}
+
+// deliver POSTs a payload, retrying network errors, 429s and 5xx responses up to
+// WebhookMaxAttempts times
+func (d *webhookDispatcher) deliver(delivery webhookDelivery) {
+	hook := delivery.target.hook
+	delivery.payload.SentAt = time.Now().UTC()
+	body, err := json.Marshal(delivery.payload)
+	if err != nil {
+		log.Printf("Error encoding webhook payload for %s: %v", hook.Name, err)
+		return
+	}
+
+	backoff := d.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(hook.URL, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == WebhookMaxAttempts {
+			log.Printf("Error delivering webhook %s after %d attempts: %v", hook.Name, attempt, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends one attempt, reporting whether a failure is worth retrying
+func (d *webhookDispatcher) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Siraaj-Webhook")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close webhook response: %v", err)
+		}
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %s", resp.Status)
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestLoadWebhooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    int
+		wantErr string
+	}{
+		{
+			name:   "Valid",
+			config: `[{"name":"purchases","url":"https://hooks.example.com/p","trigger":{"event":"purchase"}},{"name":"busy","url":"http://localhost/b","trigger":{"online_users":100},"rate_limit":1}]`,
+			want:   2,
+		},
+		{name: "Invalid JSON", config: `{`, wantErr: "failed to parse"},
+		{name: "No trigger", config: `[{"name":"a","url":"https://example.com"}]`, wantErr: "webhook 1: webhook trigger"},
+		{name: "Two triggers", config: `[{"name":"a","url":"https://example.com","trigger":{"event":"x","online_users":5}}]`, wantErr: "exactly one"},
+		{name: "Bad URL", config: `[{"name":"a","url":"ftp://example.com","trigger":{"event":"x"}}]`, wantErr: "http or https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "webhooks.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			hooks, err := loadWebhooks(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadWebhooks failed: %v", err)
+			}
+			if len(hooks) != tt.want {
+				t.Errorf("Expected %d webhooks, got %d", tt.want, len(hooks))
+			}
+		})
+	}
+}
+
+func TestWebhookDispatcherDeliversMatchingEvents(t *testing.T) {
+	payloads := make(chan domain.WebhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload domain.WebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	d := newWebhookDispatcher([]domain.Webhook{
+		{Name: "purchases", URL: server.URL, Trigger: domain.WebhookTrigger{Event: "purchase", Project: "shop"}},
+	}, nil)
+
+	d.dispatch(
+		domain.Event{EventName: "page_view", ProjectID: "shop"},
+		domain.Event{EventName: "purchase", ProjectID: "blog"},
+		domain.Event{EventName: "purchase", ProjectID: "shop", Country: "Egypt"},
+	)
+
+	select {
+	case payload := <-payloads:
+		if payload.Webhook != "purchases" || payload.Trigger != domain.WebhookTriggerEvent || payload.Event == nil || payload.Event.Country != "Egypt" {
+			t.Errorf("Unexpected payload: %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a webhook delivery")
+	}
+	select {
+	case payload := <-payloads:
+		t.Errorf("Expected only one delivery, got %+v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookDispatcherRetries(t *testing.T) {
+	var attempts atomic.Int32
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		close(done)
+	}))
+	defer server.Close()
+
+	d := newWebhookDispatcher(nil, nil)
+	d.backoff = time.Millisecond
+	target := &webhookTarget{hook: domain.Webhook{Name: "flaky", URL: server.URL}}
+	d.deliver(webhookDelivery{target: target})
+
+	select {
+	case <-done:
+	default:
+		t.Fatalf("Expected delivery to succeed on the third attempt, got %d attempts", attempts.Load())
+	}
+
+	// Client errors are not retried
+	attempts.Store(0)
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+	d.deliver(webhookDelivery{target: &webhookTarget{hook: domain.Webhook{Name: "bad", URL: rejecting.URL}}})
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("Expected 1 attempt for a 400, got %d", got)
+	}
+}
+
+func TestWebhookDispatcherClose(t *testing.T) {
+	var delivered atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		delivered.Add(1)
+	}))
+	defer server.Close()
+
+	d := newWebhookDispatcher([]domain.Webhook{
+		{Name: "clicks", URL: server.URL, Trigger: domain.WebhookTrigger{Event: "click"}},
+	}, nil)
+	// More deliveries than workers, so some are still queued when Close starts
+	for i := 0; i < WebhookWorkers*2; i++ {
+		d.dispatch(domain.Event{EventName: "click"})
+	}
+
+	// Close waits for the queue, and gives up when its context ends first
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to give up while deliveries are blocked, got %v", err)
+	}
+
+	// Deliveries dispatched after Close are dropped instead of panicking
+	d.dispatch(domain.Event{EventName: "click"})
+
+	close(release)
+	if err := d.Close(t.Context()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got := delivered.Load(); got != WebhookWorkers*2 {
+		t.Errorf("Expected the %d queued deliveries sent before Close returned, got %d", WebhookWorkers*2, got)
+	}
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	target := &webhookTarget{hook: domain.Webhook{RateLimit: 2}}
+	now := time.Now()
+
+	if !target.allow(now) || !target.allow(now) {
+		t.Fatal("Expected the first two deliveries to be allowed")
+	}
+	if target.allow(now.Add(30 * time.Second)) {
+		t.Error("Expected the third delivery in the minute to be dropped")
+	}
+	if !target.allow(now.Add(time.Minute)) {
+		t.Error("Expected deliveries to be allowed again the next minute")
+	}
+}
+
+func TestWebhookDispatcherNeverBlocks(t *testing.T) {
+	// No workers run without webhooks, so a target added afterwards fills the queue
+	d := newWebhookDispatcher(nil, nil)
+	d.events = []*webhookTarget{{hook: domain.Webhook{Name: "slow", URL: "http://localhost", RateLimit: WebhookQueueSize * 2, Trigger: domain.WebhookTrigger{Event: "click"}}}}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < WebhookQueueSize*2; i++ {
+			d.dispatch(domain.Event{EventName: "click"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch blocked on a full queue")
+	}
+}
+
+func TestWebhookOnlineUsersTrigger(t *testing.T) {
+	payloads := make(chan domain.WebhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload domain.WebhookPayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	var online atomic.Int32
+	online.Store(150)
+	d := newWebhookDispatcher([]domain.Webhook{
+		{Name: "busy", URL: server.URL, Trigger: domain.WebhookTrigger{OnlineUsers: 100}},
+	}, func() (int, error) { return int(online.Load()), nil })
+
+	d.dispatch(domain.Event{EventName: "page_view"})
+	select {
+	case payload := <-payloads:
+		if payload.Trigger != domain.WebhookTriggerOnlineUsers || payload.OnlineUsers != 150 || payload.Threshold != 100 {
+			t.Errorf("Unexpected payload: %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an online users delivery")
+	}
+
+	// Still above the threshold: no second delivery until it drops and rises again
+	waitForOnlineCheck(t, d)
+	d.mu.Lock()
+	d.lastOnlineCheck = time.Time{}
+	d.mu.Unlock()
+	d.dispatch(domain.Event{EventName: "page_view"})
+	waitForOnlineCheck(t, d)
+	select {
+	case payload := <-payloads:
+		t.Errorf("Expected no delivery while still above the threshold, got %+v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func waitForOnlineCheck(t *testing.T, d *webhookDispatcher) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		d.mu.Lock()
+		checking := d.checkingOnline
+		d.mu.Unlock()
+		if !checking {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("Online users check did not finish")
+}
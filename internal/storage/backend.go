@@ -0,0 +1,27 @@
+package storage
+
+import "fmt"
+
+// Backend is where tracked events are stored, selected with STORAGE_BACKEND
+type Backend string
+
+const (
+	// BackendParquet buffers events and flushes them to Parquet files (default)
+	BackendParquet Backend = "parquet"
+	// BackendTable inserts events straight into the DuckDB events table, trading
+	// scan speed on large datasets for a single file and no flush delay
+	BackendTable Backend = "table"
+)
+
+// ParseBackend returns the backend named by value, defaulting to BackendParquet
+// when it is empty
+func ParseBackend(value string) (Backend, error) {
+	switch backend := Backend(value); backend {
+	case "":
+		return BackendParquet, nil
+	case BackendParquet, BackendTable:
+		return backend, nil
+	default:
+		return "", fmt.Errorf("invalid STORAGE_BACKEND %q: must be parquet or table", value)
+	}
+}
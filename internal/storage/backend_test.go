@@ -0,0 +1,29 @@
+package storage
+
+import "testing"
+
+func TestParseBackend(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Backend
+		wantErr  bool
+	}{
+		{"", BackendParquet, false},
+		{"parquet", BackendParquet, false},
+		{"table", BackendTable, false},
+		{"TABLE", "", true},
+		{"sqlite", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			backend, err := ParseBackend(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBackend(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if backend != tt.expected {
+				t.Errorf("ParseBackend(%q) = %q, expected %q", tt.value, backend, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+const (
+	// Files smaller than this are in tier 0
+	CompactionBaseSize = 4 * 1024 * 1024
+	// Default size ratio between tiers, and the number of files a tier needs before it
+	// is merged, overridden with ParquetOptions.MergeFanout
+	CompactionFanout = 10
+	// Files at or above this size are never merged again
+	MaxCompactedFileSize = 1024 * 1024 * 1024
+)
+
+// parquetFileInfo is a Parquet file considered for compaction
+type parquetFileInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// compactionTier returns the size tier of a file. Tier n holds files between
+// CompactionBaseSize*fanout^(n-1) and CompactionBaseSize*fanout^n bytes, so merging
+// fanout files of one tier produces roughly one file of the next.
+func compactionTier(size int64, fanout int) int {
+	if size < CompactionBaseSize {
+		return 0
+	}
+	return int(math.Log(float64(size)/CompactionBaseSize)/math.Log(float64(fanout))) + 1
+}
+
+// pickMergeCandidates groups files by size tier and returns merge groups of up to
+// fanout files, oldest first, for every tier holding at least minGroup files. The
+// background pass uses a minGroup of fanout, merging only tiers that have filled
+// up. Large compacted files are left alone, so a merge only rewrites data of similar
+// size and the total work per byte is logarithmic instead of re-reading the whole
+// dataset every time.
+func pickMergeCandidates(files []parquetFileInfo, fanout, minGroup int) [][]parquetFileInfo {
+	tiers := make(map[int][]parquetFileInfo)
+	for _, file := range files {
+		if file.size >= MaxCompactedFileSize {
+			continue
+		}
+		tier := compactionTier(file.size, fanout)
+		tiers[tier] = append(tiers[tier], file)
+	}
+
+	tierNumbers := make([]int, 0, len(tiers))
+	for tier := range tiers {
+		tierNumbers = append(tierNumbers, tier)
+	}
+	sort.Ints(tierNumbers)
+
+	groups := [][]parquetFileInfo{}
+	for _, tier := range tierNumbers {
+		candidates := tiers[tier]
+		if len(candidates) < minGroup {
+			continue
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].modTime.Before(candidates[j].modTime)
+		})
+		// Merge at most fanout files at a time so each merge reads a bounded amount
+		// of data; leftovers wait for the tier to fill up again
+		for len(candidates) >= minGroup {
+			n := min(fanout, len(candidates))
+			groups = append(groups, candidates[:n])
+			candidates = candidates[n:]
+		}
+	}
+	return groups
+}
+
+// listParquetFileInfo returns the Parquet files in the data directory with their sizes
+func (ps *ParquetStorage) listParquetFileInfo() ([]parquetFileInfo, error) {
+	paths, err := ps.listParquetFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]parquetFileInfo, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // Removed by a concurrent reset
+			}
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		files = append(files, parquetFileInfo{path: path, size: info.Size(), modTime: info.ModTime()})
+	}
+	return files, nil
+}
+
+// checkAndMergeFiles runs a tiered compaction pass, merging each tier that has
+// accumulated enough similarly sized files into a single file. Cancelling ctx
+// aborts the pass between or during merges.
+func (ps *ParquetStorage) checkAndMergeFiles(ctx context.Context) error {
+	ps.mergeMu.Lock()
+	defer ps.mergeMu.Unlock()
+
+	_, err := ps.compact(ctx, ps.mergeFanout)
+	return err
+}
+
+// Compact runs a compaction pass now, merging every tier with at least two files
+// instead of waiting for it to fill up, such as after a large import. It returns
+// domain.ErrCompactionRunning if compaction, a reset or a user sketch rebuild is
+// already running.
+func (ps *ParquetStorage) Compact(ctx context.Context) (domain.CompactionResult, error) {
+	if !ps.mergeMu.TryLock() {
+		return domain.CompactionResult{}, domain.ErrCompactionRunning
+	}
+	defer ps.mergeMu.Unlock()
+
+	start := time.Now()
+	result, err := ps.compact(ctx, 2)
+	if err != nil {
+		return result, err
+	}
+	log.Printf("🗜️ Compacted %d files into %d (%.2f MB to %.2f MB) in %v",
+		result.FilesMerged, result.FilesWritten,
+		float64(result.BytesBefore)/(1024*1024), float64(result.BytesAfter)/(1024*1024), time.Since(start))
+	return result, nil
+}
+
+// compact merges groups of at least minGroup files per size tier, with mergeMu
+// held. Each project's partition is compacted on its own, so merges never mix
+// projects. The result counts the merges done before any error.
+func (ps *ParquetStorage) compact(ctx context.Context, minGroup int) (domain.CompactionResult, error) {
+	var result domain.CompactionResult
+	files, err := ps.listParquetFileInfo()
+	if err != nil {
+		return result, err
+	}
+
+	byDir := make(map[string][]parquetFileInfo)
+	for _, file := range files {
+		dir := filepath.Dir(file.path)
+		byDir[dir] = append(byDir[dir], file)
+	}
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	seq := 0
+	for _, dir := range dirs {
+		for _, group := range pickMergeCandidates(byDir[dir], ps.mergeFanout, minGroup) {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			mergedSize, err := ps.mergeFiles(ctx, group, seq)
+			if err != nil {
+				return result, err
+			}
+			seq++
+
+			result.FilesMerged += len(group)
+			result.FilesWritten++
+			for _, file := range group {
+				result.BytesBefore += file.size
+			}
+			result.BytesAfter += mergedSize
+		}
+	}
+	return result, nil
+}
+
+// mergeFiles merges a group of Parquet files from one directory into one file
+// there, sorted by timestamp, and deletes the originals. It returns the size of
+// the merged file.
+func (ps *ParquetStorage) mergeFiles(ctx context.Context, group []parquetFileInfo, seq int) (int64, error) {
+	start := time.Now()
+
+	paths := make([]string, len(group))
+	var inputBytes int64
+	for i, file := range group {
+		paths[i] = fmt.Sprintf("'%s'", file.path)
+		inputBytes += file.size
+	}
+
+	log.Printf("🔄 Merging %d Parquet files (%.2f MB, tier %d)...",
+		len(group), float64(inputBytes)/(1024*1024), compactionTier(group[0].size, ps.mergeFanout))
+
+	// Generate merged filename with timestamp
+	timestamp := time.Now().UTC().Format("20060102_150405")
+	mergedFile := filepath.Join(filepath.Dir(group[0].path), fmt.Sprintf("events_merged_%s_%d.parquet", timestamp, seq))
+	tempMergedFile := mergedFile + ".tmp"
+
+	// Use DuckDB to merge only this group's files
+	mergeQuery := fmt.Sprintf(`
+		COPY (
+			SELECT
+				id,
+				timestamp,
+				date_trunc('hour', timestamp)  AS date_hour,
+				date_trunc('day', timestamp)   AS date_day,
+				date_trunc('month', timestamp) AS date_month,
+				event_name,
+				user_id,
+				session_id,
+				session_duration,
+				url,
+				referrer,
+				user_agent,
+				ip,
+				country,
+				browser,
+				os,
+				device,
+				is_bot,
+				project_id,
+				channel,
+				received_at,
+				region,
+				language,
+				screen_width,
+				screen_height,
+				sample_rate
+			FROM read_parquet([%s], union_by_name=true)
+			ORDER BY timestamp
+		) TO '%s' (%s)
+	`, strings.Join(paths, ", "), tempMergedFile, ps.copyOptions())
+
+	if _, err := ps.db.ExecContext(ctx, mergeQuery); err != nil {
+		// Clean up temp file on error
+		if removeErr := os.Remove(tempMergedFile); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Printf("Warning: failed to remove temp merged file: %v", removeErr)
+		}
+		return 0, fmt.Errorf("failed to merge Parquet files: %w", err)
+	}
+
+	// Atomic rename
+	if err := os.Rename(tempMergedFile, mergedFile); err != nil {
+		if removeErr := os.Remove(tempMergedFile); removeErr != nil {
+			log.Printf("Warning: failed to remove temp merged file after rename failure: %v", removeErr)
+		}
+		return 0, fmt.Errorf("failed to rename merged file: %w", err)
+	}
+
+	mergedFileInfo, err := os.Stat(mergedFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat merged file: %w", err)
+	}
+
+	// Delete merged files
+	deletedCount := 0
+	for _, file := range group {
+		if err := os.Remove(file.path); err != nil {
+			log.Printf("⚠️  Warning: failed to delete old file %s: %v", filepath.Base(file.path), err)
+		} else {
+			deletedCount++
+		}
+	}
+
+	log.Printf("✅ Merged %d files into 1 file (%.2f MB) in %v",
+		deletedCount, float64(mergedFileInfo.Size())/(1024*1024), time.Since(start))
+
+	return mergedFileInfo.Size(), nil
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestCompactionTier(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		expected int
+	}{
+		{"Empty file", 0, 0},
+		{"Small flush", 100 * 1024, 0},
+		{"Just below base", CompactionBaseSize - 1, 0},
+		{"At base", CompactionBaseSize, 1},
+		{"One fanout up", CompactionBaseSize * CompactionFanout, 2},
+		{"Two fanouts up", CompactionBaseSize * CompactionFanout * CompactionFanout, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compactionTier(tt.size, CompactionFanout); got != tt.expected {
+				t.Errorf("compactionTier(%d) = %d, expected %d", tt.size, got, tt.expected)
+			}
+		})
+	}
+}
+
+// fileSet builds n files of the given size with increasing modification times
+func fileSet(prefix string, n int, size int64) []parquetFileInfo {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	files := make([]parquetFileInfo, n)
+	for i := range files {
+		files[i] = parquetFileInfo{
+			path:    fmt.Sprintf("%s_%d.parquet", prefix, i),
+			size:    size,
+			modTime: base.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return files
+}
+
+func TestPickMergeCandidates(t *testing.T) {
+	t.Run("Below fanout", func(t *testing.T) {
+		groups := pickMergeCandidates(fileSet("small", CompactionFanout-1, 1024), CompactionFanout, CompactionFanout)
+		if len(groups) != 0 {
+			t.Errorf("Expected no merge below fanout, got %d groups", len(groups))
+		}
+	})
+
+	t.Run("Small files merge, large files untouched", func(t *testing.T) {
+		files := append(fileSet("small", CompactionFanout, 1024), fileSet("large", 3, 200*1024*1024)...)
+		files = append(files, fileSet("huge", CompactionFanout, MaxCompactedFileSize)...)
+
+		groups := pickMergeCandidates(files, CompactionFanout, CompactionFanout)
+		if len(groups) != 1 {
+			t.Fatalf("Expected 1 merge group, got %d", len(groups))
+		}
+		if len(groups[0]) != CompactionFanout {
+			t.Errorf("Expected %d files in group, got %d", CompactionFanout, len(groups[0]))
+		}
+		for _, file := range groups[0] {
+			if file.size != 1024 {
+				t.Errorf("Expected only small files in group, got %s (%d bytes)", file.path, file.size)
+			}
+		}
+	})
+
+	t.Run("Groups are bounded by fanout", func(t *testing.T) {
+		groups := pickMergeCandidates(fileSet("small", CompactionFanout*2+3, 1024), CompactionFanout, CompactionFanout)
+		if len(groups) != 2 {
+			t.Fatalf("Expected 2 merge groups, got %d", len(groups))
+		}
+		for _, group := range groups {
+			if len(group) != CompactionFanout {
+				t.Errorf("Expected %d files per group, got %d", CompactionFanout, len(group))
+			}
+		}
+	})
+
+	t.Run("Forced pass merges partial tiers", func(t *testing.T) {
+		files := append(fileSet("small", CompactionFanout+3, 1024), fileSet("large", 1, 200*1024*1024)...)
+
+		groups := pickMergeCandidates(files, CompactionFanout, 2)
+		if len(groups) != 2 {
+			t.Fatalf("Expected 2 merge groups, got %d", len(groups))
+		}
+		if len(groups[0]) != CompactionFanout || len(groups[1]) != 3 {
+			t.Errorf("Expected groups of %d and 3 files, got %d and %d", CompactionFanout, len(groups[0]), len(groups[1]))
+		}
+	})
+
+	t.Run("Oldest first", func(t *testing.T) {
+		files := fileSet("small", CompactionFanout, 1024)
+		files[0], files[len(files)-1] = files[len(files)-1], files[0]
+
+		group := pickMergeCandidates(files, CompactionFanout, CompactionFanout)[0]
+		for i := 1; i < len(group); i++ {
+			if group[i].modTime.Before(group[i-1].modTime) {
+				t.Fatalf("Expected group sorted by modification time, got %v", group)
+			}
+		}
+	})
+}
+
+func TestCheckAndMergeFiles(t *testing.T) {
+	ps := newTestStorage(t)
+
+	for i := 0; i < CompactionFanout; i++ {
+		if err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := ps.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+
+	if err := ps.checkAndMergeFiles(context.Background()); err != nil {
+		t.Fatalf("checkAndMergeFiles failed: %v", err)
+	}
+
+	count, err := ps.GetFileCount()
+	if err != nil {
+		t.Fatalf("GetFileCount failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected %d small files merged into 1, got %d files", CompactionFanout, count)
+	}
+
+	var rows int
+	if err := ps.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM read_parquet('%s')", ps.GetFilePath())).Scan(&rows); err != nil {
+		t.Fatalf("Failed to read merged file: %v", err)
+	}
+	if rows != CompactionFanout {
+		t.Errorf("Expected %d rows after merge, got %d", CompactionFanout, rows)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	ps := newTestStorage(t)
+
+	// Fewer files than the background pass waits for
+	for i := 0; i < 3; i++ {
+		if err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := ps.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+
+	ps.mergeMu.Lock()
+	if _, err := ps.Compact(context.Background()); !errors.Is(err, domain.ErrCompactionRunning) {
+		t.Errorf("Expected ErrCompactionRunning while a pass runs, got %v", err)
+	}
+	ps.mergeMu.Unlock()
+
+	result, err := ps.Compact(context.Background())
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if result.FilesMerged != 3 || result.FilesWritten != 1 || result.BytesBefore == 0 || result.BytesAfter == 0 {
+		t.Errorf("Expected 3 files merged into 1, got %+v", result)
+	}
+	if count, err := ps.GetFileCount(); err != nil || count != 1 {
+		t.Errorf("Expected 1 file after compaction, got %d (%v)", count, err)
+	}
+
+	// Nothing is left to merge
+	result, err = ps.Compact(context.Background())
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if result != (domain.CompactionResult{}) {
+		t.Errorf("Expected nothing merged, got %+v", result)
+	}
+}
+
+// BenchmarkPickMergeCandidates reports the bytes a compaction pass rewrites when a
+// fresh batch of small files lands next to datasets of increasing size. merged_bytes
+// stays flat as the existing data grows, unlike merging every file on each pass.
+func BenchmarkPickMergeCandidates(b *testing.B) {
+	for _, compacted := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("compacted_files=%d", compacted), func(b *testing.B) {
+			files := append(fileSet("new", CompactionFanout, 512*1024), fileSet("old", compacted, MaxCompactedFileSize)...)
+
+			var merged int64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				merged = 0
+				for _, group := range pickMergeCandidates(files, CompactionFanout, CompactionFanout) {
+					for _, file := range group {
+						merged += file.size
+					}
+				}
+			}
+
+			var total int64
+			for _, file := range files {
+				total += file.size
+			}
+			b.ReportMetric(float64(merged), "merged_bytes")
+			b.ReportMetric(float64(total), "total_bytes")
+		})
+	}
+}
@@ -1,14 +1,23 @@
 package storage
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/hll"
+	"github.com/mohamedelhefni/siraaj/internal/idgen"
 )
 
 const (
@@ -18,45 +27,129 @@ const (
 	DefaultFlushInterval = 30 * time.Second
 	// Parquet file directory
 	DefaultParquetDir = "data/events"
-	// Temp CSV path for buffering
-	TempCSVFile = "data/events_buffer.csv"
-	// Max files before triggering merge
-	MaxFilesBeforeMerge = 100
-	// Merge check interval
+	// Temp CSV file name for buffering, created inside the data directory
+	TempCSVFile = "events_buffer.csv"
+	// Default merge check interval
 	MergeCheckInterval = 5 * time.Minute
+	// Default number of flushes that may write files at once
+	DefaultFlushWorkers = 1
+	// Hard cap on buffered events, as a multiple of the buffer size
+	MaxBufferMultiplier = 2
+	// Default compression codec of the Parquet files
+	DefaultParquetCodec = "ZSTD"
+	// Default rows per Parquet row group
+	DefaultRowGroupSize = 100000
 )
 
+// ParquetCodecs are the compression codecs Parquet files can be written with
+var ParquetCodecs = []string{"UNCOMPRESSED", "SNAPPY", "GZIP", "ZSTD", "LZ4", "LZ4_RAW", "BROTLI"}
+
+// ErrBufferFull is returned by Write and WriteBatch under BackpressureReject when
+// the buffer is at its hard cap because flushes are not keeping up
+var ErrBufferFull = errors.New("event buffer is full")
+
+// BackpressurePolicy controls what writes do when the buffer reaches its hard cap
+type BackpressurePolicy string
+
+const (
+	// BackpressureBlock makes writes wait until a flush drains the buffer
+	BackpressureBlock BackpressurePolicy = "block"
+	// BackpressureReject makes writes fail fast with ErrBufferFull
+	BackpressureReject BackpressurePolicy = "reject"
+)
+
+// ParquetOptions tunes buffering, flushing and compaction. Zero fields take the
+// defaults.
+type ParquetOptions struct {
+	BufferSize    int           // Events buffered before a flush is triggered
+	FlushInterval time.Duration // Longest time an event waits in the buffer
+	FlushWorkers  int           // Flushes that may write files at once
+	MergeFanout   int           // Similarly sized files a compaction tier needs before it is merged
+	MergeInterval time.Duration // How often compaction looks for tiers to merge
+	Codec         string        // Compression codec, one of ParquetCodecs in any case
+	RowGroupSize  int           // Rows per row group; larger groups scan faster but take more memory to write
+}
+
 // ParquetStorage handles buffered writes to Parquet files using DuckDB COPY
 // Uses append-only partitioned files for scalability
 type ParquetStorage struct {
 	db            *sql.DB
-	dataDir       string // Directory containing partition files
-	tempCSVPath   string
+	dataDir       string      // Directory containing partition files
+	tempCSVPaths  []string    // One per flush worker
+	flushSlots    chan string // Temp CSV paths of the idle flush workers
 	buffer        []domain.Event
 	bufferSize    int
+	maxBuffer     int // Hard cap on len(buffer)
+	policy        BackpressurePolicy
+	drained       *sync.Cond // Signalled on mu whenever the buffer is emptied
 	flushInterval time.Duration
+	mergeFanout   int
+	mergeInterval time.Duration
+	codec         string // Compression codec of written files, one of ParquetCodecs
+	rowGroupSize  int
 	mu            sync.Mutex
-	flushMu       sync.Mutex // Separate mutex for flush operations
-	mergeMu       sync.Mutex // Separate mutex for merge operations
-	stopChan      chan struct{}
+	flushMu       sync.RWMutex    // Read-held by each flush, write-held to wait for all of them
+	mergeMu       sync.Mutex      // Separate mutex for merge operations
+	ctx           context.Context // Cancelled by Close to stop every background goroutine
+	cancel        context.CancelFunc
 	flushChan     chan struct{}
 	wg            sync.WaitGroup
-	idCounter     uint64
-	fileCounter   int64 // Counter for generating unique filenames
+	closeOnce     sync.Once
+	closeErr      error
+	fileCounter   int64                // Counter for generating unique filenames
+	lastFlush     time.Time            // When flushed data last became queryable, guarded by mu
+	inFlight      map[string]time.Time // When each running flush took the buffer, by temp CSV path, guarded by mu
+
+	usersMu            sync.Mutex  // Guards users and usersDuringRebuild
+	users              *hll.Sketch // Users of every flushed event, nil until rebuilt when the sketch was missing
+	usersDuringRebuild *hll.Sketch // Users flushed while RebuildUserSketch runs, nil otherwise
 }
 
 // NewParquetStorage creates a new Parquet storage with buffering
 // Uses partitioned append-only files for better scalability
 func NewParquetStorage(db *sql.DB, dataDir string, bufferSize int, flushInterval time.Duration) (*ParquetStorage, error) {
+	return NewParquetStorageWithOptions(db, dataDir, ParquetOptions{BufferSize: bufferSize, FlushInterval: flushInterval})
+}
+
+// NewParquetStorageWithOptions creates a new Parquet storage tuned by opts
+func NewParquetStorageWithOptions(db *sql.DB, dataDir string, opts ParquetOptions) (*ParquetStorage, error) {
 	if dataDir == "" {
 		dataDir = DefaultParquetDir
 	}
+	bufferSize := opts.BufferSize
 	if bufferSize <= 0 {
 		bufferSize = DefaultBufferSize
 	}
+	flushInterval := opts.FlushInterval
 	if flushInterval <= 0 {
 		flushInterval = DefaultFlushInterval
 	}
+	workers := opts.FlushWorkers
+	if workers <= 0 {
+		workers = DefaultFlushWorkers
+	}
+	mergeFanout := opts.MergeFanout
+	if mergeFanout <= 0 {
+		mergeFanout = CompactionFanout
+	}
+	if mergeFanout < 2 {
+		return nil, fmt.Errorf("merge fanout must be at least 2, got %d", mergeFanout)
+	}
+	mergeInterval := opts.MergeInterval
+	if mergeInterval <= 0 {
+		mergeInterval = MergeCheckInterval
+	}
+	codec := strings.ToUpper(opts.Codec)
+	if codec == "" {
+		codec = DefaultParquetCodec
+	}
+	if !slices.Contains(ParquetCodecs, codec) {
+		return nil, fmt.Errorf("unknown Parquet codec %q: must be one of %s", opts.Codec, strings.Join(ParquetCodecs, ", "))
+	}
+	rowGroupSize := opts.RowGroupSize
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
 
 	// Ensure directory exists
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
@@ -66,95 +159,151 @@ func NewParquetStorage(db *sql.DB, dataDir string, bufferSize int, flushInterval
 	ps := &ParquetStorage{
 		db:            db,
 		dataDir:       dataDir,
-		tempCSVPath:   TempCSVFile,
+		flushSlots:    make(chan string, workers),
 		buffer:        make([]domain.Event, 0, bufferSize),
 		bufferSize:    bufferSize,
+		maxBuffer:     bufferSize * MaxBufferMultiplier,
+		policy:        BackpressureBlock,
 		flushInterval: flushInterval,
-		stopChan:      make(chan struct{}),
+		mergeFanout:   mergeFanout,
+		mergeInterval: mergeInterval,
+		codec:         codec,
+		rowGroupSize:  rowGroupSize,
 		flushChan:     make(chan struct{}, 1),
-		idCounter:     1,
 		fileCounter:   time.Now().Unix(), // Initialize with timestamp
+		inFlight:      make(map[string]time.Time),
+	}
+	ps.drained = sync.NewCond(&ps.mu)
+	for i := 0; i < workers; i++ {
+		name := TempCSVFile
+		if i > 0 {
+			name = fmt.Sprintf("events_buffer_%d.csv", i)
+		}
+		ps.tempCSVPaths = append(ps.tempCSVPaths, filepath.Join(dataDir, name))
+		ps.flushSlots <- ps.tempCSVPaths[i]
 	}
 
-	// Start background flusher
-	ps.wg.Add(1)
-	go ps.backgroundFlusher()
+	// Bring files written by older versions up to the current schema and layout
+	if err := ps.migrateSchema(); err != nil {
+		return nil, fmt.Errorf("failed to migrate Parquet schema: %w", err)
+	}
+	if err := ps.partitionLegacyFiles(); err != nil {
+		return nil, fmt.Errorf("failed to partition Parquet files: %w", err)
+	}
+	if err := ps.loadUserSketch(); err != nil {
+		return nil, err
+	}
 
-	// Start background merger
-	ps.wg.Add(1)
-	go ps.backgroundMerger()
+	// Until the first flush, the data is as fresh as the newest existing file
+	files, err := ps.listParquetFileInfo()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.modTime.After(ps.lastFlush) {
+			ps.lastFlush = file.modTime
+		}
+	}
+
+	ps.ctx, ps.cancel = context.WithCancel(context.Background())
+	ps.goBackground(ps.backgroundFlusher)
+	for i := 1; i < workers; i++ {
+		ps.goBackground(ps.flushWorker)
+	}
+	ps.goBackground(ps.backgroundMerger)
+	if ps.users == nil {
+		log.Println("⚠️  User sketch missing; rebuilding it from the Parquet files")
+		ps.goBackground(ps.rebuildMissingUserSketch)
+	}
 
-	log.Printf("✓ Parquet storage initialized: dir=%s, buffer_size=%d, flush_interval=%v",
-		dataDir, bufferSize, flushInterval)
+	log.Printf("✓ Parquet storage initialized: dir=%s, buffer_size=%d, flush_interval=%v, flush_workers=%d, merge_fanout=%d, codec=%s, row_group_size=%d",
+		dataDir, bufferSize, flushInterval, workers, mergeFanout, codec, rowGroupSize)
 
 	return ps, nil
 }
 
-// GetNextID returns the next ID for event insertion
+// GetNextID returns the next ID for event insertion, unique across restarts and
+// across instances with distinct INSTANCE_ID
 func (ps *ParquetStorage) GetNextID() uint64 {
+	return idgen.Next()
+}
+
+// SetBackpressurePolicy selects how writes behave once the buffer hits its hard cap
+func (ps *ParquetStorage) SetBackpressurePolicy(policy BackpressurePolicy) error {
+	if policy != BackpressureBlock && policy != BackpressureReject {
+		return fmt.Errorf("invalid backpressure policy %q", policy)
+	}
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
-	id := ps.idCounter
-	ps.idCounter++
-	return id
+	ps.policy = policy
+	return nil
 }
 
 // Write adds an event to the buffer
 func (ps *ParquetStorage) Write(event domain.Event) error {
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
-
-	ps.buffer = append(ps.buffer, event)
-
-	// Check if buffer is full
-	if len(ps.buffer) >= ps.bufferSize {
-		log.Printf("📦 Buffer full (%d events), triggering flush...", len(ps.buffer))
-		// Trigger flush without blocking
-		select {
-		case ps.flushChan <- struct{}{}:
-		default:
-			// Flush already pending
-		}
-	}
-
-	return nil
+	return ps.append(event)
 }
 
 // WriteBatch adds multiple events to the buffer
 func (ps *ParquetStorage) WriteBatch(events []domain.Event) error {
+	return ps.append(events...)
+}
+
+// append adds events to the buffer, applying the backpressure policy when the
+// buffer would exceed its hard cap. A batch larger than the cap is still accepted
+// into an empty buffer so it can never block forever.
+func (ps *ParquetStorage) append(events ...domain.Event) error {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
+	for len(ps.buffer) > 0 && len(ps.buffer)+len(events) > ps.maxBuffer {
+		if ps.policy == BackpressureReject {
+			ps.triggerFlush()
+			return ErrBufferFull
+		}
+		ps.triggerFlush()
+		ps.drained.Wait()
+	}
+
 	ps.buffer = append(ps.buffer, events...)
 
 	// Check if buffer is full
 	if len(ps.buffer) >= ps.bufferSize {
 		log.Printf("📦 Buffer full (%d events), triggering flush...", len(ps.buffer))
-		// Trigger flush without blocking
-		select {
-		case ps.flushChan <- struct{}{}:
-		default:
-			// Flush already pending
-		}
+		ps.triggerFlush()
 	}
 
 	return nil
 }
 
-// backgroundFlusher runs in a goroutine and flushes buffer periodically
-func (ps *ParquetStorage) backgroundFlusher() {
-	defer ps.wg.Done()
+// triggerFlush signals the background flusher without blocking
+func (ps *ParquetStorage) triggerFlush() {
+	select {
+	case ps.flushChan <- struct{}{}:
+	default:
+		// Flush already pending
+	}
+}
+
+// takeBuffer empties the buffer, waking writers blocked on backpressure, and
+// returns the events it held. Callers must hold ps.mu.
+func (ps *ParquetStorage) takeBuffer() []domain.Event {
+	events := make([]domain.Event, len(ps.buffer))
+	copy(events, ps.buffer)
+	ps.buffer = ps.buffer[:0]
+	ps.drained.Broadcast()
+	return events
+}
 
+// backgroundFlusher runs in a goroutine and flushes buffer periodically
+func (ps *ParquetStorage) backgroundFlusher(ctx context.Context) {
 	ticker := time.NewTicker(ps.flushInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ps.stopChan:
-			// Final flush before shutdown
-			if err := ps.Flush(); err != nil {
-				log.Printf("❌ Error during final flush: %v", err)
-			}
+		case <-ctx.Done():
+			// Final flush is done by Close once all goroutines have exited
 			return
 
 		case <-ticker.C:
@@ -172,82 +321,121 @@ func (ps *ParquetStorage) backgroundFlusher() {
 	}
 }
 
-// Flush writes buffered events to a new Parquet file (append-only, no merge)
+// flushWorker runs in a goroutine for each flush worker past the first. It picks up
+// flushes triggered by a full buffer while other workers are still writing, so
+// writers refill the buffer instead of waiting on a single flush.
+func (ps *ParquetStorage) flushWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ps.flushChan:
+			if err := ps.Flush(); err != nil {
+				log.Printf("❌ Error during manual flush: %v", err)
+			}
+		}
+	}
+}
+
+// Flush writes buffered events to a new Parquet file (append-only, no merge). Up to
+// the configured number of flush workers may run at once.
 func (ps *ParquetStorage) Flush() error {
-	// Use separate mutex to prevent concurrent flushes
+	ps.flushMu.RLock()
+	defer ps.flushMu.RUnlock()
+
+	csvPath := <-ps.flushSlots
+	defer func() { ps.flushSlots <- csvPath }()
+
+	_, err := ps.flush(csvPath)
+	return err
+}
+
+// FlushSync blocks until the current buffer is on disk, waiting for any flush already
+// in progress, and reports how many events were written and to which files
+func (ps *ParquetStorage) FlushSync() (domain.FlushResult, error) {
 	ps.flushMu.Lock()
 	defer ps.flushMu.Unlock()
+	return ps.flush(ps.tempCSVPaths[0])
+}
 
+// flush writes the buffer through the temp CSV at csvPath, one file per project.
+// Callers must hold flushMu and own csvPath, either through a flush slot or the
+// write lock.
+func (ps *ParquetStorage) flush(csvPath string) (domain.FlushResult, error) {
 	ps.mu.Lock()
 	if len(ps.buffer) == 0 {
 		ps.mu.Unlock()
-		return nil
+		return domain.FlushResult{}, nil
 	}
 
 	// Copy buffer and clear it
-	eventsToWrite := make([]domain.Event, len(ps.buffer))
-	copy(eventsToWrite, ps.buffer)
-	ps.buffer = ps.buffer[:0]
+	eventsToWrite := ps.takeBuffer()
+	ps.inFlight[csvPath] = time.Now()
+	ps.fileCounter++
+	fileNumber := ps.fileCounter
 	ps.mu.Unlock()
 
+	written := false
+	defer func() { ps.finishFlush(csvPath, written) }()
+
 	start := time.Now()
 	log.Printf("💾 Flushing %d events to Parquet file...", len(eventsToWrite))
 
-	// Write events to temporary CSV file
-	csvFile, err := os.Create(ps.tempCSVPath)
-	if err != nil {
-		return fmt.Errorf("failed to create temp CSV: %w", err)
+	// Each project's events go to a file in its own partition, so queries filtered
+	// to one project read only that project's files
+	byProject := make(map[string][]domain.Event)
+	for _, event := range eventsToWrite {
+		partition := partitionName(event.ProjectID)
+		byProject[partition] = append(byProject[partition], event)
 	}
+	partitions := make([]string, 0, len(byProject))
+	for partition := range byProject {
+		partitions = append(partitions, partition)
+	}
+	sort.Strings(partitions)
+
 	defer func() {
-		if err := csvFile.Close(); err != nil {
-			log.Printf("Warning: failed to close CSV file: %v", err)
-		}
-		if err := os.Remove(ps.tempCSVPath); err != nil {
+		if err := os.Remove(csvPath); err != nil && !os.IsNotExist(err) {
 			log.Printf("Warning: failed to remove temp CSV file: %v", err)
 		}
 	}()
 
-	// Write CSV data
-	if _, err := fmt.Fprintf(csvFile, "id,timestamp,event_name,user_id,session_id,session_duration,url,referrer,user_agent,ip,country,browser,os,device,is_bot,project_id,channel\n"); err != nil {
-		return fmt.Errorf("failed to write CSV header: %w", err)
-	}
-	for _, event := range eventsToWrite {
-		// Format timestamp as ISO8601 string for DuckDB
-		timestampStr := event.Timestamp.UTC().Format("2006-01-02 15:04:05.000000")
-		if _, err := fmt.Fprintf(csvFile, "%d,%s,%s,%s,%s,%d,%s,%s,%s,%s,%s,%s,%s,%s,%t,%s,%s\n",
-			event.ID,
-			timestampStr,
-			escapeCsv(event.EventName),
-			escapeCsv(event.UserID),
-			escapeCsv(event.SessionID),
-			event.SessionDuration,
-			escapeCsv(event.URL),
-			escapeCsv(event.Referrer),
-			escapeCsv(event.UserAgent),
-			escapeCsv(event.IP),
-			escapeCsv(event.Country),
-			escapeCsv(event.Browser),
-			escapeCsv(event.OS),
-			escapeCsv(event.Device),
-			event.IsBot,
-			escapeCsv(event.ProjectID),
-			escapeCsv(event.Channel),
-		); err != nil {
-			return fmt.Errorf("failed to write CSV row: %w", err)
+	// Generate unique filename using timestamp and counter
+	// This allows for append-only writes without merging
+	timestamp := time.Now().UTC().Format("20060102_150405")
+	result := domain.FlushResult{EventsFlushed: len(eventsToWrite)}
+	for _, partition := range partitions {
+		events := byProject[partition]
+		dir, err := ps.partitionDir(events[0].ProjectID)
+		if err != nil {
+			return domain.FlushResult{}, err
 		}
+		outputFile := fmt.Sprintf("%s/events_%s_%d.parquet", dir, timestamp, fileNumber)
+		if err := ps.writeParquetFile(csvPath, outputFile, events); err != nil {
+			return domain.FlushResult{}, err
+		}
+		written = true
+		ps.recordUsers(events)
+		result.Files = append(result.Files, outputFile)
 	}
+	result.File = result.Files[0]
 
-	if err := csvFile.Close(); err != nil {
-		return fmt.Errorf("failed to close CSV file: %w", err)
-	}
+	duration := time.Since(start)
+	log.Printf("✅ Flushed %d events to %d files in %v (%.0f events/sec)",
+		len(eventsToWrite), len(result.Files), duration, float64(len(eventsToWrite))/duration.Seconds())
 
-	// Generate unique filename using timestamp and counter
-	// This allows for append-only writes without merging
-	ps.fileCounter++
-	timestamp := time.Now().UTC().Format("20060102_150405")
-	outputFile := fmt.Sprintf("%s/events_%s_%d.parquet", ps.dataDir, timestamp, ps.fileCounter)
+	return result, nil
+}
 
-	// Convert CSV to Parquet with ZSTD compression
+// writeParquetFile writes events to outputFile through the temp CSV at csvPath
+func (ps *ParquetStorage) writeParquetFile(csvPath, outputFile string, events []domain.Event) error {
+	// Write events to temporary CSV file
+	if err := writeEventsCSV(csvPath, events); err != nil {
+		return err
+	}
+
+	// Convert CSV to Parquet
 	// Each file is independent and sorted by timestamp
 	copyQuery := fmt.Sprintf(`
 		COPY (
@@ -271,214 +459,300 @@ func (ps *ParquetStorage) Flush() error {
 				device,
 				is_bot,
 				project_id,
-				channel
-			FROM read_csv('%s', 
-				AUTO_DETECT=TRUE,
-				header=true,
-				timestampformat='%%Y-%%m-%%d %%H:%%M:%%S.%%f'
-			)
+				channel,
+				received_at,
+				region,
+				language,
+				screen_width,
+				screen_height,
+				sample_rate
+			FROM read_csv('%s', %s)
 			ORDER BY timestamp
-		) TO '%s' (FORMAT 'PARQUET', CODEC 'ZSTD', ROW_GROUP_SIZE 100000)
-	`, ps.tempCSVPath, outputFile)
+		) TO '%s' (%s)
+	`, csvPath, csvReadOptions(), outputFile, ps.copyOptions())
 
-	_, err = ps.db.Exec(copyQuery)
-	if err != nil {
+	if _, err := ps.db.Exec(copyQuery); err != nil {
 		return fmt.Errorf("failed to create Parquet file: %w", err)
 	}
+	return nil
+}
 
-	duration := time.Since(start)
-	log.Printf("✅ Flushed %d events to %s in %v (%.0f events/sec)",
-		len(eventsToWrite), outputFile, duration, float64(len(eventsToWrite))/duration.Seconds())
+// copyOptions returns the COPY options files are written with
+func (ps *ParquetStorage) copyOptions() string {
+	return fmt.Sprintf("FORMAT 'PARQUET', CODEC '%s', ROW_GROUP_SIZE %d", ps.codec, ps.rowGroupSize)
+}
 
-	return nil
+// finishFlush marks the flush through csvPath as done. When it wrote its file, data
+// is queryable up to now, or up to when the oldest flush still running took the
+// buffer, since the events that flush holds are not on disk yet.
+func (ps *ParquetStorage) finishFlush(csvPath string, written bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.inFlight, csvPath)
+	if !written {
+		return
+	}
+	asOf := time.Now()
+	for _, taken := range ps.inFlight {
+		if taken.Before(asOf) {
+			asOf = taken
+		}
+	}
+	if asOf.After(ps.lastFlush) {
+		ps.lastFlush = asOf
+	}
 }
 
-// escapeCsv escapes CSV fields
-func escapeCsv(s string) string {
-	if s == "" {
-		return ""
-	}
-	// Simple CSV escaping - quote fields with commas or quotes
-	needsQuote := false
-	for _, c := range s {
-		if c == ',' || c == '"' || c == '\n' || c == '\r' {
-			needsQuote = true
-			break
+// csvColumns lists the buffer CSV columns in write order together with the
+// DuckDB type each one is read back as. Declaring the types up front stops
+// read_csv from sniffing values such as a user_id of "007" into integers.
+var csvColumns = []struct {
+	name    string
+	sqlType string
+}{
+	{"id", "UBIGINT"},
+	{"timestamp", "TIMESTAMP"},
+	{"event_name", "VARCHAR"},
+	{"user_id", "VARCHAR"},
+	{"session_id", "VARCHAR"},
+	{"session_duration", "INTEGER"},
+	{"url", "VARCHAR"},
+	{"referrer", "VARCHAR"},
+	{"user_agent", "VARCHAR"},
+	{"ip", "VARCHAR"},
+	{"country", "VARCHAR"},
+	{"browser", "VARCHAR"},
+	{"os", "VARCHAR"},
+	{"device", "VARCHAR"},
+	{"is_bot", "BOOLEAN"},
+	{"project_id", "VARCHAR"},
+	{"channel", "VARCHAR"},
+	{"received_at", "TIMESTAMP"},
+	{"region", "VARCHAR"},
+	{"language", "VARCHAR"},
+	{"screen_width", "INTEGER"},
+	{"screen_height", "INTEGER"},
+	{"sample_rate", "DOUBLE"},
+}
+
+// csvReadOptions returns the read_csv arguments matching writeEventsCSV
+func csvReadOptions() string {
+	columns := make([]string, len(csvColumns))
+	for i, col := range csvColumns {
+		columns[i] = fmt.Sprintf("'%s': '%s'", col.name, col.sqlType)
+	}
+	return fmt.Sprintf(`columns={%s},
+				header=true,
+				delim=',',
+				quote='"',
+				escape='"',
+				allow_quoted_nulls=false,
+				timestampformat='%%Y-%%m-%%d %%H:%%M:%%S.%%f'`, strings.Join(columns, ", "))
+}
+
+// writeEventsCSV writes events to a CSV file that DuckDB can load with csvReadOptions
+func writeEventsCSV(path string, events []domain.Event) (err error) {
+	csvFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create temp CSV: %w", err)
+	}
+	defer func() {
+		if closeErr := csvFile.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close CSV file: %w", closeErr)
 		}
+	}()
+	w := bufio.NewWriter(csvFile)
+
+	header := make([]string, len(csvColumns))
+	for i, col := range csvColumns {
+		header[i] = col.name
 	}
-	if needsQuote {
-		// Escape quotes by doubling them
-		escaped := ""
-		for _, c := range s {
-			if c == '"' {
-				escaped += "\"\""
-			} else {
-				escaped += string(c)
-			}
+	if _, err := fmt.Fprintln(w, strings.Join(header, ",")); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for _, event := range events {
+		// Format timestamp as ISO8601 string for DuckDB
+		timestampStr := event.Timestamp.UTC().Format("2006-01-02 15:04:05.000000")
+		receivedAt := event.ReceivedAt
+		if receivedAt.IsZero() {
+			receivedAt = event.Timestamp
+		}
+		receivedAtStr := receivedAt.UTC().Format("2006-01-02 15:04:05.000000")
+		if _, err := fmt.Fprintf(w, "%d,%s,%s,%s,%s,%d,%s,%s,%s,%s,%s,%s,%s,%s,%t,%s,%s,%s,%s,%s,%d,%d,%g\n",
+			event.ID,
+			timestampStr,
+			escapeCsv(event.EventName),
+			escapeCsv(event.UserID),
+			escapeCsv(event.SessionID),
+			event.SessionDuration,
+			escapeCsv(event.URL),
+			escapeCsv(event.Referrer),
+			escapeCsv(event.UserAgent),
+			escapeCsv(event.IP),
+			escapeCsv(event.Country),
+			escapeCsv(event.Browser),
+			escapeCsv(event.OS),
+			escapeCsv(event.Device),
+			event.IsBot,
+			escapeCsv(event.ProjectID),
+			escapeCsv(event.Channel),
+			receivedAtStr,
+			escapeCsv(event.Region),
+			escapeCsv(event.Language),
+			event.ScreenWidth,
+			event.ScreenHeight,
+			event.StoredSampleRate(),
+		); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
 		}
-		return "\"" + escaped + "\""
 	}
-	return s
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write CSV file: %w", err)
+	}
+	return nil
+}
+
+// escapeCsv quotes a CSV field, doubling any embedded quotes.
+// Every field is quoted so read_csv (with allow_quoted_nulls=false) keeps empty
+// strings empty instead of turning them into NULL. Invalid UTF-8 and NUL bytes
+// are replaced because DuckDB rejects them, and a single bad value would
+// otherwise fail the whole flush.
+func escapeCsv(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	s = strings.ReplaceAll(s, "\x00", "\uFFFD")
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
 }
 
 // Close gracefully shuts down the storage, flushing any remaining data
+// Safe to call multiple times; later calls return the result of the first
 func (ps *ParquetStorage) Close() error {
-	log.Println("🛑 Shutting down Parquet storage...")
-
-	// Stop background flusher
-	close(ps.stopChan)
+	ps.closeOnce.Do(func() {
+		log.Println("🛑 Shutting down Parquet storage...")
+
+		// Stop every background goroutine; a merge in progress is aborted and its
+		// temp file removed, the source files stay untouched
+		ps.cancel()
+		ps.wg.Wait()
+
+		// Final flush before shutdown
+		if err := ps.Flush(); err != nil {
+			ps.closeErr = fmt.Errorf("final flush failed: %w", err)
+			log.Printf("❌ Error during final flush: %v", err)
+			return
+		}
 
-	// Wait for background flusher to complete
-	ps.wg.Wait()
+		log.Println("✓ Parquet storage shut down successfully")
+	})
+	return ps.closeErr
+}
 
-	log.Println("✓ Parquet storage shut down successfully")
-	return nil
+// goBackground runs fn in a goroutine that Close cancels through the storage context
+// and waits for. Every long-running task of the storage must be started this way.
+func (ps *ParquetStorage) goBackground(fn func(ctx context.Context)) {
+	ps.wg.Add(1)
+	go func() {
+		defer ps.wg.Done()
+		fn(ps.ctx)
+	}()
 }
 
 // GetFilePath returns the Parquet directory path pattern for DuckDB queries
-// Use with read_parquet('data/events/*.parquet') to query all files
+// Use with read_parquet('data/events/**/*.parquet') to query the files of every project
 func (ps *ParquetStorage) GetFilePath() string {
-	return fmt.Sprintf("%s/*.parquet", ps.dataDir)
+	return fmt.Sprintf("%s/**/*.parquet", ps.dataDir)
 }
 
 // backgroundMerger runs periodically to merge small Parquet files when there are too many
-func (ps *ParquetStorage) backgroundMerger() {
-	defer ps.wg.Done()
-
-	ticker := time.NewTicker(MergeCheckInterval)
+func (ps *ParquetStorage) backgroundMerger(ctx context.Context) {
+	ticker := time.NewTicker(ps.mergeInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ps.stopChan:
+		case <-ctx.Done():
 			return
 
 		case <-ticker.C:
 			// Check file count and merge if needed
-			if err := ps.checkAndMergeFiles(); err != nil {
+			if err := ps.checkAndMergeFiles(ctx); err != nil && ctx.Err() == nil {
 				log.Printf("❌ Error during file merge: %v", err)
 			}
 		}
 	}
 }
 
-// checkAndMergeFiles checks the number of Parquet files and merges them if needed
-func (ps *ParquetStorage) checkAndMergeFiles() error {
+// Reset discards buffered events and deletes every Parquet file, returning the number of files removed
+func (ps *ParquetStorage) Reset() (int, error) {
+	// Hold the flush and merge locks so no file is being written while we delete
+	ps.flushMu.Lock()
+	defer ps.flushMu.Unlock()
 	ps.mergeMu.Lock()
 	defer ps.mergeMu.Unlock()
 
-	// List all parquet files in directory
-	files, err := os.ReadDir(ps.dataDir)
-	if err != nil {
-		return fmt.Errorf("failed to read data directory: %w", err)
-	}
-
-	// Count parquet files
-	parquetFiles := []string{}
-	for _, file := range files {
-		if !file.IsDir() && len(file.Name()) > 8 && file.Name()[len(file.Name())-8:] == ".parquet" {
-			parquetFiles = append(parquetFiles, file.Name())
-		}
-	}
-
-	fileCount := len(parquetFiles)
-	if fileCount <= MaxFilesBeforeMerge {
-		return nil // No merge needed
-	}
-
-	log.Printf("🔄 Found %d Parquet files (max: %d), starting merge...", fileCount, MaxFilesBeforeMerge)
-	start := time.Now()
-
-	// Generate merged filename with timestamp
-	timestamp := time.Now().UTC().Format("20060102_150405")
-	mergedFile := fmt.Sprintf("%s/events_merged_%s.parquet", ps.dataDir, timestamp)
-	tempMergedFile := mergedFile + ".tmp"
-
-	// Use DuckDB to merge all files into one
-	// This is efficient as DuckDB handles the Parquet format natively
-	mergeQuery := fmt.Sprintf(`
-		COPY (
-			SELECT 
-				id,
-				timestamp,
-				date_trunc('hour', timestamp)  AS date_hour,
-				date_trunc('day', timestamp)   AS date_day,
-				date_trunc('month', timestamp) AS date_month,
-				event_name,
-				user_id,
-				session_id,
-				session_duration,
-				url,
-				referrer,
-				user_agent,
-				ip,
-				country,
-				browser,
-				os,
-				device,
-				is_bot,
-				project_id,
-				channel
-			FROM read_parquet('%s/*.parquet')
-			ORDER BY timestamp
-		) TO '%s' (FORMAT 'PARQUET', CODEC 'ZSTD', ROW_GROUP_SIZE 100000)
-	`, ps.dataDir, tempMergedFile)
+	ps.mu.Lock()
+	discarded := len(ps.takeBuffer())
+	ps.lastFlush = time.Time{}
+	ps.mu.Unlock()
 
-	_, err = ps.db.Exec(mergeQuery)
+	files, err := ps.listParquetFiles()
 	if err != nil {
-		// Clean up temp file on error
-		if removeErr := os.Remove(tempMergedFile); removeErr != nil {
-			log.Printf("Warning: failed to remove temp merged file: %v", removeErr)
-		}
-		return fmt.Errorf("failed to merge Parquet files: %w", err)
+		return 0, err
 	}
 
-	// Atomic rename
-	if err := os.Rename(tempMergedFile, mergedFile); err != nil {
-		removeErr := os.Remove(tempMergedFile)
-		if removeErr != nil {
-			log.Printf("Warning: failed to remove temp merged file after rename failure: %v", removeErr)
+	removed := 0
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return removed, fmt.Errorf("failed to delete %s: %w", file, err)
 		}
-		return fmt.Errorf("failed to rename merged file: %w", err)
+		removed++
 	}
 
-	// Get merged file size
-	mergedFileInfo, err := os.Stat(mergedFile)
+	ps.usersMu.Lock()
+	ps.users = hll.New()
+	err = ps.saveUserSketch()
+	ps.usersMu.Unlock()
 	if err != nil {
-		return fmt.Errorf("failed to stat merged file: %w", err)
+		return removed, err
 	}
 
-	// Delete old files
-	deletedCount := 0
-	for _, fileName := range parquetFiles {
-		filePath := fmt.Sprintf("%s/%s", ps.dataDir, fileName)
-		if err := os.Remove(filePath); err != nil {
-			log.Printf("⚠️  Warning: failed to delete old file %s: %v", fileName, err)
-		} else {
-			deletedCount++
-		}
-	}
-
-	duration := time.Since(start)
-	log.Printf("✅ Merged %d files into 1 file (%.2f MB) in %v",
-		deletedCount, float64(mergedFileInfo.Size())/(1024*1024), duration)
+	log.Printf("🧹 Reset Parquet storage: removed %d files, discarded %d buffered events", removed, discarded)
+	return removed, nil
+}
 
-	return nil
+// LastFlush returns when buffered events were last written to a Parquet file, or the
+// zero time when there is no data on disk. Events tracked since are not queryable yet.
+func (ps *ParquetStorage) LastFlush() time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.lastFlush
 }
 
-// GetFileCount returns the current number of Parquet files
+// GetFileCount returns the current number of Parquet files, across every project
 func (ps *ParquetStorage) GetFileCount() (int, error) {
-	files, err := os.ReadDir(ps.dataDir)
+	files, err := ps.listParquetFiles()
 	if err != nil {
-		return 0, fmt.Errorf("failed to read data directory: %w", err)
+		return 0, err
 	}
+	return len(files), nil
+}
 
-	count := 0
-	for _, file := range files {
-		if !file.IsDir() && len(file.Name()) > 8 && file.Name()[len(file.Name())-8:] == ".parquet" {
-			count++
-		}
+// CheckWritable confirms new files can be written to the data directory, by
+// writing and removing an empty probe file
+func (ps *ParquetStorage) CheckWritable() error {
+	probe, err := os.CreateTemp(ps.dataDir, ".ready-*")
+	if err != nil {
+		return fmt.Errorf("data directory is not writable: %w", err)
 	}
-
-	return count, nil
+	name := probe.Name()
+	closeErr := probe.Close()
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove probe file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("data directory is not writable: %w", closeErr)
+	}
+	return nil
 }
@@ -0,0 +1,590 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/duckdb/duckdb-go/v2"
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// openTestDB opens an in-memory DuckDB database, skipping when the driver is unavailable
+func openTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Skipf("DuckDB driver not available: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Skipf("DuckDB not available: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Warning: failed to close database: %v", err)
+		}
+	})
+	return db
+}
+
+// newTestStorage creates a ParquetStorage in a temp directory with a long flush interval
+// so tests control exactly when data hits disk
+func newTestStorage(t testing.TB) *ParquetStorage {
+	t.Helper()
+
+	db := openTestDB(t)
+	ps, err := NewParquetStorage(db, t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := ps.Close(); err != nil {
+			t.Logf("Warning: failed to close Parquet storage: %v", err)
+		}
+	})
+	return ps
+}
+
+func TestEscapeCsv(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Empty string", "", `""`},
+		{"Plain value", "page_view", `"page_view"`},
+		{"Comma", "a,b", `"a,b"`},
+		{"Quotes", `say "hi"`, `"say ""hi"""`},
+		{"Newline", "line\nbreak", "\"line\nbreak\""},
+		{"Unicode", "مرحبا 🚀", `"مرحبا 🚀"`},
+		{"NUL byte", "a\x00b", "\"a\uFFFDb\""},
+		{"Invalid UTF-8", "a\xffb", "\"a\uFFFDb\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeCsv(tt.input); got != tt.expected {
+				t.Errorf("escapeCsv(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+// FuzzEscapeCsvRoundTrip writes events through the flush CSV path and reads them
+// back from the resulting Parquet file, asserting every string field survives intact
+func FuzzEscapeCsvRoundTrip(f *testing.F) {
+	seeds := []string{
+		"", "plain", "comma,separated", `say "hi"`, `"`, `""`, ",", "line\nbreak",
+		"carriage\r\nreturn", "lone\rreturn", " padded ", "007", "NULL", "true", `\`,
+		"ünïcødé 🚀 عربي", "a\x00b", "\xff\xfe",
+	}
+	for _, s := range seeds {
+		f.Add(s, s+","+s)
+	}
+
+	ps := newTestStorage(f)
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		event := domain.Event{
+			ID:              ps.GetNextID(),
+			Timestamp:       time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+			EventName:       a,
+			UserID:          b,
+			SessionID:       a,
+			SessionDuration: len(a),
+			URL:             b,
+			Referrer:        a,
+			UserAgent:       b,
+			IP:              a,
+			Country:         b,
+			Browser:         a,
+			OS:              b,
+			Device:          a,
+			IsBot:           len(b)%2 == 0,
+			ProjectID:       b,
+			Channel:         a,
+		}
+
+		if err := ps.Write(event); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := ps.Flush(); err != nil {
+			t.Fatalf("Flush failed for %q / %q: %v", a, b, err)
+		}
+
+		var got domain.Event
+		query := fmt.Sprintf(`
+			SELECT event_name, user_id, session_id, session_duration, url, referrer, user_agent,
+				ip, country, browser, os, device, is_bot, project_id, channel
+			FROM read_parquet('%s')
+			WHERE id = ?
+		`, ps.GetFilePath())
+		err := ps.db.QueryRow(query, event.ID).Scan(
+			&got.EventName, &got.UserID, &got.SessionID, &got.SessionDuration, &got.URL,
+			&got.Referrer, &got.UserAgent, &got.IP, &got.Country, &got.Browser, &got.OS,
+			&got.Device, &got.IsBot, &got.ProjectID, &got.Channel,
+		)
+		if err != nil {
+			t.Fatalf("Failed to read event back: %v", err)
+		}
+
+		// Invalid UTF-8 and NUL bytes are replaced on write, everything else must match exactly
+		sanitize := func(s string) string {
+			return strings.ReplaceAll(strings.ToValidUTF8(s, "\uFFFD"), "\x00", "\uFFFD")
+		}
+		want := event
+		for _, field := range []*string{
+			&want.EventName, &want.UserID, &want.SessionID, &want.URL, &want.Referrer,
+			&want.UserAgent, &want.IP, &want.Country, &want.Browser, &want.OS,
+			&want.Device, &want.ProjectID, &want.Channel,
+		} {
+			*field = sanitize(*field)
+		}
+		want.ID, want.Timestamp = 0, time.Time{}
+
+		if got != want {
+			t.Errorf("Round trip mismatch:\n got: %+v\nwant: %+v", got, want)
+		}
+	})
+}
+
+func TestReset(t *testing.T) {
+	ps := newTestStorage(t)
+
+	for i := 0; i < 2; i++ {
+		if err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := ps.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+	if err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "buffered"}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	removed, err := ps.Reset()
+	if err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 files removed, got %d", removed)
+	}
+
+	count, err := ps.GetFileCount()
+	if err != nil {
+		t.Fatalf("GetFileCount failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no Parquet files after reset, got %d", count)
+	}
+
+	// The buffered event must be discarded, not flushed after the reset
+	if err := ps.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if count, _ := ps.GetFileCount(); count != 0 {
+		t.Errorf("Expected buffered events to be discarded, got %d files", count)
+	}
+}
+
+func TestCloseIsIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	ps, err := NewParquetStorage(db, t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+
+	if err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err := ps.Close(); err != nil {
+		t.Fatalf("First Close failed: %v", err)
+	}
+	if err := ps.Close(); err != nil {
+		t.Fatalf("Second Close failed: %v", err)
+	}
+
+	count, err := ps.GetFileCount()
+	if err != nil {
+		t.Fatalf("GetFileCount failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected final flush to write 1 file, got %d", count)
+	}
+}
+
+func TestCloseStopsBackgroundGoroutines(t *testing.T) {
+	db := openTestDB(t)
+	ps, err := NewParquetStorage(db, t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+
+	// An extra task that only stops when cancelled, standing in for retention or rollups
+	stopped := make(chan struct{})
+	ps.goBackground(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- ps.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return within 5s; a background goroutine did not exit")
+	}
+
+	select {
+	case <-stopped:
+	default:
+		t.Error("Expected background task to have exited before Close returned")
+	}
+}
+
+func TestFlushSync(t *testing.T) {
+	ps := newTestStorage(t)
+
+	result, err := ps.FlushSync()
+	if err != nil {
+		t.Fatalf("FlushSync on empty buffer failed: %v", err)
+	}
+	if result.EventsFlushed != 0 || result.File != "" {
+		t.Errorf("Expected empty result for empty buffer, got %+v", result)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	result, err = ps.FlushSync()
+	if err != nil {
+		t.Fatalf("FlushSync failed: %v", err)
+	}
+	if result.EventsFlushed != 3 {
+		t.Errorf("Expected 3 events flushed, got %d", result.EventsFlushed)
+	}
+
+	var count int
+	if err := ps.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM read_parquet('%s')", result.File)).Scan(&count); err != nil {
+		t.Fatalf("Failed to read flushed file: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 rows in %s, got %d", result.File, count)
+	}
+}
+
+// stallFlushes holds the flush lock so background flushes cannot drain the buffer,
+// returning a function that releases it
+func stallFlushes(ps *ParquetStorage) func() {
+	ps.flushMu.Lock()
+	var once sync.Once
+	return func() { once.Do(ps.flushMu.Unlock) }
+}
+
+func TestBackpressureReject(t *testing.T) {
+	db := openTestDB(t)
+	ps, err := NewParquetStorage(db, t.TempDir(), 10, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+	defer func() {
+		if err := ps.Close(); err != nil {
+			t.Logf("Warning: failed to close Parquet storage: %v", err)
+		}
+	}()
+	if err := ps.SetBackpressurePolicy(BackpressureReject); err != nil {
+		t.Fatalf("SetBackpressurePolicy failed: %v", err)
+	}
+
+	release := stallFlushes(ps)
+	defer release()
+
+	rejected := 0
+	for i := 0; i < 100; i++ {
+		err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"})
+		if errors.Is(err, ErrBufferFull) {
+			rejected++
+		} else if err != nil {
+			t.Fatalf("Unexpected write error: %v", err)
+		}
+	}
+
+	ps.mu.Lock()
+	buffered := len(ps.buffer)
+	ps.mu.Unlock()
+
+	if buffered > ps.maxBuffer {
+		t.Errorf("Buffer grew to %d events, cap is %d", buffered, ps.maxBuffer)
+	}
+	if rejected != 100-ps.maxBuffer {
+		t.Errorf("Expected %d writes rejected, got %d", 100-ps.maxBuffer, rejected)
+	}
+
+	release()
+	if err := ps.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}); err != nil {
+		t.Errorf("Expected write to succeed after flush, got %v", err)
+	}
+}
+
+func TestBackpressureBlock(t *testing.T) {
+	db := openTestDB(t)
+	ps, err := NewParquetStorage(db, t.TempDir(), 10, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+	defer func() {
+		if err := ps.Close(); err != nil {
+			t.Logf("Warning: failed to close Parquet storage: %v", err)
+		}
+	}()
+
+	release := stallFlushes(ps)
+	defer release()
+
+	batch := make([]domain.Event, ps.maxBuffer)
+	for i := range batch {
+		batch[i] = domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}
+	}
+	if err := ps.WriteBatch(batch); err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "blocked"})
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected write to block while flushes are stalled, returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ps.mu.Lock()
+	buffered := len(ps.buffer)
+	ps.mu.Unlock()
+	if buffered > ps.maxBuffer {
+		t.Errorf("Buffer grew to %d events, cap is %d", buffered, ps.maxBuffer)
+	}
+
+	// Once the flush goes through the blocked write must complete
+	release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Blocked write failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write still blocked after flush drained the buffer")
+	}
+}
+
+func TestSetBackpressurePolicyRejectsUnknown(t *testing.T) {
+	ps := &ParquetStorage{}
+	if err := ps.SetBackpressurePolicy("drop"); err == nil {
+		t.Error("Expected error for unknown backpressure policy")
+	}
+}
+
+func TestNewParquetStorageRejectsMergeFanout(t *testing.T) {
+	if _, err := NewParquetStorageWithOptions(nil, t.TempDir(), ParquetOptions{MergeFanout: 1}); err == nil {
+		t.Error("Expected error for a merge fanout of 1")
+	}
+}
+
+func TestNewParquetStorageRejectsCodec(t *testing.T) {
+	if _, err := NewParquetStorageWithOptions(nil, t.TempDir(), ParquetOptions{Codec: "LZO"}); err == nil {
+		t.Error("Expected error for an unknown codec")
+	}
+}
+
+func TestParquetCodec(t *testing.T) {
+	db := openTestDB(t)
+	ps, err := NewParquetStorageWithOptions(db, t.TempDir(), ParquetOptions{Codec: "snappy", RowGroupSize: 50000, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := ps.Close(); err != nil {
+			t.Logf("Warning: failed to close Parquet storage: %v", err)
+		}
+	})
+
+	for i := 0; i < 5; i++ {
+		if err := ps.Write(domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	result, err := ps.FlushSync()
+	if err != nil {
+		t.Fatalf("FlushSync failed: %v", err)
+	}
+
+	var rows int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM read_parquet('%s')", result.File)).Scan(&rows); err != nil {
+		t.Fatalf("Failed to read flushed file: %v", err)
+	}
+	if rows != 5 {
+		t.Errorf("Expected 5 events read back, got %d", rows)
+	}
+
+	codecRows, err := db.Query(fmt.Sprintf("SELECT DISTINCT compression FROM parquet_metadata('%s')", result.File))
+	if err != nil {
+		t.Fatalf("Failed to read Parquet metadata: %v", err)
+	}
+	defer func() {
+		if err := codecRows.Close(); err != nil {
+			t.Logf("Warning: failed to close rows: %v", err)
+		}
+	}()
+	var codecs []string
+	for codecRows.Next() {
+		var codec string
+		if err := codecRows.Scan(&codec); err != nil {
+			t.Fatalf("Failed to read Parquet metadata: %v", err)
+		}
+		codecs = append(codecs, codec)
+	}
+	if len(codecs) != 1 || codecs[0] != "SNAPPY" {
+		t.Errorf("Expected SNAPPY compression, got %v", codecs)
+	}
+}
+
+func TestFinishFlushWaitsForOlderFlushes(t *testing.T) {
+	older := time.Now().Add(-time.Minute)
+	ps := &ParquetStorage{inFlight: map[string]time.Time{"a.csv": older, "b.csv": time.Now()}}
+
+	// A later flush finishing first only vouches for data up to the older one
+	ps.finishFlush("b.csv", true)
+	if !ps.lastFlush.Equal(older) {
+		t.Errorf("Expected data as of the older flush %v, got %v", older, ps.lastFlush)
+	}
+
+	// A failed flush leaves the freshness alone
+	ps.finishFlush("a.csv", false)
+	if !ps.lastFlush.Equal(older) {
+		t.Errorf("Expected a failed flush to keep %v, got %v", older, ps.lastFlush)
+	}
+	if len(ps.inFlight) != 0 {
+		t.Errorf("Expected no flushes in flight, got %v", ps.inFlight)
+	}
+
+	ps.inFlight["a.csv"] = time.Now()
+	ps.finishFlush("a.csv", true)
+	if !ps.lastFlush.After(older) {
+		t.Errorf("Expected data to be fresh once no flush is running, got %v", ps.lastFlush)
+	}
+}
+
+func TestConcurrentFlushWorkers(t *testing.T) {
+	db := openTestDB(t)
+	ps, err := NewParquetStorageWithOptions(db, t.TempDir(), ParquetOptions{BufferSize: 50, FlushInterval: time.Hour, FlushWorkers: 4})
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+
+	const writers, batches, batchSize = 8, 20, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := 0; b < batches; b++ {
+				batch := make([]domain.Event, batchSize)
+				for i := range batch {
+					batch[i] = domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"}
+				}
+				if err := ps.WriteBatch(batch); err != nil {
+					t.Errorf("WriteBatch failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ps.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	var rows, ids int
+	query := fmt.Sprintf("SELECT COUNT(*), COUNT(DISTINCT id) FROM read_parquet('%s')", ps.GetFilePath())
+	if err := db.QueryRow(query).Scan(&rows, &ids); err != nil {
+		t.Fatalf("Failed to read Parquet files: %v", err)
+	}
+	if want := writers * batches * batchSize; rows != want || ids != want {
+		t.Errorf("Expected %d events with unique ids, got %d rows and %d ids", want, rows, ids)
+	}
+}
+
+// BenchmarkWriteBatch measures ingestion throughput with one and several flush
+// workers, with a buffer small enough that flushes run throughout
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+
+	ps := &ParquetStorage{dataDir: dir}
+	if err := ps.CheckWritable(); err != nil {
+		t.Fatalf("Expected the data directory to be writable, got %v", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("Expected the probe file to be removed, got %v (%v)", entries, err)
+	}
+
+	missing := &ParquetStorage{dataDir: filepath.Join(dir, "missing")}
+	if err := missing.CheckWritable(); err == nil {
+		t.Error("Expected an error for a missing data directory")
+	}
+}
+
+func BenchmarkWriteBatch(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("flush_workers=%d", workers), func(b *testing.B) {
+			db := openTestDB(b)
+			ps, err := NewParquetStorageWithOptions(db, b.TempDir(), ParquetOptions{BufferSize: 5000, FlushInterval: time.Hour, FlushWorkers: workers})
+			if err != nil {
+				b.Fatalf("Failed to create Parquet storage: %v", err)
+			}
+
+			const batchSize = 100
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				batch := make([]domain.Event, batchSize)
+				for pb.Next() {
+					for i := range batch {
+						batch[i] = domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view", URL: "/"}
+					}
+					if err := ps.WriteBatch(batch); err != nil {
+						b.Errorf("WriteBatch failed: %v", err)
+						return
+					}
+				}
+			})
+			if err := ps.Close(); err != nil {
+				b.Fatalf("Close failed: %v", err)
+			}
+			b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "events/sec")
+		})
+	}
+}
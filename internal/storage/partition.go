@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultProject is the project of events tracked without one
+const DefaultProject = "default"
+
+// projectSQL is the project_id of a row, with files written before projects were
+// required counted under DefaultProject
+const projectSQL = "COALESCE(NULLIF(project_id, ''), '" + DefaultProject + "')"
+
+// partitionName is the directory holding project's files: the id with every byte
+// outside [A-Za-z0-9_-] written as %XX, so any id is one path element that is
+// safe in a glob and inside a SQL string
+func partitionName(project string) string {
+	if project == "" {
+		project = DefaultProject
+	}
+	var name strings.Builder
+	for i := 0; i < len(project); i++ {
+		c := project[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' {
+			name.WriteByte(c)
+		} else {
+			fmt.Fprintf(&name, "%%%02X", c)
+		}
+	}
+	return name.String()
+}
+
+// partitionDir returns the directory of project's files, creating it when needed
+func (ps *ParquetStorage) partitionDir(project string) (string, error) {
+	dir := filepath.Join(ps.dataDir, partitionName(project))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create partition directory: %w", err)
+	}
+	return dir, nil
+}
+
+// parquetFilesIn returns the full paths of the Parquet files directly in dir
+func parquetFilesIn(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".parquet") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// GetProjectFilePath returns the path pattern of one project's Parquet files, see
+// GetFilePath
+func (ps *ParquetStorage) GetProjectFilePath(project string) string {
+	return fmt.Sprintf("%s/%s/*.parquet", ps.dataDir, partitionName(project))
+}
+
+// GetProjectFileCount returns the number of Parquet files of one project
+func (ps *ParquetStorage) GetProjectFileCount(project string) (int, error) {
+	files, err := parquetFilesIn(filepath.Join(ps.dataDir, partitionName(project)))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	return len(files), err
+}
+
+// partitionLegacyFiles moves the events of Parquet files written before
+// partitioning, directly in the data directory, into the partition of their
+// project. Each file is split into files of the same name, so a split interrupted
+// by a crash is redone from the start without duplicating events.
+func (ps *ParquetStorage) partitionLegacyFiles() error {
+	files, err := parquetFilesIn(ps.dataDir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	log.Printf("Partitioning %d Parquet files by project...", len(files))
+	start := time.Now()
+	for _, file := range files {
+		if err := ps.partitionFile(file); err != nil {
+			return err
+		}
+	}
+	log.Printf("✓ Partitioned %d Parquet files by project in %v", len(files), time.Since(start))
+	return nil
+}
+
+// partitionFile splits one unpartitioned file into its projects' partitions and
+// removes it
+func (ps *ParquetStorage) partitionFile(file string) error {
+	rows, err := ps.db.Query(fmt.Sprintf("SELECT DISTINCT %s FROM read_parquet('%s')", projectSQL, file))
+	if err != nil {
+		return fmt.Errorf("failed to read projects of %s: %w", file, err)
+	}
+	var projects []string
+	for rows.Next() {
+		var project string
+		if err := rows.Scan(&project); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to read projects of %s: %w", file, err)
+		}
+		projects = append(projects, project)
+	}
+	if err := rows.Close(); err != nil {
+		log.Printf("Warning: failed to close rows: %v", err)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read projects of %s: %w", file, err)
+	}
+
+	for _, project := range projects {
+		dir, err := ps.partitionDir(project)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.Base(file))
+		query := fmt.Sprintf(`
+			COPY (
+				SELECT * FROM read_parquet('%s') WHERE %s = '%s'
+			) TO '%s' (%s)
+		`, file, projectSQL, strings.ReplaceAll(project, "'", "''"), target+".tmp", ps.copyOptions())
+		if _, err := ps.db.Exec(query); err != nil {
+			if removeErr := os.Remove(target + ".tmp"); removeErr != nil && !os.IsNotExist(removeErr) {
+				log.Printf("Warning: failed to remove temp file: %v", removeErr)
+			}
+			return fmt.Errorf("failed to partition %s: %w", file, err)
+		}
+		if err := os.Rename(target+".tmp", target); err != nil {
+			return fmt.Errorf("failed to partition %s: %w", file, err)
+		}
+	}
+
+	if err := os.Remove(file); err != nil {
+		return fmt.Errorf("failed to remove partitioned file: %w", err)
+	}
+	return nil
+}
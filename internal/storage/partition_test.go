@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestPartitionName(t *testing.T) {
+	tests := []struct {
+		name     string
+		project  string
+		expected string
+	}{
+		{"Plain id", "my-site_2", "my-site_2"},
+		{"No project", "", DefaultProject},
+		{"Default project", "default", DefaultProject},
+		{"Path separator", "a/b", "a%2Fb"},
+		{"Parent directory", "..", "%2E%2E"},
+		{"Quote and glob", "it's*", "it%27s%2A"},
+		{"Escape character", "50%", "50%25"},
+		{"Non-ASCII", "é", "%C3%A9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partitionName(tt.project); got != tt.expected {
+				t.Errorf("partitionName(%q) = %q, expected %q", tt.project, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFlushPartitionsByProject(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+	ps, err := NewParquetStorage(db, dir, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+	defer func() {
+		if err := ps.Close(); err != nil {
+			t.Logf("Warning: failed to close Parquet storage: %v", err)
+		}
+	}()
+
+	events := []domain.Event{
+		{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view", ProjectID: "web"},
+		{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view", ProjectID: "app"},
+		{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "signup", ProjectID: "web"},
+	}
+	if err := ps.WriteBatch(events); err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+	result, err := ps.FlushSync()
+	if err != nil {
+		t.Fatalf("FlushSync failed: %v", err)
+	}
+	if result.EventsFlushed != 3 || len(result.Files) != 2 || result.File != result.Files[0] {
+		t.Fatalf("Expected 3 events in 2 files, got %+v", result)
+	}
+
+	for project, expected := range map[string]int{"web": 2, "app": 1} {
+		if count, err := ps.GetProjectFileCount(project); err != nil || count != 1 {
+			t.Errorf("Expected 1 file for %s, got %d (%v)", project, count, err)
+		}
+		var rows int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM read_parquet('%s') WHERE project_id = '%s'", ps.GetProjectFilePath(project), project)
+		if err := db.QueryRow(query).Scan(&rows); err != nil {
+			t.Fatalf("Failed to read %s: %v", project, err)
+		}
+		if rows != expected {
+			t.Errorf("Expected %d events for %s, got %d", expected, project, rows)
+		}
+	}
+	if count, err := ps.GetFileCount(); err != nil || count != 2 {
+		t.Errorf("Expected 2 files in total, got %d (%v)", count, err)
+	}
+}
+
+func TestPartitionLegacyFiles(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+
+	// A file from before partitioning, holding two projects and events without one
+	legacyFile := filepath.Join(dir, "events_legacy.parquet")
+	_, err := db.Exec(fmt.Sprintf(`
+		COPY (
+			SELECT * FROM (VALUES (1, 'web'), (2, 'app'), (3, 'web'), (4, ''), (5, NULL)) AS t(n, project_id)
+		) TO '%s' (FORMAT 'PARQUET')
+	`, legacyFile))
+	if err != nil {
+		t.Fatalf("Failed to write legacy Parquet file: %v", err)
+	}
+
+	ps := &ParquetStorage{db: db, dataDir: dir, codec: DefaultParquetCodec, rowGroupSize: DefaultRowGroupSize}
+	if err := ps.partitionLegacyFiles(); err != nil {
+		t.Fatalf("partitionLegacyFiles failed: %v", err)
+	}
+
+	if _, err := os.Stat(legacyFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the legacy file to be removed, got %v", err)
+	}
+	for project, expected := range map[string]int{"web": 2, "app": 1, DefaultProject: 2} {
+		var rows int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM read_parquet('%s')", filepath.Join(dir, partitionName(project), "events_legacy.parquet"))
+		if err := db.QueryRow(query).Scan(&rows); err != nil {
+			t.Fatalf("Failed to read partition %s: %v", project, err)
+		}
+		if rows != expected {
+			t.Errorf("Expected %d events in partition %s, got %d", expected, project, rows)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ParquetSchemaVersion is bumped whenever parquetColumns changes
+	ParquetSchemaVersion = 6
+	// SchemaVersionFile records the schema version of the files in the data directory
+	SchemaVersionFile = "schema_version"
+)
+
+// parquetColumn describes a column of the on-disk event schema. fill is the
+// expression used to populate the column when rewriting a file written before
+// the column existed.
+type parquetColumn struct {
+	name    string
+	sqlType string
+	fill    string
+}
+
+// parquetColumns is the on-disk schema produced by Flush, in file order
+var parquetColumns = []parquetColumn{
+	{"id", "UBIGINT", "NULL"},
+	{"timestamp", "TIMESTAMP", "NULL"},
+	{"date_hour", "TIMESTAMP", "date_trunc('hour', timestamp)"},
+	{"date_day", "TIMESTAMP", "date_trunc('day', timestamp)"},
+	{"date_month", "TIMESTAMP", "date_trunc('month', timestamp)"},
+	{"event_name", "VARCHAR", "NULL"},
+	{"user_id", "VARCHAR", "NULL"},
+	{"session_id", "VARCHAR", "NULL"},
+	{"session_duration", "INTEGER", "0"},
+	{"url", "VARCHAR", "NULL"},
+	{"referrer", "VARCHAR", "NULL"},
+	{"user_agent", "VARCHAR", "NULL"},
+	{"ip", "VARCHAR", "NULL"},
+	{"country", "VARCHAR", "NULL"},
+	{"browser", "VARCHAR", "NULL"},
+	{"os", "VARCHAR", "NULL"},
+	{"device", "VARCHAR", "NULL"},
+	{"is_bot", "BOOLEAN", "false"},
+	{"project_id", "VARCHAR", "'default'"},
+	{"channel", "VARCHAR", "NULL"},
+	{"received_at", "TIMESTAMP", "timestamp"},
+	{"region", "VARCHAR", "NULL"},
+	{"language", "VARCHAR", "NULL"},
+	{"screen_width", "INTEGER", "0"},
+	{"screen_height", "INTEGER", "0"},
+	{"sample_rate", "DOUBLE", "1"},
+}
+
+// readSchemaVersion returns the recorded schema version, or 0 when none has been recorded
+func readSchemaVersion(dataDir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, SchemaVersionFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", strings.TrimSpace(string(data)), err)
+	}
+	return version, nil
+}
+
+// writeSchemaVersion records the schema version in the data directory
+func writeSchemaVersion(dataDir string, version int) error {
+	path := filepath.Join(dataDir, SchemaVersionFile)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(version)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write schema version: %w", err)
+	}
+	return nil
+}
+
+// listParquetFiles returns the full paths of the Parquet files in the data
+// directory and in each project's partition below it
+func (ps *ParquetStorage) listParquetFiles() ([]string, error) {
+	paths, err := parquetFilesIn(ps.dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(ps.dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		files, err := parquetFilesIn(filepath.Join(ps.dataDir, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Removed since the data directory was read
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, files...)
+	}
+	return paths, nil
+}
+
+// fileColumns returns the set of column names stored in a Parquet file
+func fileColumns(db *sql.DB, path string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM parquet_schema(?)", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema of %s: %w", path, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// migrateSchema validates existing Parquet files against parquetColumns when the
+// recorded schema version is behind, rewriting any file that is missing columns.
+// The version is recorded afterwards so the pass only runs once per schema change.
+func (ps *ParquetStorage) migrateSchema() error {
+	version, err := readSchemaVersion(ps.dataDir)
+	if err != nil {
+		return err
+	}
+	if version == ParquetSchemaVersion {
+		return nil
+	}
+	if version > ParquetSchemaVersion {
+		return fmt.Errorf("parquet schema version %d is newer than supported version %d", version, ParquetSchemaVersion)
+	}
+
+	files, err := ps.listParquetFiles()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Validating %d Parquet files against schema version %d...", len(files), ParquetSchemaVersion)
+	start := time.Now()
+
+	rewritten := 0
+	for _, file := range files {
+		columns, err := fileColumns(ps.db, file)
+		if err != nil {
+			return err
+		}
+
+		missing := []string{}
+		for _, col := range parquetColumns {
+			if !columns[col.name] {
+				missing = append(missing, col.name)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		log.Printf("🔄 Rewriting %s, missing columns: %s", filepath.Base(file), strings.Join(missing, ", "))
+		if err := ps.rewriteFile(file, columns); err != nil {
+			return err
+		}
+		rewritten++
+	}
+
+	if err := writeSchemaVersion(ps.dataDir, ParquetSchemaVersion); err != nil {
+		return err
+	}
+
+	log.Printf("✓ Parquet schema at version %d (%d files rewritten in %v)", ParquetSchemaVersion, rewritten, time.Since(start))
+	return nil
+}
+
+// rewriteFile rewrites a Parquet file with the full schema, filling missing columns
+func (ps *ParquetStorage) rewriteFile(path string, existing map[string]bool) error {
+	selects := make([]string, len(parquetColumns))
+	for i, col := range parquetColumns {
+		expr := col.name
+		if !existing[col.name] {
+			expr = col.fill
+		}
+		selects[i] = fmt.Sprintf("CAST(%s AS %s) AS %s", expr, col.sqlType, col.name)
+	}
+
+	tempFile := path + ".tmp"
+	query := fmt.Sprintf(`
+		COPY (
+			SELECT %s
+			FROM read_parquet('%s')
+		) TO '%s' (%s)
+	`, strings.Join(selects, ", "), path, tempFile, ps.copyOptions())
+
+	if _, err := ps.db.Exec(query); err != nil {
+		if removeErr := os.Remove(tempFile); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Printf("Warning: failed to remove temp rewrite file: %v", removeErr)
+		}
+		return fmt.Errorf("failed to rewrite %s: %w", path, err)
+	}
+
+	if err := os.Rename(tempFile, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchemaVersionFile(t *testing.T) {
+	dir := t.TempDir()
+
+	version, err := readSchemaVersion(dir)
+	if err != nil {
+		t.Fatalf("readSchemaVersion failed: %v", err)
+	}
+	if version != 0 {
+		t.Errorf("Expected version 0 without a version file, got %d", version)
+	}
+
+	if err := writeSchemaVersion(dir, 3); err != nil {
+		t.Fatalf("writeSchemaVersion failed: %v", err)
+	}
+	version, err = readSchemaVersion(dir)
+	if err != nil {
+		t.Fatalf("readSchemaVersion failed: %v", err)
+	}
+	if version != 3 {
+		t.Errorf("Expected version 3, got %d", version)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, SchemaVersionFile), []byte("garbage"), 0644); err != nil {
+		t.Fatalf("Failed to write version file: %v", err)
+	}
+	if _, err := readSchemaVersion(dir); err == nil {
+		t.Error("Expected error for invalid version file")
+	}
+}
+
+func TestMigrateSchemaRewritesOldFiles(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+
+	// A file from before the channel and date partition columns existed
+	oldFile := filepath.Join(dir, "events_old.parquet")
+	_, err := db.Exec(fmt.Sprintf(`
+		COPY (
+			SELECT 1::UBIGINT AS id, TIMESTAMP '2024-01-15 10:30:00' AS timestamp,
+				'page_view' AS event_name, 'user1' AS user_id, 'session1' AS session_id,
+				10 AS session_duration, '/home' AS url, '' AS referrer, '' AS user_agent,
+				'' AS ip, '' AS country, '' AS browser, '' AS os, '' AS device,
+				false AS is_bot, 'default' AS project_id
+		) TO '%s' (FORMAT 'PARQUET')
+	`, oldFile))
+	if err != nil {
+		t.Fatalf("Failed to write old Parquet file: %v", err)
+	}
+
+	ps, err := NewParquetStorage(db, dir, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create Parquet storage: %v", err)
+	}
+	defer func() {
+		if err := ps.Close(); err != nil {
+			t.Logf("Warning: failed to close Parquet storage: %v", err)
+		}
+	}()
+
+	// Files from before partitioning are moved into their project's partition
+	oldFile = filepath.Join(dir, "default", "events_old.parquet")
+	columns, err := fileColumns(db, oldFile)
+	if err != nil {
+		t.Fatalf("fileColumns failed: %v", err)
+	}
+	for _, col := range parquetColumns {
+		if !columns[col.name] {
+			t.Errorf("Expected rewritten file to contain column %s", col.name)
+		}
+	}
+
+	var dateDay time.Time
+	var eventName string
+	if err := db.QueryRow(fmt.Sprintf("SELECT date_day, event_name FROM read_parquet('%s')", oldFile)).Scan(&dateDay, &eventName); err != nil {
+		t.Fatalf("Failed to read rewritten file: %v", err)
+	}
+	if eventName != "page_view" || !dateDay.Equal(time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected rewritten row: date_day=%v event_name=%q", dateDay, eventName)
+	}
+
+	version, err := readSchemaVersion(dir)
+	if err != nil {
+		t.Fatalf("readSchemaVersion failed: %v", err)
+	}
+	if version != ParquetSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", ParquetSchemaVersion, version)
+	}
+}
+
+func TestMigrateSchemaRejectsNewerVersion(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+
+	if err := writeSchemaVersion(dir, ParquetSchemaVersion+1); err != nil {
+		t.Fatalf("writeSchemaVersion failed: %v", err)
+	}
+	if _, err := NewParquetStorage(db, dir, 0, time.Hour); err == nil {
+		t.Error("Expected error for a schema version newer than supported")
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// Stats reports the Parquet files with their sizes and row counts, read from the
+// Parquet metadata, the timestamp range of the stored events and the buffer
+// occupancy. Backend is left for the caller.
+func (ps *ParquetStorage) Stats(ctx context.Context) (domain.StorageStats, error) {
+	files, err := ps.listParquetFileInfo()
+	if err != nil {
+		return domain.StorageStats{}, err
+	}
+	stats, err := ps.fileStats(ctx, files)
+	if err != nil && ctx.Err() == nil {
+		// Compaction or a reset may have removed files since they were listed
+		if files, err = ps.listParquetFileInfo(); err != nil {
+			return domain.StorageStats{}, err
+		}
+		stats, err = ps.fileStats(ctx, files)
+	}
+	if err != nil {
+		return domain.StorageStats{}, err
+	}
+
+	ps.mu.Lock()
+	stats.Buffer = &domain.BufferStats{
+		Events:          len(ps.buffer),
+		FlushSize:       ps.bufferSize,
+		Capacity:        ps.maxBuffer,
+		FlushesInFlight: len(ps.inFlight),
+	}
+	ps.mu.Unlock()
+	return stats, nil
+}
+
+// fileStats describes files from their Parquet metadata and the timestamp range
+// of their events
+func (ps *ParquetStorage) fileStats(ctx context.Context, files []parquetFileInfo) (domain.StorageStats, error) {
+	stats := domain.StorageStats{FileCount: len(files), Files: make([]domain.StorageFile, 0, len(files))}
+	if len(files) == 0 {
+		return stats, nil
+	}
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = fmt.Sprintf("'%s'", file.path)
+	}
+	list := "[" + strings.Join(paths, ", ") + "]"
+
+	// parquet_metadata has a row per column chunk, so each row group repeats once
+	// per column
+	query := fmt.Sprintf(`
+		SELECT file_name, COUNT(*), SUM(num_rows)
+		FROM (
+			SELECT DISTINCT file_name, row_group_id, row_group_num_rows AS num_rows
+			FROM parquet_metadata(%s)
+		)
+		GROUP BY file_name
+	`, list)
+	rows, err := ps.db.QueryContext(ctx, query)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read Parquet metadata: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Warning: failed to close rows: %v", err)
+		}
+	}()
+
+	type metadata struct {
+		rowGroups int
+		rows      int64
+	}
+	byFile := make(map[string]metadata, len(files))
+	for rows.Next() {
+		var name string
+		var m metadata
+		if err := rows.Scan(&name, &m.rowGroups, &m.rows); err != nil {
+			return stats, fmt.Errorf("failed to read Parquet metadata: %w", err)
+		}
+		byFile[name] = m
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read Parquet metadata: %w", err)
+	}
+
+	for _, file := range files {
+		m := byFile[file.path]
+		stats.Files = append(stats.Files, domain.StorageFile{Path: file.path, Bytes: file.size, Rows: m.rows, RowGroups: m.rowGroups})
+		stats.TotalBytes += file.size
+		stats.TotalEvents += m.rows
+	}
+
+	// Answered from the row group statistics without reading the column
+	var oldest, newest sql.NullTime
+	query = fmt.Sprintf("SELECT MIN(timestamp), MAX(timestamp) FROM read_parquet(%s, union_by_name=true)", list)
+	if err := ps.db.QueryRowContext(ctx, query).Scan(&oldest, &newest); err != nil {
+		return stats, fmt.Errorf("failed to read event timestamps: %w", err)
+	}
+	stats.OldestEvent, stats.NewestEvent = timePtr(oldest), timePtr(newest)
+	return stats, nil
+}
+
+// timePtr returns the time of t, or nil when it is NULL
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/hll"
+)
+
+// UserSketchFile holds the HyperLogLog sketch of the user_id of every flushed
+// event, next to the Parquet files it describes
+const UserSketchFile = "users.hll"
+
+// loadUserSketch reads the user sketch from the data directory. Without one, the
+// sketch starts empty when there are no Parquet files yet, and is otherwise left
+// nil for a rebuild to fill, since the files hold users it has not seen.
+func (ps *ParquetStorage) loadUserSketch() error {
+	data, err := os.ReadFile(filepath.Join(ps.dataDir, UserSketchFile))
+	if err == nil {
+		sketch := hll.New()
+		if err := sketch.UnmarshalBinary(data); err == nil {
+			ps.users = sketch
+			return nil
+		}
+		log.Printf("⚠️  Ignoring unreadable user sketch: %v", err)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read user sketch: %w", err)
+	}
+
+	files, err := ps.listParquetFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		ps.users = hll.New()
+	}
+	return nil
+}
+
+// saveUserSketch writes the user sketch through a temp file, so a crash never
+// leaves half a sketch behind. Callers must hold usersMu.
+func (ps *ParquetStorage) saveUserSketch() error {
+	data, err := ps.users.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode user sketch: %w", err)
+	}
+	path := filepath.Join(ps.dataDir, UserSketchFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write user sketch: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write user sketch: %w", err)
+	}
+	return nil
+}
+
+// recordUsers adds the users of flushed events to the sketch, and to the users
+// seen during a rebuild when one is running
+func (ps *ParquetStorage) recordUsers(events []domain.Event) {
+	ps.usersMu.Lock()
+	defer ps.usersMu.Unlock()
+
+	for _, sketch := range []*hll.Sketch{ps.users, ps.usersDuringRebuild} {
+		if sketch == nil {
+			continue
+		}
+		for _, event := range events {
+			if event.UserID != "" {
+				sketch.Add(event.UserID)
+			}
+		}
+	}
+	if ps.users == nil {
+		return
+	}
+	if err := ps.saveUserSketch(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// UniqueUsers returns the estimated number of distinct users across every flushed
+// event. ok is false while the sketch is missing, until RebuildUserSketch has run.
+func (ps *ParquetStorage) UniqueUsers() (users uint64, ok bool) {
+	ps.usersMu.Lock()
+	defer ps.usersMu.Unlock()
+	if ps.users == nil {
+		return 0, false
+	}
+	return ps.users.Estimate(), true
+}
+
+// RebuildUserSketch recomputes the user sketch from the Parquet files, for when it
+// went missing or no longer matches the files, such as after old files were
+// deleted. Flushes carry on meanwhile; the users they add are merged in at the end.
+func (ps *ParquetStorage) RebuildUserSketch(ctx context.Context) error {
+	// Compaction replaces files, which would fail the scan
+	ps.mergeMu.Lock()
+	defer ps.mergeMu.Unlock()
+
+	ps.usersMu.Lock()
+	ps.usersDuringRebuild = hll.New()
+	ps.usersMu.Unlock()
+	defer func() {
+		ps.usersMu.Lock()
+		ps.usersDuringRebuild = nil
+		ps.usersMu.Unlock()
+	}()
+
+	rebuilt := hll.New()
+	files, err := ps.listParquetFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		query := fmt.Sprintf(`
+			SELECT DISTINCT user_id
+			FROM read_parquet('%s', union_by_name=true)
+			WHERE user_id IS NOT NULL AND user_id != ''
+		`, ps.GetFilePath())
+		rows, err := ps.db.QueryContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to read users: %w", err)
+		}
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Printf("Warning: failed to close rows: %v", err)
+			}
+		}()
+		for rows.Next() {
+			var userID string
+			if err := rows.Scan(&userID); err != nil {
+				return fmt.Errorf("failed to read users: %w", err)
+			}
+			rebuilt.Add(userID)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read users: %w", err)
+		}
+	}
+
+	ps.usersMu.Lock()
+	defer ps.usersMu.Unlock()
+	rebuilt.Merge(ps.usersDuringRebuild)
+	ps.users = rebuilt
+	if err := ps.saveUserSketch(); err != nil {
+		return err
+	}
+	log.Printf("✓ Rebuilt user sketch from %d files: ~%d users", len(files), rebuilt.Estimate())
+	return nil
+}
+
+// rebuildMissingUserSketch rebuilds the user sketch in the background when it was
+// missing at startup
+func (ps *ParquetStorage) rebuildMissingUserSketch(ctx context.Context) {
+	if err := ps.RebuildUserSketch(ctx); err != nil && !errors.Is(ctx.Err(), context.Canceled) {
+		log.Printf("❌ Failed to rebuild user sketch: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+func TestUserSketch(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+	open := func() *ParquetStorage {
+		ps, err := NewParquetStorage(db, dir, 0, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to create Parquet storage: %v", err)
+		}
+		return ps
+	}
+	users := func(ps *ParquetStorage) uint64 {
+		users, ok := ps.UniqueUsers()
+		if !ok {
+			t.Fatal("Expected the user sketch to be available")
+		}
+		return users
+	}
+
+	ps := open()
+	if got := users(ps); got != 0 {
+		t.Errorf("Expected no users before any flush, got %d", got)
+	}
+
+	// 500 distinct users over two flushes, with repeats and anonymous events
+	for flush := 0; flush < 2; flush++ {
+		var events []domain.Event
+		for i := flush * 200; i < flush*200+300; i++ {
+			events = append(events,
+				domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view", UserID: fmt.Sprintf("user-%d", i)},
+				domain.Event{ID: ps.GetNextID(), Timestamp: time.Now(), EventName: "page_view"},
+			)
+		}
+		if err := ps.WriteBatch(events); err != nil {
+			t.Fatalf("WriteBatch failed: %v", err)
+		}
+		if _, err := ps.FlushSync(); err != nil {
+			t.Fatalf("FlushSync failed: %v", err)
+		}
+	}
+	var exact uint64
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(DISTINCT user_id) FROM read_parquet('%s') WHERE user_id != ''", ps.GetFilePath())).Scan(&exact); err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+	if exact != 500 {
+		t.Fatalf("Expected 500 users on disk, got %d", exact)
+	}
+	estimate := users(ps)
+	if math.Abs(float64(estimate)-float64(exact)) > 0.02*float64(exact) {
+		t.Errorf("Expected the sketch to estimate about %d users, got %d", exact, estimate)
+	}
+
+	// The sketch outlives the storage
+	if err := ps.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	ps = open()
+	if got := users(ps); got != estimate {
+		t.Errorf("Expected %d users after reopening, got %d", estimate, got)
+	}
+	if err := ps.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// A missing sketch is rebuilt from the files
+	if err := os.Remove(filepath.Join(dir, UserSketchFile)); err != nil {
+		t.Fatalf("Failed to remove user sketch: %v", err)
+	}
+	ps = open()
+	t.Cleanup(func() {
+		if err := ps.Close(); err != nil {
+			t.Logf("Warning: failed to close Parquet storage: %v", err)
+		}
+	})
+	if err := ps.RebuildUserSketch(t.Context()); err != nil {
+		t.Fatalf("RebuildUserSketch failed: %v", err)
+	}
+	if got := users(ps); got != estimate {
+		t.Errorf("Expected %d users after a rebuild, got %d", estimate, got)
+	}
+
+	if _, err := ps.Reset(); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if got := users(ps); got != 0 {
+		t.Errorf("Expected no users after a reset, got %d", got)
+	}
+}
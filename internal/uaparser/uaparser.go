@@ -0,0 +1,128 @@
+// Package uaparser derives the browser, operating system and device class of a
+// visitor from the user agent, so they do not depend on what the client reports.
+// Rules are tried in order and the first match wins, since most user agents name
+// several engines: Edge and Opera claim to be Chrome, Chrome claims to be Safari.
+package uaparser
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+)
+
+// Modes of applying parsed values to events, selected with UA_PARSE
+const (
+	ModeFill   = "fill"   // Fill in the fields the client left empty (default)
+	ModeAlways = "always" // Replace what the client sent
+	ModeOff    = "off"    // Keep client values as they are
+)
+
+// Mode returns the mode selected by UA_PARSE, falling back to ModeFill for missing
+// or unknown values
+func Mode() string {
+	switch mode := os.Getenv("UA_PARSE"); mode {
+	case ModeAlways, ModeOff:
+		return mode
+	default:
+		return ModeFill
+	}
+}
+
+// Device classes
+const (
+	Desktop = "Desktop"
+	Mobile  = "Mobile"
+	Tablet  = "Tablet"
+)
+
+// Result is what a user agent tells about the visitor. Fields are empty when
+// they could not be determined.
+type Result struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// browserRules come before the engines they build on
+var browserRules = []rule{
+	// In-app browsers report the engine of the platform too
+	{"Facebook", regexp.MustCompile(`FBA[NV]/`)},
+	{"Instagram", regexp.MustCompile(`Instagram `)},
+	{"Edge", regexp.MustCompile(`Edg(e|A|iOS)?/`)},
+	{"Opera", regexp.MustCompile(`OPR/|OPiOS/|Opera`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/`)},
+	{"Yandex Browser", regexp.MustCompile(`YaBrowser/`)},
+	{"Vivaldi", regexp.MustCompile(`Vivaldi/`)},
+	{"Silk", regexp.MustCompile(`Silk/`)},
+	{"Firefox", regexp.MustCompile(`Firefox/|FxiOS/`)},
+	{"Chrome", regexp.MustCompile(`Chrome/|CriOS/|Chromium/`)},
+	{"Android Browser", regexp.MustCompile(`Android.*Version/[\d.]+.*Safari/`)},
+	{"Safari", regexp.MustCompile(`Version/[\d.]+.*Safari/|(iPhone|iPad|iPod).*AppleWebKit/`)},
+	{"IE", regexp.MustCompile(`MSIE |Trident/`)},
+}
+
+// osRules use the labels of the JavaScript SDK
+var osRules = []rule{
+	{"Windows Phone", regexp.MustCompile(`Windows Phone`)},
+	{"Windows", regexp.MustCompile(`Windows`)},
+	{"iOS", regexp.MustCompile(`iPhone|iPad|iPod`)},
+	{"Android", regexp.MustCompile(`Android`)},
+	{"ChromeOS", regexp.MustCompile(`CrOS`)},
+	{"MacOS", regexp.MustCompile(`Macintosh|Mac OS X`)},
+	{"Linux", regexp.MustCompile(`Linux|X11`)},
+}
+
+// deviceRules are tried before falling back to Desktop. Android phones say Mobile,
+// Android tablets do not.
+var deviceRules = []rule{
+	{Tablet, regexp.MustCompile(`iPad|Tablet;|PlayBook|Kindle|Silk/`)},
+	{Mobile, regexp.MustCompile(`Mobi|iPhone|iPod|Windows Phone|BlackBerry|Opera Mini`)},
+	{Tablet, regexp.MustCompile(`Android`)},
+}
+
+// Parse returns the browser, OS and device class of a user agent. Any non-empty
+// user agent gets a device class, Desktop when nothing suggests otherwise.
+func Parse(userAgent string) Result {
+	if userAgent == "" {
+		return Result{}
+	}
+	device := match(deviceRules, userAgent)
+	if device == "" {
+		device = Desktop
+	}
+	return Result{
+		Browser: match(browserRules, userAgent),
+		OS:      match(osRules, userAgent),
+		Device:  device,
+	}
+}
+
+func match(rules []rule, userAgent string) string {
+	for _, r := range rules {
+		if r.pattern.MatchString(userAgent) {
+			return r.name
+		}
+	}
+	return ""
+}
+
+// DeviceForWidth classifies a device by its screen width in CSS pixels, at the
+// breakpoints of the screen size report. Widths of 0 or less give "".
+func DeviceForWidth(width int) string {
+	switch {
+	case width <= 0:
+		return ""
+	case width < domain.TabletMinWidth:
+		return Mobile
+	case width < domain.DesktopMinWidth:
+		return Tablet
+	default:
+		return Desktop
+	}
+}
@@ -0,0 +1,96 @@
+package uaparser
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  Result
+	}{
+		// Desktop
+		{"Chrome on Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", Result{"Chrome", "Windows", Desktop}},
+		{"Edge on Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0", Result{"Edge", "Windows", Desktop}},
+		{"Firefox on Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0", Result{"Firefox", "Windows", Desktop}},
+		{"Safari on macOS", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15", Result{"Safari", "MacOS", Desktop}},
+		{"Opera on macOS", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 OPR/105.0.0.0", Result{"Opera", "MacOS", Desktop}},
+		{"Firefox on Linux", "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", Result{"Firefox", "Linux", Desktop}},
+		{"Chrome on ChromeOS", "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", Result{"Chrome", "ChromeOS", Desktop}},
+		{"IE 11", "Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; rv:11.0) like Gecko", Result{"IE", "Windows", Desktop}},
+		{"IE on a Tablet PC", "Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 6.1; Trident/4.0; Tablet PC 2.0)", Result{"IE", "Windows", Desktop}},
+
+		// Mobile
+		{"Safari on iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", Result{"Safari", "iOS", Mobile}},
+		{"Chrome on iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1", Result{"Chrome", "iOS", Mobile}},
+		{"Firefox on iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/121.0 Mobile/15E148 Safari/605.1.15", Result{"Firefox", "iOS", Mobile}},
+		{"Chrome on Android phone", "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", Result{"Chrome", "Android", Mobile}},
+		{"Samsung Internet", "Mozilla/5.0 (Linux; Android 13; SAMSUNG SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36", Result{"Samsung Internet", "Android", Mobile}},
+		{"Android stock browser", "Mozilla/5.0 (Linux; U; Android 4.0.3; en-us; GT-I9100 Build/IML74K) AppleWebKit/534.30 (KHTML, like Gecko) Version/4.0 Mobile Safari/534.30", Result{"Android Browser", "Android", Mobile}},
+		{"Firefox on Android phone", "Mozilla/5.0 (Android 14; Mobile; rv:121.0) Gecko/121.0 Firefox/121.0", Result{"Firefox", "Android", Mobile}},
+		{"Facebook in-app on iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/442.0.0.0]", Result{"Facebook", "iOS", Mobile}},
+		{"Opera Mini", "Opera/9.80 (J2ME/MIDP; Opera Mini/9.80 (S60; SymbOS; Opera Mobi/23.348; U; en) Presto/2.5.25 Version/10.54", Result{"Opera", "", Mobile}},
+		{"Windows Phone", "Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1; Microsoft; Lumia 950) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.116 Mobile Safari/537.36 Edge/15.15063", Result{"Edge", "Windows Phone", Mobile}},
+
+		// Tablet
+		{"Safari on iPad", "Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", Result{"Safari", "iOS", Tablet}},
+		{"Chrome on Android tablet", "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", Result{"Chrome", "Android", Tablet}},
+		{"Firefox on Android tablet", "Mozilla/5.0 (Android 13; Tablet; rv:121.0) Gecko/121.0 Firefox/121.0", Result{"Firefox", "Android", Tablet}},
+		{"Kindle Fire", "Mozilla/5.0 (Linux; Android 9; KFTRWI) AppleWebKit/537.36 (KHTML, like Gecko) Silk/120.3.1 like Chrome/120.0.6099.230 Safari/537.36", Result{"Silk", "Android", Tablet}},
+
+		// Unknown
+		{"Empty", "", Result{}},
+		{"Unrecognized", "SomeClient/1.0", Result{"", "", Desktop}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.userAgent); got != tt.expected {
+				t.Errorf("Parse(%q) = %+v, expected %+v", tt.userAgent, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMode(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"", ModeFill},
+		{"fill", ModeFill},
+		{"always", ModeAlways},
+		{"off", ModeOff},
+		{"sometimes", ModeFill},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("UA_PARSE", tt.value)
+			if got := Mode(); got != tt.expected {
+				t.Errorf("Mode() with UA_PARSE=%q = %q, expected %q", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeviceForWidth(t *testing.T) {
+	tests := []struct {
+		width    int
+		expected string
+	}{
+		{0, ""},
+		{-1, ""},
+		{375, Mobile},
+		{767, Mobile},
+		{768, Tablet},
+		{1023, Tablet},
+		{1024, Desktop},
+		{2560, Desktop},
+	}
+
+	for _, tt := range tests {
+		if got := DeviceForWidth(tt.width); got != tt.expected {
+			t.Errorf("DeviceForWidth(%d) = %q, expected %q", tt.width, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package urlpattern groups page URLs that differ only in an identifier, such as
+// /product/123 and /product/456, under a template like /product/:id. Rules apply
+// when pages are reported; the stored URLs are left untouched.
+package urlpattern
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Rule rewrites every match of Pattern in a URL to Template. Pattern is RE2 syntax
+// so queries can apply it with regexp_replace, and Template is literal text.
+type Rule struct {
+	Pattern  string `json:"pattern"`
+	Template string `json:"template"`
+
+	re *regexp.Regexp
+}
+
+var (
+	mu    sync.RWMutex
+	rules []Rule
+)
+
+// Set replaces the rules, which apply in order, each to the result of the last
+func Set(configured []Rule) error {
+	compiled := make([]Rule, 0, len(configured))
+	for i, rule := range configured {
+		if rule.Pattern == "" {
+			return fmt.Errorf("url pattern %d: pattern is required", i)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("url pattern %d: %w", i, err)
+		}
+		rule.re = re
+		compiled = append(compiled, rule)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	rules = compiled
+	return nil
+}
+
+// LoadFile sets the rules from the JSON array of rules in path
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read url patterns file: %w", err)
+	}
+	var configured []Rule
+	if err := json.Unmarshal(data, &configured); err != nil {
+		return fmt.Errorf("failed to parse url patterns file: %w", err)
+	}
+	return Set(configured)
+}
+
+// Enabled reports whether any rules are set
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(rules) > 0
+}
+
+// Normalize returns url with every rule applied
+func Normalize(url string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, rule := range rules {
+		url = rule.re.ReplaceAllLiteralString(url, rule.Template)
+	}
+	return url
+}
+
+// SQL is column with every rule applied, the SQL twin of Normalize. It is column
+// itself when no rules are set.
+func SQL(column string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	expr := column
+	for _, rule := range rules {
+		// regexp_replace reads backslashes in the replacement as group references
+		template := strings.ReplaceAll(rule.Template, `\`, `\\`)
+		expr = fmt.Sprintf("regexp_replace(%s, %s, %s, 'g')", expr, quote(rule.Pattern), quote(template))
+	}
+	return expr
+}
+
+// quote returns s as an SQL string literal
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
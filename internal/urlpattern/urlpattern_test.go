@@ -0,0 +1,126 @@
+package urlpattern
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testRules = []Rule{
+	{Pattern: `[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`, Template: ":uuid"},
+	{Pattern: `/\d+\b`, Template: "/:id"},
+	{Pattern: `/blog/[a-z0-9-]+`, Template: "/blog/:slug"},
+}
+
+func setRules(t *testing.T, configured []Rule) {
+	t.Helper()
+	if err := Set(configured); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := Set(nil); err != nil {
+			t.Errorf("Failed to reset rules: %v", err)
+		}
+	})
+}
+
+func TestNormalize(t *testing.T) {
+	setRules(t, testRules)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		// Numeric ids
+		{"Numeric id", "https://example.com/product/123", "https://example.com/product/:id"},
+		{"Numeric id with query", "https://example.com/product/456?ref=home", "https://example.com/product/:id?ref=home"},
+		{"Several numeric ids", "/users/7/orders/42", "/users/:id/orders/:id"},
+		{"Digits inside a segment", "/product/123abc", "/product/123abc"},
+
+		// UUIDs
+		{"UUID", "/orders/3f2b8c1e-9a4d-4e6f-8b2a-1c5d7e9f0a3b", "/orders/:uuid"},
+		{"UUID before numeric id", "/orders/3f2b8c1e-9a4d-4e6f-8b2a-1c5d7e9f0a3b/items/9", "/orders/:uuid/items/:id"},
+
+		// Slugs
+		{"Slug", "https://example.com/blog/hello-world", "https://example.com/blog/:slug"},
+		{"Slug with digits", "/blog/top-10-tips", "/blog/:slug"},
+
+		// Untouched
+		{"No match", "https://example.com/about", "https://example.com/about"},
+		{"Empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.url); got != tt.expected {
+				t.Errorf("Normalize(%q) = %q, expected %q", tt.url, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSQL(t *testing.T) {
+	if got := SQL("url"); got != "url" {
+		t.Errorf("Expected the bare column without rules, got %s", got)
+	}
+	if Enabled() {
+		t.Error("Expected no rules by default")
+	}
+
+	setRules(t, []Rule{
+		{Pattern: `/\d+\b`, Template: "/:id"},
+		{Pattern: `/o'brien`, Template: `/\name`},
+	})
+
+	expected := `regexp_replace(regexp_replace(url, '/\d+\b', '/:id', 'g'), '/o''brien', '/\\name', 'g')`
+	if got := SQL("url"); got != expected {
+		t.Errorf("SQL(url) = %s, expected %s", got, expected)
+	}
+	if !Enabled() {
+		t.Error("Expected rules to be enabled")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Cleanup(func() { _ = Set(nil) })
+
+	valid := filepath.Join(dir, "patterns.json")
+	if err := os.WriteFile(valid, []byte(`[{"pattern": "/product/\\d+", "template": "/product/:id"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFile(valid); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if got := Normalize("/product/123"); got != "/product/:id" {
+		t.Errorf("Expected the loaded rule to apply, got %q", got)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"Invalid JSON", `{`},
+		{"Missing pattern", `[{"template": ":id"}]`},
+		{"Invalid pattern", `[{"pattern": "(", "template": ":id"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "bad.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := LoadFile(path); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+	if got := Normalize("/product/123"); got != "/product/:id" {
+		t.Errorf("Expected a bad file to keep the previous rules, got %q", got)
+	}
+
+	if err := LoadFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
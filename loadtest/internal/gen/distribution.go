@@ -0,0 +1,108 @@
+package gen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"os"
+	"slices"
+	"sort"
+)
+
+// Distribution decides how often Generator produces each kind of event. Weights
+// are relative: an event weighted 50 is a hundred times as common as one weighted
+// 0.5.
+type Distribution struct {
+	EventWeights   map[string]float64 `json:"event_weights"`   // By event name
+	BotRatio       float64            `json:"bot_ratio"`       // Share of bot events, 0 to 1
+	ChannelWeights map[string]float64 `json:"channel_weights"` // By channel: Direct, Organic, Social, Paid or Referral
+}
+
+// DefaultDistribution resembles a typical site: mostly page views, a few clicks and
+// searches, and rare signups and purchases, with a fifth of the traffic from bots
+func DefaultDistribution() Distribution {
+	return Distribution{
+		EventWeights: map[string]float64{
+			"page_view": 50, "button_click": 8, "session_start": 5, "session_end": 4,
+			"search": 4, "video_play": 3, "video_pause": 2, "login": 2, "form_submit": 2,
+			"profile_view": 2, "feature_used": 2, "notification_click": 1.5, "email_open": 1.5,
+			"app_open": 1.5, "like": 1.5, "add_to_cart": 1.5, "share": 1, "download": 1,
+			"comment": 0.8, "email_click": 0.8, "logout": 0.8, "follow": 0.6,
+			"checkout_started": 0.6, "signup": 0.5, "settings_change": 0.5, "error_occurred": 0.5,
+			"app_install": 0.3, "payment_completed": 0.3, "purchase": 0.3, "unfollow": 0.2,
+		},
+		BotRatio: 0.2,
+		ChannelWeights: map[string]float64{
+			"Direct": 30, "Organic": 35, "Social": 15, "Referral": 12, "Paid": 8,
+		},
+	}
+}
+
+// LoadDistribution reads a Distribution from a JSON file. Fields the file leaves
+// out keep their DefaultDistribution value; a weights map given replaces the
+// default one entirely.
+func LoadDistribution(path string) (Distribution, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Distribution{}, err
+	}
+
+	var file struct {
+		EventWeights   map[string]float64 `json:"event_weights"`
+		BotRatio       *float64           `json:"bot_ratio"`
+		ChannelWeights map[string]float64 `json:"channel_weights"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Distribution{}, fmt.Errorf("invalid distribution %s: %w", path, err)
+	}
+
+	d := DefaultDistribution()
+	if file.EventWeights != nil {
+		d.EventWeights = file.EventWeights
+	}
+	if file.BotRatio != nil {
+		d.BotRatio = *file.BotRatio
+	}
+	if file.ChannelWeights != nil {
+		d.ChannelWeights = file.ChannelWeights
+	}
+	return d, nil
+}
+
+// picker chooses among names in proportion to their weights
+type picker struct {
+	names      []string
+	cumulative []float64
+}
+
+func newPicker(weights map[string]float64) (picker, error) {
+	var p picker
+	total := 0.0
+	for _, name := range slices.Sorted(maps.Keys(weights)) {
+		weight := weights[name]
+		if weight < 0 {
+			return picker{}, fmt.Errorf("negative weight %v for %q", weight, name)
+		}
+		if weight == 0 {
+			continue
+		}
+		total += weight
+		p.names = append(p.names, name)
+		p.cumulative = append(p.cumulative, total)
+	}
+	if len(p.names) == 0 {
+		return picker{}, errors.New("no positive weights")
+	}
+	return p, nil
+}
+
+func (p picker) pick() string {
+	r := rand.Float64() * p.cumulative[len(p.cumulative)-1]
+	i := sort.SearchFloat64s(p.cumulative, r)
+	if i < len(p.names) && p.cumulative[i] == r {
+		i++ // r is where the next name's range starts
+	}
+	return p.names[min(i, len(p.names)-1)]
+}
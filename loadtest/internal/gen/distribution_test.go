@@ -0,0 +1,113 @@
+package gen
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeneratorDistribution(t *testing.T) {
+	generator, err := NewGenerator(Distribution{
+		EventWeights:   map[string]float64{"page_view": 90, "purchase": 10, "signup": 0},
+		BotRatio:       0.5,
+		ChannelWeights: map[string]float64{"Paid": 1, "Social": 3},
+	})
+	if err != nil {
+		t.Fatalf("NewGenerator failed: %v", err)
+	}
+
+	const n = 20000
+	events := map[string]int{}
+	channels := map[string]int{}
+	bots := 0
+	base := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		event := generator.RandomEvent(base, []string{"u1"}, "web")
+		events[event.EventName]++
+		channels[event.Channel]++
+		if event.IsBot {
+			bots++
+		}
+	}
+
+	// Shares within two points of the weights
+	for _, tt := range []struct {
+		name     string
+		count    int
+		expected float64
+	}{
+		{"page_view", events["page_view"], 0.9},
+		{"purchase", events["purchase"], 0.1},
+		{"Social", channels["Social"], 0.75},
+		{"Paid", channels["Paid"], 0.25},
+		{"bots", bots, 0.5},
+	} {
+		if share := float64(tt.count) / n; math.Abs(share-tt.expected) > 0.02 {
+			t.Errorf("Expected %s near %.2f, got %.3f", tt.name, tt.expected, share)
+		}
+	}
+	if events["signup"] != 0 || len(events) != 2 || len(channels) != 2 {
+		t.Errorf("Expected only weighted events and channels, got %v and %v", events, channels)
+	}
+}
+
+func TestNewGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Distribution)
+		wantErr string
+	}{
+		{"Bot ratio above 1", func(d *Distribution) { d.BotRatio = 1.5 }, "bot_ratio must be between 0 and 1"},
+		{"Negative weight", func(d *Distribution) { d.EventWeights = map[string]float64{"page_view": -1} }, `event_weights: negative weight -1 for "page_view"`},
+		{"No positive weights", func(d *Distribution) { d.EventWeights = map[string]float64{"page_view": 0} }, "event_weights: no positive weights"},
+		{"Unknown channel", func(d *Distribution) { d.ChannelWeights = map[string]float64{"Email": 1} }, `unknown channel "Email"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DefaultDistribution()
+			tt.modify(&d)
+			if _, err := NewGenerator(d); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadDistribution(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "distribution.json")
+	if err := os.WriteFile(path, []byte(`{"event_weights":{"page_view":1},"bot_ratio":0}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := LoadDistribution(path)
+	if err != nil {
+		t.Fatalf("LoadDistribution failed: %v", err)
+	}
+	if len(d.EventWeights) != 1 || d.BotRatio != 0 {
+		t.Errorf("Expected the file's weights and bot ratio, got %+v", d)
+	}
+	if len(d.ChannelWeights) != len(DefaultDistribution().ChannelWeights) {
+		t.Errorf("Expected the default channel weights, got %v", d.ChannelWeights)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"bot_ratio":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDistribution(path); err == nil {
+		t.Error("Expected an error for malformed JSON")
+	}
+}
+
+func TestDefaultDistribution(t *testing.T) {
+	d := DefaultDistribution()
+	if _, err := NewGenerator(d); err != nil {
+		t.Fatalf("Expected the default distribution valid, got %v", err)
+	}
+	if d.EventWeights["page_view"] < 100*d.EventWeights["purchase"] {
+		t.Errorf("Expected page views to dominate purchases, got %v", d.EventWeights)
+	}
+}
@@ -0,0 +1,280 @@
+// Package gen generates the analytics events the load testing tools send: random
+// events for throughput tests and user journeys through common funnels.
+package gen
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Event is an analytics event as the load testing tools send or insert it. ID is
+// only set by the CSV import, and an empty Channel is left for the server to detect.
+type Event struct {
+	ID              uint64    `json:"id,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+	EventName       string    `json:"event_name"`
+	UserID          string    `json:"user_id"`
+	SessionID       string    `json:"session_id"`
+	SessionDuration int       `json:"session_duration"`
+	URL             string    `json:"url"`
+	Referrer        string    `json:"referrer"`
+	UserAgent       string    `json:"user_agent"`
+	IP              string    `json:"ip"`
+	Country         string    `json:"country"`
+	Browser         string    `json:"browser"`
+	OS              string    `json:"os"`
+	Device          string    `json:"device"`
+	IsBot           bool      `json:"is_bot"`
+	ProjectID       string    `json:"project_id"`
+	Channel         string    `json:"channel,omitempty"`
+}
+
+// Sample data for realistic events
+var (
+	urls = []string{
+		"/", "/home", "/about", "/contact", "/pricing", "/features", "/blog",
+		"/login", "/signup", "/dashboard", "/profile", "/settings", "/help",
+		"/product/123", "/product/456", "/product/789", "/category/electronics",
+		"/category/clothing", "/category/books", "/search?q=laptop", "/cart",
+		"/checkout", "/payment", "/confirmation", "/account", "/orders", "/support",
+	}
+
+	referrers = []string{
+		"", "https://google.com", "https://facebook.com", "https://twitter.com",
+		"https://linkedin.com", "https://reddit.com", "https://youtube.com",
+		"https://github.com", "https://stackoverflow.com", "https://medium.com",
+		"https://dev.to", "https://hackernews.com", "direct", "email",
+		// Paid channels
+		"https://google.com/ads", "https://facebook.com/ads", "https://twitter.com/ads",
+		"https://linkedin.com/ads", "https://instagram.com/ads",
+		// Organic search
+		"https://www.google.com/search", "https://www.bing.com/search", "https://search.yahoo.com",
+		// Social
+		"https://t.co", "https://www.facebook.com", "https://www.linkedin.com",
+		"https://www.instagram.com", "https://www.tiktok.com",
+	}
+
+	userAgents = []string{
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Linux; Android 14; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+	}
+
+	botUserAgents = []string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		"Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)",
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+		"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)",
+		"Twitterbot/1.0",
+	}
+
+	countries = []string{
+		"United States", "Canada", "United Kingdom", "Germany", "France", "Spain",
+		"Italy", "Netherlands", "Sweden", "Norway", "Denmark", "Finland",
+		"Australia", "New Zealand", "Japan", "South Korea", "Singapore", "India",
+		"Brazil", "Mexico", "Argentina", "Chile", "Russia", "China", "Palestine",
+	}
+
+	browsers = []string{
+		"Chrome", "Safari", "Firefox", "Edge", "Opera", "Brave",
+	}
+
+	operatingSystems = []string{
+		"Windows", "MacOS", "Linux", "iOS", "Android", "ChromeOS",
+	}
+
+	devices = []string{
+		"Desktop", "Mobile", "Tablet",
+	}
+
+	ipRanges = []string{
+		"192.168.1", "10.0.0", "172.16.0", "203.0.113", "198.51.100",
+		"203.113.0", "185.199.108", "140.82.112", "151.101.1", "104.16.132",
+	}
+)
+
+// DetectChannel determines the traffic channel based on referrer and URL
+func DetectChannel(referrer, url string) string {
+	// Priority 1: Paid channels (utm_medium or utm_source contains paid/cpc/ppc)
+	if containsAny(url, []string{"utm_medium=cpc", "utm_medium=ppc", "utm_medium=paid", "utm_source=paid"}) ||
+		containsAny(referrer, []string{"/ads", "adwords", "googleads", "facebook.com/ads"}) {
+		return "Paid"
+	}
+
+	// Priority 2: Direct traffic (no referrer or same domain)
+	if referrer == "" || referrer == "direct" {
+		return "Direct"
+	}
+
+	// Priority 3: Social media
+	socialDomains := []string{
+		"facebook.com", "twitter.com", "linkedin.com", "instagram.com",
+		"tiktok.com", "pinterest.com", "reddit.com", "youtube.com",
+		"snapchat.com", "whatsapp.com", "telegram.org", "t.co",
+	}
+	if containsAnyDomain(referrer, socialDomains) {
+		return "Social"
+	}
+
+	// Priority 4: Organic search
+	searchEngines := []string{
+		"google.com/search", "bing.com/search", "yahoo.com/search",
+		"duckduckgo.com", "baidu.com", "yandex.com", "ask.com",
+	}
+	if containsAny(referrer, searchEngines) {
+		return "Organic"
+	}
+
+	// Priority 5: Referral (all other external sources)
+	return "Referral"
+}
+
+// containsAny checks if the text contains any of the substrings
+func containsAny(text string, substrings []string) bool {
+	for _, substr := range substrings {
+		if len(text) >= len(substr) && indexOfSubstring(text, substr) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAnyDomain checks if the referrer URL contains any of the domains
+func containsAnyDomain(referrer string, domains []string) bool {
+	for _, domain := range domains {
+		if indexOfSubstring(referrer, domain) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// indexOfSubstring finds the index of a substring (case-insensitive)
+func indexOfSubstring(s, substr string) int {
+	sLower := toLower(s)
+	substrLower := toLower(substr)
+	for i := 0; i <= len(sLower)-len(substrLower); i++ {
+		if sLower[i:i+len(substrLower)] == substrLower {
+			return i
+		}
+	}
+	return -1
+}
+
+// toLower converts a string to lowercase
+func toLower(s string) string {
+	result := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' {
+			result[i] = c + 32
+		} else {
+			result[i] = c
+		}
+	}
+	return string(result)
+}
+
+// Generator creates random events following a Distribution
+type Generator struct {
+	events   picker
+	channels picker
+	botRatio float64
+
+	// referrers of each channel, see DetectChannel
+	referrers map[string][]string
+}
+
+// NewGenerator validates d and returns a Generator following it
+func NewGenerator(d Distribution) (*Generator, error) {
+	if d.BotRatio < 0 || d.BotRatio > 1 {
+		return nil, fmt.Errorf("bot_ratio must be between 0 and 1, got %v", d.BotRatio)
+	}
+
+	g := &Generator{botRatio: d.BotRatio, referrers: make(map[string][]string)}
+	for _, referrer := range referrers {
+		channel := DetectChannel(referrer, "/")
+		g.referrers[channel] = append(g.referrers[channel], referrer)
+	}
+	for channel := range d.ChannelWeights {
+		if len(g.referrers[channel]) == 0 {
+			return nil, fmt.Errorf("unknown channel %q, expected Direct, Organic, Social, Paid or Referral", channel)
+		}
+	}
+
+	var err error
+	if g.events, err = newPicker(d.EventWeights); err != nil {
+		return nil, fmt.Errorf("event_weights: %w", err)
+	}
+	if g.channels, err = newPicker(d.ChannelWeights); err != nil {
+		return nil, fmt.Errorf("channel_weights: %w", err)
+	}
+	return g, nil
+}
+
+// RandomEvent creates a realistic random event by one of userPool, spread over the
+// 30 days before baseTime
+func (g *Generator) RandomEvent(baseTime time.Time, userPool []string, projectID string) Event {
+	// Random timestamp within the last 30 days
+	hoursBack := rand.Intn(30 * 24)
+	timestamp := baseTime.Add(-time.Duration(hoursBack) * time.Hour)
+	timestamp = timestamp.Add(time.Duration(rand.Intn(3600)) * time.Second)
+
+	// Select random user from pool
+	userID := userPool[rand.Intn(len(userPool))]
+
+	// Generate session ID
+	sessionID := fmt.Sprintf("sess_%s_%d", userID, rand.Intn(10))
+
+	// Generate session duration (0-3600 seconds, 1 hour max)
+	sessionDuration := rand.Intn(3600)
+
+	eventName := g.events.pick()
+	url := urls[rand.Intn(len(urls))]
+	channelReferrers := g.referrers[g.channels.pick()]
+	referrer := channelReferrers[rand.Intn(len(channelReferrers))]
+
+	isBot := rand.Float64() < g.botRatio
+	var userAgent string
+	if isBot {
+		userAgent = botUserAgents[rand.Intn(len(botUserAgents))]
+	} else {
+		userAgent = userAgents[rand.Intn(len(userAgents))]
+	}
+
+	country := countries[rand.Intn(len(countries))]
+	browser := browsers[rand.Intn(len(browsers))]
+	os := operatingSystems[rand.Intn(len(operatingSystems))]
+	device := devices[rand.Intn(len(devices))]
+
+	// Generate realistic IP
+	ipBase := ipRanges[rand.Intn(len(ipRanges))]
+	ip := fmt.Sprintf("%s.%d", ipBase, rand.Intn(255)+1)
+
+	// Detect channel based on referrer and URL
+	channel := DetectChannel(referrer, url)
+
+	return Event{
+		Timestamp:       timestamp,
+		EventName:       eventName,
+		UserID:          userID,
+		SessionID:       sessionID,
+		SessionDuration: sessionDuration,
+		URL:             url,
+		Referrer:        referrer,
+		UserAgent:       userAgent,
+		IP:              ip,
+		Country:         country,
+		Browser:         browser,
+		OS:              os,
+		Device:          device,
+		IsBot:           isBot,
+		ProjectID:       projectID,
+		Channel:         channel,
+	}
+}
@@ -0,0 +1,66 @@
+package gen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectChannel(t *testing.T) {
+	tests := []struct {
+		referrer string
+		url      string
+		expected string
+	}{
+		{"", "/", "Direct"},
+		{"direct", "/pricing", "Direct"},
+		{"https://google.com/ads", "/", "Paid"},
+		{"https://google.com", "/?utm_medium=cpc", "Paid"},
+		{"https://t.co", "/", "Social"},
+		{"https://www.bing.com/search", "/", "Organic"},
+		{"https://github.com", "/", "Referral"},
+	}
+
+	for _, tt := range tests {
+		if got := DetectChannel(tt.referrer, tt.url); got != tt.expected {
+			t.Errorf("DetectChannel(%q, %q) = %q, expected %q", tt.referrer, tt.url, got, tt.expected)
+		}
+	}
+}
+
+func TestRandomEvent(t *testing.T) {
+	generator, err := NewGenerator(DefaultDistribution())
+	if err != nil {
+		t.Fatalf("NewGenerator failed: %v", err)
+	}
+	base := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		event := generator.RandomEvent(base, []string{"u1", "u2"}, "web")
+		if event.ProjectID != "web" || (event.UserID != "u1" && event.UserID != "u2") {
+			t.Fatalf("Expected an event of the pool's users in the project, got %+v", event)
+		}
+		if event.Timestamp.Before(base.AddDate(0, 0, -30)) || event.Timestamp.After(base.Add(time.Hour)) {
+			t.Fatalf("Expected a timestamp in the 30 days before %v, got %v", base, event.Timestamp)
+		}
+		if event.Channel != DetectChannel(event.Referrer, event.URL) {
+			t.Fatalf("Expected the channel of the referrer, got %+v", event)
+		}
+	}
+}
+
+func TestJourney(t *testing.T) {
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		events := Journey("u1", "web", base)
+		if len(events) == 0 {
+			t.Fatal("Expected at least the first step of a journey")
+		}
+		for j, event := range events {
+			if event.UserID != "u1" || event.ProjectID != "web" || event.SessionID != events[0].SessionID || event.IsBot {
+				t.Fatalf("Expected one human session of u1 in the project, got %+v", event)
+			}
+			if j > 0 && !event.Timestamp.After(events[j-1].Timestamp) {
+				t.Fatalf("Expected the steps in order, got %v after %v", event.Timestamp, events[j-1].Timestamp)
+			}
+		}
+	}
+}
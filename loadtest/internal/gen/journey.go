@@ -0,0 +1,270 @@
+package gen
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// FunnelStep represents a step in a user journey
+type FunnelStep struct {
+	EventName   string
+	URL         string
+	MinDuration int // Minimum seconds to next step
+	MaxDuration int // Maximum seconds to next step
+	DropOffRate float64
+}
+
+// FunnelTemplate defines a complete user journey
+type FunnelTemplate struct {
+	Name    string
+	Steps   []FunnelStep
+	Weight  int // Higher = more likely to be chosen
+	Country string
+	Browser string
+	Device  string
+}
+
+// FunnelTemplates are the journeys Journey picks from, by weight
+var FunnelTemplates = []FunnelTemplate{
+	// E-commerce: Complete Purchase Journey
+	{
+		Name:    "E-commerce Purchase",
+		Weight:  30,
+		Country: "United States",
+		Browser: "Chrome",
+		Device:  "Desktop",
+		Steps: []FunnelStep{
+			{EventName: "page_view", URL: "/", MinDuration: 5, MaxDuration: 30, DropOffRate: 0.20},
+			{EventName: "page_view", URL: "/product/123", MinDuration: 10, MaxDuration: 60, DropOffRate: 0.30},
+			{EventName: "add_to_cart", URL: "/product/123", MinDuration: 2, MaxDuration: 10, DropOffRate: 0.40},
+			{EventName: "page_view", URL: "/cart", MinDuration: 5, MaxDuration: 20, DropOffRate: 0.35},
+			{EventName: "checkout_started", URL: "/checkout", MinDuration: 10, MaxDuration: 120, DropOffRate: 0.50},
+			{EventName: "payment_completed", URL: "/payment", MinDuration: 5, MaxDuration: 30, DropOffRate: 0.10},
+			{EventName: "purchase", URL: "/confirmation", MinDuration: 3, MaxDuration: 10, DropOffRate: 0.05},
+		},
+	},
+	// E-commerce: Browse Only (High Drop-off)
+	{
+		Name:    "E-commerce Browse",
+		Weight:  40,
+		Country: "United States",
+		Browser: "Safari",
+		Device:  "Mobile",
+		Steps: []FunnelStep{
+			{EventName: "page_view", URL: "/", MinDuration: 3, MaxDuration: 15, DropOffRate: 0.30},
+			{EventName: "page_view", URL: "/product/456", MinDuration: 5, MaxDuration: 30, DropOffRate: 0.70},
+			{EventName: "page_view", URL: "/product/789", MinDuration: 5, MaxDuration: 30, DropOffRate: 0.80},
+		},
+	},
+	// SaaS: Signup to Activation
+	{
+		Name:    "SaaS Activation",
+		Weight:  25,
+		Country: "United Kingdom",
+		Browser: "Chrome",
+		Device:  "Desktop",
+		Steps: []FunnelStep{
+			{EventName: "page_view", URL: "/", MinDuration: 10, MaxDuration: 60, DropOffRate: 0.25},
+			{EventName: "page_view", URL: "/pricing", MinDuration: 15, MaxDuration: 90, DropOffRate: 0.40},
+			{EventName: "button_click", URL: "/pricing", MinDuration: 2, MaxDuration: 5, DropOffRate: 0.15},
+			{EventName: "signup", URL: "/signup", MinDuration: 30, MaxDuration: 180, DropOffRate: 0.45},
+			{EventName: "page_view", URL: "/dashboard", MinDuration: 5, MaxDuration: 20, DropOffRate: 0.30},
+			{EventName: "feature_used", URL: "/dashboard", MinDuration: 10, MaxDuration: 300, DropOffRate: 0.25},
+		},
+	},
+	// Content: Newsletter Signup
+	{
+		Name:    "Content Newsletter",
+		Weight:  35,
+		Country: "Germany",
+		Browser: "Firefox",
+		Device:  "Desktop",
+		Steps: []FunnelStep{
+			{EventName: "page_view", URL: "/blog", MinDuration: 5, MaxDuration: 30, DropOffRate: 0.15},
+			{EventName: "page_view", URL: "/blog/article-1", MinDuration: 60, MaxDuration: 300, DropOffRate: 0.40},
+			{EventName: "button_click", URL: "/blog/article-1", MinDuration: 2, MaxDuration: 10, DropOffRate: 0.20},
+			{EventName: "form_submit", URL: "/blog/article-1", MinDuration: 10, MaxDuration: 60, DropOffRate: 0.30},
+		},
+	},
+	// Mobile App Install Journey
+	{
+		Name:    "Mobile App Install",
+		Weight:  20,
+		Country: "India",
+		Browser: "Chrome",
+		Device:  "Mobile",
+		Steps: []FunnelStep{
+			{EventName: "page_view", URL: "/mobile", MinDuration: 5, MaxDuration: 20, DropOffRate: 0.30},
+			{EventName: "button_click", URL: "/mobile", MinDuration: 2, MaxDuration: 10, DropOffRate: 0.25},
+			{EventName: "app_install", URL: "/mobile", MinDuration: 30, MaxDuration: 180, DropOffRate: 0.60},
+			{EventName: "app_open", URL: "/mobile", MinDuration: 5, MaxDuration: 3600, DropOffRate: 0.35},
+		},
+	},
+	// Video Engagement
+	{
+		Name:    "Video Engagement",
+		Weight:  15,
+		Country: "Canada",
+		Browser: "Safari",
+		Device:  "Tablet",
+		Steps: []FunnelStep{
+			{EventName: "page_view", URL: "/features", MinDuration: 5, MaxDuration: 20, DropOffRate: 0.20},
+			{EventName: "video_play", URL: "/features", MinDuration: 10, MaxDuration: 60, DropOffRate: 0.45},
+			{EventName: "button_click", URL: "/features", MinDuration: 2, MaxDuration: 10, DropOffRate: 0.35},
+			{EventName: "signup", URL: "/signup", MinDuration: 30, MaxDuration: 120, DropOffRate: 0.50},
+		},
+	},
+	// Support Journey
+	{
+		Name:    "Support Journey",
+		Weight:  10,
+		Country: "Australia",
+		Browser: "Edge",
+		Device:  "Desktop",
+		Steps: []FunnelStep{
+			{EventName: "page_view", URL: "/help", MinDuration: 10, MaxDuration: 60, DropOffRate: 0.25},
+			{EventName: "search", URL: "/help", MinDuration: 5, MaxDuration: 30, DropOffRate: 0.40},
+			{EventName: "page_view", URL: "/support", MinDuration: 20, MaxDuration: 180, DropOffRate: 0.50},
+			{EventName: "button_click", URL: "/support", MinDuration: 2, MaxDuration: 10, DropOffRate: 0.30},
+		},
+	},
+}
+
+// User agent mapping
+var userAgentMap = map[string]map[string]string{
+	"Desktop": {
+		"Chrome":  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Safari":  "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+		"Firefox": "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		"Edge":    "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+	},
+	"Mobile": {
+		"Chrome": "Mozilla/5.0 (Linux; Android 14; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+		"Safari": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+	},
+	"Tablet": {
+		"Chrome": "Mozilla/5.0 (Linux; Android 14; SM-T870) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Safari": "Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+	},
+}
+
+// OS mapping
+var osMap = map[string]string{
+	"Desktop": "Windows",
+	"Mobile":  "Android",
+	"Tablet":  "iOS",
+}
+
+// IP ranges by country
+var ipRangesByCountry = map[string]string{
+	"United States":  "203.0.113",
+	"United Kingdom": "185.199.108",
+	"Germany":        "151.101.1",
+	"India":          "104.16.132",
+	"Canada":         "198.51.100",
+	"Australia":      "203.113.0",
+	"Palestine":      "185.178.220",
+}
+
+// Referrers a journey starts from
+var journeyReferrers = []string{
+	"https://google.com/search?q=best+product",
+	"https://facebook.com",
+	"https://twitter.com",
+	"https://linkedin.com",
+	"https://reddit.com/r/technology",
+	"direct",
+	"email",
+	"",
+}
+
+// selectFunnel selects a funnel template based on weights
+func selectFunnel() FunnelTemplate {
+	totalWeight := 0
+	for _, ft := range FunnelTemplates {
+		totalWeight += ft.Weight
+	}
+
+	r := rand.Intn(totalWeight)
+	currentWeight := 0
+
+	for _, ft := range FunnelTemplates {
+		currentWeight += ft.Weight
+		if r < currentWeight {
+			return ft
+		}
+	}
+
+	return FunnelTemplates[0]
+}
+
+// Journey creates a sequence of events for one user following a funnel template,
+// starting at baseTime. Later steps may be dropped as the template says.
+func Journey(userID string, projectID string, baseTime time.Time) []Event {
+	funnel := selectFunnel()
+
+	sessionID := fmt.Sprintf("sess_%s_%d", userID, rand.Intn(100))
+	currentTime := baseTime
+
+	// Get user agent
+	userAgent := userAgentMap[funnel.Device][funnel.Browser]
+	if userAgent == "" {
+		userAgent = userAgentMap["Desktop"]["Chrome"]
+	}
+
+	// Get OS
+	os := osMap[funnel.Device]
+	if os == "" {
+		os = "Windows"
+	}
+
+	// Get IP range
+	ipBase := ipRangesByCountry[funnel.Country]
+	if ipBase == "" {
+		ipBase = "192.168.1"
+	}
+	ip := fmt.Sprintf("%s.%d", ipBase, rand.Intn(255)+1)
+
+	// Referrer
+	referrer := journeyReferrers[rand.Intn(len(journeyReferrers))]
+
+	var events []Event
+
+	for i, step := range funnel.Steps {
+		// Check drop-off
+		if i > 0 && rand.Float64() < step.DropOffRate {
+			// User dropped off at this step
+			break
+		}
+
+		// Calculate time spent on this step
+		duration := step.MinDuration + rand.Intn(step.MaxDuration-step.MinDuration+1)
+		currentTime = currentTime.Add(time.Duration(duration) * time.Second)
+
+		event := Event{
+			Timestamp:       currentTime,
+			EventName:       step.EventName,
+			UserID:          userID,
+			SessionID:       sessionID,
+			SessionDuration: int(currentTime.Sub(baseTime).Seconds()),
+			URL:             step.URL,
+			Referrer:        referrer,
+			UserAgent:       userAgent,
+			IP:              ip,
+			Country:         funnel.Country,
+			Browser:         funnel.Browser,
+			OS:              os,
+			Device:          funnel.Device,
+			IsBot:           false,
+			ProjectID:       projectID,
+		}
+
+		events = append(events, event)
+
+		// After first step, referrer becomes the previous URL
+		referrer = step.URL
+	}
+
+	return events
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxLatencySamples bounds the latencies kept for percentiles. Past it, samples are
+// replaced at random (reservoir sampling), so long runs use constant memory while
+// every request still has the same chance of being kept.
+const maxLatencySamples = 100000
+
+// LatencyRecorder collects request latencies from concurrent workers. Count, min,
+// max and average are exact; percentiles come from the sampled reservoir.
+type LatencyRecorder struct {
+	mu       sync.Mutex
+	samples  []time.Duration
+	capacity int
+	rng      *rand.Rand
+
+	count int64
+	total time.Duration
+	min   time.Duration
+	max   time.Duration
+}
+
+// NewLatencyRecorder keeps up to capacity samples for percentiles
+func NewLatencyRecorder(capacity int) *LatencyRecorder {
+	return &LatencyRecorder{
+		samples:  make([]time.Duration, 0, min(capacity, 1024)),
+		capacity: capacity,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Record adds the latency of one request
+func (lr *LatencyRecorder) Record(d time.Duration) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.count++
+	lr.total += d
+	if lr.count == 1 || d < lr.min {
+		lr.min = d
+	}
+	if d > lr.max {
+		lr.max = d
+	}
+
+	if len(lr.samples) < lr.capacity {
+		lr.samples = append(lr.samples, d)
+	} else if i := lr.rng.Int63n(lr.count); i < int64(lr.capacity) {
+		lr.samples[i] = d
+	}
+}
+
+// LatencyStats summarizes the recorded latencies
+type LatencyStats struct {
+	Count int64
+	Min   time.Duration
+	Max   time.Duration
+	Avg   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// Stats returns the summary of the latencies recorded so far
+func (lr *LatencyRecorder) Stats() LatencyStats {
+	lr.mu.Lock()
+	sorted := slices.Clone(lr.samples)
+	stats := LatencyStats{Count: lr.count, Min: lr.min, Max: lr.max}
+	if lr.count > 0 {
+		stats.Avg = lr.total / time.Duration(lr.count)
+	}
+	lr.mu.Unlock()
+
+	slices.Sort(sorted)
+	stats.P50 = percentile(sorted, 50)
+	stats.P90 = percentile(sorted, 90)
+	stats.P95 = percentile(sorted, 95)
+	stats.P99 = percentile(sorted, 99)
+	return stats
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted latencies: the
+// smallest value at least p% of them are less than or equal to
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// printLatencyStats logs the latency summary of a load test
+func printLatencyStats(stats LatencyStats) {
+	if stats.Count == 0 {
+		return
+	}
+	log.Printf("⏳ Latency: min %v | avg %v | max %v", stats.Min, stats.Avg, stats.Max)
+	log.Printf("📐 Percentiles: p50 %v | p90 %v | p95 %v | p99 %v", stats.P50, stats.P90, stats.P95, stats.P99)
+}
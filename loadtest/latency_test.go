@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	// 1ms to 100ms, so the p-th percentile is p milliseconds
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	tests := []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{90, 90 * time.Millisecond},
+		{95, 95 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{99.5, 100 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.expected {
+			t.Errorf("percentile(%v) = %v, expected %v", tt.p, got, tt.expected)
+		}
+	}
+
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("Expected 0 without samples, got %v", got)
+	}
+}
+
+func TestLatencyRecorder(t *testing.T) {
+	recorder := NewLatencyRecorder(1000)
+	// Recorded in reverse so the stats cannot rely on arrival order
+	for i := 1000; i >= 1; i-- {
+		recorder.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	stats := recorder.Stats()
+	expected := LatencyStats{
+		Count: 1000,
+		Min:   time.Microsecond,
+		Max:   1000 * time.Microsecond,
+		Avg:   500500 * time.Nanosecond,
+		P50:   500 * time.Microsecond,
+		P90:   900 * time.Microsecond,
+		P95:   950 * time.Microsecond,
+		P99:   990 * time.Microsecond,
+	}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestLatencyRecorderBounded(t *testing.T) {
+	recorder := NewLatencyRecorder(100)
+	for i := 0; i < 10000; i++ {
+		recorder.Record(time.Duration(i%10+1) * time.Millisecond)
+	}
+
+	if len(recorder.samples) != 100 {
+		t.Errorf("Expected 100 samples kept, got %d", len(recorder.samples))
+	}
+	stats := recorder.Stats()
+	if stats.Count != 10000 || stats.Min != time.Millisecond || stats.Max != 10*time.Millisecond {
+		t.Errorf("Expected exact count, min and max, got %+v", stats)
+	}
+	if stats.P50 < time.Millisecond || stats.P99 > 10*time.Millisecond {
+		t.Errorf("Expected percentiles within the recorded range, got %+v", stats)
+	}
+}
@@ -9,265 +9,27 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	_ "github.com/duckdb/duckdb-go/v2"
-)
-
-// Event represents an analytics event for load testing
-type Event struct {
-	ID              uint64    `json:"id,omitempty"`
-	Timestamp       time.Time `json:"timestamp"`
-	EventName       string    `json:"event_name"`
-	UserID          string    `json:"user_id"`
-	SessionID       string    `json:"session_id"`
-	SessionDuration int       `json:"session_duration"`
-	URL             string    `json:"url"`
-	Referrer        string    `json:"referrer"`
-	UserAgent       string    `json:"user_agent"`
-	IP              string    `json:"ip"`
-	Country         string    `json:"country"`
-	Browser         string    `json:"browser"`
-	OS              string    `json:"os"`
-	Device          string    `json:"device"`
-	IsBot           bool      `json:"is_bot"`
-	ProjectID       string    `json:"project_id"`
-	Channel         string    `json:"channel"`
-}
-
-// Sample data for realistic events
-var (
-	eventNames = []string{
-		"page_view", "button_click", "form_submit", "signup", "login", "logout",
-		"purchase", "add_to_cart", "checkout_started", "payment_completed",
-		"video_play", "video_pause", "search", "download", "share", "like",
-		"comment", "follow", "unfollow", "profile_view", "settings_change",
-		"notification_click", "email_open", "email_click", "app_install",
-		"app_open", "feature_used", "error_occurred", "session_start", "session_end",
-	}
-
-	urls = []string{
-		"/", "/home", "/about", "/contact", "/pricing", "/features", "/blog",
-		"/login", "/signup", "/dashboard", "/profile", "/settings", "/help",
-		"/product/123", "/product/456", "/product/789", "/category/electronics",
-		"/category/clothing", "/category/books", "/search?q=laptop", "/cart",
-		"/checkout", "/payment", "/confirmation", "/account", "/orders", "/support",
-	}
-
-	referrers = []string{
-		"", "https://google.com", "https://facebook.com", "https://twitter.com",
-		"https://linkedin.com", "https://reddit.com", "https://youtube.com",
-		"https://github.com", "https://stackoverflow.com", "https://medium.com",
-		"https://dev.to", "https://hackernews.com", "direct", "email",
-		// Paid channels
-		"https://google.com/ads", "https://facebook.com/ads", "https://twitter.com/ads",
-		"https://linkedin.com/ads", "https://instagram.com/ads",
-		// Organic search
-		"https://www.google.com/search", "https://www.bing.com/search", "https://search.yahoo.com",
-		// Social
-		"https://t.co", "https://www.facebook.com", "https://www.linkedin.com",
-		"https://www.instagram.com", "https://www.tiktok.com",
-	}
-
-	userAgents = []string{
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0",
-		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
-		"Mozilla/5.0 (Linux; Android 14; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
-	}
-
-	botUserAgents = []string{
-		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
-		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
-		"Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)",
-		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
-		"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)",
-		"Twitterbot/1.0",
-	}
-
-	countries = []string{
-		"United States", "Canada", "United Kingdom", "Germany", "France", "Spain",
-		"Italy", "Netherlands", "Sweden", "Norway", "Denmark", "Finland",
-		"Australia", "New Zealand", "Japan", "South Korea", "Singapore", "India",
-		"Brazil", "Mexico", "Argentina", "Chile", "Russia", "China", "Palestine",
-	}
-
-	browsers = []string{
-		"Chrome", "Safari", "Firefox", "Edge", "Opera", "Brave",
-	}
-
-	operatingSystems = []string{
-		"Windows", "MacOS", "Linux", "iOS", "Android", "ChromeOS",
-	}
-
-	devices = []string{
-		"Desktop", "Mobile", "Tablet",
-	}
+	"github.com/mohamedelhefni/siraaj/loadtest/internal/gen"
 
-	ipRanges = []string{
-		"192.168.1", "10.0.0", "172.16.0", "203.0.113", "198.51.100",
-		"203.113.0", "185.199.108", "140.82.112", "151.101.1", "104.16.132",
-	}
+	_ "github.com/duckdb/duckdb-go/v2"
 )
 
-// DetectChannel determines the traffic channel based on referrer and URL
-func DetectChannel(referrer, url string) string {
-	// Priority 1: Paid channels (utm_medium or utm_source contains paid/cpc/ppc)
-	if containsAny(url, []string{"utm_medium=cpc", "utm_medium=ppc", "utm_medium=paid", "utm_source=paid"}) ||
-		containsAny(referrer, []string{"/ads", "adwords", "googleads", "facebook.com/ads"}) {
-		return "Paid"
-	}
-
-	// Priority 2: Direct traffic (no referrer or same domain)
-	if referrer == "" || referrer == "direct" {
-		return "Direct"
-	}
-
-	// Priority 3: Social media
-	socialDomains := []string{
-		"facebook.com", "twitter.com", "linkedin.com", "instagram.com",
-		"tiktok.com", "pinterest.com", "reddit.com", "youtube.com",
-		"snapchat.com", "whatsapp.com", "telegram.org", "t.co",
-	}
-	if containsAnyDomain(referrer, socialDomains) {
-		return "Social"
-	}
-
-	// Priority 4: Organic search
-	searchEngines := []string{
-		"google.com/search", "bing.com/search", "yahoo.com/search",
-		"duckduckgo.com", "baidu.com", "yandex.com", "ask.com",
-	}
-	if containsAny(referrer, searchEngines) {
-		return "Organic"
-	}
-
-	// Priority 5: Referral (all other external sources)
-	return "Referral"
-}
-
-// containsAny checks if the text contains any of the substrings
-func containsAny(text string, substrings []string) bool {
-	for _, substr := range substrings {
-		if len(text) >= len(substr) && indexOfSubstring(text, substr) >= 0 {
-			return true
-		}
-	}
-	return false
-}
-
-// containsAnyDomain checks if the referrer URL contains any of the domains
-func containsAnyDomain(referrer string, domains []string) bool {
-	for _, domain := range domains {
-		if indexOfSubstring(referrer, domain) >= 0 {
-			return true
-		}
-	}
-	return false
-}
-
-// indexOfSubstring finds the index of a substring (case-insensitive)
-func indexOfSubstring(s, substr string) int {
-	sLower := toLower(s)
-	substrLower := toLower(substr)
-	for i := 0; i <= len(sLower)-len(substrLower); i++ {
-		if sLower[i:i+len(substrLower)] == substrLower {
-			return i
-		}
-	}
-	return -1
-}
-
-// toLower converts a string to lowercase
-func toLower(s string) string {
-	result := make([]byte, len(s))
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c >= 'A' && c <= 'Z' {
-			result[i] = c + 32
-		} else {
-			result[i] = c
-		}
-	}
-	return string(result)
-}
-
-// GenerateRandomEvent creates a realistic random event
-func GenerateRandomEvent(baseTime time.Time, userPool []string, projectID string) Event {
-	// Random timestamp within the last 30 days
-	hoursBack := rand.Intn(30 * 24)
-	timestamp := baseTime.Add(-time.Duration(hoursBack) * time.Hour)
-	timestamp = timestamp.Add(time.Duration(rand.Intn(3600)) * time.Second)
-
-	// Select random user from pool
-	userID := userPool[rand.Intn(len(userPool))]
-
-	// Generate session ID
-	sessionID := fmt.Sprintf("sess_%s_%d", userID, rand.Intn(10))
-
-	// Generate session duration (0-3600 seconds, 1 hour max)
-	sessionDuration := rand.Intn(3600)
-
-	eventName := eventNames[rand.Intn(len(eventNames))]
-	url := urls[rand.Intn(len(urls))]
-	referrer := referrers[rand.Intn(len(referrers))]
-
-	// 20% chance of bot
-	isBot := rand.Float32() < 0.2
-	var userAgent string
-	if isBot {
-		userAgent = botUserAgents[rand.Intn(len(botUserAgents))]
-	} else {
-		userAgent = userAgents[rand.Intn(len(userAgents))]
-	}
-
-	country := countries[rand.Intn(len(countries))]
-	browser := browsers[rand.Intn(len(browsers))]
-	os := operatingSystems[rand.Intn(len(operatingSystems))]
-	device := devices[rand.Intn(len(devices))]
-
-	// Generate realistic IP
-	ipBase := ipRanges[rand.Intn(len(ipRanges))]
-	ip := fmt.Sprintf("%s.%d", ipBase, rand.Intn(255)+1)
-
-	// Detect channel based on referrer and URL
-	channel := DetectChannel(referrer, url)
-
-	return Event{
-		Timestamp:       timestamp,
-		EventName:       eventName,
-		UserID:          userID,
-		SessionID:       sessionID,
-		SessionDuration: sessionDuration,
-		URL:             url,
-		Referrer:        referrer,
-		UserAgent:       userAgent,
-		IP:              ip,
-		Country:         country,
-		Browser:         browser,
-		OS:              os,
-		Device:          device,
-		IsBot:           isBot,
-		ProjectID:       projectID,
-		Channel:         channel,
-	}
-}
-
 // ========== DATABASE MODE ==========
 
 type DBLoadTester struct {
-	db *sql.DB
+	db        *sql.DB
+	generator *gen.Generator
 }
 
-func NewDBLoadTester(dbPath string) (*DBLoadTester, error) {
+func NewDBLoadTester(dbPath string, generator *gen.Generator) (*DBLoadTester, error) {
 	db, err := sql.Open("duckdb", dbPath)
 	if err != nil {
 		return nil, err
@@ -277,14 +39,14 @@ func NewDBLoadTester(dbPath string) (*DBLoadTester, error) {
 		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	return &DBLoadTester{db: db}, nil
+	return &DBLoadTester{db: db, generator: generator}, nil
 }
 
 func (lt *DBLoadTester) Close() error {
 	return lt.db.Close()
 }
 
-func (lt *DBLoadTester) InsertEventsBatch(events []Event) error {
+func (lt *DBLoadTester) InsertEventsBatch(events []gen.Event) error {
 	if len(events) == 0 {
 		return nil
 	}
@@ -353,9 +115,9 @@ func (lt *DBLoadTester) RunLoadTest(totalEvents int, batchSize int, numUsers int
 			eventsInBatch = totalEvents - (batch * batchSize)
 		}
 
-		events := make([]Event, eventsInBatch)
+		events := make([]gen.Event, eventsInBatch)
 		for i := 0; i < eventsInBatch; i++ {
-			events[i] = GenerateRandomEvent(baseTime, userPool, projectID)
+			events[i] = lt.generator.RandomEvent(baseTime, userPool, projectID)
 		}
 
 		if err := lt.InsertEventsBatch(events); err != nil {
@@ -390,12 +152,18 @@ func (lt *DBLoadTester) RunLoadTest(totalEvents int, batchSize int, numUsers int
 
 // ========== HTTP MODE ==========
 
+// maxServerBatchSize is the most events the server accepts per batch by default,
+// see TRACK_MAX_BATCH_SIZE
+const maxServerBatchSize = 100
+
 type HTTPLoadTester struct {
-	endpoint string
-	client   *http.Client
+	endpoint      string
+	batchEndpoint string
+	client        *http.Client
+	generator     *gen.Generator
 }
 
-func NewHTTPLoadTester(endpoint string) *HTTPLoadTester {
+func NewHTTPLoadTester(endpoint string, generator *gen.Generator) *HTTPLoadTester {
 	// High-performance HTTP client
 	transport := &http.Transport{
 		MaxIdleConns:        1000,
@@ -412,12 +180,25 @@ func NewHTTPLoadTester(endpoint string) *HTTPLoadTester {
 	}
 
 	return &HTTPLoadTester{
-		endpoint: endpoint,
-		client:   client,
+		endpoint:      endpoint,
+		batchEndpoint: serverURL(endpoint, "/api/track/batch"),
+		client:        client,
+		generator:     generator,
 	}
 }
 
-func (ht *HTTPLoadTester) SendEvent(event Event) error {
+// serverURL returns the URL of path on the server of endpoint
+func serverURL(endpoint, path string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	u.Path = path
+	u.RawQuery = ""
+	return u.String()
+}
+
+func (ht *HTTPLoadTester) SendEvent(event gen.Event) error {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return err
@@ -446,8 +227,59 @@ func (ht *HTTPLoadTester) SendEvent(event Event) error {
 	return nil
 }
 
-func (ht *HTTPLoadTester) RunLoadTest(totalEvents int, workers int, numUsers int, projectID string) error {
+// SendBatch posts events to the batch endpoint and returns how many the server
+// rejected; a partially accepted batch is not an error
+func (ht *HTTPLoadTester) SendBatch(events []gen.Event) (int, error) {
+	data, err := json.Marshal(map[string][]gen.Event{"events": events})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", ht.batchEndpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ht.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus {
+		io.Copy(io.Discard, resp.Body)
+		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Failed int `json:"failed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode batch response: %w", err)
+	}
+	return result.Failed, nil
+}
+
+// send delivers one request of a load test: a single event, or a batch when there
+// are several. It returns the events the server rejected.
+func (ht *HTTPLoadTester) send(events []gen.Event) (int, error) {
+	if len(events) == 1 {
+		return 0, ht.SendEvent(events[0])
+	}
+	return ht.SendBatch(events)
+}
+
+// RunLoadTest sends totalEvents and returns how many the server accepted
+func (ht *HTTPLoadTester) RunLoadTest(totalEvents int, workers int, numUsers int, projectID string, batchSize int, schedule RateSchedule) (int64, error) {
 	log.Printf("🚀 Starting HTTP load test: %d events, %d workers, %d users", totalEvents, workers, numUsers)
+	if batchSize > 1 {
+		log.Printf("📦 Sending batches of %d events to %s", batchSize, ht.batchEndpoint)
+	}
+	if schedule.Paced() {
+		log.Printf("🎯 Pacing at %.0f req/s after a %v ramp", schedule.Target, schedule.Ramp)
+	}
 
 	userPool := make([]string, numUsers)
 	for i := 0; i < numUsers; i++ {
@@ -457,23 +289,33 @@ func (ht *HTTPLoadTester) RunLoadTest(totalEvents int, workers int, numUsers int
 	baseTime := time.Now()
 	start := time.Now()
 
+	// Requests and events are counted apart, since a batch carries many events
 	var successCount atomic.Int64
 	var errorCount atomic.Int64
+	var eventCount atomic.Int64
+	var eventErrorCount atomic.Int64
+	latencies := NewLatencyRecorder(maxLatencySamples)
 	var wg sync.WaitGroup
 
-	// Channel for events
-	eventChan := make(chan Event, workers*2)
+	// Channel for requests, one event or one batch each
+	requestChan := make(chan []gen.Event, workers*2)
 
 	// Start workers
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for event := range eventChan {
-				if err := ht.SendEvent(event); err != nil {
+			for events := range requestChan {
+				sent := time.Now()
+				rejected, err := ht.send(events)
+				if err != nil {
 					errorCount.Add(1)
+					eventErrorCount.Add(int64(len(events)))
 				} else {
 					successCount.Add(1)
+					eventCount.Add(int64(len(events) - rejected))
+					eventErrorCount.Add(int64(rejected))
+					latencies.Record(time.Since(sent))
 				}
 			}
 		}()
@@ -488,48 +330,69 @@ func (ht *HTTPLoadTester) RunLoadTest(totalEvents int, workers int, numUsers int
 			select {
 			case <-ticker.C:
 				elapsed := time.Since(start)
-				success := successCount.Load()
+				requests := successCount.Load()
 				errors := errorCount.Load()
-				rate := float64(success) / elapsed.Seconds()
-				log.Printf("📊 Progress: %d sent, %d errors | Rate: %.0f events/sec", success, errors, rate)
+				events := eventCount.Load()
+				log.Printf("📊 Progress: %d requests, %d errors, %d events | Rate: %.0f req/sec, %.0f events/sec",
+					requests, errors, events, float64(requests)/elapsed.Seconds(), float64(events)/elapsed.Seconds())
 			case <-done:
 				return
 			}
 		}
 	}()
 
-	// Generate and send events
-	for i := 0; i < totalEvents; i++ {
-		event := GenerateRandomEvent(baseTime, userPool, projectID)
-		eventChan <- event
+	// Generate and send requests, at the schedule's pace when it has a target
+	totalRequests := (totalEvents + batchSize - 1) / batchSize
+	steadyFrom := min(schedule.rampRequests(), totalRequests)
+	var steadyStart time.Time
+	for i := 0; i < totalRequests; i++ {
+		events := make([]gen.Event, min(batchSize, totalEvents-i*batchSize))
+		for j := range events {
+			events[j] = ht.generator.RandomEvent(baseTime, userPool, projectID)
+		}
+		if schedule.Paced() {
+			schedule.Wait(start, i)
+		}
+		if i == steadyFrom {
+			steadyStart = time.Now()
+		}
+		requestChan <- events
 	}
 
-	close(eventChan)
+	close(requestChan)
 	wg.Wait()
 	close(done)
 
 	duration := time.Since(start)
-	success := successCount.Load()
+	var steadyDuration time.Duration
+	if !steadyStart.IsZero() {
+		steadyDuration = time.Since(steadyStart)
+	}
+	requests := successCount.Load()
 	errors := errorCount.Load()
-	rate := float64(success) / duration.Seconds()
+	events := eventCount.Load()
 
 	log.Printf("✅ HTTP load test completed!")
-	log.Printf("📈 Total events sent: %d", success)
-	log.Printf("❌ Errors: %d", errors)
+	log.Printf("📈 Total requests sent: %d", requests)
+	log.Printf("📈 Total events accepted: %d", events)
+	log.Printf("❌ Errors: %d requests, %d events", errors, eventErrorCount.Load())
 	log.Printf("⏱️  Total time: %v", duration)
-	log.Printf("🚄 Average rate: %.0f events/sec", rate)
+	log.Printf("🚄 Average rate: %.0f req/sec, %.0f events/sec", float64(requests)/duration.Seconds(), float64(events)/duration.Seconds())
+	printLatencyStats(latencies.Stats())
+	printRateStats(schedule, totalRequests-steadyFrom, steadyDuration)
 
-	return nil
+	return events, nil
 }
 
 // ========== CSV GENERATOR ==========
 
 type CSVGenerator struct {
-	filepath string
+	filepath  string
+	generator *gen.Generator
 }
 
-func NewCSVGenerator(filepath string) *CSVGenerator {
-	return &CSVGenerator{filepath: filepath}
+func NewCSVGenerator(filepath string, generator *gen.Generator) *CSVGenerator {
+	return &CSVGenerator{filepath: filepath, generator: generator}
 }
 
 func (cg *CSVGenerator) GenerateCSV(totalEvents int, numUsers int, projectID string) error {
@@ -562,7 +425,7 @@ func (cg *CSVGenerator) GenerateCSV(totalEvents int, numUsers int, projectID str
 	start := time.Now()
 
 	for i := 0; i < totalEvents; i++ {
-		event := GenerateRandomEvent(baseTime, userPool, projectID)
+		event := cg.generator.RandomEvent(baseTime, userPool, projectID)
 
 		record := []string{
 			event.Timestamp.Format(time.RFC3339),
@@ -777,7 +640,7 @@ func (cg *CSVGenerator) ImportParquetToDatabase(parquetPath, dbPath string) erro
 }
 
 // csvRecordToEvent converts CSV record to Event struct (for HTTP mode)
-func csvRecordToEvent(record []string, currentID *uint64) (Event, error) {
+func csvRecordToEvent(record []string, currentID *uint64) (gen.Event, error) {
 	*currentID++
 
 	// Parse timestamp
@@ -792,7 +655,7 @@ func csvRecordToEvent(record []string, currentID *uint64) (Event, error) {
 	// Parse is_bot
 	isBot, _ := strconv.ParseBool(record[13])
 
-	return Event{
+	return gen.Event{
 		ID:              *currentID,
 		Timestamp:       timestamp,
 		EventName:       record[1],
@@ -820,11 +683,18 @@ func main() {
 	events := flag.Int("events", 1000000, "Total number of events to generate")
 	batchSize := flag.Int("batch", 1000, "Batch size for DB mode")
 	workers := flag.Int("workers", 50, "Number of concurrent workers for HTTP mode")
+	httpBatchSize := flag.Int("batch-size", 1, "Events per request for HTTP mode, more than 1 posts batches to /api/track/batch")
 	users := flag.Int("users", 10000, "Number of unique users to simulate")
 	projectID := flag.String("project", "test_project", "Project ID for events")
 	dbPath := flag.String("db", "../data/analytics.db", "Database path for DB mode")
 	endpoint := flag.String("endpoint", "http://localhost:8080/api/events", "API endpoint for HTTP mode")
 	csvPath := flag.String("csv", "../data/loadtest.csv", "CSV file path for CSV mode")
+	targetRPS := flag.Float64("target-rps", 0, "Requests per second to hold in HTTP mode, 0 for as fast as possible")
+	ramp := flag.Duration("ramp", 0, "Time to ramp linearly up to -target-rps in HTTP mode")
+	verify := flag.Bool("verify", false, "In HTTP mode, check afterwards that every accepted event was stored, exiting non-zero otherwise")
+	adminKey := flag.String("admin-key", os.Getenv("ADMIN_API_KEY"), "Admin API key used by -verify to flush the server")
+	tolerance := flag.Float64("tolerance", 0, "Fraction the stored count may differ by with -verify, e.g. 0.05 when the server samples")
+	distributionPath := flag.String("distribution", "", "JSON file with event and channel weights and the bot ratio, see README")
 
 	flag.Parse()
 
@@ -834,12 +704,25 @@ func main() {
 	log.Printf("  Users: %d", *users)
 	log.Printf("  Project ID: %s", *projectID)
 
+	distribution := gen.DefaultDistribution()
+	if *distributionPath != "" {
+		log.Printf("  Distribution: %s", *distributionPath)
+		var err error
+		if distribution, err = gen.LoadDistribution(*distributionPath); err != nil {
+			log.Fatal("Failed to load distribution: ", err)
+		}
+	}
+	generator, err := gen.NewGenerator(distribution)
+	if err != nil {
+		log.Fatal("Invalid distribution: ", err)
+	}
+
 	switch *mode {
 	case "db":
 		log.Printf("  Database: %s", *dbPath)
 		log.Printf("  Batch Size: %d", *batchSize)
 
-		lt, err := NewDBLoadTester(*dbPath)
+		lt, err := NewDBLoadTester(*dbPath, generator)
 		if err != nil {
 			log.Fatal("Failed to create DB load tester:", err)
 		}
@@ -852,18 +735,48 @@ func main() {
 	case "http":
 		log.Printf("  Endpoint: %s", *endpoint)
 		log.Printf("  Workers: %d", *workers)
+		log.Printf("  Batch Size: %d", *httpBatchSize)
+		if *targetRPS < 0 || *ramp < 0 {
+			log.Fatal("-target-rps and -ramp must not be negative")
+		}
+		if *ramp > 0 && *targetRPS == 0 {
+			log.Fatal("-ramp requires -target-rps")
+		}
+		if *httpBatchSize < 1 || *httpBatchSize > maxServerBatchSize {
+			log.Fatalf("-batch-size must be between 1 and %d, the server's batch limit", maxServerBatchSize)
+		}
+		if *tolerance < 0 {
+			log.Fatal("-tolerance must not be negative")
+		}
+
+		// Verified runs get a project of their own, so earlier events do not count
+		project := *projectID
+		if *verify {
+			project = verifyProjectID(project)
+			log.Printf("  Verify Project ID: %s", project)
+		}
 
-		ht := NewHTTPLoadTester(*endpoint)
-		if err := ht.RunLoadTest(*events, *workers, *users, *projectID); err != nil {
+		ht := NewHTTPLoadTester(*endpoint, generator)
+		schedule := RateSchedule{Target: *targetRPS, Ramp: *ramp}
+		accepted, err := ht.RunLoadTest(*events, *workers, *users, project, *httpBatchSize, schedule)
+		if err != nil {
 			log.Fatal("HTTP load test failed:", err)
 		}
 
+		if *verify {
+			log.Printf("🔍 Verifying %d accepted events were stored...", accepted)
+			if err := ht.Verify(project, accepted, *adminKey, *tolerance); err != nil {
+				log.Fatal("❌ Verification failed: ", err)
+			}
+			log.Printf("✅ Verified: every accepted event was stored")
+		}
+
 	case "csv":
 		log.Printf("  CSV Path: %s", *csvPath)
 		log.Printf("  Parquet Path: %s", "../data/events.parquet")
 		log.Printf("  Database: %s", *dbPath)
 
-		cg := NewCSVGenerator(*csvPath)
+		cg := NewCSVGenerator(*csvPath, generator)
 
 		// Generate CSV
 		if err := cg.GenerateCSV(*events, *users, *projectID); err != nil {
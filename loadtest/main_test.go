@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mohamedelhefni/siraaj/loadtest/internal/gen"
+)
+
+func TestServerURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		expected string
+	}{
+		{"http://localhost:8080/api/track", "http://localhost:8080/api/track/batch"},
+		{"http://localhost:8080/api/events?debug=1", "http://localhost:8080/api/track/batch"},
+		{"https://analytics.example.com", "https://analytics.example.com/api/track/batch"},
+	}
+	for _, tt := range tests {
+		if got := serverURL(tt.endpoint, "/api/track/batch"); got != tt.expected {
+			t.Errorf("serverURL(%q) = %q, expected %q", tt.endpoint, got, tt.expected)
+		}
+	}
+}
+
+func TestSendBatch(t *testing.T) {
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/track/batch" {
+			t.Errorf("Expected the batch endpoint, got %s", r.URL.Path)
+		}
+		var body struct {
+			Events []gen.Event `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode the batch: %v", err)
+		}
+		received = len(body.Events)
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"status":"partial","total":3,"successful":2,"failed":1}`))
+	}))
+	defer server.Close()
+
+	ht := NewHTTPLoadTester(server.URL+"/api/track", nil)
+	rejected, err := ht.SendBatch([]gen.Event{{EventName: "a"}, {EventName: "b"}, {EventName: ""}})
+	if err != nil {
+		t.Fatalf("SendBatch failed: %v", err)
+	}
+	if received != 3 || rejected != 1 {
+		t.Errorf("Expected 3 events sent and 1 rejected, got %d and %d", received, rejected)
+	}
+}
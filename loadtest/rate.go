@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// sustainedRatio is the share of the target rate the steady phase must reach for
+// the target to count as sustained
+const sustainedRatio = 0.95
+
+// RateSchedule paces HTTP mode dispatch: a linear ramp from zero to Target requests
+// per second over Ramp, then a steady Target. A zero Target sends as fast as the
+// workers allow.
+type RateSchedule struct {
+	Target float64
+	Ramp   time.Duration
+}
+
+// Paced reports whether requests are dispatched at a target rate
+func (rs RateSchedule) Paced() bool {
+	return rs.Target > 0
+}
+
+// rampRequests is how many requests the ramp dispatches before the steady phase
+func (rs RateSchedule) rampRequests() int {
+	return int(rs.Target * rs.Ramp.Seconds() / 2)
+}
+
+// Offset returns when request n (from 0) is due, from the start of the run. During
+// the ramp n requests take sqrt(2*Ramp*n/Target) seconds, after it 1/Target each.
+func (rs RateSchedule) Offset(n int) time.Duration {
+	if !rs.Paced() {
+		return 0
+	}
+	if ramped := rs.rampRequests(); n < ramped {
+		return time.Duration(math.Sqrt(2*rs.Ramp.Seconds()*float64(n)/rs.Target) * float64(time.Second))
+	}
+	steady := float64(n)/rs.Target - rs.Ramp.Seconds()/2
+	return rs.Ramp + time.Duration(steady*float64(time.Second))
+}
+
+// Wait sleeps until request n is due
+func (rs RateSchedule) Wait(start time.Time, n int) {
+	if wait := time.Until(start.Add(rs.Offset(n))); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Sustained reports whether an achieved steady-phase rate holds the target
+func (rs RateSchedule) Sustained(achieved float64) bool {
+	return achieved >= rs.Target*sustainedRatio
+}
+
+// printRateStats logs the rate the steady phase reached against the target
+func printRateStats(schedule RateSchedule, steadyRequests int, steadyDuration time.Duration) {
+	if !schedule.Paced() {
+		return
+	}
+	if steadyRequests <= 0 || steadyDuration <= 0 {
+		log.Printf("🎯 Target: %.0f req/s not reached, every request was sent during the ramp", schedule.Target)
+		return
+	}
+
+	achieved := float64(steadyRequests) / steadyDuration.Seconds()
+	if schedule.Sustained(achieved) {
+		log.Printf("🎯 Target: %.0f req/s sustained (%.0f req/s after the ramp)", schedule.Target, achieved)
+	} else {
+		log.Printf("🎯 Target: %.0f req/s NOT sustained (%.0f req/s after the ramp, %.0f%%)", schedule.Target, achieved, achieved/schedule.Target*100)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateScheduleOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule RateSchedule
+		n        int
+		expected time.Duration
+	}{
+		{"Unpaced", RateSchedule{}, 500, 0},
+		{"Steady", RateSchedule{Target: 100}, 0, 0},
+		{"Steady request 250", RateSchedule{Target: 100}, 250, 2500 * time.Millisecond},
+		// A 10s ramp to 100 req/s sends 500 requests, a quarter of them in the first half
+		{"Ramp start", RateSchedule{Target: 100, Ramp: 10 * time.Second}, 0, 0},
+		{"Ramp middle", RateSchedule{Target: 100, Ramp: 10 * time.Second}, 125, 5 * time.Second},
+		{"Ramp end", RateSchedule{Target: 100, Ramp: 10 * time.Second}, 500, 10 * time.Second},
+		{"After the ramp", RateSchedule{Target: 100, Ramp: 10 * time.Second}, 700, 12 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.schedule.Offset(tt.n)
+			if diff := got - tt.expected; diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf("Offset(%d) = %v, expected %v", tt.n, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRateScheduleMonotonic(t *testing.T) {
+	schedule := RateSchedule{Target: 250, Ramp: 3 * time.Second}
+	previous := schedule.Offset(0)
+	for n := 1; n < 2000; n++ {
+		offset := schedule.Offset(n)
+		if offset < previous {
+			t.Fatalf("Offset(%d) = %v is before Offset(%d) = %v", n, offset, n-1, previous)
+		}
+		previous = offset
+	}
+}
+
+func TestRateScheduleSustained(t *testing.T) {
+	schedule := RateSchedule{Target: 1000}
+	if !schedule.Sustained(1000) || !schedule.Sustained(960) {
+		t.Error("Expected rates near the target sustained")
+	}
+	if schedule.Sustained(900) {
+		t.Error("Expected 90% of the target not sustained")
+	}
+}
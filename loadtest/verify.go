@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// verifyProjectID returns a project id no earlier run used, so the events stored
+// under it are exactly the ones this run sent
+func verifyProjectID(projectID string) string {
+	return fmt.Sprintf("%s_verify_%d", projectID, time.Now().UnixNano())
+}
+
+// Verify checks that the server stored the expected events under projectID. It
+// flushes the server's buffer through the admin API first, so buffered events are
+// counted, then compares the overview's total_events within tolerance, a fraction
+// of expected (0 for an exact match).
+func (ht *HTTPLoadTester) Verify(projectID string, expected int64, adminKey string, tolerance float64) error {
+	if err := ht.flush(adminKey); err != nil {
+		return err
+	}
+
+	// Generated events go back 30 days and an hour ahead, the range covers both
+	now := time.Now().UTC()
+	query := url.Values{
+		"project": {projectID},
+		"start":   {now.AddDate(0, 0, -31).Format("2006-01-02")},
+		"end":     {now.AddDate(0, 0, 1).Format("2006-01-02")},
+		"exact":   {"1"},
+	}
+	resp, err := ht.client.Get(serverURL(ht.endpoint, "/api/stats/overview") + "?" + query.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to query the overview: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("overview returned status code %d", resp.StatusCode)
+	}
+	var overview struct {
+		TotalEvents int64 `json:"total_events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&overview); err != nil {
+		return fmt.Errorf("failed to decode the overview: %w", err)
+	}
+
+	return checkStoredEvents(overview.TotalEvents, expected, tolerance)
+}
+
+// flush asks the server to write its buffered events
+func (ht *HTTPLoadTester) flush(adminKey string) error {
+	req, err := http.NewRequest("POST", serverURL(ht.endpoint, "/api/admin/flush"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Admin-Key", adminKey)
+
+	resp, err := ht.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("flush returned status code %d, set -admin-key to the server's ADMIN_API_KEY", resp.StatusCode)
+	}
+	return fmt.Errorf("flush returned status code %d", resp.StatusCode)
+}
+
+// checkStoredEvents compares the events stored with the ones the server accepted,
+// allowing a difference of tolerance times expected
+func checkStoredEvents(stored, expected int64, tolerance float64) error {
+	diff := math.Abs(float64(stored - expected))
+	if diff <= tolerance*float64(expected) {
+		return nil
+	}
+
+	off := 100.0
+	if expected > 0 {
+		off = diff / float64(expected) * 100
+	}
+	return fmt.Errorf("server stored %d events, %d were accepted (off by %.2f%%, tolerance %.2f%%)",
+		stored, expected, off, tolerance*100)
+}
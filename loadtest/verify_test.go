@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckStoredEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    int64
+		expected  int64
+		tolerance float64
+		wantErr   string
+	}{
+		{"Exact match", 1000, 1000, 0, ""},
+		{"Dropped events", 990, 1000, 0, "server stored 990 events, 1000 were accepted (off by 1.00%"},
+		{"Within tolerance", 960, 1000, 0.05, ""},
+		{"Over the estimate", 1040, 1000, 0.05, ""},
+		{"Outside tolerance", 900, 1000, 0.05, "off by 10.00%"},
+		{"Nothing accepted", 5, 0, 0.05, "off by 100.00%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStoredEvents(tt.stored, tt.expected, tt.tolerance)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	flushed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/admin/flush":
+			if r.Header.Get("X-Admin-Key") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			flushed = true
+			w.Write([]byte(`{}`))
+		case "/api/stats/overview":
+			if !flushed {
+				t.Error("Expected the flush before the overview")
+			}
+			if r.URL.Query().Get("project") != "run_1" || r.URL.Query().Get("exact") != "1" {
+				t.Errorf("Expected exact counts of the run's project, got %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"total_events":480,"unique_users":12}`))
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	ht := NewHTTPLoadTester(server.URL+"/api/track", nil)
+	if err := ht.Verify("run_1", 480, "secret", 0); err != nil {
+		t.Errorf("Expected the stored events verified, got %v", err)
+	}
+	if err := ht.Verify("run_1", 500, "secret", 0); err == nil {
+		t.Error("Expected missing events reported")
+	}
+	if err := ht.Verify("run_1", 480, "wrong", 0); err == nil || !strings.Contains(err.Error(), "-admin-key") {
+		t.Errorf("Expected the admin key error, got %v", err)
+	}
+}
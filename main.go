@@ -1,25 +1,35 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	_ "github.com/duckdb/duckdb-go/v2"
 	"github.com/mohamedelhefni/siraaj/geolocation"
+	"github.com/mohamedelhefni/siraaj/internal/dbsettings"
 	"github.com/mohamedelhefni/siraaj/internal/handler"
+	"github.com/mohamedelhefni/siraaj/internal/idgen"
 	"github.com/mohamedelhefni/siraaj/internal/middleware"
 	"github.com/mohamedelhefni/siraaj/internal/migrations"
+	"github.com/mohamedelhefni/siraaj/internal/referrerspam"
+	"github.com/mohamedelhefni/siraaj/internal/report"
 	"github.com/mohamedelhefni/siraaj/internal/repository"
 	"github.com/mohamedelhefni/siraaj/internal/service"
+	"github.com/mohamedelhefni/siraaj/internal/storage"
+	"github.com/mohamedelhefni/siraaj/internal/urlpattern"
 )
 
 //go:embed all:ui/dashboard
@@ -28,71 +38,149 @@ var dashboardFiles embed.FS
 //go:embed ui/landing/index.html
 var landingPage string
 
-// initDatabase initializes the database connection and runs migrations
-func initDatabase(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("duckdb", dbPath)
+// DefaultShutdownTimeout is how long in-flight requests may take to finish on
+// shutdown, unless SHUTDOWN_TIMEOUT says otherwise
+const DefaultShutdownTimeout = 15 * time.Second
+
+// Defaults of the database connection pool, see poolOptionsFromEnv
+const (
+	DefaultDBMaxOpenConns    = 5
+	DefaultDBMaxIdleConns    = 2
+	DefaultDBConnMaxLifetime = time.Hour
+)
+
+// initDatabase initializes the database connection, applies the DuckDB settings and
+// runs migrations. It returns how each setting was applied.
+func initDatabase(dbPath string) (*sql.DB, dbsettings.Report, error) {
+	// DuckDB is the only supported engine; fail loudly instead of running its DDL elsewhere
+	driver := os.Getenv("DB_DRIVER")
+	if driver == "" {
+		driver = "duckdb"
+	}
+	if driver != "duckdb" {
+		return nil, dbsettings.Report{}, fmt.Errorf("unsupported DB_DRIVER %q: only duckdb is supported", driver)
+	}
+
+	db, err := sql.Open(driver, dbPath)
 	if err != nil {
-		return nil, err
+		return nil, dbsettings.Report{}, err
 	}
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %v", err)
+		return nil, dbsettings.Report{}, fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(5)
-	db.SetMaxIdleConns(2)
-	db.SetConnMaxLifetime(time.Hour)
-
-	// Enable DuckDB optimizations
-	// Increase memory limit to handle larger datasets (default is ~488MB)
-	memoryLimit := os.Getenv("DUCKDB_MEMORY_LIMIT")
-	if memoryLimit == "" {
-		memoryLimit = "4GB" // Default to 4GB for better performance with large datasets
+	// Each open connection runs one query at a time, sharing the DuckDB threads
+	pool, err := poolOptionsFromEnv()
+	if err != nil {
+		return nil, dbsettings.Report{}, err
 	}
-	if _, err = db.Exec(fmt.Sprintf("PRAGMA memory_limit='%s'", memoryLimit)); err != nil {
-		log.Printf("Warning: Could not set memory limit: %v", err)
-	} else {
-		log.Printf("✓ DuckDB memory limit set to: %s", memoryLimit)
+	db.SetMaxOpenConns(pool.maxOpen)
+	db.SetMaxIdleConns(pool.maxIdle)
+	db.SetConnMaxLifetime(pool.maxLifetime)
+	log.Printf("✓ Connection pool: %d open, %d idle", pool.maxOpen, pool.maxIdle)
+
+	// Memory, threads and query tuning, see internal/dbsettings. Settings the
+	// DuckDB version does not know are skipped.
+	settings, err := dbsettings.FromEnv()
+	if err != nil {
+		return nil, dbsettings.Report{}, err
+	}
+	report, err := dbsettings.Apply(db, settings)
+	if err != nil {
+		log.Printf("Warning: Could not apply DuckDB settings: %v", err)
+	}
+
+	// Run migrations
+	if err := migrations.Migrate(db); err != nil {
+		return nil, report, fmt.Errorf("failed to run migrations: %v", err)
 	}
 
-	threads := os.Getenv("DUCKDB_THREADS")
-	if threads == "" {
-		threads = "4" // Use 4 threads for M3 chip (better utilization)
+	return db, report, nil
+}
+
+// poolOptions sizes the database connection pool
+type poolOptions struct {
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+}
+
+// poolOptionsFromEnv reads DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and
+// DB_CONN_MAX_LIFETIME, falling back to the DefaultDB* values. Idle connections
+// are capped at the open ones.
+func poolOptionsFromEnv() (poolOptions, error) {
+	pool := poolOptions{maxOpen: DefaultDBMaxOpenConns, maxIdle: DefaultDBMaxIdleConns, maxLifetime: DefaultDBConnMaxLifetime}
+	if raw := os.Getenv("DB_MAX_OPEN_CONNS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return pool, fmt.Errorf("invalid DB_MAX_OPEN_CONNS %q: must be a positive integer", raw)
+		}
+		pool.maxOpen = n
 	}
-	if _, err = db.Exec(fmt.Sprintf("PRAGMA threads=%s", threads)); err != nil {
-		log.Printf("Warning: Could not set threads: %v", err)
-	} else {
-		log.Printf("✓ DuckDB threads set to: %s", threads)
+	if raw := os.Getenv("DB_MAX_IDLE_CONNS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return pool, fmt.Errorf("invalid DB_MAX_IDLE_CONNS %q: must be zero or a positive integer", raw)
+		}
+		pool.maxIdle = n
+	}
+	if raw := os.Getenv("DB_CONN_MAX_LIFETIME"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return pool, fmt.Errorf("invalid DB_CONN_MAX_LIFETIME %q: must be a positive duration such as 1h", raw)
+		}
+		pool.maxLifetime = d
 	}
+	pool.maxIdle = min(pool.maxIdle, pool.maxOpen)
+	return pool, nil
+}
 
-	// Enable aggressive query optimizations for OLAP workloads
-	optimizations := []struct {
+// parquetOptionsFromEnv reads the Parquet buffering, flush, compaction and file
+// format tuning.
+// Unset variables keep the storage defaults.
+func parquetOptionsFromEnv() (storage.ParquetOptions, error) {
+	var opts storage.ParquetOptions
+	ints := []struct {
 		name  string
-		query string
+		value *int
 	}{
-		{"Enable parallel execution", "SET enable_object_cache=true"},
-		{"Disable preserve insertion order", "SET preserve_insertion_order=false"},
-		{"Enable query profiling", "SET enable_profiling=false"}, // Disable profiling in production
-		{"Set temp directory", "SET temp_directory='/tmp/duckdb_temp'"},
-		{"Enable parallel Parquet scan", "SET enable_http_metadata_cache=true"},
-		{"Force parallel execution", "SET force_parallelism=true"},
-		{"Optimize for throughput", "SET experimental_parallel_csv=true"},
-	}
-
-	for _, opt := range optimizations {
-		if _, err := db.Exec(opt.query); err != nil {
-			log.Printf("Warning: Could not apply %s: %v", opt.name, err)
+		{"PARQUET_BUFFER_SIZE", &opts.BufferSize},
+		{"PARQUET_FLUSH_WORKERS", &opts.FlushWorkers},
+		{"PARQUET_MERGE_FANOUT", &opts.MergeFanout},
+		{"PARQUET_ROW_GROUP_SIZE", &opts.RowGroupSize},
+	}
+	for _, setting := range ints {
+		if raw := os.Getenv(setting.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("invalid %s %q: must be a positive integer", setting.name, raw)
+			}
+			*setting.value = n
 		}
 	}
 
-	// Run migrations
-	if err := migrations.Migrate(db); err != nil {
-		return nil, fmt.Errorf("failed to run migrations: %v", err)
+	durations := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"PARQUET_FLUSH_INTERVAL", &opts.FlushInterval},
+		{"PARQUET_MERGE_INTERVAL", &opts.MergeInterval},
+	}
+	for _, setting := range durations {
+		if raw := os.Getenv(setting.name); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				return opts, fmt.Errorf("invalid %s %q: must be a positive duration such as 30s", setting.name, raw)
+			}
+			*setting.value = d
+		}
 	}
 
-	return db, nil
+	// Checked against storage.ParquetCodecs when the storage is created
+	opts.Codec = os.Getenv("PARQUET_CODEC")
+	return opts, nil
 }
 
 func main() {
@@ -117,7 +205,7 @@ func main() {
 		dbPath = "data/analytics.db"
 	}
 
-	db, err := initDatabase(dbPath)
+	db, dbSettings, err := initDatabase(dbPath)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -129,43 +217,92 @@ func main() {
 
 	log.Println("✓ DuckDB initialized successfully")
 
-	// Initialize repository directly with DuckDB
-	baseRepo := repository.NewEventRepository(db)
-	defer func() {
-		if err := baseRepo.Close(); err != nil {
-			log.Printf("Warning: failed to close repository: %v", err)
+	// Instances sharing storage, or whose data is merged later, need distinct ids
+	if instance := os.Getenv("INSTANCE_ID"); instance != "" {
+		id, err := strconv.Atoi(instance)
+		if err != nil {
+			log.Fatalf("invalid INSTANCE_ID %q: must be an integer", instance)
 		}
-	}()
+		if err := idgen.SetInstance(id); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	eventService := service.NewEventService(baseRepo)
-	eventHandler := handler.NewEventHandler(eventService, geoService)
+	// STORAGE_BACKEND=table inserts events straight into the DuckDB events table;
+	// the default buffers them and flushes them to Parquet files, the events table
+	// only serving reads until the first file is written
+	backend, err := storage.ParseBackend(os.Getenv("STORAGE_BACKEND"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Setup graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	var parquetStorage *storage.ParquetStorage
+	if backend == storage.BackendParquet {
+		dataDir := os.Getenv("PARQUET_FILE")
+		if dataDir == "" {
+			dataDir = storage.DefaultParquetDir
+		}
 
-	go func() {
-		<-sigChan
-		log.Println("\n🛑 Shutting down gracefully...")
+		opts, err := parquetOptionsFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		parquetStorage, err = storage.NewParquetStorageWithOptions(db, dataDir, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		// Close repository first to flush any pending data
+		// What writes do when flushes fall behind: "block" until drained or "reject" with 503
+		backpressure := os.Getenv("BUFFER_FULL_POLICY")
+		if backpressure == "" {
+			backpressure = string(storage.BackpressureBlock)
+		}
+		if err := parquetStorage.SetBackpressurePolicy(storage.BackpressurePolicy(backpressure)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("✓ Storage backend: %s", backend)
+
+	// A nil parquetStorage makes the repository use the events table
+	baseRepo := repository.NewEventRepository(db, parquetStorage)
+	defer func() {
 		if err := baseRepo.Close(); err != nil {
-			log.Printf("Error closing repository: %v", err)
+			log.Printf("Warning: failed to close repository: %v", err)
 		}
+	}()
 
-		// Close other resources
-		if geoService != nil {
-			if err := geoService.Close(); err != nil {
-				log.Printf("Error closing geolocation service: %v", err)
-			}
+	// Daily aggregates for the top lists, stopped before the repository closes
+	rollupCtx, stopRollup := context.WithCancel(context.Background())
+	defer stopRollup()
+	baseRepo.StartDailyStats(rollupCtx)
+
+	// Extra referrer spam domains on top of the built-in blocklist
+	if spamList := os.Getenv("REFERRER_SPAM_FILE"); spamList != "" {
+		if err := referrerspam.LoadFile(spamList); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		if err := db.Close(); err != nil {
-			log.Printf("Error closing database: %v", err)
+	// Rules grouping page URLs under patterns in the top, entry and exit pages
+	if patterns := os.Getenv("URL_PATTERNS_FILE"); patterns != "" {
+		if err := urlpattern.LoadFile(patterns); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		os.Exit(0)
-	}()
+	eventService := service.NewEventService(baseRepo)
+	eventHandler := handler.NewEventHandler(eventService, geoService)
+
+	// Scheduled digest, enabled by REPORT_DIR or REPORT_RECIPIENTS
+	reportConfig, err := report.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if reportConfig != nil {
+		reportCtx, stopReports := context.WithCancel(context.Background())
+		defer stopReports()
+		go report.New(eventService, *reportConfig).Run(reportCtx)
+	}
 
 	// Setup HTTP routes
 	mux := http.NewServeMux()
@@ -176,30 +313,64 @@ func main() {
 	mux.HandleFunc("/api/stats", eventHandler.GetStats)
 	mux.HandleFunc("/api/events", eventHandler.GetEvents)
 	mux.HandleFunc("/api/online", eventHandler.GetOnlineUsers)
+	mux.HandleFunc("/api/stream/live", eventHandler.LiveStream)
 	mux.HandleFunc("/api/projects", eventHandler.GetProjects)
 	mux.HandleFunc("/api/funnel", eventHandler.GetFunnelAnalysis)
+	mux.HandleFunc("/api/sessions", eventHandler.GetUserSessions)
+	mux.HandleFunc("/api/filters", eventHandler.GetFilterValuesHandler)
+	mux.HandleFunc("/api/goals", eventHandler.Goals)
+	mux.HandleFunc("/api/goals/", eventHandler.Goal)
+	mux.HandleFunc("/api/goals/conversions", eventHandler.GetGoalConversions)
 	mux.HandleFunc("/api/health", eventHandler.Health)
+	mux.HandleFunc("/api/health/ready", eventHandler.Ready)
 	mux.HandleFunc("/api/geo", eventHandler.GeoTest)
+	mux.HandleFunc("/api/openapi.json", handler.OpenAPISpec(apiSpec()))
 
 	// New focused stats endpoints
 	mux.HandleFunc("/api/stats/overview", eventHandler.GetTopStats)
+	mux.HandleFunc("/api/stats/compare", eventHandler.CompareSegments)
 	mux.HandleFunc("/api/stats/timeline", eventHandler.GetTimeline)
+	mux.HandleFunc("/api/stats/anomalies", eventHandler.GetAnomaliesHandler)
 	mux.HandleFunc("/api/stats/pages", eventHandler.GetTopPagesHandler)
 	mux.HandleFunc("/api/stats/pages/entry-exit", eventHandler.GetEntryExitPagesHandler)
 	mux.HandleFunc("/api/stats/countries", eventHandler.GetTopCountriesHandler)
+	mux.HandleFunc("/api/stats/regions", eventHandler.GetTopRegionsHandler)
+	mux.HandleFunc("/api/stats/languages", eventHandler.GetTopLanguagesHandler)
+	mux.HandleFunc("/api/stats/screens", eventHandler.GetScreenSizesHandler)
 	mux.HandleFunc("/api/stats/sources", eventHandler.GetTopSourcesHandler)
 	mux.HandleFunc("/api/stats/events", eventHandler.GetTopEventsHandler)
 	mux.HandleFunc("/api/stats/devices", eventHandler.GetBrowsersDevicesOSHandler)
+	mux.HandleFunc("/api/stats/stickiness", eventHandler.GetStickinessHandler)
+	mux.HandleFunc("/api/stats/visitors", eventHandler.GetNewVsReturningHandler)
+	mux.HandleFunc("/api/stats/lifetime", eventHandler.GetLifetimeUsersHandler)
+	mux.HandleFunc("/api/stats/channel-landings", eventHandler.GetChannelLandingPagesHandler)
 
 	// Channel analytics
 	mux.HandleFunc("/api/channels", eventHandler.GetChannelsHandler)
 
+	// Reports as a SQLite file
+	mux.HandleFunc("/api/export/sqlite", eventHandler.ExportSQLiteHandler)
+
+	// Raw events as a Parquet file; they hold IPs and user IDs, so admins only
+	mux.Handle("/api/export/parquet", middleware.AdminAuth(http.HandlerFunc(eventHandler.ExportParquetHandler)))
+
+	// Admin endpoints (require ADMIN_API_KEY)
+	mux.Handle("/api/admin/reset", middleware.AdminAuth(http.HandlerFunc(eventHandler.AdminReset)))
+	mux.Handle("/api/admin/flush", middleware.AdminAuth(http.HandlerFunc(eventHandler.AdminFlush)))
+	mux.Handle("/api/admin/compact", middleware.AdminAuth(http.HandlerFunc(eventHandler.AdminCompact)))
+	mux.Handle("/api/admin/storage", middleware.AdminAuth(http.HandlerFunc(eventHandler.AdminStorage)))
+	mux.Handle("/api/admin/import", middleware.AdminAuth(http.HandlerFunc(eventHandler.AdminImport)))
+	mux.Handle("/api/admin/lifetime/rebuild", middleware.AdminAuth(http.HandlerFunc(eventHandler.AdminRebuildUserSketch)))
+	mux.Handle("/api/debug/sample", middleware.AdminAuth(http.HandlerFunc(eventHandler.DebugSample)))
+	mux.Handle("/api/debug/recent", middleware.AdminAuth(http.HandlerFunc(eventHandler.DebugRecent)))
+	mux.Handle("/api/stream/events", middleware.AdminAuth(http.HandlerFunc(eventHandler.EventStream)))
+
 	// Debug endpoint to show all events
 	mux.HandleFunc("/api/debug/events", func(w http.ResponseWriter, r *http.Request) {
 		rows, err := db.Query("SELECT id, timestamp, event_name, user_id FROM events ORDER BY timestamp DESC LIMIT 50")
 		if err != nil {
 			log.Printf("Error querying events: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			middleware.WriteError(w, http.StatusInternalServerError, middleware.ErrCodeInternal, "Internal server error")
 			return
 		}
 		defer func() {
@@ -233,26 +404,47 @@ func main() {
 		}
 	})
 
-	// Database stats endpoint
+	// Storage summary, see /api/admin/storage for the files
 	mux.HandleFunc("/api/debug/storage", func(w http.ResponseWriter, r *http.Request) {
-		var tableSize int64
-		err := db.QueryRow("SELECT COUNT(*) FROM events").Scan(&tableSize)
+		stats, err := eventService.GetStorageStats(r.Context())
 		if err != nil {
-			log.Printf("Error getting table size: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("Error getting storage stats: %v", err)
+			middleware.WriteError(w, http.StatusInternalServerError, middleware.ErrCodeInternal, "Internal server error")
 			return
 		}
 
+		storageType := "Parquet files"
+		if backend == storage.BackendTable {
+			storageType = "DuckDB table"
+		}
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"total_events":  tableSize,
-			"storage_type":  "DuckDB Native",
+			"total_events":  stats.TotalEvents,
+			"storage_type":  storageType,
+			"backend":       backend,
 			"database_path": dbPath,
+			"file_count":    stats.FileCount,
+			"total_bytes":   stats.TotalBytes,
 		}); err != nil {
 			log.Printf("Error encoding storage stats: %v", err)
 		}
 	})
 
+	// Effective DuckDB settings, and which configured ones were skipped or rejected
+	mux.Handle("/api/debug/duckdb", middleware.AdminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, err := dbSettings.WithValues(db)
+		if err != nil {
+			log.Printf("Error reading DuckDB settings: %v", err)
+			middleware.WriteError(w, http.StatusInternalServerError, middleware.ErrCodeInternal, "Internal server error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Printf("Error encoding DuckDB settings: %v", err)
+		}
+	})))
+
 	// Serve dashboard (SvelteKit app) with optional BasicAuth
 	dashboardFS, err := fs.Sub(dashboardFiles, "ui/dashboard")
 	if err != nil {
@@ -263,6 +455,9 @@ func main() {
 		mux.Handle("/dashboard/", middleware.BasicAuth(dashboardHandler))
 	}
 
+	// Tracking snippet for websites, see internal/handler/tracker.js
+	mux.HandleFunc("/siraaj.js", handler.TrackerScript)
+
 	// Serve landing page at root
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
@@ -285,9 +480,11 @@ func main() {
 	fmt.Printf("🎨 Dashboard:  http://localhost:%s/dashboard/\n", port)
 	fmt.Printf("📡 API Track:  http://localhost:%s/api/track\n", port)
 	fmt.Printf("📦 API Batch:  http://localhost:%s/api/track/batch\n", port)
+	fmt.Printf("🧩 Tracker:    http://localhost:%s/siraaj.js\n", port)
 	fmt.Printf("📈 API Stats:  http://localhost:%s/api/stats\n", port)
 	fmt.Printf("🌍 Geo Test:   http://localhost:%s/api/geo\n", port)
 	fmt.Printf("❤️  Health:    http://localhost:%s/api/health\n", port)
+	fmt.Printf("✅ Ready:      http://localhost:%s/api/health/ready\n", port)
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	fmt.Println("✓ Server ready - Using official DuckDB Go driver")
 	fmt.Println("✓ Svelte Dashboard embedded and ready")
@@ -296,6 +493,9 @@ func main() {
 	} else {
 		fmt.Println("⚠️  Dashboard is publicly accessible (set DASHBOARD_USERNAME and DASHBOARD_PASSWORD to enable auth)")
 	}
+	if reportConfig != nil {
+		fmt.Printf("✓ Reports scheduled: %s\n", reportConfig.Schedule)
+	}
 	if geoService != nil {
 		fmt.Println("✓ Geolocation service enabled")
 	} else {
@@ -305,7 +505,63 @@ func main() {
 	fmt.Printf("✓ DuckDB native storage: %s\n", dbPath)
 	fmt.Println()
 
-	// Apply middleware: CORS and Logging
-	httpHandler := middleware.CORS(middleware.Logging(mux))
-	log.Fatal(http.ListenAndServe(":"+port, httpHandler))
+	// Apply middleware: request ids, CORS and Logging. Request ids come first so
+	// every response, rejected preflights included, carries one.
+	httpHandler := middleware.RequestID(middleware.CORS(middleware.Logging(mux)))
+	server := &http.Server{Addr: ":" + port, Handler: httpHandler}
+	// Shutdown waits for open connections, so end live streams as soon as it starts
+	server.RegisterOnShutdown(eventHandler.CloseStreams)
+
+	// Setup graceful shutdown: stop accepting requests and let in-flight ones finish.
+	// The deferred closes then run in order: the repository stops background work and
+	// flushes every tracked event, then the database and geolocation are released.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := serve(server, listener, sigChan, shutdownTimeout(), eventService.Close); err != nil {
+		log.Printf("Error serving HTTP: %v", err)
+	}
+}
+
+// shutdownTimeout reads SHUTDOWN_TIMEOUT, how long in-flight requests may take to
+// finish on shutdown, falling back to DefaultShutdownTimeout
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultShutdownTimeout
+}
+
+// serve runs server on listener until a signal arrives on stop, then shuts it down:
+// new connections are refused and in-flight requests get up to timeout to finish,
+// then drain gets what is left of it to finish the work they started, such as
+// webhook deliveries. It returns once the last request is done or abandoned, so
+// events they tracked are buffered before the caller flushes storage.
+func serve(server *http.Server, listener net.Listener, stop <-chan os.Signal, timeout time.Duration, drain func(context.Context) error) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-stop:
+	}
+	log.Println("\n🛑 Shutting down gracefully...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if serveErr := <-served; !errors.Is(serveErr, http.ErrServerClosed) {
+		return serveErr
+	}
+	if drainErr := drain(ctx); drainErr != nil {
+		log.Printf("Warning: %v", drainErr)
+	}
+	return err
 }
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// registeredAPIRoutes returns the /api patterns main.go registers on the mux
+func registeredAPIRoutes(t *testing.T) []string {
+	t.Helper()
+
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse main.go: %v", err)
+	}
+	var routes []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			if route, err := strconv.Unquote(lit.Value); err == nil && strings.HasPrefix(route, "/api/") {
+				routes = append(routes, route)
+			}
+		}
+		return true
+	})
+	return routes
+}
+
+func TestAPISpecCoversRoutes(t *testing.T) {
+	spec := apiSpec()
+
+	registered := map[string]bool{}
+	for _, route := range registeredAPIRoutes(t) {
+		// A trailing slash pattern serves the paths below it, such as /api/goals/{id}
+		if strings.HasSuffix(route, "/") {
+			found := false
+			for path := range spec.Paths {
+				if strings.HasPrefix(path, route+"{") {
+					registered[path], found = true, true
+				}
+			}
+			if !found {
+				t.Errorf("Route %s has no path below it in the OpenAPI spec", route)
+			}
+			continue
+		}
+		registered[route] = true
+		if _, ok := spec.Paths[route]; !ok {
+			t.Errorf("Route %s is missing from the OpenAPI spec", route)
+		}
+	}
+
+	var extra []string
+	for path := range spec.Paths {
+		if !registered[path] {
+			extra = append(extra, path)
+		}
+	}
+	sort.Strings(extra)
+	if len(extra) > 0 {
+		t.Errorf("OpenAPI spec documents unregistered paths %v", extra)
+	}
+}
+
+func TestAPISpecIsValid(t *testing.T) {
+	spec := apiSpec()
+
+	ids := map[string]string{}
+	for path, item := range spec.Paths {
+		operations := item.Operations()
+		if len(operations) == 0 {
+			t.Errorf("%s has no operations", path)
+		}
+		for method, op := range operations {
+			if op.OperationID == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+			} else if other, ok := ids[op.OperationID]; ok {
+				t.Errorf("operationId %s is used by both %s and %s %s", op.OperationID, other, method, path)
+			}
+			ids[op.OperationID] = method + " " + path
+			if len(op.Responses) == 0 {
+				t.Errorf("%s %s has no responses", method, path)
+			}
+		}
+	}
+
+	// Every $ref must resolve to a component schema
+	body, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("Failed to encode spec: %v", err)
+	}
+	const prefix = `"$ref":"#/components/schemas/`
+	for rest := string(body); strings.Contains(rest, prefix); {
+		rest = rest[strings.Index(rest, prefix)+len(prefix):]
+		name := rest[:strings.IndexByte(rest, '"')]
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("$ref to unknown schema %s", name)
+		}
+	}
+}
+
+// slowServer is a server run by serve whose handler blocks until release is closed
+type slowServer struct {
+	addr     string
+	started  chan struct{} // Closed when the handler is called
+	release  chan struct{}
+	finished atomic.Bool // Set when the handler returns
+	drained  atomic.Bool // Set when drain is called after the handler returned
+	stop     chan os.Signal
+	done     chan error // serve's result
+}
+
+func startSlowServer(t *testing.T, timeout time.Duration) *slowServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &slowServer{
+		addr:    listener.Addr().String(),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		stop:    make(chan os.Signal, 1),
+		done:    make(chan error, 1),
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(s.started)
+		<-s.release
+		w.Write([]byte(`{"status":"ok"}`))
+		s.finished.Store(true)
+	})}
+	go func() {
+		s.done <- serve(server, listener, s.stop, timeout, func(context.Context) error {
+			s.drained.Store(s.finished.Load())
+			return nil
+		})
+	}()
+	return s
+}
+
+func TestServeDrainsRequestsOnShutdown(t *testing.T) {
+	s := startSlowServer(t, 5*time.Second)
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Post("http://"+s.addr+"/api/track", "application/json", strings.NewReader(`{"event_name":"page_view"}`))
+		if err != nil {
+			responses <- "error: " + err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		responses <- resp.Status + " " + string(body)
+	}()
+	<-s.started
+	s.stop <- syscall.SIGTERM
+
+	// New connections are refused while the request is in flight
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", s.addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("Expected new connections to be refused after the signal")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case err := <-s.done:
+		t.Fatalf("Expected serve to wait for the in-flight request, returned %v", err)
+	default:
+	}
+
+	close(s.release)
+	if response := <-responses; response != `200 OK {"status":"ok"}` {
+		t.Errorf("Expected the in-flight request to complete, got %s", response)
+	}
+	if err := <-s.done; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+	if !s.finished.Load() {
+		t.Error("Expected serve to return after the handler finished")
+	}
+	if !s.drained.Load() {
+		t.Error("Expected serve to drain after the handler finished")
+	}
+}
+
+func TestServeGivesUpAfterTimeout(t *testing.T) {
+	s := startSlowServer(t, 20*time.Millisecond)
+	defer close(s.release)
+
+	go func() {
+		if resp, err := http.Get("http://" + s.addr + "/"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-s.started
+	s.stop <- syscall.SIGTERM
+
+	if err := <-s.done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected serve to give up with the timeout, got %v", err)
+	}
+}
+
+func TestPoolOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected poolOptions
+		wantErr  bool
+	}{
+		{"Defaults", nil, poolOptions{DefaultDBMaxOpenConns, DefaultDBMaxIdleConns, DefaultDBConnMaxLifetime}, false},
+		{"Configured", map[string]string{"DB_MAX_OPEN_CONNS": "16", "DB_MAX_IDLE_CONNS": "4", "DB_CONN_MAX_LIFETIME": "10m"}, poolOptions{16, 4, 10 * time.Minute}, false},
+		{"Idle capped at open", map[string]string{"DB_MAX_OPEN_CONNS": "3", "DB_MAX_IDLE_CONNS": "8"}, poolOptions{3, 3, DefaultDBConnMaxLifetime}, false},
+		{"No idle connections", map[string]string{"DB_MAX_IDLE_CONNS": "0"}, poolOptions{DefaultDBMaxOpenConns, 0, DefaultDBConnMaxLifetime}, false},
+		{"Zero open connections", map[string]string{"DB_MAX_OPEN_CONNS": "0"}, poolOptions{}, true},
+		{"Invalid lifetime", map[string]string{"DB_CONN_MAX_LIFETIME": "forever"}, poolOptions{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME"} {
+				t.Setenv(name, tt.env[name])
+			}
+			pool, err := poolOptionsFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", pool)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if pool != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, pool)
+			}
+		})
+	}
+}
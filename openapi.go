@@ -0,0 +1,637 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mohamedelhefni/siraaj/internal/dbsettings"
+	"github.com/mohamedelhefni/siraaj/internal/domain"
+	"github.com/mohamedelhefni/siraaj/internal/openapi"
+)
+
+// apiSpec describes the /api routes registered in main as an OpenAPI document,
+// served at /api/openapi.json. A new route needs its operation here as well;
+// TestAPISpecCoversRoutes fails until both lists match.
+func apiSpec() *openapi.Document {
+	return &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Siraaj Analytics API",
+			Description: "Event tracking and analytics. Dates are YYYY-MM-DD days, inclusive, in the tz zone.",
+			Version:     "1.0.0",
+		},
+		Servers: []openapi.Server{{URL: "/"}},
+		Tags: []openapi.Tag{
+			{Name: "tracking", Description: "Sending events"},
+			{Name: "stats", Description: "Aggregated analytics"},
+			{Name: "events", Description: "Raw events, sessions and live streams"},
+			{Name: "goals", Description: "Named conversions"},
+			{Name: "export", Description: "Downloads of reports and events"},
+			{Name: "admin", Description: "Operations requiring ADMIN_API_KEY"},
+			{Name: "system", Description: "Health and diagnostics"},
+		},
+		Paths: map[string]*openapi.PathItem{
+			// Core
+			"/api/health": {Get: &openapi.Operation{
+				OperationID: "getHealth",
+				Summary:     "Server status",
+				Tags:        []string{"system"},
+				Responses:   responses(ok("Server status", openapi.Ref("Health"))),
+			}},
+			"/api/health/ready": {Get: &openapi.Operation{
+				OperationID: "getReadiness",
+				Summary:     "Whether events can be stored and queried",
+				Description: "Runs SELECT 1 on DuckDB, writes a probe file to the data directory and counts recent events. Meant for readiness probes; /api/health is the cheap liveness probe.",
+				Tags:        []string{"system"},
+				Responses: withResponse(responses(ok("Every check passed", openapi.Ref("Readiness"))),
+					"503", &openapi.Response{Description: "A check failed", Content: openapi.JSON(openapi.Ref("Readiness"))}),
+			}},
+			"/api/geo": {Get: &openapi.Operation{
+				OperationID: "getGeo",
+				Summary:     "Geolocation of an IP address",
+				Tags:        []string{"system"},
+				Parameters:  []*openapi.Parameter{queryParam("ip", "string", "Address to look up, the caller's by default")},
+				Responses:   responses(ok("Location of the address", openapi.Ref("GeoLocation"))),
+			}},
+			"/api/openapi.json": {Get: &openapi.Operation{
+				OperationID: "getOpenAPI",
+				Summary:     "This OpenAPI document",
+				Tags:        []string{"system"},
+				Responses:   responses(ok("The OpenAPI document", &openapi.Schema{Type: "object"})),
+			}},
+			"/api/track": {Post: &openapi.Operation{
+				OperationID: "trackEvent",
+				Summary:     "Track a single event",
+				Description: "Events with DNT: 1, from bots with DROP_BOTS=1, with spam referrers or repeating a recent event_id are acknowledged without being stored.",
+				Tags:        []string{"tracking"},
+				Parameters:  []*openapi.Parameter{headerParam("Idempotency-Key", "string", "The event_id when the body has none")},
+				RequestBody: jsonBody(openapi.Ref("Event")),
+				Responses:   responses(ok("Event accepted", openapi.Ref("TrackResponse"))),
+			}},
+			"/api/track/batch": {Post: &openapi.Operation{
+				OperationID: "trackBatch",
+				Summary:     "Track a batch of events",
+				Description: "Valid events are stored even when others are rejected; the response is 207 then. Events repeating a recent event_id are counted as deduplicated and not stored again.",
+				Tags:        []string{"tracking"},
+				RequestBody: jsonBody(&openapi.Schema{
+					Type:       "object",
+					Properties: map[string]*openapi.Schema{"events": openapi.ArrayOf(openapi.Ref("Event"))},
+					Required:   []string{"events"},
+				}),
+				Responses: withResponse(responses(ok("All events accepted", openapi.Ref("BatchResponse"))),
+					"207", &openapi.Response{Description: "Some events rejected", Content: openapi.JSON(openapi.Ref("BatchResponse"))}),
+			}},
+
+			// Stats
+			"/api/stats": {Get: &openapi.Operation{
+				OperationID: "getStats",
+				Summary:     "All dashboard stats in one response",
+				Tags:        []string{"stats"},
+				Parameters: append(statsParams(),
+					queryParam("include", "string", "Comma-separated sections to compute, all by default: top_events, timeline, top_pages, entry_pages, exit_pages, browsers, devices, os, top_countries, top_sources, trends")),
+				Responses: responses(ok("Stats with a _meta object", &openapi.Schema{
+					Type:       "object",
+					Properties: map[string]*openapi.Schema{"_meta": openapi.Ref("StatsMeta")},
+				})),
+			}},
+			"/api/stats/overview": {Get: statsOperation("getOverview", "Totals and changes from the previous period", append(statsParams(), explainParam()), openapi.Ref("Overview"))},
+			"/api/stats/compare": {Post: &openapi.Operation{
+				OperationID: "compareSegments",
+				Summary:     "Compare the overview of two filter sets",
+				Tags:        []string{"stats"},
+				RequestBody: jsonBody(openapi.Ref("CompareRequest")),
+				Responses: responses(ok("Both overviews and their differences", &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"a":      openapi.Ref("Overview"),
+						"b":      openapi.Ref("Overview"),
+						"deltas": openapi.MapOf(openapi.Ref("MetricDelta")),
+					},
+				})),
+			}},
+			"/api/stats/timeline": {Get: statsOperation("getTimeline", "Metric over time, hourly, daily or monthly", append(statsParams(), metricParam(), explainParam()), openapi.Ref("Timeline"))},
+			"/api/stats/anomalies": {Get: statsOperation("getAnomalies", "Timeline buckets far from their rolling mean",
+				append(statsParams(), metricParam(),
+					queryParam("sigma", "number", "Standard deviations from the rolling mean before a bucket is flagged (default: 3)"),
+					queryParam("window", "integer", "Preceding buckets in the rolling mean, 3 to 90 (default: 7)")),
+				openapi.SchemaOf(domain.AnomalyResult{}))},
+			"/api/stats/pages": {Get: statsOperation("getTopPages", "Most visited pages", append(topListParams(), explainParam()), &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"top_pages": openapi.ArrayOf(openapi.Ref("PageCount")),
+					"total":     {Type: "integer"},
+				},
+			})},
+			"/api/stats/pages/entry-exit": {Get: statsOperation("getEntryExitPages", "Pages sessions start and end on", statsParams(), &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"entry_pages": openapi.ArrayOf(openapi.Ref("PageCount")),
+					"exit_pages":  openapi.ArrayOf(openapi.Ref("PageCount")),
+				},
+			})},
+			"/api/stats/countries": {Get: topListOperation("getTopCountries", "Events by country", append(topListParams(), explainParam()))},
+			"/api/stats/regions": {Get: topListOperation("getTopRegions", "Events by continent, country or region",
+				append(topListParams(), enumParam("level", "Grouping, country by default", domain.RegionLevelContinent, domain.RegionLevelCountry, domain.RegionLevelRegion)))},
+			"/api/stats/languages": {Get: topListOperation("getTopLanguages", "Events by primary language subtag", append(topListParams(), explainParam()))},
+			"/api/stats/screens":   {Get: statsOperation("getScreenSizes", "Events and visitors by screen width bucket", statsParams(), openapi.ArrayOf(openapi.Ref("ScreenSize")))},
+			"/api/stats/sources":   {Get: topListOperation("getTopSources", "Events by referrer domain, or by referrer URL when filtered by source", append(topListParams(), explainParam()))},
+			"/api/stats/events":    {Get: topListOperation("getTopEvents", "Events by name", append(topListParams(), explainParam()))},
+			"/api/stats/devices": {Get: statsOperation("getDevices", "Events by browser, device type and operating system", topListParams(), &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"browsers": openapi.ArrayOf(openapi.Ref("NamedCount")),
+					"devices":  openapi.ArrayOf(openapi.Ref("NamedCount")),
+					"os":       openapi.ArrayOf(openapi.Ref("NamedCount")),
+					"totals":   openapi.MapOf(&openapi.Schema{Type: "integer"}),
+				},
+			})},
+			"/api/stats/stickiness": {Get: statsOperation("getStickiness", "Daily, weekly and monthly active users up to end", statsParams(), objectOf(map[string]string{
+				"date": "string", "dau": "integer", "wau": "integer", "mau": "integer", "dau_mau": "number",
+			}))},
+			"/api/stats/visitors": {Get: statsOperation("getNewVsReturning", "New and returning visitors", statsParams(), &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"total_users": {Type: "integer"},
+					"new":         openapi.Ref("VisitorGroup"),
+					"returning":   openapi.Ref("VisitorGroup"),
+				},
+			})},
+			"/api/stats/lifetime": {Get: statsOperation("getLifetimeUsers", "Estimated distinct users across every stored event",
+				[]*openapi.Parameter{queryParam("meta", "string", "1 to wrap the response in {data, meta}")}, openapi.Ref("LifetimeUsers"))},
+			"/api/stats/channel-landings": {Get: &openapi.Operation{
+				OperationID: "getChannelLandingPages",
+				Summary:     "Top entry pages of each channel",
+				Description: "Streamed: a failure after the first channel ends the array with an error element marked truncated.",
+				Tags:        []string{"stats"},
+				Parameters:  statsParams(),
+				Responses: responses(ok("Channels with their landing pages", openapi.ArrayOf(&openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"channel":       {Type: "string"},
+						"sessions":      {Type: "integer"},
+						"landing_pages": openapi.ArrayOf(openapi.Ref("PageCount")),
+					},
+				}))),
+			}},
+			"/api/channels": {Get: statsOperation("getChannels", "Traffic by channel", statsParams(), openapi.ArrayOf(openapi.SchemaOf(domain.ChannelResult{})))},
+			"/api/filters": {Get: statsOperation("getFilterValues", "Values of filter fields, most frequent first",
+				append(statsParams(), queryParam("fields", "string", "Comma-separated fields, all by default: country, browser, device, os, source, event, page, project")),
+				openapi.MapOf(openapi.ArrayOf(openapi.SchemaOf(domain.FilterValue{}))))},
+			"/api/funnel": {Post: &openapi.Operation{
+				OperationID: "analyzeFunnel",
+				Summary:     "Conversion through a sequence of steps",
+				Tags:        []string{"stats"},
+				RequestBody: jsonBody(openapi.SchemaOf(domain.FunnelRequest{})),
+				Responses:   responses(ok("Users or sessions reaching each step", openapi.SchemaOf(domain.FunnelAnalysisResult{}))),
+			}},
+			"/api/projects": {Get: &openapi.Operation{
+				OperationID: "getProjects",
+				Summary:     "Projects with their event counts",
+				Tags:        []string{"stats"},
+				Responses:   responses(ok("Projects", openapi.ArrayOf(openapi.SchemaOf(domain.Project{})))),
+			}},
+			"/api/online": {Get: &openapi.Operation{
+				OperationID: "getOnlineUsers",
+				Summary:     "Users active in the last minutes",
+				Tags:        []string{"stats"},
+				Parameters:  []*openapi.Parameter{queryParam("window", "integer", "Minutes to look back, at most 60 (default: 5)")},
+				Responses:   responses(ok("Online users", openapi.Ref("OnlineUsers"))),
+			}},
+
+			// Events
+			"/api/events": {Get: &openapi.Operation{
+				OperationID: "getEvents",
+				Summary:     "Raw events, newest first",
+				Tags:        []string{"events"},
+				Parameters: append(statsParams(),
+					queryParam("offset", "integer", "Events to skip"),
+					queryParam("before", "string", "The next_cursor of the previous page, instead of offset"),
+					queryParam("user_id", "string", "Only this user's events"),
+					queryParam("session_id", "string", "Only this session's events")),
+				Responses: responses(ok("A page of events", &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"events":      openapi.ArrayOf(openapi.Ref("Event")),
+						"total":       {Type: "integer"},
+						"limit":       {Type: "integer"},
+						"offset":      {Type: "integer"},
+						"next_cursor": {Type: "string", Nullable: true},
+						"_meta":       openapi.SchemaOf(domain.EventsPageMeta{}),
+					},
+				})),
+			}},
+			"/api/sessions": {Get: &openapi.Operation{
+				OperationID: "getUserSessions",
+				Summary:     "A user's sessions, newest first",
+				Tags:        []string{"events"},
+				Parameters: append([]*openapi.Parameter{requiredQueryParam("user_id", "string", "User to reconstruct")},
+					append(statsParams(), queryParam("offset", "integer", "Sessions to skip"))...),
+				Responses: responses(ok("A page of sessions", &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"user_id":  {Type: "string"},
+						"sessions": openapi.ArrayOf(openapi.SchemaOf(domain.Session{})),
+						"limit":    {Type: "integer"},
+						"offset":   {Type: "integer"},
+						"has_more": {Type: "boolean"},
+					},
+				})),
+			}},
+			"/api/stream/live": {Get: &openapi.Operation{
+				OperationID: "streamLive",
+				Summary:     "Online users and latest events as Server-Sent Events",
+				Description: "Sends a live event with the online users and latest events on connect and every 5 seconds.",
+				Tags:        []string{"events"},
+				Responses:   responses(eventStream("live events")),
+			}},
+			"/api/stream/events": {Get: adminOperation(&openapi.Operation{
+				OperationID: "streamEvents",
+				Summary:     "Tracked events as Server-Sent Events",
+				Tags:        []string{"events"},
+				Parameters:  []*openapi.Parameter{queryParam("project", "string", "Only stream events of this project")},
+				Responses:   responses(eventStream("An event per tracked event")),
+			})},
+
+			// Goals
+			"/api/goals": {
+				Get: &openapi.Operation{
+					OperationID: "listGoals",
+					Summary:     "All goals",
+					Tags:        []string{"goals"},
+					Responses:   responses(ok("Goals", openapi.ArrayOf(openapi.Ref("Goal")))),
+				},
+				Post: &openapi.Operation{
+					OperationID: "createGoal",
+					Summary:     "Create a goal",
+					Tags:        []string{"goals"},
+					RequestBody: jsonBody(openapi.Ref("GoalInput")),
+					Responses: withResponse(responses(nil),
+						"201", &openapi.Response{Description: "The stored goal", Content: openapi.JSON(openapi.Ref("Goal"))}),
+				},
+			},
+			"/api/goals/{id}": {
+				Get: &openapi.Operation{
+					OperationID: "getGoal",
+					Summary:     "A goal",
+					Tags:        []string{"goals"},
+					Parameters:  []*openapi.Parameter{goalIDParam()},
+					Responses:   responses(ok("The goal", openapi.Ref("Goal"))),
+				},
+				Put: &openapi.Operation{
+					OperationID: "updateGoal",
+					Summary:     "Replace a goal",
+					Tags:        []string{"goals"},
+					Parameters:  []*openapi.Parameter{goalIDParam()},
+					RequestBody: jsonBody(openapi.Ref("GoalInput")),
+					Responses:   responses(ok("The stored goal", openapi.Ref("Goal"))),
+				},
+				Delete: &openapi.Operation{
+					OperationID: "deleteGoal",
+					Summary:     "Delete a goal",
+					Tags:        []string{"goals"},
+					Parameters:  []*openapi.Parameter{goalIDParam()},
+					Responses:   withResponse(responses(nil), "204", &openapi.Response{Description: "Deleted"}),
+				},
+			},
+			"/api/goals/conversions": {Get: statsOperation("getGoalConversions", "Unique visitors reaching each goal", statsParams(),
+				openapi.ArrayOf(openapi.SchemaOf(domain.GoalConversion{})))},
+
+			// Export
+			"/api/export/sqlite": {Post: &openapi.Operation{
+				OperationID: "exportSQLite",
+				Summary:     "Standard reports as a SQLite database",
+				Description: "Answers 503 when DuckDB's sqlite extension is not installed and cannot be downloaded.",
+				Tags:        []string{"export"},
+				Parameters:  statsParams(),
+				Responses:   responses(file("application/vnd.sqlite3", "SQLite database attachment")),
+			}},
+			"/api/export/parquet": {Get: adminOperation(&openapi.Operation{
+				OperationID: "exportParquet",
+				Summary:     "Raw events as a Parquet file",
+				Description: "Answers 413 when more than EXPORT_MAX_ROWS events match.",
+				Tags:        []string{"export"},
+				Parameters:  statsParams(),
+				Responses:   responses(file("application/vnd.apache.parquet", "Parquet file attachment, with the number of events in X-Total-Count")),
+			})},
+
+			// Admin and debugging
+			"/api/admin/reset": {Post: adminOperation(&openapi.Operation{
+				OperationID: "resetData",
+				Summary:     "Delete all events, only with ALLOW_RESET=1",
+				Tags:        []string{"admin"},
+				Responses: responses(ok("Data deleted", objectOf(map[string]string{
+					"status": "string", "files_removed": "integer",
+				}))),
+			})},
+			"/api/admin/flush": {Post: adminOperation(&openapi.Operation{
+				OperationID: "flushEvents",
+				Summary:     "Write buffered events to storage now",
+				Tags:        []string{"admin"},
+				Responses:   responses(ok("Events written", openapi.SchemaOf(domain.FlushResult{}))),
+			})},
+			"/api/admin/compact": {Post: adminOperation(&openapi.Operation{
+				OperationID: "compactFiles",
+				Summary:     "Merge small Parquet files now",
+				Description: "Runs a compaction pass without waiting for a tier to fill up. Fails with 409 while another pass runs, or under the table backend.",
+				Tags:        []string{"admin"},
+				Responses:   responses(ok("Files merged", openapi.SchemaOf(domain.CompactionResult{}))),
+			})},
+			"/api/admin/storage": {Get: adminOperation(&openapi.Operation{
+				OperationID: "storageStats",
+				Summary:     "Stored events, Parquet files and buffer occupancy",
+				Description: "Row counts and row groups come from the Parquet metadata. Under the table backend files is empty and buffer unset.",
+				Tags:        []string{"admin"},
+				Responses:   responses(ok("Storage statistics", openapi.SchemaOf(domain.StorageStats{}))),
+			})},
+			"/api/admin/import": {Post: adminOperation(&openapi.Operation{
+				OperationID: "importEvents",
+				Summary:     "Import historical events from a CSV or NDJSON file",
+				Description: "CSV headers and NDJSON fields name columns from: " + strings.Join(domain.ImportColumns, ", ") + ". timestamp and event_name are required. Timestamps are kept; records that fail to parse or validate are reported by line and the rest stored, with a 207 then. With strict=true any failure stores nothing.",
+				Tags:        []string{"admin"},
+				Parameters: []*openapi.Parameter{
+					queryParam("enrich", "boolean", "Run tracking enrichment on each event: geolocation, user agent, bot flag, channel and privacy settings (default: false)"),
+					queryParam("strict", "boolean", "Reject the whole file if any record fails (default: false)"),
+				},
+				RequestBody: &openapi.RequestBody{Required: true, Content: map[string]*openapi.MediaType{
+					"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+					"application/x-ndjson": {Schema: &openapi.Schema{Type: "string"}},
+				}},
+				Responses: withResponse(responses(ok("All records imported", openapi.SchemaOf(domain.ImportResult{}))),
+					"207", &openapi.Response{Description: "Some records were skipped", Content: openapi.JSON(openapi.SchemaOf(domain.ImportResult{}))}),
+			})},
+			"/api/admin/lifetime/rebuild": {Post: adminOperation(&openapi.Operation{
+				OperationID: "rebuildUserSketch",
+				Summary:     "Recompute the lifetime user sketch from the Parquet files",
+				Description: "Fails with 409 under the table backend, which keeps no sketch.",
+				Tags:        []string{"admin"},
+				Responses:   responses(ok("The rebuilt count", openapi.Ref("LifetimeUsers"))),
+			})},
+			"/api/debug/sample": {Get: adminOperation(&openapi.Operation{
+				OperationID: "sampleEvents",
+				Summary:     "Random sample of stored events",
+				Tags:        []string{"admin"},
+				Parameters:  []*openapi.Parameter{queryParam("n", "integer", "Events to sample, at most 1000 (default: 20)")},
+				Responses:   responses(ok("Sampled events", openapi.Ref("EventList"))),
+			})},
+			"/api/debug/recent": {Get: adminOperation(&openapi.Operation{
+				OperationID: "recentEvents",
+				Summary:     "Events this server accepted last, from memory",
+				Tags:        []string{"admin"},
+				Parameters:  []*openapi.Parameter{queryParam("limit", "integer", "Events to return (default: 20)")},
+				Responses:   responses(ok("Recent events", openapi.Ref("EventList"))),
+			})},
+			"/api/debug/duckdb": {Get: adminOperation(&openapi.Operation{
+				OperationID: "duckdbSettings",
+				Summary:     "DuckDB version and the effective values of the configured settings",
+				Description: "Settings the DuckDB version does not know are listed as unsupported, values it rejected as failed.",
+				Tags:        []string{"admin"},
+				Responses:   responses(ok("DuckDB settings", openapi.SchemaOf(dbsettings.Report{}))),
+			})},
+			"/api/debug/events": {Get: &openapi.Operation{
+				OperationID: "debugEvents",
+				Summary:     "The 50 latest stored events",
+				Tags:        []string{"system"},
+				Responses:   responses(ok("Latest events", openapi.Ref("EventList"))),
+			}},
+			"/api/debug/storage": {Get: &openapi.Operation{
+				OperationID: "debugStorage",
+				Summary:     "Storage backend, event count and Parquet file totals",
+				Tags:        []string{"system"},
+				Responses: responses(ok("Storage details", objectOf(map[string]string{
+					"total_events": "integer", "storage_type": "string", "backend": "string", "database_path": "string",
+					"file_count": "integer", "total_bytes": "integer",
+				}))),
+			}},
+		},
+		Components: &openapi.Components{
+			Schemas: map[string]*openapi.Schema{
+				"Error": {
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"error":      objectOf(map[string]string{"code": "string", "message": "string"}),
+						"request_id": {Type: "string"},
+					},
+				},
+				"Event":          openapi.SchemaOf(domain.Event{}),
+				"EventList":      {Type: "object", Properties: map[string]*openapi.Schema{"events": openapi.ArrayOf(openapi.Ref("Event")), "count": {Type: "integer"}}},
+				"TrackResponse":  objectOf(map[string]string{"status": "string"}),
+				"BatchResponse":  batchResponseSchema(),
+				"StatsMeta":      openapi.SchemaOf(domain.StatsMeta{}),
+				"Overview":       overviewSchema(),
+				"Timeline":       timelineSchema(),
+				"NamedCount":     objectOf(map[string]string{"name": "string", "count": "integer"}),
+				"PageCount":      objectOf(map[string]string{"url": "string", "count": "integer"}),
+				"ScreenSize":     screenSizeSchema(),
+				"VisitorGroup":   objectOf(map[string]string{"users": "integer", "visits": "integer", "events": "integer", "page_views": "integer", "views_per_visit": "number", "percentage": "number"}),
+				"CompareRequest": openapi.SchemaOf(domain.CompareRequest{}),
+				"MetricDelta":    openapi.SchemaOf(domain.MetricDelta{}),
+				"LifetimeUsers":  lifetimeUsersSchema(),
+				"OnlineUsers":    objectOf(map[string]string{"online_users": "integer", "active_sessions": "integer", "time_window_mins": "integer", "cutoff_time": "string"}),
+				"Goal":           openapi.SchemaOf(domain.Goal{}),
+				"GoalInput":      {Type: "object", Properties: map[string]*openapi.Schema{"name": {Type: "string"}, "event_name": {Type: "string"}, "url": {Type: "string"}}, Required: []string{"name"}},
+				"Health":         objectOf(map[string]string{"status": "string", "database": "string", "version": "string", "geolocation": "boolean"}),
+				"Readiness":      readinessSchema(),
+				"GeoLocation":    objectOf(map[string]string{"ip": "string", "country": "string", "country_code": "string", "region": "string", "city": "string"}),
+			},
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"adminBearer": {Type: "http", Scheme: "bearer"},
+				"adminKey":    {Type: "apiKey", Name: "X-Admin-Key", In: "header"},
+			},
+		},
+	}
+}
+
+// statsParams are the query parameters parseFiltersAndDates reads: the date
+// range and the standard filters
+func statsParams() []*openapi.Parameter {
+	return []*openapi.Parameter{
+		queryParam("start", "string", "First day, YYYY-MM-DD (default: 7 days ago)"),
+		queryParam("end", "string", "Last day, inclusive (default: today)"),
+		enumParam("period", "Relative range replacing start and end", domain.Periods...),
+		queryParam("tz", "string", "IANA time zone days are bucketed in and start and end refer to (default: STATS_TZ or UTC)"),
+		queryParam("limit", "integer", "Entries per list, at most 1000 (default: 50)"),
+		queryParam("project", "string", "Only this project"),
+		queryParam("source", "string", "Only this referrer domain or URL"),
+		queryParam("country", "string", "Only this country"),
+		queryParam("device", "string", "Only this device type"),
+		queryParam("os", "string", "Only this operating system"),
+		queryParam("browser", "string", "Only this browser"),
+		queryParam("event", "string", "Only this event name"),
+		queryParam("page", "string", "Only this page URL or URL pattern"),
+		enumParam("botFilter", "Only human or only bot traffic", "human", "bot"),
+		queryParam("exact", "string", "1 to count unique users and sessions exactly instead of approximately"),
+		enumParam("time_basis", "Bucket by the client timestamp or the server ingestion time", domain.TimeBasisEvent, domain.TimeBasisReceived),
+		enumParam("bounce_mode", "What counts as a bounce", domain.BounceSinglePageview, domain.BounceSingleEvent),
+		queryParam("strip_query", "boolean", "Report pages without query string and fragment"),
+		queryParam("meta", "string", "1 to wrap the response in {data, meta}"),
+	}
+}
+
+// topListParams are statsParams with the paging of top lists
+func topListParams() []*openapi.Parameter {
+	return append(statsParams(),
+		queryParam("offset", "integer", "Entries to skip"),
+		enumParam("sort", "Sort by count or name", "count", "name"),
+		enumParam("order", "Sort direction, desc for count and asc for name by default", "asc", "desc"))
+}
+
+// explainParam is the explain parameter of the reports with an explainable query
+func explainParam() *openapi.Parameter {
+	return queryParam("explain", "string", "1 to return the EXPLAIN ANALYZE plan of the query as text instead of the results; needs the admin key")
+}
+
+func metricParam() *openapi.Parameter {
+	return enumParam("metric", "Timeline metric (default: users)", domain.TimelineMetrics...)
+}
+
+func goalIDParam() *openapi.Parameter {
+	return &openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer", Format: "int64"}}
+}
+
+func queryParam(name, typ, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: typ}}
+}
+
+func requiredQueryParam(name, typ, description string) *openapi.Parameter {
+	param := queryParam(name, typ, description)
+	param.Required = true
+	return param
+}
+
+func headerParam(name, typ, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "header", Description: description, Schema: &openapi.Schema{Type: typ}}
+}
+
+func enumParam(name, description string, values ...string) *openapi.Parameter {
+	param := queryParam(name, "string", description)
+	param.Schema.Enum = values
+	return param
+}
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: openapi.JSON(schema)}
+}
+
+func ok(description string, schema *openapi.Schema) *openapi.Response {
+	return &openapi.Response{Description: description, Content: openapi.JSON(schema)}
+}
+
+func file(contentType, description string) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Content:     map[string]*openapi.MediaType{contentType: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+	}
+}
+
+func eventStream(description string) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Content:     map[string]*openapi.MediaType{"text/event-stream": {Schema: &openapi.Schema{Type: "string"}}},
+	}
+}
+
+// responses returns the responses of an operation: success as 200, when given,
+// and errors in the standard error body
+func responses(success *openapi.Response) map[string]*openapi.Response {
+	result := map[string]*openapi.Response{
+		"default": {Description: "Error", Content: openapi.JSON(openapi.Ref("Error"))},
+	}
+	if success != nil {
+		result["200"] = success
+	}
+	return result
+}
+
+func withResponse(result map[string]*openapi.Response, status string, response *openapi.Response) map[string]*openapi.Response {
+	result[status] = response
+	return result
+}
+
+// statsOperation is a GET of the stats tag returning schema
+func statsOperation(id, summary string, params []*openapi.Parameter, schema *openapi.Schema) *openapi.Operation {
+	return &openapi.Operation{
+		OperationID: id,
+		Summary:     summary,
+		Tags:        []string{"stats"},
+		Parameters:  params,
+		Responses:   withResponse(responses(ok(summary, schema)), "504", timedOut()),
+	}
+}
+
+// timedOut is the response of queries running longer than QUERY_TIMEOUT
+func timedOut() *openapi.Response {
+	return &openapi.Response{Description: "The queries took longer than QUERY_TIMEOUT", Content: openapi.JSON(openapi.Ref("Error"))}
+}
+
+// topListOperation is a stats GET returning named counts, with the total in X-Total-Count
+func topListOperation(id, summary string, params []*openapi.Parameter) *openapi.Operation {
+	op := statsOperation(id, summary, params, openapi.ArrayOf(openapi.Ref("NamedCount")))
+	op.Responses["200"].Headers = map[string]*openapi.Header{
+		"X-Total-Count": {Description: "Entries across all pages", Schema: &openapi.Schema{Type: "integer"}},
+	}
+	return op
+}
+
+// adminOperation marks op as requiring ADMIN_API_KEY
+func adminOperation(op *openapi.Operation) *openapi.Operation {
+	op.Security = []map[string][]string{{"adminBearer": {}}, {"adminKey": {}}}
+	return op
+}
+
+// objectOf returns an object schema of the named properties and their types
+func objectOf(properties map[string]string) *openapi.Schema {
+	schema := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+	for name, typ := range properties {
+		schema.Properties[name] = &openapi.Schema{Type: typ}
+	}
+	return schema
+}
+
+func batchResponseSchema() *openapi.Schema {
+	schema := objectOf(map[string]string{"total": "integer", "successful": "integer", "failed": "integer", "dropped": "integer", "deduplicated": "integer"})
+	schema.Properties["status"] = &openapi.Schema{Type: "string", Enum: []string{"ok", "partial", "error"}}
+	schema.Properties["errors"] = openapi.ArrayOf(objectOf(map[string]string{"index": "integer", "error": "string"}))
+	return schema
+}
+
+// readinessSchema describes the /api/health/ready response, domain.Readiness with
+// an overall status
+func readinessSchema() *openapi.Schema {
+	schema := openapi.SchemaOf(domain.Readiness{})
+	schema.Properties["status"] = &openapi.Schema{Type: "string", Enum: []string{"ok", "unavailable"}}
+	return schema
+}
+
+// lifetimeUsersSchema describes domain.LifetimeUsers with its sources
+func lifetimeUsersSchema() *openapi.Schema {
+	schema := openapi.SchemaOf(domain.LifetimeUsers{})
+	schema.Properties["source"].Enum = []string{domain.LifetimeSourceSketch, domain.LifetimeSourceScan}
+	return schema
+}
+
+// overviewSchema describes domain.TopStatsResult with _meta pointing to StatsMeta
+func overviewSchema() *openapi.Schema {
+	schema := openapi.SchemaOf(domain.TopStatsResult{})
+	schema.Properties["_meta"] = openapi.Ref("StatsMeta")
+	return schema
+}
+
+func timelineSchema() *openapi.Schema {
+	return &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"timeline":        openapi.ArrayOf(objectOf(map[string]string{"date": "string", "count": "number"})),
+			"timeline_format": {Type: "string", Enum: []string{"hour", "day", "month"}},
+		},
+	}
+}
+
+func screenSizeSchema() *openapi.Schema {
+	buckets := make([]string, len(domain.ScreenBuckets))
+	for i, bucket := range domain.ScreenBuckets {
+		buckets[i] = bucket.Name
+	}
+	schema := objectOf(map[string]string{"min_width": "integer", "events": "integer", "visitors": "integer", "percentage": "number"})
+	schema.Properties["bucket"] = &openapi.Schema{Type: "string", Enum: buckets}
+	schema.Properties["max_width"] = &openapi.Schema{Type: "integer", Nullable: true}
+	return schema
+}
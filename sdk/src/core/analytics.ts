@@ -140,6 +140,8 @@ class AnalyticsCore {
             browser: deviceInfo.browser,
             os: deviceInfo.os,
             device: deviceInfo.device,
+            screen_width: deviceInfo.screen_width,
+            screen_height: deviceInfo.screen_height,
             project_id: this.config.projectId,
             channel: channel,
             ...properties,
@@ -27,6 +27,8 @@ export interface EventData {
   browser: string;
   os: string;
   device: string;
+  screen_width?: number;
+  screen_height?: number;
   project_id: string;
   channel: string;
 }